@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// dispatchInterval is how often the load generator releases a slice of the
+// target QPS; finer ticks are unreliable on most schedulers.
+const dispatchInterval = 10 * time.Millisecond
+
+type benchOptions struct {
+	strategies []string
+	qps        int
+	duration   time.Duration
+	workers    int
+	keys       int
+	redisAddr  string
+}
+
+type benchResult struct {
+	strategy  string
+	requests  int
+	allowed   int
+	denied    int
+	errors    int
+	elapsed   time.Duration
+	latencies []time.Duration
+}
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	opts := parseFlags(cfg)
+
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     opts.redisAddr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+		PoolSize: opts.workers,
+	})
+	defer redisClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		cancel()
+		log.Fatalf("failed to connect to Redis at %s: %v", opts.redisAddr, err)
+	}
+	cancel()
+
+	collectors := metrics.NewRegistry("noop", metrics.NewNoopCollector())
+
+	results := make([]benchResult, 0, len(opts.strategies))
+	for _, strategy := range opts.strategies {
+		strategyConfig := cfg.RateLimiter
+		strategyConfig.Strategy = strategy
+
+		rateLimiter, err := ratelimit.NewConfigBasedStrategyManager(&strategyConfig, redisClient, collectors).GetCurrentStrategy()
+		if err != nil {
+			log.Fatalf("failed to build %s: %v", strategy, err)
+		}
+
+		log.Printf("benchmarking %s at %d qps for %s", strategy, opts.qps, opts.duration)
+		result := run(rateLimiter, opts)
+		result.strategy = strategy
+		results = append(results, result)
+
+		resetKeys(rateLimiter, opts.keys)
+	}
+
+	report(results)
+}
+
+func parseFlags(cfg *config.Config) benchOptions {
+	strategies := flag.String("strategies", cfg.RateLimiter.Strategy, "comma-separated strategies to compare, or \"all\"")
+	qps := flag.Int("qps", 1000, "target requests per second")
+	duration := flag.Duration("duration", 10*time.Second, "how long to drive each strategy")
+	workers := flag.Int("workers", 50, "concurrent callers")
+	keys := flag.Int("keys", 100, "number of distinct client keys")
+	redisAddr := flag.String("redis", fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port), "Redis address")
+	flag.Parse()
+
+	if *qps <= 0 || *workers <= 0 || *keys <= 0 || *duration <= 0 {
+		log.Fatal("qps, workers, keys and duration must be positive")
+	}
+
+	var names []string
+	if *strategies == "all" {
+		names = ratelimit.NewFactory(nil).GetAvailableStrategies()
+		sort.Strings(names)
+	} else {
+		for _, name := range strings.Split(*strategies, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return benchOptions{
+		strategies: names,
+		qps:        *qps,
+		duration:   *duration,
+		workers:    *workers,
+		keys:       *keys,
+		redisAddr:  *redisAddr,
+	}
+}
+
+// run paces requests at opts.qps across opts.workers callers. Requests that
+// can't be picked up because every worker is busy are dropped, so the achieved
+// rate in the report shows when the limiter is the bottleneck.
+func run(rateLimiter ratelimit.RateLimiter, opts benchOptions) benchResult {
+	jobs := make(chan string, opts.workers)
+	var mu sync.Mutex
+	result := benchResult{latencies: make([]time.Duration, 0, opts.qps*int(opts.duration.Seconds()+1))}
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				start := time.Now()
+				response, err := rateLimiter.IsAllowed(ctx, key, start)
+				latency := time.Since(start)
+				cancel()
+
+				mu.Lock()
+				result.requests++
+				result.latencies = append(result.latencies, latency)
+				switch {
+				case err != nil:
+					result.errors++
+				case response.Allowed:
+					result.allowed++
+				default:
+					result.denied++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	perTick := float64(opts.qps) * dispatchInterval.Seconds()
+	ticker := time.NewTicker(dispatchInterval)
+	deadline := time.After(opts.duration)
+	start := time.Now()
+	var owed float64
+
+dispatch:
+	for {
+		select {
+		case <-deadline:
+			break dispatch
+		case <-ticker.C:
+			owed += perTick
+			for ; owed >= 1; owed-- {
+				select {
+				case jobs <- fmt.Sprintf("bench:%d", rand.Intn(opts.keys)):
+				default:
+				}
+			}
+		}
+	}
+	ticker.Stop()
+	close(jobs)
+	wg.Wait()
+
+	result.elapsed = time.Since(start)
+	return result
+}
+
+func resetKeys(rateLimiter ratelimit.RateLimiter, keys int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for i := 0; i < keys; i++ {
+		if err := rateLimiter.Reset(ctx, fmt.Sprintf("bench:%d", i)); err != nil {
+			log.Printf("failed to reset bench keys: %v", err)
+			return
+		}
+	}
+}
+
+func report(results []benchResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STRATEGY\tREQUESTS\tQPS\tALLOWED\tDENIED\tERRORS\tP50\tP95\tP99")
+	for _, r := range results {
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+		fmt.Fprintf(w, "%s\t%d\t%.0f\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			r.strategy,
+			r.requests,
+			float64(r.requests)/r.elapsed.Seconds(),
+			ratio(r.allowed, r.requests),
+			ratio(r.denied, r.requests),
+			r.errors,
+			percentile(r.latencies, 0.50),
+			percentile(r.latencies, 0.95),
+			percentile(r.latencies, 0.99),
+		)
+	}
+	w.Flush()
+}
+
+func ratio(part, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(part)/float64(total))
+}
+
+// percentile expects sorted latencies.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	index := int(p * float64(len(latencies)-1))
+	return latencies[index].Round(time.Microsecond)
+}
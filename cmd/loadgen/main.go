@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+)
+
+// dispatchInterval is how often the load generator releases a slice of the
+// target QPS; finer ticks are unreliable on most schedulers.
+const dispatchInterval = 10 * time.Millisecond
+
+// profiles are the traffic shapes a soak can replay. Each gives the target
+// rate at elapsed time t and picks the key of the next request.
+var profiles = []string{"steady", "bursty", "ramp", "hotkey"}
+
+type loadOptions struct {
+	profiles    []string
+	server      string
+	path        string
+	qps         int
+	duration    time.Duration
+	workers     int
+	keys        int
+	burstFactor float64
+	burstEvery  time.Duration
+	burstLength time.Duration
+	hotFraction float64
+	model       limitModel
+}
+
+// limitModel is the limit each key is expected to be held to, replayed
+// client-side against the times requests were sent to work out how many of
+// them an exact limiter would have allowed.
+type limitModel struct {
+	kind   string
+	limit  int64
+	window time.Duration
+}
+
+const (
+	// modelBucket refills limit tokens per window, starting full.
+	modelBucket = "bucket"
+	// modelSliding allows limit requests in any window.
+	modelSliding = "sliding"
+	// modelFixed allows limit requests per window aligned to the epoch.
+	modelFixed = "fixed"
+)
+
+type sample struct {
+	at      time.Time
+	allowed bool
+}
+
+type loadResult struct {
+	profile  string
+	requests int
+	allowed  int
+	denied   int
+	errors   int
+	elapsed  time.Duration
+	samples  map[int][]sample
+}
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	opts := parseFlags(cfg)
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: opts.workers},
+	}
+
+	// Keys are unique to the run so that state left by an earlier soak
+	// doesn't count against this one.
+	run := fmt.Sprintf("loadgen:%d", time.Now().Unix())
+
+	results := make([]loadResult, 0, len(opts.profiles))
+	for _, profile := range opts.profiles {
+		log.Printf("replaying %s at %d qps for %s against %s%s", profile, opts.qps, opts.duration, opts.server, opts.path)
+		result := replay(client, profile, run+":"+profile, opts)
+		result.profile = profile
+		results = append(results, result)
+	}
+
+	report(results, opts)
+}
+
+func parseFlags(cfg *config.Config) loadOptions {
+	names := flag.String("profiles", "steady", "comma-separated traffic profiles ("+strings.Join(profiles, ", ")+"), or \"all\"")
+	server := flag.String("server", "http://localhost:"+cfg.Server.Port, "base URL of the server")
+	path := flag.String("path", "/api/restricted", "rate-limited endpoint to call")
+	qps := flag.Int("qps", 200, "target requests per second, the peak for ramp")
+	duration := flag.Duration("duration", 30*time.Second, "how long to replay each profile")
+	workers := flag.Int("workers", 50, "concurrent callers")
+	keys := flag.Int("keys", 10, "number of distinct client keys")
+	burstFactor := flag.Float64("burst-factor", 5, "bursty: rate multiplier during a burst")
+	burstEvery := flag.Duration("burst-every", 5*time.Second, "bursty: time between the start of bursts")
+	burstLength := flag.Duration("burst-length", time.Second, "bursty: how long a burst lasts")
+	hotFraction := flag.Float64("hot-fraction", 0.8, "hotkey: share of requests sent to a single key")
+	strategy := flag.String("strategy", cfg.RateLimiter.Strategy, "strategy the server runs, used to derive the expected limit")
+	limit := flag.Int64("limit", 0, "requests allowed per key per window; derived from the strategy's config when 0")
+	window := flag.Duration("window", 0, "window of -limit; derived from the strategy's config when 0")
+	flag.Parse()
+
+	if *qps <= 0 || *workers <= 0 || *keys <= 0 || *duration <= 0 {
+		log.Fatal("qps, workers, keys and duration must be positive")
+	}
+	if *burstFactor < 1 || *burstEvery <= 0 || *burstLength <= 0 || *burstLength > *burstEvery {
+		log.Fatal("burst-factor must be at least 1 and burst-length between 0 and burst-every")
+	}
+	if *hotFraction < 0 || *hotFraction > 1 {
+		log.Fatal("hot-fraction must be between 0 and 1")
+	}
+
+	var selected []string
+	if *names == "all" {
+		selected = profiles
+	} else {
+		for _, name := range strings.Split(*names, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if !slices.Contains(profiles, name) {
+				log.Fatalf("unknown profile %q; expected one of %s", name, strings.Join(profiles, ", "))
+			}
+			selected = append(selected, name)
+		}
+	}
+
+	model, err := modelFor(cfg.RateLimiter.Strategies, *strategy, *limit, *window)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return loadOptions{
+		profiles:    selected,
+		server:      strings.TrimSuffix(*server, "/"),
+		path:        *path,
+		qps:         *qps,
+		duration:    *duration,
+		workers:     *workers,
+		keys:        *keys,
+		burstFactor: *burstFactor,
+		burstEvery:  *burstEvery,
+		burstLength: *burstLength,
+		hotFraction: *hotFraction,
+		model:       model,
+	}
+}
+
+// modelFor derives the expected limit from the strategy's config, with limit
+// and window overriding it. Strategies without a single per-key limit, such as
+// hierarchical, need both overrides.
+func modelFor(strategies config.RateLimiterStrategiesConfig, strategy string, limit int64, window time.Duration) (limitModel, error) {
+	var model limitModel
+	switch strategy {
+	case "token_bucket":
+		bucket := strategies.TokenBucket
+		model = limitModel{kind: modelBucket, limit: bucket.BucketSize}
+		if bucket.RefillRatePerSecond > 0 {
+			model.window = time.Duration(float64(bucket.BucketSize) / float64(bucket.RefillRatePerSecond) * float64(time.Second))
+		}
+	case "sliding_window_log":
+		swl := strategies.SlidingWindowLog
+		model = limitModel{kind: modelSliding, limit: swl.BucketSize, window: time.Duration(swl.WindowSizeSeconds) * time.Second}
+	case "sliding_window_counter":
+		counter := strategies.SlidingWindowCounter
+		model = limitModel{kind: modelSliding, limit: counter.BucketSize, window: time.Duration(counter.WindowSizeSeconds) * time.Second}
+	case "fixed_window":
+		fixed := strategies.FixedWindow
+		model = limitModel{kind: modelFixed, limit: fixed.BucketSize, window: time.Duration(fixed.WindowSizeSeconds) * time.Second}
+	case "quota":
+		// A quota period outlasts any soak, so it behaves as a bucket that
+		// never refills.
+		model = limitModel{kind: modelBucket, limit: strategies.Quota.Limit}
+	default:
+		if limit <= 0 || window <= 0 {
+			return limitModel{}, fmt.Errorf("set -limit and -window to check %s", strategy)
+		}
+		model = limitModel{kind: modelSliding}
+	}
+	if limit > 0 {
+		model.limit = limit
+	}
+	if window > 0 {
+		model.window = window
+	}
+	if model.limit <= 0 {
+		return limitModel{}, fmt.Errorf("no limit configured for %s; set -limit", strategy)
+	}
+	if model.kind != modelBucket && model.window <= 0 {
+		return limitModel{}, fmt.Errorf("no window configured for %s; set -window", strategy)
+	}
+	return model, nil
+}
+
+// rate is the target rate of profile at elapsed time t.
+func rate(profile string, t time.Duration, opts loadOptions) float64 {
+	switch profile {
+	case "bursty":
+		if t%opts.burstEvery < opts.burstLength {
+			return float64(opts.qps) * opts.burstFactor
+		}
+	case "ramp":
+		return float64(opts.qps) * min(1, t.Seconds()/opts.duration.Seconds())
+	}
+	return float64(opts.qps)
+}
+
+// pickKey spreads requests evenly over the keys, except for hotkey, which
+// sends opts.hotFraction of them to key 0.
+func pickKey(profile string, opts loadOptions) int {
+	if profile == "hotkey" && (opts.keys == 1 || rand.Float64() < opts.hotFraction) {
+		return 0
+	}
+	if profile == "hotkey" {
+		return 1 + rand.Intn(opts.keys-1)
+	}
+	return rand.Intn(opts.keys)
+}
+
+// replay paces requests along profile across opts.workers callers. Like
+// cmd/bench, requests that can't be picked up because every worker is busy are
+// dropped rather than queued, so they never count against a key.
+func replay(client *http.Client, profile, prefix string, opts loadOptions) loadResult {
+	jobs := make(chan int, opts.workers)
+	var mu sync.Mutex
+	result := loadResult{samples: make(map[int][]sample, opts.keys)}
+	url := opts.server + opts.path
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				at := time.Now()
+				status, err := send(client, url, fmt.Sprintf("%s:%d", prefix, key))
+
+				mu.Lock()
+				result.requests++
+				switch {
+				case err != nil || (status != http.StatusOK && status != http.StatusTooManyRequests):
+					result.errors++
+				case status == http.StatusOK:
+					result.allowed++
+					result.samples[key] = append(result.samples[key], sample{at: at, allowed: true})
+				default:
+					result.denied++
+					result.samples[key] = append(result.samples[key], sample{at: at})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(dispatchInterval)
+	deadline := time.After(opts.duration)
+	start := time.Now()
+	var owed float64
+
+dispatch:
+	for {
+		select {
+		case <-deadline:
+			break dispatch
+		case now := <-ticker.C:
+			owed += rate(profile, now.Sub(start), opts) * dispatchInterval.Seconds()
+			for ; owed >= 1; owed-- {
+				select {
+				case jobs <- pickKey(profile, opts):
+				default:
+				}
+			}
+		}
+	}
+	ticker.Stop()
+	close(jobs)
+	wg.Wait()
+
+	result.elapsed = time.Since(start)
+	return result
+}
+
+func send(client *http.Client, url, key string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("X-Client-ID", key)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// expected replays a key's requests, in the order they were sent, against an
+// exact limiter following model, and returns how many it allows.
+func expected(model limitModel, samples []sample) int {
+	sort.Slice(samples, func(i, j int) bool { return samples[i].at.Before(samples[j].at) })
+
+	allowed := 0
+	switch model.kind {
+	case modelBucket:
+		tokens := float64(model.limit)
+		var refill float64
+		if model.window > 0 {
+			refill = float64(model.limit) / model.window.Seconds()
+		}
+		for i, s := range samples {
+			if i > 0 {
+				tokens = math.Min(float64(model.limit), tokens+s.at.Sub(samples[i-1].at).Seconds()*refill)
+			}
+			if tokens >= 1 {
+				tokens--
+				allowed++
+			}
+		}
+	case modelSliding:
+		var admitted []time.Time
+		for _, s := range samples {
+			for len(admitted) > 0 && s.at.Sub(admitted[0]) >= model.window {
+				admitted = admitted[1:]
+			}
+			if int64(len(admitted)) < model.limit {
+				admitted = append(admitted, s.at)
+				allowed++
+			}
+		}
+	case modelFixed:
+		counts := make(map[int64]int64)
+		for _, s := range samples {
+			window := s.at.UnixNano() / int64(model.window)
+			if counts[window] < model.limit {
+				counts[window]++
+				allowed++
+			}
+		}
+	}
+	return allowed
+}
+
+// report compares what the server allowed with what an exact limiter would
+// have. OVER counts requests allowed beyond the model's allowance per key,
+// the figure that matters for correctness; approximate strategies such as
+// sliding_window_counter are expected to show a little.
+func report(results []loadResult, opts loadOptions) {
+	fmt.Printf("limit: %d per %s per key (%s model)\n\n", opts.model.limit, opts.model.window, opts.model.kind)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tREQUESTS\tQPS\tALLOWED\tEXPECTED\tACCURACY\tOVER\tUNDER\tERRORS\tALLOWED/S/KEY\tLIMIT/S/KEY")
+	for _, r := range results {
+		want, over, under := 0, 0, 0
+		for _, samples := range r.samples {
+			got := 0
+			for _, s := range samples {
+				if s.allowed {
+					got++
+				}
+			}
+			exact := expected(opts.model, samples)
+			want += exact
+			if got > exact {
+				over += got - exact
+			} else {
+				under += exact - got
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%.0f\t%d\t%d\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			r.profile,
+			r.requests,
+			float64(r.requests)/r.elapsed.Seconds(),
+			r.allowed,
+			want,
+			accuracy(over+under, want),
+			over,
+			under,
+			r.errors,
+			keyRate(r),
+			limitRate(opts.model),
+		)
+	}
+	w.Flush()
+}
+
+// keyRate is the allowed rate of the busiest key, the one held at its limit.
+func keyRate(r loadResult) string {
+	busiest := 0
+	for _, samples := range r.samples {
+		allowed := 0
+		for _, s := range samples {
+			if s.allowed {
+				allowed++
+			}
+		}
+		busiest = max(busiest, allowed)
+	}
+	return fmt.Sprintf("%.2f", float64(busiest)/r.elapsed.Seconds())
+}
+
+func limitRate(model limitModel) string {
+	if model.window <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", float64(model.limit)/model.window.Seconds())
+}
+
+// accuracy is the share of expected decisions the server matched.
+func accuracy(mismatched, expected int) string {
+	if expected == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*math.Max(0, 1-float64(mismatched)/float64(expected)))
+}
@@ -0,0 +1,413 @@
+// Command rlctl inspects and operates a running rate limiter through its HTTP
+// API.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/events"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+const usage = `Usage: rlctl [flags] <command> [args]
+
+Commands:
+  check <key> [-peek]              consume one request for key, or only report its usage
+  reset <key> [-prefix] [-policy]  clear a key, or every key starting with it
+  top [-limit n]                   list the highest-traffic and most-throttled keys
+  strategy [name]                  show the current strategy, or switch to name
+  tail [-decision d]               follow decisions as they are made
+
+Flags:
+`
+
+type client struct {
+	server    string
+	token     string
+	namespace string
+	http      *http.Client
+	json      bool
+	out       io.Writer
+}
+
+// apiError is the server's error body, or its problem details when
+// server.problem_json is enabled.
+type apiError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Title   string `json:"title"`
+	Detail  string `json:"detail"`
+}
+
+func main() {
+	flags := flag.NewFlagSet("rlctl", flag.ExitOnError)
+	server := flags.String("server", envOr("RLCTL_SERVER", "http://localhost:8080"), "rate limiter base URL (RLCTL_SERVER)")
+	token := flags.String("token", os.Getenv("RLCTL_TOKEN"), "admin bearer token (RLCTL_TOKEN)")
+	namespace := flags.String("namespace", "", "namespace of the keys")
+	timeout := flags.Duration("timeout", 10*time.Second, "request timeout, except for tail")
+	asJSON := flags.Bool("json", false, "print the server's JSON responses")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	c := &client{
+		server:    strings.TrimRight(*server, "/"),
+		token:     *token,
+		namespace: *namespace,
+		http:      &http.Client{Timeout: *timeout},
+		json:      *asJSON,
+		out:       os.Stdout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	command, args := flags.Arg(0), flags.Args()[1:]
+	var err error
+	switch command {
+	case "check":
+		err = c.check(ctx, args)
+	case "reset":
+		err = c.reset(ctx, args)
+	case "top":
+		err = c.top(ctx, args)
+	case "strategy":
+		err = c.strategy(ctx, args)
+	case "tail":
+		err = c.tail(ctx, args)
+	default:
+		err = fmt.Errorf("unknown command %q", command)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rlctl:", err)
+		os.Exit(1)
+	}
+}
+
+func (c *client) check(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	peek := flags.Bool("peek", false, "report usage without consuming a request")
+	key, err := parseKeyArgs(flags, args)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Allowed   *bool                  `json:"allowed"`
+		Limit     int64                  `json:"limit"`
+		Used      int64                  `json:"used"`
+		Remaining int64                  `json:"remaining"`
+		ResetTime time.Time              `json:"reset_time"`
+		Metadata  map[string]interface{} `json:"metadata"`
+	}
+
+	if *peek {
+		body, err := c.do(ctx, http.MethodGet, "/rate-limit/status?key="+url.QueryEscape(key), nil, nil, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return c.print(body)
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "%s: %d/%d used, %d remaining, resets %s\n",
+			key, result.Used, result.Limit, result.Remaining, result.ResetTime.Local().Format(time.RFC3339))
+		return nil
+	}
+
+	headers := http.Header{"X-Client-ID": {key}}
+	body, err := c.do(ctx, http.MethodPost, "/rate-limit", nil, headers, http.StatusOK, http.StatusTooManyRequests)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(body)
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+
+	decision := "denied"
+	if result.Allowed != nil && *result.Allowed {
+		decision = "allowed"
+	}
+	fmt.Fprintf(c.out, "%s: %s\n", key, decision)
+	return nil
+}
+
+func (c *client) reset(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("reset", flag.ExitOnError)
+	prefix := flags.Bool("prefix", false, "clear every key starting with key")
+	policy := flags.String("policy", ratelimit.DefaultPolicyName, "policy holding the key")
+	key, err := parseKeyArgs(flags, args)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"policy": {*policy}}
+	if c.namespace != "" {
+		query.Set("namespace", c.namespace)
+	}
+	if *prefix {
+		query.Set("prefix", "true")
+	}
+
+	body, err := c.do(ctx, http.MethodDelete, "/admin/keys/"+url.PathEscape(key)+"?"+query.Encode(), nil, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(body)
+	}
+
+	var result struct {
+		Deleted *int64 `json:"deleted"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	if result.Deleted != nil {
+		fmt.Fprintf(c.out, "reset keys starting with %s (%d deleted)\n", key, *result.Deleted)
+		return nil
+	}
+	fmt.Fprintf(c.out, "reset %s\n", key)
+	return nil
+}
+
+func (c *client) top(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("top", flag.ExitOnError)
+	limit := flags.Int("limit", 10, "keys to list, 1-1000")
+	flags.Parse(args)
+
+	body, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/admin/analytics/top-keys?limit=%d", *limit), nil, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(body)
+	}
+
+	var report ratelimit.TopKeysReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "HIGHEST TRAFFIC (last %ds)\tREQUESTS\n", report.WindowSeconds)
+	for _, key := range report.HighestTraffic {
+		fmt.Fprintf(w, "%s\t%d\n", key.Key, key.Count)
+	}
+	fmt.Fprintf(w, "\nMOST THROTTLED\tDENIED\n")
+	for _, key := range report.MostThrottled {
+		fmt.Fprintf(w, "%s\t%d\n", key.Key, key.Count)
+	}
+	return w.Flush()
+}
+
+func (c *client) strategy(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New("strategy takes at most one name")
+	}
+
+	var result struct {
+		Strategy string `json:"strategy"`
+	}
+
+	var body []byte
+	var err error
+	if len(args) == 0 {
+		body, err = c.do(ctx, http.MethodGet, "/admin/stats", nil, nil, http.StatusOK)
+	} else {
+		request, _ := json.Marshal(map[string]string{"strategy": args[0]})
+		body, err = c.do(ctx, http.MethodPut, "/admin/strategy", request, nil, http.StatusOK)
+	}
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(body)
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, result.Strategy)
+	return nil
+}
+
+func (c *client) tail(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ExitOnError)
+	decision := flags.String("decision", "", "only show allowed, denied or error decisions")
+	flags.Parse(args)
+
+	path := "/admin/decisions/tail"
+	if *decision != "" {
+		path += "?decision=" + url.QueryEscape(*decision)
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	// The stream stays open until interrupted, so only the client timeout of
+	// other commands is dropped.
+	resp, err := (&http.Client{Transport: c.http.Transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return responseError(resp.StatusCode, body)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		if c.json {
+			fmt.Fprintln(c.out, data)
+			continue
+		}
+
+		var event events.Decision
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%dus\n", event.Time.Local().Format("15:04:05.000"),
+			event.Decision, event.KeyHash, event.Strategy, orDash(event.Namespace), event.LatencyMicros)
+		w.Flush()
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+// do sends a request and returns the body when the status is one of ok.
+func (c *client) do(ctx context.Context, method, path string, body []byte, headers http.Header, ok ...int) ([]byte, error) {
+	req, err := c.newRequest(ctx, method, path, body, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			return respBody, nil
+		}
+	}
+	return nil, responseError(resp.StatusCode, respBody)
+}
+
+func (c *client) newRequest(ctx context.Context, method, path string, body []byte, headers http.Header) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-RateLimit-Namespace", c.namespace)
+	}
+	return req, nil
+}
+
+func (c *client) print(body []byte) error {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		return err
+	}
+	indented.WriteByte('\n')
+	_, err := indented.WriteTo(c.out)
+	return err
+}
+
+func responseError(status int, body []byte) error {
+	var apiErr apiError
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error == "" {
+		apiErr.Error, apiErr.Message = apiErr.Title, apiErr.Detail
+	}
+	if apiErr.Error != "" {
+		if apiErr.Message != "" {
+			return fmt.Errorf("%s: %s (%d)", apiErr.Error, apiErr.Message, status)
+		}
+		return fmt.Errorf("%s (%d)", apiErr.Error, status)
+	}
+	return fmt.Errorf("unexpected status %d", status)
+}
+
+// parseKeyArgs accepts flags before or after the key.
+func parseKeyArgs(flags *flag.FlagSet, args []string) (string, error) {
+	var key string
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		if key != "" {
+			return "", fmt.Errorf("%s takes one key", flags.Name())
+		}
+		key, args = args[0], args[1:]
+	}
+	if key == "" {
+		return "", fmt.Errorf("%s needs a key", flags.Name())
+	}
+	return key, nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
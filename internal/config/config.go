@@ -1,38 +1,747 @@
 package config
 
 type Config struct {
-	Server      ServerConfig      `mapstructure:"server"`
-	Redis       RedisConfig       `mapstructure:"redis"`
-	RateLimiter RateLimiterConfig `mapstructure:"rate_limiter"`
+	Server         ServerConfig         `mapstructure:"server"`
+	Redis          RedisConfig          `mapstructure:"redis"`
+	Postgres       PostgresConfig       `mapstructure:"postgres"`
+	RateLimiter    RateLimiterConfig    `mapstructure:"rate_limiter"`
+	Observability  ObservabilityConfig  `mapstructure:"observability"`
+	Namespaces     NamespacesConfig     `mapstructure:"namespaces"`
+	DenialLog      DenialLogConfig      `mapstructure:"denial_log"`
+	AuditLog       AuditLogConfig       `mapstructure:"audit_log"`
+	Sandbox        SandboxConfig        `mapstructure:"sandbox"`
+	Rules          RulesConfig          `mapstructure:"rules"`
+	Classification ClassificationConfig `mapstructure:"classification"`
+	LoadShedding   LoadSheddingConfig   `mapstructure:"load_shedding"`
+	Crawlers       CrawlersConfig       `mapstructure:"crawlers"`
+	Penalties      PenaltiesConfig      `mapstructure:"penalties"`
+	Notifications  NotificationsConfig  `mapstructure:"notifications"`
+	DecisionStream DecisionStreamConfig `mapstructure:"decision_stream"`
+	Analytics      AnalyticsConfig      `mapstructure:"analytics"`
+	Dashboard      DashboardConfig      `mapstructure:"dashboard"`
+	AdminAuth      AdminAuthConfig      `mapstructure:"admin_auth"`
+	Regions        RegionsConfig        `mapstructure:"regions"`
+	KeyUsage       KeyUsageConfig       `mapstructure:"key_usage"`
+	Housekeeping   HousekeepingConfig   `mapstructure:"housekeeping"`
+}
+
+// HousekeepingConfig runs background jobs over shared state, such as active
+// key scans and idle key purges, on the instance holding a lease in Redis
+// under LeaseKey only. Without LeaderElection every instance runs them.
+type HousekeepingConfig struct {
+	LeaderElection  bool   `mapstructure:"leader_election"`
+	LeaseKey        string `mapstructure:"lease_key"`
+	LeaseTTLSeconds int    `mapstructure:"lease_ttl_seconds"`
+}
+
+// KeyUsageConfig sizes the per-prefix key report at /admin/keys/usage and
+// the optional background purge of keys idle for IdleSeconds, and paces key
+// migrations at /admin/keys/migrate.
+type KeyUsageConfig struct {
+	ScanCount  int64                   `mapstructure:"scan_count"`
+	SampleSize int64                   `mapstructure:"sample_size"`
+	Purge      KeyUsagePurgeConfig     `mapstructure:"purge"`
+	Migration  KeyUsageMigrationConfig `mapstructure:"migration"`
+}
+
+type KeyUsagePurgeConfig struct {
+	Enabled         bool `mapstructure:"enabled"`
+	IdleSeconds     int  `mapstructure:"idle_seconds"`
+	IntervalSeconds int  `mapstructure:"interval_seconds"`
+}
+
+type KeyUsageMigrationConfig struct {
+	KeysPerSecond float64 `mapstructure:"keys_per_second"`
+}
+
+// RegionsConfig splits the default policy's limit between regions that each
+// run their own Redis.
+type RegionsConfig struct {
+	Enabled                  bool                   `mapstructure:"enabled"`
+	Name                     string                 `mapstructure:"name"`
+	Shares                   map[string]float64     `mapstructure:"shares"`
+	Peers                    map[string]RedisConfig `mapstructure:"peers"`
+	ReconcileIntervalSeconds int                    `mapstructure:"reconcile_interval_seconds"`
+	MinShareFraction         float64                `mapstructure:"min_share_fraction"`
+}
+
+type AdminAuthConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Tokens are keyed by a name for the caller; ClientCerts by the common
+	// name of a client certificate verified against server.tls_client_ca_file.
+	Tokens      map[string]AdminTokenConfig      `mapstructure:"tokens"`
+	ClientCerts map[string]AdminClientCertConfig `mapstructure:"client_certs"`
+}
+
+type AdminTokenConfig struct {
+	Token string `mapstructure:"token"`
+	Role  string `mapstructure:"role"`
+}
+
+type AdminClientCertConfig struct {
+	Role string `mapstructure:"role"`
+}
+
+type DashboardConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+type AnalyticsConfig struct {
+	TopKeys  TopKeysConfig  `mapstructure:"top_keys"`
+	KeyStats KeyStatsConfig `mapstructure:"key_stats"`
+}
+
+// TopKeysConfig enables per-key counters written by the rate limit scripts.
+// It adds two sorted set writes to every decision.
+type TopKeysConfig struct {
+	Enabled           bool `mapstructure:"enabled"`
+	WindowSeconds     int  `mapstructure:"window_seconds"`
+	ResolutionSeconds int  `mapstructure:"resolution_seconds"`
+}
+
+// KeyStatsConfig adds rolling per-key statistics to every decision, kept in
+// the fields of the strategy's own hash.
+type KeyStatsConfig struct {
+	Enabled       bool `mapstructure:"enabled"`
+	WindowSeconds int  `mapstructure:"window_seconds"`
+}
+
+type DecisionStreamConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Backend is the broker to publish to; only "nats" is built in.
+	Backend         string `mapstructure:"backend"`
+	Address         string `mapstructure:"address"`
+	Subject         string `mapstructure:"subject"`
+	BatchSize       int    `mapstructure:"batch_size"`
+	FlushIntervalMs int    `mapstructure:"flush_interval_ms"`
+	BufferSize      int    `mapstructure:"buffer_size"`
+}
+
+type NotificationsConfig struct {
+	Enabled     bool     `mapstructure:"enabled"`
+	WebhookURLs []string `mapstructure:"webhook_urls"`
+	// Events limits delivery to these event types; empty delivers all.
+	Events           []string `mapstructure:"events"`
+	CooldownSeconds  int      `mapstructure:"cooldown_seconds"`
+	MaxRetries       int      `mapstructure:"max_retries"`
+	InitialBackoffMs int      `mapstructure:"initial_backoff_ms"`
+	TimeoutMs        int      `mapstructure:"timeout_ms"`
+	QueueSize        int      `mapstructure:"queue_size"`
+}
+
+type PenaltiesConfig struct {
+	Escalation EscalationConfig `mapstructure:"escalation"`
+}
+
+// EscalationConfig bans a key for BanSeconds once it has been denied more
+// than MaxViolations times within WindowSeconds.
+type EscalationConfig struct {
+	Enabled       bool  `mapstructure:"enabled"`
+	MaxViolations int64 `mapstructure:"max_violations"`
+	WindowSeconds int   `mapstructure:"window_seconds"`
+	BanSeconds    int   `mapstructure:"ban_seconds"`
+}
+
+type RulesConfig struct {
+	Enabled    bool         `mapstructure:"enabled"`
+	TierHeader string       `mapstructure:"tier_header"`
+	Rules      []RuleConfig `mapstructure:"rules"`
+	// Etcd shares the rules between instances through etcd. Rules is only
+	// used until a rule set has been pushed there.
+	Etcd RulesEtcdConfig `mapstructure:"etcd"`
+}
+
+// RulesEtcdConfig is where the versioned rule sets live in etcd.
+type RulesEtcdConfig struct {
+	Enabled       bool     `mapstructure:"enabled"`
+	Endpoints     []string `mapstructure:"endpoints"`
+	Prefix        string   `mapstructure:"prefix"`
+	Username      string   `mapstructure:"username"`
+	Password      string   `mapstructure:"password"`
+	DialTimeoutMs int      `mapstructure:"dial_timeout_ms"`
+}
+
+// RuleConfig is also the JSON form of a rule in etcd.
+type RuleConfig struct {
+	Name   string          `mapstructure:"name" json:"name"`
+	Match  RuleMatchConfig `mapstructure:"match" json:"match"`
+	Action string          `mapstructure:"action" json:"action"`
+	// Template names a rate_limiter.templates entry filling in the
+	// Strategy, Limit and WindowSeconds left empty or zero.
+	Template string `mapstructure:"template" json:"template,omitempty"`
+	// Strategy, Limit and WindowSeconds apply to the limit action; empty or
+	// zero values fall back to rate_limiter settings.
+	Strategy      string `mapstructure:"strategy" json:"strategy,omitempty"`
+	Limit         int64  `mapstructure:"limit" json:"limit,omitempty"`
+	WindowSeconds int    `mapstructure:"window_seconds" json:"window_seconds,omitempty"`
+}
+
+// ClassificationConfig tags /api requests with a class before limiting.
+// Classes are tried in order, then the bot user agent heuristic, then
+// requests without any credential header are anonymous.
+type ClassificationConfig struct {
+	Enabled           bool          `mapstructure:"enabled"`
+	BotUserAgents     []string      `mapstructure:"bot_user_agents"`
+	CredentialHeaders []string      `mapstructure:"credential_headers"`
+	Classes           []ClassConfig `mapstructure:"classes"`
+}
+
+// ClassConfig is a class's match and limit profile. A class without match
+// fields is only assigned by the built-in heuristics, e.g. bot or anonymous.
+type ClassConfig struct {
+	Name  string           `mapstructure:"name"`
+	Match ClassMatchConfig `mapstructure:"match"`
+	// Template names a rate_limiter.templates entry filling in the
+	// Strategy, Limit and WindowSeconds left empty or zero.
+	Template string `mapstructure:"template"`
+	// Strategy, Limit and WindowSeconds fall back to rate_limiter settings
+	// when empty or zero.
+	Strategy      string `mapstructure:"strategy"`
+	Limit         int64  `mapstructure:"limit"`
+	WindowSeconds int    `mapstructure:"window_seconds"`
+}
+
+// LoadSheddingConfig rejects /api requests with 503 while the node itself is
+// overloaded, lowest priority classes first. Full load is reached when any
+// of the max_* limits is; zero ignores a limit.
+type LoadSheddingConfig struct {
+	Enabled       bool    `mapstructure:"enabled"`
+	MaxInFlight   int64   `mapstructure:"max_in_flight"`
+	MaxGoroutines int     `mapstructure:"max_goroutines"`
+	MaxCPU        float64 `mapstructure:"max_cpu"`
+	// ShedFrom is the fraction of full load at which the lowest priority
+	// starts being shed.
+	ShedFrom          float64               `mapstructure:"shed_from"`
+	SampleIntervalMs  int                   `mapstructure:"sample_interval_ms"`
+	RetryAfterSeconds int                   `mapstructure:"retry_after_seconds"`
+	DefaultPriority   int                   `mapstructure:"default_priority"`
+	Priorities        []ClassPriorityConfig `mapstructure:"priorities"`
+}
+
+// ClassPriorityConfig ranks a request class for load shedding; higher
+// priorities are shed last.
+type ClassPriorityConfig struct {
+	Class    string `mapstructure:"class"`
+	Priority int    `mapstructure:"priority"`
+}
+
+// CrawlersConfig gives well-known crawlers their own limits, separate from
+// human traffic. Each crawler may send Burst requests per Burst crawl delays.
+type CrawlersConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Strategy limits every crawler; sliding_window_log spaces requests
+	// exactly.
+	Strategy  string          `mapstructure:"strategy"`
+	RobotsTxt bool            `mapstructure:"robots_txt"`
+	Crawlers  []CrawlerConfig `mapstructure:"crawlers"`
+}
+
+type CrawlerConfig struct {
+	Name              string   `mapstructure:"name"`
+	UserAgents        []string `mapstructure:"user_agents"`
+	CIDRs             []string `mapstructure:"cidrs"`
+	CrawlDelaySeconds int      `mapstructure:"crawl_delay_seconds"`
+	Burst             int64    `mapstructure:"burst"`
+}
+
+type ClassMatchConfig struct {
+	Headers    map[string]string `mapstructure:"headers"`
+	CIDRs      []string          `mapstructure:"cidrs"`
+	UserAgents []string          `mapstructure:"user_agents"`
+}
+
+type RuleMatchConfig struct {
+	Paths   []string          `mapstructure:"paths" json:"paths,omitempty"`
+	Methods []string          `mapstructure:"methods" json:"methods,omitempty"`
+	Headers map[string]string `mapstructure:"headers" json:"headers,omitempty"`
+	Tiers   []string          `mapstructure:"tiers" json:"tiers,omitempty"`
+	CIDRs   []string          `mapstructure:"cidrs" json:"cidrs,omitempty"`
+}
+
+type SandboxConfig struct {
+	Enabled           bool   `mapstructure:"enabled"`
+	DefaultSequence   string `mapstructure:"default_sequence"`
+	RetryAfterSeconds int    `mapstructure:"retry_after_seconds"`
+}
+
+type AuditLogConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Output is "stdout" or a file path; files are rotated at MaxSizeMB.
+	Output          string  `mapstructure:"output"`
+	AllowSampleRate float64 `mapstructure:"allow_sample_rate"`
+	DenySampleRate  float64 `mapstructure:"deny_sample_rate"`
+	MaxSizeMB       int     `mapstructure:"max_size_mb"`
+	MaxBackups      int     `mapstructure:"max_backups"`
+}
+
+type DenialLogConfig struct {
+	Enabled          bool   `mapstructure:"enabled"`
+	StreamKey        string `mapstructure:"stream_key"`
+	MaxEntries       int64  `mapstructure:"max_entries"`
+	RetentionSeconds int    `mapstructure:"retention_seconds"`
+}
+
+type NamespacesConfig struct {
+	Enabled    bool                       `mapstructure:"enabled"`
+	Required   bool                       `mapstructure:"required"`
+	Allowed    map[string]NamespaceConfig `mapstructure:"allowed"`
+	Quarantine QuarantineConfig           `mapstructure:"quarantine"`
+}
+
+// QuarantineConfig serves a namespace from a local limiter for
+// duration_seconds once slow_ratio of its checks in window_seconds, and at
+// least min_requests, took longer than slow_ms; see
+// ratelimit.Quarantine. The local limiter allows limit requests per key in
+// limit_window_seconds on each instance.
+type QuarantineConfig struct {
+	Enabled            bool    `mapstructure:"enabled"`
+	SlowMs             int     `mapstructure:"slow_ms"`
+	WindowSeconds      int     `mapstructure:"window_seconds"`
+	MinRequests        int64   `mapstructure:"min_requests"`
+	SlowRatio          float64 `mapstructure:"slow_ratio"`
+	DurationSeconds    int     `mapstructure:"duration_seconds"`
+	Limit              int64   `mapstructure:"limit"`
+	LimitWindowSeconds int     `mapstructure:"limit_window_seconds"`
+}
+
+type NamespaceConfig struct {
+	Token string `mapstructure:"token"`
+}
+
+type ObservabilityConfig struct {
+	Alerts           AlertsConfig               `mapstructure:"alerts"`
+	DefaultCollector string                     `mapstructure:"default_collector"`
+	Collectors       map[string]CollectorConfig `mapstructure:"collectors"`
+	PolicyCollectors map[string]string          `mapstructure:"policy_collectors"`
+}
+
+type CollectorConfig struct {
+	Type    string `mapstructure:"type"`
+	Address string `mapstructure:"address"`
+	Prefix  string `mapstructure:"prefix"`
+}
+
+type AlertsConfig struct {
+	DenialRatio       float64 `mapstructure:"denial_ratio"`
+	ErrorRatio        float64 `mapstructure:"error_ratio"`
+	LatencyP99Seconds float64 `mapstructure:"latency_p99_seconds"`
+	For               string  `mapstructure:"for"`
+	Window            string  `mapstructure:"window"`
 }
 
 type ServerConfig struct {
-	Port string `mapstructure:"port"`
+	Port         string `mapstructure:"port"`
+	MaxBodyBytes int64  `mapstructure:"max_body_bytes"`
+	MaxJSONDepth int    `mapstructure:"max_json_depth"`
+	// TrustedProxies may set ClientIPHeaders; empty means use the peer address.
+	TrustedProxies  []string `mapstructure:"trusted_proxies"`
+	ClientIPHeaders []string `mapstructure:"client_ip_headers"`
+	// TLS is served when both files are set. With a client CA, certificates
+	// signed by it are verified and can authenticate admin callers.
+	TLSCertFile     string         `mapstructure:"tls_cert_file"`
+	TLSKeyFile      string         `mapstructure:"tls_key_file"`
+	TLSClientCAFile string         `mapstructure:"tls_client_ca_file"`
+	Autocert        AutocertConfig `mapstructure:"autocert"`
+	// HTTP2 is negotiated over TLS, or spoken in cleartext (h2c) without it.
+	HTTP2 bool `mapstructure:"http2"`
+	// Timeouts in seconds; 0 means none.
+	ReadTimeoutSeconds       int `mapstructure:"read_timeout_seconds"`
+	ReadHeaderTimeoutSeconds int `mapstructure:"read_header_timeout_seconds"`
+	WriteTimeoutSeconds      int `mapstructure:"write_timeout_seconds"`
+	IdleTimeoutSeconds       int `mapstructure:"idle_timeout_seconds"`
+	// DrainSeconds is how long /health/ready reports not-ready on shutdown
+	// before the server stops accepting requests.
+	DrainSeconds int               `mapstructure:"drain_seconds"`
+	ProblemJSON  ProblemJSONConfig `mapstructure:"problem_json"`
+	// RetryAfterFormat is "seconds" or "http-date".
+	RetryAfterFormat string             `mapstructure:"retry_after_format"`
+	Localization     LocalizationConfig `mapstructure:"localization"`
+}
+
+// LocalizationConfig translates the titles and messages of error responses
+// into the language the client's Accept-Language prefers, with Messages as
+// the catalog; see middleware.Localize. It is a list rather than a map
+// since the messages are case-sensitive.
+type LocalizationConfig struct {
+	Enabled  bool                `mapstructure:"enabled"`
+	Messages []TranslationConfig `mapstructure:"messages"`
+}
+
+// TranslationConfig translates Message, in English as the service writes
+// it, into Language, a BCP 47 tag such as "fr" or "pt-BR".
+type TranslationConfig struct {
+	Language    string `mapstructure:"language"`
+	Message     string `mapstructure:"message"`
+	Translation string `mapstructure:"translation"`
+}
+
+// RetryAfterFormats lists the valid ServerConfig retry after formats.
+var RetryAfterFormats = []string{"seconds", "http-date"}
+
+// ProblemJSONConfig answers 429 and 5xx errors with RFC 7807 problem details.
+// TypeBaseURL is prefixed to the error code to form the problem type; the
+// type is "about:blank" without it.
+type ProblemJSONConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	TypeBaseURL string `mapstructure:"type_base_url"`
 }
 
+// AutocertConfig obtains certificates for Domains from Let's Encrypt with the
+// TLS-ALPN-01 challenge, so the server must be reachable on port 443.
+type AutocertConfig struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	Domains  []string `mapstructure:"domains"`
+	CacheDir string   `mapstructure:"cache_dir"`
+	Email    string   `mapstructure:"email"`
+}
+
+// RedisConfig leaves go-redis defaults in place for zero pool and timeout
+// settings; -1 disables retries or a timeout.
 type RedisConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	Password string `mapstructure:"password"`
-	DB       int    `mapstructure:"db"`
+	Host           string         `mapstructure:"host"`
+	Port           int            `mapstructure:"port"`
+	Username       string         `mapstructure:"username"`
+	Password       string         `mapstructure:"password"`
+	DB             int            `mapstructure:"db"`
+	PoolSize       int            `mapstructure:"pool_size"`
+	MinIdleConns   int            `mapstructure:"min_idle_conns"`
+	MaxRetries     int            `mapstructure:"max_retries"`
+	DialTimeoutMs  int            `mapstructure:"dial_timeout_ms"`
+	ReadTimeoutMs  int            `mapstructure:"read_timeout_ms"`
+	WriteTimeoutMs int            `mapstructure:"write_timeout_ms"`
+	PoolTimeoutMs  int            `mapstructure:"pool_timeout_ms"`
+	TLS            RedisTLSConfig `mapstructure:"tls"`
+	// Functions registers the scripts as a Redis Functions library and runs
+	// them with FCALL instead of EVALSHA. It needs Redis 7.
+	Functions bool `mapstructure:"functions"`
+	// Replica serves read-only operations instead of the primary.
+	Replica RedisReplicaConfig `mapstructure:"replica"`
+}
+
+// RedisReplicaConfig is a replica of the primary Redis that peeks and key
+// scans read from, so status pages and dashboards don't load the primary.
+// It shares the primary's credentials, db, pool and TLS settings.
+type RedisReplicaConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Host    string `mapstructure:"host"`
+	Port    int    `mapstructure:"port"`
+}
+
+// PostgresConfig is the database of the postgres backend. Only the
+// token_bucket and fixed_window strategies run there; everything else still
+// uses Redis.
+type PostgresConfig struct {
+	DSN                  string `mapstructure:"dsn"`
+	MaxConns             int32  `mapstructure:"max_conns"`
+	PurgeIntervalSeconds int    `mapstructure:"purge_interval_seconds"`
+}
+
+// Backends lists the valid RateLimiterConfig backends.
+var Backends = []string{"redis", "postgres"}
+
+// RedisTLSConfig verifies the server against CAFile, or the system roots when
+// it is empty. CertFile and KeyFile present a client certificate.
+type RedisTLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
 }
 
 type RateLimiterConfig struct {
-	Strategy   string                        `mapstructure:"strategy"`
-	Strategies RateLimiterStrategiesConfig   `mapstructure:"strategies"`
+	// Backend stores the strategies' state in "redis" or "postgres".
+	Backend       string                      `mapstructure:"backend"`
+	Strategy      string                      `mapstructure:"strategy"`
+	Strategies    RateLimiterStrategiesConfig `mapstructure:"strategies"`
+	ActiveKeys    ActiveKeysConfig            `mapstructure:"active_keys"`
+	Coalescing    CoalescingConfig            `mapstructure:"coalescing"`
+	KeyByRoute    bool                        `mapstructure:"key_by_route"`
+	MaxWaitMs     int                         `mapstructure:"max_wait_ms"`
+	MaxQueueDepth int                         `mapstructure:"max_queue_depth"`
+	TimeoutMs     int                         `mapstructure:"timeout_ms"`
+	DryRun        bool                        `mapstructure:"dry_run"`
+	FailOpen      bool                        `mapstructure:"fail_open"`
+	JWTKey        JWTKeyConfig                `mapstructure:"jwt_key"`
+	IPAggregation IPAggregationConfig         `mapstructure:"ip_aggregation"`
+	GeoIP         GeoIPConfig                 `mapstructure:"geoip"`
+	// ResponseCounting limits counting to some responses; see
+	// middleware.ResponseCountingConfig.
+	ResponseCounting ResponseCountingConfig `mapstructure:"response_counting"`
+	Evaluation       EvaluationConfig       `mapstructure:"evaluation"`
+	Experiment       ExperimentConfig       `mapstructure:"experiment"`
+	Clock            ClockConfig            `mapstructure:"clock"`
+	Connections      ConnectionsConfig      `mapstructure:"connections"`
+	SoftLimit        SoftLimitConfig        `mapstructure:"soft_limit"`
+	LatencyBudget    LatencyBudgetConfig    `mapstructure:"latency_budget"`
+	AsyncAccounting  AsyncAccountingConfig  `mapstructure:"async_accounting"`
+	// Plugins are paths of Go plugins that register more strategies.
+	Plugins     []string          `mapstructure:"plugins"`
+	KeyFields   KeyFieldsConfig   `mapstructure:"key_fields"`
+	KeyTemplate KeyTemplateConfig `mapstructure:"key_template"`
+	GraphQL     GraphQLConfig     `mapstructure:"graphql"`
+	AbuseScore  AbuseScoreConfig  `mapstructure:"abuse_score"`
+	// Limiters are named limiters Routes refer to, each with its own
+	// strategy and limits.
+	Limiters []LimiterConfig    `mapstructure:"limiters"`
+	Routes   []RouteLimitConfig `mapstructure:"routes"`
+	// Templates are limit settings rules, classes and limiters share by
+	// name.
+	Templates []LimitTemplateConfig `mapstructure:"templates"`
+}
+
+// LimiterConfig is a limiter routes refer to by Name. Strategy, Limit and
+// WindowSeconds come from Template, then fall back to rate_limiter settings
+// when empty or zero.
+type LimiterConfig struct {
+	Name          string `mapstructure:"name"`
+	Template      string `mapstructure:"template"`
+	Strategy      string `mapstructure:"strategy"`
+	Limit         int64  `mapstructure:"limit"`
+	WindowSeconds int    `mapstructure:"window_seconds"`
+}
+
+// RouteLimitConfig limits the /api route with Gin template Path, and
+// optionally Method, with the limiter named Limiter instead of the default
+// one.
+type RouteLimitConfig struct {
+	Path    string `mapstructure:"path"`
+	Method  string `mapstructure:"method"`
+	Limiter string `mapstructure:"limiter"`
+}
+
+// GraphQLConfig serves a GraphQL endpoint under /api that is charged what
+// its operations cost rather than one request each; see
+// middleware.GraphQLConfig.
+type GraphQLConfig struct {
+	Enabled         bool     `mapstructure:"enabled"`
+	Path            string   `mapstructure:"path"`
+	MaxDepth        int      `mapstructure:"max_depth"`
+	MaxComplexity   int64    `mapstructure:"max_complexity"`
+	ListArguments   []string `mapstructure:"list_arguments"`
+	DefaultListSize int64    `mapstructure:"default_list_size"`
+	MaxBodyBytes    int64    `mapstructure:"max_body_bytes"`
+	// Operations is a list rather than a map since config keys are case
+	// insensitive and operation names are not.
+	Operations []GraphQLOperationConfig `mapstructure:"operations"`
+}
+
+// AbuseScoreConfig charges /api requests by the anti-abuse score in Header,
+// e.g. a WAF's bot score: a request is charged the Multiplier of the first
+// range holding its score, rounded up to whole requests, and one without a
+// score or outside every range UnscoredMultiplier; see
+// middleware.AbuseScoring.
+type AbuseScoreConfig struct {
+	Enabled            bool               `mapstructure:"enabled"`
+	Header             string             `mapstructure:"header"`
+	UnscoredMultiplier float64            `mapstructure:"unscored_multiplier"`
+	Ranges             []ScoreRangeConfig `mapstructure:"ranges"`
+}
+
+// ScoreRangeConfig covers the scores from Min to Max, inclusive.
+type ScoreRangeConfig struct {
+	Min        float64 `mapstructure:"min"`
+	Max        float64 `mapstructure:"max"`
+	Multiplier float64 `mapstructure:"multiplier"`
+}
+
+// GraphQLOperationConfig overrides the cost of the operations named Name.
+type GraphQLOperationConfig struct {
+	Name string `mapstructure:"name"`
+	Cost int64  `mapstructure:"cost"`
+}
+
+// KeyFieldsConfig keys the requests of some routes by a JSON body field,
+// query parameter or cookie; see middleware.FieldKeyConfig. Other requests
+// keep the usual key.
+type KeyFieldsConfig struct {
+	Enabled      bool                  `mapstructure:"enabled"`
+	MaxBodyBytes int64                 `mapstructure:"max_body_bytes"`
+	Routes       []KeyFieldRouteConfig `mapstructure:"routes"`
+}
+
+// KeyTemplateConfig builds keys from a template such as
+// "{tenant}:{route}:{method}"; see middleware.KeyTemplateConfig. Requests
+// missing a value of the template keep the usual key.
+type KeyTemplateConfig struct {
+	Enabled   bool                        `mapstructure:"enabled"`
+	Template  string                      `mapstructure:"template"`
+	Variables []KeyTemplateVariableConfig `mapstructure:"variables"`
+}
+
+type KeyTemplateVariableConfig struct {
+	Name   string `mapstructure:"name"`
+	Source string `mapstructure:"source"`
+	Field  string `mapstructure:"field"`
+}
+
+type KeyFieldRouteConfig struct {
+	Path   string `mapstructure:"path"`
+	Method string `mapstructure:"method"`
+	Source string `mapstructure:"source"`
+	Field  string `mapstructure:"field"`
+}
+
+// SoftLimitConfig warns clients that have used Threshold of their limit,
+// e.g. 0.8, while still allowing them; 0 disables it. Notify also sends a
+// key.soft_limit event.
+type SoftLimitConfig struct {
+	Threshold float64 `mapstructure:"threshold"`
+	Notify    bool    `mapstructure:"notify"`
+}
+
+// LatencyBudgetConfig lets a request of the default policy through when its
+// check takes longer than BudgetMs, finishing the check in the background; see
+// ratelimit.LatencyBudgetRateLimiter. At most MaxPending checks finish in the
+// background at once.
+type LatencyBudgetConfig struct {
+	Enabled    bool `mapstructure:"enabled"`
+	BudgetMs   int  `mapstructure:"budget_ms"`
+	MaxPending int  `mapstructure:"max_pending"`
+}
+
+// AsyncAccountingConfig lets the default policy's requests through without
+// waiting for the limiter and charges them in batches of up to BatchSize
+// every FlushIntervalMs; see ratelimit.AsyncAccounting. At most BufferSize
+// requests wait to be charged.
+type AsyncAccountingConfig struct {
+	Enabled         bool `mapstructure:"enabled"`
+	FlushIntervalMs int  `mapstructure:"flush_interval_ms"`
+	BatchSize       int  `mapstructure:"batch_size"`
+	BufferSize      int  `mapstructure:"buffer_size"`
+}
+
+// ConnectionsConfig limits WebSocket connections on /api: how many each key
+// may hold open across instances, and the message rate of each connection.
+type ConnectionsConfig struct {
+	Enabled              bool    `mapstructure:"enabled"`
+	KeyPrefix            string  `mapstructure:"key_prefix"`
+	MaxPerKey            int64   `mapstructure:"max_per_key"`
+	LeaseTTLSeconds      int     `mapstructure:"lease_ttl_seconds"`
+	MessageBucketSize    int64   `mapstructure:"message_bucket_size"`
+	MessageRatePerSecond float64 `mapstructure:"message_rate_per_second"`
+}
+
+// ClockConfig picks the clock strategies decide by: "local" (each instance's
+// own), "redis" (Redis TIME on every decision) or "hybrid" (the local clock
+// corrected by its offset from Redis, resynced every SyncIntervalSeconds).
+// Strategies overrides Source per strategy name.
+type ClockConfig struct {
+	Source              string            `mapstructure:"source"`
+	SyncIntervalSeconds int               `mapstructure:"sync_interval_seconds"`
+	MaxRoundTripMs      int               `mapstructure:"max_round_trip_ms"`
+	Strategies          map[string]string `mapstructure:"strategies"`
+}
+
+// ClockSources lists the valid ClockConfig sources.
+var ClockSources = []string{"local", "redis", "hybrid"}
+
+// EvaluationConfig runs ShadowStrategy next to the enforced strategy on the
+// default policy and reports how often their decisions disagree.
+type EvaluationConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	ShadowStrategy string `mapstructure:"shadow_strategy"`
+}
+
+// ExperimentConfig enforces Strategy instead of the configured one for Share
+// of the default policy's keys, from 0 to 1, and counts each arm's
+// decisions. Keys are assigned by a hash of them and Salt.
+type ExperimentConfig struct {
+	Enabled  bool    `mapstructure:"enabled"`
+	Strategy string  `mapstructure:"strategy"`
+	Share    float64 `mapstructure:"share"`
+	Salt     string  `mapstructure:"salt"`
+}
+
+type ResponseCountingConfig struct {
+	CountStatusCodes   []string              `mapstructure:"count_status_codes"`
+	SkipStatusCodes    []string              `mapstructure:"skip_status_codes"`
+	RefundServerErrors bool                  `mapstructure:"refund_server_errors"`
+	CountHeaders       []ResponseHeaderMatch `mapstructure:"count_headers"`
+	SkipHeaders        []ResponseHeaderMatch `mapstructure:"skip_headers"`
+}
+
+// ResponseHeaderMatch matches responses whose header Name has Value, or that
+// have the header at all when Value is empty.
+type ResponseHeaderMatch struct {
+	Name  string `mapstructure:"name"`
+	Value string `mapstructure:"value"`
+}
+
+type GeoIPConfig struct {
+	Enabled   bool            `mapstructure:"enabled"`
+	CountryDB string          `mapstructure:"country_db"`
+	ASNDB     string          `mapstructure:"asn_db"`
+	Rules     []GeoRuleConfig `mapstructure:"rules"`
+}
+
+type GeoRuleConfig struct {
+	Name            string   `mapstructure:"name"`
+	Countries       []string `mapstructure:"countries"`
+	ASNs            []uint   `mapstructure:"asns"`
+	LimitMultiplier float64  `mapstructure:"limit_multiplier"`
+}
+
+type IPAggregationConfig struct {
+	Enabled          bool `mapstructure:"enabled"`
+	IPv4PrefixLength int  `mapstructure:"ipv4_prefix_length"`
+	IPv6PrefixLength int  `mapstructure:"ipv6_prefix_length"`
+}
+
+type JWTKeyConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	Claim              string `mapstructure:"claim"`
+	HMACSecret         string `mapstructure:"hmac_secret"`
+	RSAPublicKeyFile   string `mapstructure:"rsa_public_key_file"`
+	JWKSURL            string `mapstructure:"jwks_url"`
+	JWKSRefreshSeconds int    `mapstructure:"jwks_refresh_seconds"`
+}
+
+type CoalescingConfig struct {
+	Enabled    bool `mapstructure:"enabled"`
+	MaxDelayMs int  `mapstructure:"max_delay_ms"`
+	MaxBatch   int  `mapstructure:"max_batch"`
+}
+
+type ActiveKeysConfig struct {
+	Enabled             bool  `mapstructure:"enabled"`
+	ScanIntervalSeconds int   `mapstructure:"scan_interval_seconds"`
+	ScanCount           int64 `mapstructure:"scan_count"`
 }
 
 type RateLimiterStrategiesConfig struct {
-	TokenBucket         TokenBucketConfig         `mapstructure:"token_bucket"`
-	SlidingWindowLog    SlidingWindowLogConfig    `mapstructure:"sliding_window_log"`
+	TokenBucket          TokenBucketConfig          `mapstructure:"token_bucket"`
+	SlidingWindowLog     SlidingWindowLogConfig     `mapstructure:"sliding_window_log"`
 	SlidingWindowCounter SlidingWindowCounterConfig `mapstructure:"sliding_window_counter"`
+	Quota                QuotaConfig                `mapstructure:"quota"`
+	Hierarchical         HierarchicalConfig         `mapstructure:"hierarchical"`
+	MultiWindow          MultiWindowConfig          `mapstructure:"multi_window"`
+	// FixedWindow is only available with the postgres backend.
+	FixedWindow FixedWindowConfig `mapstructure:"fixed_window"`
+	// Custom configures strategies registered with ratelimit.Register or
+	// loaded from Plugins, by name. Each section is passed as is to the
+	// strategy's ConvertConfig.
+	Custom map[string]map[string]interface{} `mapstructure:"custom"`
 }
 
 type TokenBucketConfig struct {
-	KeyPrefix           string `mapstructure:"key_prefix"`
-	TTLBufferSeconds    int    `mapstructure:"ttl_buffer_seconds"`
-	BucketSize          int64  `mapstructure:"bucket_size"`
-	RefillRatePerSecond int64  `mapstructure:"refill_rate_per_second"`
+	KeyPrefix           string             `mapstructure:"key_prefix"`
+	TTLBufferSeconds    int                `mapstructure:"ttl_buffer_seconds"`
+	BucketSize          int64              `mapstructure:"bucket_size"`
+	RefillRatePerSecond int64              `mapstructure:"refill_rate_per_second"`
+	Lease               TokenLeaseConfig   `mapstructure:"lease"`
+	Global              GlobalBucketConfig `mapstructure:"global"`
+}
+
+type GlobalBucketConfig struct {
+	BucketSize          int64   `mapstructure:"bucket_size"`
+	RefillRatePerSecond float64 `mapstructure:"refill_rate_per_second"`
+}
+
+type TokenLeaseConfig struct {
+	Size      int64 `mapstructure:"size"`
+	TTLMillis int64 `mapstructure:"ttl_ms"`
 }
 
 type SlidingWindowLogConfig struct {
@@ -40,6 +749,7 @@ type SlidingWindowLogConfig struct {
 	TTLBufferSeconds  int    `mapstructure:"ttl_buffer_seconds"`
 	WindowSizeSeconds int    `mapstructure:"window_size_seconds"`
 	BucketSize        int64  `mapstructure:"bucket_size"`
+	MaxEntries        int64  `mapstructure:"max_entries"`
 }
 
 type SlidingWindowCounterConfig struct {
@@ -47,4 +757,53 @@ type SlidingWindowCounterConfig struct {
 	TTLBufferSeconds  int    `mapstructure:"ttl_buffer_seconds"`
 	WindowSizeSeconds int    `mapstructure:"window_size_seconds"`
 	BucketSize        int64  `mapstructure:"bucket_size"`
+	// SubWindows above 1 counts the window in that many buckets, e.g. 60 for
+	// one-minute buckets over an hour; 0 keeps the current and previous window.
+	SubWindows int `mapstructure:"sub_windows"`
+}
+
+type FixedWindowConfig struct {
+	KeyPrefix         string `mapstructure:"key_prefix"`
+	WindowSizeSeconds int    `mapstructure:"window_size_seconds"`
+	BucketSize        int64  `mapstructure:"bucket_size"`
+}
+
+type QuotaConfig struct {
+	KeyPrefix        string `mapstructure:"key_prefix"`
+	TTLBufferSeconds int    `mapstructure:"ttl_buffer_seconds"`
+	Period           string `mapstructure:"period"`
+	Limit            int64  `mapstructure:"limit"`
+	AnchorDay        int    `mapstructure:"anchor_day"`
+}
+
+// HierarchicalConfig charges each request against the caller's own bucket,
+// its organization's and the service-wide one. The organization is read from
+// OrganizationHeader; a bucket size of 0 turns the organization or global
+// level off.
+type HierarchicalConfig struct {
+	KeyPrefix          string               `mapstructure:"key_prefix"`
+	TTLBufferSeconds   int                  `mapstructure:"ttl_buffer_seconds"`
+	OrganizationHeader string               `mapstructure:"organization_header"`
+	User               HierarchyLevelConfig `mapstructure:"user"`
+	Organization       HierarchyLevelConfig `mapstructure:"organization"`
+	Global             HierarchyLevelConfig `mapstructure:"global"`
+}
+
+type HierarchyLevelConfig struct {
+	BucketSize          int64 `mapstructure:"bucket_size"`
+	RefillRatePerSecond int64 `mapstructure:"refill_rate_per_second"`
+}
+
+// MultiWindowConfig admits a request only if it fits both a short burst
+// window and a long sustained one, checked together in one script.
+type MultiWindowConfig struct {
+	KeyPrefix        string            `mapstructure:"key_prefix"`
+	TTLBufferSeconds int               `mapstructure:"ttl_buffer_seconds"`
+	Burst            WindowLimitConfig `mapstructure:"burst"`
+	Sustained        WindowLimitConfig `mapstructure:"sustained"`
+}
+
+type WindowLimitConfig struct {
+	WindowSizeSeconds int   `mapstructure:"window_size_seconds"`
+	Limit             int64 `mapstructure:"limit"`
 }
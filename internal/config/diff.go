@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is a setting that differs between two configs, by its path in the
+// config file, e.g. "rate_limiter.strategy".
+type Change struct {
+	Path string
+	Old  string
+	New  string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+}
+
+// redacted are settings whose values Diff doesn't show, since changes are
+// logged.
+var redacted = map[string]bool{
+	"password":    true,
+	"hmac_secret": true,
+	"token":       true,
+	"tokens":      true,
+	"dsn":         true,
+	"headers":     true,
+	// Webhook URLs, such as Slack's, carry their secret in the path.
+	"webhook_urls": true,
+}
+
+// Diff lists the settings that differ between old and new, in file order.
+// Secrets are reported as changed without their values.
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	diffValue(&changes, "", reflect.ValueOf(*old), reflect.ValueOf(*new), false)
+	return changes
+}
+
+func diffValue(changes *[]Change, path string, old, new reflect.Value, secret bool) {
+	switch old.Kind() {
+	case reflect.Struct:
+		for i := 0; i < old.NumField(); i++ {
+			field := old.Type().Field(i)
+			name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+			if name == "" || !field.IsExported() {
+				continue
+			}
+			diffValue(changes, join(path, name), old.Field(i), new.Field(i), secret || redacted[name])
+		}
+	case reflect.Slice:
+		for i := 0; i < max(old.Len(), new.Len()); i++ {
+			diffValue(changes, fmt.Sprintf("%s[%d]", path, i), index(old, i), index(new, i), secret)
+		}
+	case reflect.Map:
+		if secret {
+			diffLeaf(changes, path, old, new, secret)
+			return
+		}
+		for _, key := range mapKeys(old, new) {
+			diffValue(changes, join(path, key.String()), mapIndex(old, key), mapIndex(new, key), secret)
+		}
+	default:
+		diffLeaf(changes, path, old, new, secret)
+	}
+}
+
+func diffLeaf(changes *[]Change, path string, old, new reflect.Value, secret bool) {
+	if reflect.DeepEqual(old.Interface(), new.Interface()) {
+		return
+	}
+	change := Change{Path: path, Old: format(old), New: format(new)}
+	if secret {
+		change.Old, change.New = "<redacted>", "<redacted>"
+	}
+	*changes = append(*changes, change)
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// index returns element i of slice, or the element type's zero value past
+// its end.
+func index(slice reflect.Value, i int) reflect.Value {
+	if i < slice.Len() {
+		return slice.Index(i)
+	}
+	return reflect.Zero(slice.Type().Elem())
+}
+
+func mapIndex(m reflect.Value, key reflect.Value) reflect.Value {
+	if value := m.MapIndex(key); value.IsValid() {
+		return value
+	}
+	return reflect.Zero(m.Type().Elem())
+}
+
+func mapKeys(old, new reflect.Value) []reflect.Value {
+	seen := make(map[string]reflect.Value)
+	for _, m := range []reflect.Value{old, new} {
+		for _, key := range m.MapKeys() {
+			seen[key.String()] = key
+		}
+	}
+	keys := make([]reflect.Value, 0, len(seen))
+	for _, key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	return keys
+}
+
+func format(value reflect.Value) string {
+	if value.Kind() == reflect.String {
+		return fmt.Sprintf("%q", value.String())
+	}
+	return fmt.Sprint(value.Interface())
+}
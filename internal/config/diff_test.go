@@ -0,0 +1,44 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	old := &Config{
+		RateLimiter: RateLimiterConfig{Strategy: "token_bucket"},
+		Observability: ObservabilityConfig{Collectors: map[string]CollectorConfig{
+			"prometheus": {Type: "prometheus"},
+		}},
+		Notifications: NotificationsConfig{WebhookURLs: []string{"https://hooks.slack.com/services/T0/B0/secret"}},
+	}
+	new := &Config{
+		RateLimiter: RateLimiterConfig{Strategy: "sliding_window_log"},
+		Observability: ObservabilityConfig{Collectors: map[string]CollectorConfig{
+			"prometheus": {Type: "prometheus"},
+			"statsd":     {Type: "statsd", Address: "localhost:8125"},
+		}},
+		Notifications: NotificationsConfig{WebhookURLs: []string{
+			"https://hooks.slack.com/services/T0/B0/rotated",
+			"https://hooks.slack.com/services/T0/B1/another",
+		}},
+		Redis: RedisConfig{Password: "hunter2"},
+		AdminAuth: AdminAuthConfig{Tokens: map[string]AdminTokenConfig{
+			"ops": {Token: "s3cret", Role: "admin"},
+		}},
+	}
+
+	assert.Equal(t, []Change{
+		{Path: "redis.password", Old: "<redacted>", New: "<redacted>"},
+		{Path: "rate_limiter.strategy", Old: `"token_bucket"`, New: `"sliding_window_log"`},
+		{Path: "observability.collectors.statsd.type", Old: `""`, New: `"statsd"`},
+		{Path: "observability.collectors.statsd.address", Old: `""`, New: `"localhost:8125"`},
+		{Path: "notifications.webhook_urls[0]", Old: "<redacted>", New: "<redacted>"},
+		{Path: "notifications.webhook_urls[1]", Old: "<redacted>", New: "<redacted>"},
+		{Path: "admin_auth.tokens", Old: "<redacted>", New: "<redacted>"},
+	}, Diff(old, new))
+
+	assert.Empty(t, Diff(new, new))
+}
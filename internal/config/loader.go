@@ -27,33 +27,294 @@ func Load() (*Config, error) {
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	if err := cfg.applyLimitTemplates(); err != nil {
+		return nil, fmt.Errorf("failed to apply limit templates: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 
 	return &cfg, nil
 }
 
 func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.port", ":8080")
+	v.SetDefault("server.max_body_bytes", 1<<20)
+	v.SetDefault("server.max_json_depth", 32)
+	v.SetDefault("server.trusted_proxies", []string{})
+	v.SetDefault("server.client_ip_headers", []string{"X-Forwarded-For", "X-Real-IP"})
+	v.SetDefault("server.tls_cert_file", "")
+	v.SetDefault("server.tls_key_file", "")
+	v.SetDefault("server.tls_client_ca_file", "")
+	v.SetDefault("server.autocert.enabled", false)
+	v.SetDefault("server.autocert.domains", []string{})
+	v.SetDefault("server.autocert.cache_dir", "autocert-cache")
+	v.SetDefault("server.autocert.email", "")
+	v.SetDefault("server.http2", true)
+	v.SetDefault("server.read_timeout_seconds", 15)
+	v.SetDefault("server.read_header_timeout_seconds", 5)
+	v.SetDefault("server.write_timeout_seconds", 30)
+	v.SetDefault("server.idle_timeout_seconds", 120)
+	v.SetDefault("server.drain_seconds", 5)
+	v.SetDefault("server.problem_json.enabled", false)
+	v.SetDefault("server.problem_json.type_base_url", "")
+	v.SetDefault("server.retry_after_format", "seconds")
+	v.SetDefault("server.localization.enabled", false)
 	v.SetDefault("redis.host", "localhost")
 	v.SetDefault("redis.port", 6379)
 	v.SetDefault("redis.db", 0)
+	v.SetDefault("redis.username", "")
 	v.SetDefault("redis.password", "")
+	v.SetDefault("redis.pool_size", 0)
+	v.SetDefault("redis.min_idle_conns", 0)
+	v.SetDefault("redis.max_retries", 0)
+	v.SetDefault("redis.dial_timeout_ms", 0)
+	v.SetDefault("redis.read_timeout_ms", 0)
+	v.SetDefault("redis.write_timeout_ms", 0)
+	v.SetDefault("redis.pool_timeout_ms", 0)
+	v.SetDefault("redis.tls.enabled", false)
+	v.SetDefault("redis.tls.ca_file", "")
+	v.SetDefault("redis.tls.cert_file", "")
+	v.SetDefault("redis.tls.key_file", "")
+	v.SetDefault("redis.tls.server_name", "")
+	v.SetDefault("redis.tls.insecure_skip_verify", false)
+	v.SetDefault("redis.functions", false)
+	v.SetDefault("redis.replica.enabled", false)
+	v.SetDefault("redis.replica.host", "")
+	v.SetDefault("redis.replica.port", 6379)
+
+	v.SetDefault("postgres.dsn", "")
+	v.SetDefault("postgres.max_conns", 0)
+	v.SetDefault("postgres.purge_interval_seconds", 60)
 
+	v.SetDefault("rate_limiter.backend", "redis")
 	v.SetDefault("rate_limiter.strategy", "sliding_window_counter")
 
+	v.SetDefault("rate_limiter.active_keys.enabled", true)
+	v.SetDefault("rate_limiter.active_keys.scan_interval_seconds", 30)
+	v.SetDefault("rate_limiter.active_keys.scan_count", 1000)
+	v.SetDefault("rate_limiter.coalescing.enabled", false)
+	v.SetDefault("rate_limiter.coalescing.max_delay_ms", 2)
+	v.SetDefault("rate_limiter.coalescing.max_batch", 100)
+	v.SetDefault("rate_limiter.key_by_route", false)
+	v.SetDefault("rate_limiter.max_wait_ms", 0)
+	v.SetDefault("rate_limiter.max_queue_depth", 1000)
+	v.SetDefault("rate_limiter.timeout_ms", 5000)
+	v.SetDefault("rate_limiter.dry_run", false)
+	v.SetDefault("rate_limiter.soft_limit.threshold", 0.0)
+	v.SetDefault("rate_limiter.soft_limit.notify", false)
+	v.SetDefault("rate_limiter.latency_budget.enabled", false)
+	v.SetDefault("rate_limiter.latency_budget.budget_ms", 10)
+	v.SetDefault("rate_limiter.latency_budget.max_pending", 1000)
+	v.SetDefault("rate_limiter.async_accounting.enabled", false)
+	v.SetDefault("rate_limiter.async_accounting.flush_interval_ms", 100)
+	v.SetDefault("rate_limiter.async_accounting.batch_size", 500)
+	v.SetDefault("rate_limiter.async_accounting.buffer_size", 10000)
+	v.SetDefault("rate_limiter.fail_open", false)
+	v.SetDefault("rate_limiter.evaluation.enabled", false)
+	v.SetDefault("rate_limiter.evaluation.shadow_strategy", "sliding_window_log")
+	v.SetDefault("rate_limiter.experiment.enabled", false)
+	v.SetDefault("rate_limiter.experiment.strategy", "sliding_window_counter")
+	v.SetDefault("rate_limiter.experiment.share", 0.5)
+	v.SetDefault("rate_limiter.experiment.salt", "")
+	v.SetDefault("rate_limiter.clock.source", "local")
+	v.SetDefault("rate_limiter.clock.sync_interval_seconds", 30)
+	v.SetDefault("rate_limiter.clock.max_round_trip_ms", 50)
+	v.SetDefault("rate_limiter.connections.enabled", false)
+	v.SetDefault("rate_limiter.connections.key_prefix", "rl:conn")
+	v.SetDefault("rate_limiter.connections.max_per_key", 10)
+	v.SetDefault("rate_limiter.connections.lease_ttl_seconds", 60)
+	v.SetDefault("rate_limiter.connections.message_bucket_size", 20)
+	v.SetDefault("rate_limiter.connections.message_rate_per_second", 10)
+	v.SetDefault("rate_limiter.key_fields.enabled", false)
+	v.SetDefault("rate_limiter.key_fields.max_body_bytes", 65536)
+	v.SetDefault("rate_limiter.key_template.enabled", false)
+	v.SetDefault("rate_limiter.key_template.template", "")
+	v.SetDefault("rate_limiter.abuse_score.enabled", false)
+	v.SetDefault("rate_limiter.abuse_score.header", "X-Bot-Score")
+	v.SetDefault("rate_limiter.abuse_score.unscored_multiplier", 1.0)
+	v.SetDefault("rate_limiter.graphql.enabled", false)
+	v.SetDefault("rate_limiter.graphql.path", "/graphql")
+	v.SetDefault("rate_limiter.graphql.max_depth", 10)
+	v.SetDefault("rate_limiter.graphql.max_complexity", 1000)
+	v.SetDefault("rate_limiter.graphql.list_arguments", []string{"first", "last", "limit"})
+	v.SetDefault("rate_limiter.graphql.default_list_size", 1)
+	v.SetDefault("rate_limiter.graphql.max_body_bytes", 65536)
+
+	v.SetDefault("rate_limiter.jwt_key.enabled", false)
+	v.SetDefault("rate_limiter.jwt_key.claim", "sub")
+	v.SetDefault("rate_limiter.jwt_key.hmac_secret", "")
+	v.SetDefault("rate_limiter.jwt_key.rsa_public_key_file", "")
+	v.SetDefault("rate_limiter.jwt_key.jwks_url", "")
+	v.SetDefault("rate_limiter.jwt_key.jwks_refresh_seconds", 3600)
+	v.SetDefault("rate_limiter.ip_aggregation.enabled", false)
+	v.SetDefault("rate_limiter.ip_aggregation.ipv4_prefix_length", 24)
+	v.SetDefault("rate_limiter.ip_aggregation.ipv6_prefix_length", 64)
+	v.SetDefault("rate_limiter.geoip.enabled", false)
+	v.SetDefault("rate_limiter.geoip.country_db", "")
+	v.SetDefault("rate_limiter.geoip.asn_db", "")
+	v.SetDefault("rate_limiter.response_counting.count_status_codes", []string{})
+	v.SetDefault("rate_limiter.response_counting.skip_status_codes", []string{})
+	v.SetDefault("rate_limiter.response_counting.refund_server_errors", true)
+
 	v.SetDefault("rate_limiter.strategies.token_bucket.key_prefix", "rl:tb:")
 	v.SetDefault("rate_limiter.strategies.token_bucket.ttl_buffer_seconds", 5)
 	v.SetDefault("rate_limiter.strategies.token_bucket.bucket_size", 100)
 	v.SetDefault("rate_limiter.strategies.token_bucket.refill_rate_per_second", 10)
+	v.SetDefault("rate_limiter.strategies.token_bucket.lease.size", 0)
+	v.SetDefault("rate_limiter.strategies.token_bucket.lease.ttl_ms", 1000)
+	v.SetDefault("rate_limiter.strategies.token_bucket.global.bucket_size", 0)
+	v.SetDefault("rate_limiter.strategies.token_bucket.global.refill_rate_per_second", 0)
 
 	v.SetDefault("rate_limiter.strategies.sliding_window_log.key_prefix", "rl:swl:")
 	v.SetDefault("rate_limiter.strategies.sliding_window_log.ttl_buffer_seconds", 30)
 	v.SetDefault("rate_limiter.strategies.sliding_window_log.window_size_seconds", 3600)
 	v.SetDefault("rate_limiter.strategies.sliding_window_log.bucket_size", 1000)
+	v.SetDefault("rate_limiter.strategies.sliding_window_log.max_entries", 0)
 
 	v.SetDefault("rate_limiter.strategies.sliding_window_counter.key_prefix", "rl:swc:")
 	v.SetDefault("rate_limiter.strategies.sliding_window_counter.ttl_buffer_seconds", 15)
 	v.SetDefault("rate_limiter.strategies.sliding_window_counter.window_size_seconds", 3600)
 	v.SetDefault("rate_limiter.strategies.sliding_window_counter.bucket_size", 1000)
+	v.SetDefault("rate_limiter.strategies.sliding_window_counter.sub_windows", 0)
+
+	v.SetDefault("rate_limiter.strategies.fixed_window.key_prefix", "rl:fw:")
+	v.SetDefault("rate_limiter.strategies.fixed_window.window_size_seconds", 60)
+	v.SetDefault("rate_limiter.strategies.fixed_window.bucket_size", 100)
+
+	v.SetDefault("rate_limiter.strategies.quota.key_prefix", "rl:quota:")
+	v.SetDefault("rate_limiter.strategies.quota.ttl_buffer_seconds", 3600)
+	v.SetDefault("rate_limiter.strategies.quota.period", "monthly")
+	v.SetDefault("rate_limiter.strategies.quota.limit", 100000)
+	v.SetDefault("rate_limiter.strategies.quota.anchor_day", 1)
+
+	v.SetDefault("rate_limiter.strategies.hierarchical.key_prefix", "rl:hier:")
+	v.SetDefault("rate_limiter.strategies.hierarchical.ttl_buffer_seconds", 5)
+	v.SetDefault("rate_limiter.strategies.hierarchical.organization_header", "X-Org-ID")
+	v.SetDefault("rate_limiter.strategies.hierarchical.user.bucket_size", 100)
+	v.SetDefault("rate_limiter.strategies.hierarchical.user.refill_rate_per_second", 10)
+	v.SetDefault("rate_limiter.strategies.hierarchical.organization.bucket_size", 1000)
+	v.SetDefault("rate_limiter.strategies.hierarchical.organization.refill_rate_per_second", 100)
+	v.SetDefault("rate_limiter.strategies.hierarchical.global.bucket_size", 0)
+	v.SetDefault("rate_limiter.strategies.hierarchical.global.refill_rate_per_second", 0)
+
+	v.SetDefault("rate_limiter.strategies.multi_window.key_prefix", "rl:mw:")
+	v.SetDefault("rate_limiter.strategies.multi_window.ttl_buffer_seconds", 5)
+	v.SetDefault("rate_limiter.strategies.multi_window.burst.window_size_seconds", 1)
+	v.SetDefault("rate_limiter.strategies.multi_window.burst.limit", 10)
+	v.SetDefault("rate_limiter.strategies.multi_window.sustained.window_size_seconds", 3600)
+	v.SetDefault("rate_limiter.strategies.multi_window.sustained.limit", 1000)
+
+	v.SetDefault("observability.alerts.denial_ratio", 0.5)
+	v.SetDefault("observability.alerts.error_ratio", 0.01)
+	v.SetDefault("observability.alerts.latency_p99_seconds", 0.05)
+	v.SetDefault("observability.alerts.for", "5m")
+	v.SetDefault("observability.alerts.window", "5m")
+
+	v.SetDefault("observability.default_collector", "prometheus")
+	v.SetDefault("observability.collectors.prometheus.type", "prometheus")
+
+	v.SetDefault("namespaces.enabled", false)
+	v.SetDefault("namespaces.required", false)
+	v.SetDefault("namespaces.quarantine.enabled", false)
+	v.SetDefault("namespaces.quarantine.slow_ms", 50)
+	v.SetDefault("namespaces.quarantine.window_seconds", 30)
+	v.SetDefault("namespaces.quarantine.min_requests", 100)
+	v.SetDefault("namespaces.quarantine.slow_ratio", 0.5)
+	v.SetDefault("namespaces.quarantine.duration_seconds", 300)
+	v.SetDefault("namespaces.quarantine.limit", 100)
+	v.SetDefault("namespaces.quarantine.limit_window_seconds", 60)
+
+	v.SetDefault("denial_log.enabled", false)
+	v.SetDefault("denial_log.stream_key", "rl:denials")
+	v.SetDefault("denial_log.max_entries", 100000)
+	v.SetDefault("denial_log.retention_seconds", 86400)
+
+	v.SetDefault("audit_log.enabled", false)
+	v.SetDefault("audit_log.output", "stdout")
+	v.SetDefault("audit_log.allow_sample_rate", 0.01)
+	v.SetDefault("audit_log.deny_sample_rate", 1.0)
+	v.SetDefault("audit_log.max_size_mb", 100)
+	v.SetDefault("audit_log.max_backups", 5)
+
+	v.SetDefault("analytics.top_keys.enabled", false)
+	v.SetDefault("analytics.top_keys.window_seconds", 3600)
+	v.SetDefault("analytics.top_keys.resolution_seconds", 60)
+	v.SetDefault("analytics.key_stats.enabled", false)
+	v.SetDefault("analytics.key_stats.window_seconds", 60)
+
+	v.SetDefault("dashboard.enabled", true)
+
+	v.SetDefault("regions.enabled", false)
+	v.SetDefault("regions.name", "")
+	v.SetDefault("regions.shares", map[string]interface{}{})
+	v.SetDefault("regions.peers", map[string]interface{}{})
+	v.SetDefault("regions.reconcile_interval_seconds", 10)
+	v.SetDefault("regions.min_share_fraction", 0.5)
+
+	v.SetDefault("key_usage.scan_count", 1000)
+	v.SetDefault("key_usage.sample_size", 100)
+	v.SetDefault("key_usage.purge.enabled", false)
+	v.SetDefault("key_usage.purge.idle_seconds", 7*24*3600)
+	v.SetDefault("key_usage.purge.interval_seconds", 3600)
+	v.SetDefault("key_usage.migration.keys_per_second", 1000.0)
+
+	v.SetDefault("housekeeping.leader_election", true)
+	v.SetDefault("housekeeping.lease_key", "rl:leader")
+	v.SetDefault("housekeeping.lease_ttl_seconds", 15)
+
+	v.SetDefault("admin_auth.enabled", false)
+	v.SetDefault("admin_auth.tokens", map[string]interface{}{})
+	v.SetDefault("admin_auth.client_certs", map[string]interface{}{})
+
+	v.SetDefault("sandbox.enabled", true)
+	v.SetDefault("sandbox.default_sequence", "aad")
+	v.SetDefault("sandbox.retry_after_seconds", 1)
+
+	v.SetDefault("rules.enabled", false)
+	v.SetDefault("rules.tier_header", "X-RateLimit-Tier")
+	v.SetDefault("rules.etcd.enabled", false)
+	v.SetDefault("rules.etcd.endpoints", []string{"localhost:2379"})
+	v.SetDefault("rules.etcd.prefix", "/rate-limiter/rules")
+	v.SetDefault("rules.etcd.username", "")
+	v.SetDefault("rules.etcd.password", "")
+	v.SetDefault("rules.etcd.dial_timeout_ms", 5000)
+
+	v.SetDefault("classification.enabled", false)
+	v.SetDefault("classification.credential_headers", []string{"Authorization", "X-Client-ID"})
+
+	v.SetDefault("load_shedding.enabled", false)
+	v.SetDefault("load_shedding.max_in_flight", 1000)
+	v.SetDefault("load_shedding.max_goroutines", 0)
+	v.SetDefault("load_shedding.max_cpu", 0.9)
+	v.SetDefault("load_shedding.shed_from", 0.8)
+	v.SetDefault("load_shedding.sample_interval_ms", 1000)
+	v.SetDefault("load_shedding.retry_after_seconds", 1)
+	v.SetDefault("load_shedding.default_priority", 1)
+
+	v.SetDefault("crawlers.enabled", false)
+	v.SetDefault("crawlers.strategy", "sliding_window_log")
+	v.SetDefault("crawlers.robots_txt", false)
+
+	v.SetDefault("penalties.escalation.enabled", false)
+	v.SetDefault("penalties.escalation.max_violations", 100)
+	v.SetDefault("penalties.escalation.window_seconds", 300)
+	v.SetDefault("penalties.escalation.ban_seconds", 900)
+
+	v.SetDefault("notifications.enabled", false)
+	v.SetDefault("notifications.cooldown_seconds", 60)
+	v.SetDefault("notifications.max_retries", 3)
+	v.SetDefault("notifications.initial_backoff_ms", 500)
+	v.SetDefault("notifications.timeout_ms", 5000)
+	v.SetDefault("notifications.queue_size", 1000)
+
+	v.SetDefault("decision_stream.enabled", false)
+	v.SetDefault("decision_stream.backend", "nats")
+	v.SetDefault("decision_stream.address", "localhost:4222")
+	v.SetDefault("decision_stream.subject", "ratelimit.decisions")
+	v.SetDefault("decision_stream.batch_size", 500)
+	v.SetDefault("decision_stream.flush_interval_ms", 1000)
+	v.SetDefault("decision_stream.buffer_size", 10000)
 }
 
 func loadConfigFile(v *viper.Viper) error {
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LimitTemplateConfig is a named set of limit settings, e.g. "small" or
+// "large", that rules, classes and limiters pick with their template field
+// instead of repeating them. A template may extend another, overriding the
+// settings it sets itself.
+type LimitTemplateConfig struct {
+	Name          string `mapstructure:"name"`
+	Extends       string `mapstructure:"extends"`
+	Strategy      string `mapstructure:"strategy"`
+	Limit         int64  `mapstructure:"limit"`
+	WindowSeconds int    `mapstructure:"window_seconds"`
+}
+
+// LimitSettings are the limit settings a template provides.
+type LimitSettings struct {
+	Strategy      string
+	Limit         int64
+	WindowSeconds int
+}
+
+// ResolveTemplate returns the settings of the template called name, merged
+// with those of the templates it extends.
+func (c RateLimiterConfig) ResolveTemplate(name string) (LimitSettings, error) {
+	var settings LimitSettings
+	chain := []string{}
+	for next := name; next != ""; {
+		for _, seen := range chain {
+			if seen == next {
+				return LimitSettings{}, fmt.Errorf("template %q extends itself: %s", name, strings.Join(append(chain, next), " -> "))
+			}
+		}
+		chain = append(chain, next)
+
+		template, ok := c.template(next)
+		if !ok {
+			if next == name {
+				return LimitSettings{}, fmt.Errorf("unknown template %q", name)
+			}
+			return LimitSettings{}, fmt.Errorf("template %q extends unknown template %q", chain[len(chain)-2], next)
+		}
+		settings.inherit(LimitSettings{Strategy: template.Strategy, Limit: template.Limit, WindowSeconds: template.WindowSeconds})
+		next = template.Extends
+	}
+	return settings, nil
+}
+
+// ApplyTemplate fills the strategy, limit and window left empty or zero from
+// the template called name, so those set alongside the template override it.
+// An empty name leaves them alone.
+func (c RateLimiterConfig) ApplyTemplate(name string, strategy *string, limit *int64, windowSeconds *int) error {
+	if name == "" {
+		return nil
+	}
+	template, err := c.ResolveTemplate(name)
+	if err != nil {
+		return err
+	}
+	settings := LimitSettings{Strategy: *strategy, Limit: *limit, WindowSeconds: *windowSeconds}
+	settings.inherit(template)
+	*strategy, *limit, *windowSeconds = settings.Strategy, settings.Limit, settings.WindowSeconds
+	return nil
+}
+
+func (c RateLimiterConfig) template(name string) (LimitTemplateConfig, bool) {
+	for _, template := range c.Templates {
+		if template.Name == name {
+			return template, true
+		}
+	}
+	return LimitTemplateConfig{}, false
+}
+
+// inherit fills the settings left empty or zero from parent.
+func (s *LimitSettings) inherit(parent LimitSettings) {
+	if s.Strategy == "" {
+		s.Strategy = parent.Strategy
+	}
+	if s.Limit == 0 {
+		s.Limit = parent.Limit
+	}
+	if s.WindowSeconds == 0 {
+		s.WindowSeconds = parent.WindowSeconds
+	}
+}
+
+// applyLimitTemplates resolves the templates of rules, classes and limiters,
+// returning every template that doesn't resolve.
+func (c *Config) applyLimitTemplates() error {
+	rl := c.RateLimiter
+	var errs []error
+	apply := func(field, name string, strategy *string, limit *int64, windowSeconds *int) {
+		if err := rl.ApplyTemplate(name, strategy, limit, windowSeconds); err != nil {
+			errs = append(errs, fmt.Errorf("%s.template: %w", field, err))
+		}
+	}
+	for i := range c.Rules.Rules {
+		rule := &c.Rules.Rules[i]
+		apply(fmt.Sprintf("rules.rules[%d]", i), rule.Template, &rule.Strategy, &rule.Limit, &rule.WindowSeconds)
+	}
+	for i := range c.Classification.Classes {
+		class := &c.Classification.Classes[i]
+		apply(fmt.Sprintf("classification.classes[%d]", i), class.Template, &class.Strategy, &class.Limit, &class.WindowSeconds)
+	}
+	for i := range c.RateLimiter.Limiters {
+		limiter := &c.RateLimiter.Limiters[i]
+		apply(fmt.Sprintf("rate_limiter.limiters[%d]", i), limiter.Template, &limiter.Strategy, &limiter.Limit, &limiter.WindowSeconds)
+	}
+	return errors.Join(errs...)
+}
+
+func (c RateLimiterConfig) validateTemplates(p *problems) {
+	names := make(map[string]bool, len(c.Templates))
+	for i, template := range c.Templates {
+		field := fmt.Sprintf("rate_limiter.templates[%d]", i)
+		if template.Name == "" {
+			p.addf("%s.name is required", field)
+			continue
+		}
+		if names[template.Name] {
+			p.addf("%s.name %q is duplicated", field, template.Name)
+		}
+		names[template.Name] = true
+		if template.Strategy != "" {
+			p.strategy(field+".strategy", template.Strategy)
+		}
+		p.nonNegative(field+".limit", template.Limit)
+		p.nonNegative(field+".window_seconds", int64(template.WindowSeconds))
+		if _, err := c.ResolveTemplate(template.Name); err != nil {
+			p.addf("%s: %v", field, err)
+		}
+	}
+}
+
+// template reports field's template if it doesn't resolve.
+func (p *problems) template(field string, rl RateLimiterConfig, name string) {
+	if name == "" {
+		return
+	}
+	if _, err := rl.ResolveTemplate(name); err != nil {
+		p.addf("%s: %v", field, err)
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func templatesConfig() RateLimiterConfig {
+	return RateLimiterConfig{Templates: []LimitTemplateConfig{
+		{Name: "base", Strategy: "token_bucket", Limit: 10, WindowSeconds: 60},
+		{Name: "medium", Extends: "base", Limit: 100},
+		{Name: "large", Extends: "medium", WindowSeconds: 3600},
+		{Name: "loop-a", Extends: "loop-b", Limit: 1},
+		{Name: "loop-b", Extends: "loop-a", Limit: 2},
+		{Name: "orphan", Extends: "missing", Limit: 3},
+	}}
+}
+
+func TestRateLimiterConfig_ResolveTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		settings LimitSettings
+		err      string
+	}{
+		{
+			name:     "no parent",
+			template: "base",
+			settings: LimitSettings{Strategy: "token_bucket", Limit: 10, WindowSeconds: 60},
+		},
+		{
+			name:     "child overrides parent",
+			template: "medium",
+			settings: LimitSettings{Strategy: "token_bucket", Limit: 100, WindowSeconds: 60},
+		},
+		{
+			name:     "multi-level chain",
+			template: "large",
+			settings: LimitSettings{Strategy: "token_bucket", Limit: 100, WindowSeconds: 3600},
+		},
+		{
+			name:     "cycle",
+			template: "loop-a",
+			err:      `template "loop-a" extends itself: loop-a -> loop-b -> loop-a`,
+		},
+		{
+			name:     "unknown template",
+			template: "huge",
+			err:      `unknown template "huge"`,
+		},
+		{
+			name:     "unknown parent",
+			template: "orphan",
+			err:      `template "orphan" extends unknown template "missing"`,
+		},
+	}
+
+	rl := templatesConfig()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings, err := rl.ResolveTemplate(tt.template)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.settings, settings)
+		})
+	}
+}
+
+func TestRateLimiterConfig_ApplyTemplate(t *testing.T) {
+	rl := templatesConfig()
+
+	strategy, limit, window := "", int64(0), 0
+	require.NoError(t, rl.ApplyTemplate("large", &strategy, &limit, &window))
+	assert.Equal(t, "token_bucket", strategy)
+	assert.Equal(t, int64(100), limit)
+	assert.Equal(t, 3600, window)
+
+	strategy, limit, window = "fixed_window", 5, 0
+	require.NoError(t, rl.ApplyTemplate("large", &strategy, &limit, &window))
+	assert.Equal(t, "fixed_window", strategy, "settings set alongside the template override it")
+	assert.Equal(t, int64(5), limit)
+	assert.Equal(t, 3600, window)
+
+	strategy, limit, window = "", 7, 0
+	require.NoError(t, rl.ApplyTemplate("", &strategy, &limit, &window))
+	assert.Equal(t, "", strategy, "no template leaves the settings alone")
+	assert.Equal(t, int64(7), limit)
+
+	assert.EqualError(t, rl.ApplyTemplate("loop-b", &strategy, &limit, &window),
+		`template "loop-b" extends itself: loop-b -> loop-a -> loop-b`)
+}
+
+func TestLoad_LimitTemplates(t *testing.T) {
+	const templates = `
+rate_limiter:
+  templates:
+    - {name: "small", strategy: "token_bucket", limit: 10, window_seconds: 60}
+    - {name: "large", extends: "small", limit: 1000}
+rules:
+  enabled: true
+  rules:
+`
+
+	t.Run("applied", func(t *testing.T) {
+		chdirWithConfig(t, templates+`    - {name: "api", match: {paths: ["/api"]}, action: "limit", template: "large", window_seconds: 30}
+`)
+
+		cfg, err := Load()
+
+		require.NoError(t, err)
+		rule := cfg.Rules.Rules[0]
+		assert.Equal(t, "token_bucket", rule.Strategy)
+		assert.Equal(t, int64(1000), rule.Limit)
+		assert.Equal(t, 30, rule.WindowSeconds)
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		chdirWithConfig(t, templates+`    - {name: "api", match: {paths: ["/api"]}, action: "limit", template: "huge"}
+`)
+
+		_, err := Load()
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `rules.rules[0].template: unknown template "huge"`)
+	})
+}
+
+// chdirWithConfig runs the rest of the test in a directory holding a
+// config.yaml with contents.
+func chdirWithConfig(t *testing.T, contents string) {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(contents), 0o600))
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
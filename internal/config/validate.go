@@ -0,0 +1,633 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+// Strategies are the strategy names rate_limiter.strategies can configure.
+var Strategies = []string{"token_bucket", "sliding_window_log", "sliding_window_counter", "quota", "hierarchical", "multi_window", "fixed_window"}
+
+// RedisStrategies are the strategies the redis backend has.
+var RedisStrategies = []string{"token_bucket", "sliding_window_log", "sliding_window_counter", "quota", "hierarchical", "multi_window"}
+
+// PostgresStrategies are the strategies the postgres backend has.
+var PostgresStrategies = []string{"token_bucket", "fixed_window"}
+
+// KeyFieldSources are the places rate_limiter.key_fields can read a key from.
+var KeyFieldSources = []string{"json", "query", "cookie"}
+
+// KeyTemplateSources are the places rate_limiter.key_template variables can
+// read a value from.
+var KeyTemplateSources = []string{"header", "ip", "route", "method", "tier"}
+
+// maxSubWindows mirrors ratelimit.MaxSubWindows.
+const maxSubWindows = 1000
+
+// ValidationError lists every problem found in a config, one per entry.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid config:")
+	for _, problem := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(problem)
+	}
+	return b.String()
+}
+
+type problems struct {
+	list []string
+	// strategies are the strategy names that can be used: the built-in ones
+	// and those configured under rate_limiter.strategies.custom.
+	strategies []string
+}
+
+func (p *problems) addf(format string, args ...interface{}) {
+	p.list = append(p.list, fmt.Sprintf(format, args...))
+}
+
+func (p *problems) positive(field string, value int64) {
+	if value <= 0 {
+		p.addf("%s must be positive, got %d", field, value)
+	}
+}
+
+func (p *problems) nonNegative(field string, value int64) {
+	if value < 0 {
+		p.addf("%s must not be negative, got %d", field, value)
+	}
+}
+
+func (p *problems) strategy(field, name string) {
+	if !slices.Contains(p.strategies, name) {
+		p.addf("%s: unknown strategy %q (want one of %s)", field, name, strings.Join(p.strategies, ", "))
+	}
+}
+
+func (p *problems) backendStrategy(field, name string, strategies []string) {
+	if slices.Contains(Strategies, name) && !slices.Contains(strategies, name) {
+		p.addf("%s: strategy %q is not available with this backend (want one of %s)", field, name, strings.Join(strategies, ", "))
+	}
+}
+
+func (p *problems) clockSource(field, source string) {
+	if !slices.Contains(ClockSources, source) {
+		p.addf("%s: unknown clock source %q (want one of %s)", field, source, strings.Join(ClockSources, ", "))
+	}
+}
+
+func (p *problems) keyPrefix(field, prefix string) {
+	if strings.IndexFunc(prefix, unicode.IsSpace) >= 0 {
+		p.addf("%s must not contain whitespace, got %q", field, prefix)
+	}
+}
+
+// Validate reports values the server can't run with, such as empty buckets or
+// unknown strategy names, so they fail at startup instead of on the first
+// request. All problems are returned together as a *ValidationError.
+func (c *Config) Validate() error {
+	p := problems{strategies: slices.Concat(Strategies, slices.Sorted(maps.Keys(c.RateLimiter.Strategies.Custom)))}
+
+	if c.Server.Port == "" {
+		p.addf("server.port must not be empty")
+	}
+	if !slices.Contains(RetryAfterFormats, c.Server.RetryAfterFormat) {
+		p.addf("server.retry_after_format: unknown format %q (want one of %s)", c.Server.RetryAfterFormat, strings.Join(RetryAfterFormats, ", "))
+	}
+	c.Server.Localization.validate(&p)
+	if c.Redis.Port <= 0 || c.Redis.Port > 65535 {
+		p.addf("redis.port must be between 1 and 65535, got %d", c.Redis.Port)
+	}
+	if replica := c.Redis.Replica; replica.Enabled {
+		if replica.Host == "" {
+			p.addf("redis.replica.host must not be empty")
+		}
+		if replica.Port <= 0 || replica.Port > 65535 {
+			p.addf("redis.replica.port must be between 1 and 65535, got %d", replica.Port)
+		}
+	}
+
+	rl := c.RateLimiter
+	p.strategy("rate_limiter.strategy", rl.Strategy)
+	if rl.Evaluation.Enabled {
+		p.strategy("rate_limiter.evaluation.shadow_strategy", rl.Evaluation.ShadowStrategy)
+	}
+	if rl.Experiment.Enabled {
+		p.strategy("rate_limiter.experiment.strategy", rl.Experiment.Strategy)
+		if share := rl.Experiment.Share; share < 0 || share > 1 {
+			p.addf("rate_limiter.experiment.share must be between 0 and 1, got %g", share)
+		}
+	}
+	backendStrategies := RedisStrategies
+	switch rl.Backend {
+	case "redis":
+	case "postgres":
+		backendStrategies = PostgresStrategies
+		if c.Postgres.DSN == "" {
+			p.addf("postgres.dsn must not be empty with the postgres backend")
+		}
+		p.nonNegative("postgres.max_conns", int64(c.Postgres.MaxConns))
+		p.positive("postgres.purge_interval_seconds", int64(c.Postgres.PurgeIntervalSeconds))
+	default:
+		p.addf("rate_limiter.backend: unknown backend %q (want one of %s)", rl.Backend, strings.Join(Backends, ", "))
+	}
+	p.backendStrategy("rate_limiter.strategy", rl.Strategy, backendStrategies)
+	if rl.Evaluation.Enabled {
+		p.backendStrategy("rate_limiter.evaluation.shadow_strategy", rl.Evaluation.ShadowStrategy, backendStrategies)
+	}
+	if rl.Experiment.Enabled {
+		p.backendStrategy("rate_limiter.experiment.strategy", rl.Experiment.Strategy, backendStrategies)
+	}
+	rl.Strategies.validate(&p)
+	rl.Clock.validate(&p)
+	rl.KeyFields.validate(&p)
+	rl.KeyTemplate.validate(&p)
+	rl.GraphQL.validate(&p)
+	rl.AbuseScore.validate(&p)
+	rl.validateTemplates(&p)
+	rl.validateLimiters(&p)
+	p.positive("rate_limiter.timeout_ms", int64(rl.TimeoutMs))
+	p.positive("rate_limiter.max_queue_depth", int64(rl.MaxQueueDepth))
+	if threshold := rl.SoftLimit.Threshold; threshold < 0 || threshold >= 1 {
+		p.addf("rate_limiter.soft_limit.threshold must be at least 0 and below 1, got %g", threshold)
+	}
+	if budget := rl.LatencyBudget; budget.Enabled {
+		p.positive("rate_limiter.latency_budget.budget_ms", int64(budget.BudgetMs))
+		if budget.BudgetMs >= rl.TimeoutMs {
+			p.addf("rate_limiter.latency_budget.budget_ms must be below rate_limiter.timeout_ms, got %d", budget.BudgetMs)
+		}
+		p.positive("rate_limiter.latency_budget.max_pending", int64(budget.MaxPending))
+	}
+	if async := rl.AsyncAccounting; async.Enabled {
+		p.positive("rate_limiter.async_accounting.flush_interval_ms", int64(async.FlushIntervalMs))
+		p.positive("rate_limiter.async_accounting.batch_size", int64(async.BatchSize))
+		p.positive("rate_limiter.async_accounting.buffer_size", int64(async.BufferSize))
+		if rl.LatencyBudget.Enabled {
+			p.addf("rate_limiter.async_accounting and rate_limiter.latency_budget can't both be enabled")
+		}
+		if rl.MaxWaitMs > 0 {
+			p.addf("rate_limiter.async_accounting can't be enabled with rate_limiter.max_wait_ms")
+		}
+	}
+	if conns := rl.Connections; conns.Enabled {
+		const field = "rate_limiter.connections"
+		p.keyPrefix(field+".key_prefix", conns.KeyPrefix)
+		p.positive(field+".max_per_key", conns.MaxPerKey)
+		p.positive(field+".lease_ttl_seconds", int64(conns.LeaseTTLSeconds))
+		p.nonNegative(field+".message_bucket_size", conns.MessageBucketSize)
+		if conns.MessageBucketSize > 0 && conns.MessageRatePerSecond <= 0 {
+			p.addf("%s.message_rate_per_second must be positive, got %g", field, conns.MessageRatePerSecond)
+		}
+	}
+
+	if c.Analytics.KeyStats.Enabled {
+		p.positive("analytics.key_stats.window_seconds", int64(c.Analytics.KeyStats.WindowSeconds))
+	}
+
+	if c.KeyUsage.Purge.Enabled {
+		p.positive("key_usage.purge.idle_seconds", int64(c.KeyUsage.Purge.IdleSeconds))
+		p.positive("key_usage.purge.interval_seconds", int64(c.KeyUsage.Purge.IntervalSeconds))
+	}
+	if rate := c.KeyUsage.Migration.KeysPerSecond; rate <= 0 {
+		p.addf("key_usage.migration.keys_per_second must be positive, got %g", rate)
+	}
+
+	if c.Housekeeping.LeaderElection {
+		if c.Housekeeping.LeaseKey == "" {
+			p.addf("housekeeping.lease_key must not be empty")
+		}
+		p.positive("housekeeping.lease_ttl_seconds", int64(c.Housekeeping.LeaseTTLSeconds))
+	}
+
+	if c.Rules.Enabled {
+		for i, rule := range c.Rules.Rules {
+			field := fmt.Sprintf("rules.rules[%d]", i)
+			p.template(field+".template", rl, rule.Template)
+			if rule.Strategy != "" {
+				p.strategy(field+".strategy", rule.Strategy)
+			}
+			p.nonNegative(field+".limit", rule.Limit)
+			p.nonNegative(field+".window_seconds", int64(rule.WindowSeconds))
+		}
+		if etcd := c.Rules.Etcd; etcd.Enabled {
+			if len(etcd.Endpoints) == 0 {
+				p.addf("rules.etcd.endpoints must not be empty")
+			}
+			if !strings.HasPrefix(etcd.Prefix, "/") {
+				p.addf("rules.etcd.prefix must start with /, got %q", etcd.Prefix)
+			}
+			p.positive("rules.etcd.dial_timeout_ms", int64(etcd.DialTimeoutMs))
+		}
+	}
+
+	if c.Classification.Enabled {
+		names := make(map[string]bool, len(c.Classification.Classes))
+		for i, class := range c.Classification.Classes {
+			field := fmt.Sprintf("classification.classes[%d]", i)
+			if class.Name == "" {
+				p.addf("%s.name is required", field)
+			} else if names[class.Name] {
+				p.addf("%s.name %q is duplicated", field, class.Name)
+			}
+			names[class.Name] = true
+			p.template(field+".template", rl, class.Template)
+			if class.Strategy != "" {
+				p.strategy(field+".strategy", class.Strategy)
+			}
+			p.nonNegative(field+".limit", class.Limit)
+			p.nonNegative(field+".window_seconds", int64(class.WindowSeconds))
+		}
+	}
+
+	c.LoadShedding.validate(&p)
+
+	if quarantine := c.Namespaces.Quarantine; quarantine.Enabled {
+		const field = "namespaces.quarantine"
+		p.positive(field+".slow_ms", int64(quarantine.SlowMs))
+		p.positive(field+".window_seconds", int64(quarantine.WindowSeconds))
+		p.positive(field+".min_requests", quarantine.MinRequests)
+		if ratio := quarantine.SlowRatio; ratio <= 0 || ratio > 1 {
+			p.addf("%s.slow_ratio must be above 0 and at most 1, got %g", field, ratio)
+		}
+		p.positive(field+".duration_seconds", int64(quarantine.DurationSeconds))
+		p.positive(field+".limit", quarantine.Limit)
+		p.positive(field+".limit_window_seconds", int64(quarantine.LimitWindowSeconds))
+	}
+
+	if c.Crawlers.Enabled {
+		p.strategy("crawlers.strategy", c.Crawlers.Strategy)
+		names := make(map[string]bool, len(c.Crawlers.Crawlers))
+		for _, class := range c.Classification.Classes {
+			names[class.Name] = c.Classification.Enabled
+		}
+		for i, crawler := range c.Crawlers.Crawlers {
+			field := fmt.Sprintf("crawlers.crawlers[%d]", i)
+			if crawler.Name == "" {
+				p.addf("%s.name is required", field)
+			} else if names[crawler.Name] {
+				p.addf("%s.name %q is already a crawler or class", field, crawler.Name)
+			}
+			names[crawler.Name] = true
+			if len(crawler.UserAgents) == 0 {
+				p.addf("%s.user_agents must not be empty", field)
+			}
+			p.positive(field+".crawl_delay_seconds", int64(crawler.CrawlDelaySeconds))
+			p.nonNegative(field+".burst", crawler.Burst)
+		}
+	}
+
+	if len(p.list) > 0 {
+		return &ValidationError{Problems: p.list}
+	}
+	return nil
+}
+
+func (c RateLimiterConfig) validateLimiters(p *problems) {
+	names := make(map[string]bool, len(c.Limiters))
+	for i, limiter := range c.Limiters {
+		field := fmt.Sprintf("rate_limiter.limiters[%d]", i)
+		if limiter.Name == "" {
+			p.addf("%s.name is required", field)
+		} else if names[limiter.Name] {
+			p.addf("%s.name %q is duplicated", field, limiter.Name)
+		}
+		names[limiter.Name] = true
+		p.template(field+".template", c, limiter.Template)
+		if limiter.Strategy != "" {
+			p.strategy(field+".strategy", limiter.Strategy)
+		}
+		p.nonNegative(field+".limit", limiter.Limit)
+		p.nonNegative(field+".window_seconds", int64(limiter.WindowSeconds))
+	}
+	for i, route := range c.Routes {
+		field := fmt.Sprintf("rate_limiter.routes[%d]", i)
+		if !strings.HasPrefix(route.Path, "/") {
+			p.addf("%s.path must start with /, got %q", field, route.Path)
+		}
+		if !names[route.Limiter] {
+			p.addf("%s.limiter: unknown limiter %q", field, route.Limiter)
+		}
+	}
+}
+
+func (c LoadSheddingConfig) validate(p *problems) {
+	if !c.Enabled {
+		return
+	}
+
+	const field = "load_shedding"
+	p.nonNegative(field+".max_in_flight", c.MaxInFlight)
+	p.nonNegative(field+".max_goroutines", int64(c.MaxGoroutines))
+	if c.MaxCPU < 0 || c.MaxCPU > 1 {
+		p.addf("%s.max_cpu must be between 0 and 1, got %v", field, c.MaxCPU)
+	}
+	if c.MaxInFlight <= 0 && c.MaxGoroutines <= 0 && c.MaxCPU <= 0 {
+		p.addf("%s needs at least one of max_in_flight, max_goroutines or max_cpu", field)
+	}
+	if c.ShedFrom <= 0 || c.ShedFrom > 1 {
+		p.addf("%s.shed_from must be above 0 and at most 1, got %v", field, c.ShedFrom)
+	}
+	p.positive(field+".sample_interval_ms", int64(c.SampleIntervalMs))
+	p.positive(field+".retry_after_seconds", int64(c.RetryAfterSeconds))
+	seen := make(map[string]bool, len(c.Priorities))
+	for i, priority := range c.Priorities {
+		priorityField := fmt.Sprintf("%s.priorities[%d]", field, i)
+		if priority.Class == "" {
+			p.addf("%s.class must not be empty", priorityField)
+		} else if seen[priority.Class] {
+			p.addf("%s.class: class %q is listed twice", priorityField, priority.Class)
+		}
+		seen[priority.Class] = true
+	}
+}
+
+func (c ClockConfig) validate(p *problems) {
+	const field = "rate_limiter.clock"
+	p.clockSource(field+".source", c.Source)
+	p.positive(field+".sync_interval_seconds", int64(c.SyncIntervalSeconds))
+	p.positive(field+".max_round_trip_ms", int64(c.MaxRoundTripMs))
+
+	for _, strategy := range slices.Sorted(maps.Keys(c.Strategies)) {
+		p.strategy(field+".strategies", strategy)
+		p.clockSource(field+".strategies."+strategy, c.Strategies[strategy])
+	}
+}
+
+func (c KeyFieldsConfig) validate(p *problems) {
+	if !c.Enabled {
+		return
+	}
+
+	const field = "rate_limiter.key_fields"
+	p.positive(field+".max_body_bytes", c.MaxBodyBytes)
+	for i, route := range c.Routes {
+		routeField := fmt.Sprintf("%s.routes[%d]", field, i)
+		if !strings.HasPrefix(route.Path, "/") {
+			p.addf("%s.path must start with /, got %q", routeField, route.Path)
+		}
+		if !slices.Contains(KeyFieldSources, route.Source) {
+			p.addf("%s.source: unknown source %q (want one of %s)", routeField, route.Source, strings.Join(KeyFieldSources, ", "))
+		}
+		if route.Field == "" {
+			p.addf("%s.field must not be empty", routeField)
+		}
+	}
+}
+
+func (c KeyTemplateConfig) validate(p *problems) {
+	if !c.Enabled {
+		return
+	}
+
+	const field = "rate_limiter.key_template"
+	if !strings.Contains(c.Template, "{") {
+		p.addf("%s.template must have at least one placeholder, got %q", field, c.Template)
+	}
+	seen := make(map[string]bool, len(c.Variables))
+	for i, variable := range c.Variables {
+		variableField := fmt.Sprintf("%s.variables[%d]", field, i)
+		if variable.Name == "" {
+			p.addf("%s.name must not be empty", variableField)
+		} else if seen[variable.Name] {
+			p.addf("%s.name: variable %q is listed twice", variableField, variable.Name)
+		}
+		seen[variable.Name] = true
+		if !slices.Contains(KeyTemplateSources, variable.Source) {
+			p.addf("%s.source: unknown source %q (want one of %s)", variableField, variable.Source, strings.Join(KeyTemplateSources, ", "))
+		}
+		if variable.Source == "header" && variable.Field == "" {
+			p.addf("%s.field must name the header", variableField)
+		}
+	}
+}
+
+func (c LocalizationConfig) validate(p *problems) {
+	if !c.Enabled {
+		return
+	}
+
+	for i, message := range c.Messages {
+		field := fmt.Sprintf("server.localization.messages[%d]", i)
+		if _, err := language.Parse(message.Language); err != nil {
+			p.addf("%s.language: invalid language %q: %v", field, message.Language, err)
+		}
+		if message.Message == "" || message.Translation == "" {
+			p.addf("%s: message and translation must not be empty", field)
+		}
+		// Messages with values are format strings; their translations are
+		// given the same arguments.
+		if want, got := formatVerbs(message.Message), formatVerbs(message.Translation); !slices.Equal(want, got) {
+			p.addf("%s.translation: formatting verbs [%s] don't match the message's [%s]", field, strings.Join(got, " "), strings.Join(want, " "))
+		}
+	}
+}
+
+// formatVerbs lists the fmt verbs of format by the argument they format,
+// following explicit argument indexes such as %[2]d, so a translation may
+// reorder its arguments. Arguments consumed by a '*' width or precision
+// are listed as "*".
+func formatVerbs(format string) []string {
+	verbs := make(map[int]string)
+	arg, count := 0, 0
+	use := func(verb string) {
+		verbs[arg] = verb
+		arg++
+		count = max(count, arg)
+	}
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			i++
+		}
+	spec:
+		for i < len(format) {
+			switch c := format[i]; {
+			case c == '[':
+				end := strings.IndexByte(format[i:], ']')
+				if end < 0 {
+					return append(orderedVerbs(verbs, count), "%!(BADINDEX)")
+				}
+				if n, err := strconv.Atoi(format[i+1 : i+end]); err == nil && n > 0 {
+					arg = n - 1
+				}
+				i += end + 1
+			case c == '*':
+				use("*")
+				i++
+			case c == '.' || (c >= '0' && c <= '9'):
+				i++
+			default:
+				break spec
+			}
+		}
+		if i >= len(format) {
+			return append(orderedVerbs(verbs, count), "%!(NOVERB)")
+		}
+		verb, size := utf8.DecodeRuneInString(format[i:])
+		i += size - 1
+		if verb != '%' {
+			use("%" + string(verb))
+		}
+	}
+	return orderedVerbs(verbs, count)
+}
+
+func orderedVerbs(verbs map[int]string, count int) []string {
+	ordered := make([]string, count)
+	for arg, verb := range verbs {
+		ordered[arg] = verb
+	}
+	return ordered
+}
+
+func (c AbuseScoreConfig) validate(p *problems) {
+	if !c.Enabled {
+		return
+	}
+
+	const field = "rate_limiter.abuse_score"
+	if c.Header == "" {
+		p.addf("%s.header must not be empty", field)
+	}
+	if c.UnscoredMultiplier <= 0 {
+		p.addf("%s.unscored_multiplier must be positive, got %g", field, c.UnscoredMultiplier)
+	}
+	if len(c.Ranges) == 0 {
+		p.addf("%s.ranges must not be empty", field)
+	}
+	for i, r := range c.Ranges {
+		rangeField := fmt.Sprintf("%s.ranges[%d]", field, i)
+		if r.Min > r.Max {
+			p.addf("%s.min must not be above max, got %g and %g", rangeField, r.Min, r.Max)
+		}
+		if r.Multiplier <= 0 {
+			p.addf("%s.multiplier must be positive, got %g", rangeField, r.Multiplier)
+		}
+	}
+}
+
+func (c GraphQLConfig) validate(p *problems) {
+	if !c.Enabled {
+		return
+	}
+
+	const field = "rate_limiter.graphql"
+	if !strings.HasPrefix(c.Path, "/") {
+		p.addf("%s.path must start with /, got %q", field, c.Path)
+	}
+	p.nonNegative(field+".max_depth", int64(c.MaxDepth))
+	p.nonNegative(field+".max_complexity", c.MaxComplexity)
+	p.nonNegative(field+".default_list_size", c.DefaultListSize)
+	p.positive(field+".max_body_bytes", c.MaxBodyBytes)
+	seen := make(map[string]bool, len(c.Operations))
+	for i, operation := range c.Operations {
+		operationField := fmt.Sprintf("%s.operations[%d]", field, i)
+		if operation.Name == "" {
+			p.addf("%s.name must not be empty", operationField)
+		} else if seen[operation.Name] {
+			p.addf("%s.name: operation %q is listed twice", operationField, operation.Name)
+		}
+		seen[operation.Name] = true
+		p.nonNegative(operationField+".cost", operation.Cost)
+	}
+}
+
+func (s RateLimiterStrategiesConfig) validate(p *problems) {
+	const tb = "rate_limiter.strategies.token_bucket"
+	p.keyPrefix(tb+".key_prefix", s.TokenBucket.KeyPrefix)
+	p.nonNegative(tb+".ttl_buffer_seconds", int64(s.TokenBucket.TTLBufferSeconds))
+	p.positive(tb+".bucket_size", s.TokenBucket.BucketSize)
+	p.positive(tb+".refill_rate_per_second", s.TokenBucket.RefillRatePerSecond)
+	p.nonNegative(tb+".lease.size", s.TokenBucket.Lease.Size)
+	p.nonNegative(tb+".lease.ttl_ms", s.TokenBucket.Lease.TTLMillis)
+	if s.TokenBucket.Lease.Size > s.TokenBucket.BucketSize {
+		p.addf("%s.lease.size must not exceed bucket_size, got %d", tb, s.TokenBucket.Lease.Size)
+	}
+	p.nonNegative(tb+".global.bucket_size", s.TokenBucket.Global.BucketSize)
+	if s.TokenBucket.Global.BucketSize > 0 {
+		if rate := s.TokenBucket.Global.RefillRatePerSecond; rate <= 0 {
+			p.addf("%s.global.refill_rate_per_second must be positive, got %g", tb, rate)
+		}
+		if s.TokenBucket.Lease.Size > 0 {
+			p.addf("%s.lease can't be combined with %s.global", tb, tb)
+		}
+	}
+
+	const swl = "rate_limiter.strategies.sliding_window_log"
+	p.keyPrefix(swl+".key_prefix", s.SlidingWindowLog.KeyPrefix)
+	p.nonNegative(swl+".ttl_buffer_seconds", int64(s.SlidingWindowLog.TTLBufferSeconds))
+	p.positive(swl+".window_size_seconds", int64(s.SlidingWindowLog.WindowSizeSeconds))
+	p.positive(swl+".bucket_size", s.SlidingWindowLog.BucketSize)
+	p.nonNegative(swl+".max_entries", s.SlidingWindowLog.MaxEntries)
+
+	const fw = "rate_limiter.strategies.fixed_window"
+	p.keyPrefix(fw+".key_prefix", s.FixedWindow.KeyPrefix)
+	p.positive(fw+".window_size_seconds", int64(s.FixedWindow.WindowSizeSeconds))
+	p.positive(fw+".bucket_size", s.FixedWindow.BucketSize)
+
+	const swc = "rate_limiter.strategies.sliding_window_counter"
+	p.keyPrefix(swc+".key_prefix", s.SlidingWindowCounter.KeyPrefix)
+	p.nonNegative(swc+".ttl_buffer_seconds", int64(s.SlidingWindowCounter.TTLBufferSeconds))
+	p.positive(swc+".window_size_seconds", int64(s.SlidingWindowCounter.WindowSizeSeconds))
+	p.positive(swc+".bucket_size", s.SlidingWindowCounter.BucketSize)
+	if s.SlidingWindowCounter.SubWindows < 0 || s.SlidingWindowCounter.SubWindows > maxSubWindows {
+		p.addf("%s.sub_windows must be between 0 and %d, got %d", swc, maxSubWindows, s.SlidingWindowCounter.SubWindows)
+	}
+
+	const quota = "rate_limiter.strategies.quota"
+	p.keyPrefix(quota+".key_prefix", s.Quota.KeyPrefix)
+	p.nonNegative(quota+".ttl_buffer_seconds", int64(s.Quota.TTLBufferSeconds))
+	p.positive(quota+".limit", s.Quota.Limit)
+	if s.Quota.Period != "daily" && s.Quota.Period != "monthly" {
+		p.addf("%s.period must be daily or monthly, got %q", quota, s.Quota.Period)
+	}
+	if s.Quota.AnchorDay < 0 || s.Quota.AnchorDay > 28 {
+		p.addf("%s.anchor_day must be between 1 and 28, got %d", quota, s.Quota.AnchorDay)
+	}
+
+	const hier = "rate_limiter.strategies.hierarchical"
+	p.keyPrefix(hier+".key_prefix", s.Hierarchical.KeyPrefix)
+	p.nonNegative(hier+".ttl_buffer_seconds", int64(s.Hierarchical.TTLBufferSeconds))
+	p.positive(hier+".user.bucket_size", s.Hierarchical.User.BucketSize)
+	p.positive(hier+".user.refill_rate_per_second", s.Hierarchical.User.RefillRatePerSecond)
+	p.nonNegative(hier+".organization.bucket_size", s.Hierarchical.Organization.BucketSize)
+	if s.Hierarchical.Organization.BucketSize > 0 {
+		p.positive(hier+".organization.refill_rate_per_second", s.Hierarchical.Organization.RefillRatePerSecond)
+	}
+	p.nonNegative(hier+".global.bucket_size", s.Hierarchical.Global.BucketSize)
+	if s.Hierarchical.Global.BucketSize > 0 {
+		p.positive(hier+".global.refill_rate_per_second", s.Hierarchical.Global.RefillRatePerSecond)
+	}
+
+	const mw = "rate_limiter.strategies.multi_window"
+	p.keyPrefix(mw+".key_prefix", s.MultiWindow.KeyPrefix)
+	p.nonNegative(mw+".ttl_buffer_seconds", int64(s.MultiWindow.TTLBufferSeconds))
+	p.positive(mw+".burst.window_size_seconds", int64(s.MultiWindow.Burst.WindowSizeSeconds))
+	p.positive(mw+".burst.limit", s.MultiWindow.Burst.Limit)
+	p.positive(mw+".sustained.window_size_seconds", int64(s.MultiWindow.Sustained.WindowSizeSeconds))
+	p.positive(mw+".sustained.limit", s.MultiWindow.Sustained.Limit)
+	if s.MultiWindow.Burst.WindowSizeSeconds >= s.MultiWindow.Sustained.WindowSizeSeconds {
+		p.addf("%s.burst.window_size_seconds must be shorter than %s.sustained.window_size_seconds", mw, mw)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(s.Custom)) {
+		if slices.Contains(Strategies, name) {
+			p.addf("rate_limiter.strategies.custom.%s: name of a built-in strategy", name)
+		}
+	}
+}
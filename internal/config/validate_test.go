@@ -0,0 +1,134 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// defaultConfig returns the configuration Load produces without a config
+// file or environment.
+func defaultConfig(t *testing.T) *Config {
+	t.Helper()
+	v := viper.New()
+	setDefaults(v)
+	var cfg Config
+	require.NoError(t, v.Unmarshal(&cfg))
+	require.NoError(t, cfg.Validate())
+	return &cfg
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(cfg *Config)
+		problems []string
+	}{
+		{
+			name: "bucket size not positive",
+			modify: func(cfg *Config) {
+				cfg.RateLimiter.Strategies.TokenBucket.BucketSize = 0
+				cfg.RateLimiter.Strategies.FixedWindow.BucketSize = -5
+			},
+			problems: []string{
+				"rate_limiter.strategies.token_bucket.bucket_size must be positive, got 0",
+				"rate_limiter.strategies.fixed_window.bucket_size must be positive, got -5",
+			},
+		},
+		{
+			name: "zero window",
+			modify: func(cfg *Config) {
+				cfg.RateLimiter.Strategies.SlidingWindowCounter.WindowSizeSeconds = 0
+			},
+			problems: []string{
+				"rate_limiter.strategies.sliding_window_counter.window_size_seconds must be positive, got 0",
+			},
+		},
+		{
+			name: "unknown strategy",
+			modify: func(cfg *Config) {
+				cfg.RateLimiter.Strategy = "leaky_bucket"
+			},
+			problems: []string{
+				`rate_limiter.strategy: unknown strategy "leaky_bucket"`,
+			},
+		},
+		{
+			name: "key prefix with whitespace",
+			modify: func(cfg *Config) {
+				cfg.RateLimiter.Strategies.TokenBucket.KeyPrefix = "rl: tb"
+			},
+			problems: []string{
+				`rate_limiter.strategies.token_bucket.key_prefix must not contain whitespace, got "rl: tb"`,
+			},
+		},
+		{
+			name: "every problem is reported",
+			modify: func(cfg *Config) {
+				cfg.RateLimiter.Strategy = "leaky_bucket"
+				cfg.RateLimiter.Strategies.TokenBucket.BucketSize = 0
+				cfg.RateLimiter.Strategies.SlidingWindowLog.WindowSizeSeconds = 0
+				cfg.RateLimiter.Strategies.Quota.KeyPrefix = "quota\t"
+			},
+			problems: []string{
+				`rate_limiter.strategy: unknown strategy "leaky_bucket"`,
+				"rate_limiter.strategies.token_bucket.bucket_size must be positive, got 0",
+				"rate_limiter.strategies.sliding_window_log.window_size_seconds must be positive, got 0",
+				`rate_limiter.strategies.quota.key_prefix must not contain whitespace, got "quota\t"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig(t)
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Len(t, validationErr.Problems, len(tt.problems), "problems: %v", validationErr.Problems)
+			for _, problem := range tt.problems {
+				assert.Condition(t, func() bool {
+					for _, got := range validationErr.Problems {
+						if strings.HasPrefix(got, problem) {
+							return true
+						}
+					}
+					return false
+				}, "missing problem %q in %v", problem, validationErr.Problems)
+			}
+			assert.Contains(t, err.Error(), "invalid config")
+		})
+	}
+}
+
+func TestFormatVerbs(t *testing.T) {
+	assert.Equal(t, []string{"%d"}, formatVerbs("Rate limit exceeded: the operation costs %d"))
+	assert.Equal(t, []string{"%d", "%s"}, formatVerbs("%[2]s costs %[1]d, 100%%"))
+	assert.Equal(t, []string{"*", "%f"}, formatVerbs("%-*.2f"), "flags, width and precision may differ")
+	assert.Empty(t, formatVerbs("Too many requests"))
+}
+
+func TestLocalizationConfig_Validate(t *testing.T) {
+	config := LocalizationConfig{Enabled: true, Messages: []TranslationConfig{
+		{Language: "fr", Message: "the operation costs %d", Translation: "l'opération coûte %d"},
+		{Language: "de", Message: "%s costs %d", Translation: "%[2]d kostet %[1]s"},
+		{Language: "es", Message: "the operation costs %d", Translation: "la operación cuesta %s"},
+		{Language: "it", Message: "the operation costs %d", Translation: "l'operazione costa"},
+		{Language: "pt", Message: "Too many requests", Translation: "Demasiados pedidos: %d"},
+	}}
+
+	var p problems
+	config.validate(&p)
+
+	assert.Equal(t, []string{
+		"server.localization.messages[2].translation: formatting verbs [%s] don't match the message's [%d]",
+		"server.localization.messages[3].translation: formatting verbs [] don't match the message's [%d]",
+		"server.localization.messages[4].translation: formatting verbs [%d] don't match the message's []",
+	}, p.list)
+}
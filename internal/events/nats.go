@@ -0,0 +1,146 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const natsDialTimeout = 5 * time.Second
+
+var ErrInvalidSubject = errors.New("nats subject must be non-empty and contain no whitespace")
+
+// NATSPublisher publishes messages with the NATS text protocol, which is small
+// enough to speak directly instead of pulling in a client library. It
+// reconnects on the next batch after a failure.
+type NATSPublisher struct {
+	address string
+	subject string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	writer *bufio.Writer
+}
+
+// NewNATSPublisher publishes to subject on the server at address, given as
+// host:port or nats://host:port.
+func NewNATSPublisher(address string, subject string) (*NATSPublisher, error) {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return nil, ErrInvalidSubject
+	}
+	address = strings.TrimPrefix(address, "nats://")
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("invalid nats address %q: %w", address, err)
+	}
+
+	return &NATSPublisher{address: address, subject: subject}, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, messages [][]byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = p.conn.SetWriteDeadline(deadline)
+	} else {
+		_ = p.conn.SetWriteDeadline(time.Now().Add(natsDialTimeout))
+	}
+
+	for _, message := range messages {
+		p.writer.WriteString("PUB " + p.subject + " " + strconv.Itoa(len(message)) + "\r\n")
+		p.writer.Write(message)
+		p.writer.WriteString("\r\n")
+	}
+	if err := p.writer.Flush(); err != nil {
+		p.disconnect()
+		return err
+	}
+	return nil
+}
+
+func (p *NATSPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.disconnect()
+	return nil
+}
+
+// connect dials the server, waits for its INFO greeting and identifies
+// itself. The caller holds p.mu.
+func (p *NATSPublisher) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: natsDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.address)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(natsDialTimeout))
+	info, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(info, "INFO") {
+		conn.Close()
+		return fmt.Errorf("nats handshake failed: %q %v", strings.TrimSpace(info), err)
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	writer := bufio.NewWriter(conn)
+	writer.WriteString(`CONNECT {"verbose":false,"pedantic":false,"name":"go-rate-limiter"}` + "\r\n")
+	if err := writer.Flush(); err != nil {
+		conn.Close()
+		return err
+	}
+
+	p.conn = conn
+	p.writer = writer
+	go p.readLoop(conn, reader)
+	return nil
+}
+
+// readLoop answers the server's keepalive PINGs and reports protocol errors
+// until conn is closed.
+func (p *NATSPublisher) readLoop(conn net.Conn, reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			p.mu.Lock()
+			if p.conn == conn {
+				p.disconnect()
+			}
+			p.mu.Unlock()
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			p.mu.Lock()
+			if p.conn == conn {
+				p.writer.WriteString("PONG\r\n")
+				p.writer.Flush()
+			}
+			p.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			slog.Error("nats server error", "error", strings.TrimSpace(line))
+		}
+	}
+}
+
+func (p *NATSPublisher) disconnect() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+		p.writer = nil
+	}
+}
@@ -0,0 +1,83 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATS accepts one connection and sends every protocol line it receives,
+// payloads included, to lines.
+func fakeNATS(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	lines := make(chan string, 100)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- strings.TrimRight(line, "\r\n")
+		}
+	}()
+
+	return listener.Addr().String(), lines
+}
+
+func TestNATSPublisher_Publish(t *testing.T) {
+	address, lines := fakeNATS(t)
+
+	publisher, err := NewNATSPublisher("nats://"+address, "ratelimit.decisions")
+	require.NoError(t, err)
+	require.NoError(t, publisher.Publish(context.Background(), [][]byte{[]byte(`{"a":1}`), []byte(`{"b":22}`)}))
+	require.NoError(t, publisher.Close())
+
+	var received []string
+	for line := range lines {
+		received = append(received, line)
+	}
+	require.Len(t, received, 5)
+	assert.True(t, strings.HasPrefix(received[0], "CONNECT "))
+	assert.Equal(t, []string{
+		"PUB ratelimit.decisions 7", `{"a":1}`,
+		"PUB ratelimit.decisions 8", `{"b":22}`,
+	}, received[1:])
+}
+
+func TestNewNATSPublisher_Invalid(t *testing.T) {
+	_, err := NewNATSPublisher("localhost:4222", "")
+	assert.ErrorIs(t, err, ErrInvalidSubject)
+	_, err = NewNATSPublisher("localhost:4222", "two words")
+	assert.ErrorIs(t, err, ErrInvalidSubject)
+	_, err = NewNATSPublisher("localhost", "subject")
+	assert.Error(t, err)
+}
+
+func TestNATSPublisher_ConnectFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	publisher, err := NewNATSPublisher(address, "subject")
+	require.NoError(t, err)
+	assert.Error(t, publisher.Publish(context.Background(), [][]byte{[]byte("{}")}))
+}
@@ -0,0 +1,168 @@
+// Package events streams rate limit decisions to a message broker for offline
+// analysis of traffic patterns.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = time.Second
+	DefaultBufferSize    = 10000
+
+	DecisionAllowed = "allowed"
+	DecisionDenied  = "denied"
+	DecisionError   = "error"
+)
+
+// Decision is one rate limit check. Keys identify customers, so only a hash
+// of the key is published.
+type Decision struct {
+	Time          time.Time `json:"time"`
+	DecisionID    string    `json:"decision_id,omitempty"`
+	KeyHash       string    `json:"key_hash"`
+	Strategy      string    `json:"strategy"`
+	Namespace     string    `json:"namespace,omitempty"`
+	Decision      string    `json:"decision"`
+	LatencyMicros int64     `json:"latency_us"`
+}
+
+// Emitter accepts decisions without blocking the request path.
+type Emitter interface {
+	Emit(decision Decision)
+}
+
+// Publisher sends a batch of encoded messages to a broker.
+type Publisher interface {
+	Publish(ctx context.Context, messages [][]byte) error
+	Close() error
+}
+
+type StreamConfig struct {
+	BatchSize     int
+	FlushInterval time.Duration
+	// BufferSize bounds the decisions waiting to be published. When the
+	// broker can't keep up, further decisions are dropped rather than
+	// slowing down requests.
+	BufferSize int
+}
+
+// Stream batches decisions and hands them to a Publisher from a background
+// worker.
+type Stream struct {
+	publisher     Publisher
+	batchSize     int
+	flushInterval time.Duration
+	buffer        chan Decision
+	dropped       atomic.Int64
+	done          chan struct{}
+}
+
+func NewStream(publisher Publisher, config StreamConfig) *Stream {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultFlushInterval
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = DefaultBufferSize
+	}
+
+	return &Stream{
+		publisher:     publisher,
+		batchSize:     config.BatchSize,
+		flushInterval: config.FlushInterval,
+		buffer:        make(chan Decision, config.BufferSize),
+		done:          make(chan struct{}),
+	}
+}
+
+func (s *Stream) Emit(decision Decision) {
+	select {
+	case s.buffer <- decision:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped reports how many decisions were discarded because the buffer was
+// full.
+func (s *Stream) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Start publishes batches until ctx is cancelled, then flushes what is left
+// and closes the publisher. Done is closed once that has finished.
+func (s *Stream) Start(ctx context.Context) {
+	go func() {
+		defer close(s.done)
+		defer s.publisher.Close()
+
+		ticker := time.NewTicker(s.flushInterval)
+		defer ticker.Stop()
+
+		batch := make([]Decision, 0, s.batchSize)
+		var reportedDrops int64
+		for {
+			select {
+			case <-ctx.Done():
+				s.drain(&batch)
+				s.flush(context.Background(), batch)
+				return
+			case decision := <-s.buffer:
+				batch = append(batch, decision)
+				if len(batch) < s.batchSize {
+					continue
+				}
+			case <-ticker.C:
+				if dropped := s.Dropped(); dropped > reportedDrops {
+					slog.Warn("decision stream buffer full, dropped decisions", "dropped", dropped-reportedDrops)
+					reportedDrops = dropped
+				}
+			}
+
+			s.flush(ctx, batch)
+			batch = batch[:0]
+		}
+	}()
+}
+
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Stream) drain(batch *[]Decision) {
+	for {
+		select {
+		case decision := <-s.buffer:
+			*batch = append(*batch, decision)
+		default:
+			return
+		}
+	}
+}
+
+func (s *Stream) flush(ctx context.Context, batch []Decision) {
+	if len(batch) == 0 {
+		return
+	}
+
+	messages := make([][]byte, 0, len(batch))
+	for _, decision := range batch {
+		message, err := json.Marshal(decision)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	if err := s.publisher.Publish(ctx, messages); err != nil {
+		slog.Error("failed to publish decisions", "count", len(messages), "error", err.Error())
+	}
+}
@@ -0,0 +1,87 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingPublisher struct {
+	mu      sync.Mutex
+	batches [][][]byte
+	closed  bool
+}
+
+func (r *recordingPublisher) Publish(ctx context.Context, messages [][]byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, messages)
+	return nil
+}
+
+func (r *recordingPublisher) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+func (r *recordingPublisher) batchSizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sizes := make([]int, 0, len(r.batches))
+	for _, batch := range r.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func TestStream_BatchesAndFlushesOnStop(t *testing.T) {
+	publisher := &recordingPublisher{}
+	stream := NewStream(publisher, StreamConfig{BatchSize: 2, FlushInterval: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream.Start(ctx)
+	for i := 0; i < 3; i++ {
+		stream.Emit(Decision{KeyHash: "3f9ce8e1f5f0c7a2", Strategy: "token_bucket", Decision: DecisionAllowed})
+	}
+
+	require.Eventually(t, func() bool { return len(publisher.batchSizes()) == 1 }, time.Second, time.Millisecond)
+	cancel()
+	<-stream.Done()
+
+	assert.Equal(t, []int{2, 1}, publisher.batchSizes(), "the leftover decision is flushed on shutdown")
+	assert.True(t, publisher.closed)
+
+	var decision map[string]interface{}
+	require.NoError(t, json.Unmarshal(publisher.batches[0][0], &decision))
+	assert.Equal(t, "3f9ce8e1f5f0c7a2", decision["key_hash"])
+	assert.Equal(t, "token_bucket", decision["strategy"])
+	assert.Equal(t, "allowed", decision["decision"])
+}
+
+func TestStream_FlushesOnInterval(t *testing.T) {
+	publisher := &recordingPublisher{}
+	stream := NewStream(publisher, StreamConfig{BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream.Start(ctx)
+	stream.Emit(Decision{KeyHash: "3f9ce8e1f5f0c7a2", Decision: DecisionDenied})
+
+	assert.Eventually(t, func() bool { return len(publisher.batchSizes()) == 1 }, time.Second, time.Millisecond)
+}
+
+func TestStream_DropsWhenBufferFull(t *testing.T) {
+	stream := NewStream(&recordingPublisher{}, StreamConfig{BufferSize: 2})
+
+	for i := 0; i < 5; i++ {
+		stream.Emit(Decision{KeyHash: "3f9ce8e1f5f0c7a2"})
+	}
+	assert.Equal(t, int64(3), stream.Dropped())
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultTailBuffer is how many decisions a subscriber may fall behind before
+// it starts missing them.
+const DefaultTailBuffer = 256
+
+// Tail fans decisions out to live subscribers, such as an operator following
+// them from the admin API. Slow subscribers miss decisions rather than slowing
+// down requests.
+type Tail struct {
+	mu          sync.RWMutex
+	subscribers map[chan Decision]struct{}
+	count       atomic.Int64
+}
+
+func NewTail() *Tail {
+	return &Tail{subscribers: make(map[chan Decision]struct{})}
+}
+
+func (t *Tail) Emit(decision Decision) {
+	if t.count.Load() == 0 {
+		return
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for subscriber := range t.subscribers {
+		select {
+		case subscriber <- decision:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every decision emitted from now on and
+// a function that unsubscribes and closes it.
+func (t *Tail) Subscribe(buffer int) (<-chan Decision, func()) {
+	if buffer <= 0 {
+		buffer = DefaultTailBuffer
+	}
+	subscriber := make(chan Decision, buffer)
+
+	t.mu.Lock()
+	t.subscribers[subscriber] = struct{}{}
+	t.count.Add(1)
+	t.mu.Unlock()
+
+	var once sync.Once
+	return subscriber, func() {
+		once.Do(func() {
+			t.mu.Lock()
+			delete(t.subscribers, subscriber)
+			t.count.Add(-1)
+			t.mu.Unlock()
+			close(subscriber)
+		})
+	}
+}
+
+type multiEmitter []Emitter
+
+func (m multiEmitter) Emit(decision Decision) {
+	for _, emitter := range m {
+		emitter.Emit(decision)
+	}
+}
+
+// Tee emits every decision to each of emitters.
+func Tee(emitters ...Emitter) Emitter {
+	if len(emitters) == 1 {
+		return emitters[0]
+	}
+	return multiEmitter(emitters)
+}
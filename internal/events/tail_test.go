@@ -0,0 +1,42 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTail(t *testing.T) {
+	tail := NewTail()
+	tail.Emit(Decision{KeyHash: "before"})
+
+	decisions, unsubscribe := tail.Subscribe(1)
+	tail.Emit(Decision{KeyHash: "first"})
+	tail.Emit(Decision{KeyHash: "dropped"})
+
+	assert.Equal(t, "first", (<-decisions).KeyHash, "decisions before subscribing are not replayed")
+	assert.Empty(t, decisions, "a full subscriber misses decisions")
+
+	unsubscribe()
+	unsubscribe()
+	_, open := <-decisions
+	assert.False(t, open)
+	tail.Emit(Decision{KeyHash: "after"})
+}
+
+type countingEmitter struct {
+	count int
+}
+
+func (c *countingEmitter) Emit(decision Decision) {
+	c.count++
+}
+
+func TestTee(t *testing.T) {
+	first, second := &countingEmitter{}, &countingEmitter{}
+	Tee(first, second).Emit(Decision{})
+
+	assert.Equal(t, 1, first.count)
+	assert.Equal(t, 1, second.count)
+	assert.Same(t, first, Tee(first))
+}
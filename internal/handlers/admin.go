@@ -0,0 +1,943 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/events"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/pmujumdar27/go-rate-limiter/internal/middleware"
+	"github.com/pmujumdar27/go-rate-limiter/internal/notify"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type AdminHandler struct {
+	policies  *ratelimit.PolicyRegistry
+	denialLog *ratelimit.DenialLog
+	throttle  *ratelimit.Throttle
+	penalties *ratelimit.PenaltyBox
+	notes     *ratelimit.KeyNotes
+	notifier  notify.Notifier
+	topKeys   *ratelimit.TopKeys
+	keyUsage  *ratelimit.KeyUsage
+	state     *ratelimit.StateTransfer
+	migration *ratelimit.KeyMigration
+	strategy  atomic.Value
+	gatherer  prometheus.Gatherer
+
+	switchStrategy func(strategy string) error
+	decisionTail   *events.Tail
+	tailCtx        context.Context
+	migrationCtx   context.Context
+}
+
+// tailHeartbeat keeps idle decision tails open through proxies.
+const tailHeartbeat = 15 * time.Second
+
+func NewAdminHandler(policies *ratelimit.PolicyRegistry) *AdminHandler {
+	a := &AdminHandler{
+		policies: policies,
+		gatherer: prometheus.DefaultGatherer,
+	}
+	a.strategy.Store("")
+	return a
+}
+
+func (a *AdminHandler) WithDenialLog(denialLog *ratelimit.DenialLog) *AdminHandler {
+	a.denialLog = denialLog
+	return a
+}
+
+func (a *AdminHandler) WithThrottle(throttle *ratelimit.Throttle) *AdminHandler {
+	a.throttle = throttle
+	return a
+}
+
+func (a *AdminHandler) WithPenalties(penalties *ratelimit.PenaltyBox) *AdminHandler {
+	a.penalties = penalties
+	return a
+}
+
+func (a *AdminHandler) WithKeyNotes(notes *ratelimit.KeyNotes) *AdminHandler {
+	a.notes = notes
+	return a
+}
+
+// WithNotifier reports operator throttles to notifier.
+func (a *AdminHandler) WithNotifier(notifier notify.Notifier) *AdminHandler {
+	a.notifier = notifier
+	return a
+}
+
+func (a *AdminHandler) WithTopKeys(topKeys *ratelimit.TopKeys) *AdminHandler {
+	a.topKeys = topKeys
+	return a
+}
+
+func (a *AdminHandler) WithKeyUsage(keyUsage *ratelimit.KeyUsage) *AdminHandler {
+	a.keyUsage = keyUsage
+	return a
+}
+
+func (a *AdminHandler) WithStateTransfer(state *ratelimit.StateTransfer) *AdminHandler {
+	a.state = state
+	return a
+}
+
+// WithKeyMigration runs the migrations started at /admin/keys/migrate in
+// the background until they finish or ctx is done.
+func (a *AdminHandler) WithKeyMigration(ctx context.Context, migration *ratelimit.KeyMigration) *AdminHandler {
+	a.migration = migration
+	a.migrationCtx = ctx
+	return a
+}
+
+// WithStats reports strategy and the decision counters from gatherer at
+// /admin/stats.
+func (a *AdminHandler) WithStats(strategy string, gatherer prometheus.Gatherer) *AdminHandler {
+	a.strategy.Store(strategy)
+	a.gatherer = gatherer
+	return a
+}
+
+// WithStrategySwitch lets PUT /admin/strategy switch strategies through
+// switchStrategy.
+func (a *AdminHandler) WithStrategySwitch(switchStrategy func(strategy string) error) *AdminHandler {
+	a.switchStrategy = switchStrategy
+	return a
+}
+
+// WithDecisionTail streams the decisions emitted to tail at
+// /admin/decisions/tail until the request or ctx is done.
+func (a *AdminHandler) WithDecisionTail(ctx context.Context, tail *events.Tail) *AdminHandler {
+	a.decisionTail = tail
+	a.tailCtx = ctx
+	return a
+}
+
+type updatePolicyRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+func (a *AdminHandler) ListPolicies(c *gin.Context) {
+	policies := a.policies.List()
+
+	result := make([]gin.H, 0, len(policies))
+	for _, policy := range policies {
+		result = append(result, policyResponse(policy))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policies": result,
+	})
+}
+
+func (a *AdminHandler) UpdatePolicy(c *gin.Context) {
+	name := c.Param("name")
+
+	policy, exists := a.policies.Get(name)
+	if !exists {
+		middleware.RespondError(c, http.StatusNotFound, "Policy not found", "no policy named "+name)
+		return
+	}
+
+	var req updatePolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if req.Enabled == nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "field 'enabled' is required")
+		return
+	}
+
+	policy.SetEnabled(*req.Enabled)
+
+	c.JSON(http.StatusOK, policyResponse(policy))
+}
+
+// ExportDenials returns denied-request summaries between ?since and ?until
+// (RFC3339), capped at ?limit entries.
+func (a *AdminHandler) ExportDenials(c *gin.Context) {
+	if a.denialLog == nil {
+		middleware.RespondError(c, http.StatusNotFound, "Denial log disabled", "enable denial_log in the configuration to record denied requests")
+		return
+	}
+
+	since, err := parseOptionalTime(c.Query("since"))
+	if err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "since: "+err.Error())
+		return
+	}
+	until, err := parseOptionalTime(c.Query("until"))
+	if err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "until: "+err.Error())
+		return
+	}
+
+	limit := int64(1000)
+	if raw := c.Query("limit"); raw != "" {
+		limit, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || limit <= 0 || limit > 10000 {
+			middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "limit must be between 1 and 10000")
+			return
+		}
+	}
+
+	records, err := a.denialLog.Export(c.Request.Context(), since, until, limit)
+	if err != nil {
+		middleware.RespondError(c, http.StatusInternalServerError, "Export error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":   len(records),
+		"denials": records,
+	})
+}
+
+type setThrottleRequest struct {
+	Multiplier      *float64 `json:"multiplier"`
+	DurationSeconds int      `json:"duration_seconds"`
+}
+
+// SetThrottle scales every limit in the fleet by the given multiplier, e.g.
+// 0.2 to admit a fifth of the usual traffic. A positive duration_seconds lifts
+// the brake automatically.
+func (a *AdminHandler) SetThrottle(c *gin.Context) {
+	if !a.throttleEnabled(c) {
+		return
+	}
+
+	var req setThrottleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if req.Multiplier == nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "field 'multiplier' is required")
+		return
+	}
+	if req.DurationSeconds < 0 {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "duration_seconds must not be negative")
+		return
+	}
+
+	duration := time.Duration(req.DurationSeconds) * time.Second
+	if err := a.throttle.Set(c.Request.Context(), *req.Multiplier, duration); err != nil {
+		if errors.Is(err, ratelimit.ErrInvalidThrottleMultiplier) {
+			middleware.RespondError(c, http.StatusBadRequest, "Invalid request", err.Error())
+			return
+		}
+		middleware.RespondError(c, http.StatusInternalServerError, "Throttle error", err.Error())
+		return
+	}
+
+	if a.notifier != nil {
+		a.notifier.Notify(notify.Event{
+			Type: notify.EventThrottleEngaged,
+			Time: time.Now(),
+			Details: map[string]interface{}{
+				"multiplier":       *req.Multiplier,
+				"duration_seconds": req.DurationSeconds,
+			},
+		})
+	}
+
+	a.GetThrottle(c)
+}
+
+func (a *AdminHandler) GetThrottle(c *gin.Context) {
+	if !a.throttleEnabled(c) {
+		return
+	}
+
+	state, err := a.throttle.Get(c.Request.Context())
+	if err != nil {
+		middleware.RespondError(c, http.StatusInternalServerError, "Throttle error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+func (a *AdminHandler) ClearThrottle(c *gin.Context) {
+	if !a.throttleEnabled(c) {
+		return
+	}
+
+	if err := a.throttle.Clear(c.Request.Context()); err != nil {
+		middleware.RespondError(c, http.StatusInternalServerError, "Throttle error", err.Error())
+		return
+	}
+
+	a.GetThrottle(c)
+}
+
+func (a *AdminHandler) throttleEnabled(c *gin.Context) bool {
+	if a.throttle == nil {
+		middleware.RespondError(c, http.StatusNotFound, "Throttle unavailable", "no throttle is configured")
+		return false
+	}
+	return true
+}
+
+type penalizeRequest struct {
+	Key             string `json:"key"`
+	Namespace       string `json:"namespace"`
+	Policy          string `json:"policy"`
+	DurationSeconds int    `json:"duration_seconds"`
+	Debt            int64  `json:"debt"`
+	Reason          string `json:"reason"`
+}
+
+// Penalize punishes a key beyond its natural window. duration_seconds blocks
+// it outright under every policy; debt charges it that many extra requests
+// under the named policy, to be worked off as the limit refills.
+func (a *AdminHandler) Penalize(c *gin.Context) {
+	if !a.penaltiesEnabled(c) {
+		return
+	}
+
+	var req penalizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if req.Key == "" {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "field 'key' is required")
+		return
+	}
+	if req.DurationSeconds < 0 || req.Debt < 0 {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "duration_seconds and debt must not be negative")
+		return
+	}
+	if req.DurationSeconds == 0 && req.Debt == 0 {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "one of duration_seconds or debt is required")
+		return
+	}
+	if req.Debt > ratelimit.MaxDebt {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", fmt.Sprintf("debt must be at most %d", ratelimit.MaxDebt))
+		return
+	}
+
+	ctx := ratelimit.WithNamespace(c.Request.Context(), req.Namespace)
+
+	if req.Debt > 0 {
+		name := req.Policy
+		if name == "" {
+			name = ratelimit.DefaultPolicyName
+		}
+		policy, exists := a.policies.Get(name)
+		if !exists {
+			middleware.RespondError(c, http.StatusNotFound, "Policy not found", "no policy named "+name)
+			return
+		}
+
+		if err := policy.AddDebt(ctx, req.Key, req.Debt, time.Now()); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ratelimit.ErrDebtNotSupported) {
+				status = http.StatusNotImplemented
+			}
+			middleware.RespondError(c, status, "Penalty error", err.Error())
+			return
+		}
+	}
+
+	if req.DurationSeconds > 0 {
+		duration := time.Duration(req.DurationSeconds) * time.Second
+		if err := a.penalties.Block(ctx, req.Key, duration, req.Reason); err != nil {
+			middleware.RespondError(c, http.StatusInternalServerError, "Penalty error", err.Error())
+			return
+		}
+	}
+
+	state, err := a.penalties.Get(ctx, req.Key)
+	if err != nil {
+		middleware.RespondError(c, http.StatusInternalServerError, "Penalty error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"penalty": state,
+		"debt":    req.Debt,
+	})
+}
+
+// GetPenalty reports whether ?key (in ?namespace) is currently blocked.
+func (a *AdminHandler) GetPenalty(c *gin.Context) {
+	if !a.penaltiesEnabled(c) {
+		return
+	}
+
+	key := c.Query("key")
+	if key == "" {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "query parameter 'key' is required")
+		return
+	}
+
+	ctx := ratelimit.WithNamespace(c.Request.Context(), c.Query("namespace"))
+	state, err := a.penalties.Get(ctx, key)
+	if err != nil {
+		middleware.RespondError(c, http.StatusInternalServerError, "Penalty error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+// ClearPenalty lifts a block early. Outstanding debt is left to be worked off.
+func (a *AdminHandler) ClearPenalty(c *gin.Context) {
+	if !a.penaltiesEnabled(c) {
+		return
+	}
+
+	key := c.Query("key")
+	if key == "" {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "query parameter 'key' is required")
+		return
+	}
+
+	ctx := ratelimit.WithNamespace(c.Request.Context(), c.Query("namespace"))
+	if err := a.penalties.Clear(ctx, key); err != nil {
+		middleware.RespondError(c, http.StatusInternalServerError, "Penalty error", err.Error())
+		return
+	}
+
+	a.GetPenalty(c)
+}
+
+type annotateKeyRequest struct {
+	Key              string `json:"key"`
+	Namespace        string `json:"namespace"`
+	Text             string `json:"text"`
+	Author           string `json:"author"`
+	ExpiresInSeconds int    `json:"expires_in_seconds"`
+}
+
+// AnnotateKey leaves a note on a key for support, e.g. why its limit was
+// raised and until when, and responds with the key's inspection. The author
+// defaults to the authenticated caller.
+func (a *AdminHandler) AnnotateKey(c *gin.Context) {
+	if !a.notesEnabled(c) {
+		return
+	}
+
+	var req annotateKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if req.Key == "" || req.Text == "" {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "fields 'key' and 'text' are required")
+		return
+	}
+	if req.ExpiresInSeconds < 0 {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "expires_in_seconds must not be negative")
+		return
+	}
+
+	if principal, ok := middleware.GetAdminPrincipal(c); ok && req.Author == "" {
+		req.Author = principal.Name
+	}
+
+	ctx := ratelimit.WithNamespace(c.Request.Context(), req.Namespace)
+	note := ratelimit.KeyNote{Text: req.Text, Author: req.Author}
+	if err := a.notes.Set(ctx, req.Key, note, time.Duration(req.ExpiresInSeconds)*time.Second); err != nil {
+		middleware.RespondError(c, http.StatusInternalServerError, "Note error", err.Error())
+		return
+	}
+
+	a.respondInspection(c, ctx, req.Key, req.Namespace)
+}
+
+// ClearKeyNote removes the note on ?key (in ?namespace) and responds with
+// the key's inspection. Its penalty, if any, stays.
+func (a *AdminHandler) ClearKeyNote(c *gin.Context) {
+	if !a.notesEnabled(c) {
+		return
+	}
+
+	key := c.Query("key")
+	if key == "" {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "query parameter 'key' is required")
+		return
+	}
+
+	ctx := ratelimit.WithNamespace(c.Request.Context(), c.Query("namespace"))
+	if err := a.notes.Clear(ctx, key); err != nil {
+		middleware.RespondError(c, http.StatusInternalServerError, "Note error", err.Error())
+		return
+	}
+
+	a.respondInspection(c, ctx, key, c.Query("namespace"))
+}
+
+// keyInspection is what support sees of a key: the note left on it, its
+// penalty and its usage under each policy that can report one.
+type keyInspection struct {
+	Key       string                                 `json:"key"`
+	Namespace string                                 `json:"namespace,omitempty"`
+	Note      *ratelimit.KeyNote                     `json:"note,omitempty"`
+	Penalty   *ratelimit.PenaltyState                `json:"penalty,omitempty"`
+	Usage     map[string]ratelimit.RateLimitResponse `json:"usage"`
+}
+
+// InspectKey reports on ?key (in ?namespace) without consuming any of its
+// limit.
+func (a *AdminHandler) InspectKey(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "query parameter 'key' is required")
+		return
+	}
+
+	ctx := ratelimit.WithNamespace(c.Request.Context(), c.Query("namespace"))
+	a.respondInspection(c, ctx, key, c.Query("namespace"))
+}
+
+func (a *AdminHandler) respondInspection(c *gin.Context, ctx context.Context, key string, namespace string) {
+	inspection := keyInspection{
+		Key:       key,
+		Namespace: namespace,
+		Usage:     make(map[string]ratelimit.RateLimitResponse),
+	}
+
+	var err error
+	if a.notes != nil {
+		if inspection.Note, err = a.notes.Get(ctx, key); err != nil {
+			middleware.RespondError(c, http.StatusInternalServerError, "Inspection error", err.Error())
+			return
+		}
+	}
+	if a.penalties != nil {
+		state, err := a.penalties.Get(ctx, key)
+		if err != nil {
+			middleware.RespondError(c, http.StatusInternalServerError, "Inspection error", err.Error())
+			return
+		}
+		inspection.Penalty = &state
+	}
+
+	now := time.Now()
+	for _, policy := range a.policies.List() {
+		response, err := policy.Peek(ctx, key, now)
+		if errors.Is(err, ratelimit.ErrPeekNotSupported) {
+			continue
+		}
+		if err != nil {
+			middleware.RespondError(c, http.StatusInternalServerError, "Inspection error", fmt.Sprintf("policy %s: %v", policy.Name(), err))
+			return
+		}
+		inspection.Usage[policy.Name()] = response
+	}
+
+	c.JSON(http.StatusOK, inspection)
+}
+
+// ListBans returns the keys currently banned by escalation.
+func (a *AdminHandler) ListBans(c *gin.Context) {
+	if !a.penaltiesEnabled(c) {
+		return
+	}
+
+	bans, err := a.penalties.Bans(c.Request.Context(), time.Now())
+	if err != nil {
+		middleware.RespondError(c, http.StatusInternalServerError, "Penalty error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(bans),
+		"bans":  bans,
+	})
+}
+
+// Stats returns the current strategy and the total allowed and denied
+// decisions since start. Rates are left to the caller to derive by polling.
+func (a *AdminHandler) Stats(c *gin.Context) {
+	decisions, err := metrics.DecisionTotals(a.gatherer)
+	if err != nil {
+		middleware.RespondError(c, http.StatusInternalServerError, "Metrics error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"strategy":  a.strategy.Load(),
+		"decisions": decisions,
+		"time":      time.Now().UTC(),
+	})
+}
+
+// ResetKey clears the rate limit state of the key in the path under
+// ?policy (default "default") and ?namespace. The key is the rest of the
+// path, so it may contain "/". With ?prefix=true it clears every key
+// starting with it instead, e.g. all of a customer's API keys.
+func (a *AdminHandler) ResetKey(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if key == "" {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "key is required")
+		return
+	}
+	bulk := c.Query("prefix") == "true"
+
+	name := c.DefaultQuery("policy", ratelimit.DefaultPolicyName)
+	policy, exists := a.policies.Get(name)
+	if !exists {
+		middleware.RespondError(c, http.StatusNotFound, "Policy not found", "no policy named "+name)
+		return
+	}
+
+	ctx := ratelimit.WithNamespace(c.Request.Context(), c.Query("namespace"))
+	if !bulk {
+		if err := policy.Reset(ctx, key); err != nil {
+			middleware.RespondError(c, http.StatusInternalServerError, "Reset error", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"key":    key,
+			"policy": name,
+			"reset":  true,
+		})
+		return
+	}
+
+	deleted, err := policy.ResetPrefix(ctx, key)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ratelimit.ErrResetPrefixNotSupported):
+			status = http.StatusNotImplemented
+		case errors.Is(err, ratelimit.ErrNamespacePrefix):
+			status = http.StatusBadRequest
+		}
+		middleware.RespondError(c, status, "Reset error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"prefix":  key,
+		"policy":  name,
+		"reset":   true,
+		"deleted": deleted,
+	})
+}
+
+// TopKeys returns the ?limit keys with the most requests and the most denials
+// over the analytics window.
+func (a *AdminHandler) TopKeys(c *gin.Context) {
+	if a.topKeys == nil {
+		middleware.RespondError(c, http.StatusNotFound, "Top keys disabled", "enable analytics.top_keys in the configuration to track keys")
+		return
+	}
+
+	limit := int64(10)
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		limit, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || limit <= 0 || limit > 1000 {
+			middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "limit must be between 1 and 1000")
+			return
+		}
+	}
+
+	report, err := a.topKeys.Top(c.Request.Context(), time.Now(), limit)
+	if err != nil {
+		middleware.RespondError(c, http.StatusInternalServerError, "Analytics error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// KeyUsage reports the keys under each strategy's prefix, or only ?prefix,
+// with their sampled memory use. ?idle_seconds also counts the keys unused
+// for that long.
+func (a *AdminHandler) KeyUsage(c *gin.Context) {
+	a.keyUsageReport(c, false)
+}
+
+// PurgeIdleKeys deletes the keys unused for ?idle_seconds under each
+// strategy's prefix, or only ?prefix, and reports what was left.
+func (a *AdminHandler) PurgeIdleKeys(c *gin.Context) {
+	a.keyUsageReport(c, true)
+}
+
+func (a *AdminHandler) keyUsageReport(c *gin.Context, purge bool) {
+	if a.keyUsage == nil {
+		middleware.RespondError(c, http.StatusNotFound, "Key usage unavailable", "no key usage reporter is configured")
+		return
+	}
+
+	options := ratelimit.KeyUsageOptions{Name: c.Query("prefix"), Purge: purge}
+	if raw := c.Query("idle_seconds"); raw != "" || purge {
+		idleSeconds, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || idleSeconds <= 0 {
+			middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "idle_seconds must be a positive number of seconds")
+			return
+		}
+		options.IdleThreshold = time.Duration(idleSeconds) * time.Second
+	}
+
+	report, err := a.keyUsage.Report(c.Request.Context(), options)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ratelimit.ErrUnknownKeyPrefix) {
+			status = http.StatusNotFound
+		}
+		middleware.RespondError(c, status, "Key usage error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ExportState returns the state of every key under each strategy's prefix,
+// or only ?prefix, in the form ImportState takes.
+func (a *AdminHandler) ExportState(c *gin.Context) {
+	if a.state == nil {
+		middleware.RespondError(c, http.StatusNotFound, "State transfer unavailable", "no state transfer is configured")
+		return
+	}
+
+	export, err := a.state.Export(c.Request.Context(), c.Query("prefix"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ratelimit.ErrUnknownKeyPrefix) {
+			status = http.StatusNotFound
+		}
+		middleware.RespondError(c, status, "State export error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, export)
+}
+
+type importStateRequest struct {
+	Keys []ratelimit.KeyState `json:"keys" binding:"required"`
+}
+
+// ImportState writes the keys of an export. Keys that already exist are
+// kept unless ?overwrite=true.
+func (a *AdminHandler) ImportState(c *gin.Context) {
+	if a.state == nil {
+		middleware.RespondError(c, http.StatusNotFound, "State transfer unavailable", "no state transfer is configured")
+		return
+	}
+
+	var options ratelimit.ImportOptions
+	if raw := c.Query("overwrite"); raw != "" {
+		overwrite, err := strconv.ParseBool(raw)
+		if err != nil {
+			middleware.RespondError(c, http.StatusBadRequest, "Invalid request", "overwrite must be true or false")
+			return
+		}
+		options.Overwrite = overwrite
+	}
+
+	var req importStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	result, err := a.state.Import(c.Request.Context(), req.Keys, options)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ratelimit.ErrInvalidKeyState) {
+			status = http.StatusBadRequest
+		}
+		middleware.RespondError(c, status, "State import error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+type migrateKeysRequest struct {
+	Prefix    string `json:"prefix"`
+	From      string `json:"from" binding:"required"`
+	To        string `json:"to" binding:"required"`
+	Overwrite bool   `json:"overwrite"`
+	DryRun    bool   `json:"dry_run"`
+}
+
+// MigrateKeys starts renaming the keys under one prefix to another,
+// relative to the key prefix of the strategy named by prefix when given. It
+// answers with the job to poll at /admin/keys/migrate/:id.
+func (a *AdminHandler) MigrateKeys(c *gin.Context) {
+	if a.migration == nil {
+		middleware.RespondError(c, http.StatusNotFound, "Key migration unavailable", "no key migration is configured")
+		return
+	}
+
+	var req migrateKeysRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	job, err := a.migration.Start(a.migrationCtx, ratelimit.KeyMigrationOptions{
+		Name:      req.Prefix,
+		From:      req.From,
+		To:        req.To,
+		Overwrite: req.Overwrite,
+		DryRun:    req.DryRun,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ratelimit.ErrUnknownKeyPrefix):
+			status = http.StatusNotFound
+		case errors.Is(err, ratelimit.ErrInvalidKeyMigration):
+			status = http.StatusBadRequest
+		case errors.Is(err, ratelimit.ErrKeyMigrationRunning):
+			status = http.StatusConflict
+		}
+		middleware.RespondError(c, status, "Key migration error", err.Error())
+		return
+	}
+
+	c.Header("Location", "/admin/keys/migrate/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// KeyMigrationStatus reports the progress of a migration started by
+// MigrateKeys.
+func (a *AdminHandler) KeyMigrationStatus(c *gin.Context) {
+	if a.migration == nil {
+		middleware.RespondError(c, http.StatusNotFound, "Key migration unavailable", "no key migration is configured")
+		return
+	}
+
+	job, ok := a.migration.Job(c.Param("id"))
+	if !ok {
+		middleware.RespondError(c, http.StatusNotFound, "Key migration not found", "no recent key migration has id "+c.Param("id"))
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+type switchStrategyRequest struct {
+	Strategy string `json:"strategy" binding:"required"`
+}
+
+// SwitchStrategy makes the default policy use another configured strategy
+// until the next restart. Existing counters of the old strategy are left in
+// Redis, so switching back resumes them.
+func (a *AdminHandler) SwitchStrategy(c *gin.Context) {
+	if a.switchStrategy == nil {
+		middleware.RespondError(c, http.StatusNotImplemented, "Strategy switch unavailable", ratelimit.ErrStrategySwitchNotSupported.Error())
+		return
+	}
+
+	var req switchStrategyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if err := a.switchStrategy(req.Strategy); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ratelimit.ErrStrategySwitchNotSupported) || errors.Is(err, ratelimit.ErrCapabilityLost) {
+			status = http.StatusConflict
+		}
+		middleware.RespondError(c, status, "Strategy switch failed", err.Error())
+		return
+	}
+	a.strategy.Store(req.Strategy)
+
+	c.JSON(http.StatusOK, gin.H{
+		"strategy": req.Strategy,
+	})
+}
+
+// TailDecisions streams decisions as server-sent events, optionally only
+// those with ?decision=allowed, denied or error. Keys are hashed as in the
+// decision stream.
+func (a *AdminHandler) TailDecisions(c *gin.Context) {
+	if a.decisionTail == nil {
+		middleware.RespondError(c, http.StatusNotFound, "Decision tail unavailable", "no decision tail is configured")
+		return
+	}
+	filter := c.Query("decision")
+
+	decisions, unsubscribe := a.decisionTail.Subscribe(0)
+	defer unsubscribe()
+
+	// The stream outlives the server's write timeout.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	done := a.tailCtx
+	if done == nil {
+		done = context.Background()
+	}
+	heartbeat := time.NewTicker(tailHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-done.Done():
+			return false
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case decision := <-decisions:
+			if filter == "" || decision.Decision == filter {
+				c.SSEvent("decision", decision)
+			}
+			return true
+		}
+	})
+}
+
+func (a *AdminHandler) penaltiesEnabled(c *gin.Context) bool {
+	if a.penalties == nil {
+		middleware.RespondError(c, http.StatusNotFound, "Penalties unavailable", "no penalty box is configured")
+		return false
+	}
+	return true
+}
+
+func (a *AdminHandler) notesEnabled(c *gin.Context) bool {
+	if a.notes == nil {
+		middleware.RespondError(c, http.StatusNotFound, "Notes unavailable", "no key notes store is configured")
+		return false
+	}
+	return true
+}
+
+func parseOptionalTime(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func policyResponse(policy *ratelimit.Policy) gin.H {
+	return gin.H{
+		"name":    policy.Name(),
+		"enabled": policy.Enabled(),
+	}
+}
@@ -0,0 +1,720 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/events"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAdminRouter() (*gin.Engine, *ratelimit.Policy) {
+	gin.SetMode(gin.TestMode)
+
+	policy := ratelimit.NewPolicy("default", &MockRateLimiter{}, nil)
+	registry := ratelimit.NewPolicyRegistry()
+	registry.Register(policy)
+
+	handler := NewAdminHandler(registry)
+	router := gin.New()
+	router.GET("/admin/policies", handler.ListPolicies)
+	router.PATCH("/admin/policies/:name", handler.UpdatePolicy)
+
+	return router, policy
+}
+
+func TestAdminHandler_UpdatePolicy(t *testing.T) {
+	router, policy := setupAdminRouter()
+
+	req := httptest.NewRequest("PATCH", "/admin/policies/default", strings.NewReader(`{"enabled": false}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"enabled":false`)
+	assert.False(t, policy.Enabled())
+}
+
+func TestAdminHandler_UpdatePolicy_NotFound(t *testing.T) {
+	router, _ := setupAdminRouter()
+
+	req := httptest.NewRequest("PATCH", "/admin/policies/missing", strings.NewReader(`{"enabled": false}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdminHandler_UpdatePolicy_MissingField(t *testing.T) {
+	router, policy := setupAdminRouter()
+
+	req := httptest.NewRequest("PATCH", "/admin/policies/default", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, policy.Enabled())
+}
+
+func TestAdminHandler_ListPolicies(t *testing.T) {
+	router, _ := setupAdminRouter()
+
+	req := httptest.NewRequest("GET", "/admin/policies", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"default"`)
+	assert.Contains(t, w.Body.String(), `"enabled":true`)
+}
+
+func setupThrottleRouter(t *testing.T) (*gin.Engine, *miniredis.Miniredis) {
+	gin.SetMode(gin.TestMode)
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	handler := NewAdminHandler(ratelimit.NewPolicyRegistry()).WithThrottle(ratelimit.NewThrottle(client))
+	router := gin.New()
+	router.GET("/admin/throttle", handler.GetThrottle)
+	router.POST("/admin/throttle", handler.SetThrottle)
+	router.DELETE("/admin/throttle", handler.ClearThrottle)
+
+	return router, server
+}
+
+func TestAdminHandler_SetThrottle(t *testing.T) {
+	router, server := setupThrottleRouter(t)
+
+	req := httptest.NewRequest("POST", "/admin/throttle", strings.NewReader(`{"multiplier": 0.2, "duration_seconds": 600}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"active":true`)
+	assert.Contains(t, w.Body.String(), `"multiplier":0.2`)
+	assert.Contains(t, w.Body.String(), `"expires_at"`)
+
+	value, err := server.Get(ratelimit.ThrottleKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.2", value)
+	assert.Equal(t, 600*time.Second, server.TTL(ratelimit.ThrottleKey))
+
+	req = httptest.NewRequest("DELETE", "/admin/throttle", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"active":false`)
+	assert.False(t, server.Exists(ratelimit.ThrottleKey))
+}
+
+func TestAdminHandler_SetThrottle_InvalidMultiplier(t *testing.T) {
+	router, server := setupThrottleRouter(t)
+
+	for _, body := range []string{`{}`, `{"multiplier": 0}`, `{"multiplier": 1.5}`, `{"multiplier": 0.5, "duration_seconds": -1}`} {
+		req := httptest.NewRequest("POST", "/admin/throttle", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+	assert.False(t, server.Exists(ratelimit.ThrottleKey))
+}
+
+func setupPenaltyRouter(t *testing.T) (*gin.Engine, *miniredis.Miniredis) {
+	gin.SetMode(gin.TestMode)
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	registry := ratelimit.NewPolicyRegistry()
+	registry.Register(ratelimit.NewPolicy("default", &MockRateLimiter{}, nil))
+
+	handler := NewAdminHandler(registry).WithPenalties(ratelimit.NewPenaltyBox(client))
+	router := gin.New()
+	router.GET("/admin/penalize", handler.GetPenalty)
+	router.POST("/admin/penalize", handler.Penalize)
+	router.DELETE("/admin/penalize", handler.ClearPenalty)
+	router.GET("/admin/bans", handler.ListBans)
+
+	return router, server
+}
+
+func TestAdminHandler_Penalize(t *testing.T) {
+	router, server := setupPenaltyRouter(t)
+	redisKey := ratelimit.PenaltyKeyPrefix + "ns:tenant:client"
+
+	req := httptest.NewRequest("POST", "/admin/penalize", strings.NewReader(`{"key": "client", "namespace": "tenant", "duration_seconds": 300, "reason": "scraping"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"active":true`)
+	assert.Contains(t, w.Body.String(), `"reason":"scraping"`)
+	assert.Equal(t, 300*time.Second, server.TTL(redisKey))
+
+	req = httptest.NewRequest("GET", "/admin/penalize?key=client&namespace=tenant", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"active":true`)
+
+	req = httptest.NewRequest("DELETE", "/admin/penalize?key=client&namespace=tenant", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"active":false`)
+	assert.False(t, server.Exists(redisKey))
+}
+
+func TestAdminHandler_Penalize_Invalid(t *testing.T) {
+	router, server := setupPenaltyRouter(t)
+
+	for _, body := range []string{`{}`, `{"key": "client"}`, `{"key": "client", "duration_seconds": -1}`, `{"key": "client", "debt": -5}`, `{"key": "client", "debt": 1000001}`} {
+		req := httptest.NewRequest("POST", "/admin/penalize", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+	assert.Empty(t, server.Keys())
+
+	req := httptest.NewRequest("POST", "/admin/penalize", strings.NewReader(`{"key": "client", "debt": 5}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotImplemented, w.Code, "the mock limiter cannot carry debt")
+
+	req = httptest.NewRequest("POST", "/admin/penalize", strings.NewReader(`{"key": "client", "debt": 5, "policy": "missing"}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// setupKeyNotesRouter serves notes and inspections with the given penalty
+// box, which may be nil, and a peeking "api" policy next to "default".
+func setupKeyNotesRouter(t *testing.T, penalties bool) (*gin.Engine, *miniredis.Miniredis) {
+	gin.SetMode(gin.TestMode)
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	peeking := &MockPeekingRateLimiter{}
+	peeking.On("Peek", mock.Anything, "ns:tenant:client", mock.Anything).Return(ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 7}, nil)
+	registry := ratelimit.NewPolicyRegistry()
+	registry.Register(ratelimit.NewPolicy("default", &MockRateLimiter{}, nil))
+	registry.Register(ratelimit.NewPolicy("api", peeking, nil))
+
+	handler := NewAdminHandler(registry).WithKeyNotes(ratelimit.NewKeyNotes(client))
+	if penalties {
+		handler.WithPenalties(ratelimit.NewPenaltyBox(client))
+	}
+	router := gin.New()
+	router.PUT("/admin/notes", handler.AnnotateKey)
+	router.DELETE("/admin/notes", handler.ClearKeyNote)
+	router.GET("/admin/keys/inspect", handler.InspectKey)
+	router.POST("/admin/penalize", handler.Penalize)
+	router.DELETE("/admin/penalize", handler.ClearPenalty)
+
+	return router, server
+}
+
+func TestAdminHandler_KeyNotes(t *testing.T) {
+	router, server := setupKeyNotesRouter(t, false)
+	redisKey := ratelimit.NoteKeyPrefix + "ns:tenant:client"
+
+	req := httptest.NewRequest("PUT", "/admin/notes", strings.NewReader(`{"key": "client", "namespace": "tenant", "text": "raised limit until Friday per ticket 123", "author": "alice", "expires_in_seconds": 86400}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code, "notes don't need a penalty box")
+	assert.Contains(t, w.Body.String(), `"text":"raised limit until Friday per ticket 123"`)
+	assert.Contains(t, w.Body.String(), `"author":"alice"`)
+	assert.Equal(t, 24*time.Hour, server.TTL(redisKey))
+
+	req = httptest.NewRequest("GET", "/admin/keys/inspect?key=client&namespace=tenant", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"note":{"text":"raised limit until Friday per ticket 123"`)
+	assert.Contains(t, w.Body.String(), `"api":{"allowed":true,"limit":10,"remaining":7`)
+	assert.NotContains(t, w.Body.String(), `"default"`, "policies that can't peek are left out")
+	assert.NotContains(t, w.Body.String(), `"penalty"`)
+
+	req = httptest.NewRequest("DELETE", "/admin/notes?key=client&namespace=tenant", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"note"`)
+	assert.False(t, server.Exists(redisKey))
+
+	for _, body := range []string{`{"key": "client"}`, `{"text": "note"}`, `{"key": "client", "text": "note", "expires_in_seconds": -1}`} {
+		req := httptest.NewRequest("PUT", "/admin/notes", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/keys/inspect", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAdminHandler_InspectKeyWithPenalty(t *testing.T) {
+	router, _ := setupKeyNotesRouter(t, true)
+
+	req := httptest.NewRequest("PUT", "/admin/notes", strings.NewReader(`{"key": "client", "namespace": "tenant", "text": "trial account"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("POST", "/admin/penalize", strings.NewReader(`{"key": "client", "namespace": "tenant", "duration_seconds": 300, "reason": "scraping"}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("DELETE", "/admin/penalize?key=client&namespace=tenant", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("GET", "/admin/keys/inspect?key=client&namespace=tenant", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"penalty":{"active":false`)
+	assert.Contains(t, w.Body.String(), `"text":"trial account"`, "lifting the block keeps the note")
+}
+
+func TestAdminHandler_ListBans(t *testing.T) {
+	router, server := setupPenaltyRouter(t)
+	expiresAt := time.Now().Add(time.Hour).UnixMilli()
+	_, err := server.ZAdd(ratelimit.BanListKey, float64(expiresAt), "client")
+	assert.NoError(t, err)
+	_, err = server.ZAdd(ratelimit.BanListKey, float64(time.Now().Add(-time.Hour).UnixMilli()), "expired")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/admin/bans", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"count":1`)
+	assert.Contains(t, w.Body.String(), `"key":"client"`)
+	assert.NotContains(t, w.Body.String(), "expired")
+}
+
+func TestAdminHandler_TopKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	topKeys, err := ratelimit.NewTopKeys(client, ratelimit.TopKeysConfig{})
+	assert.NoError(t, err)
+	bucket := time.Now().Truncate(ratelimit.DefaultTopKeysResolution).Unix()
+	_, err = server.ZAdd(ratelimit.TopKeysPrefix+"traffic:"+strconv.FormatInt(bucket, 10), 7, "client")
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/admin/analytics/top-keys", NewAdminHandler(ratelimit.NewPolicyRegistry()).WithTopKeys(topKeys).TopKeys)
+	router.GET("/disabled", NewAdminHandler(ratelimit.NewPolicyRegistry()).TopKeys)
+
+	req := httptest.NewRequest("GET", "/admin/analytics/top-keys?limit=5", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"highest_traffic":[{"key":"client","count":7}]`)
+	assert.Contains(t, w.Body.String(), `"most_throttled":[]`)
+
+	req = httptest.NewRequest("GET", "/admin/analytics/top-keys?limit=0", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest("GET", "/disabled", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdminHandler_KeyUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	start := time.Unix(10000, 0)
+	server.SetTime(start)
+	assert.NoError(t, server.Set("rl:tb::stale", "1"))
+	server.SetTime(start.Add(time.Hour))
+	assert.NoError(t, server.Set("rl:tb::fresh", "1"))
+
+	handler := NewAdminHandler(ratelimit.NewPolicyRegistry()).
+		WithKeyUsage(ratelimit.NewKeyUsage(client, map[string]string{"token_bucket": "rl:tb:"}, 100, 10))
+	router := gin.New()
+	router.GET("/admin/keys/usage", handler.KeyUsage)
+	router.POST("/admin/keys/purge", handler.PurgeIdleKeys)
+
+	req := httptest.NewRequest("GET", "/admin/keys/usage?idle_seconds=60", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total_keys":2`)
+	assert.Contains(t, w.Body.String(), `"idle_keys":1`)
+
+	req = httptest.NewRequest("POST", "/admin/keys/purge", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "purging needs idle_seconds")
+
+	req = httptest.NewRequest("POST", "/admin/keys/purge?idle_seconds=60&prefix=token_bucket", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"purged_keys":1`)
+	assert.False(t, server.Exists("rl:tb::stale"))
+
+	req = httptest.NewRequest("GET", "/admin/keys/usage?prefix=quota", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdminHandler_StateExportImport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	prefixes := map[string]string{"token_bucket": "rl:tb:"}
+
+	newRouter := func(t *testing.T) (*gin.Engine, *miniredis.Miniredis) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+
+		handler := NewAdminHandler(ratelimit.NewPolicyRegistry()).
+			WithStateTransfer(ratelimit.NewStateTransfer(client, prefixes, 100))
+		router := gin.New()
+		router.GET("/admin/state/export", handler.ExportState)
+		router.POST("/admin/state/import", handler.ImportState)
+		return router, server
+	}
+
+	sourceRouter, sourceServer := newRouter(t)
+	sourceServer.HSet("rl:tb::alice", "tokens", "3")
+	req := httptest.NewRequest("GET", "/admin/state/export", nil)
+	w := httptest.NewRecorder()
+	sourceRouter.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	export := w.Body.String()
+	assert.Contains(t, export, `"key":"rl:tb::alice"`)
+
+	targetRouter, targetServer := newRouter(t)
+	req = httptest.NewRequest("POST", "/admin/state/import", strings.NewReader(export))
+	w = httptest.NewRecorder()
+	targetRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"imported":1,"existing":0}`, w.Body.String())
+	assert.Equal(t, "3", targetServer.HGet("rl:tb::alice", "tokens"))
+
+	req = httptest.NewRequest("POST", "/admin/state/import", strings.NewReader(`{"keys":[{"key":"session:alice","type":"string","string":"1"}]}`))
+	w = httptest.NewRecorder()
+	targetRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.False(t, targetServer.Exists("session:alice"))
+
+	req = httptest.NewRequest("GET", "/admin/state/export?prefix=quota", nil)
+	w = httptest.NewRecorder()
+	sourceRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdminHandler_MigrateKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	prefixes := map[string]string{"token_bucket": "rl:tb:"}
+
+	handler := NewAdminHandler(ratelimit.NewPolicyRegistry()).
+		WithKeyMigration(context.Background(), ratelimit.NewKeyMigration(client, prefixes, 100, 1e6))
+	router := gin.New()
+	router.POST("/admin/keys/migrate", handler.MigrateKeys)
+	router.GET("/admin/keys/migrate/:id", handler.KeyMigrationStatus)
+
+	server.HSet("old:alice", "tokens", "3")
+	req := httptest.NewRequest("POST", "/admin/keys/migrate", strings.NewReader(`{"from":"old:","to":"rl:tb::"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var job ratelimit.KeyMigrationJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, "/admin/keys/migrate/"+job.ID, w.Header().Get("Location"))
+
+	assert.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/keys/migrate/"+job.ID, nil))
+		return w.Code == http.StatusOK && json.Unmarshal(w.Body.Bytes(), &job) == nil &&
+			job.State == ratelimit.KeyMigrationDone
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), job.Result.Renamed)
+	assert.Equal(t, "3", server.HGet("rl:tb::alice", "tokens"))
+
+	req = httptest.NewRequest("POST", "/admin/keys/migrate", strings.NewReader(`{"prefix":"token_bucket","from":"a","to":"a:b"}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest("POST", "/admin/keys/migrate", strings.NewReader(`{"prefix":"quota","from":"a","to":"b"}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/keys/migrate/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdminHandler_Stats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registry := prometheus.NewRegistry()
+	decisions := prometheus.NewCounterVec(prometheus.CounterOpts{Name: metrics.DecisionsMetricName}, []string{"strategy", "decision"})
+	registry.MustRegister(decisions)
+	decisions.WithLabelValues("token_bucket", "allowed").Add(5)
+	decisions.WithLabelValues("quota", "allowed").Add(2)
+	decisions.WithLabelValues("token_bucket", "denied").Add(3)
+
+	handler := NewAdminHandler(ratelimit.NewPolicyRegistry()).WithStats("token_bucket", registry)
+	router := gin.New()
+	router.GET("/admin/stats", handler.Stats)
+
+	req := httptest.NewRequest("GET", "/admin/stats", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"strategy":"token_bucket"`)
+	assert.Contains(t, w.Body.String(), `"decisions":{"allowed":7,"denied":3}`)
+}
+
+func TestAdminHandler_ResetKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := &MockRateLimiter{}
+	limiter.On("Reset", mock.Anything, "ns:tenant:client").Return(nil)
+	registry := ratelimit.NewPolicyRegistry()
+	registry.Register(ratelimit.NewPolicy("default", limiter, nil))
+
+	router := gin.New()
+	router.DELETE("/admin/keys/*key", NewAdminHandler(registry).ResetKey)
+
+	req := httptest.NewRequest("DELETE", "/admin/keys/client?namespace=tenant", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"reset":true`)
+	limiter.AssertExpectations(t)
+
+	req = httptest.NewRequest("DELETE", "/admin/keys/client?policy=missing", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req = httptest.NewRequest("DELETE", "/admin/keys/client?prefix=true", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotImplemented, w.Code, "the mock limiter cannot reset prefixes")
+}
+
+func TestAdminHandler_ResetKey_Slash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := &MockRateLimiter{}
+	limiter.On("Reset", mock.Anything, "tenant/42/api").Return(nil).Twice()
+	registry := ratelimit.NewPolicyRegistry()
+	registry.Register(ratelimit.NewPolicy("default", limiter, nil))
+
+	router := gin.New()
+	router.DELETE("/admin/keys/*key", NewAdminHandler(registry).ResetKey)
+
+	for _, path := range []string{"/admin/keys/tenant/42/api", "/admin/keys/tenant%2F42%2Fapi"} {
+		req := httptest.NewRequest("DELETE", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Contains(t, w.Body.String(), `"key":"tenant/42/api"`, path)
+	}
+	limiter.AssertExpectations(t)
+
+	req := httptest.NewRequest("DELETE", "/admin/keys/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAdminHandler_ResetKey_Prefix(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	rateLimiter, err := ratelimit.NewSlidingWindowLogRateLimiter(ratelimit.SlidingWindowLogConfig{
+		WindowSize: time.Minute,
+		BucketSize: 1,
+		KeyPrefix:  "swl",
+	}, client)
+	assert.NoError(t, err)
+	registry := ratelimit.NewPolicyRegistry()
+	registry.Register(ratelimit.NewPolicy("default", rateLimiter, nil))
+
+	for _, key := range []string{"swl:customer-42:key-1", "swl:customer-42:key-2", "swl:customer-7:key-1"} {
+		assert.NoError(t, server.Set(key, "1"))
+	}
+
+	router := gin.New()
+	router.DELETE("/admin/keys/*key", NewAdminHandler(registry).ResetKey)
+
+	req := httptest.NewRequest("DELETE", "/admin/keys/customer-42:?prefix=true", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"deleted":2`)
+	assert.Equal(t, []string{"swl:customer-7:key-1"}, server.Keys())
+}
+
+func TestDashboardFS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.StaticFS("/dashboard", DashboardFS())
+
+	for _, path := range []string{"/dashboard/", "/dashboard/app.js", "/dashboard/style.css"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+
+	req := httptest.NewRequest("GET", "/dashboard/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), `<script src="app.js">`)
+}
+
+func TestAdminHandler_SwitchStrategy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var switched []string
+	handler := NewAdminHandler(ratelimit.NewPolicyRegistry()).
+		WithStats("token_bucket", prometheus.NewRegistry()).
+		WithStrategySwitch(func(strategy string) error {
+			switch strategy {
+			case "quota":
+				return ratelimit.ErrStrategySwitchNotSupported
+			case "sliding_window_log":
+				switched = append(switched, strategy)
+				return nil
+			}
+			return errors.New("unknown strategy: " + strategy)
+		})
+	router := gin.New()
+	router.PUT("/admin/strategy", handler.SwitchStrategy)
+	router.GET("/admin/stats", handler.Stats)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/admin/strategy", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, put(`{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put(`{"strategy": "leaky_bucket"}`).Code)
+	assert.Equal(t, http.StatusConflict, put(`{"strategy": "quota"}`).Code)
+	assert.Equal(t, http.StatusOK, put(`{"strategy": "sliding_window_log"}`).Code)
+	assert.Equal(t, []string{"sliding_window_log"}, switched)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/stats", nil))
+	assert.Contains(t, w.Body.String(), `"strategy":"sliding_window_log"`)
+
+	router = gin.New()
+	router.PUT("/admin/strategy", NewAdminHandler(ratelimit.NewPolicyRegistry()).SwitchStrategy)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/strategy", strings.NewReader(`{"strategy": "quota"}`)))
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+func TestAdminHandler_TailDecisions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tail := events.NewTail()
+	ctx, stop := context.WithCancel(context.Background())
+	router := gin.New()
+	router.GET("/admin/decisions/tail", NewAdminHandler(ratelimit.NewPolicyRegistry()).WithDecisionTail(ctx, tail).TailDecisions)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/admin/decisions/tail?decision=denied")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// Emit until the subscription is in place, then stop the stream.
+	go func() {
+		for ctx.Err() == nil {
+			tail.Emit(events.Decision{KeyHash: "allowed-key", Decision: events.DecisionAllowed})
+			tail.Emit(events.Decision{KeyHash: "denied-key", Decision: events.DecisionDenied})
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "event:decision\n", line)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Contains(t, line, `"key_hash":"denied-key"`, "allowed decisions are filtered out")
+
+	stop()
+	_, err = io.ReadAll(reader)
+	assert.NoError(t, err, "the stream ends when the server shuts down")
+}
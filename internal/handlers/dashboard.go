@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// DashboardFS serves the static dashboard, which reads and drives the admin
+// API from the browser.
+func DashboardFS() http.FileSystem {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	return http.FS(files)
+}
@@ -0,0 +1,162 @@
+// Polls the admin API; rates are derived from the decision counters between
+// two polls.
+const pollInterval = 2000;
+let previous = null;
+
+// The admin token is kept for the browser session only.
+const tokenInput = document.getElementById("token");
+tokenInput.value = sessionStorage.getItem("adminToken") || "";
+tokenInput.addEventListener("change", () => {
+  sessionStorage.setItem("adminToken", tokenInput.value);
+  refresh();
+});
+
+async function api(method, path, body) {
+  const headers = body ? { "Content-Type": "application/json" } : {};
+  if (tokenInput.value) {
+    headers.Authorization = "Bearer " + tokenInput.value;
+  }
+  const response = await fetch(path, {
+    method,
+    headers,
+    body: body ? JSON.stringify(body) : undefined,
+  });
+  const data = await response.json().catch(() => ({}));
+  if (!response.ok) {
+    const error = new Error(data.message || data.error || response.statusText);
+    error.status = response.status;
+    throw error;
+  }
+  return data;
+}
+
+function text(id, value) {
+  document.getElementById(id).textContent = value;
+}
+
+function fillTable(id, entries) {
+  const body = document.getElementById(id);
+  body.replaceChildren(...entries.map((entry) => {
+    const row = document.createElement("tr");
+    for (const value of [entry.key, entry.count]) {
+      const cell = document.createElement("td");
+      cell.textContent = value;
+      row.appendChild(cell);
+    }
+    return row;
+  }));
+}
+
+async function refreshStats() {
+  const stats = await api("GET", "/admin/stats");
+  text("strategy", stats.strategy || "-");
+
+  const now = Date.parse(stats.time);
+  if (previous) {
+    const seconds = (now - previous.time) / 1000;
+    if (seconds > 0) {
+      text("allow-rate", ((stats.decisions.allowed - previous.allowed) / seconds).toFixed(1));
+      text("deny-rate", ((stats.decisions.denied - previous.denied) / seconds).toFixed(1));
+    }
+  }
+  previous = { time: now, allowed: stats.decisions.allowed, denied: stats.decisions.denied };
+}
+
+async function refreshPolicies() {
+  const data = await api("GET", "/admin/policies");
+  text("policies", data.policies
+    .map((policy) => policy.name + (policy.enabled ? "" : " (disabled)"))
+    .join(", "));
+}
+
+async function refreshTopKeys() {
+  const note = document.getElementById("top-keys-note");
+  try {
+    const report = await api("GET", "/admin/analytics/top-keys?limit=10");
+    note.hidden = true;
+    fillTable("highest-traffic", report.highest_traffic);
+    fillTable("most-throttled", report.most_throttled);
+  } catch (error) {
+    if (error.status !== 404) {
+      throw error;
+    }
+    note.textContent = "Top keys are off; enable analytics.top_keys to track them.";
+    note.hidden = false;
+  }
+}
+
+async function refresh() {
+  try {
+    await Promise.all([refreshStats(), refreshPolicies(), refreshTopKeys()]);
+    text("status", "updated " + new Date().toLocaleTimeString());
+  } catch (error) {
+    text("status", "error: " + error.message);
+  }
+}
+
+// showNote shows the support note in a key's inspection, if any.
+function showNote(inspection) {
+  const element = document.getElementById("key-note");
+  const note = inspection && inspection.note;
+  element.hidden = !note;
+  if (note) {
+    element.textContent = "Note" + (note.author ? " by " + note.author : "") + ": " + note.text +
+      (note.expires_at ? " (until " + note.expires_at + ")" : "");
+  }
+}
+
+async function runAction(action) {
+  const form = document.getElementById("action-form");
+  const result = document.getElementById("action-result");
+  if (!form.reportValidity()) {
+    return;
+  }
+  const fields = new FormData(form);
+  const target = { key: fields.get("key"), namespace: fields.get("namespace") };
+
+  try {
+    if (action === "reset") {
+      const query = new URLSearchParams({ namespace: target.namespace });
+      if (fields.get("prefix")) {
+        query.set("prefix", "true");
+      }
+      const data = await api("DELETE", "/admin/keys/" + encodeURIComponent(target.key) + "?" + query);
+      result.textContent = data.prefix !== undefined
+        ? "Reset " + data.deleted + " keys starting with " + data.prefix
+        : "Reset " + target.key;
+    } else if (action === "inspect") {
+      const query = new URLSearchParams(target);
+      const data = await api("GET", "/admin/keys/inspect?" + query);
+      const penalty = data.penalty;
+      const usage = Object.entries(data.usage)
+        .map(([policy, status]) => policy + " " + status.remaining + "/" + status.limit)
+        .join(", ");
+      result.textContent = (penalty && penalty.active
+        ? target.key + " is blocked until " + penalty.expires_at + (penalty.reason ? " (" + penalty.reason + ")" : "")
+        : target.key + " is not blocked") + (usage ? "; remaining " + usage : "");
+      showNote(data);
+    } else if (action === "note") {
+      const data = await api("PUT", "/admin/notes", { ...target, text: fields.get("note") });
+      result.textContent = "Saved note on " + target.key;
+      showNote(data);
+    } else {
+      const data = await api("POST", "/admin/penalize", {
+        ...target,
+        duration_seconds: Number(fields.get("duration_seconds")),
+        reason: fields.get("reason"),
+      });
+      result.textContent = "Blocked " + target.key + " until " + data.penalty.expires_at;
+    }
+    result.className = "";
+  } catch (error) {
+    result.textContent = error.message;
+    result.className = "error";
+  }
+}
+
+document.querySelectorAll("[data-action]").forEach((button) => {
+  button.addEventListener("click", () => runAction(button.dataset.action));
+});
+
+refresh();
+setInterval(refresh, pollInterval);
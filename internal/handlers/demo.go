@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/middleware"
 )
 
 type DemoHandler struct{}
@@ -29,7 +30,7 @@ func (d *DemoHandler) UnrestrictedResource(c *gin.Context) {
 }
 
 func (d *DemoHandler) RestrictedResource(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
+	body := gin.H{
 		"message":   "Access granted to restricted resource",
 		"timestamp": time.Now().UTC(),
 		"path":      c.Request.URL.Path,
@@ -40,5 +41,24 @@ func (d *DemoHandler) RestrictedResource(c *gin.Context) {
 			"content":     "This resource is protected by rate limiting",
 			"access_count": "limited by rate limiter",
 		},
+	}
+	if decision, ok := middleware.GetDecision(c); ok && !decision.Bypassed && !decision.Optimistic {
+		body["rate_limit"] = gin.H{
+			"limit":      decision.Limit,
+			"remaining":  decision.Remaining,
+			"reset_time": decision.ResetTime,
+		}
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// GraphQLResource stands in for a GraphQL server behind
+// middleware.GraphQLRateLimit, answering with what the operation cost.
+func (d *DemoHandler) GraphQLResource(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": nil,
+		"extensions": gin.H{
+			"cost": middleware.GetGraphQLCost(c),
+		},
 	})
-}
\ No newline at end of file
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,3 +12,43 @@ func Health(c *gin.Context) {
 		"status": "ok",
 	})
 }
+
+// Readiness counts in-flight requests and reports not-ready once the server
+// starts draining, so load balancers stop sending traffic before shutdown.
+type Readiness struct {
+	draining atomic.Bool
+	inFlight atomic.Int64
+}
+
+func NewReadiness() *Readiness {
+	return &Readiness{}
+}
+
+// Track counts the requests it wraps as in flight.
+func (r *Readiness) Track() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r.inFlight.Add(1)
+		defer r.inFlight.Add(-1)
+		c.Next()
+	}
+}
+
+// Drain marks the server as not ready; requests are still served.
+func (r *Readiness) Drain() {
+	r.draining.Store(true)
+}
+
+func (r *Readiness) InFlight() int64 {
+	return r.inFlight.Load()
+}
+
+func (r *Readiness) Ready(c *gin.Context) {
+	status, code := "ready", http.StatusOK
+	if r.draining.Load() {
+		status, code = "draining", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status":    status,
+		"in_flight": r.InFlight(),
+	})
+}
@@ -1,11 +1,27 @@
 package handlers
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func MetricsHandler() gin.HandlerFunc {
 	h := promhttp.Handler()
 	return gin.WrapH(h)
-}
\ No newline at end of file
+}
+
+// AlertRulesHandler serves Prometheus alerting rules generated from the
+// configured thresholds. YAML is returned unless ?format=json is given.
+func AlertRulesHandler(thresholds metrics.AlertThresholds) gin.HandlerFunc {
+	rules := metrics.GenerateAlertRules(thresholds)
+	return func(c *gin.Context) {
+		if c.Query("format") == "json" {
+			c.JSON(http.StatusOK, rules)
+			return
+		}
+		c.YAML(http.StatusOK, rules)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertRulesHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/alerts", AlertRulesHandler(metrics.AlertThresholds{
+		DenialRatio:       0.5,
+		ErrorRatio:        0.01,
+		LatencyP99Seconds: 0.05,
+		For:               "5m",
+	}))
+
+	req := httptest.NewRequest("GET", "/alerts", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "RateLimiterHighDenialRate")
+	assert.Contains(t, body, "RateLimiterRedisErrors")
+	assert.Contains(t, body, "RateLimiterHighLatencyP99")
+	assert.Contains(t, body, metrics.DurationMetricName+"_bucket[5m]")
+	assert.Contains(t, body, "> 0.05")
+
+	req = httptest.NewRequest("GET", "/alerts?format=json", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"groups"`)
+}
@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/events"
+	"github.com/pmujumdar27/go-rate-limiter/internal/middleware"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+// Operation documents one route of the OpenAPI document. Request and
+// Response are zero values of the JSON bodies; their schemas are derived
+// from the Go types.
+type Operation struct {
+	Summary string
+	// Admin marks routes behind the admin bearer token.
+	Admin    bool
+	Query    []Parameter
+	Request  interface{}
+	Response interface{}
+	// Stream is the media type of a streamed response, e.g.
+	// "text/event-stream", instead of JSON.
+	Stream string
+}
+
+type Parameter struct {
+	Name        string
+	Description string
+}
+
+// decisionResponse is the body of the check endpoints, under "reserved"
+// instead of "allowed" for reservations.
+type decisionResponse struct {
+	Allowed    bool                   `json:"allowed"`
+	Code       middleware.ErrorCode   `json:"code,omitempty"`
+	RetryAfter int64                  `json:"retry_after,omitempty"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	RequestID  string                 `json:"request_id,omitempty"`
+}
+
+type reservationResponse struct {
+	Reserved  bool                   `json:"reserved"`
+	N         int64                  `json:"n"`
+	DelayMs   int64                  `json:"delay_ms"`
+	TimeToAct time.Time              `json:"time_to_act"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type statusResponse struct {
+	Key       string                 `json:"key"`
+	Limit     int64                  `json:"limit"`
+	Used      int64                  `json:"used"`
+	Remaining int64                  `json:"remaining"`
+	ResetTime time.Time              `json:"reset_time"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	// RecentRequests is only set when asked for with ?recent=.
+	RecentRequests []time.Time `json:"recent_requests,omitempty"`
+}
+
+var keyQuery = Parameter{Name: "key", Description: "key to report on; the caller's key when empty"}
+
+// Operations documents the server's routes by "METHOD /path", with gin's
+// path syntax. Routes missing here are still listed, with a generic body.
+var Operations = map[string]Operation{
+	"GET /":             {Summary: "Service information"},
+	"GET /health":       {Summary: "Liveness check"},
+	"GET /health/ready": {Summary: "Readiness check; 503 while draining"},
+	"GET /metrics":      {Summary: "Prometheus metrics", Stream: "text/plain"},
+	"GET /openapi.json": {Summary: "This document"},
+
+	"POST /rate-limit": {Summary: "Consume one request for the caller's key", Response: decisionResponse{}},
+	"POST /rate-limit/reserve": {
+		Summary:  "Reserve requests and report how long to wait before sending them",
+		Query:    []Parameter{{Name: "n", Description: "requests to reserve, default 1"}, {Name: "max_wait_ms", Description: "longest acceptable wait, at most 60000"}},
+		Response: reservationResponse{},
+	},
+	"POST /rate-limit/reset": {Summary: "Reset the caller's key", Admin: true},
+	"GET /rate-limit/quota":  {Summary: "Report the caller's quota without consuming it", Response: ratelimit.RateLimitResponse{}},
+	"GET /rate-limit/status": {
+		Summary:  "Report a key's usage without consuming it",
+		Query:    []Parameter{{Name: "key", Description: "another key than the caller's; requires the read_only role"}, {Name: "recent", Description: "include the times of the key's n most recent requests (sliding_window_log only)"}},
+		Response: statusResponse{},
+	},
+	"POST /rate-limit/test": {
+		Summary:  "Replay a deterministic allow/deny sequence for the caller's sandbox key",
+		Admin:    true,
+		Query:    []Parameter{{Name: "sequence", Description: "e.g. aad"}, {Name: "deny_every", Description: "deny every nth request"}},
+		Response: decisionResponse{},
+	},
+	"POST /rate-limit/test/reset": {Summary: "Restart the caller's sandbox sequence", Admin: true},
+
+	"GET /api/unrestricted": {Summary: "Demo resource without a limit"},
+	"GET /api/restricted":   {Summary: "Demo resource behind the rate limit middleware"},
+	"POST /api/graphql":     {Summary: "Demo GraphQL endpoint charged by operation cost"},
+
+	"GET /admin/policies":         {Summary: "List policies", Admin: true},
+	"PATCH /admin/policies/:name": {Summary: "Enable or disable a policy", Admin: true, Request: updatePolicyRequest{}},
+	"GET /admin/denials": {
+		Summary: "Export recent denials",
+		Admin:   true,
+		Query:   []Parameter{{Name: "since", Description: "RFC 3339 time"}, {Name: "until", Description: "RFC 3339 time"}},
+	},
+	"GET /admin/throttle":    {Summary: "Show the fleet-wide throttle", Admin: true},
+	"POST /admin/throttle":   {Summary: "Scale every limit by a multiplier", Admin: true, Request: setThrottleRequest{}},
+	"DELETE /admin/throttle": {Summary: "Lift the fleet-wide throttle", Admin: true},
+	"GET /admin/penalize":    {Summary: "Show a key's penalty", Admin: true, Query: []Parameter{keyQuery}},
+	"POST /admin/penalize":   {Summary: "Block a key or charge it extra requests", Admin: true, Request: penalizeRequest{}},
+	"DELETE /admin/penalize": {Summary: "Clear a key's penalty", Admin: true, Query: []Parameter{keyQuery}},
+	"GET /admin/bans":        {Summary: "List blocked keys", Admin: true},
+	"PUT /admin/notes":       {Summary: "Leave a note on a key for support", Admin: true, Request: annotateKeyRequest{}, Response: keyInspection{}},
+	"DELETE /admin/notes":    {Summary: "Remove a key's note", Admin: true, Query: []Parameter{keyQuery}, Response: keyInspection{}},
+	"GET /admin/analytics/top-keys": {
+		Summary:  "List the highest-traffic and most-throttled keys",
+		Admin:    true,
+		Query:    []Parameter{{Name: "limit", Description: "keys per list, 1-1000"}},
+		Response: ratelimit.TopKeysReport{},
+	},
+	"GET /admin/stats":    {Summary: "Current strategy and decision totals", Admin: true},
+	"PUT /admin/strategy": {Summary: "Switch the default policy's strategy", Admin: true, Request: switchStrategyRequest{}},
+	"GET /admin/decisions/tail": {
+		Summary:  "Follow decisions as server-sent events",
+		Admin:    true,
+		Query:    []Parameter{{Name: "decision", Description: "allowed, denied or error"}},
+		Response: events.Decision{},
+		Stream:   "text/event-stream",
+	},
+	"DELETE /admin/keys/*key": {
+		Summary: "Reset a key, or every key starting with it",
+		Admin:   true,
+		Query:   []Parameter{{Name: "policy"}, {Name: "namespace"}, {Name: "prefix", Description: "true to reset by prefix"}},
+	},
+	"GET /admin/keys/inspect": {
+		Summary:  "Show a key's note, penalty and usage under each policy",
+		Admin:    true,
+		Query:    []Parameter{{Name: "key", Description: "required"}, {Name: "namespace"}},
+		Response: keyInspection{},
+	},
+	"GET /admin/keys/usage": {
+		Summary:  "Count keys and sample their memory per strategy prefix",
+		Admin:    true,
+		Query:    []Parameter{{Name: "prefix", Description: "strategy name, default all"}, {Name: "idle_seconds", Description: "also count keys unused this long"}},
+		Response: ratelimit.KeyUsageReport{},
+	},
+	"POST /admin/keys/purge": {
+		Summary:  "Delete keys unused for idle_seconds",
+		Admin:    true,
+		Query:    []Parameter{{Name: "prefix", Description: "strategy name, default all"}, {Name: "idle_seconds", Description: "required"}},
+		Response: ratelimit.KeyUsageReport{},
+	},
+	"POST /admin/keys/migrate": {
+		Summary:  "Move the keys under one prefix to another, paced by key_usage.migration",
+		Admin:    true,
+		Request:  migrateKeysRequest{},
+		Response: ratelimit.KeyMigrationJob{},
+	},
+	"GET /admin/keys/migrate/:id": {
+		Summary:  "Report the progress of a key migration",
+		Admin:    true,
+		Response: ratelimit.KeyMigrationJob{},
+	},
+	"GET /admin/state/export": {
+		Summary:  "Dump the keys under each strategy prefix for a Redis migration",
+		Admin:    true,
+		Query:    []Parameter{{Name: "prefix", Description: "strategy name, default all"}},
+		Response: ratelimit.StateExport{},
+	},
+	"POST /admin/state/import": {
+		Summary:  "Write the keys of a state export",
+		Admin:    true,
+		Query:    []Parameter{{Name: "overwrite", Description: "true to replace keys that already exist"}},
+		Request:  importStateRequest{},
+		Response: ratelimit.ImportResult{},
+	},
+	"GET /admin/observability/alerts": {
+		Summary: "Prometheus alerting rules for the configured thresholds",
+		Admin:   true,
+		Query:   []Parameter{{Name: "format", Description: "json instead of YAML"}},
+	},
+}
+
+// OpenAPI builds an OpenAPI 3 document for routes, described by operations.
+func OpenAPI(title, version string, routes gin.RoutesInfo, operations map[string]Operation) map[string]interface{} {
+	schemas := newSchemaRegistry()
+	errorSchema := schemas.ref(reflect.TypeOf(middleware.ErrorResponse{}))
+
+	paths := make(map[string]map[string]interface{})
+	for _, route := range routes {
+		if route.Method == http.MethodHead {
+			continue
+		}
+
+		op := operations[route.Method+" "+route.Path]
+		path, pathParams := openAPIPath(route.Path)
+
+		parameters := make([]interface{}, 0, len(pathParams)+len(op.Query))
+		for _, name := range pathParams {
+			parameters = append(parameters, map[string]interface{}{
+				"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, param := range op.Query {
+			parameter := map[string]interface{}{"name": param.Name, "in": "query", "schema": map[string]interface{}{"type": "string"}}
+			if param.Description != "" {
+				parameter["description"] = param.Description
+			}
+			parameters = append(parameters, parameter)
+		}
+
+		operation := map[string]interface{}{
+			"operationId": strings.ToLower(route.Method) + operationName(route.Path),
+			"tags":        []string{tagFor(route.Path)},
+			"responses": map[string]interface{}{
+				"200":     successResponse(op, schemas),
+				"default": errorResponse(errorSchema),
+			},
+		}
+		if op.Summary != "" {
+			operation["summary"] = op.Summary
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+		if op.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemas.ref(reflect.TypeOf(op.Request))},
+				},
+			}
+		}
+		if op.Admin {
+			operation["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+		}
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": title, "version": version},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// OpenAPIHandler serves doc as JSON.
+func OpenAPIHandler(doc map[string]interface{}) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+func successResponse(op Operation, schemas *schemaRegistry) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object"}
+	if op.Response != nil {
+		schema = schemas.ref(reflect.TypeOf(op.Response))
+	}
+	if op.Stream != "" {
+		return map[string]interface{}{
+			"description": "OK",
+			"content":     map[string]interface{}{op.Stream: map[string]interface{}{"schema": schema}},
+		}
+	}
+	return jsonResponse("OK", schema)
+}
+
+// errorResponse also lists problem+json, served for 429 and 5xx when
+// server.problem_json is enabled.
+func errorResponse(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json":            map[string]interface{}{"schema": schema},
+			middleware.ProblemContentType: map[string]interface{}{"schema": map[string]interface{}{"type": "object"}},
+		},
+	}
+}
+
+func jsonResponse(description string, schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}},
+	}
+}
+
+// openAPIPath turns gin's :name and *name segments into {name}.
+func openAPIPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func operationName(path string) string {
+	var name strings.Builder
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '-' || r == '.' || r == ':' || r == '*'
+	}) {
+		name.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	if name.Len() == 0 {
+		return "Root"
+	}
+	return name.String()
+}
+
+func tagFor(path string) string {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if segment == "" || segment == "openapi.json" {
+		return "service"
+	}
+	return segment
+}
+
+// schemaRegistry derives JSON schemas from Go types, keeping named structs
+// under components/schemas.
+type schemaRegistry struct {
+	schemas map[string]interface{}
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{schemas: make(map[string]interface{})}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (r *schemaRegistry) ref(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType || t.Name() == "" {
+		return r.schema(t)
+	}
+
+	name := schemaName(t)
+	if _, exists := r.schemas[name]; !exists {
+		// Reserve the name first, in case the type refers to itself.
+		r.schemas[name] = nil
+		r.schemas[name] = r.schema(t)
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func (r *schemaRegistry) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(time.Duration(0)):
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": r.ref(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": r.ref(t.Elem())}
+	case reflect.Struct:
+		return r.structSchema(t)
+	}
+	// interface{} and anything else accept any value.
+	return map[string]interface{}{}
+}
+
+func (r *schemaRegistry) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	r.addFields(t, properties, &required)
+	sort.Strings(required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields follows encoding/json: embedded structs are flattened, "-" and
+// unexported fields are skipped, and omitempty or pointer fields are optional.
+func (r *schemaRegistry) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			r.addFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = r.ref(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func schemaName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	name := t.Name()
+	if pkg == "handlers" || pkg == "" {
+		return strings.ToUpper(name[:1]) + name[1:]
+	}
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + name
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/rate-limit", func(c *gin.Context) {})
+	router.PUT("/admin/strategy", func(c *gin.Context) {})
+	router.DELETE("/admin/keys/*key", func(c *gin.Context) {})
+	router.GET("/undocumented", func(c *gin.Context) {})
+	router.GET("/openapi.json", OpenAPIHandler(OpenAPI("test", "1.0.0", router.Routes(), Operations)))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var doc struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Contains(t, doc.Paths, "/undocumented", "routes without docs are listed")
+	assert.Contains(t, doc.Paths["/admin/keys/{key}"], "delete")
+	assert.Equal(t, "Reset a key, or every key starting with it", doc.Paths["/admin/keys/{key}"]["delete"]["summary"])
+
+	strategy := doc.Paths["/admin/strategy"]["put"]
+	assert.Equal(t, "Switch the default policy's strategy", strategy["summary"])
+	assert.Contains(t, strategy, "security")
+	assert.Contains(t, strategy, "requestBody")
+	assert.NotContains(t, doc.Paths["/rate-limit"]["post"], "security")
+
+	errorSchema := doc.Components.Schemas["MiddlewareErrorResponse"]
+	require.NotNil(t, errorSchema)
+	assert.ElementsMatch(t, []interface{}{"code", "error", "message"}, errorSchema["required"])
+	assert.Contains(t, errorSchema["properties"], "retry_after")
+
+	switchSchema := doc.Components.Schemas["SwitchStrategyRequest"]
+	assert.Equal(t, []interface{}{"strategy"}, switchSchema["required"])
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	path, params := openAPIPath("/admin/keys/:key/*rest")
+	assert.Equal(t, "/admin/keys/{key}/{rest}", path)
+	assert.Equal(t, []string{"key", "rest"}, params)
+}
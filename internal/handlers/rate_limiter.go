@@ -1,17 +1,28 @@
 package handlers
 
 import (
-	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/middleware"
 	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
 )
 
+// maxReserveWait bounds reservations, and is the default for those that don't
+// set ?max_wait_ms, so one caller can't run its budget arbitrarily far into
+// debt.
+const maxReserveWait = time.Minute
+
 type RateLimitHandler struct {
 	rateLimiter ratelimit.RateLimiter
+	denialLog   *ratelimit.DenialLog
+	auditLog    *ratelimit.AuditLog
+	sandbox     *ratelimit.Sandbox
+	timeout     time.Duration
 }
 
 func NewRateLimitHandler(rateLimiter ratelimit.RateLimiter) *RateLimitHandler {
@@ -20,55 +31,160 @@ func NewRateLimitHandler(rateLimiter ratelimit.RateLimiter) *RateLimitHandler {
 	}
 }
 
+func (rlh *RateLimitHandler) WithAuditLog(auditLog *ratelimit.AuditLog) *RateLimitHandler {
+	rlh.auditLog = auditLog
+	return rlh
+}
+
+func (rlh *RateLimitHandler) WithDenialLog(denialLog *ratelimit.DenialLog) *RateLimitHandler {
+	rlh.denialLog = denialLog
+	return rlh
+}
+
+// WithTimeout caps each rate limit call on top of the request's own deadline.
+func (rlh *RateLimitHandler) WithTimeout(timeout time.Duration) *RateLimitHandler {
+	rlh.timeout = timeout
+	return rlh
+}
+
+func (rlh *RateLimitHandler) WithSandbox(sandbox *ratelimit.Sandbox) *RateLimitHandler {
+	rlh.sandbox = sandbox
+	return rlh
+}
+
 func (rlh *RateLimitHandler) RateLimit(c *gin.Context) {
 	clientID := c.GetHeader("X-Client-ID")
 	if clientID == "" {
-		clientID = c.ClientIP()
+		clientID = middleware.ClientKeyIP(c)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := middleware.LimiterContext(c, rlh.timeout)
 	defer cancel()
+	ctx = middleware.WithDecisionID(c, ctx)
 
 	response, err := rlh.rateLimiter.IsAllowed(ctx, clientID, time.Now())
+	if err != nil && middleware.ClientGone(c) {
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Rate limiter error",
-			"message": err.Error(),
-		})
+		middleware.LogRateLimitError(c, clientID, err)
+		middleware.RespondError(c, http.StatusInternalServerError, "Rate limiter error", err.Error())
 		return
 	}
 
 	rlh.setRateLimitHeaders(c, response)
+	middleware.RecordAudit(c, rlh.auditLog, rlh.rateLimiter, clientID, response)
 
 	if !response.Allowed {
-		c.JSON(http.StatusTooManyRequests, gin.H{
-			"allowed":  false,
-			"metadata": response.Metadata,
-		})
+		middleware.LogRateLimitDenied(c, clientID, response)
+		middleware.RecordDenial(c, rlh.denialLog, rlh.rateLimiter, clientID)
+		respondRateLimited(c, "allowed", response)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	body := gin.H{
 		"allowed":  true,
 		"metadata": response.Metadata,
+	}
+	if response.Stats != nil {
+		body["stats"] = response.Stats
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// Reserve books ?n requests (default 1) for the caller and reports how long to
+// wait before sending them, so clients can pace themselves instead of retrying
+// on 429. Reservations that would wait longer than ?max_wait_ms are refused
+// without being charged.
+func (rlh *RateLimitHandler) Reserve(c *gin.Context) {
+	reserver, ok := rlh.rateLimiter.(ratelimit.Reserver)
+	if !ok || !ratelimit.SupportsReserve(rlh.rateLimiter) {
+		middleware.RespondError(c, http.StatusNotImplemented, "Reservation error", ratelimit.ErrReserveNotSupported.Error())
+		return
+	}
+
+	n, maxWait, err := reserveParams(c)
+	if err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid reservation", err.Error())
+		return
+	}
+
+	clientID := c.GetHeader("X-Client-ID")
+	if clientID == "" {
+		clientID = middleware.ClientKeyIP(c)
+	}
+
+	ctx, cancel := middleware.LimiterContext(c, rlh.timeout)
+	defer cancel()
+	ctx = middleware.WithDecisionID(c, ctx)
+
+	reservation, err := reserver.ReserveN(ctx, clientID, n, time.Now(), maxWait)
+	if err != nil && middleware.ClientGone(c) {
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		middleware.LogRateLimitError(c, clientID, err)
+		middleware.RespondError(c, http.StatusInternalServerError, "Reservation error", err.Error())
+		return
+	}
+
+	rlh.setRateLimitHeaders(c, reservation.RateLimitResponse)
+
+	if !reservation.Allowed {
+		middleware.LogRateLimitDenied(c, clientID, reservation.RateLimitResponse)
+		respondRateLimited(c, "reserved", reservation.RateLimitResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reserved":    true,
+		"n":           n,
+		"delay_ms":    reservation.Delay.Milliseconds(),
+		"time_to_act": time.Now().Add(reservation.Delay),
+		"metadata":    reservation.Metadata,
 	})
 }
 
+func reserveParams(c *gin.Context) (int64, time.Duration, error) {
+	n := int64(1)
+	if raw := c.Query("n"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 1 {
+			return 0, 0, fmt.Errorf("n must be a positive integer")
+		}
+		n = parsed
+	}
+
+	maxWait := maxReserveWait
+	if raw := c.Query("max_wait_ms"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("max_wait_ms must be a non-negative integer")
+		}
+		// Compared in milliseconds, since larger values overflow a Duration.
+		if parsed < maxReserveWait.Milliseconds() {
+			maxWait = time.Duration(parsed) * time.Millisecond
+		}
+	}
+
+	return n, maxWait, nil
+}
+
 func (rlh *RateLimitHandler) ResetRateLimit(c *gin.Context) {
 	clientID := c.GetHeader("X-Client-ID")
 	if clientID == "" {
-		clientID = c.ClientIP()
+		clientID = middleware.ClientKeyIP(c)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := middleware.LimiterContext(c, rlh.timeout)
 	defer cancel()
 
 	err := rlh.rateLimiter.Reset(ctx, clientID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Reset error",
-			"message": err.Error(),
-		})
+		middleware.LogRateLimitError(c, clientID, err)
+		middleware.RespondError(c, http.StatusInternalServerError, "Reset error", err.Error())
 		return
 	}
 
@@ -78,22 +194,211 @@ func (rlh *RateLimitHandler) ResetRateLimit(c *gin.Context) {
 	})
 }
 
-func (rlh *RateLimitHandler) setRateLimitHeaders(c *gin.Context, response ratelimit.RateLimitResponse) {
-	c.Header("RateLimit-Limit", strconv.FormatInt(response.Limit, 10))
-	c.Header("RateLimit-Remaining", strconv.FormatInt(response.Remaining, 10))
+// Test replays a deterministic allow/deny sequence for the caller's sandbox
+// key. ?sequence=aad or ?deny_every=3 override the configured default.
+func (rlh *RateLimitHandler) Test(c *gin.Context) {
+	if rlh.sandbox == nil {
+		middleware.RespondError(c, http.StatusNotFound, "Sandbox disabled", "the rate limit sandbox is not enabled")
+		return
+	}
+
+	sequence, err := sandboxSequence(c)
+	if err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, "Invalid sandbox sequence", err.Error())
+		return
+	}
 
-	resetSeconds := int64(time.Until(response.ResetTime).Seconds())
+	key := sandboxKey(c)
+	response := rlh.sandbox.Next(key, sequence, time.Now())
+	rlh.setRateLimitHeaders(c, response)
 
-	if resetSeconds < 0 {
-		resetSeconds = 0
+	if !response.Allowed {
+		respondRateLimited(c, "allowed", response)
+		return
 	}
-	c.Header("RateLimit-Reset", strconv.FormatInt(resetSeconds, 10))
 
-	if !response.Allowed && response.RetryAfter != nil {
-		retryAfterSeconds := int64(response.RetryAfter.Seconds())
-		if retryAfterSeconds < 0 {
-			retryAfterSeconds = 0
+	c.JSON(http.StatusOK, gin.H{
+		"allowed":  true,
+		"metadata": response.Metadata,
+	})
+}
+
+func (rlh *RateLimitHandler) ResetTest(c *gin.Context) {
+	if rlh.sandbox == nil {
+		middleware.RespondError(c, http.StatusNotFound, "Sandbox disabled", "the rate limit sandbox is not enabled")
+		return
+	}
+
+	key := sandboxKey(c)
+	rlh.sandbox.Reset(key)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Sandbox sequence reset successfully",
+		"client_id": key,
+	})
+}
+
+// respondRateLimited answers a denied check with the decision field set to
+// false and the code and retry_after of the error envelope, or as problem
+// details carrying the decision and metadata when those are enabled.
+func respondRateLimited(c *gin.Context, decision string, response ratelimit.RateLimitResponse) {
+	if middleware.ProblemJSONEnabled(c) {
+		problem := middleware.NewErrorResponse(c, http.StatusTooManyRequests, "Rate limit exceeded", "Too many requests")
+		if response.RetryAfter != nil {
+			problem = problem.WithRetryAfter(*response.RetryAfter)
+		}
+		details := gin.H{decision: false, "metadata": response.Metadata}
+		if response.Stats != nil {
+			details["stats"] = response.Stats
+		}
+		problem.Details = details
+		middleware.WriteError(c, http.StatusTooManyRequests, problem)
+		return
+	}
+
+	body := gin.H{
+		decision:     false,
+		"code":       middleware.CodeRateLimited,
+		"metadata":   response.Metadata,
+		"request_id": middleware.GetRequestID(c),
+	}
+	if response.RetryAfter != nil {
+		body["retry_after"] = middleware.RetryAfterSeconds(*response.RetryAfter)
+	}
+	if response.Stats != nil {
+		body["stats"] = response.Stats
+	}
+	c.JSON(http.StatusTooManyRequests, body)
+}
+
+func sandboxKey(c *gin.Context) string {
+	clientID := c.GetHeader("X-Client-ID")
+	if clientID == "" {
+		clientID = middleware.ClientKeyIP(c)
+	}
+	if namespace := middleware.GetNamespace(c); namespace != "" {
+		return namespace + ":" + clientID
+	}
+	return clientID
+}
+
+func sandboxSequence(c *gin.Context) (ratelimit.SandboxSequence, error) {
+	if sequence := c.Query("sequence"); sequence != "" {
+		return ratelimit.ParseSandboxSequence(sequence)
+	}
+	if denyEvery := c.Query("deny_every"); denyEvery != "" {
+		n, err := strconv.Atoi(denyEvery)
+		if err != nil {
+			return nil, fmt.Errorf("deny_every must be an integer")
+		}
+		return ratelimit.DenyEverySequence(n)
+	}
+	return nil, nil
+}
+
+func (rlh *RateLimitHandler) QuotaUsage(c *gin.Context) {
+	clientID := c.GetHeader("X-Client-ID")
+	if clientID == "" {
+		clientID = middleware.ClientKeyIP(c)
+	}
+
+	response, ok := rlh.peek(c, clientID, "Quota usage error", 0)
+	if !ok {
+		return
+	}
+
+	rlh.setRateLimitHeaders(c, response)
+
+	c.JSON(http.StatusOK, gin.H{
+		"client_id":  clientID,
+		"limit":      response.Limit,
+		"remaining":  response.Remaining,
+		"reset_time": response.ResetTime,
+		"metadata":   response.Metadata,
+	})
+}
+
+// Status reports usage for ?key= (or the caller) without consuming capacity.
+// ?recent=N adds the times of the key's N most recent requests, for
+// strategies that log them.
+func (rlh *RateLimitHandler) Status(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		key = c.GetHeader("X-Client-ID")
+	}
+	if key == "" {
+		key = middleware.ClientKeyIP(c)
+	}
+
+	recent := 0
+	if value := c.Query("recent"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > ratelimit.MaxRecentRequests {
+			middleware.RespondError(c, http.StatusBadRequest, "Invalid recent",
+				fmt.Sprintf("recent must be a number from 0 to %d", ratelimit.MaxRecentRequests))
+			return
 		}
-		c.Header("Retry-After", strconv.FormatInt(retryAfterSeconds, 10))
+		recent = n
+	}
+
+	response, ok := rlh.peek(c, key, "Status error", recent)
+	if !ok {
+		return
+	}
+
+	used := response.Limit - response.Remaining
+	if used < 0 {
+		used = 0
+	}
+
+	body := gin.H{
+		"key":        key,
+		"limit":      response.Limit,
+		"used":       used,
+		"remaining":  response.Remaining,
+		"reset_time": response.ResetTime,
+		"metadata":   response.Metadata,
 	}
+	if recent > 0 {
+		recentRequests := response.RecentRequests
+		if recentRequests == nil {
+			recentRequests = []time.Time{}
+		}
+		body["recent_requests"] = recentRequests
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// peek reports on key, with the times of its last recent requests when
+// recent is positive.
+func (rlh *RateLimitHandler) peek(c *gin.Context, key string, errorTitle string, recent int) (ratelimit.RateLimitResponse, bool) {
+	peeker, ok := rlh.rateLimiter.(ratelimit.Peeker)
+	if !ok {
+		middleware.RespondError(c, http.StatusNotImplemented, errorTitle, ratelimit.ErrPeekNotSupported.Error())
+		return ratelimit.RateLimitResponse{}, false
+	}
+
+	ctx, cancel := middleware.LimiterContext(c, rlh.timeout)
+	defer cancel()
+	if recent > 0 {
+		ctx = ratelimit.WithRecentRequests(ctx, recent)
+	}
+
+	response, err := peeker.Peek(ctx, key, time.Now())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ratelimit.ErrPeekNotSupported) {
+			status = http.StatusNotImplemented
+		} else {
+			middleware.LogRateLimitError(c, key, err)
+		}
+		middleware.RespondError(c, status, errorTitle, err.Error())
+		return ratelimit.RateLimitResponse{}, false
+	}
+
+	return response, true
+}
+
+func (rlh *RateLimitHandler) setRateLimitHeaders(c *gin.Context, response ratelimit.RateLimitResponse) {
+	middleware.SetRateLimitHeaders(c, response)
 }
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/middleware"
 	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -48,9 +49,9 @@ func TestRateLimitHandler_RateLimit_Allowed(t *testing.T) {
 			Limit:     10,
 			Remaining: 9,
 			ResetTime: time.Now().Add(time.Hour),
-			Metadata: map[string]interface{}{
+			Metadata: ratelimit.MetadataOf(map[string]interface{}{
 				"bucket_size": 10,
-			},
+			}),
 		}, nil)
 
 	router := gin.New()
@@ -88,9 +89,9 @@ func TestRateLimitHandler_RateLimit_Denied(t *testing.T) {
 			Remaining:  0,
 			ResetTime:  time.Now().Add(time.Hour),
 			RetryAfter: &retryAfter,
-			Metadata: map[string]interface{}{
+			Metadata: ratelimit.MetadataOf(map[string]interface{}{
 				"current_tokens": 0,
-			},
+			}),
 		}, nil)
 
 	router := gin.New()
@@ -113,6 +114,69 @@ func TestRateLimitHandler_RateLimit_Denied(t *testing.T) {
 	mockLimiter.AssertExpectations(t)
 }
 
+func TestRateLimitHandler_RateLimit_Stats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := &MockRateLimiter{}
+	handler := NewRateLimitHandler(mockLimiter)
+
+	mockLimiter.On("IsAllowed", mock.Anything, mock.AnythingOfType("string"), mock.Anything).Return(
+		ratelimit.RateLimitResponse{
+			Allowed:   true,
+			Limit:     10,
+			Remaining: 5,
+			ResetTime: time.Now().Add(time.Minute),
+			Stats: &ratelimit.KeyStats{
+				Requests:  5,
+				Denied:    2,
+				FirstSeen: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		}, nil)
+
+	router := gin.New()
+	router.POST("/rate-limit", handler.RateLimit)
+
+	req := httptest.NewRequest("POST", "/rate-limit", nil)
+	req.Header.Set("X-Client-ID", "test-client")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"stats":{"requests":5,"denied":2,"first_seen":"2024-01-01T00:00:00Z"}`)
+}
+
+func TestRateLimitHandler_RateLimit_DeniedProblemJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := &MockRateLimiter{}
+	handler := NewRateLimitHandler(mockLimiter)
+
+	retryAfter := 30 * time.Second
+	mockLimiter.On("IsAllowed", mock.Anything, mock.AnythingOfType("string"), mock.Anything).Return(
+		ratelimit.RateLimitResponse{
+			Allowed:    false,
+			Limit:      10,
+			ResetTime:  time.Now().Add(time.Hour),
+			RetryAfter: &retryAfter,
+		}, nil)
+
+	router := gin.New()
+	router.Use(middleware.ProblemJSON(""))
+	router.POST("/rate-limit", handler.RateLimit)
+
+	req := httptest.NewRequest("POST", "/rate-limit", nil)
+	req.Header.Set("X-Client-ID", "test-client")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, middleware.ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"type":"about:blank"`)
+	assert.Contains(t, w.Body.String(), `"retry-after":30`)
+	assert.Contains(t, w.Body.String(), `"allowed":false`)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+}
+
 func TestRateLimitHandler_RateLimit_ClientIPFallback(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -141,6 +205,39 @@ func TestRateLimitHandler_RateLimit_ClientIPFallback(t *testing.T) {
 	mockLimiter.AssertExpectations(t)
 }
 
+func TestRateLimitHandler_RateLimit_TrustedProxyClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := &MockRateLimiter{}
+	handler := NewRateLimitHandler(mockLimiter)
+
+	for _, key := range []string{"1.2.3.4", "203.0.113.5"} {
+		mockLimiter.On("IsAllowed", mock.Anything, key, mock.Anything).Return(
+			ratelimit.RateLimitResponse{
+				Allowed:   true,
+				Limit:     10,
+				Remaining: 9,
+				ResetTime: time.Now().Add(time.Hour),
+			}, nil).Once()
+	}
+
+	router := gin.New()
+	assert.NoError(t, middleware.ConfigureClientIP(router, middleware.ClientIPConfig{TrustedProxies: []string{"10.0.0.0/8"}}))
+	router.POST("/rate-limit", handler.RateLimit)
+
+	for _, remoteAddr := range []string{"10.0.0.1:1234", "203.0.113.5:1234"} {
+		req := httptest.NewRequest("POST", "/rate-limit", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "1.2.3.4")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	mockLimiter.AssertExpectations(t)
+}
+
 func TestRateLimitHandler_RateLimit_Error(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -291,4 +388,203 @@ func TestRateLimitHandler_setRateLimitHeaders(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+type MockPeekingRateLimiter struct {
+	MockRateLimiter
+}
+
+func (m *MockPeekingRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (ratelimit.RateLimitResponse, error) {
+	args := m.Called(ctx, key, timestamp)
+	return args.Get(0).(ratelimit.RateLimitResponse), args.Error(1)
+}
+
+func TestRateLimitHandler_Status(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := &MockPeekingRateLimiter{}
+	handler := NewRateLimitHandler(mockLimiter)
+
+	mockLimiter.On("Peek", mock.Anything, "customer-42", mock.Anything).Return(
+		ratelimit.RateLimitResponse{
+			Allowed:   true,
+			Limit:     10,
+			Remaining: 7,
+			ResetTime: time.Now().Add(time.Minute),
+		}, nil)
+
+	router := gin.New()
+	router.GET("/rate-limit/status", handler.Status)
+
+	req := httptest.NewRequest("GET", "/rate-limit/status?key=customer-42", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"used":3`)
+	assert.Contains(t, w.Body.String(), `"remaining":7`)
+	mockLimiter.AssertNotCalled(t, "IsAllowed", mock.Anything, mock.Anything, mock.Anything)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimitHandler_StatusRecentRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := &MockPeekingRateLimiter{}
+	handler := NewRateLimitHandler(mockLimiter)
+
+	requestedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	asksForTwo := mock.MatchedBy(func(ctx context.Context) bool { return ratelimit.RecentRequestsFromContext(ctx) == 2 })
+	mockLimiter.On("Peek", asksForTwo, "customer-42", mock.Anything).Return(
+		ratelimit.RateLimitResponse{
+			Limit:          10,
+			Remaining:      8,
+			RecentRequests: []time.Time{requestedAt, requestedAt.Add(-time.Second)},
+		}, nil)
+
+	router := gin.New()
+	router.GET("/rate-limit/status", handler.Status)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/rate-limit/status?key=customer-42&recent=2", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"recent_requests":["2024-05-01T12:00:00Z","2024-05-01T11:59:59Z"]`)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/rate-limit/status?key=customer-42&recent=1000", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimitHandler_Status_NotSupported(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewRateLimitHandler(&MockRateLimiter{})
+
+	router := gin.New()
+	router.GET("/rate-limit/status", handler.Status)
+
+	req := httptest.NewRequest("GET", "/rate-limit/status?key=customer-42", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+func TestRateLimitHandler_Test(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	sequence, _ := ratelimit.ParseSandboxSequence("aad")
+	sandbox, _ := ratelimit.NewSandbox(ratelimit.SandboxConfig{DefaultSequence: sequence, RetryAfter: 5 * time.Second})
+	handler := NewRateLimitHandler(&MockRateLimiter{}).WithSandbox(sandbox)
+
+	router := gin.New()
+	router.POST("/rate-limit/test", handler.Test)
+
+	codes := make([]int, 0, 4)
+	var denied *httptest.ResponseRecorder
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest("POST", "/rate-limit/test?deny_every=2", nil)
+		req.Header.Set("X-Client-ID", "sandbox-client")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+		if w.Code == http.StatusTooManyRequests {
+			denied = w
+		}
+	}
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK, http.StatusTooManyRequests}, codes)
+	assert.Equal(t, "5", denied.Header().Get("Retry-After"))
+	assert.Equal(t, "0", denied.Header().Get("RateLimit-Remaining"))
+
+	req := httptest.NewRequest("POST", "/rate-limit/test?sequence=axe", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRateLimitHandler_Test_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewRateLimitHandler(&MockRateLimiter{})
+
+	router := gin.New()
+	router.POST("/rate-limit/test", handler.Test)
+
+	req := httptest.NewRequest("POST", "/rate-limit/test", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+type MockReservingRateLimiter struct {
+	MockRateLimiter
+}
+
+func (m *MockReservingRateLimiter) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (ratelimit.Reservation, error) {
+	args := m.Called(ctx, key, n, timestamp, maxDelay)
+	return args.Get(0).(ratelimit.Reservation), args.Error(1)
+}
+
+func TestRateLimitHandler_Reserve(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := &MockReservingRateLimiter{}
+	handler := NewRateLimitHandler(mockLimiter)
+
+	mockLimiter.On("ReserveN", mock.Anything, "customer-42", int64(3), mock.Anything, 500*time.Millisecond).Return(
+		ratelimit.Reservation{
+			RateLimitResponse: ratelimit.RateLimitResponse{Allowed: true, Limit: 10, ResetTime: time.Now().Add(time.Second)},
+			Delay:             250 * time.Millisecond,
+		}, nil).Once()
+	mockLimiter.On("ReserveN", mock.Anything, "customer-42", int64(1), mock.Anything, maxReserveWait).Return(
+		ratelimit.Reservation{
+			RateLimitResponse: ratelimit.RateLimitResponse{Allowed: false, Limit: 10, ResetTime: time.Now().Add(time.Second)},
+		}, nil).Twice()
+
+	router := gin.New()
+	router.POST("/rate-limit/reserve", handler.Reserve)
+
+	req := httptest.NewRequest("POST", "/rate-limit/reserve?n=3&max_wait_ms=500", nil)
+	req.Header.Set("X-Client-ID", "customer-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"delay_ms":250`)
+
+	req = httptest.NewRequest("POST", "/rate-limit/reserve", nil)
+	req.Header.Set("X-Client-ID", "customer-42")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// Longer waits are clamped to the maximum.
+	req = httptest.NewRequest("POST", "/rate-limit/reserve?max_wait_ms=9223372036854775807", nil)
+	req.Header.Set("X-Client-ID", "customer-42")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimitHandler_Reserve_Invalid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/rate-limit/reserve", NewRateLimitHandler(&MockReservingRateLimiter{}).Reserve)
+	router.POST("/unsupported/reserve", NewRateLimitHandler(&MockRateLimiter{}).Reserve)
+
+	for target, status := range map[string]int{
+		"/rate-limit/reserve?n=0":            http.StatusBadRequest,
+		"/rate-limit/reserve?max_wait_ms=-1": http.StatusBadRequest,
+		"/unsupported/reserve":               http.StatusNotImplemented,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", target, nil))
+		assert.Equal(t, status, w.Code, target)
+	}
+}
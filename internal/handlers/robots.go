@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CrawlDelay is one robots.txt group: a user-agent token and its delay.
+type CrawlDelay struct {
+	UserAgent string
+	Delay     time.Duration
+}
+
+// RobotsTxt serves a robots.txt advertising each crawler's Crawl-delay, so
+// crawlers that honour it, such as Bingbot, pace themselves before being
+// limited. Googlebot ignores Crawl-delay and only backs off on 429s.
+func RobotsTxt(delays []CrawlDelay) gin.HandlerFunc {
+	var body strings.Builder
+	for _, delay := range delays {
+		fmt.Fprintf(&body, "User-agent: %s\nCrawl-delay: %d\n\n", delay.UserAgent, int64(delay.Delay.Round(time.Second)/time.Second))
+	}
+	body.WriteString("User-agent: *\nAllow: /\n")
+	content := body.String()
+
+	return func(c *gin.Context) {
+		c.String(http.StatusOK, content)
+	}
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRobotsTxt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/robots.txt", RobotsTxt([]CrawlDelay{
+		{UserAgent: "Googlebot", Delay: 2 * time.Second},
+		{UserAgent: "bingbot", Delay: 5 * time.Second},
+	}))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/robots.txt", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "User-agent: Googlebot\nCrawl-delay: 2\n\nUser-agent: bingbot\nCrawl-delay: 5\n\nUser-agent: *\nAllow: /\n", w.Body.String())
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import "fmt"
+
+// AlertThresholds configures the alerting rules generated for the exported metrics.
+type AlertThresholds struct {
+	DenialRatio       float64
+	ErrorRatio        float64
+	LatencyP99Seconds float64
+	For               string
+	Window            string
+}
+
+type AlertRuleFile struct {
+	Groups []AlertRuleGroup `yaml:"groups" json:"groups"`
+}
+
+type AlertRuleGroup struct {
+	Name  string      `yaml:"name" json:"name"`
+	Rules []AlertRule `yaml:"rules" json:"rules"`
+}
+
+type AlertRule struct {
+	Alert       string            `yaml:"alert" json:"alert"`
+	Expr        string            `yaml:"expr" json:"expr"`
+	For         string            `yaml:"for,omitempty" json:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty" json:"annotations,omitempty"`
+}
+
+// GenerateAlertRules builds Prometheus alerting rules against the metric names
+// registered by PrometheusCollector.
+func GenerateAlertRules(thresholds AlertThresholds) AlertRuleFile {
+	window := thresholds.Window
+	if window == "" {
+		window = "5m"
+	}
+
+	rules := []AlertRule{
+		{
+			Alert: "RateLimiterHighDenialRate",
+			Expr: fmt.Sprintf(
+				`sum by (strategy) (rate(%s{decision="denied"}[%s])) / sum by (strategy) (rate(%s[%s])) > %g`,
+				DecisionsMetricName, window, DecisionsMetricName, window, thresholds.DenialRatio,
+			),
+			For:    thresholds.For,
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "High rate limit denial ratio for {{ $labels.strategy }}",
+				"description": fmt.Sprintf("More than %g of rate limit decisions are denials.", thresholds.DenialRatio),
+			},
+		},
+		{
+			Alert: "RateLimiterRedisErrors",
+			Expr: fmt.Sprintf(
+				`sum by (strategy) (rate(%s[%s])) / (sum by (strategy) (rate(%s[%s])) + sum by (strategy) (rate(%s[%s]))) > %g`,
+				ErrorsMetricName, window, DecisionsMetricName, window, ErrorsMetricName, window, thresholds.ErrorRatio,
+			),
+			For:    thresholds.For,
+			Labels: map[string]string{"severity": "critical"},
+			Annotations: map[string]string{
+				"summary":     "Rate limit checks failing for {{ $labels.strategy }}",
+				"description": fmt.Sprintf("More than %g of rate limit checks fail with a Redis error.", thresholds.ErrorRatio),
+			},
+		},
+		{
+			Alert: "RateLimiterHighLatencyP99",
+			Expr: fmt.Sprintf(
+				`histogram_quantile(0.99, sum by (le, strategy) (rate(%s_bucket[%s]))) > %g`,
+				DurationMetricName, window, thresholds.LatencyP99Seconds,
+			),
+			For:    thresholds.For,
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "Rate limit decision latency p99 is high for {{ $labels.strategy }}",
+				"description": fmt.Sprintf("p99 decision latency exceeds %gs.", thresholds.LatencyP99Seconds),
+			},
+		},
+		{
+			Alert:  "RateLimiterNamespaceQuarantined",
+			Expr:   fmt.Sprintf(`max by (namespace) (%s) > 0`, QuarantineMetricName),
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "Namespace {{ $labels.namespace }} is quarantined",
+				"description": "Its Redis keys became too slow, so its checks are served by an approximate local limiter.",
+			},
+		},
+	}
+
+	return AlertRuleFile{
+		Groups: []AlertRuleGroup{
+			{
+				Name:  "go-rate-limiter",
+				Rules: rules,
+			},
+		},
+	}
+}
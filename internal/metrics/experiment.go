@@ -0,0 +1,7 @@
+package metrics
+
+// Arms of a strategy experiment, reported through RecordExperimentDecision.
+const (
+	ExperimentControl   = "control"
+	ExperimentTreatment = "experiment"
+)
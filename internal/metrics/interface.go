@@ -5,4 +5,37 @@ import "time"
 type Collector interface {
 	RecordRateLimitDecision(strategy string, allowed bool)
 	RecordRateLimitDuration(strategy string, duration time.Duration)
+	SetActiveKeys(strategy string, count int64)
+	RecordRateLimitBypass(policy string)
+	RecordRateLimitError(strategy string)
+	RecordNamespaceDecision(namespace string, allowed bool)
+	RecordBan(policy string)
+	// SetMode reports the limiter's current operating mode, one of the Mode
+	// constants.
+	SetMode(mode string)
+	// RecordShadowDecision counts how a shadow strategy's decision compared
+	// with the enforced one, as one of the Shadow outcomes.
+	RecordShadowDecision(enforced, shadow, outcome string)
+	// RecordLoadShed counts a request rejected because the node was
+	// overloaded, by the request's class ("" when unclassified).
+	RecordLoadShed(class string)
+	// SetLoadPressure reports the node's load as a fraction of the load
+	// shedder's limits.
+	SetLoadPressure(pressure float64)
+	// RecordRetryAfter observes the Retry-After a strategy gave a denied
+	// request.
+	RecordRetryAfter(strategy string, retryAfter time.Duration)
+	// SetUtilization reports how much of its limit the key of the latest
+	// decision has used, from 0 to 1.
+	SetUtilization(strategy string, utilization float64)
+	// RecordExperimentDecision counts a decision made by strategy in an arm
+	// of a strategy experiment, one of the Experiment arms.
+	RecordExperimentDecision(arm, strategy string, allowed bool)
+	// SetNamespaceQuarantined reports whether namespace's checks are served
+	// locally because its Redis keys became too slow.
+	SetNamespaceQuarantined(namespace string, quarantined bool)
+	// RecordOptimisticAllow counts a request let through because its check
+	// ran over the latency budget, by the check's late decision, one of the
+	// Optimistic outcomes.
+	RecordOptimisticAllow(outcome string)
 }
@@ -0,0 +1,11 @@
+package metrics
+
+// Operating modes reported through SetMode. Limits are approximate or not
+// applied at all in every mode but ModeEnforced.
+const (
+	ModeEnforced = "enforced"
+	ModeDegraded = "degraded"
+	ModeDryRun   = "dry-run"
+)
+
+var modes = []string{ModeEnforced, ModeDegraded, ModeDryRun}
@@ -15,4 +15,60 @@ func (n *NoopCollector) RecordRateLimitDecision(strategy string, allowed bool) {
 
 func (n *NoopCollector) RecordRateLimitDuration(strategy string, duration time.Duration) {
 	// No-op
-}
\ No newline at end of file
+}
+
+func (n *NoopCollector) SetActiveKeys(strategy string, count int64) {
+	// No-op
+}
+
+func (n *NoopCollector) RecordRateLimitBypass(policy string) {
+	// No-op
+}
+
+func (n *NoopCollector) RecordRateLimitError(strategy string) {
+	// No-op
+}
+
+func (n *NoopCollector) RecordNamespaceDecision(namespace string, allowed bool) {
+	// No-op
+}
+
+func (n *NoopCollector) RecordBan(policy string) {
+	// No-op
+}
+
+func (n *NoopCollector) RecordShadowDecision(enforced, shadow, outcome string) {
+	// No-op
+}
+
+func (n *NoopCollector) SetMode(mode string) {
+	// No-op
+}
+
+func (n *NoopCollector) RecordLoadShed(class string) {
+	// No-op
+}
+
+func (n *NoopCollector) SetLoadPressure(pressure float64) {
+	// No-op
+}
+
+func (n *NoopCollector) RecordRetryAfter(strategy string, retryAfter time.Duration) {
+	// No-op
+}
+
+func (n *NoopCollector) SetUtilization(strategy string, utilization float64) {
+	// No-op
+}
+
+func (n *NoopCollector) RecordExperimentDecision(arm, strategy string, allowed bool) {
+	// No-op
+}
+
+func (n *NoopCollector) SetNamespaceQuarantined(namespace string, quarantined bool) {
+	// No-op
+}
+
+func (n *NoopCollector) RecordOptimisticAllow(outcome string) {
+	// No-op
+}
@@ -0,0 +1,9 @@
+package metrics
+
+// Late decisions of the checks a latency budget let through optimistically,
+// reported through RecordOptimisticAllow.
+const (
+	OptimisticAllowed = "allowed"
+	OptimisticDenied  = "denied"
+	OptimisticFailed  = "error"
+)
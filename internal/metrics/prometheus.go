@@ -7,28 +7,162 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+const (
+	DecisionsMetricName   = "rate_limit_requests_total"
+	DurationMetricName    = "rate_limit_duration_seconds"
+	ErrorsMetricName      = "rate_limit_errors_total"
+	ActiveKeysMetricName  = "rate_limit_active_keys"
+	BypassedMetricName    = "rate_limit_bypassed_total"
+	NamespaceMetricName   = "rate_limit_namespace_requests_total"
+	BansMetricName        = "rate_limit_bans_total"
+	ModeMetricName        = "rate_limit_mode"
+	ShadowMetricName      = "rate_limit_shadow_decisions_total"
+	LoadShedMetricName    = "rate_limit_load_shed_total"
+	PressureMetricName    = "rate_limit_load_pressure"
+	RetryAfterMetricName  = "rate_limit_retry_after_seconds"
+	UtilizationMetricName = "rate_limit_utilization"
+	ExperimentMetricName  = "rate_limit_experiment_requests_total"
+	QuarantineMetricName  = "rate_limit_namespace_quarantined"
+	OptimisticMetricName  = "rate_limit_optimistic_allows_total"
+)
+
+// retryAfterBuckets span a token's refill up to a daily quota's reset.
+var retryAfterBuckets = []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 300, 900, 3600, 21600, 86400}
+
 type PrometheusCollector struct {
-	rateLimitDecisions *prometheus.CounterVec
-	rateLimitDuration  *prometheus.HistogramVec
+	rateLimitDecisions  *prometheus.CounterVec
+	rateLimitDuration   *prometheus.HistogramVec
+	activeKeys          *prometheus.GaugeVec
+	bypassedRequests    *prometheus.CounterVec
+	rateLimitErrors     *prometheus.CounterVec
+	namespaceDecisions  *prometheus.CounterVec
+	bans                *prometheus.CounterVec
+	mode                *prometheus.GaugeVec
+	shadowDecisions     *prometheus.CounterVec
+	loadShed            *prometheus.CounterVec
+	loadPressure        prometheus.Gauge
+	retryAfter          *prometheus.HistogramVec
+	utilization         *prometheus.GaugeVec
+	experimentDecisions *prometheus.CounterVec
+	quarantined         *prometheus.GaugeVec
+	optimisticAllows    *prometheus.CounterVec
 }
 
 func NewPrometheusCollector() *PrometheusCollector {
 	return &PrometheusCollector{
 		rateLimitDecisions: promauto.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "rate_limit_requests_total",
+				Name: DecisionsMetricName,
 				Help: "Total number of rate limit decisions by strategy and outcome",
 			},
 			[]string{"strategy", "decision"},
 		),
 		rateLimitDuration: promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
-				Name: "rate_limit_duration_seconds",
+				Name: DurationMetricName,
 				Help: "Time taken to process rate limit checks",
 				Buckets: prometheus.DefBuckets,
 			},
 			[]string{"strategy"},
 		),
+		activeKeys: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: ActiveKeysMetricName,
+				Help: "Number of rate limit keys currently stored in Redis by strategy",
+			},
+			[]string{"strategy"},
+		),
+		bypassedRequests: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: BypassedMetricName,
+				Help: "Total number of requests let through because their policy is disabled",
+			},
+			[]string{"policy"},
+		),
+		rateLimitErrors: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: ErrorsMetricName,
+				Help: "Total number of rate limit checks that failed with a backend error",
+			},
+			[]string{"strategy"},
+		),
+		namespaceDecisions: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: NamespaceMetricName,
+				Help: "Total number of rate limit decisions by namespace and outcome",
+			},
+			[]string{"namespace", "decision"},
+		),
+		bans: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: BansMetricName,
+				Help: "Total number of keys banned after repeated denials",
+			},
+			[]string{"policy"},
+		),
+		mode: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: ModeMetricName,
+				Help: "1 for the limiter's current operating mode (enforced, degraded or dry-run), 0 for the others",
+			},
+			[]string{"mode"},
+		),
+		shadowDecisions: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: ShadowMetricName,
+				Help: "Total number of shadow strategy decisions by how they compared with the enforced strategy",
+			},
+			[]string{"enforced", "shadow", "outcome"},
+		),
+		loadShed: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: LoadShedMetricName,
+				Help: "Total number of requests rejected because the node was overloaded, by request class",
+			},
+			[]string{"class"},
+		),
+		loadPressure: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: PressureMetricName,
+				Help: "Load of the node as a fraction of the load shedder's limits; 1 or more sheds all but the most important traffic",
+			},
+		),
+		retryAfter: promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    RetryAfterMetricName,
+				Help:    "Retry-After given to denied requests by strategy",
+				Buckets: retryAfterBuckets,
+			},
+			[]string{"strategy"},
+		),
+		utilization: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: UtilizationMetricName,
+				Help: "Share of its limit the key of the latest decision has used, by strategy; averaged over time, how close clients run to their limits",
+			},
+			[]string{"strategy"},
+		),
+		experimentDecisions: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: ExperimentMetricName,
+				Help: "Total number of rate limit decisions in a strategy experiment by arm, strategy and outcome",
+			},
+			[]string{"arm", "strategy", "decision"},
+		),
+		quarantined: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: QuarantineMetricName,
+				Help: "1 while a namespace's checks are served by a local limiter because its Redis keys became too slow",
+			},
+			[]string{"namespace"},
+		),
+		optimisticAllows: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: OptimisticMetricName,
+				Help: "Total number of requests let through because their check ran over the latency budget, by the check's late decision",
+			},
+			[]string{"outcome"},
+		),
 	}
 }
 
@@ -42,4 +176,102 @@ func (p *PrometheusCollector) RecordRateLimitDecision(strategy string, allowed b
 
 func (p *PrometheusCollector) RecordRateLimitDuration(strategy string, duration time.Duration) {
 	p.rateLimitDuration.WithLabelValues(strategy).Observe(duration.Seconds())
-}
\ No newline at end of file
+}
+
+func (p *PrometheusCollector) SetActiveKeys(strategy string, count int64) {
+	p.activeKeys.WithLabelValues(strategy).Set(float64(count))
+}
+
+func (p *PrometheusCollector) RecordRateLimitBypass(policy string) {
+	p.bypassedRequests.WithLabelValues(policy).Inc()
+}
+
+func (p *PrometheusCollector) RecordRateLimitError(strategy string) {
+	p.rateLimitErrors.WithLabelValues(strategy).Inc()
+}
+
+func (p *PrometheusCollector) RecordNamespaceDecision(namespace string, allowed bool) {
+	decision := "denied"
+	if allowed {
+		decision = "allowed"
+	}
+	p.namespaceDecisions.WithLabelValues(namespace, decision).Inc()
+}
+func (p *PrometheusCollector) RecordBan(policy string) {
+	p.bans.WithLabelValues(policy).Inc()
+}
+
+func (p *PrometheusCollector) SetMode(mode string) {
+	for _, candidate := range modes {
+		value := 0.0
+		if candidate == mode {
+			value = 1
+		}
+		p.mode.WithLabelValues(candidate).Set(value)
+	}
+}
+
+func (p *PrometheusCollector) RecordShadowDecision(enforced, shadow, outcome string) {
+	p.shadowDecisions.WithLabelValues(enforced, shadow, outcome).Inc()
+}
+
+func (p *PrometheusCollector) RecordLoadShed(class string) {
+	p.loadShed.WithLabelValues(class).Inc()
+}
+
+func (p *PrometheusCollector) SetLoadPressure(pressure float64) {
+	p.loadPressure.Set(pressure)
+}
+
+func (p *PrometheusCollector) RecordRetryAfter(strategy string, retryAfter time.Duration) {
+	p.retryAfter.WithLabelValues(strategy).Observe(retryAfter.Seconds())
+}
+
+func (p *PrometheusCollector) SetUtilization(strategy string, utilization float64) {
+	p.utilization.WithLabelValues(strategy).Set(utilization)
+}
+
+func (p *PrometheusCollector) RecordExperimentDecision(arm, strategy string, allowed bool) {
+	decision := "denied"
+	if allowed {
+		decision = "allowed"
+	}
+	p.experimentDecisions.WithLabelValues(arm, strategy, decision).Inc()
+}
+
+func (p *PrometheusCollector) SetNamespaceQuarantined(namespace string, quarantined bool) {
+	value := 0.0
+	if quarantined {
+		value = 1
+	}
+	p.quarantined.WithLabelValues(namespace).Set(value)
+}
+
+func (p *PrometheusCollector) RecordOptimisticAllow(outcome string) {
+	p.optimisticAllows.WithLabelValues(outcome).Inc()
+}
+
+// DecisionTotals sums rate_limit_requests_total by decision across strategies,
+// e.g. {"allowed": 120, "denied": 4}. It reads what gatherer has collected, so
+// it is empty when Prometheus is not the configured collector.
+func DecisionTotals(gatherer prometheus.Gatherer) (map[string]float64, error) {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	totals := map[string]float64{"allowed": 0, "denied": 0}
+	for _, family := range families {
+		if family.GetName() != DecisionsMetricName {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "decision" {
+					totals[label.GetValue()] += metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return totals, nil
+}
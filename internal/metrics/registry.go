@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Registry holds named collectors and routes each policy to one of them.
+// Policies without an explicit assignment use the default collector.
+type Registry struct {
+	mu          sync.RWMutex
+	collectors  map[string]Collector
+	assignments map[string]string
+	defaultName string
+}
+
+func NewRegistry(defaultName string, defaultCollector Collector) *Registry {
+	return &Registry{
+		collectors:  map[string]Collector{defaultName: defaultCollector},
+		assignments: make(map[string]string),
+		defaultName: defaultName,
+	}
+}
+
+func (r *Registry) Register(name string, collector Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors[name] = collector
+}
+
+func (r *Registry) Get(name string) (Collector, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	collector, exists := r.collectors[name]
+	return collector, exists
+}
+
+// Assign routes a policy's metrics to the named collector.
+func (r *Registry) Assign(policy string, collectorName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.collectors[collectorName]; !exists {
+		return fmt.Errorf("unknown metrics collector: %s", collectorName)
+	}
+	r.assignments[policy] = collectorName
+	return nil
+}
+
+func (r *Registry) ForPolicy(policy string) Collector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if name, assigned := r.assignments[policy]; assigned {
+		return r.collectors[name]
+	}
+	return r.collectors[r.defaultName]
+}
+
+func (r *Registry) Default() Collector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.collectors[r.defaultName]
+}
+
+// Close closes every collector holding a connection, such as StatsD's.
+func (r *Registry) Close() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return CloseCollectors(r.collectors)
+}
+
+// CloseCollectors closes the collectors holding a connection, once each
+// even when registered under several names.
+func CloseCollectors(collectors map[string]Collector) error {
+	closed := make(map[io.Closer]bool)
+	var errs []error
+	for _, collector := range collectors {
+		closer, ok := collector.(io.Closer)
+		if !ok || closed[closer] {
+			continue
+		}
+		closed[closer] = true
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,22 @@
+package metrics
+
+// Outcomes of comparing a shadow strategy's decision with the enforced one,
+// reported through RecordShadowDecision.
+const (
+	ShadowAgree    = "agree"
+	ShadowStricter = "shadow_stricter"
+	ShadowLooser   = "shadow_looser"
+	ShadowError    = "shadow_error"
+)
+
+// ShadowOutcome classifies a shadow decision against the enforced one.
+func ShadowOutcome(enforcedAllowed, shadowAllowed bool) string {
+	switch {
+	case enforcedAllowed == shadowAllowed:
+		return ShadowAgree
+	case enforcedAllowed:
+		return ShadowStricter
+	default:
+		return ShadowLooser
+	}
+}
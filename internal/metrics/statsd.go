@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// StatsdCollector emits metrics as plain StatsD lines over UDP. Writes are
+// fire-and-forget so a missing agent never slows down rate limit checks.
+// Names taken from configuration or requests, such as namespaces, are
+// sanitized so they can't break the line format.
+type StatsdCollector struct {
+	conn   net.Conn
+	prefix string
+}
+
+func NewStatsdCollector(address string, prefix string) (*StatsdCollector, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial statsd at %s: %w", address, err)
+	}
+
+	return &StatsdCollector{
+		conn:   conn,
+		prefix: prefix,
+	}, nil
+}
+
+func (s *StatsdCollector) RecordRateLimitDecision(strategy string, allowed bool) {
+	decision := "denied"
+	if allowed {
+		decision = "allowed"
+	}
+	s.send("rate_limit.requests.%s.%s:1|c", strategy, decision)
+}
+
+func (s *StatsdCollector) RecordRateLimitDuration(strategy string, duration time.Duration) {
+	s.send("rate_limit.duration.%s:%f|ms", strategy, float64(duration)/float64(time.Millisecond))
+}
+
+func (s *StatsdCollector) SetActiveKeys(strategy string, count int64) {
+	s.send("rate_limit.active_keys.%s:%d|g", strategy, count)
+}
+
+func (s *StatsdCollector) RecordRateLimitBypass(policy string) {
+	s.send("rate_limit.bypassed.%s:1|c", policy)
+}
+
+func (s *StatsdCollector) RecordRateLimitError(strategy string) {
+	s.send("rate_limit.errors.%s:1|c", strategy)
+}
+
+func (s *StatsdCollector) RecordNamespaceDecision(namespace string, allowed bool) {
+	decision := "denied"
+	if allowed {
+		decision = "allowed"
+	}
+	s.send("rate_limit.namespace.%s.%s:1|c", namespace, decision)
+}
+
+func (s *StatsdCollector) RecordBan(policy string) {
+	s.send("rate_limit.bans.%s:1|c", policy)
+}
+
+func (s *StatsdCollector) SetMode(mode string) {
+	for _, candidate := range modes {
+		value := 0
+		if candidate == mode {
+			value = 1
+		}
+		s.send("rate_limit.mode.%s:%d|g", candidate, value)
+	}
+}
+
+func (s *StatsdCollector) RecordShadowDecision(enforced, shadow, outcome string) {
+	s.send("rate_limit.shadow.%s.%s.%s:1|c", enforced, shadow, outcome)
+}
+
+func (s *StatsdCollector) RecordLoadShed(class string) {
+	if class == "" {
+		class = "unclassified"
+	}
+	s.send("rate_limit.load_shed.%s:1|c", class)
+}
+
+func (s *StatsdCollector) SetLoadPressure(pressure float64) {
+	s.send("rate_limit.load_pressure:%f|g", pressure)
+}
+
+func (s *StatsdCollector) RecordRetryAfter(strategy string, retryAfter time.Duration) {
+	s.send("rate_limit.retry_after.%s:%f|ms", strategy, float64(retryAfter)/float64(time.Millisecond))
+}
+
+func (s *StatsdCollector) SetUtilization(strategy string, utilization float64) {
+	s.send("rate_limit.utilization.%s:%f|g", strategy, utilization)
+}
+
+func (s *StatsdCollector) RecordExperimentDecision(arm, strategy string, allowed bool) {
+	decision := "denied"
+	if allowed {
+		decision = "allowed"
+	}
+	s.send("rate_limit.experiment.%s.%s.%s:1|c", arm, strategy, decision)
+}
+
+func (s *StatsdCollector) SetNamespaceQuarantined(namespace string, quarantined bool) {
+	value := 0
+	if quarantined {
+		value = 1
+	}
+	s.send("rate_limit.namespace.%s.quarantined:%d|g", namespace, value)
+}
+
+func (s *StatsdCollector) RecordOptimisticAllow(outcome string) {
+	s.send("rate_limit.optimistic.%s:1|c", outcome)
+}
+
+func (s *StatsdCollector) Close() error {
+	return s.conn.Close()
+}
+
+// send writes the line format describes, in which every string argument is
+// one segment of the metric name.
+func (s *StatsdCollector) send(format string, args ...interface{}) {
+	for i, arg := range args {
+		if segment, ok := arg.(string); ok {
+			args[i] = statsdSegment(segment)
+		}
+	}
+	_, _ = s.conn.Write([]byte(s.prefix + fmt.Sprintf(format, args...)))
+}
+
+// statsdSegment replaces the characters StatsD gives a meaning, such as '.',
+// ':' and '|', and anything else outside [A-Za-z0-9_-], with '_'.
+func statsdSegment(segment string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, segment)
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsdCollector_SanitizesNames(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	collector, err := NewStatsdCollector(listener.LocalAddr().String(), "app.")
+	require.NoError(t, err)
+
+	collector.RecordNamespaceDecision("team.a:1|c\n%d", true)
+
+	require.NoError(t, listener.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 512)
+	n, _, err := listener.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "app.rate_limit.namespace.team_a_1_c__d.allowed:1|c", string(buf[:n]))
+}
+
+func TestRegistry_CloseClosesSharedCollectorsOnce(t *testing.T) {
+	collector, err := NewStatsdCollector("127.0.0.1:8125", "")
+	require.NoError(t, err)
+
+	registry := NewRegistry("default", collector)
+	registry.Register("alias", collector)
+	registry.Register("noop", NewNoopCollector())
+
+	assert.NoError(t, registry.Close())
+	_, err = collector.conn.Write([]byte("x"))
+	assert.Error(t, err)
+}
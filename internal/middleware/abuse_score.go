@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AbuseScorer reads an external anti-abuse signal for a request, such as the
+// bot score a WAF or CDN adds as a header. ok is false when the request has
+// none.
+type AbuseScorer interface {
+	Score(c *gin.Context) (score float64, ok bool)
+}
+
+// HeaderScorer reads the score from the request header Header. Only use a
+// header the proxy in front always sets or strips, or clients can pick their
+// own score.
+type HeaderScorer struct {
+	Header string
+}
+
+func (h HeaderScorer) Score(c *gin.Context) (float64, bool) {
+	raw := strings.TrimSpace(c.GetHeader(h.Header))
+	if raw == "" {
+		return 0, false
+	}
+	score, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false
+	}
+	return score, true
+}
+
+// ScoreRange charges requests scoring from Min to Max, inclusive, Multiplier
+// times their cost.
+type ScoreRange struct {
+	Min        float64
+	Max        float64
+	Multiplier float64
+}
+
+// AbuseScoring weighs what a request is charged by its anti-abuse score, so
+// likely bots use up their limit faster than likely humans. A request is
+// charged its cost times the multiplier of the first range its score falls
+// in, rounded up to a whole request.
+type AbuseScoring struct {
+	Scorer AbuseScorer
+	Ranges []ScoreRange
+	// Unscored is the multiplier of requests without a score or with one in
+	// no range. Zero charges them their cost.
+	Unscored float64
+}
+
+const abuseScoreContextKey = "abuse_score"
+
+// Weigh returns what a request costing cost is charged. It is cost when a is
+// nil, and free requests stay free.
+func (a *AbuseScoring) Weigh(c *gin.Context, cost int64) int64 {
+	if a == nil || a.Scorer == nil || cost <= 0 {
+		return cost
+	}
+
+	multiplier := a.Unscored
+	if score, ok := a.Scorer.Score(c); ok {
+		c.Set(abuseScoreContextKey, score)
+		for _, r := range a.Ranges {
+			if score >= r.Min && score <= r.Max {
+				multiplier = r.Multiplier
+				break
+			}
+		}
+	}
+	if multiplier <= 0 {
+		return cost
+	}
+
+	weighed := math.Ceil(float64(cost) * multiplier)
+	if weighed >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return max(1, int64(weighed))
+}
+
+// GetAbuseScore returns the score AbuseScoring read for the request, if any.
+func GetAbuseScore(c *gin.Context) (float64, bool) {
+	score, ok := c.Get(abuseScoreContextKey)
+	if !ok {
+		return 0, false
+	}
+	value, ok := score.(float64)
+	return value, ok
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAbuseScoring_Weigh(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	scoring := &AbuseScoring{
+		Scorer: HeaderScorer{Header: "X-Bot-Score"},
+		Ranges: []ScoreRange{
+			{Min: 0, Max: 29, Multiplier: 5},
+			{Min: 30, Max: 100, Multiplier: 1},
+		},
+		Unscored: 1.5,
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		cost   int64
+		want   int64
+	}{
+		{name: "likely bot", header: "10", cost: 1, want: 5},
+		{name: "likely human", header: "99", cost: 3, want: 3},
+		{name: "range bounds are inclusive", header: "29", cost: 2, want: 10},
+		{name: "unscored rounds up", header: "", cost: 1, want: 2},
+		{name: "unparsable is unscored", header: "bot", cost: 2, want: 3},
+		{name: "outside every range is unscored", header: "150", cost: 4, want: 6},
+		{name: "free requests stay free", header: "10", cost: 0, want: 0},
+		{name: "huge costs are capped", header: "10", cost: math.MaxInt64, want: math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("X-Bot-Score", tt.header)
+			}
+			assert.Equal(t, tt.want, scoring.Weigh(c, tt.cost))
+		})
+	}
+
+	var disabled *AbuseScoring
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	assert.Equal(t, int64(1), disabled.Weigh(c, 1), "nil scoring charges the cost")
+}
+
+func TestRateLimitMiddleware_AbuseScoring(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockReservingRateLimiter)
+	mockLimiter.On("ReserveN", mock.Anything, "client", int64(5), mock.Anything, time.Duration(0)).Return(
+		ratelimit.Reservation{
+			RateLimitResponse: ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 5, ResetTime: time.Now().Add(time.Minute)},
+		}, nil).Once()
+	mockLimiter.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 4, ResetTime: time.Now().Add(time.Minute)}, nil).Once()
+
+	router := gin.New()
+	router.GET("/test", RateLimit(mockLimiter, &RateLimitConfig{
+		KeyExtractor: func(c *gin.Context) string { return "client" },
+		AbuseScoring: &AbuseScoring{
+			Scorer: HeaderScorer{Header: "X-Bot-Score"},
+			Ranges: []ScoreRange{{Min: 0, Max: 29, Multiplier: 5}},
+		},
+	}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-Bot-Score", "3")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "unscored requests cost one")
+
+	mockLimiter.AssertExpectations(t)
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Role is what an admin API caller may do. RoleAdmin includes RoleReadOnly.
+type Role string
+
+const (
+	RoleReadOnly Role = "read_only"
+	RoleAdmin    Role = "admin"
+
+	adminPrincipalContextKey = "admin.principal"
+)
+
+// AdminPrincipal is an authenticated admin API caller.
+type AdminPrincipal struct {
+	Name string
+	Role Role
+}
+
+type AdminAuthConfig struct {
+	// Tokens maps each bearer token to the caller it identifies.
+	Tokens map[string]AdminPrincipal
+	// ClientCerts maps the common name of a verified TLS client certificate
+	// to its role.
+	ClientCerts map[string]Role
+}
+
+type adminToken struct {
+	digest    [sha256.Size]byte
+	principal AdminPrincipal
+}
+
+// AdminAuth authenticates admin API callers by bearer token or client
+// certificate and checks their role per endpoint.
+type AdminAuth struct {
+	tokens      []adminToken
+	clientCerts map[string]Role
+}
+
+func NewAdminAuth(cfg AdminAuthConfig) (*AdminAuth, error) {
+	auth := &AdminAuth{clientCerts: make(map[string]Role, len(cfg.ClientCerts))}
+
+	for token, principal := range cfg.Tokens {
+		if token == "" {
+			return nil, fmt.Errorf("admin token for %s is empty", principal.Name)
+		}
+		if !validRole(principal.Role) {
+			return nil, fmt.Errorf("admin token for %s: unknown role %q", principal.Name, principal.Role)
+		}
+		auth.tokens = append(auth.tokens, adminToken{digest: sha256.Sum256([]byte(token)), principal: principal})
+	}
+
+	for commonName, role := range cfg.ClientCerts {
+		if !validRole(role) {
+			return nil, fmt.Errorf("client certificate %s: unknown role %q", commonName, role)
+		}
+		auth.clientCerts[commonName] = role
+	}
+
+	return auth, nil
+}
+
+// Require rejects callers without at least role: 401 when they are not
+// authenticated and 403 when their role is too low. A nil AdminAuth lets
+// every request through.
+func (a *AdminAuth) Require(role Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a == nil {
+			c.Next()
+			return
+		}
+
+		principal, ok := a.authenticate(c)
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+			abortAdminAuth(c, http.StatusUnauthorized, "Unauthorized", "a valid admin token or client certificate is required")
+			return
+		}
+		if !principal.Role.allows(role) {
+			abortAdminAuth(c, http.StatusForbidden, "Forbidden", "this endpoint requires the "+string(role)+" role")
+			return
+		}
+
+		c.Set(adminPrincipalContextKey, principal)
+		c.Next()
+	}
+}
+
+// GetAdminPrincipal returns the caller authenticated by AdminAuth.Require.
+func GetAdminPrincipal(c *gin.Context) (AdminPrincipal, bool) {
+	value, exists := c.Get(adminPrincipalContextKey)
+	if !exists {
+		return AdminPrincipal{}, false
+	}
+	principal, ok := value.(AdminPrincipal)
+	return principal, ok
+}
+
+func (a *AdminAuth) authenticate(c *gin.Context) (AdminPrincipal, bool) {
+	if token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); found {
+		// Every token is compared so timing does not reveal which one matched.
+		digest := sha256.Sum256([]byte(token))
+		var principal AdminPrincipal
+		matched := false
+		for _, candidate := range a.tokens {
+			if subtle.ConstantTimeCompare(digest[:], candidate.digest[:]) == 1 {
+				principal, matched = candidate.principal, true
+			}
+		}
+		return principal, matched
+	}
+
+	// VerifiedChains is only set when the server verified the certificate
+	// against its client CA.
+	if tls := c.Request.TLS; tls != nil && len(tls.VerifiedChains) > 0 {
+		commonName := tls.VerifiedChains[0][0].Subject.CommonName
+		if role, ok := a.clientCerts[commonName]; ok {
+			return AdminPrincipal{Name: commonName, Role: role}, true
+		}
+	}
+
+	return AdminPrincipal{}, false
+}
+
+func (r Role) allows(required Role) bool {
+	return r == RoleAdmin || r == required
+}
+
+func validRole(role Role) bool {
+	return role == RoleReadOnly || role == RoleAdmin
+}
+
+func abortAdminAuth(c *gin.Context, status int, reason, message string) {
+	AbortError(c, status, reason, message)
+}
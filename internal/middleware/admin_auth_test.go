@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAdminAuthRouter(auth *AdminAuth) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	handler := func(c *gin.Context) {
+		principal, _ := GetAdminPrincipal(c)
+		c.String(http.StatusOK, principal.Name)
+	}
+	router.GET("/admin/policies", auth.Require(RoleReadOnly), handler)
+	router.POST("/admin/reset", auth.Require(RoleAdmin), handler)
+	return router
+}
+
+func TestAdminAuth_Require(t *testing.T) {
+	auth, err := NewAdminAuth(AdminAuthConfig{
+		Tokens: map[string]AdminPrincipal{
+			"ops-token":     {Name: "ops", Role: RoleAdmin},
+			"grafana-token": {Name: "grafana", Role: RoleReadOnly},
+		},
+	})
+	require.NoError(t, err)
+	router := setupAdminAuthRouter(auth)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		authorization  string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "no credentials", method: "GET", path: "/admin/policies", expectedStatus: http.StatusUnauthorized},
+		{name: "unknown token", method: "GET", path: "/admin/policies", authorization: "Bearer guess", expectedStatus: http.StatusUnauthorized},
+		{name: "not a bearer token", method: "GET", path: "/admin/policies", authorization: "Basic ops-token", expectedStatus: http.StatusUnauthorized},
+		{name: "read only reads", method: "GET", path: "/admin/policies", authorization: "Bearer grafana-token", expectedStatus: http.StatusOK, expectedBody: "grafana"},
+		{name: "read only writes", method: "POST", path: "/admin/reset", authorization: "Bearer grafana-token", expectedStatus: http.StatusForbidden},
+		{name: "admin reads", method: "GET", path: "/admin/policies", authorization: "Bearer ops-token", expectedStatus: http.StatusOK, expectedBody: "ops"},
+		{name: "admin writes", method: "POST", path: "/admin/reset", authorization: "Bearer ops-token", expectedStatus: http.StatusOK, expectedBody: "ops"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="admin"`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAdminAuth_ClientCertificate(t *testing.T) {
+	auth, err := NewAdminAuth(AdminAuthConfig{
+		ClientCerts: map[string]Role{"monitoring.internal": RoleReadOnly},
+	})
+	require.NoError(t, err)
+	router := setupAdminAuthRouter(auth)
+
+	withCert := func(req *http.Request, commonName string, verified bool) *http.Request {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		if verified {
+			state.VerifiedChains = [][]*x509.Certificate{{cert}}
+		}
+		req.TLS = state
+		return req
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, withCert(httptest.NewRequest("GET", "/admin/policies", nil), "monitoring.internal", true))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "monitoring.internal", w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, withCert(httptest.NewRequest("POST", "/admin/reset", nil), "monitoring.internal", true))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, withCert(httptest.NewRequest("GET", "/admin/policies", nil), "monitoring.internal", false))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "unverified certificates are ignored")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, withCert(httptest.NewRequest("GET", "/admin/policies", nil), "someone.else", true))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAdminAuth_Disabled(t *testing.T) {
+	var auth *AdminAuth
+	router := setupAdminAuthRouter(auth)
+
+	req := httptest.NewRequest("POST", "/admin/reset", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestNewAdminAuth_Invalid(t *testing.T) {
+	_, err := NewAdminAuth(AdminAuthConfig{Tokens: map[string]AdminPrincipal{"": {Name: "ops", Role: RoleAdmin}}})
+	assert.Error(t, err)
+
+	_, err = NewAdminAuth(AdminAuthConfig{Tokens: map[string]AdminPrincipal{"token": {Name: "ops", Role: "root"}}})
+	assert.Error(t, err)
+
+	_, err = NewAdminAuth(AdminAuthConfig{ClientCerts: map[string]Role{"ops": "writer"}})
+	assert.Error(t, err)
+}
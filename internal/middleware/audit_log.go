@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+// RecordAudit queues the decision for the audit log if it is sampled. A nil
+// log is a no-op.
+func RecordAudit(c *gin.Context, auditLog *ratelimit.AuditLog, rateLimiter ratelimit.RateLimiter, key string, response ratelimit.RateLimitResponse) {
+	if auditLog == nil || !auditLog.Sampled(response.Allowed) {
+		return
+	}
+
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+
+	record := ratelimit.AuditRecord{
+		Time:       time.Now(),
+		RequestID:  GetRequestID(c),
+		DecisionID: GetDecisionID(c),
+		Key:        key,
+		ClientIP:   c.ClientIP(),
+		Method:     c.Request.Method,
+		Route:      route,
+		Allowed:    response.Allowed,
+		Limit:      response.Limit,
+		Remaining:  response.Remaining,
+		Metadata:   response.Metadata.Map(),
+	}
+	if named, ok := rateLimiter.(namedRateLimiter); ok {
+		record.Policy = named.Name()
+	}
+	if response.RetryAfter != nil {
+		retryAfterMs := response.RetryAfter.Milliseconds()
+		record.RetryAfterMs = &retryAfterMs
+	}
+
+	auditLog.Enqueue(record)
+}
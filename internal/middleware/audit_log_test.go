@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddleware_AuditLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var output bytes.Buffer
+	auditLog, err := ratelimit.NewAuditLog(ratelimit.AuditLogConfig{Output: &output, AllowSampleRate: 0, DenySampleRate: 1})
+	require.NoError(t, err)
+	ctx, stop := context.WithCancel(context.Background())
+	auditLog.Start(ctx)
+
+	retryAfter := 2 * time.Second
+	mockLimiter := &MockRateLimiter{}
+	mockLimiter.On("IsAllowed", mock.Anything, "allowed-client", mock.Anything).Return(ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 9}, nil)
+	mockLimiter.On("IsAllowed", mock.Anything, "denied-client", mock.Anything).Return(ratelimit.RateLimitResponse{
+		Allowed:    false,
+		Limit:      10,
+		RetryAfter: &retryAfter,
+		Metadata:   ratelimit.MetadataOf(map[string]interface{}{"strategy": "token_bucket"}),
+	}, nil)
+
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/api/items/:id", RateLimit(mockLimiter, &RateLimitConfig{AuditLog: auditLog}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	var decisionID string
+	for _, client := range []string{"allowed-client", "denied-client"} {
+		req := httptest.NewRequest("GET", "/api/items/7", nil)
+		req.Header.Set("X-Client-ID", client)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		decisionID = w.Header().Get(DecisionIDHeader)
+	}
+	stop()
+	<-auditLog.Done()
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 1, "allowed requests are not sampled at rate 0")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "denied-client", record["key"])
+	assert.Equal(t, "/api/items/:id", record["route"])
+	assert.Equal(t, false, record["allowed"])
+	assert.Equal(t, float64(2000), record["retry_after_ms"])
+	assert.Equal(t, "token_bucket", record["metadata"].(map[string]interface{})["strategy"])
+	assert.NotEmpty(t, record["request_id"])
+	assert.Equal(t, decisionID, record["decision_id"], "the audit log finds the decision a customer quotes")
+}
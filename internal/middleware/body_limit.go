@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BodyLimitConfig struct {
+	MaxBytes     int64
+	MaxJSONDepth int
+}
+
+var errJSONTooDeep = errors.New("json nesting too deep")
+
+// BodyLimit caps request bodies at MaxBytes and rejects JSON payloads nested
+// deeper than MaxJSONDepth. Both checks respond with 413.
+func BodyLimit(cfg BodyLimitConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		if cfg.MaxBytes > 0 {
+			if c.Request.ContentLength > cfg.MaxBytes {
+				abortBodyTooLarge(c, fmt.Sprintf("request body exceeds %d bytes", cfg.MaxBytes), cfg.MaxBytes)
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.MaxBytes)
+		}
+
+		if cfg.MaxJSONDepth > 0 && isJSONRequest(c.Request) {
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					abortBodyTooLarge(c, fmt.Sprintf("request body exceeds %d bytes", cfg.MaxBytes), cfg.MaxBytes)
+					return
+				}
+				AbortError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+				return
+			}
+
+			if err := checkJSONDepth(body, cfg.MaxJSONDepth); errors.Is(err, errJSONTooDeep) {
+				abortBodyTooLarge(c, fmt.Sprintf("json nesting exceeds depth %d", cfg.MaxJSONDepth), cfg.MaxBytes)
+				return
+			}
+
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		c.Next()
+	}
+}
+
+func abortBodyTooLarge(c *gin.Context, message string, limit int64) {
+	body := NewErrorResponse(c, http.StatusRequestEntityTooLarge, "Request too large", message)
+	if limit > 0 {
+		body.Details = map[string]interface{}{"limit_bytes": limit}
+	}
+	WriteError(c, http.StatusRequestEntityTooLarge, body)
+	c.Abort()
+}
+
+// isJSONRequest reports whether the request declares a JSON body, as
+// application/json or a +json type such as application/problem+json.
+// Bodies without a Content-Type aren't assumed to be JSON.
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// checkJSONDepth walks the token stream and fails once nesting passes maxDepth.
+// Malformed JSON is left for the handler's own binding to report.
+func checkJSONDepth(body []byte, maxDepth int) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	depth := 0
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+
+		delim, ok := token.(json.Delim)
+		if !ok {
+			continue
+		}
+
+		switch delim {
+		case '{', '[':
+			depth++
+			if depth > maxDepth {
+				return errJSONTooDeep
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+}
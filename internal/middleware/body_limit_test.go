@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupBodyLimitRouter(cfg BodyLimitConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(BodyLimit(cfg))
+	router.POST("/test", func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.String(http.StatusOK, string(body))
+	})
+	return router
+}
+
+func TestBodyLimit_WithinLimits(t *testing.T) {
+	router := setupBodyLimitRouter(BodyLimitConfig{MaxBytes: 64, MaxJSONDepth: 3})
+
+	req := httptest.NewRequest("POST", "/test", strings.NewReader(`{"a":{"b":[1]}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"a":{"b":[1]}}`, w.Body.String())
+}
+
+func TestBodyLimit_TooLarge(t *testing.T) {
+	router := setupBodyLimitRouter(BodyLimitConfig{MaxBytes: 8})
+
+	req := httptest.NewRequest("POST", "/test", strings.NewReader(`{"key":"0123456789"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "Request too large")
+	assert.Contains(t, w.Body.String(), `"limit_bytes":8`)
+}
+
+func TestBodyLimit_TooLargeWithoutContentLength(t *testing.T) {
+	router := setupBodyLimitRouter(BodyLimitConfig{MaxBytes: 8, MaxJSONDepth: 10})
+
+	req := httptest.NewRequest("POST", "/test", strings.NewReader(`{"key":"0123456789"}`))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestBodyLimit_TooDeep(t *testing.T) {
+	router := setupBodyLimitRouter(BodyLimitConfig{MaxBytes: 1024, MaxJSONDepth: 2})
+
+	req := httptest.NewRequest("POST", "/test", strings.NewReader(`{"a":{"b":{"c":1}}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "json nesting exceeds depth 2")
+}
+
+func TestBodyLimit_DepthOnlyCheckedForJSON(t *testing.T) {
+	router := setupBodyLimitRouter(BodyLimitConfig{MaxBytes: 1024, MaxJSONDepth: 2})
+	body := `{"a":{"b":{"c":1}}}`
+
+	for contentType, want := range map[string]int{
+		"":                         http.StatusOK,
+		"text/plain":               http.StatusOK,
+		"application/problem+json": http.StatusRequestEntityTooLarge,
+		"Application/JSON":         http.StatusRequestEntityTooLarge,
+	} {
+		req := httptest.NewRequest("POST", "/test", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, want, w.Code, "content type %q", contentType)
+	}
+}
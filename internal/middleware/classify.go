@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+const (
+	ClassHeader     = "X-RateLimit-Class"
+	classContextKey = "ratelimit.class"
+)
+
+// Classes the built-in classifiers assign.
+const (
+	ClassBot       = "bot"
+	ClassInternal  = "internal"
+	ClassPartner   = "partner"
+	ClassAnonymous = "anonymous"
+)
+
+// Classifier tags a request with a class, such as ClassBot, or returns an
+// empty string to leave it unclassified.
+type Classifier interface {
+	Classify(c *gin.Context) string
+}
+
+type ClassifierFunc func(c *gin.Context) string
+
+func (f ClassifierFunc) Classify(c *gin.Context) string {
+	return f(c)
+}
+
+// Classifiers asks each classifier in turn; the first class returned wins.
+type Classifiers []Classifier
+
+func (cs Classifiers) Classify(c *gin.Context) string {
+	for _, classifier := range cs {
+		if class := classifier.Classify(c); class != "" {
+			return class
+		}
+	}
+	return ""
+}
+
+// DefaultBotUserAgents are the User-Agent substrings UserAgentClassifier
+// treats as automated clients when none are configured.
+var DefaultBotUserAgents = []string{
+	"bot", "crawler", "spider", "scraper", "slurp", "headless",
+	"curl", "wget", "python-requests", "go-http-client", "okhttp",
+}
+
+// UserAgentClassifier is a heuristic bot detector: a request is ClassBot if
+// its User-Agent is missing or contains one of the patterns, ignoring case.
+// Clients can send any User-Agent, so it only catches bots that don't hide.
+type UserAgentClassifier struct {
+	patterns []string
+}
+
+func NewUserAgentClassifier(patterns []string) *UserAgentClassifier {
+	if len(patterns) == 0 {
+		patterns = DefaultBotUserAgents
+	}
+	lowered := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern != "" {
+			lowered = append(lowered, strings.ToLower(pattern))
+		}
+	}
+	return &UserAgentClassifier{patterns: lowered}
+}
+
+func (u *UserAgentClassifier) Classify(c *gin.Context) string {
+	userAgent := strings.ToLower(c.Request.UserAgent())
+	if userAgent == "" || containsAny(userAgent, u.patterns) {
+		return ClassBot
+	}
+	return ""
+}
+
+// ClassMatch assigns Class to requests matching every non-empty field; within
+// a field any entry may match.
+type ClassMatch struct {
+	Class string
+	// Headers maps a header name to its required value; an empty value only
+	// requires the header to be present.
+	Headers map[string]string
+	CIDRs   []netip.Prefix
+	// UserAgents are case-insensitive User-Agent substrings.
+	UserAgents []string
+}
+
+func (m ClassMatch) matches(c *gin.Context) bool {
+	for name, want := range m.Headers {
+		values, present := c.Request.Header[http.CanonicalHeaderKey(name)]
+		if !present || (want != "" && (len(values) == 0 || values[0] != want)) {
+			return false
+		}
+	}
+	if len(m.CIDRs) > 0 {
+		addr, err := netip.ParseAddr(c.ClientIP())
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		contained := false
+		for _, prefix := range m.CIDRs {
+			if prefix.Contains(addr) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			return false
+		}
+	}
+	if len(m.UserAgents) > 0 && !containsAny(strings.ToLower(c.Request.UserAgent()), m.UserAgents) {
+		return false
+	}
+	return true
+}
+
+// MatchClassifier returns the class of the first matching entry, e.g.
+// ClassInternal for the office CIDRs or ClassPartner for requests carrying a
+// partner header set by the gateway.
+type MatchClassifier []ClassMatch
+
+func NewMatchClassifier(matches []ClassMatch) MatchClassifier {
+	classifier := make(MatchClassifier, len(matches))
+	for i, match := range matches {
+		match.UserAgents = lowerAll(match.UserAgents)
+		classifier[i] = match
+	}
+	return classifier
+}
+
+func (mc MatchClassifier) Classify(c *gin.Context) string {
+	for _, match := range mc {
+		if match.matches(c) {
+			return match.Class
+		}
+	}
+	return ""
+}
+
+// AnonymousClassifier returns ClassAnonymous for requests carrying none of
+// the credential headers, such as Authorization or X-Client-ID. Without
+// headers it classifies nothing.
+type AnonymousClassifier []string
+
+func (a AnonymousClassifier) Classify(c *gin.Context) string {
+	if len(a) == 0 {
+		return ""
+	}
+	for _, header := range a {
+		if c.GetHeader(header) != "" {
+			return ""
+		}
+	}
+	return ClassAnonymous
+}
+
+// Classify tags each request with classifier's class, so later middleware
+// and handlers can read it with GetClass. The class is also returned in
+// X-RateLimit-Class.
+func Classify(classifier Classifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if class := classifier.Classify(c); class != "" {
+			c.Set(classContextKey, class)
+			c.Header(ClassHeader, class)
+		}
+		c.Next()
+	}
+}
+
+// GetClass returns the class set by Classify, or an empty string.
+func GetClass(c *gin.Context) string {
+	return c.GetString(classContextKey)
+}
+
+// ClassProfile is how ClassRateLimit limits one class.
+type ClassProfile struct {
+	Policy *ratelimit.Policy
+	// Configure adjusts the class's copy of the middleware config, e.g. to
+	// key requests differently; nil keeps it as is.
+	Configure func(config *RateLimitConfig)
+}
+
+// ClassRateLimit limits each class with its profile, and unclassified
+// requests, or classes without a profile, with fallback. Requests a rule
+// already decided pass through, so it can follow Rules as that middleware's
+// fallback.
+func ClassRateLimit(profiles map[string]ClassProfile, fallback ratelimit.RateLimiter, config *RateLimitConfig) gin.HandlerFunc {
+	if config == nil {
+		config = &RateLimitConfig{}
+	}
+
+	limiters := make(map[string]gin.HandlerFunc, len(profiles))
+	for class, profile := range profiles {
+		classConfig := *config
+		if profile.Configure != nil {
+			profile.Configure(&classConfig)
+		}
+		limiters[class] = RateLimit(profile.Policy, &classConfig)
+	}
+	fallbackConfig := *config
+	fallbackLimiter := RateLimit(fallback, &fallbackConfig)
+
+	return func(c *gin.Context) {
+		if GetRule(c) != "" {
+			c.Next()
+			return
+		}
+		if limiter, ok := limiters[GetClass(c)]; ok {
+			limiter(c)
+			return
+		}
+		fallbackLimiter(c)
+	}
+}
+
+func containsAny(value string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(value, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, value := range values {
+		lowered[i] = strings.ToLower(value)
+	}
+	return lowered
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/pmujumdar27/go-rate-limiter/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func classifyRequest(classifier Classifier, configure func(req *http.Request)) string {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Classify(classifier))
+	router.GET("/test", func(c *gin.Context) {
+		c.String(http.StatusOK, GetClass(c))
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.RemoteAddr = "203.0.113.7:1234"
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	configure(req)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestUserAgentClassifier(t *testing.T) {
+	classifier := NewUserAgentClassifier(nil)
+
+	for userAgent, want := range map[string]string{
+		"Mozilla/5.0 (X11; Linux x86_64)":         "",
+		"Mozilla/5.0 (compatible; Googlebot/2.1)": ClassBot,
+		"curl/8.4.0": ClassBot,
+		"Mozilla/5.0 HeadlessChrome/120.0.0.0 Safari/537.36": ClassBot,
+		"": ClassBot,
+	} {
+		t.Run(userAgent, func(t *testing.T) {
+			class := classifyRequest(classifier, func(req *http.Request) {
+				req.Header.Set("User-Agent", userAgent)
+			})
+			assert.Equal(t, want, class)
+		})
+	}
+
+	custom := NewUserAgentClassifier([]string{"MyScraper"})
+	assert.Equal(t, ClassBot, classifyRequest(custom, func(req *http.Request) {
+		req.Header.Set("User-Agent", "myscraper/1.0")
+	}))
+	assert.Empty(t, classifyRequest(custom, func(req *http.Request) {
+		req.Header.Set("User-Agent", "curl/8.4.0")
+	}), "configured patterns replace the defaults")
+}
+
+func TestClassifiers_FirstClassWins(t *testing.T) {
+	classifier := Classifiers{
+		NewMatchClassifier([]ClassMatch{
+			{Class: ClassInternal, CIDRs: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+			{Class: ClassPartner, Headers: map[string]string{"X-Partner-ID": ""}},
+			{Class: "monitoring", UserAgents: []string{"UptimeRobot"}},
+		}),
+		NewUserAgentClassifier(nil),
+		AnonymousClassifier{"Authorization", "X-Client-ID"},
+	}
+
+	tests := []struct {
+		name      string
+		configure func(req *http.Request)
+		want      string
+	}{
+		{"internal address", func(req *http.Request) { req.RemoteAddr = "10.1.2.3:1234" }, ClassInternal},
+		{"partner header", func(req *http.Request) { req.Header.Set("X-Partner-ID", "acme") }, ClassPartner},
+		{"matched before the bot heuristic", func(req *http.Request) {
+			req.Header.Set("User-Agent", "Mozilla/5.0+(compatible; UptimeRobot/2.0)")
+		}, "monitoring"},
+		{"bot", func(req *http.Request) { req.Header.Set("User-Agent", "python-requests/2.31") }, ClassBot},
+		{"anonymous", func(req *http.Request) {}, ClassAnonymous},
+		{"credentialed", func(req *http.Request) { req.Header.Set("X-Client-ID", "client-1") }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, classifyRequest(classifier, tt.configure))
+		})
+	}
+
+	assert.Empty(t, classifyRequest(AnonymousClassifier(nil), func(req *http.Request) {}),
+		"no credential headers disables the anonymous class")
+}
+
+func TestClassRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	botLimiter := new(MockRateLimiter)
+	botLimiter.On("IsAllowed", mock.Anything, "client-1", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: false, Limit: 1, ResetTime: time.Now().Add(time.Minute)}, nil).Once()
+	fallbackLimiter := new(MockRateLimiter)
+	fallbackLimiter.On("IsAllowed", mock.Anything, "client-1", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 9, ResetTime: time.Now().Add(time.Minute)}, nil).Once()
+
+	engine := rules.NewEngine("")
+	require.NoError(t, engine.Add(rules.Rule{Name: "health", Match: rules.Matcher{Paths: []string{"/health"}}, Action: rules.ActionBypass}))
+
+	router := gin.New()
+	router.Use(
+		Classify(NewUserAgentClassifier(nil)),
+		Rules(engine, nil, nil),
+		ClassRateLimit(map[string]ClassProfile{
+			ClassBot: {Policy: ratelimit.NewPolicy("class:bot", botLimiter, nil)},
+		}, fallbackLimiter, nil),
+	)
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	router.GET("/health", ok)
+	router.GET("/items", ok)
+
+	serve := func(path, userAgent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Client-ID", "client-1")
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("/items", "curl/8.4.0")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, ClassBot, w.Header().Get(ClassHeader))
+
+	w = serve("/items", "Mozilla/5.0")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("RateLimit-Limit"))
+	assert.Empty(t, w.Header().Get(ClassHeader))
+
+	w = serve("/health", "curl/8.4.0")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"), "requests a rule decided skip the class limit")
+
+	botLimiter.AssertExpectations(t)
+	fallbackLimiter.AssertExpectations(t)
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultClientIPHeaders is the header precedence used when none is configured.
+var DefaultClientIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+type ClientIPConfig struct {
+	// TrustedProxies lists the CIDRs (or single IPs) allowed to set client IP
+	// headers. When empty the headers are ignored and the peer address is the
+	// client, so callers can't pick their own rate-limit key.
+	TrustedProxies []string
+	// Headers are consulted in order, e.g. CF-Connecting-IP before
+	// X-Forwarded-For when behind Cloudflare.
+	Headers []string
+}
+
+// ConfigureClientIP makes c.ClientIP() honour forwarding headers only from
+// trusted proxies. The handlers and the middleware key extractors all key
+// anonymous traffic by ClientKeyIP, which builds on c.ClientIP(), so this
+// applies to every path.
+func ConfigureClientIP(engine *gin.Engine, cfg ClientIPConfig) error {
+	configured := cfg.Headers
+	if len(configured) == 0 {
+		configured = DefaultClientIPHeaders
+	}
+	headers := make([]string, 0, len(configured))
+	for i, header := range configured {
+		if header == "" {
+			return fmt.Errorf("client ip header %d is empty", i)
+		}
+		headers = append(headers, http.CanonicalHeaderKey(header))
+	}
+
+	if err := engine.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("trusted proxies: %w", err)
+	}
+	engine.ForwardedByClientIP = len(cfg.TrustedProxies) > 0
+	engine.RemoteIPHeaders = headers
+	return nil
+}
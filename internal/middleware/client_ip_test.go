@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func clientIPRouter(t *testing.T, cfg ClientIPConfig) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	require.NoError(t, ConfigureClientIP(router, cfg))
+	router.GET("/ip", func(c *gin.Context) {
+		c.String(http.StatusOK, defaultKeyExtractor(c))
+	})
+	return router
+}
+
+func requestClientIP(router *gin.Engine, remoteAddr string, headers map[string]string) string {
+	req := httptest.NewRequest("GET", "/ip", nil)
+	req.RemoteAddr = remoteAddr
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestConfigureClientIP_NoTrustedProxies(t *testing.T) {
+	router := clientIPRouter(t, ClientIPConfig{})
+
+	ip := requestClientIP(router, "203.0.113.5:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"})
+	assert.Equal(t, "203.0.113.5", ip, "forwarding headers are ignored without trusted proxies")
+}
+
+func TestConfigureClientIP_TrustedProxy(t *testing.T) {
+	router := clientIPRouter(t, ClientIPConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+
+	ip := requestClientIP(router, "10.1.1.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, 10.2.2.2"})
+	assert.Equal(t, "1.2.3.4", ip, "trusted hops are skipped from the right")
+
+	ip = requestClientIP(router, "203.0.113.5:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"})
+	assert.Equal(t, "203.0.113.5", ip, "untrusted peers can't spoof the header")
+
+	ip = requestClientIP(router, "10.1.1.1:1234", map[string]string{"X-Forwarded-For": "5.6.7.8, 1.2.3.4"})
+	assert.Equal(t, "1.2.3.4", ip, "values prepended by the client are ignored")
+}
+
+func TestConfigureClientIP_HeaderPrecedence(t *testing.T) {
+	router := clientIPRouter(t, ClientIPConfig{
+		TrustedProxies: []string{"10.0.0.1"},
+		Headers:        []string{"cf-connecting-ip", "X-Forwarded-For"},
+	})
+
+	ip := requestClientIP(router, "10.0.0.1:1234", map[string]string{
+		"CF-Connecting-IP": "9.9.9.9",
+		"X-Forwarded-For":  "1.2.3.4",
+	})
+	assert.Equal(t, "9.9.9.9", ip)
+}
+
+func TestConfigureClientIP_InvalidProxy(t *testing.T) {
+	assert.Error(t, ConfigureClientIP(gin.New(), ClientIPConfig{TrustedProxies: []string{"not-a-cidr"}}))
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+const connectionContextKey = "ratelimit.connection"
+
+// IsWebSocketUpgrade reports whether r asks to switch to the WebSocket
+// protocol.
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") &&
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ConnectionLimit admits WebSocket upgrades while the key holds fewer than
+// the limiter's maximum connections, and keeps the slot until the handler
+// serving the connection returns. Handlers check each message with
+// GetConnection(c).AllowMessage. Other requests pass through untouched.
+func ConnectionLimit(limiter *ratelimit.ConnectionLimiter, keyExtractor func(c *gin.Context) string) gin.HandlerFunc {
+	if keyExtractor == nil {
+		keyExtractor = defaultKeyExtractor
+	}
+
+	return func(c *gin.Context) {
+		if !IsWebSocketUpgrade(c.Request) {
+			c.Next()
+			return
+		}
+
+		key := keyExtractor(c)
+		ctx, cancel := LimiterContext(c, DefaultLimiterTimeout)
+		ctx = WithDecisionID(c, ctx)
+		connection, response, err := limiter.Acquire(ctx, key, time.Now())
+		cancel()
+		if err != nil {
+			LogRateLimitError(c, key, err)
+			AbortError(c, http.StatusInternalServerError, "Connection limiter error", err.Error())
+			return
+		}
+
+		SetRateLimitHeaders(c, response)
+		setDecision(c, response)
+		if connection == nil {
+			LogRateLimitDenied(c, key, response)
+			AbortError(c, http.StatusTooManyRequests, "Connection limit exceeded", "Too many open connections")
+			return
+		}
+
+		// The connection outlives the upgrade request's context, which
+		// hijacking ends, so the slot is released with a fresh one.
+		defer func() {
+			releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), DefaultLimiterTimeout)
+			defer cancel()
+			if err := connection.Release(releaseCtx); err != nil {
+				slog.Error("failed to release connection",
+					"request_id", GetRequestID(c),
+					"key", key,
+					"connection", connection.ID,
+					"error", err.Error(),
+				)
+			}
+		}()
+
+		c.Set(connectionContextKey, connection)
+		c.Next()
+	}
+}
+
+// GetConnection returns the connection admitted by ConnectionLimit, or nil
+// for requests that weren't upgrades.
+func GetConnection(c *gin.Context) *ratelimit.Connection {
+	connection, _ := c.Get(connectionContextKey)
+	limited, _ := connection.(*ratelimit.Connection)
+	return limited
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func upgradeRequest() *http.Request {
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	return req
+}
+
+func TestIsWebSocketUpgrade(t *testing.T) {
+	assert.True(t, IsWebSocketUpgrade(upgradeRequest()))
+	assert.False(t, IsWebSocketUpgrade(httptest.NewRequest("GET", "/ws", nil)))
+
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Upgrade", "websocket")
+	assert.False(t, IsWebSocketUpgrade(req), "Upgrade without Connection: upgrade is ignored")
+}
+
+func TestConnectionLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	limiter, err := ratelimit.NewConnectionLimiter(ratelimit.ConnectionLimiterConfig{
+		KeyPrefix:            "test:conn",
+		MaxConnections:       1,
+		MessageBucketSize:    1,
+		MessageRatePerSecond: 1,
+	}, client)
+	require.NoError(t, err)
+
+	open := make(chan struct{})
+	closeConnection := make(chan struct{})
+	router := gin.New()
+	router.GET("/ws", ConnectionLimit(limiter, func(c *gin.Context) string { return "client" }), func(c *gin.Context) {
+		connection := GetConnection(c)
+		if connection == nil {
+			c.Status(http.StatusOK)
+			return
+		}
+		assert.True(t, connection.AllowMessage(time.Now()).Allowed)
+		assert.False(t, connection.AllowMessage(time.Now()).Allowed)
+		close(open)
+		<-closeConnection
+		c.Status(http.StatusSwitchingProtocols)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router.ServeHTTP(httptest.NewRecorder(), upgradeRequest())
+	}()
+	<-open
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, upgradeRequest())
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/ws", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "plain requests are not connections")
+
+	close(closeConnection)
+	<-done
+	count, err := limiter.Count(context.Background(), "client", time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+// Crawler is a well-known crawler, such as Googlebot, limited apart from
+// human traffic. All of its requests share one budget, since a crawler
+// spreads its requests over many addresses but honours a crawl delay per site.
+type Crawler struct {
+	// Name is the crawler's class and its robots.txt user-agent token.
+	Name string
+	// UserAgents are case-insensitive User-Agent substrings.
+	UserAgents []string
+	// CIDRs, when set, are the only addresses the crawler is accepted from,
+	// so a client claiming its User-Agent can't use up its budget.
+	CIDRs      []netip.Prefix
+	CrawlDelay time.Duration
+	Policy     *ratelimit.Policy
+}
+
+// CrawlerClassifier classifies requests from the crawlers by their name.
+type CrawlerClassifier struct {
+	crawlers []Crawler
+}
+
+func NewCrawlerClassifier(crawlers []Crawler) *CrawlerClassifier {
+	classifier := &CrawlerClassifier{crawlers: make([]Crawler, len(crawlers))}
+	for i, crawler := range crawlers {
+		crawler.UserAgents = lowerAll(crawler.UserAgents)
+		classifier.crawlers[i] = crawler
+	}
+	return classifier
+}
+
+func (cc *CrawlerClassifier) Classify(c *gin.Context) string {
+	userAgent := strings.ToLower(c.Request.UserAgent())
+	if userAgent == "" {
+		return ""
+	}
+	for _, crawler := range cc.crawlers {
+		if !containsAny(userAgent, crawler.UserAgents) {
+			continue
+		}
+		match := ClassMatch{CIDRs: crawler.CIDRs}
+		if match.matches(c) {
+			return crawler.Name
+		}
+	}
+	return ""
+}
+
+// Profiles limits each crawler with its policy, keyed by the crawler's name,
+// and tells it to retry no sooner than its crawl delay.
+func (cc *CrawlerClassifier) Profiles() map[string]ClassProfile {
+	profiles := make(map[string]ClassProfile, len(cc.crawlers))
+	for _, crawler := range cc.crawlers {
+		profiles[crawler.Name] = ClassProfile{
+			Policy: crawler.Policy,
+			Configure: func(config *RateLimitConfig) {
+				config.KeyExtractor = func(*gin.Context) string { return crawler.Name }
+				config.KeyByRoute = false
+				config.OnLimitReached = crawlDelayLimitReached(crawler.CrawlDelay)
+			},
+		}
+	}
+	return profiles
+}
+
+// crawlDelayLimitReached rejects a crawler with a Retry-After of at least
+// delay. Crawlers back off on 429s, so a delay they can act on keeps them
+// from coming back every second.
+func crawlDelayLimitReached(delay time.Duration) func(c *gin.Context, response ratelimit.RateLimitResponse) {
+	return func(c *gin.Context, response ratelimit.RateLimitResponse) {
+		retryAfter := delay
+		if response.RetryAfter != nil && *response.RetryAfter > retryAfter {
+			retryAfter = *response.RetryAfter
+		}
+		SetRetryAfter(c, retryAfter)
+		body := NewErrorResponse(c, http.StatusTooManyRequests, "Rate limit exceeded", "Crawl delay not respected").WithRetryAfter(retryAfter)
+		WriteError(c, http.StatusTooManyRequests, body)
+		c.Abort()
+	}
+}
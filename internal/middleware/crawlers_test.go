@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCrawlerClassifier(t *testing.T) {
+	classifier := NewCrawlerClassifier([]Crawler{
+		{Name: "Googlebot", UserAgents: []string{"Googlebot"}, CIDRs: []netip.Prefix{netip.MustParsePrefix("66.249.64.0/19")}},
+		{Name: "bingbot", UserAgents: []string{"bingbot"}},
+	})
+
+	tests := []struct {
+		name, userAgent, remoteAddr, want string
+	}{
+		{"verified googlebot", "Mozilla/5.0 (compatible; Googlebot/2.1)", "66.249.66.1:1234", "Googlebot"},
+		{"googlebot from elsewhere", "Mozilla/5.0 (compatible; Googlebot/2.1)", "203.0.113.7:1234", ""},
+		{"bingbot anywhere", "Mozilla/5.0 (compatible; bingbot/2.0)", "203.0.113.7:1234", "bingbot"},
+		{"human", "Mozilla/5.0 (X11; Linux x86_64)", "66.249.66.1:1234", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class := classifyRequest(classifier, func(req *http.Request) {
+				req.Header.Set("User-Agent", tt.userAgent)
+				req.RemoteAddr = tt.remoteAddr
+			})
+			assert.Equal(t, tt.want, class)
+		})
+	}
+}
+
+func TestCrawlerProfiles_SharedKeyAndCrawlDelay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	retryAfter := 200 * time.Millisecond
+	crawlerLimiter := new(MockRateLimiter)
+	crawlerLimiter.On("IsAllowed", mock.Anything, "bingbot", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 1, ResetTime: time.Now().Add(time.Second)}, nil).Once()
+	crawlerLimiter.On("IsAllowed", mock.Anything, "bingbot", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: false, Limit: 1, ResetTime: time.Now().Add(retryAfter), RetryAfter: &retryAfter}, nil).Once()
+	humanLimiter := new(MockRateLimiter)
+	humanLimiter.On("IsAllowed", mock.Anything, "client-1:GET:/page/:id", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 9, ResetTime: time.Now().Add(time.Minute)}, nil).Once()
+
+	classifier := NewCrawlerClassifier([]Crawler{{
+		Name:       "bingbot",
+		UserAgents: []string{"bingbot"},
+		CrawlDelay: 5 * time.Second,
+		Policy:     ratelimit.NewPolicy("crawler:bingbot", crawlerLimiter, nil),
+	}})
+	router := gin.New()
+	router.Use(Classify(classifier), ClassRateLimit(classifier.Profiles(), humanLimiter, &RateLimitConfig{KeyByRoute: true}))
+	router.GET("/page/:id", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	serve := func(path, userAgent, clientID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("X-Client-ID", clientID)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	crawler := "Mozilla/5.0 (compatible; bingbot/2.0)"
+	w := serve("/page/1", crawler, "crawler-ip-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve("/page/2", crawler, "crawler-ip-2")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"), "crawlers wait at least the crawl delay")
+	assert.Contains(t, w.Body.String(), "Crawl delay not respected")
+
+	w = serve("/page/1", "Mozilla/5.0", "client-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("RateLimit-Limit"))
+
+	crawlerLimiter.AssertExpectations(t)
+	humanLimiter.AssertExpectations(t)
+}
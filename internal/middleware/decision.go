@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+// DecisionIDHeader carries the ID of the request's rate limit decision, which
+// customers can quote to support to find it in the logs and the audit log.
+const DecisionIDHeader = "X-RateLimit-Decision-Id"
+
+const (
+	decisionContextKey   = "ratelimit.decision"
+	decisionIDContextKey = "ratelimit.decision_id"
+)
+
+// WithDecisionID assigns a new ID to the rate limit decision about to be made
+// for c with ctx. It is returned in the X-RateLimit-Decision-Id header, and
+// ctx carries it to the decision stream. When several limiters decide a
+// request, the last one's ID wins, as with GetDecision.
+func WithDecisionID(c *gin.Context, ctx context.Context) context.Context {
+	id := newRequestID()
+	c.Set(decisionIDContextKey, id)
+	c.Header(DecisionIDHeader, id)
+	return ratelimit.WithDecisionID(ctx, id)
+}
+
+// GetDecisionID returns the ID of the request's latest rate limit decision,
+// or an empty string when no limiter decided it.
+func GetDecisionID(c *gin.Context) string {
+	return c.GetString(decisionIDContextKey)
+}
+
+// setDecision stores response for handlers further down the chain. When
+// several limiters decide a request, the last one wins.
+func setDecision(c *gin.Context, response ratelimit.RateLimitResponse) {
+	c.Set(decisionContextKey, response)
+}
+
+// GetDecision returns the rate limit decision for the request, so handlers can
+// reflect the remaining quota in their responses or act on it. It reports
+// false for requests no limiter decided, e.g. because the limiter failed open.
+func GetDecision(c *gin.Context) (ratelimit.RateLimitResponse, bool) {
+	value, exists := c.Get(decisionContextKey)
+	response, ok := value.(ratelimit.RateLimitResponse)
+	return response, exists && ok
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetDecision(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRateLimiter)
+	mockLimiter.On("IsAllowed", mock.Anything, mock.Anything, mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 4, ResetTime: time.Now().Add(time.Minute)}, nil)
+
+	remaining := func(c *gin.Context) {
+		decision, ok := GetDecision(c)
+		if !ok {
+			c.String(http.StatusOK, "undecided")
+			return
+		}
+		c.String(http.StatusOK, strconv.FormatInt(decision.Remaining, 10))
+	}
+	router := gin.New()
+	router.GET("/limited", RateLimit(mockLimiter), remaining)
+	router.GET("/open", remaining)
+
+	for path, want := range map[string]string{"/limited": "4", "/open": "undecided"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, want, w.Body.String(), path)
+	}
+}
+
+func TestWithDecisionID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRateLimiter)
+	mockLimiter.On("IsAllowed", mock.Anything, mock.Anything, mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: false, Limit: 10, ResetTime: time.Now().Add(time.Minute)}, nil)
+
+	router := gin.New()
+	router.GET("/limited", RateLimit(mockLimiter), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	ids := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/limited", nil))
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+		id := w.Header().Get(DecisionIDHeader)
+		assert.NotEmpty(t, id)
+		assert.Contains(t, w.Body.String(), `"decision_id":"`+id+`"`, "the body quotes the header")
+		ids[id] = true
+	}
+	assert.Len(t, ids, 2, "every decision gets its own ID")
+
+	mockLimiter.AssertCalled(t, "IsAllowed", mock.MatchedBy(func(ctx context.Context) bool {
+		return ratelimit.DecisionIDFromContext(ctx) != ""
+	}), mock.Anything, mock.Anything)
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+type namedRateLimiter interface {
+	Name() string
+}
+
+// RecordDenial queues a summary of a denied request for the denial log
+// without blocking the response. A nil log is a no-op.
+func RecordDenial(c *gin.Context, denialLog *ratelimit.DenialLog, rateLimiter ratelimit.RateLimiter, key string) {
+	if denialLog == nil {
+		return
+	}
+
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+
+	policy := ""
+	if named, ok := rateLimiter.(namedRateLimiter); ok {
+		policy = named.Name()
+	}
+
+	record := ratelimit.DenialRecord{
+		DecisionID: GetDecisionID(c),
+		KeyHash:    ratelimit.HashKey(key),
+		Route:      route,
+		Method:     c.Request.Method,
+		Policy:     policy,
+		UserAgent:  c.GetHeader("User-Agent"),
+		Timestamp:  time.Now(),
+	}
+	denialLog.Enqueue(record)
+}
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorCode identifies the kind of error for clients, independent of the
+// human-readable title and message.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest  ErrorCode = "invalid_request"
+	CodeUnauthenticated ErrorCode = "unauthenticated"
+	CodeForbidden       ErrorCode = "forbidden"
+	CodeNotFound        ErrorCode = "not_found"
+	CodeConflict        ErrorCode = "conflict"
+	CodeTooLarge        ErrorCode = "request_too_large"
+	CodeRateLimited     ErrorCode = "rate_limited"
+	CodeInternal        ErrorCode = "internal_error"
+	CodeNotImplemented  ErrorCode = "not_implemented"
+	CodeUnavailable     ErrorCode = "unavailable"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+const problemTypeContextKey = "problem_type_base"
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+	Code ErrorCode `json:"code"`
+	// Error is a short title, e.g. "Invalid request".
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	// RetryAfter is how many seconds to wait before retrying, when known.
+	RetryAfter *int64                 `json:"retry_after,omitempty"`
+	RequestID  string                 `json:"request_id,omitempty"`
+	DecisionID string                 `json:"decision_id,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// NewErrorResponse builds the error body for status, with the code that
+// status maps to and the IDs of the request and its rate limit decision. The
+// title and message are translated when Localize applies.
+func NewErrorResponse(c *gin.Context, status int, title, message string) ErrorResponse {
+	return ErrorResponse{
+		Code:       ErrorCodeFor(status),
+		Error:      Localized(c, title),
+		Message:    Localized(c, message),
+		RequestID:  GetRequestID(c),
+		DecisionID: GetDecisionID(c),
+	}
+}
+
+// WithRetryAfter sets RetryAfter, rounded up to whole seconds.
+func (e ErrorResponse) WithRetryAfter(retryAfter time.Duration) ErrorResponse {
+	seconds := RetryAfterSeconds(retryAfter)
+	e.RetryAfter = &seconds
+	return e
+}
+
+// RetryAfterSeconds rounds retryAfter up to whole seconds, so clients don't
+// retry a moment too early.
+func RetryAfterSeconds(retryAfter time.Duration) int64 {
+	if retryAfter < 0 {
+		return 0
+	}
+	return int64(math.Ceil(retryAfter.Seconds()))
+}
+
+// Problem renders e as RFC 7807 problem details. The type is typeBase
+// followed by the code, or "about:blank" without a base; details become
+// extension members.
+func (e ErrorResponse) Problem(c *gin.Context, status int, typeBase string) map[string]interface{} {
+	problemType := "about:blank"
+	if typeBase != "" {
+		problemType = typeBase + string(e.Code)
+	}
+
+	problem := make(map[string]interface{}, len(e.Details)+7)
+	for name, value := range e.Details {
+		problem[name] = value
+	}
+	problem["type"] = problemType
+	problem["title"] = e.Error
+	problem["status"] = status
+	problem["detail"] = e.Message
+	problem["code"] = e.Code
+	if c.Request != nil {
+		problem["instance"] = c.Request.URL.Path
+	}
+	if e.RetryAfter != nil {
+		problem["retry-after"] = *e.RetryAfter
+	}
+	if e.RequestID != "" {
+		problem["request_id"] = e.RequestID
+	}
+	if e.DecisionID != "" {
+		problem["decision_id"] = e.DecisionID
+	}
+	return problem
+}
+
+// ProblemJSON makes 429 and 5xx errors written by WriteError problem+json
+// bodies, for clients that parse RFC 7807. Other errors keep ErrorResponse.
+func ProblemJSON(typeBase string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(problemTypeContextKey, typeBase)
+		c.Next()
+	}
+}
+
+// ProblemJSONEnabled reports whether ProblemJSON is installed for c.
+func ProblemJSONEnabled(c *gin.Context) bool {
+	_, ok := c.Get(problemTypeContextKey)
+	return ok
+}
+
+// WriteError writes response, as problem details when ProblemJSON applies.
+func WriteError(c *gin.Context, status int, response ErrorResponse) {
+	setContentLanguage(c)
+	if ProblemJSONEnabled(c) && (status == http.StatusTooManyRequests || status >= 500) {
+		// gin keeps a Content-Type that is already set.
+		c.Header("Content-Type", ProblemContentType)
+		c.JSON(status, response.Problem(c, status, c.GetString(problemTypeContextKey)))
+		return
+	}
+	c.JSON(status, response)
+}
+
+// RespondError writes an ErrorResponse without aborting, for handlers.
+func RespondError(c *gin.Context, status int, title, message string) {
+	WriteError(c, status, NewErrorResponse(c, status, title, message))
+}
+
+// AbortError responds with an error and stops the handler chain.
+func AbortError(c *gin.Context, status int, title, message string) {
+	RespondError(c, status, title, message)
+	c.Abort()
+}
+
+// ErrorCodeFor maps an HTTP status to its ErrorCode.
+func ErrorCodeFor(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusNotImplemented:
+		return CodeNotImplemented
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
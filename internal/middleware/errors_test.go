@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAbortError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/test", func(c *gin.Context) {
+		AbortError(c, http.StatusForbidden, "Forbidden", "no access")
+	}, func(c *gin.Context) {
+		t.Error("handler after AbortError ran")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "forbidden", body["code"])
+	assert.Equal(t, "Forbidden", body["error"])
+	assert.Equal(t, "no access", body["message"])
+	assert.NotEmpty(t, body["request_id"])
+	assert.NotContains(t, body, "retry_after")
+}
+
+func TestErrorResponse_WithRetryAfter(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	response := NewErrorResponse(c, http.StatusTooManyRequests, "Rate limit exceeded", "Too many requests").
+		WithRetryAfter(1500 * time.Millisecond)
+
+	assert.Equal(t, CodeRateLimited, response.Code)
+	require.NotNil(t, response.RetryAfter)
+	assert.Equal(t, int64(2), *response.RetryAfter, "rounded up")
+	assert.Equal(t, int64(0), RetryAfterSeconds(-time.Second))
+}
+
+func TestErrorCodeFor(t *testing.T) {
+	assert.Equal(t, CodeInvalidRequest, ErrorCodeFor(http.StatusBadRequest))
+	assert.Equal(t, CodeTooLarge, ErrorCodeFor(http.StatusRequestEntityTooLarge))
+	assert.Equal(t, CodeUnavailable, ErrorCodeFor(http.StatusServiceUnavailable))
+	assert.Equal(t, CodeInternal, ErrorCodeFor(http.StatusBadGateway))
+	assert.Equal(t, CodeInvalidRequest, ErrorCodeFor(http.StatusTeapot))
+}
+
+func TestWriteError_ProblemJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(ProblemJSON("https://example.com/errors/"))
+	router.GET("/limited", func(c *gin.Context) {
+		response := NewErrorResponse(c, http.StatusTooManyRequests, "Rate limit exceeded", "Too many requests").
+			WithRetryAfter(3 * time.Second)
+		response.Details = map[string]interface{}{"allowed": false}
+		WriteError(c, http.StatusTooManyRequests, response)
+	})
+	router.GET("/invalid", func(c *gin.Context) {
+		RespondError(c, http.StatusBadRequest, "Invalid request", "bad key")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/limited", nil))
+
+	var problem map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "https://example.com/errors/rate_limited", problem["type"])
+	assert.Equal(t, "Rate limit exceeded", problem["title"])
+	assert.Equal(t, "Too many requests", problem["detail"])
+	assert.Equal(t, float64(http.StatusTooManyRequests), problem["status"])
+	assert.Equal(t, float64(3), problem["retry-after"])
+	assert.Equal(t, "/limited", problem["instance"])
+	assert.Equal(t, false, problem["allowed"], "details become extension members")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/invalid", nil))
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json", "only 429 and 5xx become problems")
+	assert.Contains(t, w.Body.String(), `"code":"invalid_request"`)
+}
+
+func TestErrorResponse_ProblemWithoutTypeBase(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/x", nil)
+
+	problem := NewErrorResponse(c, http.StatusInternalServerError, "Rate limiter error", "boom").
+		Problem(c, http.StatusInternalServerError, "")
+
+	assert.Equal(t, "about:blank", problem["type"])
+	assert.NotContains(t, problem, "retry-after")
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultFieldKeyMaxBodyBytes caps how much of a body is buffered to find a
+// JSON key field when no cap is configured.
+const DefaultFieldKeyMaxBodyBytes = 64 << 10
+
+type FieldKeySource string
+
+const (
+	// FieldKeyJSON reads a field of a JSON body. Nested fields are separated
+	// by dots, e.g. "variables.customerId".
+	FieldKeyJSON FieldKeySource = "json"
+	// FieldKeyQuery reads a query parameter.
+	FieldKeyQuery FieldKeySource = "query"
+	// FieldKeyCookie reads a cookie.
+	FieldKeyCookie FieldKeySource = "cookie"
+)
+
+// FieldKeyRoute keys the requests of one route by a field.
+type FieldKeyRoute struct {
+	// Path is the Gin route template, e.g. "/api/graphql".
+	Path string
+	// Method restricts the route to one HTTP method; empty matches any.
+	Method string
+	Source FieldKeySource
+	Field  string
+}
+
+type FieldKeyConfig struct {
+	Routes []FieldKeyRoute
+	// MaxBodyBytes caps the body buffered for FieldKeyJSON. Larger bodies are
+	// not parsed and use Fallback. DefaultFieldKeyMaxBodyBytes when zero.
+	MaxBodyBytes int64
+	// Fallback keys requests on other routes, and those without the field;
+	// the default key extractor when nil.
+	Fallback func(c *gin.Context) string
+}
+
+// NewFieldKeyExtractor returns a KeyExtractor for APIs whose caller identity
+// lives in the request rather than its headers, such as a GraphQL endpoint
+// keyed by a variable. The first route matching a request names the field;
+// its key is "<field>:<value>".
+func NewFieldKeyExtractor(cfg FieldKeyConfig) (func(c *gin.Context) string, error) {
+	for _, route := range cfg.Routes {
+		if route.Path == "" || route.Field == "" {
+			return nil, errors.New("field key routes need a path and a field")
+		}
+		switch route.Source {
+		case FieldKeyJSON, FieldKeyQuery, FieldKeyCookie:
+		default:
+			return nil, fmt.Errorf("route %s: unknown field key source %q", route.Path, route.Source)
+		}
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = DefaultFieldKeyMaxBodyBytes
+	}
+	if cfg.Fallback == nil {
+		cfg.Fallback = defaultKeyExtractor
+	}
+
+	return func(c *gin.Context) string {
+		for _, route := range cfg.Routes {
+			if route.Path != c.FullPath() || (route.Method != "" && !strings.EqualFold(route.Method, c.Request.Method)) {
+				continue
+			}
+			if value := fieldValue(c, route, cfg.MaxBodyBytes); value != "" {
+				return route.Field + ":" + value
+			}
+			break
+		}
+		return cfg.Fallback(c)
+	}, nil
+}
+
+func fieldValue(c *gin.Context, route FieldKeyRoute, maxBodyBytes int64) string {
+	switch route.Source {
+	case FieldKeyQuery:
+		return c.Query(route.Field)
+	case FieldKeyCookie:
+		value, _ := c.Cookie(route.Field)
+		return value
+	default:
+		return jsonFieldValue(c, route.Field, maxBodyBytes)
+	}
+}
+
+// jsonFieldValue reads up to maxBodyBytes of a JSON body and returns the
+// scalar at path, or "" if there is none. The body is put back untouched for
+// the handler, including any part beyond the cap.
+func jsonFieldValue(c *gin.Context, path string, maxBodyBytes int64) string {
+	if c.Request.Body == nil || !isJSONRequest(c.Request) {
+		return ""
+	}
+
+	buffered, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodyBytes+1))
+	c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(buffered), c.Request.Body), c.Request.Body}
+	if err != nil {
+		slog.Debug("failed to read body for rate limit key", "request_id", GetRequestID(c), "error", err.Error())
+		return ""
+	}
+	if int64(len(buffered)) > maxBodyBytes {
+		return ""
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(buffered))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return ""
+	}
+
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = object[name]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	default:
+		return ""
+	}
+}
+
+// readCloser reads from the buffered and remaining body but closes the
+// original.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
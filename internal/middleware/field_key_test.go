@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fieldKeyRouter answers with the key of each request and the body its
+// handler read, separated by "|".
+func fieldKeyRouter(t *testing.T, cfg FieldKeyConfig) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	extractor, err := NewFieldKeyExtractor(cfg)
+	require.NoError(t, err)
+
+	router := gin.New()
+	handler := func(c *gin.Context) {
+		key := extractor(c)
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, key+"|"+string(body))
+	}
+	router.POST("/graphql", handler)
+	router.GET("/search", handler)
+	router.GET("/account", handler)
+	return router
+}
+
+func fieldKey(router *gin.Engine, method, target, body string, header http.Header) string {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.RemoteAddr = "192.0.2.1:1234"
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestFieldKeyExtractor(t *testing.T) {
+	router := fieldKeyRouter(t, FieldKeyConfig{
+		Routes: []FieldKeyRoute{
+			{Path: "/graphql", Method: "POST", Source: FieldKeyJSON, Field: "variables.customerId"},
+			{Path: "/search", Source: FieldKeyQuery, Field: "api_key"},
+			{Path: "/account", Source: FieldKeyCookie, Field: "session"},
+		},
+		MaxBodyBytes: 64,
+	})
+
+	jsonHeader := http.Header{"Content-Type": {"application/json; charset=utf-8"}}
+	body := `{"query":"{ orders }","variables":{"customerId":42}}`
+	assert.Equal(t, "variables.customerId:42|"+body, fieldKey(router, "POST", "/graphql", body, jsonHeader), "the handler still gets the body")
+	assert.Equal(t, "192.0.2.1|{}", fieldKey(router, "POST", "/graphql", `{}`, jsonHeader), "missing fields fall back")
+	assert.Equal(t, "192.0.2.1|x", fieldKey(router, "POST", "/graphql", "x", http.Header{"Content-Type": {"text/plain"}}))
+	assert.Equal(t, "192.0.2.1|"+body, fieldKey(router, "POST", "/graphql", body, nil), "bodies without a JSON content type aren't parsed")
+	assert.Equal(t, "192.0.2.1|"+body, fieldKey(router, "POST", "/graphql", body, http.Header{"Content-Type": {"text/x-json"}}))
+
+	large := `{"variables":{"customerId":"c-1"},"padding":"` + strings.Repeat("a", 100) + `"}`
+	assert.Equal(t, "192.0.2.1|"+large, fieldKey(router, "POST", "/graphql", large, jsonHeader), "bodies over the cap aren't parsed but reach the handler whole")
+
+	assert.Equal(t, "api_key:k-1|", fieldKey(router, "GET", "/search?api_key=k-1", "", nil))
+	assert.Equal(t, "session:s-1|", fieldKey(router, "GET", "/account", "", http.Header{"Cookie": {"session=s-1"}}))
+	assert.Equal(t, "client-7|", fieldKey(router, "GET", "/account", "", http.Header{"X-Client-Id": {"client-7"}}), "default fallback")
+}
+
+func TestFieldKeyExtractor_InvalidRoutes(t *testing.T) {
+	_, err := NewFieldKeyExtractor(FieldKeyConfig{Routes: []FieldKeyRoute{{Path: "/graphql", Source: "form", Field: "id"}}})
+	assert.Error(t, err)
+
+	_, err = NewFieldKeyExtractor(FieldKeyConfig{Routes: []FieldKeyRoute{{Path: "/graphql", Source: FieldKeyJSON}}})
+	assert.Error(t, err)
+}
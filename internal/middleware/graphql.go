@@ -0,0 +1,342 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+// DefaultGraphQLMaxBodyBytes caps the GraphQL request buffered to price it
+// when no cap is configured.
+const DefaultGraphQLMaxBodyBytes = 64 << 10
+
+// DefaultGraphQLListArguments are the arguments read as a list field's page
+// size when none are configured.
+var DefaultGraphQLListArguments = []string{"first", "last", "limit"}
+
+// Codes of the GraphQL errors written by GraphQLRateLimit, in the
+// extensions of each error.
+const (
+	GraphQLCodeParseFailed   = "GRAPHQL_PARSE_FAILED"
+	GraphQLCodeTooComplex    = "QUERY_TOO_COMPLEX"
+	GraphQLCodeTooLarge      = "QUERY_TOO_LARGE"
+	GraphQLCodeRateLimited   = "RATE_LIMITED"
+	GraphQLCodeInternalError = "INTERNAL_SERVER_ERROR"
+)
+
+const graphQLCostContextKey = "graphql_cost"
+
+type GraphQLConfig struct {
+	// MaxDepth rejects operations whose fields nest deeper than this. Zero
+	// means no limit.
+	MaxDepth int
+	// MaxComplexity rejects operations that cost more than this. Zero means
+	// no limit.
+	MaxComplexity int64
+	// ListArguments name the arguments giving a list field's page size, e.g.
+	// first: 50; DefaultGraphQLListArguments when empty. The fields selected
+	// from the list are charged that many times.
+	ListArguments []string
+	// DefaultListSize is the page size of fields with selections but no
+	// list argument. Zero or 1 charges them like a single object.
+	DefaultListSize int64
+	// Operations overrides the cost of operations by name, e.g. for
+	// persisted queries whose cost is known. Overridden operations aren't
+	// checked against MaxComplexity.
+	Operations map[string]int64
+	// MaxBodyBytes caps the request buffered to read the query; larger
+	// requests are rejected. DefaultGraphQLMaxBodyBytes when zero.
+	MaxBodyBytes int64
+}
+
+// graphQLRequest is a request of the GraphQL over HTTP spec.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphQLError is a rejection, written as a GraphQL response with a single
+// error.
+type graphQLError struct {
+	status     int
+	code       string
+	message    string
+	extensions map[string]interface{}
+}
+
+// GraphQLRateLimit limits a GraphQL endpoint by what its operations cost
+// rather than by request count. It parses the query, prices it with 1 token
+// per field, multiplied by the page size of the lists it is selected from,
+// and takes that many tokens at once, so the limiter must support batches or
+// reservations. Queries that fail to parse, or are deeper or more complex
+// than allowed, are rejected before reaching the limiter.
+//
+// Rejections are GraphQL responses with an errors array, whose extensions
+// carry a code and, when rate limited, the cost and retryAfter in seconds.
+// Rate limited requests are answered with 429 and the usual headers.
+//
+// The key, timeout, mode and logs of config apply as for RateLimit; waiting,
+// coalescing and response counting do not. A POST body can hold a batch of
+// requests, which is charged their total cost.
+func GraphQLRateLimit(rateLimiter ratelimit.RateLimiter, cfg GraphQLConfig, config ...*RateLimitConfig) gin.HandlerFunc {
+	var rateLimitConfig *RateLimitConfig
+	if len(config) > 0 && config[0] != nil {
+		rateLimitConfig = config[0]
+	} else {
+		rateLimitConfig = &RateLimitConfig{}
+	}
+	if rateLimitConfig.KeyExtractor == nil {
+		rateLimitConfig.KeyExtractor = defaultKeyExtractor
+	}
+	if len(cfg.ListArguments) == 0 {
+		cfg.ListArguments = DefaultGraphQLListArguments
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = DefaultGraphQLMaxBodyBytes
+	}
+
+	return func(c *gin.Context) {
+		cost, rejection := graphQLCost(c, cfg)
+		if rejection != nil {
+			writeGraphQLError(c, rejection)
+			return
+		}
+		cost = rateLimitConfig.AbuseScoring.Weigh(c, cost)
+		c.Set(graphQLCostContextKey, cost)
+		if cost == 0 {
+			// Only an override makes an operation free.
+			c.Next()
+			return
+		}
+
+		key := rateLimitConfig.KeyExtractor(c)
+		if rateLimitConfig.KeyByRoute {
+			key = routeKey(c, key)
+		}
+		ctx, cancel := LimiterContext(c, rateLimitConfig.Timeout)
+		defer cancel()
+		ctx = WithDecisionID(c, ctx)
+
+		response, err := ratelimit.TakeN(ctx, rateLimiter, key, cost, time.Now())
+		if err != nil && ClientGone(c) {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			LogRateLimitError(c, key, err)
+			if rateLimitConfig.Mode.failsOpen() {
+				rateLimitConfig.Mode.recordCheck(true)
+				rateLimitConfig.Mode.setHeader(c)
+				c.Next()
+				return
+			}
+			writeGraphQLError(c, &graphQLError{
+				status:  http.StatusInternalServerError,
+				code:    GraphQLCodeInternalError,
+				message: "Rate limiter error",
+			})
+			return
+		}
+
+		rateLimitConfig.Mode.recordCheck(false)
+		rateLimitConfig.Mode.setHeader(c)
+		SetRateLimitHeaders(c, response)
+		setDecision(c, response)
+		RecordAudit(c, rateLimitConfig.AuditLog, rateLimiter, key, response)
+
+		if !response.Allowed {
+			LogRateLimitDenied(c, key, response)
+			RecordDenial(c, rateLimitConfig.DenialLog, rateLimiter, key)
+			if !rateLimitConfig.Mode.DryRun() {
+				extensions := map[string]interface{}{"cost": cost}
+				if response.RetryAfter != nil {
+					extensions["retryAfter"] = RetryAfterSeconds(*response.RetryAfter)
+				}
+				writeGraphQLError(c, &graphQLError{
+					status:     http.StatusTooManyRequests,
+					code:       GraphQLCodeRateLimited,
+					message:    Localizedf(c, "Rate limit exceeded: the operation costs %d", cost),
+					extensions: extensions,
+				})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// GetGraphQLCost returns the cost GraphQLRateLimit charged the request, or 0.
+func GetGraphQLCost(c *gin.Context) int64 {
+	cost, _ := c.Get(graphQLCostContextKey)
+	n, _ := cost.(int64)
+	return n
+}
+
+func writeGraphQLError(c *gin.Context, rejection *graphQLError) {
+	extensions := map[string]interface{}{"code": rejection.code}
+	for name, value := range rejection.extensions {
+		extensions[name] = value
+	}
+	if requestID := GetRequestID(c); requestID != "" {
+		extensions["requestId"] = requestID
+	}
+	if decisionID := GetDecisionID(c); decisionID != "" {
+		extensions["decisionId"] = decisionID
+	}
+
+	setContentLanguage(c)
+	c.AbortWithStatusJSON(rejection.status, gin.H{
+		"errors": []gin.H{{
+			"message":    rejection.message,
+			"extensions": extensions,
+		}},
+	})
+}
+
+// graphQLCost reads the GraphQL requests of c and returns their total cost.
+// The body is put back untouched for the handler.
+func graphQLCost(c *gin.Context, cfg GraphQLConfig) (int64, *graphQLError) {
+	requests, rejection := readGraphQLRequests(c, cfg.MaxBodyBytes)
+	if rejection != nil {
+		return 0, rejection
+	}
+
+	var total int64
+	for _, request := range requests {
+		cost, rejection := priceGraphQLRequest(request, cfg)
+		if rejection != nil {
+			return 0, rejection
+		}
+		total = saturatingAdd(total, cost)
+	}
+	return total, nil
+}
+
+func readGraphQLRequests(c *gin.Context, maxBodyBytes int64) ([]graphQLRequest, *graphQLError) {
+	if c.Request.Method == http.MethodGet {
+		request := graphQLRequest{Query: c.Query("query"), OperationName: c.Query("operationName")}
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				return nil, parseFailed("variables must be a JSON object")
+			}
+		}
+		return []graphQLRequest{request}, nil
+	}
+
+	if c.Request.Body == nil {
+		return nil, parseFailed("missing GraphQL request body")
+	}
+	buffered, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodyBytes+1))
+	c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(buffered), c.Request.Body), c.Request.Body}
+	if err != nil {
+		return nil, parseFailed("failed to read the request body")
+	}
+	if int64(len(buffered)) > maxBodyBytes {
+		return nil, &graphQLError{
+			status:  http.StatusRequestEntityTooLarge,
+			code:    GraphQLCodeTooLarge,
+			message: fmt.Sprintf("GraphQL requests are limited to %d bytes", maxBodyBytes),
+		}
+	}
+
+	if c.ContentType() == "application/graphql" {
+		return []graphQLRequest{{Query: string(buffered), OperationName: c.Query("operationName")}}, nil
+	}
+
+	trimmed := bytes.TrimSpace(buffered)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var requests []graphQLRequest
+		if err := json.Unmarshal(trimmed, &requests); err != nil || len(requests) == 0 {
+			return nil, parseFailed("the body must be a GraphQL request or a non-empty batch of them")
+		}
+		return requests, nil
+	}
+	var request graphQLRequest
+	if err := json.Unmarshal(trimmed, &request); err != nil {
+		return nil, parseFailed("the body must be a GraphQL request")
+	}
+	return []graphQLRequest{request}, nil
+}
+
+// priceGraphQLRequest prices the operation a request executes, and checks it
+// against the configured depth and complexity.
+func priceGraphQLRequest(request graphQLRequest, cfg GraphQLConfig) (int64, *graphQLError) {
+	if request.Query == "" {
+		return 0, parseFailed("missing query")
+	}
+	doc, err := parseGraphQL(request.Query)
+	if err != nil {
+		return 0, parseFailed(err.Error())
+	}
+
+	operation, err := selectOperation(doc, request.OperationName)
+	if err != nil {
+		return 0, parseFailed(err.Error())
+	}
+
+	cost := &gqlCost{
+		doc:             doc,
+		variables:       request.Variables,
+		listArguments:   cfg.ListArguments,
+		defaultListSize: cfg.DefaultListSize,
+		fragments:       make(map[string]gqlPrice),
+		pricing:         make(map[string]bool),
+	}
+	price, err := cost.price(operation.selections)
+	if err != nil {
+		return 0, parseFailed(err.Error())
+	}
+
+	if cfg.MaxDepth > 0 && price.depth > cfg.MaxDepth {
+		return 0, &graphQLError{
+			status:     http.StatusBadRequest,
+			code:       GraphQLCodeTooComplex,
+			message:    fmt.Sprintf("The operation is nested %d levels deep, more than the maximum of %d", price.depth, cfg.MaxDepth),
+			extensions: map[string]interface{}{"depth": price.depth, "maxDepth": cfg.MaxDepth},
+		}
+	}
+
+	if override, ok := cfg.Operations[operation.name]; ok && operation.name != "" {
+		return override, nil
+	}
+	if cfg.MaxComplexity > 0 && price.complexity > cfg.MaxComplexity {
+		return 0, &graphQLError{
+			status:     http.StatusBadRequest,
+			code:       GraphQLCodeTooComplex,
+			message:    fmt.Sprintf("The operation costs %d, more than the maximum of %d", price.complexity, cfg.MaxComplexity),
+			extensions: map[string]interface{}{"cost": price.complexity, "maxCost": cfg.MaxComplexity},
+		}
+	}
+	// Even an operation selecting only __typename is a request.
+	return max(price.complexity, 1), nil
+}
+
+// selectOperation picks the operation named name, or the document's only
+// operation when name is empty.
+func selectOperation(doc *gqlDocument, name string) (*gqlOperation, error) {
+	if name == "" {
+		if len(doc.operations) != 1 {
+			return nil, errors.New("operationName is required for documents with several operations")
+		}
+		return doc.operations[0], nil
+	}
+	for _, operation := range doc.operations {
+		if operation.name == name {
+			return operation, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+func parseFailed(message string) *graphQLError {
+	return &graphQLError{status: http.StatusBadRequest, code: GraphQLCodeParseFailed, message: message}
+}
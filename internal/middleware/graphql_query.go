@@ -0,0 +1,547 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// This is a parser for just enough of the GraphQL query language to price a
+// request: operations, fragments, and the fields, arguments and selections
+// within them. It checks syntax but nothing that needs the schema; the
+// GraphQL server validates the query fully.
+
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+type gqlOperation struct {
+	// kind is "query", "mutation" or "subscription".
+	kind       string
+	name       string
+	selections []gqlSelection
+}
+
+type gqlFragment struct {
+	name       string
+	selections []gqlSelection
+}
+
+// gqlSelection is a field, a fragment spread when spread is set, or an inline
+// fragment when neither name nor spread is.
+type gqlSelection struct {
+	name       string
+	spread     string
+	arguments  map[string]interface{}
+	selections []gqlSelection
+}
+
+// gqlVariable is an argument value referring to a variable.
+type gqlVariable string
+
+type gqlTokenKind int
+
+const (
+	gqlEOF gqlTokenKind = iota
+	gqlPunctuator
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind  gqlTokenKind
+	value string
+	pos   int
+}
+
+type gqlParser struct {
+	source string
+	pos    int
+	token  gqlToken
+	// depth guards against selection sets nested deep enough to exhaust the
+	// stack.
+	depth int
+}
+
+// maxGraphQLNesting bounds the nesting of selection sets and values the
+// parser accepts, well beyond any sensible MaxDepth.
+const maxGraphQLNesting = 256
+
+func parseGraphQL(source string) (doc *gqlDocument, err error) {
+	p := &gqlParser{source: source}
+	defer func() {
+		if r := recover(); r != nil {
+			syntaxErr, ok := r.(gqlSyntaxError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, syntaxErr
+		}
+	}()
+
+	p.next()
+	doc = &gqlDocument{fragments: make(map[string]*gqlFragment)}
+	if p.token.kind == gqlEOF {
+		p.fail("empty document")
+	}
+	for p.token.kind != gqlEOF {
+		switch {
+		case p.peek(gqlPunctuator, "{"):
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", selections: p.selectionSet()})
+		case p.peek(gqlName, "query"), p.peek(gqlName, "mutation"), p.peek(gqlName, "subscription"):
+			doc.operations = append(doc.operations, p.operation())
+		case p.peek(gqlName, "fragment"):
+			fragment := p.fragment()
+			if _, exists := doc.fragments[fragment.name]; exists {
+				p.fail("fragment %q is defined twice", fragment.name)
+			}
+			doc.fragments[fragment.name] = fragment
+		default:
+			p.unexpected()
+		}
+	}
+	return doc, nil
+}
+
+type gqlSyntaxError struct {
+	message string
+	pos     int
+}
+
+func (e gqlSyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.pos, e.message)
+}
+
+func (p *gqlParser) fail(format string, args ...interface{}) {
+	panic(gqlSyntaxError{message: fmt.Sprintf(format, args...), pos: p.token.pos})
+}
+
+func (p *gqlParser) unexpected() {
+	if p.token.kind == gqlEOF {
+		p.fail("unexpected end of document")
+	}
+	p.fail("unexpected %q", p.token.value)
+}
+
+func (p *gqlParser) peek(kind gqlTokenKind, value string) bool {
+	return p.token.kind == kind && p.token.value == value
+}
+
+// skip consumes the token if it is the punctuator value.
+func (p *gqlParser) skip(value string) bool {
+	if p.peek(gqlPunctuator, value) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *gqlParser) expect(value string) {
+	if !p.skip(value) {
+		p.unexpected()
+	}
+}
+
+func (p *gqlParser) name() string {
+	if p.token.kind != gqlName {
+		p.unexpected()
+	}
+	name := p.token.value
+	p.next()
+	return name
+}
+
+func (p *gqlParser) enter() {
+	p.depth++
+	if p.depth > maxGraphQLNesting {
+		p.fail("document is nested more than %d levels deep", maxGraphQLNesting)
+	}
+}
+
+func (p *gqlParser) operation() *gqlOperation {
+	operation := &gqlOperation{kind: p.name()}
+	if p.token.kind == gqlName {
+		operation.name = p.name()
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			p.expect("$")
+			p.name()
+			p.expect(":")
+			p.typeRef()
+			if p.skip("=") {
+				p.value()
+			}
+			p.directives()
+		}
+	}
+	p.directives()
+	operation.selections = p.selectionSet()
+	return operation
+}
+
+func (p *gqlParser) fragment() *gqlFragment {
+	p.next()
+	fragment := &gqlFragment{name: p.name()}
+	if fragment.name == "on" {
+		p.fail("fragments can't be named \"on\"")
+	}
+	if p.name() != "on" {
+		p.fail("expected \"on\" after the fragment name")
+	}
+	p.name()
+	p.directives()
+	fragment.selections = p.selectionSet()
+	return fragment
+}
+
+func (p *gqlParser) typeRef() {
+	if p.skip("[") {
+		p.enter()
+		p.typeRef()
+		p.depth--
+		p.expect("]")
+	} else {
+		p.name()
+	}
+	p.skip("!")
+}
+
+func (p *gqlParser) directives() {
+	for p.skip("@") {
+		p.name()
+		p.arguments()
+	}
+}
+
+func (p *gqlParser) selectionSet() []gqlSelection {
+	p.expect("{")
+	p.enter()
+	var selections []gqlSelection
+	for !p.skip("}") {
+		selections = append(selections, p.selection())
+	}
+	if len(selections) == 0 {
+		p.fail("empty selection set")
+	}
+	p.depth--
+	return selections
+}
+
+func (p *gqlParser) selection() gqlSelection {
+	if p.skip("...") {
+		if p.token.kind == gqlName && p.token.value != "on" {
+			spread := gqlSelection{spread: p.name()}
+			p.directives()
+			return spread
+		}
+		if p.peek(gqlName, "on") {
+			p.next()
+			p.name()
+		}
+		p.directives()
+		return gqlSelection{selections: p.selectionSet()}
+	}
+
+	field := gqlSelection{name: p.name()}
+	if p.skip(":") {
+		field.name = p.name()
+	}
+	field.arguments = p.arguments()
+	p.directives()
+	if p.peek(gqlPunctuator, "{") {
+		field.selections = p.selectionSet()
+	}
+	return field
+}
+
+func (p *gqlParser) arguments() map[string]interface{} {
+	if !p.skip("(") {
+		return nil
+	}
+	arguments := make(map[string]interface{})
+	for !p.skip(")") {
+		name := p.name()
+		p.expect(":")
+		arguments[name] = p.value()
+	}
+	return arguments
+}
+
+// value parses a value, returning variables as gqlVariable and integers as
+// int64. Other values only need to be well-formed.
+func (p *gqlParser) value() interface{} {
+	token := p.token
+	switch {
+	case p.skip("$"):
+		return gqlVariable(p.name())
+	case p.skip("["):
+		p.enter()
+		for !p.skip("]") {
+			p.value()
+		}
+		p.depth--
+		return nil
+	case p.skip("{"):
+		p.enter()
+		for !p.skip("}") {
+			p.name()
+			p.expect(":")
+			p.value()
+		}
+		p.depth--
+		return nil
+	case token.kind == gqlInt:
+		p.next()
+		n, err := strconv.ParseInt(token.value, 10, 64)
+		if err != nil {
+			return int64(math.MaxInt64)
+		}
+		return n
+	case token.kind == gqlFloat, token.kind == gqlString, token.kind == gqlName:
+		p.next()
+		return nil
+	}
+	p.unexpected()
+	return nil
+}
+
+// next reads the next token, skipping whitespace, commas and comments.
+func (p *gqlParser) next() {
+	for p.pos < len(p.source) {
+		switch c := p.source[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.source) && p.source[p.pos] != '\n' && p.source[p.pos] != '\r' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.source[p.pos:], "\uFEFF"):
+			p.pos += len("\uFEFF")
+		default:
+			p.token = p.lex()
+			return
+		}
+	}
+	p.token = gqlToken{kind: gqlEOF, pos: p.pos}
+}
+
+func (p *gqlParser) lex() gqlToken {
+	start := p.pos
+	c := p.source[p.pos]
+	switch {
+	case strings.HasPrefix(p.source[p.pos:], "..."):
+		p.pos += 3
+		return gqlToken{kind: gqlPunctuator, value: "...", pos: start}
+	case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+		p.pos++
+		return gqlToken{kind: gqlPunctuator, value: string(c), pos: start}
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.source) && (p.source[p.pos] == '_' || isLetter(p.source[p.pos]) || isDigit(p.source[p.pos])) {
+			p.pos++
+		}
+		return gqlToken{kind: gqlName, value: p.source[start:p.pos], pos: start}
+	case c == '-' || isDigit(c):
+		return p.lexNumber()
+	case c == '"':
+		return p.lexString()
+	}
+	p.token = gqlToken{pos: start}
+	p.fail("unexpected character %q", c)
+	return gqlToken{}
+}
+
+func (p *gqlParser) lexNumber() gqlToken {
+	start := p.pos
+	kind := gqlInt
+	p.pos++
+	p.digits()
+	if p.pos < len(p.source) && p.source[p.pos] == '.' {
+		kind = gqlFloat
+		p.pos++
+		p.digits()
+	}
+	if p.pos < len(p.source) && (p.source[p.pos] == 'e' || p.source[p.pos] == 'E') {
+		kind = gqlFloat
+		p.pos++
+		if p.pos < len(p.source) && (p.source[p.pos] == '+' || p.source[p.pos] == '-') {
+			p.pos++
+		}
+		p.digits()
+	}
+	value := p.source[start:p.pos]
+	if value == "-" || strings.HasSuffix(value, ".") || strings.HasSuffix(value, "e") || strings.HasSuffix(value, "E") ||
+		strings.HasSuffix(value, "+") || strings.HasSuffix(value, "-") {
+		p.token = gqlToken{pos: start}
+		p.fail("invalid number %q", value)
+	}
+	return gqlToken{kind: kind, value: value, pos: start}
+}
+
+func (p *gqlParser) digits() {
+	for p.pos < len(p.source) && isDigit(p.source[p.pos]) {
+		p.pos++
+	}
+}
+
+// lexString skips over a string or block string. Its contents don't matter
+// for pricing, so escapes are checked only as far as finding the end.
+func (p *gqlParser) lexString() gqlToken {
+	start := p.pos
+	if strings.HasPrefix(p.source[p.pos:], `"""`) {
+		p.pos += 3
+		for p.pos < len(p.source) {
+			switch {
+			case strings.HasPrefix(p.source[p.pos:], `\"""`):
+				p.pos += 4
+			case strings.HasPrefix(p.source[p.pos:], `"""`):
+				p.pos += 3
+				return gqlToken{kind: gqlString, pos: start}
+			default:
+				p.pos++
+			}
+		}
+	} else {
+		p.pos++
+		for p.pos < len(p.source) && p.source[p.pos] != '\n' && p.source[p.pos] != '\r' {
+			switch p.source[p.pos] {
+			case '\\':
+				p.pos += 2
+			case '"':
+				p.pos++
+				return gqlToken{kind: gqlString, pos: start}
+			default:
+				p.pos++
+			}
+		}
+	}
+	p.token = gqlToken{pos: start}
+	p.fail("unterminated string")
+	return gqlToken{}
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// gqlCost prices an operation's selections. Every field costs 1, plus the
+// cost of its own selections multiplied by the page size its list arguments
+// ask for. __typename is free. Fragments are priced once, however often they
+// are spread.
+type gqlCost struct {
+	doc           *gqlDocument
+	variables     map[string]interface{}
+	listArguments []string
+	// defaultListSize multiplies lists whose size isn't given as an argument;
+	// 1 prices them like a single object.
+	defaultListSize int64
+	fragments       map[string]gqlPrice
+	pricing         map[string]bool
+}
+
+type gqlPrice struct {
+	complexity int64
+	depth      int
+}
+
+func (g *gqlCost) price(selections []gqlSelection) (gqlPrice, error) {
+	var total gqlPrice
+	for _, selection := range selections {
+		var price gqlPrice
+		switch {
+		case selection.spread != "":
+			var err error
+			if price, err = g.fragment(selection.spread); err != nil {
+				return gqlPrice{}, err
+			}
+		case selection.name == "":
+			var err error
+			if price, err = g.price(selection.selections); err != nil {
+				return gqlPrice{}, err
+			}
+		case selection.name == "__typename":
+			continue
+		default:
+			children, err := g.price(selection.selections)
+			if err != nil {
+				return gqlPrice{}, err
+			}
+			price.complexity = saturatingAdd(1, saturatingMul(g.listSize(selection), children.complexity))
+			price.depth = children.depth + 1
+		}
+		total.complexity = saturatingAdd(total.complexity, price.complexity)
+		total.depth = max(total.depth, price.depth)
+	}
+	return total, nil
+}
+
+func (g *gqlCost) fragment(name string) (gqlPrice, error) {
+	if price, ok := g.fragments[name]; ok {
+		return price, nil
+	}
+	fragment, ok := g.doc.fragments[name]
+	if !ok {
+		return gqlPrice{}, fmt.Errorf("unknown fragment %q", name)
+	}
+	if g.pricing[name] {
+		return gqlPrice{}, fmt.Errorf("fragment %q spreads itself", name)
+	}
+
+	g.pricing[name] = true
+	price, err := g.price(fragment.selections)
+	delete(g.pricing, name)
+	if err != nil {
+		return gqlPrice{}, err
+	}
+	g.fragments[name] = price
+	return price, nil
+}
+
+// listSize is the page size a field's list arguments ask for, e.g.
+// first: 50, reading variables from the request.
+func (g *gqlCost) listSize(field gqlSelection) int64 {
+	if len(field.selections) == 0 {
+		return 1
+	}
+	for _, name := range g.listArguments {
+		value, ok := field.arguments[name]
+		if !ok {
+			continue
+		}
+		if variable, ok := value.(gqlVariable); ok {
+			value = g.variables[string(variable)]
+		}
+		switch n := value.(type) {
+		case int64:
+			return max(n, 1)
+		case float64:
+			if n >= math.MaxInt64 {
+				return math.MaxInt64
+			}
+			return max(int64(n), 1)
+		}
+	}
+	return max(g.defaultListSize, 1)
+}
+
+func saturatingAdd(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+func saturatingMul(a, b int64) int64 {
+	if a != 0 && b > math.MaxInt64/a {
+		return math.MaxInt64
+	}
+	return a * b
+}
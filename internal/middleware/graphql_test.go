@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriceGraphQLRequest(t *testing.T) {
+	cfg := GraphQLConfig{ListArguments: DefaultGraphQLListArguments}
+
+	tests := []struct {
+		name       string
+		request    graphQLRequest
+		complexity int64
+	}{
+		{"single field", graphQLRequest{Query: "{ viewer }"}, 1},
+		{"typename only", graphQLRequest{Query: "{ __typename }"}, 1},
+		{"nested", graphQLRequest{Query: "query Me { viewer { name, email } }"}, 3},
+		{
+			"list argument multiplies the selection",
+			graphQLRequest{Query: `{ repos(first: 10, after: "x") { name owner { login } } }`},
+			1 + 10*3,
+		},
+		{
+			"list size from a variable",
+			graphQLRequest{Query: "query Repos($n: Int = 5) { repos(last: $n) { name } }", Variables: map[string]interface{}{"n": float64(20)}},
+			1 + 20,
+		},
+		{
+			"fragments and inline fragments",
+			graphQLRequest{Query: `
+				query Search {
+					search(limit: 2) { ...Hit ... on User { login } }
+				}
+				fragment Hit on Repo @cached { name # the repo's name
+					stars }`},
+			1 + 2*3,
+		},
+		{
+			"picks the named operation",
+			graphQLRequest{Query: "query A { a } mutation B { b { c d } }", OperationName: "B"},
+			3,
+		},
+		{
+			"block strings and directives",
+			graphQLRequest{Query: `{ search(q: """a "quoted" } brace""") @include(if: true) { id } }`},
+			2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, rejection := priceGraphQLRequest(tt.request, cfg)
+			require.Nil(t, rejection)
+			assert.Equal(t, tt.complexity, cost)
+		})
+	}
+}
+
+func TestPriceGraphQLRequest_Rejections(t *testing.T) {
+	cfg := GraphQLConfig{ListArguments: DefaultGraphQLListArguments, MaxDepth: 3, MaxComplexity: 100}
+
+	tests := []struct {
+		name    string
+		request graphQLRequest
+		code    string
+	}{
+		{"missing query", graphQLRequest{}, GraphQLCodeParseFailed},
+		{"syntax error", graphQLRequest{Query: "{ viewer { name }"}, GraphQLCodeParseFailed},
+		{"empty selection", graphQLRequest{Query: "{ viewer { } }"}, GraphQLCodeParseFailed},
+		{"unknown fragment", graphQLRequest{Query: "{ ...Missing }"}, GraphQLCodeParseFailed},
+		{"fragment cycle", graphQLRequest{Query: "{ ...A } fragment A on Q { a ...B } fragment B on Q { ...A }"}, GraphQLCodeParseFailed},
+		{"ambiguous operation", graphQLRequest{Query: "query A { a } query B { b }"}, GraphQLCodeParseFailed},
+		{"unknown operation", graphQLRequest{Query: "query A { a }", OperationName: "B"}, GraphQLCodeParseFailed},
+		{"too deep", graphQLRequest{Query: "{ a { b { c { d } } } }"}, GraphQLCodeTooComplex},
+		{"too complex", graphQLRequest{Query: "{ a(first: 100) { b } }"}, GraphQLCodeTooComplex},
+		{"nested too deep to parse", graphQLRequest{Query: strings.Repeat("{ a ", 1000) + strings.Repeat("}", 1000)}, GraphQLCodeParseFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, rejection := priceGraphQLRequest(tt.request, cfg)
+			require.NotNil(t, rejection)
+			assert.Equal(t, tt.code, rejection.code)
+			assert.Equal(t, http.StatusBadRequest, rejection.status)
+		})
+	}
+}
+
+func TestPriceGraphQLRequest_OperationOverrides(t *testing.T) {
+	cfg := GraphQLConfig{
+		ListArguments: DefaultGraphQLListArguments,
+		MaxComplexity: 10,
+		Operations:    map[string]int64{"Export": 500, "Ping": 0},
+	}
+
+	cost, rejection := priceGraphQLRequest(graphQLRequest{Query: "query Export { rows(first: 1000) { id } }"}, cfg)
+	require.Nil(t, rejection, "overrides aren't checked against MaxComplexity")
+	assert.Equal(t, int64(500), cost)
+
+	cost, rejection = priceGraphQLRequest(graphQLRequest{Query: "query Ping { ping }"}, cfg)
+	require.Nil(t, rejection)
+	assert.Zero(t, cost)
+}
+
+func graphQLRouter(limiter ratelimit.RateLimiter, cfg GraphQLConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.JSON(http.StatusOK, gin.H{"data": gin.H{"cost": GetGraphQLCost(c), "body": string(body)}})
+	}
+	limit := GraphQLRateLimit(limiter, cfg, &RateLimitConfig{
+		KeyExtractor: func(c *gin.Context) string { return "client" },
+	})
+	router.POST("/graphql", limit, handler)
+	router.GET("/graphql", limit, handler)
+	return router
+}
+
+func TestGraphQLRateLimit(t *testing.T) {
+	limiter := new(MockReservingRateLimiter)
+	limiter.On("ReserveN", mock.Anything, "client", int64(11), mock.Anything, time.Duration(0)).Return(
+		ratelimit.Reservation{
+			RateLimitResponse: ratelimit.RateLimitResponse{Allowed: true, Limit: 100, Remaining: 89, ResetTime: time.Now().Add(time.Minute)},
+		}, nil).Once()
+	retryAfter := 3 * time.Second
+	limiter.On("ReserveN", mock.Anything, "client", int64(21), mock.Anything, time.Duration(0)).Return(
+		ratelimit.Reservation{
+			RateLimitResponse: ratelimit.RateLimitResponse{Allowed: false, Limit: 100, RetryAfter: &retryAfter, ResetTime: time.Now().Add(time.Minute)},
+		}, nil).Once()
+	router := graphQLRouter(limiter, GraphQLConfig{})
+
+	body := `{"query":"query Repos($n: Int) { repos(first: $n) { name } }","variables":{"n":10}}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":{"cost":11,"body":`+string(mustJSON(t, body))+`}}`, w.Body.String(), "the handler still gets the body")
+	assert.Equal(t, "89", w.Header().Get("RateLimit-Remaining"))
+
+	query := url.Values{"query": {"{ repos(first: 20) { name } }"}}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/graphql?"+query.Encode(), nil))
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3", w.Header().Get("Retry-After"))
+	decisionID := w.Header().Get(DecisionIDHeader)
+	require.NotEmpty(t, decisionID)
+	assert.JSONEq(t, `{"errors":[{
+		"message":"Rate limit exceeded: the operation costs 21",
+		"extensions":{"code":"RATE_LIMITED","cost":21,"retryAfter":3,"decisionId":"`+decisionID+`"}
+	}]}`, w.Body.String())
+
+	limiter.AssertExpectations(t)
+}
+
+func TestGraphQLRateLimit_Batch(t *testing.T) {
+	limiter := new(MockReservingRateLimiter)
+	limiter.On("ReserveN", mock.Anything, "client", int64(4), mock.Anything, time.Duration(0)).Return(
+		ratelimit.Reservation{RateLimitResponse: ratelimit.RateLimitResponse{Allowed: true, Limit: 100}}, nil).Once()
+	router := graphQLRouter(limiter, GraphQLConfig{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", strings.NewReader(`[{"query":"{ a }"},{"query":"{ b { c d } }"}]`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	limiter.AssertExpectations(t)
+}
+
+func TestGraphQLRateLimit_RejectsBeforeCharging(t *testing.T) {
+	limiter := new(MockReservingRateLimiter)
+	router := graphQLRouter(limiter, GraphQLConfig{MaxDepth: 2, MaxBodyBytes: 64})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query":"{ a { b { c } } }"}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var response struct {
+		Errors []struct {
+			Message    string                 `json:"message"`
+			Extensions map[string]interface{} `json:"extensions"`
+		} `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, GraphQLCodeTooComplex, response.Errors[0].Extensions["code"])
+	assert.Equal(t, float64(3), response.Errors[0].Extensions["depth"])
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query":"{ a }","padding":"`+strings.Repeat("x", 64)+`"}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), GraphQLCodeTooLarge)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", strings.NewReader(`not json`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), GraphQLCodeParseFailed)
+
+	limiter.AssertNotCalled(t, "ReserveN", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/gin-gonic/gin"
+)
+
+const clientKeyIPContextKey = "ratelimit.client_key_ip"
+
+type IPAggregationConfig struct {
+	// IPv4PrefixLength groups IPv4 clients by subnet, e.g. 24. 0 or 32 keeps
+	// individual addresses.
+	IPv4PrefixLength int
+	// IPv6PrefixLength groups IPv6 clients by subnet, e.g. 64. 0 or 128 keeps
+	// individual addresses.
+	IPv6PrefixLength int
+}
+
+// IPAggregation makes ClientKeyIP report the caller's subnet instead of its
+// address, so clients rotating addresses within a subnet share one budget.
+func IPAggregation(cfg IPAggregationConfig) (gin.HandlerFunc, error) {
+	if cfg.IPv4PrefixLength < 0 || cfg.IPv4PrefixLength > 32 {
+		return nil, fmt.Errorf("ipv4 prefix length must be between 0 and 32, got %d", cfg.IPv4PrefixLength)
+	}
+	if cfg.IPv6PrefixLength < 0 || cfg.IPv6PrefixLength > 128 {
+		return nil, fmt.Errorf("ipv6 prefix length must be between 0 and 128, got %d", cfg.IPv6PrefixLength)
+	}
+
+	return func(c *gin.Context) {
+		c.Set(clientKeyIPContextKey, aggregateIP(c.ClientIP(), cfg))
+		c.Next()
+	}, nil
+}
+
+// ClientKeyIP returns the client IP to use in rate-limit keys: the subnet set
+// by IPAggregation, or c.ClientIP() when the middleware is not installed.
+func ClientKeyIP(c *gin.Context) string {
+	if ip := c.GetString(clientKeyIPContextKey); ip != "" {
+		return ip
+	}
+	return c.ClientIP()
+}
+
+func aggregateIP(ip string, cfg IPAggregationConfig) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+
+	bits := cfg.IPv6PrefixLength
+	if addr.Is4() {
+		bits = cfg.IPv4PrefixLength
+	}
+	if bits == 0 || bits >= addr.BitLen() {
+		return addr.String()
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateIP(t *testing.T) {
+	cfg := IPAggregationConfig{IPv4PrefixLength: 24, IPv6PrefixLength: 64}
+
+	assert.Equal(t, "203.0.113.0/24", aggregateIP("203.0.113.77", cfg))
+	assert.Equal(t, "203.0.113.0/24", aggregateIP("::ffff:203.0.113.77", cfg), "IPv4-mapped addresses use the IPv4 prefix")
+	assert.Equal(t, "2001:db8:1:2::/64", aggregateIP("2001:db8:1:2:aaaa:bbbb:cccc:dddd", cfg))
+	assert.Equal(t, "not-an-ip", aggregateIP("not-an-ip", cfg))
+
+	assert.Equal(t, "203.0.113.77", aggregateIP("203.0.113.77", IPAggregationConfig{IPv6PrefixLength: 64}))
+	assert.Equal(t, "2001:db8::1", aggregateIP("2001:db8::1", IPAggregationConfig{IPv4PrefixLength: 24, IPv6PrefixLength: 128}))
+}
+
+func TestIPAggregation_SharesBudgetAcrossSubnet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	aggregation, err := IPAggregation(IPAggregationConfig{IPv4PrefixLength: 24, IPv6PrefixLength: 64})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(aggregation)
+	router.GET("/key", func(c *gin.Context) {
+		c.String(http.StatusOK, defaultKeyExtractor(c))
+	})
+
+	for _, remoteAddr := range []string{"198.51.100.1:1234", "198.51.100.254:1234"} {
+		req := httptest.NewRequest("GET", "/key", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "198.51.100.0/24", w.Body.String())
+	}
+}
+
+func TestIPAggregation_InvalidPrefix(t *testing.T) {
+	_, err := IPAggregation(IPAggregationConfig{IPv4PrefixLength: 33})
+	assert.Error(t, err)
+
+	_, err = IPAggregation(IPAggregationConfig{IPv6PrefixLength: -1})
+	assert.Error(t, err)
+}
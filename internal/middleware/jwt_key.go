@@ -0,0 +1,261 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	DefaultJWTClaim      = "sub"
+	DefaultJWKSRefresh   = time.Hour
+	jwksMinRefetch       = 10 * time.Second
+	jwksFetchTimeout     = 5 * time.Second
+	maxJWKSResponseBytes = 1 << 20
+)
+
+type JWTKeyConfig struct {
+	// Claim names the claim used as the rate-limit key, e.g. "sub" or "org_id".
+	Claim string
+	// HMACSecret enables HS256 tokens.
+	HMACSecret []byte
+	// RSAPublicKey enables RS256 tokens signed by a single key.
+	RSAPublicKey *rsa.PublicKey
+	// JWKSURL enables RS256 tokens whose kid is published in a JWKS document.
+	JWKSURL     string
+	JWKSRefresh time.Duration
+	HTTPClient  *http.Client
+}
+
+// NewJWTKeyExtractor returns a KeyExtractor that limits authenticated callers
+// by a claim of their bearer token. Requests without a valid token fall back
+// to the client IP, so anonymous traffic is still limited.
+func NewJWTKeyExtractor(cfg JWTKeyConfig) (func(c *gin.Context) string, error) {
+	if len(cfg.HMACSecret) == 0 && cfg.RSAPublicKey == nil && cfg.JWKSURL == "" {
+		return nil, errors.New("jwt key extractor needs an HMAC secret, an RSA public key or a JWKS URL")
+	}
+	if cfg.Claim == "" {
+		cfg.Claim = DefaultJWTClaim
+	}
+
+	var methods []string
+	if len(cfg.HMACSecret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.RSAPublicKey != nil || cfg.JWKSURL != "" {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+
+	var jwks *jwksCache
+	if cfg.JWKSURL != "" {
+		jwks = newJWKSCache(cfg.JWKSURL, cfg.JWKSRefresh, cfg.HTTPClient)
+	}
+
+	parser := jwt.NewParser(jwt.WithValidMethods(methods), jwt.WithExpirationRequired())
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.Alg() {
+		case jwt.SigningMethodHS256.Alg():
+			return cfg.HMACSecret, nil
+		case jwt.SigningMethodRS256.Alg():
+			kid, _ := token.Header["kid"].(string)
+			if jwks != nil && (kid != "" || cfg.RSAPublicKey == nil) {
+				return jwks.key(kid)
+			}
+			return cfg.RSAPublicKey, nil
+		}
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+
+	return func(c *gin.Context) string {
+		raw := bearerToken(c.GetHeader("Authorization"))
+		if raw == "" {
+			return ClientKeyIP(c)
+		}
+
+		claims := jwt.MapClaims{}
+		if _, err := parser.ParseWithClaims(raw, claims, keyFunc); err != nil {
+			slog.Debug("ignoring invalid jwt for rate limit key", "request_id", GetRequestID(c), "error", err.Error())
+			return ClientKeyIP(c)
+		}
+
+		value, ok := claims[cfg.Claim]
+		if !ok || value == nil || value == "" {
+			return ClientKeyIP(c)
+		}
+		return fmt.Sprintf("%s:%v", cfg.Claim, value)
+	}, nil
+}
+
+func bearerToken(header string) string {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// jwksCache serves RSA keys from a JWKS document, refetching it when it goes
+// stale or a token names an unknown kid (at most once per jwksMinRefetch).
+// The document is fetched outside mu by one caller at a time, so tokens with
+// known kids are verified while it is in flight.
+type jwksCache struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchErr  error
+	fetchedAt time.Time
+	// fetching is closed once the fetch in flight, if any, is done.
+	fetching chan struct{}
+}
+
+func newJWKSCache(url string, refresh time.Duration, client *http.Client) *jwksCache {
+	if refresh <= 0 {
+		refresh = DefaultJWKSRefresh
+	}
+	if client == nil {
+		client = &http.Client{Timeout: jwksFetchTimeout}
+	}
+	return &jwksCache{url: url, refresh: refresh, client: client}
+}
+
+func (j *jwksCache) key(kid string) (*rsa.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	since := time.Since(j.fetchedAt)
+	_, known := j.keys[kid]
+	switch {
+	case j.fetching != nil:
+		if !known {
+			// The fetch in flight may publish kid.
+			j.wait()
+		}
+	case since > j.refresh || (!known && since > jwksMinRefetch):
+		j.refetch()
+	}
+	if j.keys == nil && j.fetchErr != nil {
+		return nil, j.fetchErr
+	}
+
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	// A document with a single key is commonly used without kids.
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no jwks key with kid %q", kid)
+}
+
+// refetch fetches the document with mu released, keeping the keys already
+// fetched if it fails. It is called, and returns, with mu held.
+func (j *jwksCache) refetch() {
+	done := make(chan struct{})
+	j.fetching = done
+	j.fetchedAt = time.Now()
+	j.mu.Unlock()
+
+	keys, err := j.fetch()
+
+	j.mu.Lock()
+	if err == nil {
+		j.keys = keys
+	}
+	j.fetchErr = err
+	j.fetching = nil
+	close(done)
+}
+
+// wait waits for the fetch in flight with mu released.
+func (j *jwksCache) wait() {
+	done := j.fetching
+	j.mu.Unlock()
+	<-done
+	j.mu.Lock()
+}
+
+type jwksDocument struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+func (j *jwksCache) fetch() (map[string]*rsa.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var document jwksDocument
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, maxJWKSResponseBytes))
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(document.Keys))
+	for _, jwk := range document.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := parseRSAJWK(jwk.N, jwk.E)
+		if err != nil {
+			slog.Warn("skipping invalid jwks key", "kid", jwk.Kid, "error", err.Error())
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func parseRSAJWK(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("modulus: %w", err)
+	}
+	exponent, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("exponent: %w", err)
+	}
+	if len(exponent) == 0 || len(exponent) > 4 {
+		return nil, errors.New("exponent out of range")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(modulus),
+		E: int(new(big.Int).SetBytes(exponent).Int64()),
+	}, nil
+}
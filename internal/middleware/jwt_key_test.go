@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func extractKey(t *testing.T, extractor func(c *gin.Context) string, authorization string) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Request.RemoteAddr = "192.0.2.1:1234"
+	if authorization != "" {
+		c.Request.Header.Set("Authorization", authorization)
+	}
+	return extractor(c)
+}
+
+func signHS256(t *testing.T, secret []byte, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	require.NoError(t, err)
+	return "Bearer " + token
+}
+
+func TestJWTKeyExtractor_HS256(t *testing.T) {
+	secret := []byte("test-secret")
+	extractor, err := NewJWTKeyExtractor(JWTKeyConfig{HMACSecret: secret})
+	require.NoError(t, err)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	assert.Equal(t, "sub:user-1", extractKey(t, extractor, signHS256(t, secret, jwt.MapClaims{"sub": "user-1", "exp": exp})))
+
+	assert.Equal(t, "192.0.2.1", extractKey(t, extractor, ""), "anonymous traffic is keyed by IP")
+	assert.Equal(t, "192.0.2.1", extractKey(t, extractor, signHS256(t, []byte("other"), jwt.MapClaims{"sub": "user-1", "exp": exp})), "bad signature")
+	assert.Equal(t, "192.0.2.1", extractKey(t, extractor, signHS256(t, secret, jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(-time.Hour).Unix()})), "expired")
+	assert.Equal(t, "192.0.2.1", extractKey(t, extractor, signHS256(t, secret, jwt.MapClaims{"sub": "user-1"})), "no expiry")
+}
+
+func TestJWTKeyExtractor_CustomClaim(t *testing.T) {
+	secret := []byte("test-secret")
+	extractor, err := NewJWTKeyExtractor(JWTKeyConfig{HMACSecret: secret, Claim: "org_id"})
+	require.NoError(t, err)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	assert.Equal(t, "org_id:42", extractKey(t, extractor, signHS256(t, secret, jwt.MapClaims{"sub": "user-1", "org_id": 42, "exp": exp})))
+	assert.Equal(t, "192.0.2.1", extractKey(t, extractor, signHS256(t, secret, jwt.MapClaims{"sub": "user-1", "exp": exp})), "missing claim")
+}
+
+func TestJWTKeyExtractor_RS256WithJWKS(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	fetches := 0
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"keys":[{"kty":"RSA","kid":"k1","use":"sig","n":"` +
+			base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()) + `","e":"` +
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()) + `"}]}`))
+	}))
+	defer jwks.Close()
+
+	extractor, err := NewJWTKeyExtractor(JWTKeyConfig{JWKSURL: jwks.URL})
+	require.NoError(t, err)
+
+	sign := func(kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "user-2", "exp": time.Now().Add(time.Hour).Unix()})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(privateKey)
+		require.NoError(t, err)
+		return "Bearer " + signed
+	}
+
+	assert.Equal(t, "sub:user-2", extractKey(t, extractor, sign("k1")))
+	assert.Equal(t, "sub:user-2", extractKey(t, extractor, sign("k1")))
+	assert.Equal(t, 1, fetches, "keys are cached")
+
+	assert.Equal(t, "192.0.2.1", extractKey(t, extractor, sign("unknown")))
+	assert.Equal(t, 1, fetches, "unknown kids don't refetch more than once per interval")
+}
+
+func TestJWKSCache_FetchesOutsideLock(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	requested := make(chan struct{}, 1)
+	release := make(chan struct{})
+	fetches := 0
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if fetches > 1 {
+			requested <- struct{}{}
+			<-release
+		}
+		_, _ = w.Write([]byte(`{"keys":[{"kty":"RSA","kid":"k1","n":"` +
+			base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()) + `","e":"` +
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()) + `"}]}`))
+	}))
+	defer jwks.Close()
+
+	cache := newJWKSCache(jwks.URL, time.Hour, nil)
+	_, err = cache.key("k1")
+	require.NoError(t, err)
+
+	cache.mu.Lock()
+	cache.fetchedAt = time.Now().Add(-time.Minute)
+	cache.mu.Unlock()
+	unknown := make(chan error, 2)
+	go func() {
+		_, err := cache.key("k2")
+		unknown <- err
+	}()
+	<-requested
+
+	known := make(chan error, 1)
+	go func() {
+		_, err := cache.key("k1")
+		known <- err
+	}()
+	select {
+	case err := <-known:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("a known kid waited for the JWKS fetch")
+	}
+
+	go func() {
+		_, err := cache.key("k3")
+		unknown <- err
+	}()
+	close(release)
+	assert.ErrorContains(t, <-unknown, "no jwks key")
+	assert.ErrorContains(t, <-unknown, "no jwks key")
+	assert.Equal(t, 2, fetches, "unknown kids wait for the fetch in flight")
+}
+
+func TestJWTKeyExtractor_RS256StaticKey(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	extractor, err := NewJWTKeyExtractor(JWTKeyConfig{RSAPublicKey: &privateKey.PublicKey})
+	require.NoError(t, err)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "user-3", "exp": time.Now().Add(time.Hour).Unix()}).SignedString(privateKey)
+	require.NoError(t, err)
+	assert.Equal(t, "sub:user-3", extractKey(t, extractor, "Bearer "+token))
+
+	// An HS256 token must not be accepted when only RSA keys are configured.
+	assert.Equal(t, "192.0.2.1", extractKey(t, extractor, signHS256(t, []byte("secret"), jwt.MapClaims{"sub": "user-3", "exp": time.Now().Add(time.Hour).Unix()})))
+}
+
+func TestNewJWTKeyExtractor_RequiresKey(t *testing.T) {
+	_, err := NewJWTKeyExtractor(JWTKeyConfig{})
+	assert.Error(t, err)
+}
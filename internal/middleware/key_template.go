@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/rules"
+)
+
+type KeyTemplateSource string
+
+const (
+	// KeyTemplateHeader reads the request header named by the variable's
+	// Field.
+	KeyTemplateHeader KeyTemplateSource = "header"
+	// KeyTemplateIP is the client IP, aggregated like the default key.
+	KeyTemplateIP KeyTemplateSource = "ip"
+	// KeyTemplateRoute is the Gin route template, e.g. "/api/users/:id", or
+	// "unmatched".
+	KeyTemplateRoute KeyTemplateSource = "route"
+	// KeyTemplateMethod is the HTTP method.
+	KeyTemplateMethod KeyTemplateSource = "method"
+	// KeyTemplateTier is the caller's plan from the tier header.
+	KeyTemplateTier KeyTemplateSource = "tier"
+)
+
+// KeyTemplateVariable names a value a template can use, e.g. a tenant read
+// from a header.
+type KeyTemplateVariable struct {
+	Source KeyTemplateSource
+	// Field is the header name for KeyTemplateHeader.
+	Field string
+}
+
+type KeyTemplateConfig struct {
+	// Template is the key with placeholders in braces, e.g.
+	// "{tenant}:{route}:{method}". A placeholder is a variable, a source
+	// other than header, or "header:<name>".
+	Template  string
+	Variables map[string]KeyTemplateVariable
+	// TierHeader carries the tier; rules.DefaultTierHeader when empty.
+	TierHeader string
+	// Fallback keys requests missing a value of the template; the default
+	// key extractor when nil.
+	Fallback func(c *gin.Context) string
+}
+
+// keySegment is a literal part of a template, or a value read from the
+// request when source is set.
+type keySegment struct {
+	literal string
+	source  KeyTemplateSource
+	field   string
+}
+
+// NewKeyTemplateExtractor returns a KeyExtractor building keys from a
+// template, so that combinations of headers, route and method can be keyed
+// without writing an extractor. A request missing any of the template's
+// values, such as a header it doesn't send, gets the Fallback key rather
+// than sharing a key with every other request missing it.
+func NewKeyTemplateExtractor(cfg KeyTemplateConfig) (func(c *gin.Context) string, error) {
+	segments, err := parseKeyTemplate(cfg.Template, cfg.Variables)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TierHeader == "" {
+		cfg.TierHeader = rules.DefaultTierHeader
+	}
+	if cfg.Fallback == nil {
+		cfg.Fallback = defaultKeyExtractor
+	}
+
+	return func(c *gin.Context) string {
+		var b strings.Builder
+		for _, segment := range segments {
+			if segment.source == "" {
+				b.WriteString(segment.literal)
+				continue
+			}
+			value := keyTemplateValue(c, segment, cfg.TierHeader)
+			if value == "" {
+				return cfg.Fallback(c)
+			}
+			b.WriteString(value)
+		}
+		return b.String()
+	}, nil
+}
+
+func parseKeyTemplate(template string, variables map[string]KeyTemplateVariable) ([]keySegment, error) {
+	if template == "" {
+		return nil, errors.New("key template is empty")
+	}
+	for name, variable := range variables {
+		if err := checkKeyTemplateVariable(variable); err != nil {
+			return nil, fmt.Errorf("key template variable %q: %w", name, err)
+		}
+	}
+
+	var segments []keySegment
+	placeholders := 0
+	rest := template
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			segments = append(segments, keySegment{literal: rest})
+			break
+		}
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("key template %q: unexpected }", template)
+		}
+		if open > 0 {
+			segments = append(segments, keySegment{literal: rest[:open]})
+		}
+		end := strings.IndexAny(rest[open+1:], "{}")
+		if end < 0 || rest[open+1+end] != '}' {
+			return nil, fmt.Errorf("key template %q: unclosed {", template)
+		}
+		name := rest[open+1 : open+1+end]
+		segment, err := keyTemplatePlaceholder(name, variables)
+		if err != nil {
+			return nil, fmt.Errorf("key template %q: %w", template, err)
+		}
+		segments = append(segments, segment)
+		placeholders++
+		rest = rest[open+1+end+1:]
+	}
+	if placeholders == 0 {
+		return nil, fmt.Errorf("key template %q has no placeholders, so every request would share one key", template)
+	}
+	return segments, nil
+}
+
+func keyTemplatePlaceholder(name string, variables map[string]KeyTemplateVariable) (keySegment, error) {
+	if variable, ok := variables[name]; ok {
+		return keySegment{source: variable.Source, field: variable.Field}, nil
+	}
+	if header, ok := strings.CutPrefix(name, string(KeyTemplateHeader)+":"); ok && header != "" {
+		return keySegment{source: KeyTemplateHeader, field: header}, nil
+	}
+	switch source := KeyTemplateSource(name); source {
+	case KeyTemplateIP, KeyTemplateRoute, KeyTemplateMethod, KeyTemplateTier:
+		return keySegment{source: source}, nil
+	}
+	return keySegment{}, fmt.Errorf("unknown placeholder {%s}", name)
+}
+
+func checkKeyTemplateVariable(variable KeyTemplateVariable) error {
+	switch variable.Source {
+	case KeyTemplateHeader:
+		if variable.Field == "" {
+			return errors.New("header variables need a field")
+		}
+	case KeyTemplateIP, KeyTemplateRoute, KeyTemplateMethod, KeyTemplateTier:
+	default:
+		return fmt.Errorf("unknown source %q", variable.Source)
+	}
+	return nil
+}
+
+func keyTemplateValue(c *gin.Context, segment keySegment, tierHeader string) string {
+	switch segment.source {
+	case KeyTemplateHeader:
+		return c.GetHeader(segment.field)
+	case KeyTemplateIP:
+		return ClientKeyIP(c)
+	case KeyTemplateRoute:
+		if route := c.FullPath(); route != "" {
+			return route
+		}
+		return "unmatched"
+	case KeyTemplateMethod:
+		return c.Request.Method
+	case KeyTemplateTier:
+		return strings.ToLower(c.GetHeader(tierHeader))
+	}
+	return ""
+}
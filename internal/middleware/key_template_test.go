@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyTemplateExtractor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	extractor, err := NewKeyTemplateExtractor(KeyTemplateConfig{
+		Template: "{tenant}:{tier}:{route}:{method}",
+		Variables: map[string]KeyTemplateVariable{
+			"tenant": {Source: KeyTemplateHeader, Field: "X-Tenant-ID"},
+		},
+	})
+	require.NoError(t, err)
+	ipExtractor, err := NewKeyTemplateExtractor(KeyTemplateConfig{
+		Template:   "ip={ip}/{header:X-Region}",
+		TierHeader: "X-Plan",
+	})
+	require.NoError(t, err)
+
+	router := gin.New()
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, extractor(c)+"|"+ipExtractor(c))
+	}
+	router.GET("/users/:id", handler)
+	router.POST("/users/:id", handler)
+
+	key := func(method string, header http.Header) string {
+		req := httptest.NewRequest(method, "/users/7", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	header := http.Header{"X-Tenant-Id": {"acme"}, "X-Ratelimit-Tier": {"Pro"}, "X-Region": {"eu"}}
+	assert.Equal(t, "acme:pro:/users/:id:GET|ip=192.0.2.1/eu", key("GET", header))
+	assert.Equal(t, "acme:pro:/users/:id:POST|ip=192.0.2.1/eu", key("POST", header))
+	assert.Equal(t, "192.0.2.1|192.0.2.1", key("GET", nil), "requests missing a value use the fallback key")
+	assert.Equal(t, "client-7|ip=192.0.2.1/eu", key("GET", http.Header{"X-Client-Id": {"client-7"}, "X-Region": {"eu"}}))
+}
+
+func TestKeyTemplateExtractor_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  KeyTemplateConfig
+	}{
+		{"empty", KeyTemplateConfig{}},
+		{"no placeholders", KeyTemplateConfig{Template: "everyone"}},
+		{"unknown placeholder", KeyTemplateConfig{Template: "{tenant}:{route}"}},
+		{"unclosed", KeyTemplateConfig{Template: "{route"}},
+		{"nested", KeyTemplateConfig{Template: "{a{route}}"}},
+		{"stray brace", KeyTemplateConfig{Template: "route}"}},
+		{"header without name", KeyTemplateConfig{Template: "{header:}"}},
+		{"variable without field", KeyTemplateConfig{
+			Template:  "{tenant}",
+			Variables: map[string]KeyTemplateVariable{"tenant": {Source: KeyTemplateHeader}},
+		}},
+		{"variable with unknown source", KeyTemplateConfig{
+			Template:  "{tenant}",
+			Variables: map[string]KeyTemplateVariable{"tenant": {Source: "cookie", Field: "t"}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyTemplateExtractor(tt.cfg)
+			assert.Error(t, err)
+		})
+	}
+}
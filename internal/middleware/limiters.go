@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+// NamedLimiters are limiters configured by name, e.g. "login", "search" and
+// "export", each with its own strategy and limits, so routes can pick the one
+// that fits them rather than all sharing the default limit.
+type NamedLimiters struct {
+	handlers map[string]gin.HandlerFunc
+}
+
+// NewNamedLimiters runs each of limiters through RateLimit with its own copy
+// of config.
+func NewNamedLimiters(limiters map[string]ratelimit.RateLimiter, config *RateLimitConfig) *NamedLimiters {
+	if config == nil {
+		config = &RateLimitConfig{}
+	}
+
+	handlers := make(map[string]gin.HandlerFunc, len(limiters))
+	for name, rateLimiter := range limiters {
+		limiterConfig := *config
+		handlers[name] = RateLimit(rateLimiter, &limiterConfig)
+	}
+	return &NamedLimiters{handlers: handlers}
+}
+
+// Limit returns the middleware of the limiter called name, for routes
+// registered in code. Unknown names are an error rather than unlimited
+// routes.
+func (n *NamedLimiters) Limit(name string) (gin.HandlerFunc, error) {
+	handler, ok := n.handlers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown limiter %q (want one of %s)", name, strings.Join(n.Names(), ", "))
+	}
+	return handler, nil
+}
+
+// Names returns the limiters' names, sorted.
+func (n *NamedLimiters) Names() []string {
+	names := make([]string, 0, len(n.handlers))
+	for name := range n.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RouteLimit limits the requests of a route with a named limiter.
+type RouteLimit struct {
+	// Path is the Gin route template, e.g. "/api/users/:id".
+	Path string
+	// Method restricts the route to one HTTP method; empty matches any.
+	Method  string
+	Limiter string
+}
+
+// Routes returns middleware limiting the requests of routes with their
+// limiters, the first matching route winning. Other requests go to fallback,
+// or pass through when it is nil, as do requests a rule already decided, so
+// it can follow Rules.
+func (n *NamedLimiters) Routes(routes []RouteLimit, fallback gin.HandlerFunc) (gin.HandlerFunc, error) {
+	handlers := make([]gin.HandlerFunc, len(routes))
+	for i, route := range routes {
+		handler, err := n.Limit(route.Limiter)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Path, err)
+		}
+		handlers[i] = handler
+	}
+
+	return func(c *gin.Context) {
+		if GetRule(c) != "" {
+			c.Next()
+			return
+		}
+		for i, route := range routes {
+			if route.Path == c.FullPath() && (route.Method == "" || strings.EqualFold(route.Method, c.Request.Method)) {
+				handlers[i](c)
+				return
+			}
+		}
+		if fallback == nil {
+			c.Next()
+			return
+		}
+		fallback(c)
+	}, nil
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamedLimiters_Routes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	login := new(MockRateLimiter)
+	login.On("IsAllowed", mock.Anything, mock.Anything, mock.Anything).Return(ratelimit.RateLimitResponse{Limit: 5}, nil)
+	search := new(MockRateLimiter)
+	search.On("IsAllowed", mock.Anything, mock.Anything, mock.Anything).Return(ratelimit.RateLimitResponse{Allowed: true, Limit: 50, Remaining: 49}, nil)
+	limiters := NewNamedLimiters(map[string]ratelimit.RateLimiter{"login": login, "search": search}, nil)
+
+	fallback := func(c *gin.Context) {
+		c.Header("X-Fallback", "1")
+		c.Next()
+	}
+	routes, err := limiters.Routes([]RouteLimit{
+		{Path: "/login", Method: http.MethodPost, Limiter: "login"},
+		{Path: "/search/:term", Limiter: "search"},
+	}, fallback)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(routes)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST("/login", ok)
+	router.GET("/login", ok)
+	router.GET("/search/:term", ok)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := serve(http.MethodPost, "/login")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "5", w.Header().Get("RateLimit-Limit"))
+
+	w = serve(http.MethodGet, "/search/shoes")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "50", w.Header().Get("RateLimit-Limit"))
+
+	w = serve(http.MethodGet, "/login")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Fallback"), "other methods use the fallback")
+	login.AssertNumberOfCalls(t, "IsAllowed", 1)
+}
+
+func TestNamedLimiters_UnknownLimiter(t *testing.T) {
+	limiters := NewNamedLimiters(map[string]ratelimit.RateLimiter{"login": new(MockRateLimiter)}, nil)
+
+	_, err := limiters.Limit("export")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown limiter "export" (want one of login)`)
+
+	_, err = limiters.Routes([]RouteLimit{{Path: "/export", Limiter: "export"}}, nil)
+	assert.Error(t, err)
+}
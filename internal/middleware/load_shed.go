@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"runtime"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+)
+
+// DefaultLoadShedSampleInterval is how often a LoadShedder samples the
+// goroutine count and CPU usage when no interval is configured.
+const DefaultLoadShedSampleInterval = time.Second
+
+// DefaultShedFrom is the pressure at which a LoadShedder starts shedding
+// when none is configured.
+const DefaultShedFrom = 0.8
+
+type LoadShedConfig struct {
+	// MaxInFlight is the number of requests in flight through LoadShed at
+	// full load. Zero ignores in-flight requests.
+	MaxInFlight int64
+	// MaxGoroutines is the goroutine count at full load. Zero ignores it.
+	MaxGoroutines int
+	// MaxCPU is the process CPU usage at full load, as a fraction of the
+	// cores Go may use, e.g. 0.9. Zero ignores CPU.
+	MaxCPU float64
+	// ShedFrom is the pressure, as a fraction of full load, at which the
+	// lowest priority is shed; DefaultShedFrom when zero. Higher priorities
+	// are shed at evenly spaced points after it, the highest only at full
+	// load.
+	ShedFrom float64
+	// Priorities ranks request classes: the higher the priority, the longer
+	// the class is admitted. Classes not listed, and unclassified requests,
+	// get DefaultPriority.
+	Priorities      map[string]int
+	DefaultPriority int
+	// SampleInterval is how often Run samples the goroutine count and CPU
+	// usage; DefaultLoadShedSampleInterval when zero.
+	SampleInterval time.Duration
+	// RetryAfter is sent to shed clients; 1s when zero.
+	RetryAfter time.Duration
+	// Collector records shed requests and the sampled pressure.
+	Collector metrics.Collector
+}
+
+// LoadShedder tracks how loaded the node is, from requests in flight,
+// goroutines and CPU, and decides which priorities LoadShed rejects. Unlike
+// the rate limits, which share a budget per key across nodes, it protects
+// the node itself, so a burst spread over many keys can't take it down.
+type LoadShedder struct {
+	cfg    LoadShedConfig
+	levels []int
+
+	inFlight   atomic.Int64
+	goroutines atomic.Int64
+	cpu        atomic.Uint64 // float64 bits
+}
+
+// NewLoadShedder returns a LoadShedder for cfg. Goroutines and CPU only
+// count once Run is sampling them.
+func NewLoadShedder(cfg LoadShedConfig) *LoadShedder {
+	if cfg.ShedFrom <= 0 || cfg.ShedFrom > 1 {
+		cfg.ShedFrom = DefaultShedFrom
+	}
+	if cfg.SampleInterval <= 0 {
+		cfg.SampleInterval = DefaultLoadShedSampleInterval
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	if cfg.Collector == nil {
+		cfg.Collector = &metrics.NoopCollector{}
+	}
+
+	levels := []int{cfg.DefaultPriority}
+	for _, priority := range cfg.Priorities {
+		levels = append(levels, priority)
+	}
+	slices.Sort(levels)
+	return &LoadShedder{cfg: cfg, levels: slices.Compact(levels)}
+}
+
+// Run samples the goroutine count and CPU usage every SampleInterval until
+// ctx is done.
+func (s *LoadShedder) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.SampleInterval)
+	defer ticker.Stop()
+
+	lastCPU, cpuOK := processCPUTime()
+	lastSample := time.Now()
+	if !cpuOK && s.cfg.MaxCPU > 0 {
+		slog.Warn("process CPU usage is unavailable on this platform; load shedding ignores it")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.goroutines.Store(int64(runtime.NumGoroutine()))
+			if cpu, ok := processCPUTime(); ok && cpuOK {
+				if elapsed := now.Sub(lastSample); elapsed > 0 {
+					usage := float64(cpu-lastCPU) / float64(elapsed) / float64(runtime.GOMAXPROCS(0))
+					s.cpu.Store(math.Float64bits(usage))
+				}
+				lastCPU = cpu
+			}
+			lastSample = now
+			s.cfg.Collector.SetLoadPressure(s.Pressure())
+		}
+	}
+}
+
+// Pressure returns the node's load as a fraction of full load: the highest
+// of its in-flight requests, goroutines and CPU usage against their limits.
+func (s *LoadShedder) Pressure() float64 {
+	var pressure float64
+	if s.cfg.MaxInFlight > 0 {
+		pressure = max(pressure, float64(s.inFlight.Load())/float64(s.cfg.MaxInFlight))
+	}
+	if s.cfg.MaxGoroutines > 0 {
+		pressure = max(pressure, float64(s.goroutines.Load())/float64(s.cfg.MaxGoroutines))
+	}
+	if s.cfg.MaxCPU > 0 {
+		pressure = max(pressure, math.Float64frombits(s.cpu.Load())/s.cfg.MaxCPU)
+	}
+	return pressure
+}
+
+// Sheds reports whether requests of class are rejected at pressure. The
+// lowest priority is shed from ShedFrom and the highest at full load; with a
+// single priority, everything is shed at full load.
+func (s *LoadShedder) Sheds(class string, pressure float64) bool {
+	priority, ok := s.cfg.Priorities[class]
+	if !ok {
+		priority = s.cfg.DefaultPriority
+	}
+	if len(s.levels) == 1 {
+		return pressure >= 1
+	}
+
+	level, _ := slices.BinarySearch(s.levels, priority)
+	step := (1 - s.cfg.ShedFrom) / float64(len(s.levels)-1)
+	return pressure >= s.cfg.ShedFrom+float64(level)*step
+}
+
+// LoadShed rejects requests with 503 while the node is too loaded for their
+// class's priority, as decided by shedder, before they cost a rate limit
+// check. The class comes from Classify, which must run first for priorities
+// to apply.
+func LoadShed(shedder *LoadShedder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class := GetClass(c)
+		if shedder.Sheds(class, shedder.Pressure()) {
+			// Not logged: an overloaded node can't afford a line per request.
+			shedder.cfg.Collector.RecordLoadShed(class)
+			SetRetryAfter(c, shedder.cfg.RetryAfter)
+			body := NewErrorResponse(c, http.StatusServiceUnavailable, "Server overloaded", "The server is too busy to handle this request").WithRetryAfter(shedder.cfg.RetryAfter)
+			WriteError(c, http.StatusServiceUnavailable, body)
+			c.Abort()
+			return
+		}
+
+		shedder.inFlight.Add(1)
+		defer shedder.inFlight.Add(-1)
+		c.Next()
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package middleware
+
+import "time"
+
+// processCPUTime is unavailable outside unix, so CPU isn't a load signal
+// there.
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
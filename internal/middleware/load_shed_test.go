@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type shedCollector struct {
+	metrics.NoopCollector
+	shed     []string
+	pressure chan float64
+}
+
+func (c *shedCollector) RecordLoadShed(class string) {
+	c.shed = append(c.shed, class)
+}
+
+func (c *shedCollector) SetLoadPressure(pressure float64) {
+	select {
+	case c.pressure <- pressure:
+	default:
+	}
+}
+
+func TestLoadShedder_Sheds(t *testing.T) {
+	shedder := NewLoadShedder(LoadShedConfig{
+		ShedFrom:        0.6,
+		Priorities:      map[string]int{ClassBot: 0, ClassInternal: 2},
+		DefaultPriority: 1,
+	})
+
+	tests := []struct {
+		pressure float64
+		shed     []string
+	}{
+		{0.5, nil},
+		{0.6, []string{ClassBot}},
+		{0.79, []string{ClassBot}},
+		{0.8, []string{ClassBot, ClassAnonymous, ""}},
+		{1, []string{ClassBot, ClassAnonymous, "", ClassInternal}},
+	}
+	for _, tt := range tests {
+		var shed []string
+		for _, class := range []string{ClassBot, ClassAnonymous, "", ClassInternal} {
+			if shedder.Sheds(class, tt.pressure) {
+				shed = append(shed, class)
+			}
+		}
+		assert.Equal(t, tt.shed, shed, "pressure %v", tt.pressure)
+	}
+
+	single := NewLoadShedder(LoadShedConfig{})
+	assert.False(t, single.Sheds(ClassBot, 0.99))
+	assert.True(t, single.Sheds(ClassBot, 1))
+}
+
+func TestLoadShed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	collector := &shedCollector{}
+	shedder := NewLoadShedder(LoadShedConfig{
+		MaxInFlight:     2,
+		ShedFrom:        0.5,
+		Priorities:      map[string]int{ClassBot: 0},
+		DefaultPriority: 1,
+		RetryAfter:      2 * time.Second,
+		Collector:       collector,
+	})
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		c.Set(classContextKey, c.Query("class"))
+	}, LoadShed(shedder), func(c *gin.Context) {
+		if c.Query("block") != "" {
+			entered <- struct{}{}
+			<-release
+		}
+		c.Status(http.StatusOK)
+	})
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/?class=bot").Code)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve("/?class=internal&block=1")
+	}()
+	<-entered
+	assert.Equal(t, 0.5, shedder.Pressure())
+
+	w := serve("/?class=bot")
+	require.Equal(t, http.StatusServiceUnavailable, w.Code, "bots are shed from half load")
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), string(CodeUnavailable))
+	assert.Equal(t, http.StatusOK, serve("/?class=internal").Code)
+
+	close(release)
+	<-done
+	assert.Equal(t, http.StatusOK, serve("/?class=bot").Code, "in-flight requests are released")
+	assert.Equal(t, []string{ClassBot}, collector.shed)
+}
+
+func TestLoadShedder_Run(t *testing.T) {
+	collector := &shedCollector{pressure: make(chan float64, 1)}
+	shedder := NewLoadShedder(LoadShedConfig{
+		MaxGoroutines:  1,
+		SampleInterval: 10 * time.Millisecond,
+		Collector:      collector,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go shedder.Run(ctx)
+
+	select {
+	case pressure := <-collector.pressure:
+		assert.GreaterOrEqual(t, pressure, 1.0, "the test runs more than one goroutine")
+	case <-time.After(time.Second):
+		t.Fatal("no sample taken")
+	}
+	assert.True(t, shedder.Sheds("", shedder.Pressure()))
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+// MessageCatalog translates the messages of error responses, such as the
+// title and message of a 429, which public APIs often show their users as
+// they are. Messages are looked up by their English text, or by the format
+// string of those with values in them, e.g. "Rate limit exceeded: the
+// operation costs %d".
+type MessageCatalog interface {
+	// Languages lists the languages the catalog translates into.
+	Languages() []language.Tag
+	Translate(lang language.Tag, message string) (string, bool)
+}
+
+// Messages is a MessageCatalog held in memory.
+type Messages map[language.Tag]map[string]string
+
+// Add registers translation as message in lang.
+func (m Messages) Add(lang language.Tag, message, translation string) {
+	if m[lang] == nil {
+		m[lang] = make(map[string]string)
+	}
+	m[lang][message] = translation
+}
+
+func (m Messages) Languages() []language.Tag {
+	languages := make([]language.Tag, 0, len(m))
+	for lang := range m {
+		languages = append(languages, lang)
+	}
+	return languages
+}
+
+func (m Messages) Translate(lang language.Tag, message string) (string, bool) {
+	translation, ok := m[lang][message]
+	return translation, ok
+}
+
+const (
+	localeContextKey    = "locale"
+	localizedContextKey = "localized"
+)
+
+type locale struct {
+	lang    language.Tag
+	catalog MessageCatalog
+}
+
+// Localize translates the error responses written through NewErrorResponse
+// into the language of the request's Accept-Language that catalog matches
+// best. Requests preferring English, or a language catalog doesn't know,
+// and messages it has no translation for, get English.
+func Localize(catalog MessageCatalog) gin.HandlerFunc {
+	// English comes first, so it is the fallback.
+	supported := append([]language.Tag{language.English}, catalog.Languages()...)
+	matcher := language.NewMatcher(supported)
+
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		if accept := c.GetHeader("Accept-Language"); accept != "" {
+			tags, _, err := language.ParseAcceptLanguage(accept)
+			if err == nil && len(tags) > 0 {
+				_, index, confidence := matcher.Match(tags...)
+				if confidence != language.No && index > 0 {
+					c.Set(localeContextKey, locale{lang: supported[index], catalog: catalog})
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+// Localized returns message in the request's language, when Localize picked
+// one for it and its catalog has a translation.
+func Localized(c *gin.Context, message string) string {
+	value, ok := c.Get(localeContextKey)
+	if !ok {
+		return message
+	}
+	l := value.(locale)
+	translation, ok := l.catalog.Translate(l.lang, message)
+	if !ok {
+		return message
+	}
+	c.Set(localizedContextKey, l.lang)
+	return translation
+}
+
+// Localizedf formats the translation of format with args.
+func Localizedf(c *gin.Context, format string, args ...interface{}) string {
+	return fmt.Sprintf(Localized(c, format), args...)
+}
+
+// setContentLanguage reports the language of a response that was
+// translated.
+func setContentLanguage(c *gin.Context) {
+	if value, ok := c.Get(localizedContextKey); ok {
+		c.Header("Content-Language", value.(language.Tag).String())
+	}
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+)
+
+func TestLocalize_RateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	messages := Messages{}
+	messages.Add(language.French, "Rate limit exceeded", "Limite de requêtes dépassée")
+	messages.Add(language.French, "Too many requests", "Trop de requêtes")
+	messages.Add(language.German, "Rate limit exceeded", "Ratenlimit überschritten")
+
+	mockLimiter := new(MockRateLimiter)
+	mockLimiter.On("IsAllowed", mock.Anything, mock.Anything, mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: false, Limit: 10, ResetTime: time.Now().Add(time.Minute)}, nil)
+
+	router := gin.New()
+	router.Use(Localize(messages))
+	router.GET("/test", RateLimit(mockLimiter), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name            string
+		acceptLanguage  string
+		wantTitle       string
+		wantMessage     string
+		contentLanguage string
+	}{
+		{name: "regional variant", acceptLanguage: "fr-CA,fr;q=0.9,en;q=0.5", wantTitle: "Limite de requêtes dépassée", wantMessage: "Trop de requêtes", contentLanguage: "fr"},
+		{name: "untranslated message stays English", acceptLanguage: "de", wantTitle: "Ratenlimit überschritten", wantMessage: "Too many requests", contentLanguage: "de"},
+		{name: "English preferred", acceptLanguage: "en-US,fr;q=0.8", wantTitle: "Rate limit exceeded", wantMessage: "Too many requests"},
+		{name: "unknown language", acceptLanguage: "ja", wantTitle: "Rate limit exceeded", wantMessage: "Too many requests"},
+		{name: "no header", wantTitle: "Rate limit exceeded", wantMessage: "Too many requests"},
+		{name: "malformed header", acceptLanguage: "fr;q=x;;", wantTitle: "Rate limit exceeded", wantMessage: "Too many requests"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/test", nil)
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusTooManyRequests, w.Code)
+			var body ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tt.wantTitle, body.Error)
+			assert.Equal(t, tt.wantMessage, body.Message)
+			assert.Equal(t, CodeRateLimited, body.Code, "codes aren't translated")
+			assert.Equal(t, tt.contentLanguage, w.Header().Get("Content-Language"))
+			assert.Equal(t, "Accept-Language", w.Header().Get("Vary"))
+		})
+	}
+}
+
+func TestLocalizedf(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	messages := Messages{}
+	messages.Add(language.French, "Rate limit exceeded: the operation costs %d", "Limite de requêtes dépassée : l'opération coûte %d")
+
+	var got string
+	router := gin.New()
+	router.Use(Localize(messages))
+	router.GET("/test", func(c *gin.Context) {
+		got = Localizedf(c, "Rate limit exceeded: the operation costs %d", 31)
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Accept-Language", "fr")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "Limite de requêtes dépassée : l'opération coûte 31", got)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	assert.Equal(t, "Rate limit exceeded: the operation costs 31", Localizedf(c, "Rate limit exceeded: the operation costs %d", 31), "without Localize messages stay English")
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+)
+
+// ModeHeader tells downstream services whether the limit was applied:
+// "enforced", "degraded" or "dry-run".
+const ModeHeader = "X-RateLimit-Mode"
+
+type ModeConfig struct {
+	// DryRun evaluates every request but lets denied ones through.
+	DryRun bool
+	// FailOpen lets requests through unchecked when the limiter fails,
+	// instead of answering 500. The mode is degraded until a check succeeds
+	// again.
+	FailOpen  bool
+	Collector metrics.Collector
+}
+
+// ModeTracker reports the limiter's operating mode in the ModeHeader of every
+// rate limited response and in the collector's mode gauge.
+type ModeTracker struct {
+	dryRun    bool
+	failOpen  bool
+	collector metrics.Collector
+	degraded  atomic.Bool
+}
+
+func NewModeTracker(cfg ModeConfig) *ModeTracker {
+	collector := cfg.Collector
+	if collector == nil {
+		collector = metrics.NewNoopCollector()
+	}
+
+	tracker := &ModeTracker{
+		dryRun:    cfg.DryRun,
+		failOpen:  cfg.FailOpen,
+		collector: collector,
+	}
+	collector.SetMode(tracker.Mode())
+	return tracker
+}
+
+// Mode returns the current operating mode. A nil tracker is always enforced.
+func (m *ModeTracker) Mode() string {
+	switch {
+	case m == nil:
+		return metrics.ModeEnforced
+	case m.degraded.Load():
+		return metrics.ModeDegraded
+	case m.dryRun:
+		return metrics.ModeDryRun
+	default:
+		return metrics.ModeEnforced
+	}
+}
+
+// DryRun reports whether denied requests are let through.
+func (m *ModeTracker) DryRun() bool {
+	return m != nil && m.dryRun
+}
+
+// failsOpen reports whether requests should go through when the limiter
+// fails. A dry run never blocks, so it always does.
+func (m *ModeTracker) failsOpen() bool {
+	return m != nil && (m.failOpen || m.dryRun)
+}
+
+// recordCheck notes whether the last limiter check succeeded, updating the
+// gauge when that changes the mode.
+func (m *ModeTracker) recordCheck(failed bool) {
+	if m == nil {
+		return
+	}
+	if m.degraded.CompareAndSwap(!failed, failed) {
+		m.collector.SetMode(m.Mode())
+	}
+}
+
+func (m *ModeTracker) setHeader(c *gin.Context) {
+	if m != nil {
+		c.Header(ModeHeader, m.Mode())
+	}
+}
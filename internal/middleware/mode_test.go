@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type modeCollector struct {
+	metrics.NoopCollector
+	modes []string
+}
+
+func (m *modeCollector) SetMode(mode string) {
+	m.modes = append(m.modes, mode)
+}
+
+func serveMode(limiter *MockRateLimiter, tracker *ModeTracker) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/test", RateLimit(limiter, &RateLimitConfig{Mode: tracker}), func(c *gin.Context) {
+		c.String(http.StatusOK, "success")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	return w
+}
+
+func TestModeTracker_DryRun(t *testing.T) {
+	limiter := new(MockRateLimiter)
+	limiter.On("IsAllowed", mock.Anything, mock.Anything, mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: false, Limit: 10, ResetTime: time.Now().Add(time.Minute)}, nil)
+
+	collector := &modeCollector{}
+	w := serveMode(limiter, NewModeTracker(ModeConfig{DryRun: true, Collector: collector}))
+
+	assert.Equal(t, http.StatusOK, w.Code, "dry runs let denied requests through")
+	assert.Equal(t, "success", w.Body.String())
+	assert.Equal(t, metrics.ModeDryRun, w.Header().Get(ModeHeader))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, []string{metrics.ModeDryRun}, collector.modes)
+}
+
+func TestModeTracker_FailOpen(t *testing.T) {
+	collector := &modeCollector{}
+	tracker := NewModeTracker(ModeConfig{FailOpen: true, Collector: collector})
+
+	failing := new(MockRateLimiter)
+	failing.On("IsAllowed", mock.Anything, mock.Anything, mock.Anything).Return(ratelimit.RateLimitResponse{}, errors.New("redis down"))
+
+	w := serveMode(failing, tracker)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, metrics.ModeDegraded, w.Header().Get(ModeHeader))
+
+	w = serveMode(failing, tracker)
+	assert.Equal(t, metrics.ModeDegraded, w.Header().Get(ModeHeader))
+
+	healthy := new(MockRateLimiter)
+	healthy.On("IsAllowed", mock.Anything, mock.Anything, mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 9, ResetTime: time.Now().Add(time.Minute)}, nil)
+
+	w = serveMode(healthy, tracker)
+	assert.Equal(t, metrics.ModeEnforced, w.Header().Get(ModeHeader))
+	assert.Equal(t, []string{metrics.ModeEnforced, metrics.ModeDegraded, metrics.ModeEnforced}, collector.modes,
+		"the gauge only changes on transitions")
+}
+
+func TestModeTracker_FailClosed(t *testing.T) {
+	failing := new(MockRateLimiter)
+	failing.On("IsAllowed", mock.Anything, mock.Anything, mock.Anything).Return(ratelimit.RateLimitResponse{}, errors.New("redis down"))
+
+	w := serveMode(failing, NewModeTracker(ModeConfig{}))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get(ModeHeader))
+
+	var tracker *ModeTracker
+	assert.Equal(t, metrics.ModeEnforced, tracker.Mode())
+	assert.False(t, tracker.DryRun())
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	NamespaceHeader      = "X-RateLimit-Namespace"
+	NamespaceTokenHeader = "X-RateLimit-Namespace-Token"
+	namespaceContextKey  = "ratelimit.namespace"
+)
+
+type NamespaceConfig struct {
+	// Namespaces maps each allowed namespace to the token callers must present.
+	// An empty token only checks the allowlist.
+	Namespaces map[string]string
+	Required   bool
+}
+
+// Namespace validates the X-RateLimit-Namespace header against the allowlist
+// so several applications can share one deployment with isolated budgets.
+func Namespace(cfg NamespaceConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		namespace := c.GetHeader(NamespaceHeader)
+		if namespace == "" {
+			if cfg.Required {
+				abortInvalidNamespace(c, http.StatusBadRequest, NamespaceHeader+" header is required")
+				return
+			}
+			c.Next()
+			return
+		}
+
+		token, allowed := cfg.Namespaces[namespace]
+		if !allowed {
+			abortInvalidNamespace(c, http.StatusForbidden, "namespace "+namespace+" is not allowed")
+			return
+		}
+
+		if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.GetHeader(NamespaceTokenHeader))) != 1 {
+			abortInvalidNamespace(c, http.StatusForbidden, "invalid token for namespace "+namespace)
+			return
+		}
+
+		c.Set(namespaceContextKey, namespace)
+		c.Next()
+	}
+}
+
+// GetNamespace returns the validated namespace, or an empty string for the
+// shared default budget.
+func GetNamespace(c *gin.Context) string {
+	return c.GetString(namespaceContextKey)
+}
+
+func abortInvalidNamespace(c *gin.Context, status int, message string) {
+	AbortError(c, status, "Invalid namespace", message)
+}
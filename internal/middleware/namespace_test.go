@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupNamespaceRouter(cfg NamespaceConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(Namespace(cfg))
+	router.GET("/test", func(c *gin.Context) {
+		c.String(http.StatusOK, GetNamespace(c))
+	})
+	return router
+}
+
+func TestNamespace(t *testing.T) {
+	router := setupNamespaceRouter(NamespaceConfig{
+		Namespaces: map[string]string{
+			"billing": "secret",
+			"search":  "",
+		},
+	})
+
+	tests := []struct {
+		name           string
+		namespace      string
+		token          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "no namespace", expectedStatus: http.StatusOK, expectedBody: ""},
+		{name: "allowlisted without token", namespace: "search", expectedStatus: http.StatusOK, expectedBody: "search"},
+		{name: "valid token", namespace: "billing", token: "secret", expectedStatus: http.StatusOK, expectedBody: "billing"},
+		{name: "wrong token", namespace: "billing", token: "guess", expectedStatus: http.StatusForbidden},
+		{name: "unknown namespace", namespace: "other", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/test", nil)
+			if tt.namespace != "" {
+				req.Header.Set(NamespaceHeader, tt.namespace)
+			}
+			if tt.token != "" {
+				req.Header.Set(NamespaceTokenHeader, tt.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestNamespace_Required(t *testing.T) {
+	router := setupNamespaceRouter(NamespaceConfig{Required: true})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestNamespace_PropagatedToRateLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRateLimiter)
+	mockLimiter.On("IsAllowed", mock.Anything, "ns:search:client", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 9, ResetTime: time.Now()}, nil)
+
+	policy := ratelimit.NewPolicy("default", mockLimiter, nil)
+
+	router := gin.New()
+	router.Use(Namespace(NamespaceConfig{Namespaces: map[string]string{"search": ""}}))
+	router.GET("/test", RateLimit(policy), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set(NamespaceHeader, "search")
+	req.Header.Set("X-Client-ID", "client")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockLimiter.AssertExpectations(t)
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+const organizationContextKey = "ratelimit.organization"
+
+// Organization reads the caller's organization from header, so hierarchical
+// limits can charge the budget its members share. Requests without the
+// header are only limited at the user and global levels.
+func Organization(header string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if organization := c.GetHeader(header); organization != "" {
+			c.Set(organizationContextKey, organization)
+		}
+		c.Next()
+	}
+}
+
+// GetOrganization returns the organization read by Organization, or an empty
+// string.
+func GetOrganization(c *gin.Context) string {
+	return c.GetString(organizationContextKey)
+}
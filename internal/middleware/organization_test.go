@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestOrganization_PropagatedToRateLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRateLimiter)
+	withOrganization := mock.MatchedBy(func(ctx context.Context) bool {
+		return ratelimit.OrganizationFromContext(ctx) == "acme"
+	})
+	mockLimiter.On("IsAllowed", withOrganization, "client", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 9, ResetTime: time.Now()}, nil)
+
+	router := gin.New()
+	router.Use(Organization("X-Org-ID"))
+	router.GET("/test", RateLimit(mockLimiter), func(c *gin.Context) {
+		c.String(http.StatusOK, GetOrganization(c))
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-Org-ID", "acme")
+	req.Header.Set("X-Client-ID", "client")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "acme", w.Body.String())
+	mockLimiter.AssertExpectations(t)
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+// DefaultMaxQueueDepth is how many requests RateLimit holds at once when
+// RateLimitConfig.MaxQueueDepth is unset.
+const DefaultMaxQueueDepth = 1000
+
+var errClientGone = errors.New("client went away while queued")
+
+// requestQueue bounds how many requests RateLimit holds while they wait for
+// capacity.
+type requestQueue chan struct{}
+
+func newRequestQueue(depth int) requestQueue {
+	if depth <= 0 {
+		depth = DefaultMaxQueueDepth
+	}
+	return make(requestQueue, depth)
+}
+
+func (q requestQueue) tryEnter() bool {
+	select {
+	case q <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q requestQueue) leave() {
+	<-q
+}
+
+// reserveAndWait books capacity up front and holds the request until the
+// reservation is due. Reservations that can't be queued are handed back.
+func reserveAndWait(c *gin.Context, ctx context.Context, reserver ratelimit.Reserver, refunder ratelimit.Refunder, queue requestQueue, key string, n int64, timestamp time.Time, maxWait time.Duration, refundTimeout time.Duration) (ratelimit.RateLimitResponse, error) {
+	reservation, err := reserver.ReserveN(ctx, key, n, timestamp, maxWait)
+	if err != nil || !reservation.Allowed || reservation.Delay <= 0 {
+		return reservation.RateLimitResponse, err
+	}
+
+	giveBack := func() {
+		if refunder != nil {
+			rollbackCharge(c, ratelimit.NewCharge(refunder, key, n, timestamp), refundTimeout)
+		}
+	}
+
+	if !queue.tryEnter() {
+		giveBack()
+		return queueFull(reservation.RateLimitResponse, reservation.Delay), nil
+	}
+	defer queue.leave()
+
+	if !waitFor(c, reservation.Delay) {
+		giveBack()
+		return reservation.RateLimitResponse, errClientGone
+	}
+	return reservation.RateLimitResponse, nil
+}
+
+// retryUntilAllowed holds a denied request and asks again once the limiter
+// expects capacity back, giving up early when that is past maxWait or the
+// limiter doesn't say. It returns the timestamp of the final decision.
+func retryUntilAllowed(c *gin.Context, ctx context.Context, rateLimiter ratelimit.RateLimiter, queue requestQueue, key string, n int64, timestamp time.Time, maxWait time.Duration) (ratelimit.RateLimitResponse, time.Time, error) {
+	response, err := take(ctx, rateLimiter, key, n, timestamp)
+	if err != nil || response.Allowed {
+		return response, timestamp, err
+	}
+
+	if !queue.tryEnter() {
+		return queueFull(response, 0), timestamp, nil
+	}
+	defer queue.leave()
+
+	deadline := timestamp.Add(maxWait)
+	for {
+		wait := retryWait(response)
+		if wait <= 0 || wait > time.Until(deadline) {
+			return response, timestamp, nil
+		}
+		if !waitFor(c, wait) {
+			return response, timestamp, errClientGone
+		}
+
+		timestamp = time.Now()
+		response, err = take(ctx, rateLimiter, key, n, timestamp)
+		if err != nil || response.Allowed {
+			return response, timestamp, err
+		}
+	}
+}
+
+// retryWait is how long until the limiter that denied response expects
+// capacity back: its Retry-After, or else until its window resets. Zero means
+// it doesn't say.
+func retryWait(response ratelimit.RateLimitResponse) time.Duration {
+	if response.RetryAfter != nil && *response.RetryAfter > 0 {
+		return *response.RetryAfter
+	}
+	if wait := time.Until(response.ResetTime); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// queueFull turns response into a denial for a request that found the queue
+// full.
+func queueFull(response ratelimit.RateLimitResponse, retryAfter time.Duration) ratelimit.RateLimitResponse {
+	response.Allowed = false
+	response.Remaining = 0
+	response.Metadata.Set("queue_full", true)
+	if retryAfter > 0 {
+		response.RetryAfter = &retryAfter
+	}
+	return response
+}
+
+// waitFor sleeps for d. It returns false if the client goes away first.
+func waitFor(c *gin.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-c.Request.Context().Done():
+		return false
+	}
+}
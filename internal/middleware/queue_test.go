@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func deniedFor(retryAfter time.Duration) ratelimit.RateLimitResponse {
+	return ratelimit.RateLimitResponse{Allowed: false, Limit: 5, ResetTime: time.Now().Add(retryAfter), RetryAfter: &retryAfter}
+}
+
+func TestRateLimitMiddleware_MaxWaitPolls(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRateLimiter)
+	mockLimiter.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(deniedFor(20*time.Millisecond), nil).Once()
+	mockLimiter.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 5, ResetTime: time.Now().Add(time.Second)}, nil).Once()
+
+	router := gin.New()
+	router.GET("/test", RateLimit(mockLimiter, &RateLimitConfig{
+		KeyExtractor: func(c *gin.Context) string { return "client" },
+		MaxWait:      time.Second,
+	}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimitMiddleware_MaxWaitGivesUpEarly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRateLimiter)
+	mockLimiter.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(deniedFor(time.Minute), nil).Once()
+
+	router := gin.New()
+	router.GET("/test", RateLimit(mockLimiter, &RateLimitConfig{
+		KeyExtractor: func(c *gin.Context) string { return "client" },
+		MaxWait:      time.Second,
+	}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Less(t, time.Since(start), time.Second, "capacity won't be back in time, so don't hold the request")
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimitMiddleware_MaxQueueDepth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	queued := make(chan struct{})
+	mockLimiter := new(MockRateLimiter)
+	mockLimiter.On("IsAllowed", mock.Anything, "first", mock.Anything).Return(deniedFor(200*time.Millisecond), nil).Once().
+		Run(func(mock.Arguments) { close(queued) })
+	mockLimiter.On("IsAllowed", mock.Anything, "first", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 5, ResetTime: time.Now().Add(time.Second)}, nil).Once()
+	mockLimiter.On("IsAllowed", mock.Anything, "second", mock.Anything).Return(deniedFor(10*time.Millisecond), nil).Once()
+
+	var rejected ratelimit.RateLimitResponse
+	router := gin.New()
+	router.GET("/test", RateLimit(mockLimiter, &RateLimitConfig{
+		KeyExtractor:  func(c *gin.Context) string { return c.Query("key") },
+		MaxWait:       time.Second,
+		MaxQueueDepth: 1,
+		OnLimitReached: func(c *gin.Context, response ratelimit.RateLimitResponse) {
+			rejected = response
+			c.AbortWithStatus(http.StatusTooManyRequests)
+		},
+	}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	first := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/test?key=first", nil))
+		first <- w.Code
+	}()
+
+	<-queued
+	time.Sleep(20 * time.Millisecond)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test?key=second", nil))
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, true, rejected.Metadata.Value("queue_full"))
+	assert.Equal(t, http.StatusOK, <-first)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimitMiddleware_MaxWaitWaitsForReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRateLimiter)
+	mockLimiter.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: false, Limit: 5, ResetTime: time.Now().Add(50 * time.Millisecond)}, nil).Once()
+	mockLimiter.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: false, Limit: 5}, nil).Once()
+
+	router := gin.New()
+	router.GET("/test", RateLimit(mockLimiter, &RateLimitConfig{
+		KeyExtractor: func(c *gin.Context) string { return "client" },
+		MaxWait:      time.Second,
+	}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "a limiter that doesn't say when capacity is back isn't polled")
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond, "without Retry-After the request waits for the reset")
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestNewRequestQueue_DefaultDepth(t *testing.T) {
+	assert.Equal(t, DefaultMaxQueueDepth, cap(newRequestQueue(0)))
+	assert.Equal(t, 3, cap(newRequestQueue(3)))
+}
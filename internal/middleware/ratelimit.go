@@ -2,6 +2,9 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
@@ -11,23 +14,94 @@ import (
 )
 
 type RateLimitConfig struct {
-	KeyExtractor func(c *gin.Context) string
-	OnLimitReached func(c *gin.Context, response ratelimit.RateLimitResponse)
+	KeyExtractor           func(c *gin.Context) string
+	OnLimitReached         func(c *gin.Context, response ratelimit.RateLimitResponse)
 	SkipSuccessfulRequests bool
+	DenialLog              *ratelimit.DenialLog
+	AuditLog               *ratelimit.AuditLog
+	// CoalesceWindow batches concurrent requests for the same key into one
+	// Redis call, adding at most this much latency. Zero disables coalescing.
+	CoalesceWindow   time.Duration
+	CoalesceMaxBatch int
+	// KeyByRoute appends the HTTP method and Gin route template to the key
+	// (e.g. "client:GET:/api/users/:id") so reads and writes get separate
+	// budgets.
+	KeyByRoute bool
+	// CountResponse reports whether a response uses up the limit. Requests
+	// are charged up front as a ratelimit.Charge, committed after the handler
+	// when it returns true and rolled back otherwise, so the limiter must
+	// support refunds. Nil counts every response.
+	CountResponse ResponseCounter
+	// MaxWait queues requests that would otherwise be denied for up to this
+	// long. Limiters that support reservations book capacity up front; others
+	// are asked again once they expect capacity back. Zero rejects straight
+	// away.
+	MaxWait time.Duration
+	// MaxQueueDepth caps how many requests wait at once; requests beyond it
+	// are rejected. Zero means DefaultMaxQueueDepth.
+	MaxQueueDepth int
+	// Mode reports the operating mode and controls dry runs and failing
+	// open. Nil always enforces and answers 500 when the limiter fails.
+	Mode *ModeTracker
+	// Timeout caps each decision on top of the request's own deadline.
+	// Zero uses DefaultLimiterTimeout.
+	Timeout time.Duration
+	// AbuseScoring charges each request by its anti-abuse score rather than
+	// as one request; the limiter must then support batches or
+	// reservations. Nil charges every request as one.
+	AbuseScoring *AbuseScoring
+}
+
+// DefaultLimiterTimeout caps a rate limit call when no timeout is configured.
+const DefaultLimiterTimeout = 5 * time.Second
+
+// LimiterContext derives the context for a rate limit call from the
+// request's, so the call stops when the client goes away or its deadline
+// passes, and at the latest after timeout. It carries the namespace, client
+// IP and organization strategies read from the context.
+func LimiterContext(c *gin.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = DefaultLimiterTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	ctx = ratelimit.WithNamespace(ctx, GetNamespace(c))
+	ctx = ratelimit.WithClientIP(ctx, c.ClientIP())
+	ctx = ratelimit.WithOrganization(ctx, GetOrganization(c))
+	return ctx, cancel
+}
+
+// ClientGone reports whether the client aborted the request, in which case
+// nobody is left to read the response.
+func ClientGone(c *gin.Context) bool {
+	return c.Request.Context().Err() != nil
 }
 
 func defaultKeyExtractor(c *gin.Context) string {
 	clientID := c.GetHeader("X-Client-ID")
 	if clientID == "" {
-		clientID = c.ClientIP()
+		clientID = ClientKeyIP(c)
 	}
 	return clientID
 }
 
+// routeKey scopes key to the matched route. The template is used rather than
+// the raw path so /users/1 and /users/2 share a budget; unmatched requests
+// share one bucket per method.
+func routeKey(c *gin.Context, key string) string {
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	return key + ":" + c.Request.Method + ":" + route
+}
+
 func defaultOnLimitReached(c *gin.Context, response ratelimit.RateLimitResponse) {
-	c.JSON(http.StatusTooManyRequests, gin.H{
-		"message": "Too many requests",
-	})
+	body := NewErrorResponse(c, http.StatusTooManyRequests, "Rate limit exceeded", "Too many requests")
+	if response.RetryAfter != nil {
+		body = body.WithRetryAfter(*response.RetryAfter)
+	}
+	WriteError(c, http.StatusTooManyRequests, body)
 	c.Abort()
 }
 
@@ -46,36 +120,204 @@ func RateLimit(rateLimiter ratelimit.RateLimiter, config ...*RateLimitConfig) gi
 		cfg.OnLimitReached = defaultOnLimitReached
 	}
 
+	if cfg.Mode.DryRun() {
+		// A dry run must not hold requests back either.
+		cfg.MaxWait = 0
+	}
+
+	var reserver ratelimit.Reserver
+	if cfg.MaxWait > 0 {
+		if r, ok := rateLimiter.(ratelimit.Reserver); ok && ratelimit.SupportsReserve(rateLimiter) {
+			reserver = r
+		} else {
+			slog.Debug("rate limiter does not support reservations; queued requests will retry once capacity is expected back")
+		}
+	}
+	queue := newRequestQueue(cfg.MaxQueueDepth)
+
+	scoring := cfg.AbuseScoring
+	if scoring != nil && !ratelimit.SupportsBatch(rateLimiter) && !ratelimit.SupportsReserve(rateLimiter) {
+		slog.Warn("rate limiter can only charge one request at a time; ignoring abuse scores")
+		scoring = nil
+	}
+
+	var refunder ratelimit.Refunder
+	if r, ok := rateLimiter.(ratelimit.Refunder); ok && ratelimit.SupportsRefund(rateLimiter) {
+		refunder = r
+	} else if cfg.CountResponse != nil {
+		slog.Warn("rate limiter does not support refunds; counting every response")
+	}
+
+	// Reserved requests are decided one by one, so there is nothing to coalesce.
+	if cfg.CoalesceWindow > 0 && reserver == nil {
+		if batchLimiter, ok := rateLimiter.(ratelimit.BatchRateLimiter); ok && ratelimit.SupportsBatch(rateLimiter) {
+			coalescer, err := ratelimit.NewCoalescer(batchLimiter, ratelimit.CoalescerConfig{
+				MaxDelay: cfg.CoalesceWindow,
+				MaxBatch: cfg.CoalesceMaxBatch,
+			})
+			if err == nil {
+				rateLimiter = coalescer
+			}
+		}
+	}
+
 	return func(c *gin.Context) {
 		key := cfg.KeyExtractor(c)
-		
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if cfg.KeyByRoute {
+			key = routeKey(c, key)
+		}
+
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = DefaultLimiterTimeout
+		}
+		ctx, cancel := LimiterContext(c, timeout+cfg.MaxWait)
 		defer cancel()
+		ctx = WithDecisionID(c, ctx)
+		cost := scoring.Weigh(c, 1)
 
-		response, err := rateLimiter.IsAllowed(ctx, key, time.Now())
+		timestamp := time.Now()
+		var response ratelimit.RateLimitResponse
+		var err error
+		switch {
+		case reserver != nil:
+			response, err = reserveAndWait(c, ctx, reserver, refunder, queue, key, cost, timestamp, cfg.MaxWait, timeout)
+		case cfg.MaxWait > 0:
+			response, timestamp, err = retryUntilAllowed(c, ctx, rateLimiter, queue, key, cost, timestamp, cfg.MaxWait)
+		default:
+			response, err = take(ctx, rateLimiter, key, cost, timestamp)
+		}
+		if errors.Is(err, errClientGone) || (err != nil && ClientGone(c)) {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil && cfg.Mode.failsOpen() {
+			LogRateLimitError(c, key, err)
+			cfg.Mode.recordCheck(true)
+			cfg.Mode.setHeader(c)
+			if !cfg.SkipSuccessfulRequests {
+				c.Next()
+			}
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Rate limiter error",
-				"message": err.Error(),
-			})
-			c.Abort()
+			LogRateLimitError(c, key, err)
+			AbortError(c, http.StatusInternalServerError, "Rate limiter error", err.Error())
 			return
 		}
 
-		setRateLimitHeaders(c, response)
+		cfg.Mode.recordCheck(false)
+		cfg.Mode.setHeader(c)
+		if score, ok := GetAbuseScore(c); ok {
+			response.Metadata.SetFloat("abuse_score", score)
+			response.Metadata.SetInt("cost", cost)
+		}
+		SetRateLimitHeaders(c, response)
+		setDecision(c, response)
+		RecordAudit(c, cfg.AuditLog, rateLimiter, key, response)
 
 		if !response.Allowed {
-			cfg.OnLimitReached(c, response)
-			return
+			LogRateLimitDenied(c, key, response)
+			RecordDenial(c, cfg.DenialLog, rateLimiter, key)
+			if !cfg.Mode.DryRun() {
+				cfg.OnLimitReached(c, response)
+				return
+			}
+		}
+
+		var charge *ratelimit.Charge
+		if refunder != nil && cfg.CountResponse != nil && response.Allowed && !response.Bypassed {
+			charge = ratelimit.NewCharge(refunder, key, cost, timestamp)
 		}
 
 		if !cfg.SkipSuccessfulRequests {
 			c.Next()
 		}
+
+		if charge != nil {
+			if cfg.CountResponse(c.Writer.Status(), c.Writer.Header()) {
+				charge.Commit()
+			} else {
+				rollbackCharge(c, charge, timeout)
+			}
+		}
+	}
+}
+
+// take decides a request costing n, through IsAllowed when it costs one.
+func take(ctx context.Context, rateLimiter ratelimit.RateLimiter, key string, n int64, timestamp time.Time) (ratelimit.RateLimitResponse, error) {
+	if n == 1 {
+		return rateLimiter.IsAllowed(ctx, key, timestamp)
 	}
+	return ratelimit.TakeN(ctx, rateLimiter, key, n, timestamp)
 }
 
-func setRateLimitHeaders(c *gin.Context, response ratelimit.RateLimitResponse) {
+// rollbackCharge gives back what the request was charged, e.g. once its
+// response turned out not to count. It gets a fresh timeout since the handler
+// may have used up the original one, and outlives the request: a client that
+// went away must still get its capacity back.
+func rollbackCharge(c *gin.Context, charge *ratelimit.Charge, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), timeout)
+	defer cancel()
+	ctx = ratelimit.WithNamespace(ctx, GetNamespace(c))
+	ctx = ratelimit.WithClientIP(ctx, c.ClientIP())
+	ctx = ratelimit.WithOrganization(ctx, GetOrganization(c))
+
+	if err := charge.Rollback(ctx); err != nil {
+		slog.Error("failed to refund rate limit",
+			"request_id", GetRequestID(c),
+			"key", charge.Key(),
+			"status", c.Writer.Status(),
+			"error", err.Error(),
+		)
+	}
+}
+
+// Formats of the Retry-After header.
+const (
+	RetryAfterFormatSeconds  = "seconds"
+	RetryAfterFormatHTTPDate = "http-date"
+)
+
+// ResetAtHeader carries the decision's reset time as an RFC 3339 timestamp,
+// for clients that would rather not add RateLimit-Reset to their own clock.
+const ResetAtHeader = "RateLimit-Reset-At"
+
+// SoftLimitHeader warns a client allowed past its policy's soft limit that
+// it is close to being denied.
+const SoftLimitHeader = "X-RateLimit-Warning"
+
+const retryAfterFormatContextKey = "retry_after_format"
+
+// RetryAfterFormat makes the Retry-After headers written for c use format,
+// RetryAfterFormatSeconds or RetryAfterFormatHTTPDate.
+func RetryAfterFormat(format string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(retryAfterFormatContextKey, format)
+		c.Next()
+	}
+}
+
+// SetRetryAfter writes a Retry-After header for a denial lifting after
+// retryAfter. It is rounded up to whole seconds and never 0, since a client
+// told to retry immediately would only be denied again.
+func SetRetryAfter(c *gin.Context, retryAfter time.Duration) {
+	seconds := max(1, RetryAfterSeconds(retryAfter))
+	if c.GetString(retryAfterFormatContextKey) == RetryAfterFormatHTTPDate {
+		retryAt := time.Now().Truncate(time.Second).Add(time.Duration(seconds) * time.Second)
+		c.Header("Retry-After", retryAt.UTC().Format(http.TimeFormat))
+		return
+	}
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
+// SetRateLimitHeaders writes the RateLimit headers for response, and
+// Retry-After when it was denied.
+func SetRateLimitHeaders(c *gin.Context, response ratelimit.RateLimitResponse) {
+	if response.Bypassed || response.Optimistic {
+		return
+	}
+
 	c.Header("RateLimit-Limit", strconv.FormatInt(response.Limit, 10))
 	c.Header("RateLimit-Remaining", strconv.FormatInt(response.Remaining, 10))
 
@@ -84,12 +326,20 @@ func setRateLimitHeaders(c *gin.Context, response ratelimit.RateLimitResponse) {
 		resetSeconds = 0
 	}
 	c.Header("RateLimit-Reset", strconv.FormatInt(resetSeconds, 10))
+	if !response.ResetTime.IsZero() {
+		c.Header(ResetAtHeader, response.ResetTime.UTC().Format(time.RFC3339Nano))
+	}
 
 	if !response.Allowed && response.RetryAfter != nil {
-		retryAfterSeconds := int64(response.RetryAfter.Seconds())
-		if retryAfterSeconds < 0 {
-			retryAfterSeconds = 0
-		}
-		c.Header("Retry-After", strconv.FormatInt(retryAfterSeconds, 10))
+		SetRetryAfter(c, *response.RetryAfter)
 	}
-}
\ No newline at end of file
+	if response.Allowed && response.Metadata.Has("soft_limit") {
+		c.Header(SoftLimitHeader, fmt.Sprintf("approaching limit; remaining=%d; limit=%d", response.Remaining, response.Limit))
+	}
+
+	if response.Metadata.Has("quota_period") {
+		c.Header("X-Quota-Limit", strconv.FormatInt(response.Limit, 10))
+		c.Header("X-Quota-Remaining", strconv.FormatInt(response.Remaining, 10))
+		c.Header("X-Quota-Reset", strconv.FormatInt(resetSeconds, 10))
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -11,6 +12,7 @@ import (
 	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockRateLimiter struct {
@@ -88,6 +90,77 @@ func TestRateLimitMiddleware_Denied(t *testing.T) {
 	mockLimiter.AssertExpectations(t)
 }
 
+func TestRateLimitMiddleware_RetryAfterFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	resetTime := time.Date(2026, 10, 21, 7, 28, 0, 500_000_000, time.UTC)
+	tests := []struct {
+		name       string
+		format     string
+		retryAfter time.Duration
+		check      func(t *testing.T, retryAfter string)
+	}{
+		{"seconds round up", RetryAfterFormatSeconds, 1500 * time.Millisecond, func(t *testing.T, retryAfter string) {
+			assert.Equal(t, "2", retryAfter)
+		}},
+		{"never zero", RetryAfterFormatSeconds, 10 * time.Millisecond, func(t *testing.T, retryAfter string) {
+			assert.Equal(t, "1", retryAfter)
+		}},
+		{"http-date", RetryAfterFormatHTTPDate, 30 * time.Second, func(t *testing.T, retryAfter string) {
+			retryAt, err := http.ParseTime(retryAfter)
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(30*time.Second), retryAt, time.Second)
+			assert.False(t, retryAt.Before(time.Now().Add(29*time.Second)), "rounded up, never early")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockLimiter := new(MockRateLimiter)
+			mockLimiter.On("IsAllowed", mock.Anything, mock.Anything, mock.Anything).Return(
+				ratelimit.RateLimitResponse{Allowed: false, Limit: 10, ResetTime: resetTime, RetryAfter: &tt.retryAfter}, nil)
+
+			router := gin.New()
+			router.Use(RetryAfterFormat(tt.format))
+			router.GET("/test", RateLimit(mockLimiter), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+			tt.check(t, w.Header().Get("Retry-After"))
+			assert.Equal(t, "2026-10-21T07:28:00.5Z", w.Header().Get(ResetAtHeader))
+		})
+	}
+}
+
+func TestRateLimitMiddleware_SoftLimitWarning(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	metadata := ratelimit.MetadataOf(map[string]interface{}{"soft_limit": true})
+	mockLimiter := new(MockRateLimiter)
+	mockLimiter.On("IsAllowed", mock.Anything, mock.Anything, mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 2, ResetTime: time.Now().Add(time.Minute), Metadata: metadata}, nil).Once()
+	mockLimiter.On("IsAllowed", mock.Anything, mock.Anything, mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 7, ResetTime: time.Now().Add(time.Minute)}, nil).Once()
+
+	router := gin.New()
+	router.GET("/test", RateLimit(mockLimiter), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "approaching limit; remaining=2; limit=10", w.Header().Get(SoftLimitHeader))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	assert.Empty(t, w.Header().Get(SoftLimitHeader))
+}
+
 func TestRateLimitMiddleware_CustomKeyExtractor(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	
@@ -117,4 +190,258 @@ func TestRateLimitMiddleware_CustomKeyExtractor(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 	mockLimiter.AssertExpectations(t)
-}
\ No newline at end of file
+}
+func TestRateLimitMiddleware_KeyByRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRateLimiter)
+	for _, key := range []string{"client-1:GET:/users/:id", "client-1:POST:/users/:id"} {
+		mockLimiter.On("IsAllowed", mock.Anything, key, mock.Anything).Return(
+			ratelimit.RateLimitResponse{
+				Allowed:   true,
+				Limit:     10,
+				Remaining: 9,
+				ResetTime: time.Now().Add(time.Hour),
+			}, nil).Once()
+	}
+
+	middleware := RateLimit(mockLimiter, &RateLimitConfig{KeyByRoute: true})
+	handler := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	}
+
+	router := gin.New()
+	router.GET("/users/:id", middleware, handler)
+	router.POST("/users/:id", middleware, handler)
+
+	for _, method := range []string{"GET", "POST"} {
+		req := httptest.NewRequest(method, "/users/42", nil)
+		req.Header.Set("X-Client-ID", "client-1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	mockLimiter.AssertExpectations(t)
+}
+
+type MockRefundingRateLimiter struct {
+	MockRateLimiter
+}
+
+func (m *MockRefundingRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	args := m.Called(ctx, key, n, timestamp)
+	return args.Error(0)
+}
+
+func TestRateLimitMiddleware_CountResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRefundingRateLimiter)
+	mockLimiter.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 5, Remaining: 4, ResetTime: time.Now().Add(time.Minute)}, nil)
+	mockLimiter.On("Refund", mock.Anything, "client", int64(1), mock.Anything).Return(nil).Once()
+
+	countResponse, err := NewResponseCounter(ResponseCountingConfig{CountStatusCodes: []string{"401", "403"}})
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/login", RateLimit(mockLimiter, &RateLimitConfig{
+		KeyExtractor:  func(c *gin.Context) string { return "client" },
+		CountResponse: countResponse,
+	}), func(c *gin.Context) {
+		if c.Query("password") == "correct" {
+			c.Status(http.StatusOK)
+			return
+		}
+		c.Status(http.StatusUnauthorized)
+	})
+
+	for _, target := range []string{"/login?password=wrong", "/login?password=correct"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	}
+
+	mockLimiter.AssertNumberOfCalls(t, "IsAllowed", 2)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimitMiddleware_CountResponseHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRefundingRateLimiter)
+	mockLimiter.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 5, Remaining: 4, ResetTime: time.Now().Add(time.Minute)}, nil)
+	mockLimiter.On("Refund", mock.Anything, "client", int64(1), mock.Anything).Return(nil).Once()
+
+	countResponse, err := NewResponseCounter(ResponseCountingConfig{
+		CountHeaders: []HeaderMatch{{Name: "X-Login-Result", Value: "failure"}},
+	})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/login", RateLimit(mockLimiter, &RateLimitConfig{
+		KeyExtractor:  func(c *gin.Context) string { return "client" },
+		CountResponse: countResponse,
+	}), func(c *gin.Context) {
+		// Both answers are 200, so only the header tells them apart.
+		if c.Query("password") == "correct" {
+			c.Header("X-Login-Result", "success")
+		} else {
+			c.Header("X-Login-Result", "failure")
+		}
+		c.Status(http.StatusOK)
+	})
+
+	for _, target := range []string{"/login?password=wrong", "/login?password=correct"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", target, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	mockLimiter.AssertNumberOfCalls(t, "Refund", 1)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimitMiddleware_CountResponseWithoutRefunds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRateLimiter)
+	mockLimiter.On("IsAllowed", mock.Anything, mock.AnythingOfType("string"), mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 5, Remaining: 4, ResetTime: time.Now().Add(time.Minute)}, nil)
+
+	router := gin.New()
+	router.GET("/test", RateLimit(mockLimiter, &RateLimitConfig{
+		CountResponse: func(status int, header http.Header) bool { return false },
+	}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockLimiter.AssertExpectations(t)
+}
+
+type MockReservingRateLimiter struct {
+	MockRefundingRateLimiter
+}
+
+func (m *MockReservingRateLimiter) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (ratelimit.Reservation, error) {
+	args := m.Called(ctx, key, n, timestamp, maxDelay)
+	return args.Get(0).(ratelimit.Reservation), args.Error(1)
+}
+
+func TestRateLimitMiddleware_MaxWait(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockReservingRateLimiter)
+	mockLimiter.On("ReserveN", mock.Anything, "queued", int64(1), mock.Anything, time.Second).Return(
+		ratelimit.Reservation{
+			RateLimitResponse: ratelimit.RateLimitResponse{Allowed: true, Limit: 5, ResetTime: time.Now().Add(time.Minute)},
+			Delay:             20 * time.Millisecond,
+		}, nil).Once()
+	mockLimiter.On("ReserveN", mock.Anything, "rejected", int64(1), mock.Anything, time.Second).Return(
+		ratelimit.Reservation{
+			RateLimitResponse: ratelimit.RateLimitResponse{Allowed: false, Limit: 5, ResetTime: time.Now().Add(time.Minute)},
+		}, nil).Once()
+
+	router := gin.New()
+	router.GET("/test", RateLimit(mockLimiter, &RateLimitConfig{
+		KeyExtractor: func(c *gin.Context) string { return c.Query("key") },
+		MaxWait:      time.Second,
+	}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test?key=queued", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond, "request should wait for its reservation")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test?key=rejected", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	mockLimiter.AssertNotCalled(t, "IsAllowed", mock.Anything, mock.Anything, mock.Anything)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimitMiddleware_MaxWaitClientGone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockReservingRateLimiter)
+	mockLimiter.On("ReserveN", mock.Anything, "client", int64(1), mock.Anything, time.Minute).Return(
+		ratelimit.Reservation{
+			RateLimitResponse: ratelimit.RateLimitResponse{Allowed: true, Limit: 5, ResetTime: time.Now().Add(time.Minute)},
+			Delay:             time.Minute,
+		}, nil)
+	mockLimiter.On("Refund", mock.Anything, "client", int64(1), mock.Anything).Return(nil).Once()
+
+	router := gin.New()
+	router.GET("/test", RateLimit(mockLimiter, &RateLimitConfig{
+		KeyExtractor: func(c *gin.Context) string { return "client" },
+		MaxWait:      time.Minute,
+	}), func(c *gin.Context) {
+		t.Error("handler should not run once the client has gone")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil).WithContext(ctx))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimitMiddleware_ClientCancellationReachesLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRateLimiter)
+	mockLimiter.On("IsAllowed", mock.MatchedBy(func(ctx context.Context) bool {
+		return errors.Is(ctx.Err(), context.Canceled)
+	}), "client", mock.Anything).Return(ratelimit.RateLimitResponse{}, context.Canceled)
+
+	router := gin.New()
+	router.GET("/test", RateLimit(mockLimiter, &RateLimitConfig{
+		KeyExtractor: func(c *gin.Context) string { return "client" },
+		Mode:         NewModeTracker(ModeConfig{FailOpen: true}),
+	}), func(c *gin.Context) {
+		t.Error("handler should not run once the client has gone")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil).WithContext(ctx))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestRateLimitMiddleware_Timeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLimiter := new(MockRateLimiter)
+	mockLimiter.On("IsAllowed", mock.MatchedBy(func(ctx context.Context) bool {
+		deadline, ok := ctx.Deadline()
+		return ok && time.Until(deadline) <= 50*time.Millisecond
+	}), "client", mock.Anything).Return(ratelimit.RateLimitResponse{}, context.DeadlineExceeded)
+
+	router := gin.New()
+	router.GET("/test", RateLimit(mockLimiter, &RateLimitConfig{
+		KeyExtractor: func(c *gin.Context) string { return "client" },
+		Timeout:      50 * time.Millisecond,
+	}), func(c *gin.Context) {
+		t.Error("handler should not run when the limiter times out")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockLimiter.AssertExpectations(t)
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+const (
+	RequestIDHeader     = "X-Request-ID"
+	requestIDContextKey = "request_id"
+	maxRequestIDLength  = 128
+)
+
+// RequestID tags every request with an ID, reusing a well-formed incoming
+// X-Request-ID so decisions can be correlated across services.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Set(requestIDContextKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// GetRequestID returns the ID assigned by RequestID, or an empty string when
+// the middleware is not installed.
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDContextKey)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		isAlphaNum := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if !isAlphaNum && r != '-' && r != '_' && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// LogRateLimitDenied writes the structured log entry matching a 429 response.
+func LogRateLimitDenied(c *gin.Context, key string, response ratelimit.RateLimitResponse) {
+	attrs := []any{
+		"request_id", GetRequestID(c),
+		"decision_id", GetDecisionID(c),
+		"key", key,
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"limit", response.Limit,
+		"reset_time", response.ResetTime,
+	}
+	if response.RetryAfter != nil {
+		attrs = append(attrs, "retry_after", response.RetryAfter.String())
+	}
+	slog.Warn("rate limit exceeded", attrs...)
+}
+
+// LogRateLimitError writes the structured log entry matching a 500 response.
+func LogRateLimitError(c *gin.Context, key string, err error) {
+	slog.Error("rate limiter error",
+		"request_id", GetRequestID(c),
+		"decision_id", GetDecisionID(c),
+		"key", key,
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"error", err.Error(),
+	)
+}
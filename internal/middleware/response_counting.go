@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ResponseCountingConfig decides which responses use up a client's limit.
+// When CountStatusCodes is set only matching responses count, e.g. 401 and
+// 403 for brute-force protection; otherwise every response counts except
+// those matching SkipStatusCodes. Entries are codes ("404") or classes
+// ("5xx"). Header conditions narrow that further.
+type ResponseCountingConfig struct {
+	CountStatusCodes []string
+	SkipStatusCodes  []string
+	// RefundServerErrors skips 5xx responses, so backend failures don't use
+	// up client quota.
+	RefundServerErrors bool
+	// CountHeaders only counts responses carrying one of these headers, e.g.
+	// X-Login-Result: failure set by a login handler.
+	CountHeaders []HeaderMatch
+	// SkipHeaders doesn't count responses carrying any of these headers.
+	SkipHeaders []HeaderMatch
+}
+
+// HeaderMatch matches responses whose header Name has Value, compared
+// case-insensitively, or that have the header at all when Value is empty.
+type HeaderMatch struct {
+	Name  string
+	Value string
+}
+
+func (m HeaderMatch) matches(header http.Header) bool {
+	values := header.Values(m.Name)
+	if m.Value == "" {
+		return len(values) > 0
+	}
+	for _, value := range values {
+		if strings.EqualFold(strings.TrimSpace(value), m.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseCounter reports whether a finished response uses up the limit,
+// from its status and headers.
+type ResponseCounter func(status int, header http.Header) bool
+
+// NewResponseCounter builds a RateLimitConfig.CountResponse func from cfg. It
+// returns nil when cfg counts every response.
+func NewResponseCounter(cfg ResponseCountingConfig) (ResponseCounter, error) {
+	countStatus, err := newStatusCounter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, match := range slices.Concat(cfg.CountHeaders, cfg.SkipHeaders) {
+		if match.Name == "" {
+			return nil, errors.New("header conditions need a header name")
+		}
+	}
+	if len(cfg.CountHeaders) == 0 && len(cfg.SkipHeaders) == 0 {
+		if countStatus == nil {
+			return nil, nil
+		}
+		return func(status int, header http.Header) bool {
+			return countStatus(status)
+		}, nil
+	}
+
+	return func(status int, header http.Header) bool {
+		if countStatus != nil && !countStatus(status) {
+			return false
+		}
+		for _, match := range cfg.SkipHeaders {
+			if match.matches(header) {
+				return false
+			}
+		}
+		if len(cfg.CountHeaders) == 0 {
+			return true
+		}
+		for _, match := range cfg.CountHeaders {
+			if match.matches(header) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func newStatusCounter(cfg ResponseCountingConfig) (func(status int) bool, error) {
+	count, err := parseStatusPatterns(cfg.CountStatusCodes)
+	if err != nil {
+		return nil, fmt.Errorf("count status codes: %w", err)
+	}
+	skip, err := parseStatusPatterns(cfg.SkipStatusCodes)
+	if err != nil {
+		return nil, fmt.Errorf("skip status codes: %w", err)
+	}
+	if cfg.RefundServerErrors {
+		skip = append(skip, statusPattern{min: 500, max: 599})
+	}
+
+	switch {
+	case len(count) > 0:
+		return func(status int) bool {
+			return matchStatus(count, status) && !matchStatus(skip, status)
+		}, nil
+	case len(skip) > 0:
+		return func(status int) bool {
+			return !matchStatus(skip, status)
+		}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// statusPattern matches statuses in [min, max].
+type statusPattern struct {
+	min, max int
+}
+
+func parseStatusPatterns(patterns []string) ([]statusPattern, error) {
+	parsed := make([]statusPattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		normalized := strings.ToLower(strings.TrimSpace(pattern))
+		if len(normalized) == 3 && strings.HasSuffix(normalized, "xx") {
+			class, err := strconv.Atoi(normalized[:1])
+			if err != nil || class < 1 || class > 5 {
+				return nil, fmt.Errorf("invalid status class %q", pattern)
+			}
+			parsed = append(parsed, statusPattern{min: class * 100, max: class*100 + 99})
+			continue
+		}
+
+		code, err := strconv.Atoi(normalized)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q", pattern)
+		}
+		parsed = append(parsed, statusPattern{min: code, max: code})
+	}
+	return parsed, nil
+}
+
+func matchStatus(patterns []statusPattern, status int) bool {
+	for _, pattern := range patterns {
+		if status >= pattern.min && status <= pattern.max {
+			return true
+		}
+	}
+	return false
+}
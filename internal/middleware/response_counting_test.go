@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewResponseCounter(t *testing.T) {
+	countResponse, err := NewResponseCounter(ResponseCountingConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, countResponse, "counting every response needs no hook")
+
+	countResponse, err = NewResponseCounter(ResponseCountingConfig{CountStatusCodes: []string{"401", "403"}})
+	require.NoError(t, err)
+	assert.True(t, countResponse(401, nil))
+	assert.True(t, countResponse(403, nil))
+	assert.False(t, countResponse(200, nil))
+	assert.False(t, countResponse(500, nil))
+
+	countResponse, err = NewResponseCounter(ResponseCountingConfig{SkipStatusCodes: []string{"5XX", "404"}})
+	require.NoError(t, err)
+	assert.True(t, countResponse(200, nil))
+	assert.True(t, countResponse(429, nil))
+	assert.False(t, countResponse(404, nil))
+	assert.False(t, countResponse(503, nil))
+
+	countResponse, err = NewResponseCounter(ResponseCountingConfig{RefundServerErrors: true})
+	require.NoError(t, err)
+	assert.True(t, countResponse(429, nil))
+	assert.False(t, countResponse(502, nil))
+
+	countResponse, err = NewResponseCounter(ResponseCountingConfig{CountStatusCodes: []string{"4xx"}, SkipStatusCodes: []string{"404"}})
+	require.NoError(t, err)
+	assert.True(t, countResponse(401, nil))
+	assert.False(t, countResponse(404, nil))
+}
+
+func TestNewResponseCounter_Headers(t *testing.T) {
+	countResponse, err := NewResponseCounter(ResponseCountingConfig{
+		CountStatusCodes: []string{"2xx", "401"},
+		CountHeaders:     []HeaderMatch{{Name: "X-Login-Result", Value: "failure"}, {Name: "X-Suspicious"}},
+		SkipHeaders:      []HeaderMatch{{Name: "X-Trusted-Device"}},
+	})
+	require.NoError(t, err)
+	assert.True(t, countResponse(200, http.Header{"X-Login-Result": {"FAILURE"}}))
+	assert.True(t, countResponse(401, http.Header{"X-Suspicious": {""}}))
+	assert.False(t, countResponse(200, http.Header{"X-Login-Result": {"success"}}))
+	assert.False(t, countResponse(200, nil))
+	assert.False(t, countResponse(500, http.Header{"X-Login-Result": {"failure"}}), "the status must match too")
+	assert.False(t, countResponse(401, http.Header{"X-Login-Result": {"failure"}, "X-Trusted-Device": {"1"}}))
+
+	countResponse, err = NewResponseCounter(ResponseCountingConfig{SkipHeaders: []HeaderMatch{{Name: "X-Cache", Value: "hit"}}})
+	require.NoError(t, err)
+	assert.True(t, countResponse(200, http.Header{"X-Cache": {"miss"}}))
+	assert.False(t, countResponse(200, http.Header{"X-Cache": {"HIT"}}))
+
+	_, err = NewResponseCounter(ResponseCountingConfig{CountHeaders: []HeaderMatch{{Value: "failure"}}})
+	assert.Error(t, err)
+}
+
+func TestNewResponseCounter_Invalid(t *testing.T) {
+	for _, pattern := range []string{"", "abc", "99", "600", "6xx", "x00"} {
+		_, err := NewResponseCounter(ResponseCountingConfig{SkipStatusCodes: []string{pattern}})
+		assert.Error(t, err, pattern)
+	}
+}
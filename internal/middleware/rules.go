@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/pmujumdar27/go-rate-limiter/internal/rules"
+)
+
+const (
+	RuleHeader     = "X-RateLimit-Rule"
+	ruleContextKey = "ratelimit.rule"
+)
+
+// Rules picks the limiter for each request from engine. Limit rules run their
+// policy through RateLimit with config; requests matching no rule use
+// fallback, or pass through when fallback is nil.
+func Rules(engine *rules.Engine, fallback ratelimit.RateLimiter, config *RateLimitConfig) gin.HandlerFunc {
+	return NewRuleSet(engine, fallback, config).Handler()
+}
+
+// RuleSet is the Rules middleware with an engine that can be replaced while
+// it serves, e.g. when the rules change in etcd.
+type RuleSet struct {
+	config   RateLimitConfig
+	fallback gin.HandlerFunc
+	current  atomic.Pointer[compiledRules]
+}
+
+type compiledRules struct {
+	engine   *rules.Engine
+	limiters map[string]gin.HandlerFunc
+}
+
+func NewRuleSet(engine *rules.Engine, fallback ratelimit.RateLimiter, config *RateLimitConfig) *RuleSet {
+	if config == nil {
+		config = &RateLimitConfig{}
+	}
+
+	s := &RuleSet{config: *config}
+	if fallback != nil {
+		fallbackConfig := *config
+		s.fallback = RateLimit(fallback, &fallbackConfig)
+	}
+	s.Update(engine)
+	return s
+}
+
+// Update makes requests that start afterwards use engine. Requests already
+// matched finish with the rules they matched.
+func (s *RuleSet) Update(engine *rules.Engine) {
+	limiters := make(map[string]gin.HandlerFunc)
+	for _, rule := range engine.Rules() {
+		if rule.Action == rules.ActionLimit {
+			ruleConfig := s.config
+			limiters[rule.Name] = RateLimit(rule.Policy, &ruleConfig)
+		}
+	}
+	s.current.Store(&compiledRules{engine: engine, limiters: limiters})
+}
+
+// Engine returns the engine requests are currently matched against.
+func (s *RuleSet) Engine() *rules.Engine {
+	return s.current.Load().engine
+}
+
+func (s *RuleSet) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current := s.current.Load()
+		rule, matched := current.engine.Evaluate(rules.Request{
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			Header:   c.Request.Header,
+			ClientIP: c.ClientIP(),
+		})
+		if !matched {
+			if s.fallback == nil {
+				c.Next()
+				return
+			}
+			s.fallback(c)
+			return
+		}
+
+		c.Set(ruleContextKey, rule.Name)
+		c.Header(RuleHeader, rule.Name)
+
+		switch rule.Action {
+		case rules.ActionBypass:
+			c.Next()
+		case rules.ActionDeny:
+			AbortError(c, http.StatusForbidden, "Request denied", "denied by rule "+rule.Name)
+		default:
+			current.limiters[rule.Name](c)
+		}
+	}
+}
+
+// GetRule returns the name of the rule that matched the request, if any.
+func GetRule(c *gin.Context) string {
+	return c.GetString(ruleContextKey)
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/pmujumdar27/go-rate-limiter/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRulesMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	writesLimiter := new(MockRateLimiter)
+	writesLimiter.On("IsAllowed", mock.Anything, "client-1", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: false, Limit: 1, ResetTime: time.Now().Add(time.Minute)}, nil).Once()
+	fallbackLimiter := new(MockRateLimiter)
+	fallbackLimiter.On("IsAllowed", mock.Anything, "client-1", mock.Anything).Return(
+		ratelimit.RateLimitResponse{Allowed: true, Limit: 10, Remaining: 9, ResetTime: time.Now().Add(time.Minute)}, nil).Once()
+
+	engine := rules.NewEngine("")
+	require.NoError(t, engine.Add(rules.Rule{Name: "health", Match: rules.Matcher{Paths: []string{"/health"}}, Action: rules.ActionBypass}))
+	require.NoError(t, engine.Add(rules.Rule{Name: "admin", Match: rules.Matcher{Paths: []string{"/admin/**"}}, Action: rules.ActionDeny}))
+	require.NoError(t, engine.Add(rules.Rule{
+		Name:   "writes",
+		Match:  rules.Matcher{Methods: []string{"POST"}},
+		Action: rules.ActionLimit,
+		Policy: ratelimit.NewPolicy("writes", writesLimiter, nil),
+	}))
+
+	router := gin.New()
+	router.Use(Rules(engine, fallbackLimiter, nil))
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	router.GET("/health", ok)
+	router.GET("/admin/policies", ok)
+	router.POST("/items", ok)
+	router.GET("/items", ok)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Client-ID", "client-1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("GET", "/health")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "health", w.Header().Get(RuleHeader))
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"), "bypassed requests touch no limiter")
+
+	w = serve("GET", "/admin/policies")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "denied by rule admin")
+
+	w = serve("POST", "/items")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "writes", w.Header().Get(RuleHeader))
+
+	w = serve("GET", "/items")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("RateLimit-Limit"))
+	assert.Empty(t, w.Header().Get(RuleHeader))
+
+	writesLimiter.AssertExpectations(t)
+	fallbackLimiter.AssertExpectations(t)
+}
@@ -0,0 +1,35 @@
+// Package notify tells external systems about rate limiting events so teams
+// can page on, or feed a SIEM with, abuse as it happens.
+package notify
+
+import "time"
+
+type EventType string
+
+const (
+	// EventKeyThrottled fires when a policy denies a key.
+	EventKeyThrottled EventType = "key.throttled"
+	// EventKeySoftLimit fires when a policy allows a key past its soft limit.
+	EventKeySoftLimit EventType = "key.soft_limit"
+	// EventKeyBanned fires when escalation bans a key.
+	EventKeyBanned EventType = "key.banned"
+	// EventThrottleEngaged fires when an operator sets the fleet-wide throttle.
+	EventThrottleEngaged EventType = "throttle.engaged"
+	// EventNamespaceQuarantined fires when a namespace's checks move to a
+	// local limiter because its Redis keys became too slow.
+	EventNamespaceQuarantined EventType = "namespace.quarantined"
+)
+
+// Event is the JSON body delivered to subscribers.
+type Event struct {
+	Type    EventType              `json:"type"`
+	Time    time.Time              `json:"time"`
+	Key     string                 `json:"key,omitempty"`
+	Policy  string                 `json:"policy,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Notifier delivers events. Notify must not block the request path.
+type Notifier interface {
+	Notify(event Event)
+}
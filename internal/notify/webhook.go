@@ -0,0 +1,263 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWebhookMaxRetries     = 3
+	DefaultWebhookInitialBackoff = 500 * time.Millisecond
+	DefaultWebhookMaxBackoff     = 30 * time.Second
+	DefaultWebhookTimeout        = 5 * time.Second
+	DefaultWebhookQueueSize      = 1000
+
+	// maxCooldownEntries bounds the memory spent remembering recent events.
+	maxCooldownEntries = 10000
+	// minCooldownPruneInterval keeps short cooldowns from pruning the
+	// remembered events constantly.
+	minCooldownPruneInterval = time.Second
+)
+
+var ErrNoWebhookURLs = errors.New("at least one webhook url is required")
+
+type WebhookConfig struct {
+	URLs []string
+	// Events limits delivery to these event types; empty delivers all.
+	Events []EventType
+	// Cooldown drops an event when one of the same type for the same key was
+	// accepted less than this long ago, so a hammering client produces one
+	// notification rather than thousands.
+	Cooldown       time.Duration
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	QueueSize      int
+}
+
+// WebhookNotifier POSTs events as JSON to every configured URL from a
+// background worker, retrying failed deliveries with exponential backoff.
+// Events that arrive while the queue is full are dropped.
+type WebhookNotifier struct {
+	urls           []string
+	events         map[EventType]bool
+	cooldown       time.Duration
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	client         *http.Client
+	queue          chan Event
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+func NewWebhookNotifier(config WebhookConfig) (*WebhookNotifier, error) {
+	if len(config.URLs) == 0 {
+		return nil, ErrNoWebhookURLs
+	}
+	for _, raw := range config.URLs {
+		parsed, err := url.Parse(raw)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid webhook url %q", raw)
+		}
+	}
+
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = DefaultWebhookInitialBackoff
+	}
+	if config.MaxBackoff < config.InitialBackoff {
+		config.MaxBackoff = max(DefaultWebhookMaxBackoff, config.InitialBackoff)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultWebhookTimeout
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultWebhookQueueSize
+	}
+
+	var events map[EventType]bool
+	if len(config.Events) > 0 {
+		events = make(map[EventType]bool, len(config.Events))
+		for _, event := range config.Events {
+			events[event] = true
+		}
+	}
+
+	return &WebhookNotifier{
+		urls:           config.URLs,
+		events:         events,
+		cooldown:       config.Cooldown,
+		maxRetries:     config.MaxRetries,
+		initialBackoff: config.InitialBackoff,
+		maxBackoff:     config.MaxBackoff,
+		client:         &http.Client{Timeout: config.Timeout},
+		queue:          make(chan Event, config.QueueSize),
+		lastSent:       make(map[string]time.Time),
+	}, nil
+}
+
+// Start delivers queued events, and forgets events past their cooldown,
+// until ctx is cancelled.
+func (w *WebhookNotifier) Start(ctx context.Context) {
+	if w.cooldown > 0 {
+		go func() {
+			ticker := time.NewTicker(max(w.cooldown, minCooldownPruneInterval))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case now := <-ticker.C:
+					w.pruneCooldowns(now)
+				}
+			}
+		}()
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-w.queue:
+				w.deliver(ctx, event)
+			}
+		}
+	}()
+}
+
+func (w *WebhookNotifier) Notify(event Event) {
+	if w.events != nil && !w.events[event.Type] {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if !w.acceptAfterCooldown(event) {
+		return
+	}
+
+	select {
+	case w.queue <- event:
+	default:
+		slog.Warn("webhook queue full, dropping event", "type", event.Type, "key", event.Key)
+	}
+}
+
+func (w *WebhookNotifier) acceptAfterCooldown(event Event) bool {
+	if w.cooldown <= 0 {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := string(event.Type) + "\x00" + event.Key
+	if last, ok := w.lastSent[id]; ok && event.Time.Sub(last) < w.cooldown {
+		return false
+	}
+
+	if _, ok := w.lastSent[id]; !ok && len(w.lastSent) >= maxCooldownEntries {
+		// Expired events are left to pruneCooldowns, so until it runs
+		// forget an arbitrary one, which at worst is reported again early.
+		for other := range w.lastSent {
+			delete(w.lastSent, other)
+			break
+		}
+	}
+	w.lastSent[id] = event.Time
+	return true
+}
+
+func (w *WebhookNotifier) pruneCooldowns(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for id, last := range w.lastSent {
+		if now.Sub(last) >= w.cooldown {
+			delete(w.lastSent, id)
+		}
+	}
+}
+
+func (w *WebhookNotifier) deliver(ctx context.Context, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("failed to encode webhook event", "type", event.Type, "error", err.Error())
+		return
+	}
+
+	for _, target := range w.urls {
+		if err := w.post(ctx, target, body); err != nil && ctx.Err() == nil {
+			slog.Error("webhook delivery failed",
+				"url", target,
+				"type", event.Type,
+				"key", event.Key,
+				"error", err.Error(),
+			)
+		}
+	}
+}
+
+// post sends body to target, retrying transport errors, 429s and 5xx
+// responses. Other 4xx responses mean the request itself is wrong, so they
+// are not retried.
+func (w *WebhookNotifier) post(ctx context.Context, target string, body []byte) error {
+	backoff := w.initialBackoff
+	var lastErr error
+
+	for attempt := 0; attempt <= w.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, w.maxBackoff)
+		}
+
+		retry, err := w.postOnce(ctx, target, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+
+	return lastErr
+}
+
+func (w *WebhookNotifier) postOnce(ctx context.Context, target string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-rate-limiter")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startNotifier(t *testing.T, config WebhookConfig) *WebhookNotifier {
+	t.Helper()
+	notifier, err := NewWebhookNotifier(config)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	notifier.Start(ctx)
+	return notifier
+}
+
+func TestNewWebhookNotifier_Invalid(t *testing.T) {
+	_, err := NewWebhookNotifier(WebhookConfig{})
+	assert.ErrorIs(t, err, ErrNoWebhookURLs)
+
+	for _, raw := range []string{"not a url", "ftp://example.com/hook", "http://"} {
+		_, err = NewWebhookNotifier(WebhookConfig{URLs: []string{raw}})
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestWebhookNotifier_Delivers(t *testing.T) {
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var event Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received <- event
+	}))
+	defer server.Close()
+
+	notifier := startNotifier(t, WebhookConfig{URLs: []string{server.URL}})
+	notifier.Notify(Event{Type: EventKeyBanned, Key: "client", Policy: "default", Details: map[string]interface{}{"ban_seconds": 900}})
+
+	select {
+	case event := <-received:
+		assert.Equal(t, EventKeyBanned, event.Type)
+		assert.Equal(t, "client", event.Key)
+		assert.Equal(t, "default", event.Policy)
+		assert.Equal(t, float64(900), event.Details["ban_seconds"])
+		assert.False(t, event.Time.IsZero())
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not delivered")
+	}
+}
+
+func TestWebhookNotifier_Retries(t *testing.T) {
+	var attempts atomic.Int32
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		close(done)
+	}))
+	defer server.Close()
+
+	notifier := startNotifier(t, WebhookConfig{URLs: []string{server.URL}, MaxRetries: 3, InitialBackoff: time.Millisecond})
+	notifier.Notify(Event{Type: EventThrottleEngaged})
+
+	select {
+	case <-done:
+		assert.Equal(t, int32(3), attempts.Load())
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not retried until delivered")
+	}
+}
+
+func TestWebhookNotifier_DoesNotRetryClientErrors(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	notifier, err := NewWebhookNotifier(WebhookConfig{URLs: []string{server.URL}, MaxRetries: 3, InitialBackoff: time.Millisecond})
+	require.NoError(t, err)
+
+	assert.Error(t, notifier.post(context.Background(), server.URL, []byte(`{}`)))
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestWebhookNotifier_FiltersAndCoolsDown(t *testing.T) {
+	notifier, err := NewWebhookNotifier(WebhookConfig{
+		URLs:     []string{"http://example.com/hook"},
+		Events:   []EventType{EventKeyThrottled},
+		Cooldown: time.Minute,
+	})
+	require.NoError(t, err)
+	now := time.Now()
+
+	notifier.Notify(Event{Type: EventKeyBanned, Key: "client", Time: now})
+	assert.Len(t, notifier.queue, 0, "unsubscribed events are dropped")
+
+	notifier.Notify(Event{Type: EventKeyThrottled, Key: "client", Time: now})
+	notifier.Notify(Event{Type: EventKeyThrottled, Key: "client", Time: now.Add(time.Second)})
+	notifier.Notify(Event{Type: EventKeyThrottled, Key: "other", Time: now.Add(time.Second)})
+	assert.Len(t, notifier.queue, 2, "repeats for the same key are held back")
+
+	notifier.Notify(Event{Type: EventKeyThrottled, Key: "client", Time: now.Add(time.Minute)})
+	assert.Len(t, notifier.queue, 3, "the key is reported again after the cooldown")
+}
+
+func TestWebhookNotifier_BoundsCooldowns(t *testing.T) {
+	notifier, err := NewWebhookNotifier(WebhookConfig{
+		URLs:     []string{"http://example.com/hook"},
+		Cooldown: time.Minute,
+	})
+	require.NoError(t, err)
+	now := time.Now()
+
+	for i := 0; i < maxCooldownEntries+10; i++ {
+		assert.True(t, notifier.acceptAfterCooldown(Event{Type: EventKeyThrottled, Key: "client-" + strconv.Itoa(i), Time: now}))
+	}
+	assert.Len(t, notifier.lastSent, maxCooldownEntries)
+
+	assert.True(t, notifier.acceptAfterCooldown(Event{Type: EventKeyBanned, Key: "client", Time: now.Add(time.Minute)}))
+	notifier.pruneCooldowns(now.Add(time.Minute))
+	assert.Len(t, notifier.lastSent, 1, "events past their cooldown are forgotten")
+}
@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+// ActiveKeysScanner periodically counts the Redis keys owned by each strategy
+// and reports them through the metrics collector.
+type ActiveKeysScanner struct {
+	redisClient *redis.Client
+	collector   metrics.Collector
+	interval    time.Duration
+	scanCount   int64
+
+	mu       sync.RWMutex
+	patterns map[string]string
+	current  func() (strategy, pattern string, err error)
+	followed string
+}
+
+func NewActiveKeysScanner(redisClient *redis.Client, collector metrics.Collector, interval time.Duration, scanCount int64) *ActiveKeysScanner {
+	if interval <= 0 {
+		interval = DefaultActiveKeysScanInterval
+	}
+	if scanCount <= 0 {
+		scanCount = DefaultActiveKeysScanCount
+	}
+
+	return &ActiveKeysScanner{
+		redisClient: redisClient,
+		collector:   collector,
+		interval:    interval,
+		scanCount:   scanCount,
+		patterns:    make(map[string]string),
+	}
+}
+
+// AddStrategy registers a strategy whose keys match the given SCAN pattern.
+func (s *ActiveKeysScanner) AddStrategy(strategy string, pattern string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.patterns[strategy] = pattern
+}
+
+// Follow also counts the keys of the strategy current returns, under the
+// SCAN pattern it returns with it. current is called on every scan, so the
+// gauge follows strategy switches and reloads; the strategy switched away
+// from is reset to zero.
+func (s *ActiveKeysScanner) Follow(current func() (strategy, pattern string, err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = current
+}
+
+// Start runs the scanner through housekeeping until ctx is cancelled, so
+// only its leader reports the gauge. An instance that stops leading resets
+// its gauge to zero rather than keep reporting its last counts next to the
+// new leader's.
+func (s *ActiveKeysScanner) Start(ctx context.Context, housekeeping *Housekeeping) {
+	housekeeping.Schedule(ctx, HousekeepingJob{
+		Name:       "active_keys_scan",
+		Interval:   s.interval,
+		RunAtStart: true,
+		Run:        s.ScanOnce,
+		StepDown:   s.resetGauge,
+	})
+}
+
+func (s *ActiveKeysScanner) resetGauge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for strategy := range s.patterns {
+		s.collector.SetActiveKeys(strategy, 0)
+	}
+	if s.followed != "" {
+		s.collector.SetActiveKeys(s.followed, 0)
+		s.followed = ""
+	}
+}
+
+// ScanOnce counts the keys of every registered strategy and updates the gauge.
+func (s *ActiveKeysScanner) ScanOnce(ctx context.Context) error {
+	s.mu.RLock()
+	patterns := make(map[string]string, len(s.patterns)+1)
+	for strategy, pattern := range s.patterns {
+		patterns[strategy] = pattern
+	}
+	current := s.current
+	s.mu.RUnlock()
+
+	if current != nil {
+		strategy, pattern, err := current()
+		if err != nil {
+			return fmt.Errorf("current strategy: %w", err)
+		}
+		patterns[strategy] = pattern
+
+		s.mu.Lock()
+		if s.followed != "" && s.followed != strategy {
+			if _, ok := patterns[s.followed]; !ok {
+				s.collector.SetActiveKeys(s.followed, 0)
+			}
+		}
+		s.followed = strategy
+		s.mu.Unlock()
+	}
+
+	for strategy, pattern := range patterns {
+		count, err := s.countKeys(ctx, pattern)
+		if err != nil {
+			return fmt.Errorf("strategy %s: %w", strategy, err)
+		}
+		s.collector.SetActiveKeys(strategy, count)
+	}
+
+	return nil
+}
+
+func (s *ActiveKeysScanner) countKeys(ctx context.Context, pattern string) (int64, error) {
+	var count int64
+	var cursor uint64
+
+	for {
+		keys, next, err := s.redisClient.Scan(ctx, cursor, pattern, s.scanCount).Result()
+		if err != nil {
+			return 0, err
+		}
+
+		count += int64(len(keys))
+		cursor = next
+		if cursor == 0 {
+			return count, nil
+		}
+	}
+}
+
+// ActiveKeyPattern returns the SCAN pattern matching one key per client for
+// the given strategy and key prefix.
+func ActiveKeyPattern(strategy string, keyPrefix string) string {
+	if strategy == string(SlidingWindowCounterStrategy) {
+		return fmt.Sprintf("%s:*:current", keyPrefix)
+	}
+	return fmt.Sprintf("%s:*", keyPrefix)
+}
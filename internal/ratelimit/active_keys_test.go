@@ -0,0 +1,153 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type activeKeysCollector struct {
+	metrics.NoopCollector
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (a *activeKeysCollector) SetActiveKeys(strategy string, count int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.counts[strategy] = count
+}
+
+func (a *activeKeysCollector) count(strategy string) (int64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	count, ok := a.counts[strategy]
+	return count, ok
+}
+
+func TestActiveKeyPattern(t *testing.T) {
+	assert.Equal(t, "rl:tb::*", ActiveKeyPattern("token_bucket", "rl:tb:"))
+	assert.Equal(t, "rl:swl::*", ActiveKeyPattern("sliding_window_log", "rl:swl:"))
+	assert.Equal(t, "rl:swc::*:current", ActiveKeyPattern("sliding_window_counter", "rl:swc:"))
+}
+
+func TestNewActiveKeysScanner_Defaults(t *testing.T) {
+	scanner := NewActiveKeysScanner(&redis.Client{}, metrics.NewNoopCollector(), 0, 0)
+
+	assert.Equal(t, DefaultActiveKeysScanInterval, scanner.interval)
+	assert.Equal(t, int64(DefaultActiveKeysScanCount), scanner.scanCount)
+
+	scanner = NewActiveKeysScanner(&redis.Client{}, metrics.NewNoopCollector(), time.Minute, 50)
+	scanner.AddStrategy("token_bucket", "rl:tb::*")
+
+	assert.Equal(t, time.Minute, scanner.interval)
+	assert.Equal(t, int64(50), scanner.scanCount)
+	assert.Equal(t, "rl:tb::*", scanner.patterns["token_bucket"])
+}
+
+func TestActiveKeysScanner_ScanOnce(t *testing.T) {
+	client, server := newScriptRedis(t)
+	for i := 0; i < 5; i++ {
+		server.HSet(fmt.Sprintf("rl:tb::client-%d", i), "tokens", "1")
+	}
+	for i := 0; i < 3; i++ {
+		server.Set(fmt.Sprintf("rl:swc::client-%d:current", i), "1")
+		server.Set(fmt.Sprintf("rl:swc::client-%d:previous", i), "1")
+	}
+	server.Set("rl:other::client-0", "1")
+
+	collector := &activeKeysCollector{counts: make(map[string]int64)}
+	scanner := NewActiveKeysScanner(client, collector, time.Minute, 2)
+	scanner.AddStrategy("token_bucket", ActiveKeyPattern("token_bucket", "rl:tb:"))
+	scanner.AddStrategy("sliding_window_counter", ActiveKeyPattern("sliding_window_counter", "rl:swc:"))
+	scanner.AddStrategy("sliding_window_log", ActiveKeyPattern("sliding_window_log", "rl:swl:"))
+
+	require.NoError(t, scanner.ScanOnce(context.Background()))
+	assert.Equal(t, map[string]int64{
+		"token_bucket":           5,
+		"sliding_window_counter": 3,
+		"sliding_window_log":     0,
+	}, collector.counts)
+
+	server.Del("rl:tb::client-0")
+	require.NoError(t, scanner.ScanOnce(context.Background()))
+	assert.Equal(t, int64(4), collector.counts["token_bucket"], "the gauge follows keys expiring")
+
+	server.Close()
+	assert.Error(t, scanner.ScanOnce(context.Background()))
+	assert.Equal(t, int64(4), collector.counts["token_bucket"], "failed scans leave the gauge alone")
+}
+
+func TestActiveKeysScanner_ResetsGaugeOnStepDown(t *testing.T) {
+	client, server := newScriptRedis(t)
+	server.Set("rl:tb::client-0", "1")
+
+	leader, err := NewLeaderElection(client, "rl:leader", 15*time.Second)
+	require.NoError(t, err)
+	require.NoError(t, leader.Campaign(context.Background()))
+
+	collector := &activeKeysCollector{counts: make(map[string]int64)}
+	scanner := NewActiveKeysScanner(client, collector, time.Millisecond, 10)
+	scanner.AddStrategy("token_bucket", "rl:tb::*")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scanner.Start(ctx, NewHousekeeping(leader))
+	require.Eventually(t, func() bool {
+		count, _ := collector.count("token_bucket")
+		return count == 1
+	}, time.Second, time.Millisecond)
+
+	server.FastForward(16 * time.Second)
+	successor, err := NewLeaderElection(client, "rl:leader", 15*time.Second)
+	require.NoError(t, err)
+	require.NoError(t, successor.Campaign(context.Background()))
+	require.NoError(t, leader.Campaign(context.Background()))
+	require.False(t, leader.IsLeader())
+
+	assert.Eventually(t, func() bool {
+		count, _ := collector.count("token_bucket")
+		return count == 0
+	}, time.Second, time.Millisecond, "the former leader stops reporting its last count")
+}
+
+func TestActiveKeysScanner_FollowsCurrentStrategy(t *testing.T) {
+	client, server := newScriptRedis(t)
+	server.HSet("rl:tb::client-0", "tokens", "1")
+	server.Set("rl:swc::client-0:current", "1")
+	server.Set("rl:swc::client-1:current", "1")
+
+	strategy := "token_bucket"
+	prefixes := map[string]string{"token_bucket": "rl:tb:", "sliding_window_counter": "rl:swc:"}
+	collector := &activeKeysCollector{counts: make(map[string]int64)}
+	scanner := NewActiveKeysScanner(client, collector, time.Minute, 10)
+	scanner.Follow(func() (string, string, error) {
+		return strategy, ActiveKeyPattern(strategy, prefixes[strategy]), nil
+	})
+
+	require.NoError(t, scanner.ScanOnce(context.Background()))
+	assert.Equal(t, map[string]int64{"token_bucket": 1}, collector.counts)
+
+	strategy = "sliding_window_counter"
+	require.NoError(t, scanner.ScanOnce(context.Background()))
+	assert.Equal(t, map[string]int64{
+		"token_bucket":           0,
+		"sliding_window_counter": 2,
+	}, collector.counts, "the strategy switched away from is reset")
+
+	prefixes["sliding_window_counter"] = "rl:swc2:"
+	require.NoError(t, scanner.ScanOnce(context.Background()))
+	assert.Equal(t, int64(0), collector.counts["sliding_window_counter"], "a reloaded key prefix is picked up")
+
+	scanner.Follow(func() (string, string, error) {
+		return "", "", fmt.Errorf("no key prefix")
+	})
+	assert.ErrorContains(t, scanner.ScanOnce(context.Background()), "current strategy: no key prefix")
+}
@@ -0,0 +1,389 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type AsyncAccountingConfig struct {
+	// BatchSize is how many requests are recorded per flush at most.
+	BatchSize int
+	// FlushInterval is how long requests wait to be recorded at most.
+	FlushInterval time.Duration
+	// BufferSize bounds the requests waiting to be recorded. When the
+	// limiter can't keep up, further requests go unrecorded rather than
+	// slowing down requests.
+	BufferSize int
+	// Timeout bounds recording the requests of one key.
+	Timeout time.Duration
+}
+
+// asyncUsage is n requests of key waiting to be charged, or -n waiting to be
+// refunded.
+type asyncUsage struct {
+	ctx       context.Context
+	limiter   BatchRateLimiter
+	key       string
+	n         int64
+	timestamp time.Time
+}
+
+type asyncBatchKey struct {
+	limiter BatchRateLimiter
+	key     string
+}
+
+type asyncDenial struct {
+	until time.Time
+	limit int64
+}
+
+// AsyncAccounting lets requests through without waiting for the limiter and
+// records them afterwards, in batches that charge each key once per flush.
+// A key found over its limit by a flush is denied locally until the limiter
+// would let it through again, so enforcement lags by up to a flush: the
+// trade for near-zero added latency on limits that needn't be strict, such
+// as internal telemetry.
+type AsyncAccounting struct {
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration
+	buffer        chan asyncUsage
+	dropped       atomic.Int64
+	done          chan struct{}
+
+	mu     sync.Mutex
+	denied map[string]asyncDenial
+}
+
+func NewAsyncAccounting(config AsyncAccountingConfig) *AsyncAccounting {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultAsyncBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultAsyncFlushInterval
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = DefaultAsyncBufferSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultAsyncFlushInterval
+	}
+
+	return &AsyncAccounting{
+		batchSize:     config.BatchSize,
+		flushInterval: config.FlushInterval,
+		timeout:       config.Timeout,
+		buffer:        make(chan asyncUsage, config.BufferSize),
+		done:          make(chan struct{}),
+		denied:        make(map[string]asyncDenial),
+	}
+}
+
+// Wrap returns limiter with its requests recorded by a. Limiters wrapped by
+// the same AsyncAccounting share its buffer and denials. The limiter must
+// decide batches, so a flush charges each key with one call however many
+// requests it had.
+func (a *AsyncAccounting) Wrap(limiter RateLimiter) (*AsyncRateLimiter, error) {
+	batcher, ok := limiter.(BatchRateLimiter)
+	if !ok || !SupportsBatch(limiter) {
+		return nil, ErrBatchNotSupported
+	}
+	return &AsyncRateLimiter{limiter: batcher, accounting: a}, nil
+}
+
+// Dropped reports how many requests went unrecorded because the buffer was
+// full.
+func (a *AsyncAccounting) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+// Start records batches until ctx is cancelled, then records what is left.
+// Done is closed once that has finished.
+func (a *AsyncAccounting) Start(ctx context.Context) {
+	go func() {
+		defer close(a.done)
+
+		ticker := time.NewTicker(a.flushInterval)
+		defer ticker.Stop()
+
+		batch := make([]asyncUsage, 0, a.batchSize)
+		var reportedDrops int64
+		for {
+			select {
+			case <-ctx.Done():
+				for drained := false; !drained; {
+					select {
+					case usage := <-a.buffer:
+						batch = append(batch, usage)
+					default:
+						drained = true
+					}
+				}
+				a.flush(batch)
+				return
+			case usage := <-a.buffer:
+				batch = append(batch, usage)
+				if len(batch) < a.batchSize {
+					continue
+				}
+			case <-ticker.C:
+				if dropped := a.Dropped(); dropped > reportedDrops {
+					slog.Warn("async accounting buffer full, requests went unrecorded", "dropped", dropped-reportedDrops)
+					reportedDrops = dropped
+				}
+			}
+
+			a.flush(batch)
+			batch = batch[:0]
+		}
+	}()
+}
+
+func (a *AsyncAccounting) Done() <-chan struct{} {
+	return a.done
+}
+
+func (a *AsyncAccounting) record(usage asyncUsage) {
+	select {
+	case a.buffer <- usage:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// flush charges each key of batch once for all its requests, net of their
+// refunds, and remembers the keys found over their limit.
+func (a *AsyncAccounting) flush(batch []asyncUsage) {
+	if len(batch) == 0 {
+		return
+	}
+
+	totals := make(map[asyncBatchKey]*asyncUsage)
+	order := make([]asyncBatchKey, 0, len(batch))
+	for _, usage := range batch {
+		batchKey := asyncBatchKey{limiter: usage.limiter, key: namespacedKey(usage.ctx, usage.key)}
+		if total, ok := totals[batchKey]; ok {
+			// The latest request's context and time decide.
+			total.ctx, total.timestamp = usage.ctx, usage.timestamp
+			total.n += usage.n
+			continue
+		}
+		total := usage
+		totals[batchKey] = &total
+		order = append(order, batchKey)
+	}
+
+	var failed int
+	var lastErr error
+	for _, batchKey := range order {
+		usage := totals[batchKey]
+		if usage.n < 0 {
+			if err := a.refund(usage); err != nil {
+				failed++
+				lastErr = err
+			}
+			continue
+		}
+		if usage.n == 0 {
+			continue
+		}
+		response, denied, err := a.charge(usage)
+		if err != nil {
+			failed++
+			lastErr = err
+			continue
+		}
+		if denied {
+			a.deny(batchKey.key, usage.timestamp, response)
+		}
+	}
+	if failed > 0 {
+		slog.Warn("failed to record requests let through by async accounting", "keys", failed, "error", lastErr.Error())
+	}
+	a.sweep(time.Now())
+}
+
+// charge records usage.n requests with one call. It reports whether the key
+// ran out.
+func (a *AsyncAccounting) charge(usage *asyncUsage) (RateLimitResponse, bool, error) {
+	ctx, cancel := context.WithTimeout(usage.ctx, a.timeout)
+	defer cancel()
+
+	granted, response, err := usage.limiter.AllowN(ctx, usage.key, usage.n, usage.timestamp)
+	return response, granted < usage.n, err
+}
+
+// refund gives back the -usage.n requests refunded beyond those charged in
+// the same flush.
+func (a *AsyncAccounting) refund(usage *asyncUsage) error {
+	ctx, cancel := context.WithTimeout(usage.ctx, a.timeout)
+	defer cancel()
+
+	refunder, ok := usage.limiter.(Refunder)
+	if !ok {
+		return ErrRefundNotSupported
+	}
+	return refunder.Refund(ctx, usage.key, -usage.n, usage.timestamp)
+}
+
+func (a *AsyncAccounting) deny(key string, timestamp time.Time, response RateLimitResponse) {
+	until := response.ResetTime
+	if response.RetryAfter != nil {
+		until = timestamp.Add(*response.RetryAfter)
+	}
+	if !until.After(timestamp) {
+		until = timestamp.Add(a.flushInterval)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.denied[key] = asyncDenial{until: until, limit: response.Limit}
+}
+
+// denial returns the denial of key in force at timestamp, if any.
+func (a *AsyncAccounting) denial(key string, timestamp time.Time) (asyncDenial, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	denial, ok := a.denied[key]
+	if !ok {
+		return asyncDenial{}, false
+	}
+	if !timestamp.Before(denial.until) {
+		delete(a.denied, key)
+		return asyncDenial{}, false
+	}
+	return denial, true
+}
+
+func (a *AsyncAccounting) forget(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.denied, key)
+}
+
+func (a *AsyncAccounting) sweep(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, denial := range a.denied {
+		if !now.Before(denial.until) {
+			delete(a.denied, key)
+		}
+	}
+}
+
+// AsyncRateLimiter answers checks straight away, from the denials of its
+// AsyncAccounting, and leaves recording them to it. Requests it lets through
+// have no limit or remaining count yet, so they are reported as optimistic.
+// Refunds are recorded with them; peeks, resets, debts and reservations
+// reach the wrapped limiter directly.
+type AsyncRateLimiter struct {
+	limiter    BatchRateLimiter
+	accounting *AsyncAccounting
+}
+
+func (a *AsyncRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	_, response, err := a.AllowN(ctx, key, 1, timestamp)
+	return response, err
+}
+
+// AllowN grants all n requests unless key was found over its limit.
+func (a *AsyncRateLimiter) AllowN(ctx context.Context, key string, n int64, timestamp time.Time) (int64, RateLimitResponse, error) {
+	metadata := Metadata{}
+	metadata.Set("async", true)
+	if denial, ok := a.accounting.denial(namespacedKey(ctx, key), timestamp); ok {
+		retryAfter := denial.until.Sub(timestamp)
+		return 0, RateLimitResponse{
+			Allowed:    false,
+			Limit:      denial.limit,
+			ResetTime:  denial.until,
+			RetryAfter: &retryAfter,
+			Metadata:   metadata,
+		}, nil
+	}
+
+	a.accounting.record(asyncUsage{
+		ctx:       context.WithoutCancel(ctx),
+		limiter:   a.limiter,
+		key:       key,
+		n:         n,
+		timestamp: timestamp,
+	})
+	return n, RateLimitResponse{Allowed: true, Optimistic: true, Metadata: metadata}, nil
+}
+
+func (a *AsyncRateLimiter) SupportsBatch() bool {
+	return SupportsBatch(a.limiter)
+}
+
+func (a *AsyncRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	peeker, ok := a.limiter.(Peeker)
+	if !ok {
+		return RateLimitResponse{Err: ErrPeekNotSupported}, ErrPeekNotSupported
+	}
+	return peeker.Peek(ctx, key, timestamp)
+}
+
+// Reset clears key in the wrapped limiter and lifts its local denial.
+func (a *AsyncRateLimiter) Reset(ctx context.Context, key string) error {
+	a.accounting.forget(namespacedKey(ctx, key))
+	return a.limiter.Reset(ctx, key)
+}
+
+func (a *AsyncRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	resetter, ok := a.limiter.(PrefixResetter)
+	if !ok {
+		return 0, ErrResetPrefixNotSupported
+	}
+	return resetter.ResetPrefix(ctx, prefix)
+}
+
+// Refund queues n requests of key to be given back, so they are netted
+// against its requests still waiting to be charged instead of being refunded
+// before they were charged. When the buffer is full they are refunded
+// straight away.
+func (a *AsyncRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	refunder, ok := a.limiter.(Refunder)
+	if !ok || !SupportsRefund(a.limiter) {
+		return ErrRefundNotSupported
+	}
+	select {
+	case a.accounting.buffer <- asyncUsage{
+		ctx:       context.WithoutCancel(ctx),
+		limiter:   a.limiter,
+		key:       key,
+		n:         -n,
+		timestamp: timestamp,
+	}:
+		return nil
+	default:
+		return refunder.Refund(ctx, key, n, timestamp)
+	}
+}
+
+func (a *AsyncRateLimiter) SupportsRefund() bool {
+	return SupportsRefund(a.limiter)
+}
+
+func (a *AsyncRateLimiter) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	debtor, ok := a.limiter.(Debtor)
+	if !ok {
+		return ErrDebtNotSupported
+	}
+	return debtor.AddDebt(ctx, key, n, timestamp)
+}
+
+func (a *AsyncRateLimiter) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error) {
+	reserver, ok := a.limiter.(Reserver)
+	if !ok {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: ErrReserveNotSupported}}, ErrReserveNotSupported
+	}
+	return reserver.ReserveN(ctx, key, n, timestamp, maxDelay)
+}
+
+func (a *AsyncRateLimiter) SupportsReserve() bool {
+	return SupportsReserve(a.limiter)
+}
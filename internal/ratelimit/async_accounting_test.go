@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type refundingBatchLimiter struct {
+	MockBatchRateLimiter
+}
+
+func (m *refundingBatchLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	return m.Called(ctx, key, n, timestamp).Error(0)
+}
+
+func TestAsyncAccounting_ChargesInBatches(t *testing.T) {
+	inner := new(MockBatchRateLimiter)
+	accounting := NewAsyncAccounting(AsyncAccountingConfig{FlushInterval: time.Hour})
+	limiter, err := accounting.Wrap(inner)
+	require.NoError(t, err)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		response, err := limiter.IsAllowed(context.Background(), "client", now)
+		require.NoError(t, err)
+		assert.True(t, response.Allowed, "requests are let through before they are charged")
+		assert.True(t, response.Optimistic)
+		assert.False(t, response.Bypassed)
+		assert.Equal(t, true, response.Metadata.Value("async"))
+	}
+
+	retryAfter := 30 * time.Second
+	inner.On("AllowN", mock.Anything, "client", int64(3), now).Return(
+		int64(2), RateLimitResponse{Allowed: false, Limit: 2, RetryAfter: &retryAfter}, nil).Once()
+	accounting.flush(drainAsyncBuffer(accounting))
+	inner.AssertExpectations(t)
+
+	response, err := limiter.IsAllowed(context.Background(), "client", now.Add(10*time.Second))
+	require.NoError(t, err)
+	assert.False(t, response.Allowed, "the key is denied once a flush finds it over its limit")
+	assert.Equal(t, int64(2), response.Limit)
+	require.NotNil(t, response.RetryAfter)
+	assert.Equal(t, 20*time.Second, *response.RetryAfter)
+
+	other, err := limiter.IsAllowed(WithNamespace(context.Background(), "tenant"), "client", now)
+	require.NoError(t, err)
+	assert.True(t, other.Allowed, "denials are per namespace")
+
+	response, err = limiter.IsAllowed(context.Background(), "client", now.Add(retryAfter))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed, "the denial ends with its retry after")
+}
+
+func TestAsyncAccounting_NeedsBatches(t *testing.T) {
+	accounting := NewAsyncAccounting(AsyncAccountingConfig{FlushInterval: time.Hour})
+	_, err := accounting.Wrap(new(MockRateLimiterForFactory))
+	assert.ErrorIs(t, err, ErrBatchNotSupported, "charging one request at a time would flood the limiter")
+}
+
+func TestAsyncAccounting_NetsRefunds(t *testing.T) {
+	inner := new(refundingBatchLimiter)
+	accounting := NewAsyncAccounting(AsyncAccountingConfig{FlushInterval: time.Hour})
+	limiter, err := accounting.Wrap(inner)
+	require.NoError(t, err)
+	now := time.Now()
+
+	_, charge, err := Begin(context.Background(), limiter, "client", now)
+	require.NoError(t, err)
+	require.NotNil(t, charge, "requests let through are charged")
+	_, _, err = limiter.AllowN(context.Background(), "client", 2, now)
+	require.NoError(t, err)
+	require.NoError(t, charge.Rollback(context.Background()))
+
+	inner.On("AllowN", mock.Anything, "client", int64(2), now).Return(int64(2), RateLimitResponse{Allowed: true}, nil).Once()
+	accounting.flush(drainAsyncBuffer(accounting))
+	inner.AssertExpectations(t)
+
+	require.NoError(t, limiter.Refund(context.Background(), "client", 1, now))
+	inner.On("Refund", mock.Anything, "client", int64(1), now).Return(nil).Once()
+	accounting.flush(drainAsyncBuffer(accounting))
+	inner.AssertExpectations(t)
+}
+
+func TestAsyncAccounting_BufferFull(t *testing.T) {
+	accounting := NewAsyncAccounting(AsyncAccountingConfig{BufferSize: 1})
+	limiter, err := accounting.Wrap(new(MockBatchRateLimiter))
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		response, err := limiter.IsAllowed(context.Background(), "client", time.Now())
+		require.NoError(t, err)
+		assert.True(t, response.Allowed, "a full buffer doesn't hold up requests")
+	}
+	assert.Equal(t, int64(2), accounting.Dropped())
+}
+
+func TestAsyncAccounting_FlushesOnStop(t *testing.T) {
+	inner := new(MockBatchRateLimiter)
+	accounting := NewAsyncAccounting(AsyncAccountingConfig{FlushInterval: time.Hour})
+	limiter, err := accounting.Wrap(inner)
+	require.NoError(t, err)
+	now := time.Now()
+
+	inner.On("AllowN", mock.Anything, "client", int64(2), now).Return(int64(2), RateLimitResponse{Allowed: true}, nil).Once()
+	_, _, err = limiter.AllowN(context.Background(), "client", 2, now)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	accounting.Start(ctx)
+	cancel()
+	select {
+	case <-accounting.Done():
+	case <-time.After(time.Second):
+		t.Fatal("async accounting didn't stop")
+	}
+	inner.AssertExpectations(t)
+}
+
+func drainAsyncBuffer(accounting *AsyncAccounting) []asyncUsage {
+	var batch []asyncUsage
+	for {
+		select {
+		case usage := <-accounting.buffer:
+			batch = append(batch, usage)
+		default:
+			return batch
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type AuditLogConfig struct {
+	Output io.Writer
+	// AllowSampleRate and DenySampleRate are the fractions, from 0 to 1, of
+	// allowed and denied decisions to record.
+	AllowSampleRate float64
+	DenySampleRate  float64
+}
+
+// AuditRecord is one line of the audit log. Unlike the denial log it keeps
+// the key in the clear, since it exists to identify abusive clients.
+type AuditRecord struct {
+	Time         time.Time              `json:"time"`
+	RequestID    string                 `json:"request_id,omitempty"`
+	DecisionID   string                 `json:"decision_id,omitempty"`
+	Key          string                 `json:"key"`
+	ClientIP     string                 `json:"client_ip,omitempty"`
+	Method       string                 `json:"method"`
+	Route        string                 `json:"route"`
+	Policy       string                 `json:"policy,omitempty"`
+	Allowed      bool                   `json:"allowed"`
+	Limit        int64                  `json:"limit"`
+	Remaining    int64                  `json:"remaining"`
+	RetryAfterMs *int64                 `json:"retry_after_ms,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// AuditLog writes a sample of decisions as JSON lines, typically all denials
+// and a small share of allowed requests, for later abuse investigation.
+// Enqueued records are written by a background worker, so slow output never
+// holds up a request.
+type AuditLog struct {
+	allowSampleRate float64
+	denySampleRate  float64
+	sample          func() float64
+	queue           chan AuditRecord
+	dropped         atomic.Int64
+	done            chan struct{}
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewAuditLog(config AuditLogConfig) (*AuditLog, error) {
+	if config.Output == nil {
+		return nil, fmt.Errorf("audit log output is required")
+	}
+	if config.AllowSampleRate < 0 || config.AllowSampleRate > 1 || config.DenySampleRate < 0 || config.DenySampleRate > 1 {
+		return nil, fmt.Errorf("audit log sample rates must be between 0 and 1")
+	}
+
+	return &AuditLog{
+		allowSampleRate: config.AllowSampleRate,
+		denySampleRate:  config.DenySampleRate,
+		sample:          rand.Float64,
+		queue:           make(chan AuditRecord, DefaultAuditLogQueueSize),
+		done:            make(chan struct{}),
+		encoder:         json.NewEncoder(config.Output),
+	}, nil
+}
+
+// Start writes enqueued records until ctx is cancelled, then writes what is
+// left. Done is closed once that has finished.
+func (a *AuditLog) Start(ctx context.Context) {
+	go func() {
+		defer close(a.done)
+
+		ticker := time.NewTicker(AuditLogDropReportInterval)
+		defer ticker.Stop()
+
+		var reportedDrops int64
+		for {
+			select {
+			case <-ctx.Done():
+				for {
+					select {
+					case record := <-a.queue:
+						a.write(record)
+					default:
+						return
+					}
+				}
+			case record := <-a.queue:
+				a.write(record)
+			case <-ticker.C:
+				if dropped := a.Dropped(); dropped > reportedDrops {
+					slog.Warn("audit log queue full, decisions went unrecorded", "dropped", dropped-reportedDrops)
+					reportedDrops = dropped
+				}
+			}
+		}
+	}()
+}
+
+func (a *AuditLog) Done() <-chan struct{} {
+	return a.done
+}
+
+// Enqueue queues record to be written by the worker, dropping it when the
+// queue is full.
+func (a *AuditLog) Enqueue(record AuditRecord) {
+	select {
+	case a.queue <- record:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// Dropped reports how many records were dropped because the queue was full.
+func (a *AuditLog) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+func (a *AuditLog) write(record AuditRecord) {
+	if err := a.Record(record); err != nil {
+		slog.Error("failed to write audit log", "request_id", record.RequestID, "error", err.Error())
+	}
+}
+
+// Sampled reports whether a decision with the given outcome should be
+// recorded. Callers check it first to avoid building records that are thrown
+// away.
+func (a *AuditLog) Sampled(allowed bool) bool {
+	rate := a.denySampleRate
+	if allowed {
+		rate = a.allowSampleRate
+	}
+	return rate >= 1 || (rate > 0 && a.sample() < rate)
+}
+
+func (a *AuditLog) Record(record AuditRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.encoder.Encode(record)
+}
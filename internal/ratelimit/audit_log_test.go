@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAuditLog_Invalid(t *testing.T) {
+	_, err := NewAuditLog(AuditLogConfig{DenySampleRate: 1})
+	assert.Error(t, err)
+	_, err = NewAuditLog(AuditLogConfig{Output: &bytes.Buffer{}, AllowSampleRate: 1.5})
+	assert.Error(t, err)
+	_, err = NewAuditLog(AuditLogConfig{Output: &bytes.Buffer{}, DenySampleRate: -0.1})
+	assert.Error(t, err)
+}
+
+func TestAuditLog_Sampled(t *testing.T) {
+	auditLog, err := NewAuditLog(AuditLogConfig{Output: &bytes.Buffer{}, AllowSampleRate: 0.01, DenySampleRate: 1})
+	require.NoError(t, err)
+
+	auditLog.sample = func() float64 { return 0.5 }
+	assert.False(t, auditLog.Sampled(true))
+	assert.True(t, auditLog.Sampled(false), "every denial is recorded")
+
+	auditLog.sample = func() float64 { return 0.005 }
+	assert.True(t, auditLog.Sampled(true))
+
+	auditLog.denySampleRate = 0
+	auditLog.sample = func() float64 { return 0 }
+	assert.False(t, auditLog.Sampled(false), "a zero rate records nothing")
+}
+
+func TestAuditLog_Record(t *testing.T) {
+	var output bytes.Buffer
+	auditLog, err := NewAuditLog(AuditLogConfig{Output: &output, DenySampleRate: 1})
+	require.NoError(t, err)
+
+	retryAfterMs := int64(1500)
+	require.NoError(t, auditLog.Record(AuditRecord{Key: "client", Method: "GET", Route: "/api/restricted", RetryAfterMs: &retryAfterMs}))
+	require.NoError(t, auditLog.Record(AuditRecord{Key: "other", Allowed: true, Metadata: map[string]interface{}{"policy": "default"}}))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var first map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.Equal(t, "client", first["key"])
+	assert.Equal(t, false, first["allowed"])
+	assert.Equal(t, float64(1500), first["retry_after_ms"])
+	assert.Contains(t, lines[1], `"metadata":{"policy":"default"}`)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	file, err := OpenRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	defer file.Close()
+
+	for _, line := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		_, err = file.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	read := func(name string) string {
+		content, err := os.ReadFile(name)
+		require.NoError(t, err)
+		return string(content)
+	}
+	assert.Equal(t, "dddddd\n", read(path))
+	assert.Equal(t, "cccccc\n", read(path+".1"))
+	assert.Equal(t, "bbbbbb\n", read(path+".2"))
+	assert.NoFileExists(t, path+".3", "only max backups are kept")
+}
+
+func TestRotatingFile_AppendsToExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0o644))
+
+	file, err := OpenRotatingFile(path, 100, 1)
+	require.NoError(t, err)
+	_, err = file.Write([]byte("new\n"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "old\nnew\n", string(content))
+}
+
+func TestAuditLog_Enqueue(t *testing.T) {
+	var output bytes.Buffer
+	auditLog, err := NewAuditLog(AuditLogConfig{Output: &output, DenySampleRate: 1})
+	require.NoError(t, err)
+
+	for i := 0; i < DefaultAuditLogQueueSize+1; i++ {
+		auditLog.Enqueue(AuditRecord{Key: "client"})
+	}
+	assert.Equal(t, int64(1), auditLog.Dropped(), "records beyond the queue are dropped")
+	assert.Zero(t, output.Len(), "records are written by the worker")
+
+	ctx, stop := context.WithCancel(context.Background())
+	stop()
+	auditLog.Start(ctx)
+	<-auditLog.Done()
+	assert.Equal(t, DefaultAuditLogQueueSize, strings.Count(output.String(), "\n"), "queued records are written on shutdown")
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// The strategy benchmarks run against miniredis in the same process, so both
+// ns/op and allocs/op include the server's share and only mean something
+// compared with another run on the same machine (make bench-compare).
+
+const benchmarkKeys = 100
+
+// benchmarkIsAllowed spreads decisions over benchmarkKeys keys and moves the
+// clock on by a millisecond each, so windows keep sliding instead of every
+// decision after the first few being a denial.
+func benchmarkIsAllowed(b *testing.B, ctx context.Context, limiter RateLimiter) {
+	b.Helper()
+	keys := make([]string, benchmarkKeys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("bench:%d", i)
+	}
+	start := time.Unix(1000, 500)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		timestamp := start.Add(time.Duration(i) * time.Millisecond)
+		if _, err := limiter.IsAllowed(ctx, keys[i%benchmarkKeys], timestamp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func newBenchmarkTokenBucket(b *testing.B) *TokenBucketRateLimiter {
+	client, _ := newScriptRedis(b)
+	limiter, err := NewTokenBucketRateLimiter(TokenBucketConfig{
+		KeyPrefix:           "bench:tb",
+		BucketSize:          100,
+		RefillRatePerSecond: 50,
+	}, client)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return limiter
+}
+
+func BenchmarkTokenBucket_IsAllowed(b *testing.B) {
+	benchmarkIsAllowed(b, context.Background(), newBenchmarkTokenBucket(b))
+}
+
+func BenchmarkLeasedTokenBucket_IsAllowed(b *testing.B) {
+	limiter, err := NewLeasedTokenBucketRateLimiter(newBenchmarkTokenBucket(b), TokenLeaseConfig{
+		LeaseSize: 20,
+		LeaseTTL:  time.Minute,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkIsAllowed(b, context.Background(), limiter)
+}
+
+func BenchmarkSlidingWindowLog_IsAllowed(b *testing.B) {
+	client, _ := newScriptRedis(b)
+	limiter, err := NewSlidingWindowLogRateLimiter(SlidingWindowLogConfig{
+		KeyPrefix:  "bench:swl",
+		WindowSize: time.Second,
+		BucketSize: 100,
+	}, client)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkIsAllowed(b, context.Background(), limiter)
+}
+
+func BenchmarkSlidingWindowCounter_IsAllowed(b *testing.B) {
+	for _, subWindows := range []int{0, 10} {
+		b.Run(fmt.Sprintf("sub_windows=%d", subWindows), func(b *testing.B) {
+			client, _ := newScriptRedis(b)
+			limiter, err := NewSlidingWindowCounterRateLimiter(SlidingWindowCounterConfig{
+				KeyPrefix:  "bench:swc",
+				WindowSize: time.Second,
+				BucketSize: 100,
+				SubWindows: subWindows,
+			}, client)
+			if err != nil {
+				b.Fatal(err)
+			}
+			benchmarkIsAllowed(b, context.Background(), limiter)
+		})
+	}
+}
+
+func BenchmarkQuota_IsAllowed(b *testing.B) {
+	client, _ := newScriptRedis(b)
+	limiter, err := NewQuotaRateLimiter(QuotaConfig{
+		KeyPrefix: "bench:quota",
+		Period:    QuotaPeriodDaily,
+		Limit:     1 << 40,
+	}, client)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkIsAllowed(b, context.Background(), limiter)
+}
+
+func BenchmarkHierarchical_IsAllowed(b *testing.B) {
+	client, _ := newScriptRedis(b)
+	limiter, err := NewHierarchicalRateLimiter(HierarchicalConfig{
+		KeyPrefix:                       "bench:hier",
+		BucketSize:                      100,
+		RefillRatePerSecond:             50,
+		OrganizationBucketSize:          1000,
+		OrganizationRefillRatePerSecond: 500,
+		GlobalBucketSize:                10000,
+		GlobalRefillRatePerSecond:       5000,
+	}, client)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkIsAllowed(b, WithOrganization(context.Background(), "acme"), limiter)
+}
+
+func BenchmarkMultiWindow_IsAllowed(b *testing.B) {
+	client, _ := newScriptRedis(b)
+	limiter, err := NewMultiWindowRateLimiter(MultiWindowConfig{
+		KeyPrefix:       "bench:mw",
+		WindowSize:      time.Hour,
+		BucketSize:      1 << 40,
+		BurstWindowSize: time.Second,
+		BurstLimit:      100,
+	}, client)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkIsAllowed(b, context.Background(), limiter)
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Charge is a request counted tentatively until its outcome is known, e.g.
+// a login that should only count against a brute-force limit when it fails.
+// The request is charged up front, so a key that has run out is still
+// denied, and Commit keeps the charge while Rollback refunds it. Whichever is
+// called first settles the charge; later calls do nothing.
+type Charge struct {
+	refunder  Refunder
+	key       string
+	n         int64
+	timestamp time.Time
+	settled   atomic.Bool
+}
+
+// NewCharge returns the pending charge of n requests key was charged at
+// timestamp by the limiter refunder.
+func NewCharge(refunder Refunder, key string, n int64, timestamp time.Time) *Charge {
+	return &Charge{refunder: refunder, key: key, n: n, timestamp: timestamp}
+}
+
+// Begin decides a request like IsAllowed and, when it is allowed, returns
+// its pending charge. Bypassed requests cost nothing and get no charge;
+// optimistic ones are charged in the background and get one.
+// The limiter must support refunds.
+func Begin(ctx context.Context, rateLimiter RateLimiter, key string, timestamp time.Time) (RateLimitResponse, *Charge, error) {
+	refunder, ok := rateLimiter.(Refunder)
+	if !ok || !SupportsRefund(rateLimiter) {
+		return RateLimitResponse{}, nil, ErrRefundNotSupported
+	}
+
+	response, err := rateLimiter.IsAllowed(ctx, key, timestamp)
+	if err != nil || !response.Allowed || response.Bypassed {
+		return response, nil, err
+	}
+	return response, NewCharge(refunder, key, 1, timestamp), nil
+}
+
+func (c *Charge) Key() string {
+	return c.key
+}
+
+// Commit keeps the charge.
+func (c *Charge) Commit() {
+	c.settled.Store(true)
+}
+
+// Rollback refunds the charge unless it was already settled. A failed
+// refund leaves the charge in place.
+func (c *Charge) Rollback(ctx context.Context) error {
+	if !c.settled.CompareAndSwap(false, true) {
+		return nil
+	}
+	return c.refunder.Refund(ctx, c.key, c.n, c.timestamp)
+}
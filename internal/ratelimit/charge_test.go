@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCharge(t *testing.T) {
+	client, server := newScriptRedis(t)
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 2, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	now := time.Unix(0, scriptNow)
+
+	response, charge, err := Begin(ctx, bucket, "login", now)
+	require.NoError(t, err)
+	require.True(t, response.Allowed)
+	require.NoError(t, charge.Rollback(ctx))
+	assert.Equal(t, "2", server.HGet("tb:login", "tokens"), "rolled back")
+	require.NoError(t, charge.Rollback(ctx))
+	assert.Equal(t, "2", server.HGet("tb:login", "tokens"), "only once")
+
+	_, charge, err = Begin(ctx, bucket, "login", now)
+	require.NoError(t, err)
+	charge.Commit()
+	require.NoError(t, charge.Rollback(ctx))
+	assert.Equal(t, "1", server.HGet("tb:login", "tokens"), "committed charges stay")
+
+	_, _, err = Begin(ctx, bucket, "login", now)
+	require.NoError(t, err)
+	response, charge, err = Begin(ctx, bucket, "login", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Nil(t, charge, "denied requests cost nothing")
+}
+
+func TestBegin_NeedsRefunds(t *testing.T) {
+	_, _, err := Begin(context.Background(), &MockRateLimiterForFactory{}, "login", time.Now())
+	assert.ErrorIs(t, err, ErrRefundNotSupported)
+}
@@ -0,0 +1,269 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Clock sources a strategy can decide by.
+const (
+	ClockSourceLocal  = "local"
+	ClockSourceRedis  = "redis"
+	ClockSourceHybrid = "hybrid"
+)
+
+const (
+	DefaultClockSyncInterval = 30 * time.Second
+	DefaultClockMaxRoundTrip = 50 * time.Millisecond
+)
+
+// Clock maps a timestamp taken from the local clock onto the clock a strategy
+// decides by, so instances whose clocks disagree still share windows and
+// refill times.
+type Clock interface {
+	Adjust(ctx context.Context, timestamp time.Time) (time.Time, error)
+}
+
+// redisOffset estimates how far Redis' clock is ahead of the local one from a
+// TIME call, assuming Redis read its clock halfway through the round trip.
+func redisOffset(ctx context.Context, redisClient *redis.Client) (time.Duration, time.Duration, error) {
+	sent := time.Now()
+	serverTime, err := redisClient.Time(ctx).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	received := time.Now()
+
+	roundTrip := received.Sub(sent)
+	return serverTime.Sub(sent.Add(roundTrip / 2)), roundTrip, nil
+}
+
+// RedisClock reads Redis TIME on every call, making Redis the authoritative
+// clock at the cost of a round trip per decision.
+type RedisClock struct {
+	redisClient *redis.Client
+}
+
+func NewRedisClock(redisClient *redis.Client) *RedisClock {
+	return &RedisClock{redisClient: redisClient}
+}
+
+func (r *RedisClock) Adjust(ctx context.Context, timestamp time.Time) (time.Time, error) {
+	offset, _, err := redisOffset(ctx, r.redisClient)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read redis time: %w", err)
+	}
+	return timestamp.Add(offset), nil
+}
+
+// HybridClock keeps using the local clock but corrects it by its offset from
+// Redis' clock, measured again every syncInterval. Samples whose round trip
+// took longer than maxRoundTrip are too imprecise and are dropped. Until the
+// first sync succeeds, and while Redis can't be reached, the last offset
+// known is used.
+type HybridClock struct {
+	redisClient  *redis.Client
+	syncInterval time.Duration
+	maxRoundTrip time.Duration
+
+	mu       sync.Mutex
+	offset   time.Duration
+	syncedAt time.Time
+	syncing  bool
+}
+
+func NewHybridClock(redisClient *redis.Client, syncInterval time.Duration, maxRoundTrip time.Duration) *HybridClock {
+	if syncInterval <= 0 {
+		syncInterval = DefaultClockSyncInterval
+	}
+	if maxRoundTrip <= 0 {
+		maxRoundTrip = DefaultClockMaxRoundTrip
+	}
+
+	return &HybridClock{
+		redisClient:  redisClient,
+		syncInterval: syncInterval,
+		maxRoundTrip: maxRoundTrip,
+	}
+}
+
+// Adjust never fails: a stale offset is resynced by the one caller that
+// notices, while concurrent callers keep using the previous offset.
+func (h *HybridClock) Adjust(ctx context.Context, timestamp time.Time) (time.Time, error) {
+	h.mu.Lock()
+	offset := h.offset
+	stale := !h.syncing && time.Since(h.syncedAt) >= h.syncInterval
+	if stale {
+		h.syncing = true
+	}
+	h.mu.Unlock()
+
+	if stale {
+		offset = h.sync(ctx)
+	}
+	return timestamp.Add(offset), nil
+}
+
+func (h *HybridClock) sync(ctx context.Context) time.Duration {
+	offset, roundTrip, err := redisOffset(ctx, h.redisClient)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.syncing = false
+
+	switch {
+	case err != nil:
+		slog.Warn("clock sync failed, keeping the last offset", "error", err, "offset", h.offset)
+		return h.offset
+	case roundTrip > h.maxRoundTrip:
+		slog.Debug("clock sync sample dropped", "round_trip", roundTrip)
+		return h.offset
+	}
+
+	h.offset = offset
+	h.syncedAt = time.Now()
+	return offset
+}
+
+// Offset is how far Redis' clock was ahead of the local one at the last sync.
+func (h *HybridClock) Offset() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.offset
+}
+
+// NewClock returns the clock for source, or nil for the local clock.
+func NewClock(source string, redisClient *redis.Client, syncInterval time.Duration, maxRoundTrip time.Duration) (Clock, error) {
+	switch source {
+	case "", ClockSourceLocal:
+		return nil, nil
+	case ClockSourceRedis:
+		return NewRedisClock(redisClient), nil
+	case ClockSourceHybrid:
+		return NewHybridClock(redisClient, syncInterval, maxRoundTrip), nil
+	default:
+		return nil, fmt.Errorf("unknown clock source: %s", source)
+	}
+}
+
+// ClockDecorator adjusts every timestamp passed to rateLimiter with clock.
+// Refunds and debts are adjusted too, so they land on the same clock as the
+// decisions they belong to. ResetTime is moved back onto the local clock, as
+// callers compare it with time.Now; metadata times are left on the strategy's.
+type ClockDecorator struct {
+	rateLimiter RateLimiter
+	clock       Clock
+}
+
+func NewClockDecorator(rateLimiter RateLimiter, clock Clock) *ClockDecorator {
+	return &ClockDecorator{rateLimiter: rateLimiter, clock: clock}
+}
+
+func (c *ClockDecorator) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	adjusted, err := c.clock.Adjust(ctx, timestamp)
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+	response, err := c.rateLimiter.IsAllowed(ctx, key, adjusted)
+	return toLocalClock(response, adjusted.Sub(timestamp)), err
+}
+
+func toLocalClock(response RateLimitResponse, offset time.Duration) RateLimitResponse {
+	if !response.ResetTime.IsZero() {
+		response.ResetTime = response.ResetTime.Add(-offset)
+	}
+	return response
+}
+
+func (c *ClockDecorator) AllowN(ctx context.Context, key string, n int64, timestamp time.Time) (int64, RateLimitResponse, error) {
+	batcher, ok := c.rateLimiter.(BatchRateLimiter)
+	if !ok {
+		return 0, RateLimitResponse{Err: ErrBatchNotSupported}, ErrBatchNotSupported
+	}
+	adjusted, err := c.clock.Adjust(ctx, timestamp)
+	if err != nil {
+		return 0, RateLimitResponse{Err: err}, err
+	}
+	granted, response, err := batcher.AllowN(ctx, key, n, adjusted)
+	return granted, toLocalClock(response, adjusted.Sub(timestamp)), err
+}
+
+func (c *ClockDecorator) SupportsBatch() bool {
+	return SupportsBatch(c.rateLimiter)
+}
+
+func (c *ClockDecorator) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	peeker, ok := c.rateLimiter.(Peeker)
+	if !ok {
+		return RateLimitResponse{Err: ErrPeekNotSupported}, ErrPeekNotSupported
+	}
+	adjusted, err := c.clock.Adjust(ctx, timestamp)
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+	response, err := peeker.Peek(ctx, key, adjusted)
+	return toLocalClock(response, adjusted.Sub(timestamp)), err
+}
+
+func (c *ClockDecorator) Reset(ctx context.Context, key string) error {
+	return c.rateLimiter.Reset(ctx, key)
+}
+
+func (c *ClockDecorator) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	resetter, ok := c.rateLimiter.(PrefixResetter)
+	if !ok {
+		return 0, ErrResetPrefixNotSupported
+	}
+	return resetter.ResetPrefix(ctx, prefix)
+}
+
+func (c *ClockDecorator) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	refunder, ok := c.rateLimiter.(Refunder)
+	if !ok {
+		return ErrRefundNotSupported
+	}
+	timestamp, err := c.clock.Adjust(ctx, timestamp)
+	if err != nil {
+		return err
+	}
+	return refunder.Refund(ctx, key, n, timestamp)
+}
+
+func (c *ClockDecorator) SupportsRefund() bool {
+	return SupportsRefund(c.rateLimiter)
+}
+
+func (c *ClockDecorator) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	debtor, ok := c.rateLimiter.(Debtor)
+	if !ok {
+		return ErrDebtNotSupported
+	}
+	timestamp, err := c.clock.Adjust(ctx, timestamp)
+	if err != nil {
+		return err
+	}
+	return debtor.AddDebt(ctx, key, n, timestamp)
+}
+
+func (c *ClockDecorator) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error) {
+	reserver, ok := c.rateLimiter.(Reserver)
+	if !ok {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: ErrReserveNotSupported}}, ErrReserveNotSupported
+	}
+	adjusted, err := c.clock.Adjust(ctx, timestamp)
+	if err != nil {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: err}}, err
+	}
+	reservation, err := reserver.ReserveN(ctx, key, n, adjusted, maxDelay)
+	reservation.RateLimitResponse = toLocalClock(reservation.RateLimitResponse, adjusted.Sub(timestamp))
+	return reservation, err
+}
+
+func (c *ClockDecorator) SupportsReserve() bool {
+	return SupportsReserve(c.rateLimiter)
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisClock_Adjust(t *testing.T) {
+	client, server := newScriptRedis(t)
+	server.SetTime(time.Now().Add(time.Hour))
+
+	now := time.Now()
+	adjusted, err := NewRedisClock(client).Adjust(context.Background(), now)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(time.Hour), adjusted, time.Second)
+}
+
+func TestHybridClock_ResyncsAfterInterval(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := context.Background()
+	server.SetTime(time.Now().Add(time.Hour))
+
+	clock := NewHybridClock(client, time.Hour, time.Second)
+	now := time.Now()
+	adjusted, err := clock.Adjust(ctx, now)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(time.Hour), adjusted, time.Second)
+
+	// Within the sync interval the measured offset keeps being used.
+	server.SetTime(time.Now().Add(-time.Hour))
+	adjusted, err = clock.Adjust(ctx, now)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(time.Hour), adjusted, time.Second)
+
+	clock.syncedAt = time.Time{}
+	adjusted, err = clock.Adjust(ctx, now)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(-time.Hour), adjusted, time.Second)
+	assert.InDelta(t, float64(-time.Hour), float64(clock.Offset()), float64(time.Second))
+}
+
+func TestHybridClock_KeepsOffsetWhenRedisFails(t *testing.T) {
+	client, server := newScriptRedis(t)
+	server.SetTime(time.Now().Add(time.Hour))
+
+	clock := NewHybridClock(client, time.Hour, time.Second)
+	_, err := clock.Adjust(context.Background(), time.Now())
+	require.NoError(t, err)
+
+	server.Close()
+	clock.syncedAt = time.Time{}
+	now := time.Now()
+	adjusted, err := clock.Adjust(context.Background(), now)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(time.Hour), adjusted, time.Second)
+}
+
+// offsetClock stands in for the offset a Redis or hybrid clock would measure
+// on an instance whose own clock is off.
+type offsetClock time.Duration
+
+func (o offsetClock) Adjust(_ context.Context, timestamp time.Time) (time.Time, error) {
+	return timestamp.Add(time.Duration(o)), nil
+}
+
+func TestClockDecorator_SharesStateAcrossSkewedInstances(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	limiter, err := NewTokenBucketRateLimiter(TokenBucketConfig{
+		KeyPrefix:           "test:clock",
+		BucketSize:          2,
+		RefillRatePerSecond: 1,
+	}, client)
+	require.NoError(t, err)
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+
+	inSync := NewClockDecorator(limiter, offsetClock(0))
+	for i := 0; i < 2; i++ {
+		response, err := inSync.IsAllowed(ctx, "alice", now)
+		require.NoError(t, err)
+		require.True(t, response.Allowed)
+	}
+
+	// Deciding by its own clock, an instance an hour ahead would find the
+	// bucket refilled.
+	ahead := NewClockDecorator(limiter, offsetClock(-time.Hour))
+	response, err := ahead.IsAllowed(ctx, "alice", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	require.NotNil(t, response.RetryAfter)
+	assert.Equal(t, time.Second, *response.RetryAfter)
+	assert.Equal(t, now.Add(time.Hour+time.Second), response.ResetTime, "reset time is on the caller's clock")
+
+	require.NoError(t, ahead.Refund(ctx, "alice", 1, now.Add(time.Hour)))
+	response, err = inSync.IsAllowed(ctx, "alice", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+}
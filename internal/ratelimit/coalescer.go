@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type CoalescerConfig struct {
+	// MaxDelay caps the latency added while waiting for a batch to fill.
+	MaxDelay time.Duration
+	// MaxBatch flushes a batch early once this many requests are waiting.
+	MaxBatch int
+}
+
+type coalescedResult struct {
+	response RateLimitResponse
+	err      error
+}
+
+type coalescedBatch struct {
+	waiters []chan coalescedResult
+	ctx     context.Context
+}
+
+// Coalescer merges requests for the same key that arrive within MaxDelay into
+// one AllowN call and hands each caller its share of the verdict. It takes
+// the name of the policy it wraps, so decisions it makes are still
+// attributed to that policy.
+type Coalescer struct {
+	rateLimiter BatchRateLimiter
+	policy      string
+	maxDelay    time.Duration
+	maxBatch    int
+
+	mu      sync.Mutex
+	pending map[string]*coalescedBatch
+}
+
+func NewCoalescer(rateLimiter BatchRateLimiter, config CoalescerConfig) (*Coalescer, error) {
+	if rateLimiter == nil || !SupportsBatch(rateLimiter) {
+		return nil, ErrBatchNotSupported
+	}
+	if config.MaxDelay <= 0 {
+		return nil, errors.New("coalescer max delay must be positive")
+	}
+
+	maxBatch := config.MaxBatch
+	if maxBatch <= 0 {
+		maxBatch = DefaultCoalescerMaxBatch
+	}
+
+	var policy string
+	if named, ok := rateLimiter.(interface{ Name() string }); ok {
+		policy = named.Name()
+	}
+
+	return &Coalescer{
+		rateLimiter: rateLimiter,
+		policy:      policy,
+		maxDelay:    config.MaxDelay,
+		maxBatch:    maxBatch,
+		pending:     make(map[string]*coalescedBatch),
+	}, nil
+}
+
+func (c *Coalescer) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	result := make(chan coalescedResult, 1)
+	batchKey := c.policy + "\x00" + namespacedKey(ctx, key)
+
+	c.mu.Lock()
+	batch, exists := c.pending[batchKey]
+	if !exists {
+		batch = &coalescedBatch{ctx: ctx}
+		c.pending[batchKey] = batch
+		time.AfterFunc(c.maxDelay, func() { c.flush(batchKey, key, batch) })
+	}
+	batch.waiters = append(batch.waiters, result)
+	full := len(batch.waiters) >= c.maxBatch
+	c.mu.Unlock()
+
+	if full {
+		c.flush(batchKey, key, batch)
+	}
+
+	select {
+	case r := <-result:
+		return r.response, r.err
+	case <-ctx.Done():
+		return RateLimitResponse{Err: ctx.Err()}, ctx.Err()
+	}
+}
+
+// Name is the name of the wrapped policy, empty when it isn't one.
+func (c *Coalescer) Name() string {
+	return c.policy
+}
+
+func (c *Coalescer) Reset(ctx context.Context, key string) error {
+	return c.rateLimiter.Reset(ctx, key)
+}
+
+func (c *Coalescer) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	refunder, ok := c.rateLimiter.(Refunder)
+	if !ok {
+		return ErrRefundNotSupported
+	}
+	return refunder.Refund(ctx, key, n, timestamp)
+}
+
+func (c *Coalescer) SupportsRefund() bool {
+	return SupportsRefund(c.rateLimiter)
+}
+
+func (c *Coalescer) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	peeker, ok := c.rateLimiter.(Peeker)
+	if !ok {
+		return RateLimitResponse{Err: ErrPeekNotSupported}, ErrPeekNotSupported
+	}
+	return peeker.Peek(ctx, key, timestamp)
+}
+
+// flush decides a batch once; whichever of the timer or a full batch gets
+// here first wins.
+func (c *Coalescer) flush(batchKey string, key string, batch *coalescedBatch) {
+	c.mu.Lock()
+	if c.pending[batchKey] != batch {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.pending, batchKey)
+	waiters := batch.waiters
+	c.mu.Unlock()
+
+	// The first caller's context carries the namespace for the whole batch;
+	// its deadline is not reused so one cancelled caller can't fail the rest.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = WithNamespace(ctx, NamespaceFromContext(batch.ctx))
+
+	n := int64(len(waiters))
+	granted, response, err := c.rateLimiter.AllowN(ctx, key, n, time.Now())
+
+	for i, waiter := range waiters {
+		if err != nil {
+			waiter <- coalescedResult{response: response, err: err}
+			continue
+		}
+
+		individual := response
+		individual.Metadata.SetInt("coalesced", n)
+
+		if int64(i) < granted {
+			individual.Allowed = true
+			individual.RetryAfter = nil
+			individual.Remaining = response.Remaining + granted - 1 - int64(i)
+		} else {
+			individual.Allowed = false
+			individual.Remaining = 0
+			if individual.RetryAfter == nil {
+				retryAfter := c.maxDelay
+				individual.RetryAfter = &retryAfter
+			}
+		}
+		waiter <- coalescedResult{response: individual}
+	}
+}
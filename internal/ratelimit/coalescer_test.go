@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockBatchRateLimiter struct {
+	MockRateLimiterForFactory
+}
+
+func (m *MockBatchRateLimiter) AllowN(ctx context.Context, key string, n int64, timestamp time.Time) (int64, RateLimitResponse, error) {
+	args := m.Called(ctx, key, n, timestamp)
+	return args.Get(0).(int64), args.Get(1).(RateLimitResponse), args.Error(2)
+}
+
+func runCoalesced(coalescer *Coalescer, count int) []RateLimitResponse {
+	responses := make([]RateLimitResponse, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], _ = coalescer.IsAllowed(context.Background(), "hot", time.Now())
+		}(i)
+	}
+	wg.Wait()
+	return responses
+}
+
+func TestCoalescer_SplitsGrantAcrossWaiters(t *testing.T) {
+	retryAfter := time.Second
+	mockLimiter := &MockBatchRateLimiter{}
+	mockLimiter.On("AllowN", mock.Anything, "hot", int64(3), mock.Anything).Return(
+		int64(2), RateLimitResponse{Allowed: false, Limit: 10, Remaining: 0, RetryAfter: &retryAfter}, nil).Once()
+
+	coalescer, err := NewCoalescer(mockLimiter, CoalescerConfig{MaxDelay: time.Second, MaxBatch: 3})
+	assert.NoError(t, err)
+
+	responses := runCoalesced(coalescer, 3)
+
+	allowed := 0
+	for _, response := range responses {
+		assert.Equal(t, int64(3), response.Metadata.Value("coalesced"))
+		if response.Allowed {
+			allowed++
+			assert.Nil(t, response.RetryAfter)
+		} else {
+			assert.Equal(t, &retryAfter, response.RetryAfter)
+		}
+	}
+	assert.Equal(t, 2, allowed)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestCoalescer_FlushesAfterMaxDelay(t *testing.T) {
+	mockLimiter := &MockBatchRateLimiter{}
+	mockLimiter.On("AllowN", mock.Anything, "hot", int64(1), mock.Anything).Return(
+		int64(1), RateLimitResponse{Allowed: true, Limit: 10, Remaining: 9}, nil).Once()
+
+	coalescer, err := NewCoalescer(mockLimiter, CoalescerConfig{MaxDelay: 2 * time.Millisecond})
+	assert.NoError(t, err)
+
+	responses := runCoalesced(coalescer, 1)
+
+	assert.True(t, responses[0].Allowed)
+	assert.Equal(t, int64(9), responses[0].Remaining)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestCoalescer_PropagatesErrors(t *testing.T) {
+	mockLimiter := &MockBatchRateLimiter{}
+	mockLimiter.On("AllowN", mock.Anything, "hot", int64(2), mock.Anything).Return(
+		int64(0), RateLimitResponse{}, errors.New("redis down")).Once()
+
+	coalescer, err := NewCoalescer(mockLimiter, CoalescerConfig{MaxDelay: time.Second, MaxBatch: 2})
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = coalescer.IsAllowed(context.Background(), "hot", time.Now())
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Error(t, errs[0])
+	assert.Error(t, errs[1])
+}
+
+func TestNewCoalescer_RequiresBatchSupport(t *testing.T) {
+	policy := NewPolicy("default", &MockRateLimiterForFactory{}, nil)
+
+	_, err := NewCoalescer(policy, CoalescerConfig{MaxDelay: time.Millisecond})
+
+	assert.ErrorIs(t, err, ErrBatchNotSupported)
+}
+
+func TestCoalescer_KeepsPolicyName(t *testing.T) {
+	mockLimiter := &MockBatchRateLimiter{}
+	mockLimiter.On("AllowN", mock.Anything, "hot", int64(1), mock.Anything).Return(
+		int64(1), RateLimitResponse{Allowed: true, Limit: 10, Remaining: 9}, nil).Once()
+
+	coalescer, err := NewCoalescer(NewPolicy("search", mockLimiter, nil), CoalescerConfig{MaxDelay: time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, "search", coalescer.Name(), "denial and audit records name the policy")
+
+	responses := runCoalesced(coalescer, 1)
+	assert.True(t, responses[0].Allowed)
+	mockLimiter.AssertExpectations(t)
+}
@@ -0,0 +1,200 @@
+// Package conformancetest is a contract test suite for ratelimit.RateLimiter
+// implementations. Every strategy and backend is expected to pass it, so that
+// callers can swap one for another and keep the same burst, throughput, reset
+// and Retry-After behavior. A strategy's tests run it with Run:
+//
+//	conformancetest.Run(t, conformancetest.Config{
+//		New: func(t *testing.T) ratelimit.RateLimiter {
+//			return newBucket(t, 5, time.Second)
+//		},
+//		Burst:  5,
+//		Window: time.Second,
+//	})
+package conformancetest
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// DefaultStart is when requests are made unless Config.Start says
+// otherwise. It is a whole hour, so windows of up to an hour start with it.
+var DefaultStart = time.Unix(1699999200, 0)
+
+type Config struct {
+	// New returns the limiter under test. Every subtest uses its own keys,
+	// so the limiters may share a backend.
+	New func(t *testing.T) ratelimit.RateLimiter
+	// Burst is how many requests a fresh key is allowed at once.
+	Burst int64
+	// Window is how long a drained key takes to earn Burst requests again,
+	// or 0 for limiters that don't recover within a test, such as quotas.
+	Window time.Duration
+	// Tolerance is the share of the steady-state throughput an approximate
+	// strategy may be off by, e.g. 0.1 for a sliding window counter.
+	Tolerance float64
+	// Start is the timestamp of the first request; DefaultStart when zero.
+	// Limiters that expire or reset keys by the wall clock, such as quotas,
+	// need a Start of time.Now().
+	Start time.Time
+}
+
+var keySequence atomic.Int64
+
+// Run checks the limiter built by cfg.New against the contract every strategy
+// follows, each aspect in its own subtest.
+func Run(t *testing.T, cfg Config) {
+	t.Helper()
+	require.NotNil(t, cfg.New, "Config.New is required")
+	require.Positive(t, cfg.Burst, "Config.Burst must be positive")
+	if cfg.Start.IsZero() {
+		cfg.Start = DefaultStart
+	}
+
+	t.Run("Burst", func(t *testing.T) { testBurst(t, cfg) })
+	t.Run("SteadyState", func(t *testing.T) { testSteadyState(t, cfg) })
+	t.Run("KeyIsolation", func(t *testing.T) { testKeyIsolation(t, cfg) })
+	t.Run("Reset", func(t *testing.T) { testReset(t, cfg) })
+	t.Run("RetryAfter", func(t *testing.T) { testRetryAfter(t, cfg) })
+}
+
+// newKey returns a key no other subtest uses.
+func newKey() string {
+	return fmt.Sprintf("conformance:%d:%d", time.Now().UnixNano(), keySequence.Add(1))
+}
+
+func decide(t *testing.T, rateLimiter ratelimit.RateLimiter, key string, timestamp time.Time) ratelimit.RateLimitResponse {
+	t.Helper()
+	response, err := rateLimiter.IsAllowed(context.Background(), key, timestamp)
+	require.NoError(t, err)
+	return response
+}
+
+// drain uses up key's burst at timestamp.
+func drain(t *testing.T, rateLimiter ratelimit.RateLimiter, key string, cfg Config, timestamp time.Time) {
+	t.Helper()
+	for i := int64(0); i < cfg.Burst; i++ {
+		require.True(t, decide(t, rateLimiter, key, timestamp).Allowed, "request %d of the burst", i+1)
+	}
+}
+
+// testBurst checks that a fresh key is allowed exactly Burst requests at
+// once, counting Remaining down, and that the next is denied with a
+// Retry-After.
+func testBurst(t *testing.T, cfg Config) {
+	rateLimiter := cfg.New(t)
+	key := newKey()
+
+	remaining := cfg.Burst
+	for i := int64(0); i < cfg.Burst; i++ {
+		response := decide(t, rateLimiter, key, cfg.Start)
+		require.True(t, response.Allowed, "request %d of the burst", i+1)
+		assert.Less(t, response.Remaining, remaining, "request %d lowers Remaining", i+1)
+		assert.GreaterOrEqual(t, response.Remaining, int64(0))
+		remaining = response.Remaining
+	}
+	assert.Zero(t, remaining, "the burst leaves nothing")
+
+	response := decide(t, rateLimiter, key, cfg.Start)
+	assert.False(t, response.Allowed, "the request after the burst is denied")
+	assert.Zero(t, response.Remaining)
+	if assert.NotNil(t, response.RetryAfter, "denials say when to retry") {
+		assert.Positive(t, *response.RetryAfter)
+	}
+}
+
+// testSteadyState sends twice the limit for five windows and checks that,
+// once the initial burst is spent, the key is allowed Burst requests per
+// Window.
+func testSteadyState(t *testing.T, cfg Config) {
+	if cfg.Window <= 0 {
+		t.Skip("the limiter doesn't recover within a test")
+	}
+	rateLimiter := cfg.New(t)
+	key := newKey()
+
+	const windows = 4
+	interval := cfg.Window / time.Duration(2*cfg.Burst)
+	measureFrom := cfg.Start.Add(cfg.Window)
+	end := measureFrom.Add(windows * cfg.Window)
+
+	allowed := int64(0)
+	for timestamp := cfg.Start; timestamp.Before(end); timestamp = timestamp.Add(interval) {
+		if decide(t, rateLimiter, key, timestamp).Allowed && !timestamp.Before(measureFrom) {
+			allowed++
+		}
+	}
+
+	want := windows * cfg.Burst
+	assert.InDelta(t, want, allowed, 1+cfg.Tolerance*float64(want),
+		"%d requests allowed in %d windows of %s, want %d", allowed, windows, cfg.Window, want)
+}
+
+// testKeyIsolation checks that keys don't share capacity.
+func testKeyIsolation(t *testing.T, cfg Config) {
+	rateLimiter := cfg.New(t)
+	drained, fresh := newKey(), newKey()
+
+	drain(t, rateLimiter, drained, cfg, cfg.Start)
+	require.False(t, decide(t, rateLimiter, drained, cfg.Start).Allowed)
+
+	response := decide(t, rateLimiter, fresh, cfg.Start)
+	assert.True(t, response.Allowed, "another key keeps its burst")
+	assert.Equal(t, cfg.Burst-1, response.Remaining)
+}
+
+// testReset checks that Reset restores the full burst of a key and only that
+// key, and that resetting an unknown key is not an error.
+func testReset(t *testing.T, cfg Config) {
+	rateLimiter := cfg.New(t)
+	ctx := context.Background()
+	reset, untouched := newKey(), newKey()
+
+	drain(t, rateLimiter, reset, cfg, cfg.Start)
+	drain(t, rateLimiter, untouched, cfg, cfg.Start)
+	require.NoError(t, rateLimiter.Reset(ctx, reset))
+
+	drain(t, rateLimiter, reset, cfg, cfg.Start)
+	assert.False(t, decide(t, rateLimiter, reset, cfg.Start).Allowed, "a reset key gets one burst, not more")
+	assert.False(t, decide(t, rateLimiter, untouched, cfg.Start).Allowed, "other keys stay drained")
+
+	assert.NoError(t, rateLimiter.Reset(ctx, newKey()), "resetting an unknown key")
+}
+
+// retrySlack is how late after Retry-After runs out a request may be made and
+// still count as honoring it, since strategies round window boundaries
+// differently; clients see whole seconds anyway.
+const retrySlack = time.Millisecond
+
+// testRetryAfter checks that Retry-After shrinks as time passes while the key
+// stays denied, and that a request made when it runs out is allowed.
+func testRetryAfter(t *testing.T, cfg Config) {
+	rateLimiter := cfg.New(t)
+	key := newKey()
+
+	drain(t, rateLimiter, key, cfg, cfg.Start)
+	response := decide(t, rateLimiter, key, cfg.Start)
+	require.False(t, response.Allowed)
+	require.NotNil(t, response.RetryAfter)
+	retryAt := cfg.Start.Add(*response.RetryAfter)
+
+	retryAfter := *response.RetryAfter
+	for i := 1; i < 4; i++ {
+		timestamp := cfg.Start.Add(time.Duration(i) * retryAt.Sub(cfg.Start) / 4)
+		response = decide(t, rateLimiter, key, timestamp)
+		require.False(t, response.Allowed, "denied %s before Retry-After runs out", retryAt.Sub(timestamp))
+		require.NotNil(t, response.RetryAfter)
+		assert.LessOrEqual(t, *response.RetryAfter, retryAfter, "Retry-After shrinks as time passes")
+		retryAfter = *response.RetryAfter
+		retryAt = timestamp.Add(retryAfter)
+	}
+
+	assert.True(t, decide(t, rateLimiter, key, retryAt.Add(retrySlack)).Allowed, "allowed once Retry-After runs out")
+}
@@ -0,0 +1,109 @@
+package conformancetest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit/conformancetest"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestTokenBucket(t *testing.T) {
+	conformancetest.Run(t, conformancetest.Config{
+		New: func(t *testing.T) ratelimit.RateLimiter {
+			rateLimiter, err := ratelimit.NewTokenBucketRateLimiter(ratelimit.TokenBucketConfig{
+				BucketSize: 5, RefillRatePerSecond: 5, KeyPrefix: "tb",
+			}, newRedis(t))
+			require.NoError(t, err)
+			return rateLimiter
+		},
+		Burst:  5,
+		Window: time.Second,
+	})
+}
+
+func TestSlidingWindowLog(t *testing.T) {
+	conformancetest.Run(t, conformancetest.Config{
+		New: func(t *testing.T) ratelimit.RateLimiter {
+			rateLimiter, err := ratelimit.NewSlidingWindowLogRateLimiter(ratelimit.SlidingWindowLogConfig{
+				WindowSize: 10 * time.Second, BucketSize: 5, KeyPrefix: "swl",
+			}, newRedis(t))
+			require.NoError(t, err)
+			return rateLimiter
+		},
+		Burst:  5,
+		Window: 10 * time.Second,
+	})
+}
+
+func TestSlidingWindowCounter(t *testing.T) {
+	conformancetest.Run(t, conformancetest.Config{
+		New: func(t *testing.T) ratelimit.RateLimiter {
+			rateLimiter, err := ratelimit.NewSlidingWindowCounterRateLimiter(ratelimit.SlidingWindowCounterConfig{
+				WindowSize: 10 * time.Second, BucketSize: 10, KeyPrefix: "swc",
+			}, newRedis(t))
+			require.NoError(t, err)
+			return rateLimiter
+		},
+		Burst:     10,
+		Window:    10 * time.Second,
+		Tolerance: 0.1,
+	})
+}
+
+func TestSlidingWindowCounter_SubWindows(t *testing.T) {
+	conformancetest.Run(t, conformancetest.Config{
+		New: func(t *testing.T) ratelimit.RateLimiter {
+			rateLimiter, err := ratelimit.NewSlidingWindowCounterRateLimiter(ratelimit.SlidingWindowCounterConfig{
+				WindowSize: 10 * time.Second, BucketSize: 10, KeyPrefix: "swcb", SubWindows: 10,
+			}, newRedis(t))
+			require.NoError(t, err)
+			return rateLimiter
+		},
+		Burst:     10,
+		Window:    10 * time.Second,
+		Tolerance: 0.1,
+	})
+}
+
+func TestMultiWindow(t *testing.T) {
+	conformancetest.Run(t, conformancetest.Config{
+		New: func(t *testing.T) ratelimit.RateLimiter {
+			rateLimiter, err := ratelimit.NewMultiWindowRateLimiter(ratelimit.MultiWindowConfig{
+				WindowSize: 10 * time.Second, BucketSize: 10,
+				BurstWindowSize: time.Second, BurstLimit: 10,
+				KeyPrefix: "mw",
+			}, newRedis(t))
+			require.NoError(t, err)
+			return rateLimiter
+		},
+		Burst:     10,
+		Window:    10 * time.Second,
+		Tolerance: 0.1,
+	})
+}
+
+func TestQuota(t *testing.T) {
+	conformancetest.Run(t, conformancetest.Config{
+		New: func(t *testing.T) ratelimit.RateLimiter {
+			rateLimiter, err := ratelimit.NewQuotaRateLimiter(ratelimit.QuotaConfig{
+				Period: ratelimit.QuotaPeriodDaily, Limit: 5, KeyPrefix: "quota",
+			}, newRedis(t))
+			require.NoError(t, err)
+			return rateLimiter
+		},
+		Burst: 5,
+		Start: time.Now(),
+	})
+}
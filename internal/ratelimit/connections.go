@@ -0,0 +1,238 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ConnectionLimiterConfig limits long-lived connections such as WebSockets:
+// how many each key may hold open across all instances, and how many messages
+// each connection may send, as a token bucket kept in memory. A zero
+// MessageBucketSize leaves messages unlimited.
+type ConnectionLimiterConfig struct {
+	KeyPrefix            string
+	MaxConnections       int64
+	LeaseTTL             time.Duration
+	MessageBucketSize    int64
+	MessageRatePerSecond float64
+}
+
+func (c ConnectionLimiterConfig) Validate() error {
+	if c.MaxConnections <= 0 {
+		return errors.New("max connections must be positive")
+	}
+	if c.MessageBucketSize < 0 || (c.MessageBucketSize > 0 && c.MessageRatePerSecond <= 0) {
+		return errors.New("invalid message bucket configuration")
+	}
+	return nil
+}
+
+// ConnectionLimiter hands out connection slots counted in Redis. A slot is a
+// lease the holding instance refreshes while the connection is open, so slots
+// of an instance that dies are freed once their lease runs out.
+type ConnectionLimiter struct {
+	config      ConnectionLimiterConfig
+	redisClient *redis.Client
+	leaseTTL    time.Duration
+}
+
+func NewConnectionLimiter(config ConnectionLimiterConfig, redisClient *redis.Client) (*ConnectionLimiter, error) {
+	if redisClient == nil {
+		return nil, errors.New("invalid configuration")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	leaseTTL := config.LeaseTTL
+	if leaseTTL <= 0 {
+		leaseTTL = DefaultConnectionLeaseTTL
+	}
+
+	return &ConnectionLimiter{
+		config:      config,
+		redisClient: redisClient,
+		leaseTTL:    leaseTTL,
+	}, nil
+}
+
+func (l *ConnectionLimiter) redisKey(ctx context.Context, key string) string {
+	return fmt.Sprintf("%s:%s", l.config.KeyPrefix, namespacedKey(ctx, key))
+}
+
+// Acquire opens a connection for key if it holds fewer than the maximum. The
+// response reports the open connections against the limit either way; when
+// it is not allowed the returned connection is nil. An acquired connection
+// must be released.
+func (l *ConnectionLimiter) Acquire(ctx context.Context, key string, timestamp time.Time) (*Connection, RateLimitResponse, error) {
+	id, err := connectionID()
+	if err != nil {
+		return nil, RateLimitResponse{Err: err}, err
+	}
+
+	redisKey := l.redisKey(ctx, key)
+	result, err := connectionAcquireScript.Run(ctx, l.redisClient, []string{redisKey, ThrottleKey},
+		l.config.MaxConnections, timestamp.UnixMilli(), l.leaseTTL.Milliseconds(), id).Result()
+	if err != nil {
+		return nil, RateLimitResponse{Err: err}, err
+	}
+
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) != 3 {
+		err = errors.New("invalid redis response from connection script")
+		return nil, RateLimitResponse{Err: err}, err
+	}
+	values := make([]int64, len(resultArray))
+	for i := range resultArray {
+		values[i], err = getInt64FromResult(resultArray[i])
+		if err != nil {
+			err = fmt.Errorf("failed to parse connection script result %d: %w", i, err)
+			return nil, RateLimitResponse{Err: err}, err
+		}
+	}
+	allowed, open, limit := values[0], values[1], values[2]
+
+	response := RateLimitResponse{
+		Allowed:   allowed == 1,
+		Limit:     limit,
+		Remaining: max(0, limit-open),
+	}
+	response.Metadata.SetInt("open_connections", open)
+	response.Metadata.SetInt("max_connections", limit)
+	if allowed != 1 {
+		return nil, response, nil
+	}
+
+	connection := &Connection{
+		ID:       id,
+		limiter:  l,
+		redisKey: redisKey,
+		done:     make(chan struct{}),
+	}
+	if l.config.MessageBucketSize > 0 {
+		connection.messages = &messageBucket{
+			size:       float64(l.config.MessageBucketSize),
+			refillRate: l.config.MessageRatePerSecond,
+			tokens:     float64(l.config.MessageBucketSize),
+			lastRefill: timestamp,
+		}
+	}
+	go connection.keepAlive()
+	return connection, response, nil
+}
+
+// Count returns how many connections key holds open.
+func (l *ConnectionLimiter) Count(ctx context.Context, key string, timestamp time.Time) (int64, error) {
+	return l.redisClient.ZCount(ctx, l.redisKey(ctx, key), fmt.Sprintf("(%d", timestamp.UnixMilli()), "+inf").Result()
+}
+
+func connectionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate connection id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Connection is a slot held for one open connection. Its message bucket is
+// local to the connection, so checking a message costs no Redis call.
+type Connection struct {
+	ID string
+
+	limiter  *ConnectionLimiter
+	redisKey string
+	messages *messageBucket
+
+	releaseOnce sync.Once
+	done        chan struct{}
+}
+
+// AllowMessage reports whether the connection may send one more message now.
+func (c *Connection) AllowMessage(timestamp time.Time) RateLimitResponse {
+	if c.messages == nil {
+		return RateLimitResponse{Allowed: true}
+	}
+	return c.messages.take(timestamp)
+}
+
+// keepAlive refreshes the lease until the connection is released.
+func (c *Connection) keepAlive() {
+	ticker := time.NewTicker(c.limiter.leaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		expiresAt := time.Now().Add(c.limiter.leaseTTL).UnixMilli()
+		pipe := c.limiter.redisClient.TxPipeline()
+		pipe.ZAddXX(ctx, c.redisKey, redis.Z{Score: float64(expiresAt), Member: c.ID})
+		pipe.PExpire(ctx, c.redisKey, c.limiter.leaseTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			slog.Warn("failed to refresh connection lease", "connection", c.ID, "error", err)
+		}
+		cancel()
+	}
+}
+
+// Release frees the slot. Calling it more than once is harmless.
+func (c *Connection) Release(ctx context.Context) error {
+	var err error
+	c.releaseOnce.Do(func() {
+		close(c.done)
+		err = c.limiter.redisClient.ZRem(ctx, c.redisKey, c.ID).Err()
+	})
+	return err
+}
+
+// messageBucket is a token bucket for the messages of one connection.
+type messageBucket struct {
+	mu         sync.Mutex
+	size       float64
+	refillRate float64
+	tokens     float64
+	lastRefill time.Time
+}
+
+func (b *messageBucket) take(timestamp time.Time) RateLimitResponse {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := timestamp.Sub(b.lastRefill).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.size, b.tokens+elapsed*b.refillRate)
+		b.lastRefill = timestamp
+	}
+
+	limit := int64(b.size)
+	if b.tokens < 1 {
+		retryAfter := time.Duration((1 - b.tokens) / b.refillRate * NanosecondsPerSecond)
+		return RateLimitResponse{
+			Allowed:    false,
+			Limit:      limit,
+			Remaining:  0,
+			ResetTime:  timestamp.Add(retryAfter),
+			RetryAfter: &retryAfter,
+		}
+	}
+
+	b.tokens--
+	return RateLimitResponse{
+		Allowed:   true,
+		Limit:     limit,
+		Remaining: int64(b.tokens),
+		ResetTime: timestamp.Add(time.Duration((b.size - b.tokens) / b.refillRate * NanosecondsPerSecond)),
+	}
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConnectionLimiter(t *testing.T, config ConnectionLimiterConfig) *ConnectionLimiter {
+	t.Helper()
+	client, _ := newScriptRedis(t)
+	config.KeyPrefix = "test:conn"
+	limiter, err := NewConnectionLimiter(config, client)
+	require.NoError(t, err)
+	return limiter
+}
+
+func TestConnectionLimiter_LimitsOpenConnections(t *testing.T) {
+	limiter := newTestConnectionLimiter(t, ConnectionLimiterConfig{MaxConnections: 2})
+	ctx := context.Background()
+	now := time.Now()
+
+	first, response, err := limiter.Acquire(ctx, "alice", now)
+	require.NoError(t, err)
+	require.NotNil(t, first)
+	assert.Equal(t, int64(1), response.Remaining)
+
+	second, _, err := limiter.Acquire(ctx, "alice", now)
+	require.NoError(t, err)
+	require.NotNil(t, second)
+	defer second.Release(ctx)
+
+	third, response, err := limiter.Acquire(ctx, "alice", now)
+	require.NoError(t, err)
+	assert.Nil(t, third)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, int64(2), response.Metadata.Value("open_connections"))
+
+	other, _, err := limiter.Acquire(WithNamespace(ctx, "tenant"), "alice", now)
+	require.NoError(t, err)
+	require.NotNil(t, other, "namespaces count connections separately")
+	defer other.Release(ctx)
+
+	require.NoError(t, first.Release(ctx))
+	require.NoError(t, first.Release(ctx))
+	count, err := limiter.Count(ctx, "alice", now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	third, _, err = limiter.Acquire(ctx, "alice", now)
+	require.NoError(t, err)
+	require.NotNil(t, third)
+	defer third.Release(ctx)
+}
+
+func TestConnectionLimiter_ExpiredLeasesFreeSlots(t *testing.T) {
+	limiter := newTestConnectionLimiter(t, ConnectionLimiterConfig{MaxConnections: 1, LeaseTTL: time.Minute})
+	ctx := context.Background()
+	now := time.Now()
+
+	// A connection whose instance died is never released or refreshed.
+	abandoned, _, err := limiter.Acquire(ctx, "alice", now)
+	require.NoError(t, err)
+	require.NotNil(t, abandoned)
+	close(abandoned.done)
+
+	connection, _, err := limiter.Acquire(ctx, "alice", now.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.Nil(t, connection)
+
+	connection, _, err = limiter.Acquire(ctx, "alice", now.Add(time.Minute+time.Millisecond))
+	require.NoError(t, err)
+	require.NotNil(t, connection)
+	defer connection.Release(ctx)
+}
+
+func TestConnection_AllowMessage(t *testing.T) {
+	limiter := newTestConnectionLimiter(t, ConnectionLimiterConfig{
+		MaxConnections:       1,
+		MessageBucketSize:    2,
+		MessageRatePerSecond: 1,
+	})
+	ctx := context.Background()
+	now := time.Now()
+
+	connection, _, err := limiter.Acquire(ctx, "alice", now)
+	require.NoError(t, err)
+	require.NotNil(t, connection)
+	defer connection.Release(ctx)
+
+	assert.True(t, connection.AllowMessage(now).Allowed)
+	assert.True(t, connection.AllowMessage(now).Allowed)
+	response := connection.AllowMessage(now)
+	assert.False(t, response.Allowed)
+	require.NotNil(t, response.RetryAfter)
+	assert.Equal(t, time.Second, *response.RetryAfter)
+
+	assert.True(t, connection.AllowMessage(now.Add(time.Second)).Allowed)
+}
+
+func TestConnectionLimiterConfig_Validate(t *testing.T) {
+	assert.Error(t, ConnectionLimiterConfig{}.Validate())
+	assert.Error(t, ConnectionLimiterConfig{MaxConnections: 1, MessageBucketSize: 5}.Validate())
+	assert.NoError(t, ConnectionLimiterConfig{MaxConnections: 1}.Validate())
+}
@@ -1,5 +1,7 @@
 package ratelimit
 
+import "time"
+
 const (
 	// DefaultTTLBufferSeconds is the default buffer time in seconds added to TTL
 	// to protect against clock drift and network latency
@@ -11,4 +13,127 @@ const (
 
 	// NanosecondsPerSecond is the conversion factor from nanoseconds to seconds
 	NanosecondsPerSecond = 1e9
+
+	// SchemaVersion is the version of the format the scripts write strategy
+	// state in; see scripts/lib/schema.lua. Bump it with any change to the
+	// format, which the previous version's scripts must still be able to read
+	SchemaVersion = 3
+
+	// DefaultActiveKeysScanInterval is how often the active keys gauge is
+	// refreshed when no interval is configured
+	DefaultActiveKeysScanInterval = 30 * time.Second
+
+	// DefaultActiveKeysScanCount is the COUNT hint passed to each SCAN call
+	DefaultActiveKeysScanCount = 1000
+
+	// DefaultKeyMigrationKeysPerSecond is how fast a key migration renames
+	// keys when no rate is configured
+	DefaultKeyMigrationKeysPerSecond = 1000
+
+	// MaxKeyMigrationJobs is the number of key migrations whose state is kept
+	// for lookup
+	MaxKeyMigrationJobs = 100
+
+	// DefaultTokenLeaseTTL is how long leased tokens may be served from memory
+	// before unused ones are discarded
+	DefaultTokenLeaseTTL = time.Second
+
+	// MaxTokenLeases is the number of local leases kept before expired ones
+	// are swept
+	MaxTokenLeases = 10000
+
+	// MaxQuarantineKeys is the number of local windows a quarantined
+	// namespace keeps at most; beyond it ended ones are swept, then the
+	// oldest
+	MaxQuarantineKeys = 10000
+
+	// DefaultLatencyBudgetMaxPending is the number of checks over the latency
+	// budget that may finish in the background at once
+	DefaultLatencyBudgetMaxPending = 1000
+
+	// DefaultAsyncBatchSize is the number of requests async accounting
+	// records per flush when no batch size is configured
+	DefaultAsyncBatchSize = 500
+
+	// DefaultAsyncFlushInterval is how long requests wait to be recorded by
+	// async accounting when no interval is configured
+	DefaultAsyncFlushInterval = 100 * time.Millisecond
+
+	// DefaultAsyncBufferSize is the number of requests waiting to be recorded
+	// by async accounting when no buffer size is configured
+	DefaultAsyncBufferSize = 10000
+
+	// DefaultDenialLogQueueSize is the number of denials waiting to be
+	// written to the denial log before further ones are dropped
+	DefaultDenialLogQueueSize = 1000
+
+	// DenialLogDropReportInterval is how often dropped denials are logged
+	DenialLogDropReportInterval = 10 * time.Second
+
+	// DefaultAuditLogQueueSize is the number of audit records waiting to be
+	// written before further ones are dropped
+	DefaultAuditLogQueueSize = 1000
+
+	// AuditLogDropReportInterval is how often dropped audit records are
+	// logged
+	AuditLogDropReportInterval = 10 * time.Second
+
+	// DefaultCoalescerMaxBatch is the number of waiting requests that flushes
+	// a coalesced batch before its delay expires
+	DefaultCoalescerMaxBatch = 100
+
+	// MaxSandboxKeys bounds the sandbox's in-memory positions; the map is
+	// cleared when a new key would exceed it
+	MaxSandboxKeys = 10000
+
+	// MaxSandboxSequenceLength bounds a sandbox allow/deny cycle
+	MaxSandboxSequenceLength = 1000
+
+	// MaxDebt bounds the extra requests one penalty may charge a key
+	MaxDebt = 1000000
+
+	// DefaultPenaltyCacheTTL is how long a policy reuses a key's block
+	// state before checking Redis again
+	DefaultPenaltyCacheTTL = time.Second
+
+	// MaxPenaltyCacheKeys bounds the cached block states; the cache is
+	// cleared when a new key would exceed it after expired ones are swept
+	MaxPenaltyCacheKeys = 10000
+
+	// MaxSoftLimitNotices bounds the keys a policy remembers sending a soft
+	// limit event for; they are forgotten when a new key would exceed it
+	// after ended windows are swept
+	MaxSoftLimitNotices = 10000
+
+	// MaxSubWindows bounds the sliding window counter's buckets, all of
+	// which are read on every request
+	MaxSubWindows = 1000
+
+	// GlobalBucketKey is the key suffix of the service-wide token bucket
+	GlobalBucketKey = "__global__"
+
+	// ReservedKeyPrefix starts the key suffixes of shared buckets. Client
+	// keys starting with it are stored with another "_" in front, so no
+	// client can name a shared bucket
+	ReservedKeyPrefix = "__"
+
+	// OrganizationBucketKeyPrefix prefixes the organization buckets of the
+	// hierarchical strategy. Like GlobalBucketKey, it starts with
+	// ReservedKeyPrefix
+	OrganizationBucketKeyPrefix = "__org__:"
+
+	// DefaultConnectionLeaseTTL is how long a connection slot outlives the
+	// last refresh from the instance holding it
+	DefaultConnectionLeaseTTL = time.Minute
+
+	// DefaultLeaderLeaseTTL is how long a leader keeps its lease without
+	// extending it
+	DefaultLeaderLeaseTTL = 15 * time.Second
+
+	// DefaultKeyLimiterTimeout bounds the limiter calls of KeyLimiter's Allow
+	// and Reserve, which take no context
+	DefaultKeyLimiterTimeout = time.Second
+
+	// DefaultPolicyName is the name of the policy wrapping the configured strategy
+	DefaultPolicyName = "default"
 )
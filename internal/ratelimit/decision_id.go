@@ -0,0 +1,19 @@
+package ratelimit
+
+import "context"
+
+type decisionIDContextKey struct{}
+
+// WithDecisionID tags the decisions made with ctx with id, so the events they
+// emit can be matched with the response, logs and audit log of the request.
+func WithDecisionID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, decisionIDContextKey{}, id)
+}
+
+func DecisionIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(decisionIDContextKey{}).(string)
+	return id
+}
@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type DenialLogConfig struct {
+	StreamKey  string
+	MaxEntries int64
+	Retention  time.Duration
+}
+
+type DenialRecord struct {
+	ID         string    `json:"id,omitempty"`
+	DecisionID string    `json:"decision_id,omitempty"`
+	KeyHash    string    `json:"key_hash"`
+	Route      string    `json:"route"`
+	Method     string    `json:"method"`
+	Policy     string    `json:"policy"`
+	UserAgent  string    `json:"user_agent"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// DenialLog keeps summaries of denied requests in a capped Redis stream for
+// post-incident review. Keys are stored hashed, never in the clear.
+// Enqueued records are written by a single worker; when it can't keep up,
+// for instance during an attack, further records are dropped rather than
+// piling up.
+type DenialLog struct {
+	redisClient *redis.Client
+	streamKey   string
+	maxEntries  int64
+	retention   time.Duration
+	queue       chan DenialRecord
+	dropped     atomic.Int64
+}
+
+func NewDenialLog(config DenialLogConfig, redisClient *redis.Client) (*DenialLog, error) {
+	if config.StreamKey == "" || config.MaxEntries <= 0 || redisClient == nil {
+		return nil, fmt.Errorf("invalid denial log configuration")
+	}
+
+	return &DenialLog{
+		redisClient: redisClient,
+		streamKey:   config.StreamKey,
+		maxEntries:  config.MaxEntries,
+		retention:   config.Retention,
+		queue:       make(chan DenialRecord, DefaultDenialLogQueueSize),
+	}, nil
+}
+
+// Start writes enqueued records until ctx is cancelled.
+func (d *DenialLog) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(DenialLogDropReportInterval)
+		defer ticker.Stop()
+
+		var reportedDrops int64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case record := <-d.queue:
+				recordCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+				if err := d.Record(recordCtx, record); err != nil {
+					slog.Error("failed to record denial", "decision_id", record.DecisionID, "error", err.Error())
+				}
+				cancel()
+			case <-ticker.C:
+				if dropped := d.Dropped(); dropped > reportedDrops {
+					slog.Warn("denial log queue full, denials went unrecorded", "dropped", dropped-reportedDrops)
+					reportedDrops = dropped
+				}
+			}
+		}
+	}()
+}
+
+// Enqueue queues record to be written by the worker, dropping it when the
+// queue is full.
+func (d *DenialLog) Enqueue(record DenialRecord) {
+	select {
+	case d.queue <- record:
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+// Dropped reports how many records were dropped because the queue was full.
+func (d *DenialLog) Dropped() int64 {
+	return d.dropped.Load()
+}
+
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (d *DenialLog) Record(ctx context.Context, record DenialRecord) error {
+	pipe := d.redisClient.Pipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: d.streamKey,
+		MaxLen: d.maxEntries,
+		Approx: true,
+		ID:     "*",
+		Values: map[string]interface{}{
+			"decision_id": record.DecisionID,
+			"key_hash":    record.KeyHash,
+			"route":       record.Route,
+			"method":      record.Method,
+			"policy":      record.Policy,
+			"user_agent":  record.UserAgent,
+			"timestamp":   record.Timestamp.UnixMilli(),
+		},
+	})
+	if d.retention > 0 {
+		cutoff := record.Timestamp.Add(-d.retention).UnixMilli()
+		pipe.XTrimMinIDApprox(ctx, d.streamKey, strconv.FormatInt(cutoff, 10), 0)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Export returns up to limit records logged between since and until, oldest first.
+func (d *DenialLog) Export(ctx context.Context, since, until time.Time, limit int64) ([]DenialRecord, error) {
+	start := "-"
+	if !since.IsZero() {
+		start = strconv.FormatInt(since.UnixMilli(), 10)
+	}
+	end := "+"
+	if !until.IsZero() {
+		end = strconv.FormatInt(until.UnixMilli(), 10)
+	}
+
+	messages, err := d.redisClient.XRangeN(ctx, d.streamKey, start, end, limit).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]DenialRecord, 0, len(messages))
+	for _, message := range messages {
+		records = append(records, denialRecordFromMessage(message))
+	}
+	return records, nil
+}
+
+func denialRecordFromMessage(message redis.XMessage) DenialRecord {
+	record := DenialRecord{ID: message.ID}
+	record.DecisionID, _ = message.Values["decision_id"].(string)
+	record.KeyHash, _ = message.Values["key_hash"].(string)
+	record.Route, _ = message.Values["route"].(string)
+	record.Method, _ = message.Values["method"].(string)
+	record.Policy, _ = message.Values["policy"].(string)
+	record.UserAgent, _ = message.Values["user_agent"].(string)
+
+	if raw, ok := message.Values["timestamp"].(string); ok {
+		if millis, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			record.Timestamp = time.UnixMilli(millis).UTC()
+		}
+	}
+	return record
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDenialLog(t *testing.T) {
+	_, err := NewDenialLog(DenialLogConfig{StreamKey: "rl:denials", MaxEntries: 100}, &redis.Client{})
+	assert.NoError(t, err)
+
+	_, err = NewDenialLog(DenialLogConfig{StreamKey: "", MaxEntries: 100}, &redis.Client{})
+	assert.Error(t, err)
+
+	_, err = NewDenialLog(DenialLogConfig{StreamKey: "rl:denials", MaxEntries: 0}, &redis.Client{})
+	assert.Error(t, err)
+}
+
+func TestDenialLog_Enqueue(t *testing.T) {
+	client, server := newScriptRedis(t)
+	denialLog, err := NewDenialLog(DenialLogConfig{StreamKey: "rl:denials", MaxEntries: 10000}, client)
+	assert.NoError(t, err)
+
+	for i := 0; i <= DefaultDenialLogQueueSize; i++ {
+		denialLog.Enqueue(DenialRecord{KeyHash: HashKey("client"), Timestamp: time.Now()})
+	}
+	assert.Equal(t, int64(1), denialLog.Dropped(), "a full queue drops denials")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	denialLog.Start(ctx)
+	assert.Eventually(t, func() bool {
+		entries, err := server.Stream("rl:denials")
+		return err == nil && len(entries) == DefaultDenialLogQueueSize
+	}, 5*time.Second, 10*time.Millisecond, "one worker writes the queued denials")
+}
+
+func TestHashKey(t *testing.T) {
+	hash := HashKey("customer-42")
+
+	assert.Len(t, hash, 16)
+	assert.Equal(t, hash, HashKey("customer-42"))
+	assert.NotEqual(t, hash, HashKey("customer-43"))
+	assert.NotContains(t, hash, "customer")
+}
+
+func TestDenialRecordFromMessage(t *testing.T) {
+	record := denialRecordFromMessage(redis.XMessage{
+		ID: "1700000000000-0",
+		Values: map[string]interface{}{
+			"decision_id": "d-1",
+			"key_hash":    "abc",
+			"route":       "/api/restricted",
+			"method":      "GET",
+			"policy":      "default",
+			"user_agent":  "curl/8.0",
+			"timestamp":   "1700000000000",
+		},
+	})
+
+	assert.Equal(t, "1700000000000-0", record.ID)
+	assert.Equal(t, "d-1", record.DecisionID)
+	assert.Equal(t, "abc", record.KeyHash)
+	assert.Equal(t, "/api/restricted", record.Route)
+	assert.Equal(t, "GET", record.Method)
+	assert.Equal(t, "default", record.Policy)
+	assert.Equal(t, "curl/8.0", record.UserAgent)
+	assert.Equal(t, time.UnixMilli(1700000000000).UTC(), record.Timestamp)
+}
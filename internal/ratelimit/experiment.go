@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+)
+
+// ExperimentRateLimiter splits keys between two strategies, the control and
+// the experiment, so they can be compared on real traffic. Each key is
+// assigned an arm by a hash of it, so it keeps its arm, and its state, for as
+// long as the experiment runs. Every decision is counted per arm.
+type ExperimentRateLimiter struct {
+	control        RateLimiter
+	experiment     RateLimiter
+	controlName    string
+	experimentName string
+	share          float64
+	salt           string
+	collector      metrics.Collector
+}
+
+// NewExperimentRateLimiter sends share of the keys, from 0 to 1, to
+// experiment and the rest to control. Changing salt reassigns the keys.
+func NewExperimentRateLimiter(control RateLimiter, controlName string, experiment RateLimiter, experimentName string, share float64, salt string, collector metrics.Collector) *ExperimentRateLimiter {
+	return &ExperimentRateLimiter{
+		control:        control,
+		experiment:     experiment,
+		controlName:    controlName,
+		experimentName: experimentName,
+		share:          share,
+		salt:           salt,
+		collector:      collector,
+	}
+}
+
+// Arm returns the arm key is assigned to, metrics.ExperimentControl or
+// metrics.ExperimentTreatment.
+func (e *ExperimentRateLimiter) Arm(key string) string {
+	// FNV clusters keys differing in a suffix, e.g. numbered clients, so the
+	// share would be off.
+	sum := sha256.Sum256([]byte(e.salt + "\x00" + key))
+	if float64(binary.BigEndian.Uint64(sum[:8]))/math.MaxUint64 < e.share {
+		return metrics.ExperimentTreatment
+	}
+	return metrics.ExperimentControl
+}
+
+func (e *ExperimentRateLimiter) arm(key string) (string, string, RateLimiter) {
+	if arm := e.Arm(key); arm == metrics.ExperimentTreatment {
+		return arm, e.experimentName, e.experiment
+	}
+	return metrics.ExperimentControl, e.controlName, e.control
+}
+
+func (e *ExperimentRateLimiter) record(response *RateLimitResponse, arm, strategy string, err error) {
+	if err != nil {
+		return
+	}
+	e.collector.RecordExperimentDecision(arm, strategy, response.Allowed)
+	response.Metadata.Set("experiment_arm", arm)
+	response.Metadata.Set("experiment_strategy", strategy)
+}
+
+func (e *ExperimentRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	arm, strategy, rateLimiter := e.arm(key)
+	response, err := rateLimiter.IsAllowed(ctx, key, timestamp)
+	e.record(&response, arm, strategy, err)
+	return response, err
+}
+
+func (e *ExperimentRateLimiter) AllowN(ctx context.Context, key string, n int64, timestamp time.Time) (int64, RateLimitResponse, error) {
+	arm, strategy, rateLimiter := e.arm(key)
+	batcher, ok := rateLimiter.(BatchRateLimiter)
+	if !ok {
+		return 0, RateLimitResponse{Err: ErrBatchNotSupported}, ErrBatchNotSupported
+	}
+	allowed, response, err := batcher.AllowN(ctx, key, n, timestamp)
+	e.record(&response, arm, strategy, err)
+	return allowed, response, err
+}
+
+// SupportsBatch reports whether both arms can serve AllowN, so keys don't
+// lose batches by landing in the experiment.
+func (e *ExperimentRateLimiter) SupportsBatch() bool {
+	return SupportsBatch(e.control) && SupportsBatch(e.experiment)
+}
+
+func (e *ExperimentRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	_, _, rateLimiter := e.arm(key)
+	peeker, ok := rateLimiter.(Peeker)
+	if !ok {
+		return RateLimitResponse{Err: ErrPeekNotSupported}, ErrPeekNotSupported
+	}
+	return peeker.Peek(ctx, key, timestamp)
+}
+
+// Reset clears key in its arm.
+func (e *ExperimentRateLimiter) Reset(ctx context.Context, key string) error {
+	_, _, rateLimiter := e.arm(key)
+	return rateLimiter.Reset(ctx, key)
+}
+
+// ResetPrefix clears the prefix in both arms and reports the deletions of
+// both.
+func (e *ExperimentRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	resetter, ok := e.control.(PrefixResetter)
+	if !ok {
+		return 0, ErrResetPrefixNotSupported
+	}
+	deleted, err := resetter.ResetPrefix(ctx, prefix)
+	if experimentResetter, ok := e.experiment.(PrefixResetter); ok {
+		experimentDeleted, experimentErr := experimentResetter.ResetPrefix(ctx, prefix)
+		deleted += experimentDeleted
+		if experimentErr != nil {
+			err = errors.Join(err, fmt.Errorf("experiment strategy %s: %w", e.experimentName, experimentErr))
+		}
+	}
+	return deleted, err
+}
+
+func (e *ExperimentRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	_, _, rateLimiter := e.arm(key)
+	refunder, ok := rateLimiter.(Refunder)
+	if !ok {
+		return ErrRefundNotSupported
+	}
+	return refunder.Refund(ctx, key, n, timestamp)
+}
+
+func (e *ExperimentRateLimiter) SupportsRefund() bool {
+	return SupportsRefund(e.control) && SupportsRefund(e.experiment)
+}
+
+func (e *ExperimentRateLimiter) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	_, _, rateLimiter := e.arm(key)
+	debtor, ok := rateLimiter.(Debtor)
+	if !ok {
+		return ErrDebtNotSupported
+	}
+	return debtor.AddDebt(ctx, key, n, timestamp)
+}
+
+func (e *ExperimentRateLimiter) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error) {
+	arm, strategy, rateLimiter := e.arm(key)
+	reserver, ok := rateLimiter.(Reserver)
+	if !ok {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: ErrReserveNotSupported}}, ErrReserveNotSupported
+	}
+	reservation, err := reserver.ReserveN(ctx, key, n, timestamp, maxDelay)
+	e.record(&reservation.RateLimitResponse, arm, strategy, err)
+	return reservation, err
+}
+
+func (e *ExperimentRateLimiter) SupportsReserve() bool {
+	return SupportsReserve(e.control) && SupportsReserve(e.experiment)
+}
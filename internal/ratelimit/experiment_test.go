@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type experimentCollector struct {
+	metrics.NoopCollector
+	decisions []string
+}
+
+func (e *experimentCollector) RecordExperimentDecision(arm, strategy string, allowed bool) {
+	e.decisions = append(e.decisions, fmt.Sprintf("%s/%s/%t", arm, strategy, allowed))
+}
+
+func TestExperimentRateLimiter_Arm(t *testing.T) {
+	limiter := NewExperimentRateLimiter(nil, "token_bucket", nil, "sliding_window_counter", 0.3, "", metrics.NewNoopCollector())
+
+	treated := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("client-%d", i)
+		arm := limiter.Arm(key)
+		assert.Equal(t, arm, limiter.Arm(key), "a key keeps its arm")
+		if arm == metrics.ExperimentTreatment {
+			treated++
+		}
+	}
+	assert.InDelta(t, 3000, treated, 200, "share of the keys in the experiment")
+
+	none := NewExperimentRateLimiter(nil, "token_bucket", nil, "sliding_window_counter", 0, "", metrics.NewNoopCollector())
+	all := NewExperimentRateLimiter(nil, "token_bucket", nil, "sliding_window_counter", 1, "", metrics.NewNoopCollector())
+	assert.Equal(t, metrics.ExperimentControl, none.Arm("client"))
+	assert.Equal(t, metrics.ExperimentTreatment, all.Arm("client"))
+}
+
+func TestExperimentRateLimiter_Salt(t *testing.T) {
+	first := NewExperimentRateLimiter(nil, "token_bucket", nil, "sliding_window_counter", 0.5, "first", metrics.NewNoopCollector())
+	second := NewExperimentRateLimiter(nil, "token_bucket", nil, "sliding_window_counter", 0.5, "second", metrics.NewNoopCollector())
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("client-%d", i)
+		if first.Arm(key) != second.Arm(key) {
+			moved++
+		}
+	}
+	assert.InDelta(t, 500, moved, 100, "another salt reassigns about half the keys")
+}
+
+func TestExperimentRateLimiter_IsAllowed(t *testing.T) {
+	control := new(MockRateLimiterForFactory)
+	experiment := new(MockRateLimiterForFactory)
+	collector := &experimentCollector{}
+	limiter := NewExperimentRateLimiter(control, "token_bucket", experiment, "sliding_window_counter", 0.5, "", collector)
+
+	var controlKey, experimentKey string
+	for i := 0; controlKey == "" || experimentKey == ""; i++ {
+		key := fmt.Sprintf("client-%d", i)
+		if limiter.Arm(key) == metrics.ExperimentTreatment {
+			experimentKey = key
+		} else {
+			controlKey = key
+		}
+	}
+
+	control.On("IsAllowed", mock.Anything, controlKey, mock.Anything).Return(RateLimitResponse{Allowed: true}, nil)
+	experiment.On("IsAllowed", mock.Anything, experimentKey, mock.Anything).Return(RateLimitResponse{Allowed: false}, nil)
+
+	response, err := limiter.IsAllowed(context.Background(), controlKey, time.Now())
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, metrics.ExperimentControl, response.Metadata.Value("experiment_arm"))
+	assert.Equal(t, "token_bucket", response.Metadata.Value("experiment_strategy"))
+
+	response, err = limiter.IsAllowed(context.Background(), experimentKey, time.Now())
+	require.NoError(t, err)
+	assert.False(t, response.Allowed, "the experiment decides its keys")
+	assert.Equal(t, metrics.ExperimentTreatment, response.Metadata.Value("experiment_arm"))
+	assert.Equal(t, "sliding_window_counter", response.Metadata.Value("experiment_strategy"))
+
+	assert.Equal(t, []string{
+		"control/token_bucket/true",
+		"experiment/sliding_window_counter/false",
+	}, collector.decisions)
+	control.AssertExpectations(t)
+	experiment.AssertExpectations(t)
+}
+
+func TestExperimentRateLimiter_Error(t *testing.T) {
+	control := new(MockRateLimiterForFactory)
+	collector := &experimentCollector{}
+	limiter := NewExperimentRateLimiter(control, "token_bucket", nil, "sliding_window_counter", 0, "", collector)
+
+	control.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(RateLimitResponse{}, errors.New("redis down"))
+
+	_, err := limiter.IsAllowed(context.Background(), "client", time.Now())
+	assert.Error(t, err)
+	assert.Empty(t, collector.decisions, "errors aren't decisions")
+}
+
+func TestExperimentRateLimiter_Reset(t *testing.T) {
+	control := new(MockRateLimiterForFactory)
+	experiment := new(MockRateLimiterForFactory)
+	limiter := NewExperimentRateLimiter(control, "token_bucket", experiment, "sliding_window_counter", 1, "", metrics.NewNoopCollector())
+
+	experiment.On("Reset", mock.Anything, "client").Return(nil)
+
+	require.NoError(t, limiter.Reset(context.Background(), "client"))
+	experiment.AssertExpectations(t)
+	control.AssertNotCalled(t, "Reset", mock.Anything, mock.Anything)
+}
@@ -1,16 +1,38 @@
 package ratelimit
 
 import (
+	"context"
 	"fmt"
+	"time"
 
+	"github.com/pmujumdar27/go-rate-limiter/internal/events"
 	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
 	"github.com/redis/go-redis/v9"
 )
 
 type Factory struct {
 	redisClient      *redis.Client
+	readClient       *redis.Client
 	strategies       map[string]StrategyConstructor
 	metricsCollector metrics.Collector
+	collectors       *metrics.Registry
+	decisions        events.Emitter
+	topKeys          *TopKeys
+	keyStatsWindow   time.Duration
+	backgroundCtx    context.Context
+	clocks           map[string]Clock
+}
+
+// topKeysRecorder is implemented by strategies whose scripts can update the
+// top keys analytics.
+type topKeysRecorder interface {
+	setTopKeys(topKeys *TopKeys)
+}
+
+// backgroundWorker is implemented by strategies that do work outside of the
+// request that triggered it, which should stop with ctx.
+type backgroundWorker interface {
+	setBackgroundContext(ctx context.Context)
 }
 
 func NewFactory(redisClient *redis.Client) *Factory {
@@ -23,15 +45,40 @@ func NewFactory(redisClient *redis.Client) *Factory {
 	f.RegisterStrategy(&TokenBucketConstructor{})
 	f.RegisterStrategy(&SlidingWindowLogConstructor{})
 	f.RegisterStrategy(&SlidingWindowCounterConstructor{})
+	f.RegisterStrategy(&QuotaConstructor{})
+	f.RegisterStrategy(&HierarchicalConstructor{})
+	f.RegisterStrategy(&MultiWindowConstructor{})
+	f.registerCustomStrategies()
 
 	return f
 }
 
+// registerCustomStrategies adds the strategies registered with Register.
+func (f *Factory) registerCustomStrategies() {
+	for _, constructor := range registeredConstructors() {
+		f.RegisterStrategy(constructor)
+	}
+}
+
 func (f *Factory) RegisterStrategy(constructor StrategyConstructor) {
 	f.strategies[constructor.Name()] = constructor
 }
 
 func (f *Factory) CreateRateLimiter(strategy string, config map[string]interface{}) (RateLimiter, error) {
+	return f.createRateLimiter(strategy, config, f.metricsCollector)
+}
+
+// CreatePolicyRateLimiter builds a rate limiter whose metrics are routed to
+// the collector assigned to the policy in the collector registry.
+func (f *Factory) CreatePolicyRateLimiter(policy string, strategy string, config map[string]interface{}) (RateLimiter, error) {
+	collector := f.metricsCollector
+	if f.collectors != nil {
+		collector = f.collectors.ForPolicy(policy)
+	}
+	return f.createRateLimiter(strategy, config, collector)
+}
+
+func (f *Factory) createRateLimiter(strategy string, config map[string]interface{}, collector metrics.Collector) (RateLimiter, error) {
 	constructor, exists := f.strategies[strategy]
 	if !exists {
 		return nil, fmt.Errorf("unsupported rate limiter strategy: %s", strategy)
@@ -41,11 +88,48 @@ func (f *Factory) CreateRateLimiter(strategy string, config map[string]interface
 	if err != nil {
 		return nil, err
 	}
+	if recorder, ok := rateLimiter.(topKeysRecorder); ok && f.topKeys != nil {
+		recorder.setTopKeys(f.topKeys)
+	}
+	if setter, ok := rateLimiter.(readClientSetter); ok && f.readClient != nil {
+		setter.setReadClient(f.readClient)
+	}
+	if recorder, ok := rateLimiter.(keyStatsRecorder); ok && f.keyStatsWindow > 0 {
+		recorder.setKeyStats(f.keyStatsWindow)
+	}
+	if worker, ok := rateLimiter.(backgroundWorker); ok && f.backgroundCtx != nil {
+		worker.setBackgroundContext(f.backgroundCtx)
+	}
+	if clock := f.clocks[strategy]; clock != nil {
+		rateLimiter = NewClockDecorator(rateLimiter, clock)
+	}
+
+	if collector != nil {
+		return NewMetricsDecorator(rateLimiter, collector, strategy).WithDecisionStream(f.decisions), nil
+	}
+
+	return rateLimiter, nil
+}
 
-	if f.metricsCollector != nil {
-		return NewMetricsDecorator(rateLimiter, f.metricsCollector, strategy), nil
+// CreateShadowRateLimiter builds a strategy whose decisions are only
+// compared with the enforced ones, so it records no metrics, decisions or
+// top keys of its own.
+func (f *Factory) CreateShadowRateLimiter(strategy string, config map[string]interface{}) (RateLimiter, error) {
+	constructor, exists := f.strategies[strategy]
+	if !exists {
+		return nil, fmt.Errorf("unsupported rate limiter strategy: %s", strategy)
 	}
 
+	rateLimiter, err := constructor.NewFromConfig(config, f.redisClient)
+	if err != nil {
+		return nil, err
+	}
+	if worker, ok := rateLimiter.(backgroundWorker); ok && f.backgroundCtx != nil {
+		worker.setBackgroundContext(f.backgroundCtx)
+	}
+	if clock := f.clocks[strategy]; clock != nil {
+		rateLimiter = NewClockDecorator(rateLimiter, clock)
+	}
 	return rateLimiter, nil
 }
 
@@ -57,7 +141,70 @@ func (f *Factory) GetAvailableStrategies() []string {
 	return strategies
 }
 
+// WithDecisionStream emits every decision of the limiters created afterwards
+// to decisions.
+func (f *Factory) WithDecisionStream(decisions events.Emitter) *Factory {
+	f.decisions = decisions
+	return f
+}
+
+// WithPostgres replaces the Redis strategies with the ones the Postgres
+// backend has, token_bucket and fixed_window, keeping their state in store.
+// Strategies registered with Register are kept.
+func (f *Factory) WithPostgres(store *PostgresStore) *Factory {
+	f.strategies = make(map[string]StrategyConstructor)
+	f.RegisterStrategy(&PostgresTokenBucketConstructor{store: store})
+	f.RegisterStrategy(&PostgresFixedWindowConstructor{store: store})
+	f.registerCustomStrategies()
+	return f
+}
+
+// WithKeyStats makes the limiters created afterwards that support it report
+// KeyStats over window with every decision.
+func (f *Factory) WithKeyStats(window time.Duration) *Factory {
+	f.keyStatsWindow = window
+	return f
+}
+
+// WithTopKeys makes the limiters created afterwards count requests and
+// denials per key for the top keys report.
+func (f *Factory) WithTopKeys(topKeys *TopKeys) *Factory {
+	f.topKeys = topKeys
+	return f
+}
+
+// WithReadClient makes the limiters created afterwards send their read-only
+// operations, such as Peek, to client, typically a replica. Their decisions
+// still go to the primary.
+func (f *Factory) WithReadClient(client *redis.Client) *Factory {
+	f.readClient = client
+	return f
+}
+
+// WithBackgroundContext stops the background work of the limiters created
+// afterwards, such as lease refreshes, when ctx is done.
+func (f *Factory) WithBackgroundContext(ctx context.Context) *Factory {
+	f.backgroundCtx = ctx
+	return f
+}
+
+// WithClock makes the limiters of strategy created afterwards decide by clock
+// instead of the local clock.
+func (f *Factory) WithClock(strategy string, clock Clock) *Factory {
+	if f.clocks == nil {
+		f.clocks = make(map[string]Clock)
+	}
+	f.clocks[strategy] = clock
+	return f
+}
+
 func (f *Factory) WithMetrics(collector metrics.Collector) *Factory {
 	f.metricsCollector = collector
 	return f
 }
+
+func (f *Factory) WithCollectorRegistry(collectors *metrics.Registry) *Factory {
+	f.collectors = collectors
+	f.metricsCollector = collectors.Default()
+	return f
+}
@@ -58,7 +58,10 @@ func TestNewFactory(t *testing.T) {
 	assert.Contains(t, strategies, "token_bucket")
 	assert.Contains(t, strategies, "sliding_window_log")
 	assert.Contains(t, strategies, "sliding_window_counter")
-	assert.Len(t, strategies, 3)
+	assert.Contains(t, strategies, "quota")
+	assert.Contains(t, strategies, "hierarchical")
+	assert.Contains(t, strategies, "multi_window")
+	assert.Len(t, strategies, 6)
 }
 
 func TestFactory_RegisterStrategy(t *testing.T) {
@@ -192,7 +195,7 @@ func TestFactory_GetAvailableStrategies(t *testing.T) {
 
 	// Test with default strategies
 	strategies := factory.GetAvailableStrategies()
-	assert.Len(t, strategies, 3)
+	assert.Len(t, strategies, 6)
 	assert.Contains(t, strategies, "token_bucket")
 	assert.Contains(t, strategies, "sliding_window_log")
 	assert.Contains(t, strategies, "sliding_window_counter")
@@ -203,8 +206,45 @@ func TestFactory_GetAvailableStrategies(t *testing.T) {
 	factory.RegisterStrategy(mockConstructor)
 
 	strategies = factory.GetAvailableStrategies()
-	assert.Len(t, strategies, 4)
+	assert.Len(t, strategies, 7)
 	assert.Contains(t, strategies, "custom_strategy")
 	
 	mockConstructor.AssertExpectations(t)
-}
\ No newline at end of file
+}
+type namedCollector struct {
+	metrics.NoopCollector
+	name string
+}
+
+func TestFactory_CreatePolicyRateLimiter_RoutesCollector(t *testing.T) {
+	mockRedis := &redis.Client{}
+	defaultCollector := &namedCollector{name: "default"}
+	teamCollector := &namedCollector{name: "team"}
+
+	registry := metrics.NewRegistry("default", defaultCollector)
+	registry.Register("team", teamCollector)
+	assert.NoError(t, registry.Assign("search", "team"))
+	assert.Error(t, registry.Assign("login", "missing"))
+
+	factory := NewFactory(mockRedis).WithCollectorRegistry(registry)
+
+	mockConstructor := &MockStrategyConstructor{}
+	mockRateLimiter := &MockRateLimiterForFactory{}
+	config := map[string]interface{}{"bucket_size": 10}
+
+	mockConstructor.On("Name").Return("test_strategy")
+	mockConstructor.On("NewFromConfig", config, mockRedis).Return(mockRateLimiter, nil)
+	factory.RegisterStrategy(mockConstructor)
+
+	rateLimiter, err := factory.CreatePolicyRateLimiter("search", "test_strategy", config)
+	assert.NoError(t, err)
+	decorator, ok := rateLimiter.(*MetricsDecorator)
+	assert.True(t, ok)
+	assert.Same(t, teamCollector, decorator.collector)
+
+	rateLimiter, err = factory.CreatePolicyRateLimiter("login", "test_strategy", config)
+	assert.NoError(t, err)
+	decorator, ok = rateLimiter.(*MetricsDecorator)
+	assert.True(t, ok)
+	assert.Same(t, defaultCollector, decorator.collector)
+}
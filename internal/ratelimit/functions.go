@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// FunctionLibraryPrefix starts the name of the Redis Functions library holding
+// the scripts. The rest is a hash of its code, so each build registers its
+// own library and instances of different versions can share a Redis during a
+// rolling deploy.
+const FunctionLibraryPrefix = "ratelimit_"
+
+// useFunctions switches every script call to FCALL. It is set by
+// LoadFunctions and stays on for the life of the process.
+var useFunctions atomic.Bool
+
+var (
+	libraryOnce    sync.Once
+	libraryName    string
+	librarySource  string
+	functionPrefix string
+)
+
+// luaScript is an embedded script that runs with EVALSHA or, once
+// LoadFunctions has been called, as a function of the library.
+type luaScript struct {
+	*redis.Script
+	name   string
+	source string
+}
+
+// functionCaller is the part of a client FCALL needs; *redis.Client and
+// *redis.ClusterClient implement it.
+type functionCaller interface {
+	FCall(ctx context.Context, function string, keys []string, args ...interface{}) *redis.Cmd
+	FunctionLoadReplace(ctx context.Context, code string) *redis.StringCmd
+}
+
+// Run calls the script's function when functions are on and c supports them,
+// loading the library first if c's server doesn't have it, e.g. a region's
+// Redis or one that was restarted, like redis.Script does on NOSCRIPT.
+func (s *luaScript) Run(ctx context.Context, c redis.Scripter, keys []string, args ...interface{}) *redis.Cmd {
+	caller, ok := c.(functionCaller)
+	if !ok || !useFunctions.Load() {
+		return s.Script.Run(ctx, c, keys, args...)
+	}
+
+	function := s.function()
+	cmd := caller.FCall(ctx, function, keys, args...)
+	if err := cmd.Err(); err != nil && strings.Contains(err.Error(), "Function not found") {
+		if err := loadLibrary(ctx, caller); err != nil {
+			return cmd
+		}
+		cmd = caller.FCall(ctx, function, keys, args...)
+	}
+	return cmd
+}
+
+func (s *luaScript) function() string {
+	buildLibrary()
+	return functionPrefix + s.name
+}
+
+// LoadFunctions registers every embedded script as a function of one library
+// with FUNCTION LOAD and makes scripts run with FCALL from then on. It needs
+// Redis 7. Loading the same library again is a no-op, and libraries of older
+// builds are left in place for instances still running them.
+func LoadFunctions(ctx context.Context, client functionCaller) error {
+	if err := loadLibrary(ctx, client); err != nil {
+		return err
+	}
+	useFunctions.Store(true)
+	return nil
+}
+
+// FunctionLibrary returns the name of the library LoadFunctions registers.
+func FunctionLibrary() string {
+	buildLibrary()
+	return libraryName
+}
+
+func loadLibrary(ctx context.Context, client functionCaller) error {
+	buildLibrary()
+	name, err := client.FunctionLoadReplace(ctx, librarySource).Result()
+	if err != nil {
+		return fmt.Errorf("redis function library %s: %w", libraryName, err)
+	}
+	if name != libraryName {
+		return fmt.Errorf("redis function library: redis returned name %s, expected %s", name, libraryName)
+	}
+	return nil
+}
+
+// buildLibrary wraps each script in a function taking KEYS and ARGV, so the
+// scripts and their prelude run unchanged, and names the library and its
+// functions after a hash of the scripts.
+func buildLibrary() {
+	libraryOnce.Do(func() {
+		names := make([]string, 0, len(scripts))
+		for name := range scripts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		hash := sha1.New()
+		for _, name := range names {
+			hash.Write([]byte(name))
+			hash.Write([]byte(scripts[name].source))
+		}
+		libraryName = FunctionLibraryPrefix + hex.EncodeToString(hash.Sum(nil))[:12]
+		functionPrefix = libraryName + "_"
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "#!lua name=%s\n", libraryName)
+		for _, name := range names {
+			script := scripts[name]
+			fmt.Fprintf(&b, "\nredis.register_function('%s%s', function(KEYS, ARGV)\n", functionPrefix, script.name)
+			b.WriteString(script.source)
+			b.WriteString("\nend)\n")
+		}
+		librarySource = b.String()
+	})
+}
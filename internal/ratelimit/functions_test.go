@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// fakeFunctions records FCALLs and FUNCTION LOADs, which miniredis lacks.
+type fakeFunctions struct {
+	*redis.Client
+	loaded []string
+	calls  []string
+}
+
+func (f *fakeFunctions) FCall(ctx context.Context, function string, keys []string, args ...interface{}) *redis.Cmd {
+	f.calls = append(f.calls, function)
+	cmd := redis.NewCmd(ctx)
+	if len(f.loaded) == 0 {
+		cmd.SetErr(errors.New("ERR Function not found"))
+		return cmd
+	}
+	cmd.SetVal(int64(1))
+	return cmd
+}
+
+func (f *fakeFunctions) FunctionLoadReplace(ctx context.Context, code string) *redis.StringCmd {
+	f.loaded = append(f.loaded, code)
+	cmd := redis.NewStringCmd(ctx)
+	cmd.SetVal(FunctionLibrary())
+	return cmd
+}
+
+func TestFunctionLibrary(t *testing.T) {
+	buildLibrary()
+
+	assert.Regexp(t, "^"+FunctionLibraryPrefix+"[0-9a-f]{12}$", libraryName)
+	assert.True(t, strings.HasPrefix(librarySource, "#!lua name="+libraryName+"\n"))
+
+	registered := regexp.MustCompile(`redis\.register_function\('([a-z0-9_]+)'`).FindAllStringSubmatch(librarySource, -1)
+	require.Len(t, registered, len(scripts), "every script is a function")
+	assert.Contains(t, librarySource, "redis.register_function('"+tokenBucketScript.function()+"'")
+
+	_, err := parse.Parse(strings.NewReader(strings.SplitN(librarySource, "\n", 2)[1]), "library")
+	assert.NoError(t, err, "the library must be valid Lua")
+}
+
+func TestLuaScript_RunWithFunctions(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newScriptRedis(t)
+	functions := &fakeFunctions{Client: client}
+
+	// Without LoadFunctions scripts keep running with EVALSHA.
+	_, err := tokenBucketPeekScript.Run(ctx, functions, []string{"tb:k", ThrottleKey}, 2, 1, scriptNow).Result()
+	require.NoError(t, err)
+	assert.Empty(t, functions.calls)
+
+	t.Cleanup(func() { useFunctions.Store(false) })
+	useFunctions.Store(true)
+
+	// A server without the library gets it loaded on the first call.
+	result, err := tokenBucketPeekScript.Run(ctx, functions, []string{"tb:k", ThrottleKey}, 2, 1, scriptNow).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result)
+	assert.Len(t, functions.loaded, 1)
+	assert.Equal(t, []string{tokenBucketPeekScript.function(), tokenBucketPeekScript.function()}, functions.calls)
+
+	require.NoError(t, LoadFunctions(ctx, functions))
+	assert.Len(t, functions.loaded, 2)
+}
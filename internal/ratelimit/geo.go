@@ -0,0 +1,322 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// GeoInfo describes where a client address is registered.
+type GeoInfo struct {
+	Country        string
+	ASN            uint
+	ASOrganization string
+}
+
+// GeoLookup resolves a client address to its country and ASN.
+type GeoLookup interface {
+	Lookup(ip netip.Addr) (GeoInfo, error)
+}
+
+// GeoRule scales the limit for clients from the listed countries (ISO 3166
+// codes) or ASNs, e.g. 0.1 for known hosting providers.
+type GeoRule struct {
+	Name            string
+	Countries       []string
+	ASNs            []uint
+	LimitMultiplier float64
+}
+
+func (r GeoRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("geo rule name is required")
+	}
+	if len(r.Countries) == 0 && len(r.ASNs) == 0 {
+		return fmt.Errorf("geo rule %s: at least one country or ASN is required", r.Name)
+	}
+	if r.LimitMultiplier <= 0 {
+		return fmt.Errorf("geo rule %s: limit multiplier must be positive", r.Name)
+	}
+	return nil
+}
+
+func (r GeoRule) Matches(info GeoInfo) bool {
+	for _, asn := range r.ASNs {
+		if info.ASN != 0 && asn == info.ASN {
+			return true
+		}
+	}
+	for _, country := range r.Countries {
+		if info.Country != "" && strings.EqualFold(country, info.Country) {
+			return true
+		}
+	}
+	return false
+}
+
+type clientIPContextKey struct{}
+
+// WithClientIP records the caller's address so geo rules can classify it,
+// independently of how the rate-limit key was built.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	if ip == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, clientIPContextKey{}, ip)
+}
+
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPContextKey{}).(string)
+	return ip
+}
+
+type geoRoute struct {
+	rule        GeoRule
+	rateLimiter RateLimiter
+}
+
+// GeoRateLimiter sends requests from clients matching a GeoRule to that
+// rule's rate limiter and everyone else to the fallback. Rules are checked in
+// the order they were added.
+type GeoRateLimiter struct {
+	lookup   GeoLookup
+	fallback RateLimiter
+	routes   []geoRoute
+}
+
+func NewGeoRateLimiter(lookup GeoLookup, fallback RateLimiter) *GeoRateLimiter {
+	return &GeoRateLimiter{
+		lookup:   lookup,
+		fallback: fallback,
+	}
+}
+
+func (g *GeoRateLimiter) AddRule(rule GeoRule, rateLimiter RateLimiter) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	g.routes = append(g.routes, geoRoute{rule: rule, rateLimiter: rateLimiter})
+	return nil
+}
+
+func (g *GeoRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	rateLimiter, metadata := g.route(ctx)
+
+	response, err := rateLimiter.IsAllowed(ctx, key, timestamp)
+	if err != nil {
+		return response, err
+	}
+	return withGeoMetadata(response, metadata), nil
+}
+
+func (g *GeoRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	rateLimiter, metadata := g.route(ctx)
+
+	peeker, ok := rateLimiter.(Peeker)
+	if !ok {
+		return RateLimitResponse{Err: ErrPeekNotSupported}, ErrPeekNotSupported
+	}
+	response, err := peeker.Peek(ctx, key, timestamp)
+	if err != nil {
+		return response, err
+	}
+	return withGeoMetadata(response, metadata), nil
+}
+
+// Reset clears key under every rule, since the caller's address may have
+// matched a different rule when the budget was consumed.
+func (g *GeoRateLimiter) Reset(ctx context.Context, key string) error {
+	var errs []error
+	if err := g.fallback.Reset(ctx, key); err != nil {
+		errs = append(errs, err)
+	}
+	for _, route := range g.routes {
+		if err := route.rateLimiter.Reset(ctx, key); err != nil {
+			errs = append(errs, fmt.Errorf("geo rule %s: %w", route.rule.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ResetPrefix clears the prefix under every rule, like Reset.
+func (g *GeoRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	resetter, ok := g.fallback.(PrefixResetter)
+	if !ok {
+		return 0, ErrResetPrefixNotSupported
+	}
+	deleted, err := resetter.ResetPrefix(ctx, prefix)
+	errs := []error{err}
+	for _, route := range g.routes {
+		resetter, ok := route.rateLimiter.(PrefixResetter)
+		if !ok {
+			errs = append(errs, fmt.Errorf("geo rule %s: %w", route.rule.Name, ErrResetPrefixNotSupported))
+			continue
+		}
+		n, err := resetter.ResetPrefix(ctx, prefix)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("geo rule %s: %w", route.rule.Name, err))
+		}
+		deleted += n
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// Refund goes to the rule the caller's address matches now, which is the one
+// that charged the request unless the GeoIP database changed in between.
+func (g *GeoRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	rateLimiter, _ := g.route(ctx)
+
+	refunder, ok := rateLimiter.(Refunder)
+	if !ok {
+		return ErrRefundNotSupported
+	}
+	return refunder.Refund(ctx, key, n, timestamp)
+}
+
+func (g *GeoRateLimiter) SupportsRefund() bool {
+	if !SupportsRefund(g.fallback) {
+		return false
+	}
+	for _, route := range g.routes {
+		if !SupportsRefund(route.rateLimiter) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddDebt charges key under every rule, like Reset, since the caller may come
+// back from an address that matches a different rule.
+func (g *GeoRateLimiter) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	debtor, ok := g.fallback.(Debtor)
+	if !ok {
+		return ErrDebtNotSupported
+	}
+	errs := []error{debtor.AddDebt(ctx, key, n, timestamp)}
+	for _, route := range g.routes {
+		debtor, ok := route.rateLimiter.(Debtor)
+		if !ok {
+			errs = append(errs, fmt.Errorf("geo rule %s: %w", route.rule.Name, ErrDebtNotSupported))
+			continue
+		}
+		if err := debtor.AddDebt(ctx, key, n, timestamp); err != nil {
+			errs = append(errs, fmt.Errorf("geo rule %s: %w", route.rule.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (g *GeoRateLimiter) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error) {
+	rateLimiter, metadata := g.route(ctx)
+
+	reserver, ok := rateLimiter.(Reserver)
+	if !ok {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: ErrReserveNotSupported}}, ErrReserveNotSupported
+	}
+	reservation, err := reserver.ReserveN(ctx, key, n, timestamp, maxDelay)
+	if err != nil {
+		return reservation, err
+	}
+	reservation.RateLimitResponse = withGeoMetadata(reservation.RateLimitResponse, metadata)
+	return reservation, nil
+}
+
+func (g *GeoRateLimiter) SupportsReserve() bool {
+	if !SupportsReserve(g.fallback) {
+		return false
+	}
+	for _, route := range g.routes {
+		if !SupportsReserve(route.rateLimiter) {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *GeoRateLimiter) route(ctx context.Context) (RateLimiter, map[string]interface{}) {
+	addr, err := netip.ParseAddr(ClientIPFromContext(ctx))
+	if err != nil {
+		return g.fallback, nil
+	}
+
+	info, err := g.lookup.Lookup(addr.Unmap())
+	if err != nil {
+		slog.Debug("geo lookup failed", "ip", addr.String(), "error", err.Error())
+		return g.fallback, nil
+	}
+
+	metadata := map[string]interface{}{}
+	if info.Country != "" {
+		metadata["geo_country"] = info.Country
+	}
+	if info.ASN != 0 {
+		metadata["geo_asn"] = info.ASN
+	}
+
+	for _, route := range g.routes {
+		if route.rule.Matches(info) {
+			metadata["geo_rule"] = route.rule.Name
+			metadata["geo_limit_multiplier"] = route.rule.LimitMultiplier
+			return route.rateLimiter, metadata
+		}
+	}
+	return g.fallback, metadata
+}
+
+func withGeoMetadata(response RateLimitResponse, metadata map[string]interface{}) RateLimitResponse {
+	for name, value := range metadata {
+		response.Metadata.Set(name, value)
+	}
+	return response
+}
+
+// ScaleLimits returns a copy of a converted strategy config with its limits
+// multiplied by multiplier (never below 1, though refill rates keep their
+// fraction) and keys stored under keySuffix,
+// so a scaled variant keeps its own budget.
+func ScaleLimits(strategyConfig map[string]interface{}, multiplier float64, keySuffix string) (map[string]interface{}, error) {
+	if multiplier <= 0 {
+		return nil, fmt.Errorf("limit multiplier must be positive, got %v", multiplier)
+	}
+
+	scaled := make(map[string]interface{}, len(strategyConfig))
+	for name, value := range strategyConfig {
+		scaled[name] = value
+	}
+
+	if _, exists := scaled["refill_rate_per_second"]; exists {
+		rate, err := getFloat64Config(scaled, "refill_rate_per_second")
+		if err != nil {
+			return nil, err
+		}
+		scaled["refill_rate_per_second"] = rate * multiplier
+	}
+	for _, name := range []string{"bucket_size", "limit", "burst_limit"} {
+		if _, exists := scaled[name]; !exists {
+			continue
+		}
+		value, err := getInt64Config(scaled, name)
+		if err != nil {
+			return nil, err
+		}
+		scaledValue := int64(float64(value) * multiplier)
+		if scaledValue < 1 {
+			scaledValue = 1
+		}
+		scaled[name] = scaledValue
+	}
+
+	if keySuffix != "" {
+		prefix, err := getStringConfig(scaled, "key_prefix")
+		if err != nil {
+			return nil, err
+		}
+		scaled["key_prefix"] = prefix + keySuffix
+	}
+
+	return scaled, nil
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type staticGeoLookup map[string]GeoInfo
+
+func (s staticGeoLookup) Lookup(ip netip.Addr) (GeoInfo, error) {
+	info, ok := s[ip.String()]
+	if !ok {
+		return GeoInfo{}, errors.New("address not found")
+	}
+	return info, nil
+}
+
+func TestGeoRateLimiter_RoutesByRule(t *testing.T) {
+	lookup := staticGeoLookup{
+		"198.51.100.1": {Country: "US", ASN: 16509},
+		"203.0.113.1":  {Country: "NZ", ASN: 64500},
+	}
+	fallback := new(MockRateLimiterForFactory)
+	hosting := new(MockRateLimiterForFactory)
+
+	geo := NewGeoRateLimiter(lookup, fallback)
+	require.NoError(t, geo.AddRule(GeoRule{Name: "hosting", ASNs: []uint{16509}, LimitMultiplier: 0.1}, hosting))
+
+	hosting.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(RateLimitResponse{Allowed: true, Limit: 1}, nil).Once()
+	fallback.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(RateLimitResponse{Allowed: true, Limit: 10}, nil).Twice()
+
+	ctx := WithClientIP(context.Background(), "198.51.100.1")
+	response, err := geo.IsAllowed(ctx, "client", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), response.Limit)
+	assert.Equal(t, "hosting", response.Metadata.Value("geo_rule"))
+	assert.Equal(t, uint(16509), response.Metadata.Value("geo_asn"))
+	assert.Equal(t, "US", response.Metadata.Value("geo_country"))
+
+	ctx = WithClientIP(context.Background(), "203.0.113.1")
+	response, err = geo.IsAllowed(ctx, "client", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), response.Limit)
+	assert.Equal(t, "NZ", response.Metadata.Value("geo_country"))
+	assert.False(t, response.Metadata.Has("geo_rule"))
+
+	// Unknown addresses and requests without an IP use the fallback.
+	response, err = geo.IsAllowed(context.Background(), "client", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), response.Limit)
+
+	hosting.AssertExpectations(t)
+	fallback.AssertExpectations(t)
+}
+
+func TestGeoRateLimiter_ResetClearsEveryRule(t *testing.T) {
+	fallback := new(MockRateLimiterForFactory)
+	blocked := new(MockRateLimiterForFactory)
+
+	geo := NewGeoRateLimiter(staticGeoLookup{}, fallback)
+	require.NoError(t, geo.AddRule(GeoRule{Name: "blocked", Countries: []string{"xx"}, LimitMultiplier: 0.5}, blocked))
+
+	fallback.On("Reset", mock.Anything, "client").Return(nil)
+	blocked.On("Reset", mock.Anything, "client").Return(nil)
+
+	require.NoError(t, geo.Reset(context.Background(), "client"))
+	fallback.AssertExpectations(t)
+	blocked.AssertExpectations(t)
+}
+
+func TestGeoRule_Validate(t *testing.T) {
+	assert.Error(t, GeoRule{Countries: []string{"US"}, LimitMultiplier: 1}.Validate())
+	assert.Error(t, GeoRule{Name: "empty", LimitMultiplier: 1}.Validate())
+	assert.Error(t, GeoRule{Name: "zero", Countries: []string{"US"}}.Validate())
+	assert.NoError(t, GeoRule{Name: "ok", Countries: []string{"US"}, LimitMultiplier: 2}.Validate())
+
+	assert.True(t, GeoRule{Countries: []string{"us"}}.Matches(GeoInfo{Country: "US"}))
+	assert.False(t, GeoRule{ASNs: []uint{1}}.Matches(GeoInfo{Country: "US"}))
+}
+
+func TestScaleLimits(t *testing.T) {
+	original := map[string]interface{}{
+		"key_prefix":             "rl:tb:",
+		"bucket_size":            int64(100),
+		"refill_rate_per_second": int64(5),
+	}
+
+	scaled, err := ScaleLimits(original, 0.1, "geo:hosting")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), scaled["bucket_size"])
+	assert.Equal(t, 0.5, scaled["refill_rate_per_second"], "refill rates keep their fraction")
+	assert.Equal(t, "rl:tb:geo:hosting", scaled["key_prefix"])
+	assert.Equal(t, int64(100), original["bucket_size"], "the original config is untouched")
+
+	scaled, err = ScaleLimits(original, 0.001, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), scaled["bucket_size"], "limits never drop below 1")
+
+	_, err = ScaleLimits(original, 0, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// MaxMindGeoLookup reads MaxMind country and ASN databases (GeoIP2 or
+// GeoLite2). Either database may be omitted.
+type MaxMindGeoLookup struct {
+	country *geoip2.Reader
+	asn     *geoip2.Reader
+}
+
+func OpenMaxMindGeoLookup(countryDB, asnDB string) (*MaxMindGeoLookup, error) {
+	if countryDB == "" && asnDB == "" {
+		return nil, errors.New("geoip needs a country or ASN database")
+	}
+
+	lookup := &MaxMindGeoLookup{}
+	if countryDB != "" {
+		reader, err := geoip2.Open(countryDB)
+		if err != nil {
+			return nil, fmt.Errorf("open country database: %w", err)
+		}
+		lookup.country = reader
+	}
+	if asnDB != "" {
+		reader, err := geoip2.Open(asnDB)
+		if err != nil {
+			lookup.Close()
+			return nil, fmt.Errorf("open ASN database: %w", err)
+		}
+		lookup.asn = reader
+	}
+	return lookup, nil
+}
+
+func (m *MaxMindGeoLookup) Lookup(ip netip.Addr) (GeoInfo, error) {
+	var info GeoInfo
+	netIP := net.IP(ip.AsSlice())
+
+	if m.country != nil {
+		record, err := m.country.Country(netIP)
+		if err != nil {
+			return GeoInfo{}, err
+		}
+		info.Country = record.Country.IsoCode
+	}
+	if m.asn != nil {
+		record, err := m.asn.ASN(netIP)
+		if err != nil {
+			return GeoInfo{}, err
+		}
+		info.ASN = record.AutonomousSystemNumber
+		info.ASOrganization = record.AutonomousSystemOrganization
+	}
+	return info, nil
+}
+
+func (m *MaxMindGeoLookup) Close() error {
+	var errs []error
+	if m.country != nil {
+		errs = append(errs, m.country.Close())
+	}
+	if m.asn != nil {
+		errs = append(errs, m.asn.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -2,7 +2,6 @@ package ratelimit
 
 import (
 	"fmt"
-	"time"
 )
 
 func getInt64FromResult(value interface{}) (int64, error) {
@@ -36,17 +35,22 @@ func getInt64Config(config map[string]interface{}, key string) (int64, error) {
 	}
 }
 
-func getDurationConfig(config map[string]interface{}, key string) (time.Duration, error) {
+func getFloat64Config(config map[string]interface{}, key string) (float64, error) {
 	value, exists := config[key]
 	if !exists {
 		return 0, fmt.Errorf("required config key '%s' not found", key)
 	}
 
-	if duration, ok := value.(time.Duration); ok {
-		return duration, nil
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	default:
+		return 0, fmt.Errorf("config key '%s' must be a number, got %T", key, value)
 	}
-
-	return 0, fmt.Errorf("config key '%s' must be a time.Duration, got %T", key, value)
 }
 
 func getStringConfig(config map[string]interface{}, key string) (string, error) {
@@ -61,21 +65,3 @@ func getStringConfig(config map[string]interface{}, key string) (string, error)
 
 	return "", fmt.Errorf("config key '%s' must be a string, got %T", key, value)
 }
-
-func getIntConfig(config map[string]interface{}, key string) (int, error) {
-	value, exists := config[key]
-	if !exists {
-		return 0, fmt.Errorf("required config key '%s' not found", key)
-	}
-
-	switch v := value.(type) {
-	case int:
-		return v, nil
-	case int64:
-		return int(v), nil
-	case float64:
-		return int(v), nil
-	default:
-		return 0, fmt.Errorf("config key '%s' must be a number, got %T", key, value)
-	}
-}
\ No newline at end of file
@@ -0,0 +1,286 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Hierarchy levels, innermost first, as reported in the limited_by metadata.
+const (
+	HierarchyLevelUser         = "user"
+	HierarchyLevelOrganization = "organization"
+	HierarchyLevelGlobal       = "global"
+)
+
+type organizationContextKey struct{}
+
+// WithOrganization records the organization the caller belongs to, so the
+// hierarchical strategy can charge its shared budget.
+func WithOrganization(ctx context.Context, organization string) context.Context {
+	if organization == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, organizationContextKey{}, organization)
+}
+
+func OrganizationFromContext(ctx context.Context) string {
+	organization, _ := ctx.Value(organizationContextKey{}).(string)
+	return organization
+}
+
+// HierarchicalConfig limits each key (the user level) with a token bucket,
+// and optionally every key of an organization and every key of the service
+// with shared buckets. A bucket size of 0 disables a shared level.
+type HierarchicalConfig struct {
+	KeyPrefix                       string  `mapstructure:"key_prefix"`
+	TTLBufferSeconds                int     `mapstructure:"ttl_buffer_seconds"`
+	BucketSize                      int64   `mapstructure:"bucket_size"`
+	RefillRatePerSecond             float64 `mapstructure:"refill_rate_per_second"`
+	OrganizationBucketSize          int64   `mapstructure:"organization_bucket_size"`
+	OrganizationRefillRatePerSecond int64   `mapstructure:"organization_refill_rate_per_second"`
+	GlobalBucketSize                int64   `mapstructure:"global_bucket_size"`
+	GlobalRefillRatePerSecond       int64   `mapstructure:"global_refill_rate_per_second"`
+}
+
+func (c HierarchicalConfig) Validate() error {
+	if c.BucketSize <= 0 || c.RefillRatePerSecond <= 0 {
+		return errors.New("bucket_size and refill_rate_per_second must be positive")
+	}
+	if c.OrganizationBucketSize < 0 || (c.OrganizationBucketSize > 0 && c.OrganizationRefillRatePerSecond <= 0) {
+		return errors.New("invalid organization bucket configuration")
+	}
+	if c.GlobalBucketSize < 0 || (c.GlobalBucketSize > 0 && c.GlobalRefillRatePerSecond <= 0) {
+		return errors.New("invalid global bucket configuration")
+	}
+	return nil
+}
+
+type hierarchyLevel struct {
+	name       string
+	redisKey   string
+	bucketSize int64
+	refillRate float64
+}
+
+// HierarchicalRateLimiter charges a request at every level of user,
+// organization and global in one script, so it is either admitted by all of
+// them or charged by none. The organization comes from the context (see
+// WithOrganization); requests without one skip that level.
+type HierarchicalRateLimiter struct {
+	config      HierarchicalConfig
+	redisClient *redis.Client
+	ttlBuffer   int64
+	topKeys     *TopKeys
+	metadata    Metadata
+}
+
+func NewHierarchicalRateLimiter(config HierarchicalConfig, redisClient *redis.Client) (*HierarchicalRateLimiter, error) {
+	if redisClient == nil {
+		return nil, errors.New("invalid configuration")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	ttlBufferSeconds := config.TTLBufferSeconds
+	if ttlBufferSeconds <= 0 {
+		ttlBufferSeconds = DefaultTTLBufferSeconds
+	}
+
+	return &HierarchicalRateLimiter{
+		config:      config,
+		redisClient: redisClient,
+		ttlBuffer:   int64(ttlBufferSeconds),
+		metadata: SharedMetadata(map[string]interface{}{
+			"bucket_size": config.BucketSize,
+			"refill_rate": config.RefillRatePerSecond,
+		}),
+	}, nil
+}
+
+// levels returns the buckets key is charged against, innermost first.
+// Organization buckets are namespaced like keys; the global one is shared by
+// every namespace.
+func (h *HierarchicalRateLimiter) levels(ctx context.Context, key string) []hierarchyLevel {
+	levels := []hierarchyLevel{{
+		name:       HierarchyLevelUser,
+		redisKey:   bucketKey(h.config.KeyPrefix, key),
+		bucketSize: h.config.BucketSize,
+		refillRate: h.config.RefillRatePerSecond,
+	}}
+	if organization := OrganizationFromContext(ctx); organization != "" && h.config.OrganizationBucketSize > 0 {
+		levels = append(levels, hierarchyLevel{
+			name:       HierarchyLevelOrganization,
+			redisKey:   h.organizationKeyPrefix() + namespacedKey(ctx, organization),
+			bucketSize: h.config.OrganizationBucketSize,
+			refillRate: float64(h.config.OrganizationRefillRatePerSecond),
+		})
+	}
+	if h.config.GlobalBucketSize > 0 {
+		levels = append(levels, hierarchyLevel{
+			name:       HierarchyLevelGlobal,
+			redisKey:   globalBucketKey(h.config.KeyPrefix),
+			bucketSize: h.config.GlobalBucketSize,
+			refillRate: float64(h.config.GlobalRefillRatePerSecond),
+		})
+	}
+	return levels
+}
+
+func (h *HierarchicalRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	levels := h.levels(ctx, key)
+	redisKeys := make([]string, len(levels))
+	args := []interface{}{len(levels), timestamp.UnixNano(), h.ttlBuffer}
+	for i, level := range levels {
+		redisKeys[i] = level.redisKey
+		args = append(args, level.bucketSize, level.refillRate)
+	}
+
+	keys, args := h.topKeys.scriptKeys(redisKeys, args, key, timestamp)
+	result, err := hierarchicalScript.Run(ctx, h.redisClient, keys, args...).Result()
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) != 4+len(levels) {
+		err = errors.New("invalid redis response from hierarchical script")
+		return RateLimitResponse{Err: err}, err
+	}
+
+	values := make([]int64, len(resultArray))
+	for i := range resultArray {
+		values[i], err = getInt64FromResult(resultArray[i])
+		if err != nil {
+			err = fmt.Errorf("failed to parse hierarchical script result %d: %w", i, err)
+			return RateLimitResponse{Err: err}, err
+		}
+	}
+	allowed, limitedBy, timeNanos := values[0], values[1], values[2]
+
+	limit := limitFromResult(resultArray, 3, h.config.BucketSize)
+	metadata := h.metadata
+	if organization := OrganizationFromContext(ctx); organization != "" {
+		metadata.Set("organization", organization)
+	}
+	markThrottled(&metadata, limit, h.config.BucketSize)
+
+	remaining := values[4]
+	for i, level := range levels {
+		tokens := values[4+i]
+		metadata.SetInt(level.name+"_remaining", tokens)
+		if tokens < remaining {
+			remaining = tokens
+		}
+	}
+
+	if allowed == 1 {
+		fullTime := time.Unix(0, timeNanos)
+		metadata.SetTime("bucket_full_time", fullTime)
+
+		return RateLimitResponse{
+			Allowed:   true,
+			Limit:     limit,
+			Remaining: remaining,
+			ResetTime: fullTime,
+			Metadata:  metadata,
+		}, nil
+	}
+
+	nextTokenTime := time.Unix(0, timeNanos)
+	retryAfter := nextTokenTime.Sub(timestamp)
+	metadata.SetTime("next_token_time", nextTokenTime)
+	if limitedBy >= 1 && int(limitedBy) <= len(levels) {
+		metadata.Set("limited_by", levels[limitedBy-1].name)
+	}
+
+	return RateLimitResponse{
+		Allowed:    false,
+		Limit:      limit,
+		Remaining:  0,
+		ResetTime:  nextTokenTime,
+		RetryAfter: &retryAfter,
+		Metadata:   metadata,
+	}, nil
+}
+
+func (h *HierarchicalRateLimiter) setTopKeys(topKeys *TopKeys) {
+	h.topKeys = topKeys
+}
+
+// Reset clears the key's own bucket; organization and global buckets are
+// shared with other keys and kept.
+func (h *HierarchicalRateLimiter) Reset(ctx context.Context, key string) error {
+	return h.redisClient.Del(ctx, bucketKey(h.config.KeyPrefix, key)).Err()
+}
+
+// ResetPrefix deletes the bucket of every key starting with prefix. The
+// organization and global buckets are kept.
+func (h *HierarchicalRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPrefix
+	}
+	pattern := prefixPattern(h.config.KeyPrefix, escapeReservedKey(prefix))
+	return deleteMatching(ctx, h.redisClient, pattern, h.organizationKeyPrefix(), globalBucketKey(h.config.KeyPrefix))
+}
+
+// organizationKeyPrefix starts the Redis keys of organization buckets. It
+// starts with ReservedKeyPrefix, so no client's own bucket shares it.
+func (h *HierarchicalRateLimiter) organizationKeyPrefix() string {
+	return h.config.KeyPrefix + ":" + OrganizationBucketKeyPrefix
+}
+
+// Refund returns n tokens at every level the key was charged at, which
+// relies on ctx carrying the same organization as the charge.
+func (h *HierarchicalRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	if n <= 0 {
+		return nil
+	}
+
+	levels := h.levels(ctx, key)
+	keys := make([]string, 0, len(levels)+1)
+	args := []interface{}{n, timestamp.UnixNano()}
+	for _, level := range levels {
+		keys = append(keys, level.redisKey)
+		args = append(args, level.bucketSize)
+	}
+
+	return tokenBucketRefundScript.Run(ctx, h.redisClient, append(keys, ThrottleKey), args...).Err()
+}
+
+type HierarchicalConstructor struct{}
+
+func (c *HierarchicalConstructor) Name() string {
+	return "hierarchical"
+}
+
+func (c *HierarchicalConstructor) NewFromConfig(config map[string]interface{}, redisClient *redis.Client) (RateLimiter, error) {
+	options, err := DecodeOptions[HierarchicalConfig](config)
+	if err != nil {
+		return nil, fmt.Errorf("hierarchical strategy: %w", err)
+	}
+	return NewHierarchicalRateLimiter(options, redisClient)
+}
+
+func (c *HierarchicalConstructor) ConvertConfig(rawConfig interface{}) (map[string]interface{}, error) {
+	cfg, ok := rawConfig.(config.HierarchicalConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected HierarchicalConfig, got %T", rawConfig)
+	}
+
+	return EncodeOptions(HierarchicalConfig{
+		KeyPrefix:                       cfg.KeyPrefix,
+		TTLBufferSeconds:                cfg.TTLBufferSeconds,
+		BucketSize:                      cfg.User.BucketSize,
+		RefillRatePerSecond:             float64(cfg.User.RefillRatePerSecond),
+		OrganizationBucketSize:          cfg.Organization.BucketSize,
+		OrganizationRefillRatePerSecond: cfg.Organization.RefillRatePerSecond,
+		GlobalBucketSize:                cfg.Global.BucketSize,
+		GlobalRefillRatePerSecond:       cfg.Global.RefillRatePerSecond,
+	})
+}
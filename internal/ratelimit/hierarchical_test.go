@@ -0,0 +1,156 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHierarchy(t *testing.T) (*HierarchicalRateLimiter, context.Context) {
+	t.Helper()
+	client, _ := newScriptRedis(t)
+	limiter, err := NewHierarchicalRateLimiter(HierarchicalConfig{
+		KeyPrefix:                       "test:hier",
+		BucketSize:                      3,
+		RefillRatePerSecond:             1,
+		OrganizationBucketSize:          4,
+		OrganizationRefillRatePerSecond: 1,
+		GlobalBucketSize:                6,
+		GlobalRefillRatePerSecond:       1,
+	}, client)
+	require.NoError(t, err)
+	return limiter, WithOrganization(context.Background(), "acme")
+}
+
+func TestHierarchicalRateLimiter_LimitedByEachLevel(t *testing.T) {
+	limiter, acme := newTestHierarchy(t)
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 3; i++ {
+		response, err := limiter.IsAllowed(acme, "alice", now)
+		require.NoError(t, err)
+		require.True(t, response.Allowed)
+	}
+	response, err := limiter.IsAllowed(acme, "alice", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, HierarchyLevelUser, response.Metadata.Value("limited_by"))
+	assert.Equal(t, "acme", response.Metadata.Value("organization"))
+
+	response, err = limiter.IsAllowed(acme, "bob", now)
+	require.NoError(t, err)
+	require.True(t, response.Allowed)
+	assert.Equal(t, int64(0), response.Metadata.Value("organization_remaining"))
+	assert.Equal(t, int64(0), response.Remaining)
+
+	response, err = limiter.IsAllowed(acme, "bob", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, HierarchyLevelOrganization, response.Metadata.Value("limited_by"))
+	require.NotNil(t, response.RetryAfter)
+	assert.Equal(t, time.Second, *response.RetryAfter)
+
+	// Requests without an organization skip that level but still share the
+	// global bucket.
+	for i := 0; i < 2; i++ {
+		response, err = limiter.IsAllowed(context.Background(), "carol", now)
+		require.NoError(t, err)
+		require.True(t, response.Allowed)
+	}
+	response, err = limiter.IsAllowed(context.Background(), "carol", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, HierarchyLevelGlobal, response.Metadata.Value("limited_by"))
+	assert.False(t, response.Metadata.Has("organization_remaining"))
+}
+
+func TestHierarchicalRateLimiter_DeniedRequestsChargeNoLevel(t *testing.T) {
+	limiter, acme := newTestHierarchy(t)
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 5; i++ {
+		_, err := limiter.IsAllowed(acme, "alice", now)
+		require.NoError(t, err)
+	}
+
+	response, err := limiter.IsAllowed(acme, "bob", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed, "alice's denied requests must not use up the organization")
+	assert.Equal(t, int64(0), response.Metadata.Value("organization_remaining"))
+	assert.Equal(t, int64(2), response.Metadata.Value("global_remaining"))
+}
+
+func TestHierarchicalRateLimiter_Refund(t *testing.T) {
+	limiter, acme := newTestHierarchy(t)
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 3; i++ {
+		_, err := limiter.IsAllowed(acme, "alice", now)
+		require.NoError(t, err)
+	}
+	require.NoError(t, limiter.Refund(acme, "alice", 2, now))
+
+	response, err := limiter.IsAllowed(acme, "alice", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(1), response.Metadata.Value("user_remaining"))
+	assert.Equal(t, int64(2), response.Metadata.Value("organization_remaining"))
+	assert.Equal(t, int64(4), response.Metadata.Value("global_remaining"))
+}
+
+func TestHierarchicalRateLimiter_ClientCannotNameOrganizationBucket(t *testing.T) {
+	client, server := newScriptRedis(t)
+	limiter, err := NewHierarchicalRateLimiter(HierarchicalConfig{
+		KeyPrefix:                       "hier",
+		BucketSize:                      5,
+		RefillRatePerSecond:             1,
+		OrganizationBucketSize:          2,
+		OrganizationRefillRatePerSecond: 1,
+	}, client)
+	require.NoError(t, err)
+	now := time.Unix(1000, 0)
+	acme := WithOrganization(context.Background(), "acme")
+
+	response, err := limiter.IsAllowed(acme, "alice", now)
+	require.NoError(t, err)
+	require.True(t, response.Allowed)
+	for i := 0; i < 5; i++ {
+		response, err = limiter.IsAllowed(context.Background(), OrganizationBucketKeyPrefix+"acme", now)
+		require.NoError(t, err)
+		require.True(t, response.Allowed)
+	}
+	assert.True(t, server.Exists("hier:___org__:acme"))
+
+	response, err = limiter.IsAllowed(acme, "alice", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed, "acme's budget is untouched")
+
+	deleted, err := limiter.ResetPrefix(context.Background(), "_")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.True(t, server.Exists("hier:__org__:acme"), "prefix resets keep organization buckets")
+}
+
+func TestHierarchicalConstructor(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	constructor := &HierarchicalConstructor{}
+
+	_, err := constructor.NewFromConfig(map[string]interface{}{
+		"key_prefix":               "test:hier",
+		"bucket_size":              int64(10),
+		"refill_rate_per_second":   int64(1),
+		"organization_bucket_size": int64(100),
+	}, client)
+	assert.ErrorContains(t, err, "organization")
+
+	limiter, err := constructor.NewFromConfig(map[string]interface{}{
+		"key_prefix":             "test:hier",
+		"bucket_size":            int64(10),
+		"refill_rate_per_second": int64(1),
+	}, client)
+	require.NoError(t, err)
+	assert.IsType(t, &HierarchicalRateLimiter{}, limiter)
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// HousekeepingJob is background work over shared state, such as scanning
+// or purging keys, that needs doing once however many instances run.
+type HousekeepingJob struct {
+	Name     string
+	Interval time.Duration
+	// RunAtStart runs the job straight away rather than after one interval.
+	RunAtStart bool
+	Run        func(ctx context.Context) error
+	// StepDown, if set, runs once this instance stops leading after having
+	// run the job, e.g. to retract a gauge the new leader now reports.
+	StepDown func()
+}
+
+// Housekeeping runs jobs on the leader of its election only. Other
+// instances keep their schedule and skip each run, so a new leader picks
+// the jobs up at their next interval. Without an election, it runs them on
+// every instance.
+type Housekeeping struct {
+	election *LeaderElection
+}
+
+func NewHousekeeping(election *LeaderElection) *Housekeeping {
+	return &Housekeeping{election: election}
+}
+
+// Leading reports whether this instance runs the jobs.
+func (h *Housekeeping) Leading() bool {
+	return h == nil || h.election == nil || h.election.IsLeader()
+}
+
+// Schedule runs job every interval until ctx is cancelled. A nil
+// Housekeeping runs it on this instance regardless.
+func (h *Housekeeping) Schedule(ctx context.Context, job HousekeepingJob) {
+	go func() {
+		ticker := time.NewTicker(job.Interval)
+		defer ticker.Stop()
+
+		run := job.RunAtStart
+		ran := false
+		for {
+			if run {
+				leading := h.Leading()
+				if leading {
+					if err := job.Run(ctx); err != nil && ctx.Err() == nil {
+						slog.Error("housekeeping job failed", "job", job.Name, "error", err)
+					}
+				} else if ran && job.StepDown != nil {
+					job.StepDown()
+				}
+				ran = leading
+			}
+			run = true
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
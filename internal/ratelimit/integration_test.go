@@ -0,0 +1,263 @@
+//go:build integration
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// integrationRedis returns a client for REDIS_ADDR when set, otherwise for an
+// in-process miniredis. The miniredis server is nil against real Redis.
+func integrationRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		client := redis.NewClient(&redis.Options{Addr: addr})
+		require.NoError(t, client.Ping(context.Background()).Err())
+		t.Cleanup(func() { client.Close() })
+		return client, nil
+	}
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+// assertExpires checks that redisKey expires within maxTTL and, on miniredis,
+// that it is actually gone once that time has passed.
+func assertExpires(t *testing.T, client *redis.Client, server *miniredis.Miniredis, redisKey string, maxTTL time.Duration) {
+	t.Helper()
+	ctx := context.Background()
+
+	ttl, err := client.TTL(ctx, redisKey).Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0))
+	assert.LessOrEqual(t, ttl, maxTTL)
+
+	if server == nil {
+		return
+	}
+	server.FastForward(maxTTL + time.Second)
+	exists, err := client.Exists(ctx, redisKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+}
+
+func TestIntegration_TokenBucket(t *testing.T) {
+	client, server := integrationRedis(t)
+	ctx := context.Background()
+	key := "client-" + time.Now().Format("150405.000000000")
+
+	limiter, err := NewTokenBucketRateLimiter(TokenBucketConfig{
+		BucketSize:          3,
+		RefillRatePerSecond: 1,
+		KeyPrefix:           "it:tb",
+		TTLBufferSeconds:    5,
+	}, client)
+	require.NoError(t, err)
+	t.Cleanup(func() { limiter.Reset(ctx, key) })
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		response, err := limiter.IsAllowed(ctx, key, now)
+		require.NoError(t, err)
+		assert.True(t, response.Allowed, "request %d", i+1)
+		assert.Equal(t, int64(2-i), response.Remaining)
+	}
+
+	response, err := limiter.IsAllowed(ctx, key, now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	require.NotNil(t, response.RetryAfter)
+	assert.InDelta(t, time.Second.Seconds(), response.RetryAfter.Seconds(), 0.01)
+
+	response, err = limiter.IsAllowed(ctx, key, now.Add(time.Second))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed, "one token refills after a second")
+
+	require.NoError(t, limiter.Reset(ctx, key))
+	response, err = limiter.IsAllowed(ctx, key, now.Add(time.Second))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(2), response.Remaining)
+
+	assertExpires(t, client, server, "it:tb:"+key, time.Duration(MinimumTTLSeconds)*time.Second)
+}
+
+func TestIntegration_SlidingWindowLog(t *testing.T) {
+	client, server := integrationRedis(t)
+	ctx := context.Background()
+	key := "client-" + time.Now().Format("150405.000000000")
+
+	limiter, err := NewSlidingWindowLogRateLimiter(SlidingWindowLogConfig{
+		WindowSize:       10 * time.Second,
+		BucketSize:       2,
+		KeyPrefix:        "it:swl",
+		TTLBufferSeconds: 5,
+	}, client)
+	require.NoError(t, err)
+	t.Cleanup(func() { limiter.Reset(ctx, key) })
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		response, err := limiter.IsAllowed(ctx, key, now.Add(time.Duration(i)*time.Second))
+		require.NoError(t, err)
+		assert.True(t, response.Allowed)
+	}
+
+	response, err := limiter.IsAllowed(ctx, key, now.Add(5*time.Second))
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+
+	response, err = limiter.IsAllowed(ctx, key, now.Add(10*time.Second+time.Millisecond))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed, "the oldest entry slides out of the window")
+
+	response, err = limiter.IsAllowed(ctx, key, now.Add(10*time.Second+2*time.Millisecond))
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+
+	require.NoError(t, limiter.Reset(ctx, key))
+	response, err = limiter.IsAllowed(ctx, key, now.Add(10*time.Second+3*time.Millisecond))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+
+	assertExpires(t, client, server, "it:swl:"+key, 15*time.Second)
+}
+
+func TestIntegration_SlidingWindowCounter(t *testing.T) {
+	client, server := integrationRedis(t)
+	ctx := context.Background()
+	key := "client-" + time.Now().Format("150405.000000000")
+	window := 10 * time.Second
+
+	limiter, err := NewSlidingWindowCounterRateLimiter(SlidingWindowCounterConfig{
+		WindowSize:       window,
+		BucketSize:       4,
+		KeyPrefix:        "it:swc",
+		TTLBufferSeconds: 5,
+	}, client)
+	require.NoError(t, err)
+	t.Cleanup(func() { limiter.Reset(ctx, key) })
+
+	windowStart := time.Now().Truncate(window).Add(window)
+	for i := 0; i < 4; i++ {
+		response, err := limiter.IsAllowed(ctx, key, windowStart.Add(time.Second))
+		require.NoError(t, err)
+		assert.True(t, response.Allowed)
+	}
+
+	response, err := limiter.IsAllowed(ctx, key, windowStart.Add(time.Second))
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+
+	// Half way into the next window the previous count weighs 4 * 0.5 = 2.
+	next := windowStart.Add(window + window/2)
+	for i := 0; i < 2; i++ {
+		response, err = limiter.IsAllowed(ctx, key, next)
+		require.NoError(t, err)
+		assert.True(t, response.Allowed, "request %d after rollover", i+1)
+	}
+	response, err = limiter.IsAllowed(ctx, key, next)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+
+	// Two windows later nothing carries over.
+	response, err = limiter.IsAllowed(ctx, key, windowStart.Add(3*window))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(3), response.Remaining)
+
+	assertExpires(t, client, server, "it:swc:"+key+":current", 25*time.Second)
+}
+
+func TestIntegration_Quota(t *testing.T) {
+	client, server := integrationRedis(t)
+	ctx := context.Background()
+	key := "client-" + time.Now().Format("150405.000000000")
+
+	limiter, err := NewQuotaRateLimiter(QuotaConfig{
+		Period:           QuotaPeriodDaily,
+		Limit:            2,
+		KeyPrefix:        "it:quota",
+		TTLBufferSeconds: 5,
+	}, client)
+	require.NoError(t, err)
+	t.Cleanup(func() { limiter.Reset(ctx, key) })
+
+	now := time.Now().UTC()
+	for i := 0; i < 2; i++ {
+		response, err := limiter.IsAllowed(ctx, key, now)
+		require.NoError(t, err)
+		assert.True(t, response.Allowed)
+	}
+
+	response, err := limiter.IsAllowed(ctx, key, now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+
+	response, err = limiter.IsAllowed(ctx, key, now.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed, "a new day starts a new quota")
+
+	require.NoError(t, limiter.Reset(ctx, key))
+	response, err = limiter.IsAllowed(ctx, key, now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+
+	periodStart, periodEnd := limiter.periodBounds(now)
+	assertExpires(t, client, server, limiter.periodKey(key, periodStart), time.Until(periodEnd)+5*time.Second)
+}
+
+func TestIntegration_TokenBucketGlobal(t *testing.T) {
+	client, _ := integrationRedis(t)
+	ctx := context.Background()
+	prefix := "it:tbg:" + time.Now().Format("150405.000000000")
+
+	limiter, err := NewTokenBucketRateLimiter(TokenBucketConfig{
+		BucketSize:                2,
+		RefillRatePerSecond:       1,
+		KeyPrefix:                 prefix,
+		TTLBufferSeconds:          5,
+		GlobalBucketSize:          5,
+		GlobalRefillRatePerSecond: 1,
+	}, client)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Del(ctx, prefix+":"+GlobalBucketKey) })
+
+	now := time.Now()
+	results := make(chan RateLimitResponse, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, err := limiter.IsAllowed(ctx, fmt.Sprintf("client-%d", i), now)
+			assert.NoError(t, err)
+			results <- response
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	allowed := 0
+	for response := range results {
+		if response.Allowed {
+			allowed++
+		} else {
+			assert.Equal(t, "global", response.Metadata.Value("limited_by"))
+		}
+	}
+	assert.Equal(t, 5, allowed, "concurrent clients can't exceed the global bucket")
+}
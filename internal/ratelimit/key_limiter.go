@@ -0,0 +1,300 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// KeyLimiter binds a RateLimiter to one key and offers the API of
+// golang.org/x/time/rate's Limiter, so code written against it can share a
+// limit across processes by swapping the limiter:
+//
+//	limiter := ratelimit.NewKeyLimiter(policy, "outbound:payments")
+//	if err := limiter.Wait(ctx); err != nil {
+//		return err
+//	}
+//
+// Allow and Reserve take no context and return no error, like their x/time/rate
+// counterparts. They call the limiter with a timeout of WithTimeout and treat
+// errors as denials, or as grants WithFailOpen.
+type KeyLimiter struct {
+	rateLimiter RateLimiter
+	key         string
+	timeout     time.Duration
+	failOpen    bool
+}
+
+var (
+	ErrWaitExceedsLimit    = errors.New("rate: wait(n) exceeds limit")
+	ErrWaitExceedsDeadline = errors.New("rate: wait(n) would exceed context deadline")
+)
+
+func NewKeyLimiter(rateLimiter RateLimiter, key string) *KeyLimiter {
+	return &KeyLimiter{rateLimiter: rateLimiter, key: key, timeout: DefaultKeyLimiterTimeout}
+}
+
+// WithTimeout bounds the calls made by Allow and Reserve.
+func (l *KeyLimiter) WithTimeout(timeout time.Duration) *KeyLimiter {
+	if timeout > 0 {
+		l.timeout = timeout
+	}
+	return l
+}
+
+// WithFailOpen makes Allow and Reserve grant requests while the limiter fails.
+func (l *KeyLimiter) WithFailOpen(failOpen bool) *KeyLimiter {
+	l.failOpen = failOpen
+	return l
+}
+
+func (l *KeyLimiter) Allow() bool {
+	return l.AllowN(time.Now(), 1)
+}
+
+// AllowN reports whether n requests may happen at t, consuming them if so.
+// Either all n are granted or none.
+func (l *KeyLimiter) AllowN(t time.Time, n int) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	allowed, _, err := l.decide(ctx, int64(n), t)
+	if err != nil {
+		slog.Error("key limiter failed", "key", l.key, "error", err, "fail_open", l.failOpen)
+		return l.failOpen
+	}
+	return allowed
+}
+
+func (l *KeyLimiter) decide(ctx context.Context, n int64, t time.Time) (bool, *time.Duration, error) {
+	response, err := TakeN(ctx, l.rateLimiter, l.key, n, t)
+	if err != nil {
+		return false, nil, err
+	}
+	return response.Allowed, response.RetryAfter, nil
+}
+
+// TakeN consumes n requests for key at t, all or nothing, for callers that
+// charge a variable cost per request. Batch limiters are asked through
+// AllowN, the way wrappers such as a quarantine or a latency budget decide
+// requests, and have any part of n they granted refunded. Limiters that can
+// only reserve are asked for a reservation that may not wait. Other limiters
+// can only take one request at a time and fail with ErrBatchNotSupported.
+func TakeN(ctx context.Context, rateLimiter RateLimiter, key string, n int64, t time.Time) (RateLimitResponse, error) {
+	if n <= 0 {
+		return RateLimitResponse{Allowed: true}, nil
+	}
+	if n == 1 {
+		return rateLimiter.IsAllowed(ctx, key, t)
+	}
+
+	batcher, ok := rateLimiter.(BatchRateLimiter)
+	if !ok || !SupportsBatch(rateLimiter) {
+		if reserver, ok := rateLimiter.(Reserver); ok && SupportsReserve(rateLimiter) {
+			reservation, err := reserver.ReserveN(ctx, key, n, t, 0)
+			if err != nil {
+				return RateLimitResponse{}, err
+			}
+			return reservation.RateLimitResponse, nil
+		}
+		return RateLimitResponse{}, ErrBatchNotSupported
+	}
+	granted, response, err := batcher.AllowN(ctx, key, n, t)
+	if err != nil {
+		return RateLimitResponse{}, err
+	}
+	response.Allowed = granted == n
+	if response.Allowed || granted == 0 {
+		return response, nil
+	}
+
+	refunder, ok := rateLimiter.(Refunder)
+	if !ok || !SupportsRefund(rateLimiter) {
+		return RateLimitResponse{}, ErrRefundNotSupported
+	}
+	if err := refunder.Refund(ctx, key, granted, t); err != nil {
+		return RateLimitResponse{}, err
+	}
+	response.Remaining += granted
+	return response, nil
+}
+
+func (l *KeyLimiter) refund(ctx context.Context, n int64, t time.Time) error {
+	refunder, ok := l.rateLimiter.(Refunder)
+	if !ok || !SupportsRefund(l.rateLimiter) {
+		return ErrRefundNotSupported
+	}
+	return refunder.Refund(ctx, l.key, n, t)
+}
+
+// KeyReservation is the x/time/rate Reservation of a KeyLimiter.
+type KeyReservation struct {
+	limiter *KeyLimiter
+	ok      bool
+	n       int64
+	// timeToAct is when the reserved requests may proceed.
+	timeToAct time.Time
+	// reservedAt is the timestamp the reservation was charged at, which a
+	// refund must use.
+	reservedAt time.Time
+	canceled   bool
+	// overLimit is set when n is more than the limit ever allows.
+	overLimit bool
+}
+
+func (l *KeyLimiter) Reserve() *KeyReservation {
+	return l.ReserveN(time.Now(), 1)
+}
+
+// ReserveN reserves n requests at t, however long they have to wait. The
+// limiter must implement Reserver; otherwise, and when it fails, the
+// reservation is not OK, unless WithFailOpen makes it one without delay.
+func (l *KeyLimiter) ReserveN(t time.Time, n int) *KeyReservation {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	reservation, err := l.reserve(ctx, int64(n), t, time.Duration(math.MaxInt64))
+	if err != nil {
+		slog.Error("key limiter failed", "key", l.key, "error", err, "fail_open", l.failOpen)
+		return &KeyReservation{limiter: l, ok: l.failOpen, timeToAct: t, reservedAt: t, canceled: true}
+	}
+	return reservation
+}
+
+func (l *KeyLimiter) reserve(ctx context.Context, n int64, t time.Time, maxDelay time.Duration) (*KeyReservation, error) {
+	reserver, ok := l.rateLimiter.(Reserver)
+	if !ok || !SupportsReserve(l.rateLimiter) {
+		return nil, ErrReserveNotSupported
+	}
+
+	reservation, err := reserver.ReserveN(ctx, l.key, n, t, maxDelay)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyReservation{
+		limiter:    l,
+		ok:         reservation.Allowed,
+		n:          n,
+		timeToAct:  t.Add(reservation.Delay),
+		reservedAt: t,
+		// Bypassed reservations charged nothing to give back.
+		canceled:  !reservation.Allowed || reservation.Bypassed,
+		overLimit: !reservation.Allowed && reservation.RetryAfter == nil,
+	}, nil
+}
+
+// OK reports whether the requests were reserved. Requests over the limit
+// can never be.
+func (r *KeyReservation) OK() bool {
+	return r.ok
+}
+
+func (r *KeyReservation) Delay() time.Duration {
+	return r.DelayFrom(time.Now())
+}
+
+// DelayFrom returns how long after t the reserved requests may proceed, or
+// an infinite duration when the reservation is not OK.
+func (r *KeyReservation) DelayFrom(t time.Time) time.Duration {
+	if !r.ok {
+		return time.Duration(math.MaxInt64)
+	}
+	if delay := r.timeToAct.Sub(t); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+func (r *KeyReservation) Cancel() {
+	r.CancelAt(time.Now())
+}
+
+// CancelAt hands the reserved requests back, if they have not been acted on
+// by t, so others can use them. The limiter must implement Refunder.
+func (r *KeyReservation) CancelAt(t time.Time) {
+	if r.canceled || !t.Before(r.timeToAct) {
+		return
+	}
+	r.canceled = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.limiter.timeout)
+	defer cancel()
+	if err := r.limiter.refund(ctx, r.n, r.reservedAt); err != nil {
+		slog.Error("failed to cancel reservation", "key", r.limiter.key, "error", err)
+	}
+}
+
+func (l *KeyLimiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n requests may proceed, ctx is done or it is clear they
+// won't fit before ctx's deadline. Unlike Allow, it returns the limiter's
+// errors. Limiters that can reserve queue the requests; others are polled
+// after each RetryAfter.
+func (l *KeyLimiter) WaitN(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	maxDelay := time.Duration(math.MaxInt64)
+	if deadline, ok := ctx.Deadline(); ok {
+		maxDelay = deadline.Sub(now)
+	}
+
+	if SupportsReserve(l.rateLimiter) {
+		reservation, err := l.reserve(ctx, int64(n), now, maxDelay)
+		if err != nil {
+			return err
+		}
+		if !reservation.OK() {
+			if reservation.overLimit {
+				return fmt.Errorf("%w: n=%d", ErrWaitExceedsLimit, n)
+			}
+			return fmt.Errorf("%w: n=%d", ErrWaitExceedsDeadline, n)
+		}
+		if err := sleepContext(ctx, reservation.DelayFrom(now)); err != nil {
+			reservation.Cancel()
+			return err
+		}
+		return nil
+	}
+
+	for {
+		allowed, retryAfter, err := l.decide(ctx, int64(n), now)
+		if err != nil {
+			return err
+		}
+		if allowed {
+			return nil
+		}
+		if retryAfter == nil {
+			return fmt.Errorf("%w: n=%d", ErrWaitExceedsLimit, n)
+		}
+		if deadline, ok := ctx.Deadline(); ok && now.Add(*retryAfter).After(deadline) {
+			return fmt.Errorf("%w: n=%d", ErrWaitExceedsDeadline, n)
+		}
+		if err := sleepContext(ctx, max(*retryAfter, time.Millisecond)); err != nil {
+			return err
+		}
+		now = time.Now()
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyLimiter_AllowAndReserve(t *testing.T) {
+	client, server := newScriptRedis(t)
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 2, RefillRatePerSecond: 10, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	limiter := NewKeyLimiter(bucket, "outbound")
+
+	now := time.Unix(0, scriptNow)
+	assert.True(t, limiter.AllowN(now, 1))
+	assert.False(t, limiter.AllowN(now, 2), "batches are all or nothing")
+	assert.True(t, limiter.AllowN(now, 1))
+	assert.False(t, limiter.AllowN(now, 1))
+
+	reservation := limiter.ReserveN(now, 1)
+	require.True(t, reservation.OK())
+	assert.Equal(t, 100*time.Millisecond, reservation.DelayFrom(now))
+	assert.Equal(t, "-1", server.HGet("tb:outbound", "tokens"))
+
+	reservation.CancelAt(now)
+	assert.Equal(t, "0", server.HGet("tb:outbound", "tokens"), "cancelling hands the token back")
+	reservation.CancelAt(now)
+	assert.Equal(t, "0", server.HGet("tb:outbound", "tokens"), "only once")
+
+	reservation = limiter.ReserveN(now, 3)
+	assert.False(t, reservation.OK(), "more than the bucket holds")
+	assert.Equal(t, time.Duration(1<<63-1), reservation.DelayFrom(now))
+}
+
+func TestKeyLimiter_Wait(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 1, RefillRatePerSecond: 20, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	limiter := NewKeyLimiter(bucket, "outbound")
+
+	ctx := context.Background()
+	require.NoError(t, limiter.Wait(ctx))
+	start := time.Now()
+	require.NoError(t, limiter.Wait(ctx))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	assert.ErrorIs(t, limiter.WaitN(ctx, 2), ErrWaitExceedsLimit)
+
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, limiter.Wait(short), ErrWaitExceedsDeadline)
+}
+
+func TestKeyLimiter_WaitPollsLimitersWithoutReservations(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	// The log resets on whole seconds, so a 2s window keeps the first retry
+	// at least a second away whenever the test starts.
+	log, err := NewSlidingWindowLogRateLimiter(SlidingWindowLogConfig{WindowSize: 2 * time.Second, BucketSize: 1, KeyPrefix: "swl"}, client)
+	require.NoError(t, err)
+	limiter := NewKeyLimiter(log, "outbound")
+
+	ctx := context.Background()
+	require.NoError(t, limiter.Wait(ctx))
+	assert.False(t, limiter.Allow())
+
+	short, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, limiter.Wait(short), ErrWaitExceedsDeadline)
+
+	start := time.Now()
+	require.NoError(t, limiter.Wait(ctx))
+	assert.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+
+	assert.False(t, limiter.Reserve().OK(), "the log can't reserve")
+	assert.ErrorIs(t, limiter.WaitN(ctx, 2), ErrBatchNotSupported)
+}
+
+func TestKeyLimiter_Errors(t *testing.T) {
+	client, server := newScriptRedis(t)
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 1, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	server.Close()
+
+	limiter := NewKeyLimiter(bucket, "outbound").WithTimeout(100 * time.Millisecond)
+	assert.False(t, limiter.Allow())
+	assert.False(t, limiter.Reserve().OK())
+	assert.Error(t, limiter.Wait(context.Background()))
+
+	limiter.WithFailOpen(true)
+	assert.True(t, limiter.Allow())
+	reservation := limiter.Reserve()
+	assert.True(t, reservation.OK())
+	assert.Zero(t, reservation.Delay())
+}
+
+func TestTakeN_GoesThroughWrappers(t *testing.T) {
+	client, server := newScriptRedis(t)
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 5, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	quarantine := NewQuarantine(testQuarantineConfig, metrics.NewNoopCollector(), nil)
+	limiter := quarantine.Wrap(bucket)
+	now := time.Unix(0, scriptNow)
+
+	response, err := TakeN(context.Background(), limiter, "client", 3, now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(2), response.Remaining)
+
+	for i := 0; i < 3; i++ {
+		quarantine.observe("slow", 2*time.Second, now)
+	}
+	response, err = TakeN(WithNamespace(context.Background(), "slow"), limiter, "client", 2, now)
+	require.NoError(t, err)
+	assert.Equal(t, true, response.Metadata.Value("quarantined"), "costs aren't reserved past the quarantine")
+	assert.Equal(t, []string{"tb:client"}, server.Keys(), "the quarantined namespace stays out of Redis")
+}
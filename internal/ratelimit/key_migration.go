@@ -0,0 +1,269 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// KeyMigration moves the keys under one prefix to another, e.g. after a
+// strategy's key_prefix or a tenant was renamed, keeping their state and
+// TTLs. It renames one SCAN page at a time and paces itself to keysPerSecond
+// so a large move doesn't crowd out the traffic Redis serves.
+type KeyMigration struct {
+	redisClient   *redis.Client
+	prefixes      map[string]string
+	scanCount     int64
+	keysPerSecond float64
+
+	mu      sync.Mutex
+	jobs    map[string]*KeyMigrationJob
+	order   []string
+	running bool
+}
+
+// NewKeyMigration migrates keys under any prefix, or relative to one of
+// prefixes, keyed by a name such as the strategy owning them.
+func NewKeyMigration(redisClient *redis.Client, prefixes map[string]string, scanCount int64, keysPerSecond float64) *KeyMigration {
+	if scanCount <= 0 {
+		scanCount = DefaultActiveKeysScanCount
+	}
+	if keysPerSecond <= 0 {
+		keysPerSecond = DefaultKeyMigrationKeysPerSecond
+	}
+
+	return &KeyMigration{
+		redisClient:   redisClient,
+		prefixes:      prefixes,
+		scanCount:     scanCount,
+		keysPerSecond: keysPerSecond,
+		jobs:          make(map[string]*KeyMigrationJob),
+	}
+}
+
+var (
+	ErrInvalidKeyMigration = errors.New("invalid key migration")
+	ErrKeyMigrationRunning = errors.New("a key migration is already running")
+)
+
+type KeyMigrationOptions struct {
+	// Name makes From and To relative to the key prefix called Name; empty
+	// takes them as whole key prefixes, e.g. one no longer configured.
+	Name string
+	From string
+	To   string
+	// Overwrite replaces keys that already exist under To; by default they
+	// are kept and their source is left in place.
+	Overwrite bool
+	// DryRun only counts the keys that would move.
+	DryRun bool
+}
+
+type KeyMigrationResult struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	DryRun  bool   `json:"dry_run"`
+	Scanned int64  `json:"scanned"`
+	Renamed int64  `json:"renamed"`
+	// Existing counts keys left in place because their target existed.
+	Existing int64 `json:"existing"`
+	// Missing counts keys that expired or were deleted since the scan.
+	Missing int64 `json:"missing"`
+}
+
+const (
+	KeyMigrationRunning = "running"
+	KeyMigrationDone    = "done"
+	KeyMigrationFailed  = "failed"
+)
+
+// KeyMigrationJob is a migration started by Start. Result counts the keys
+// moved so far while it runs.
+type KeyMigrationJob struct {
+	ID        string             `json:"id"`
+	State     string             `json:"state"`
+	Error     string             `json:"error,omitempty"`
+	StartedAt time.Time          `json:"started_at"`
+	Result    KeyMigrationResult `json:"result"`
+}
+
+// Start runs Migrate in the background until it finishes or ctx is done,
+// returning the job to look up with Job. Invalid options are reported
+// straight away, and only one migration runs at a time.
+func (m *KeyMigration) Start(ctx context.Context, options KeyMigrationOptions) (KeyMigrationJob, error) {
+	from, to, err := m.resolve(options)
+	if err != nil {
+		return KeyMigrationJob{}, err
+	}
+	id, err := newKeyMigrationID()
+	if err != nil {
+		return KeyMigrationJob{}, err
+	}
+
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return KeyMigrationJob{}, ErrKeyMigrationRunning
+	}
+	m.running = true
+	job := &KeyMigrationJob{
+		ID:        id,
+		State:     KeyMigrationRunning,
+		StartedAt: time.Now(),
+		Result:    KeyMigrationResult{From: from, To: to, DryRun: options.DryRun},
+	}
+	m.jobs[id] = job
+	m.order = append(m.order, id)
+	// Only the newest job can still be running, so the oldest are finished.
+	for len(m.order) > MaxKeyMigrationJobs {
+		delete(m.jobs, m.order[0])
+		m.order = m.order[1:]
+	}
+	started := *job
+	m.mu.Unlock()
+
+	go func() {
+		result, err := m.migrate(ctx, from, to, options, func(result KeyMigrationResult) {
+			m.mu.Lock()
+			job.Result = result
+			m.mu.Unlock()
+		})
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.running = false
+		job.Result = result
+		job.State = KeyMigrationDone
+		if err != nil {
+			job.State = KeyMigrationFailed
+			job.Error = err.Error()
+		}
+	}()
+	return started, nil
+}
+
+// Job returns the state of the job with id, if it is one of the last
+// MaxKeyMigrationJobs started.
+func (m *KeyMigration) Job(id string) (KeyMigrationJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return KeyMigrationJob{}, false
+	}
+	return *job, true
+}
+
+func newKeyMigrationID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Migrate renames every key under From to the same key under To, both
+// ending at a segment boundary, so From "ns:acme" doesn't take in
+// "ns:acme2:" keys. Keys
+// written under From while it runs may be missed, so stop writing them, e.g.
+// by rolling out the new prefix, before migrating, and run it again to catch
+// stragglers. On error, the result counts what was moved before it.
+func (m *KeyMigration) Migrate(ctx context.Context, options KeyMigrationOptions) (KeyMigrationResult, error) {
+	from, to, err := m.resolve(options)
+	if err != nil {
+		return KeyMigrationResult{}, err
+	}
+	return m.migrate(ctx, from, to, options, nil)
+}
+
+// migrate calls progress, if given, after each SCAN page.
+func (m *KeyMigration) migrate(ctx context.Context, from, to string, options KeyMigrationOptions, progress func(KeyMigrationResult)) (KeyMigrationResult, error) {
+	result := KeyMigrationResult{From: from, To: to, DryRun: options.DryRun}
+	overwrite := "0"
+	if options.Overwrite {
+		overwrite = "1"
+	}
+	pattern := globReplacer.Replace(from) + "*"
+
+	var cursor uint64
+	for {
+		keys, next, err := m.redisClient.Scan(ctx, cursor, pattern, m.scanCount).Result()
+		if err != nil {
+			return result, err
+		}
+		keys = removeKeys(keys, []string{ThrottleKey})
+		result.Scanned += int64(len(keys))
+
+		if !options.DryRun && len(keys) > 0 {
+			renames := make([]string, 0, 2*len(keys)+1)
+			for _, key := range keys {
+				renames = append(renames, key, to+strings.TrimPrefix(key, from))
+			}
+			counts, err := keyMigrateScript.Run(ctx, m.redisClient, append(renames, ThrottleKey), overwrite).Int64Slice()
+			if err != nil {
+				return result, err
+			}
+			result.Renamed += counts[0]
+			result.Existing += counts[1]
+			result.Missing += counts[2]
+
+			if err := m.pace(ctx, len(keys)); err != nil {
+				return result, err
+			}
+		}
+
+		if progress != nil {
+			progress(result)
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return result, nil
+		}
+	}
+}
+
+func (m *KeyMigration) resolve(options KeyMigrationOptions) (string, string, error) {
+	from, to := options.From, options.To
+	if options.Name != "" {
+		keyPrefix, ok := m.prefixes[options.Name]
+		if !ok {
+			return "", "", fmt.Errorf("%w: %s", ErrUnknownKeyPrefix, options.Name)
+		}
+		from, to = keyPrefix+":"+from, keyPrefix+":"+to
+	}
+	if !strings.HasSuffix(from, ":") {
+		from += ":"
+	}
+	if !strings.HasSuffix(to, ":") {
+		to += ":"
+	}
+
+	switch {
+	case options.From == "" || options.To == "":
+		return "", "", fmt.Errorf("%w: from and to must not be empty", ErrInvalidKeyMigration)
+	case strings.HasPrefix(to, from) || strings.HasPrefix(from, to):
+		// The renamed keys would be found and renamed again.
+		return "", "", fmt.Errorf("%w: %q and %q overlap", ErrInvalidKeyMigration, from, to)
+	}
+	return from, to, nil
+}
+
+// pace waits as long as renaming keys takes at keysPerSecond.
+func (m *KeyMigration) pace(ctx context.Context, keys int) error {
+	timer := time.NewTimer(time.Duration(float64(keys) / m.keysPerSecond * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyMigration_Migrate(t *testing.T) {
+	ctx := context.Background()
+	client, server := newScriptRedis(t)
+	require.NoError(t, client.HSet(ctx, "rl:tb::ns:acme:alice", "tokens", "3").Err())
+	require.NoError(t, client.Expire(ctx, "rl:tb::ns:acme:alice", time.Minute).Err())
+	require.NoError(t, client.Set(ctx, "rl:tb::ns:acme:bob", "old", 0).Err())
+	require.NoError(t, client.Set(ctx, "rl:tb::ns:acme-corp:bob", "new", 0).Err())
+	require.NoError(t, client.Set(ctx, "rl:tb::ns:other:carol", "1", 0).Err())
+	require.NoError(t, client.Set(ctx, "rl:tb::ns:acme2:dave", "1", 0).Err())
+
+	migration := NewKeyMigration(client, transferPrefixes, 1, 1e6)
+	options := KeyMigrationOptions{Name: "token_bucket", From: "ns:acme", To: "ns:acme-corp", DryRun: true}
+
+	result, err := migration.Migrate(ctx, options)
+	require.NoError(t, err)
+	assert.Equal(t, KeyMigrationResult{From: "rl:tb::ns:acme:", To: "rl:tb::ns:acme-corp:", DryRun: true, Scanned: 2}, result)
+	assert.True(t, server.Exists("rl:tb::ns:acme:alice"), "a dry run moves nothing")
+
+	options.DryRun = false
+	result, err = migration.Migrate(ctx, options)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Renamed)
+	assert.Equal(t, int64(1), result.Existing)
+	assert.Equal(t, "3", server.HGet("rl:tb::ns:acme-corp:alice", "tokens"))
+	assert.Equal(t, time.Minute, server.TTL("rl:tb::ns:acme-corp:alice"), "the TTL moves with the key")
+	assert.False(t, server.Exists("rl:tb::ns:acme:alice"))
+	assert.True(t, server.Exists("rl:tb::ns:acme:bob"), "a key whose target exists stays")
+	assert.True(t, server.Exists("rl:tb::ns:other:carol"))
+	assert.True(t, server.Exists("rl:tb::ns:acme2:dave"), "only whole segments match")
+
+	options.Overwrite = true
+	result, err = migration.Migrate(ctx, options)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Renamed)
+	bob, err := client.Get(ctx, "rl:tb::ns:acme-corp:bob").Result()
+	require.NoError(t, err)
+	assert.Equal(t, "old", bob)
+}
+
+func TestKeyMigration_Invalid(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	migration := NewKeyMigration(client, transferPrefixes, 10, 1e6)
+
+	_, err := migration.Migrate(context.Background(), KeyMigrationOptions{From: "rl:tb:", To: "rl:tb:v2:"})
+	assert.ErrorIs(t, err, ErrInvalidKeyMigration, "renamed keys would be renamed again")
+
+	_, err = migration.Migrate(context.Background(), KeyMigrationOptions{From: "rl:tb:"})
+	assert.ErrorIs(t, err, ErrInvalidKeyMigration)
+
+	_, err = migration.Migrate(context.Background(), KeyMigrationOptions{Name: "unknown", From: "a", To: "b"})
+	assert.ErrorIs(t, err, ErrUnknownKeyPrefix)
+}
+
+func TestKeyMigration_Start(t *testing.T) {
+	ctx := context.Background()
+	client, server := newScriptRedis(t)
+	require.NoError(t, client.Set(ctx, "old:alice", "1", 0).Err())
+	migration := NewKeyMigration(client, transferPrefixes, 10, 1e6)
+
+	_, err := migration.Start(ctx, KeyMigrationOptions{From: "old:"})
+	assert.ErrorIs(t, err, ErrInvalidKeyMigration, "invalid options aren't started")
+
+	job, err := migration.Start(ctx, KeyMigrationOptions{From: "old:", To: "new:"})
+	require.NoError(t, err)
+	assert.Equal(t, KeyMigrationRunning, job.State)
+
+	assert.Eventually(t, func() bool {
+		job, ok := migration.Job(job.ID)
+		return ok && job.State == KeyMigrationDone
+	}, time.Second, 10*time.Millisecond)
+	job, _ = migration.Job(job.ID)
+	assert.Equal(t, int64(1), job.Result.Renamed)
+	assert.True(t, server.Exists("new:alice"))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	job, err = migration.Start(cancelled, KeyMigrationOptions{From: "new:", To: "old:"})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		job, _ := migration.Job(job.ID)
+		return job.State == KeyMigrationFailed && job.Error != ""
+	}, time.Second, 10*time.Millisecond)
+}
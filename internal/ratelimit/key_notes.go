@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NoteKeyPrefix prefixes the Redis hashes of the notes left on keys.
+const NoteKeyPrefix = "rl:note:"
+
+var ErrEmptyNote = errors.New("note text is required")
+
+// KeyNote is a note support left on a key, e.g. "customer X, raised limit
+// until Friday per ticket 123", so whoever looks at the key next knows why
+// it is treated differently.
+type KeyNote struct {
+	Text      string     `json:"text"`
+	Author    string     `json:"author,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// KeyNotes stores the notes left on keys. Notes stand on their own: a key
+// can have one whether or not it is blocked or has state under any policy,
+// and requests never read them.
+type KeyNotes struct {
+	redisClient *redis.Client
+}
+
+func NewKeyNotes(redisClient *redis.Client) *KeyNotes {
+	return &KeyNotes{redisClient: redisClient}
+}
+
+// Set leaves note on key, in ctx's namespace, replacing any note already
+// there. A positive ttl removes it once it no longer applies.
+func (n *KeyNotes) Set(ctx context.Context, key string, note KeyNote, ttl time.Duration) error {
+	if note.Text == "" {
+		return ErrEmptyNote
+	}
+	if note.CreatedAt.IsZero() {
+		note.CreatedAt = time.Now()
+	}
+
+	noteKey := NoteKeyPrefix + namespacedKey(ctx, key)
+	_, err := n.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, noteKey)
+		pipe.HSet(ctx, noteKey,
+			"text", note.Text,
+			"author", note.Author,
+			"created_at", note.CreatedAt.UnixMilli(),
+		)
+		if ttl > 0 {
+			pipe.PExpire(ctx, noteKey, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Get returns the note left on key, or nil when there is none.
+func (n *KeyNotes) Get(ctx context.Context, key string) (*KeyNote, error) {
+	noteKey := NoteKeyPrefix + namespacedKey(ctx, key)
+	var fields *redis.MapStringStringCmd
+	var ttl *redis.DurationCmd
+	_, err := n.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		fields = pipe.HGetAll(ctx, noteKey)
+		ttl = pipe.PTTL(ctx, noteKey)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(fields.Val()) == 0 {
+		return nil, nil
+	}
+
+	createdAt, _ := strconv.ParseInt(fields.Val()["created_at"], 10, 64)
+	note := &KeyNote{
+		Text:      fields.Val()["text"],
+		Author:    fields.Val()["author"],
+		CreatedAt: time.UnixMilli(createdAt),
+	}
+	if ttl.Val() > 0 {
+		expiresAt := time.Now().Add(ttl.Val())
+		note.ExpiresAt = &expiresAt
+	}
+	return note, nil
+}
+
+// Clear removes the note left on key.
+func (n *KeyNotes) Clear(ctx context.Context, key string) error {
+	return n.redisClient.Del(ctx, NoteKeyPrefix+namespacedKey(ctx, key)).Err()
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyNotes(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := WithNamespace(context.Background(), "tenant")
+	notes := NewKeyNotes(client)
+
+	assert.ErrorIs(t, notes.Set(ctx, "client", KeyNote{}, 0), ErrEmptyNote)
+	note, err := notes.Get(ctx, "client")
+	require.NoError(t, err)
+	assert.Nil(t, note)
+
+	createdAt := time.UnixMilli(time.Now().UnixMilli())
+	require.NoError(t, notes.Set(ctx, "client", KeyNote{Text: "trial account", Author: "alice", CreatedAt: createdAt}, 0))
+	require.NoError(t, notes.Set(ctx, "client", KeyNote{Text: "raised limit per ticket 123", CreatedAt: createdAt}, time.Hour))
+	assert.Equal(t, time.Hour, server.TTL(NoteKeyPrefix+"ns:tenant:client"))
+
+	note, err = notes.Get(ctx, "client")
+	require.NoError(t, err)
+	require.NotNil(t, note)
+	assert.Equal(t, "raised limit per ticket 123", note.Text)
+	assert.Empty(t, note.Author, "a new note replaces the old one")
+	assert.True(t, createdAt.Equal(note.CreatedAt))
+	require.NotNil(t, note.ExpiresAt)
+
+	other, err := notes.Get(context.Background(), "client")
+	require.NoError(t, err)
+	assert.Nil(t, other, "notes are kept per namespace")
+
+	state, err := NewPenaltyBox(client).Get(ctx, "client")
+	require.NoError(t, err)
+	assert.False(t, state.Active, "a note doesn't block the key")
+
+	require.NoError(t, notes.Clear(ctx, "client"))
+	note, err = notes.Get(ctx, "client")
+	require.NoError(t, err)
+	assert.Nil(t, note)
+}
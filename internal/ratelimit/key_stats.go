@@ -0,0 +1,43 @@
+package ratelimit
+
+import "time"
+
+// KeyStats are rolling statistics of one key, kept in the Redis hash its
+// strategy already updates on every decision. Requests and Denied cover the
+// last stats window, with the previous window weighted by how much of it
+// still overlaps. FirstSeen is when the key's state was created, so it starts
+// over once an idle key expires.
+type KeyStats struct {
+	Requests  int64     `json:"requests"`
+	Denied    int64     `json:"denied"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// keyStatsRecorder is implemented by strategies whose scripts can keep key
+// statistics in their hash.
+type keyStatsRecorder interface {
+	setKeyStats(window time.Duration)
+}
+
+// keyStatsFromResult reads the requests, denials and first seen time a
+// script appended from index on, or nil when it didn't, e.g. with key stats
+// off.
+func keyStatsFromResult(resultArray []interface{}, index int) *KeyStats {
+	if len(resultArray) < index+3 {
+		return nil
+	}
+
+	var values [3]int64
+	for i := range values {
+		value, err := getInt64FromResult(resultArray[index+i])
+		if err != nil {
+			return nil
+		}
+		values[i] = value
+	}
+	return &KeyStats{
+		Requests:  values[0],
+		Denied:    values[1],
+		FirstSeen: time.UnixMilli(values[2]),
+	}
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyStats_TokenBucket(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newScriptRedis(t)
+
+	rateLimiter, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 2, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+
+	now := time.Unix(0, scriptNow)
+	response, err := rateLimiter.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.Nil(t, response.Stats, "stats are off unless enabled")
+
+	rateLimiter.setKeyStats(time.Minute)
+	for i := 0; i < 2; i++ {
+		response, err = rateLimiter.IsAllowed(ctx, "client", now)
+		require.NoError(t, err)
+	}
+	assert.False(t, response.Allowed)
+	require.NotNil(t, response.Stats)
+	assert.Equal(t, KeyStats{Requests: 2, Denied: 1, FirstSeen: time.UnixMilli(now.UnixMilli())}, *response.Stats)
+
+	// Two windows later nothing overlaps any more, but the key is still known.
+	later := now.Add(2 * time.Minute)
+	response, err = rateLimiter.IsAllowed(ctx, "client", later)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, KeyStats{Requests: 1, Denied: 0, FirstSeen: time.UnixMilli(now.UnixMilli())}, *response.Stats)
+}
+
+func TestKeyStats_TokenBucketGlobal(t *testing.T) {
+	ctx := context.Background()
+	client, server := newScriptRedis(t)
+
+	rateLimiter, err := NewTokenBucketRateLimiter(TokenBucketConfig{
+		BucketSize: 5, RefillRatePerSecond: 1, GlobalBucketSize: 2, GlobalRefillRatePerSecond: 0.5, KeyPrefix: "tb",
+	}, client)
+	require.NoError(t, err)
+	rateLimiter.setKeyStats(time.Minute)
+
+	now := time.Unix(0, scriptNow)
+	var response RateLimitResponse
+	for i := 0; i < 3; i++ {
+		response, err = rateLimiter.IsAllowed(ctx, "client", now)
+		require.NoError(t, err)
+	}
+	assert.False(t, response.Allowed)
+	limitedBy, _ := response.Metadata.Get("limited_by")
+	assert.Equal(t, "global", limitedBy)
+	assert.Equal(t, now.Add(2*time.Second), response.ResetTime, "the global bucket refills a token every 2s")
+	require.NotNil(t, response.Stats)
+	assert.Equal(t, KeyStats{Requests: 3, Denied: 1, FirstSeen: time.UnixMilli(now.UnixMilli())}, *response.Stats)
+	assert.Equal(t, "3", server.HGet("tb:client", "stats_requests"))
+}
+
+func TestKeyStats_SlidingWindowCounter(t *testing.T) {
+	ctx := context.Background()
+	client, server := newScriptRedis(t)
+
+	rateLimiter, err := NewSlidingWindowCounterRateLimiter(SlidingWindowCounterConfig{WindowSize: 10 * time.Second, BucketSize: 1, KeyPrefix: "swc"}, client)
+	require.NoError(t, err)
+	rateLimiter.setKeyStats(time.Minute)
+
+	now := time.Unix(0, scriptNow)
+	var response RateLimitResponse
+	for i := 0; i < 3; i++ {
+		response, err = rateLimiter.IsAllowed(ctx, "client", now)
+		require.NoError(t, err)
+	}
+	assert.False(t, response.Allowed)
+	require.NotNil(t, response.Stats)
+	assert.Equal(t, KeyStats{Requests: 3, Denied: 2, FirstSeen: time.UnixMilli(now.UnixMilli())}, *response.Stats)
+	assert.Equal(t, "3", server.HGet("swc:client:current", "stats_requests"))
+}
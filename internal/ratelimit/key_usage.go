@@ -0,0 +1,233 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// KeyUsage reports how many Redis keys each prefix holds and roughly how much
+// memory they take, for capacity planning on a shared Redis, and purges keys
+// left idle for long.
+type KeyUsage struct {
+	replicaReads
+	redisClient *redis.Client
+	prefixes    map[string]string
+	scanCount   int64
+	sampleSize  int64
+}
+
+// NewKeyUsage reports on the keys under each of prefixes, keyed by a name
+// such as the strategy owning them. MEMORY USAGE is sampled on up to
+// sampleSize keys per prefix and extrapolated to the rest.
+func NewKeyUsage(redisClient *redis.Client, prefixes map[string]string, scanCount int64, sampleSize int64) *KeyUsage {
+	if scanCount <= 0 {
+		scanCount = DefaultActiveKeysScanCount
+	}
+	if sampleSize < 0 {
+		sampleSize = 0
+	}
+
+	return &KeyUsage{
+		redisClient: redisClient,
+		prefixes:    prefixes,
+		scanCount:   scanCount,
+		sampleSize:  sampleSize,
+	}
+}
+
+// WithReadClient scans and inspects the keys through client, typically a
+// replica. Purges still go to the primary, which rechecks each key's idle
+// time before deleting it.
+func (k *KeyUsage) WithReadClient(client *redis.Client) *KeyUsage {
+	k.setReadClient(client)
+	return k
+}
+
+var ErrUnknownKeyPrefix = errors.New("unknown key prefix")
+
+type KeyUsageOptions struct {
+	// Name limits the report to one prefix; empty reports all of them.
+	Name string
+	// IdleThreshold counts keys without a TTL unused for at least this long
+	// as idle; zero skips the idle check.
+	IdleThreshold time.Duration
+	// Purge deletes the idle keys.
+	Purge bool
+}
+
+type PrefixUsage struct {
+	Name           string `json:"name"`
+	Prefix         string `json:"prefix"`
+	Keys           int64  `json:"keys"`
+	KeysWithoutTTL int64  `json:"keys_without_ttl"`
+	SampledKeys    int64  `json:"sampled_keys"`
+	SampledBytes   int64  `json:"sampled_bytes"`
+	EstimatedBytes int64  `json:"estimated_bytes"`
+	IdleKeys       int64  `json:"idle_keys"`
+	PurgedKeys     int64  `json:"purged_keys"`
+}
+
+type KeyUsageReport struct {
+	IdleThresholdSeconds int64         `json:"idle_threshold_seconds"`
+	Purged               bool          `json:"purged"`
+	TotalKeys            int64         `json:"total_keys"`
+	EstimatedBytes       int64         `json:"estimated_bytes"`
+	Prefixes             []PrefixUsage `json:"prefixes"`
+}
+
+// Report scans the keys of every prefix, or only options.Name. The scan
+// walks the whole keyspace, so it is meant for occasional admin use.
+func (k *KeyUsage) Report(ctx context.Context, options KeyUsageOptions) (KeyUsageReport, error) {
+	names := make([]string, 0, len(k.prefixes))
+	for name := range k.prefixes {
+		if options.Name == "" || options.Name == name {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return KeyUsageReport{}, fmt.Errorf("%w: %s", ErrUnknownKeyPrefix, options.Name)
+	}
+	sort.Strings(names)
+
+	report := KeyUsageReport{
+		IdleThresholdSeconds: int64(options.IdleThreshold.Seconds()),
+		Purged:               options.Purge && options.IdleThreshold > 0,
+		Prefixes:             make([]PrefixUsage, 0, len(names)),
+	}
+	for _, name := range names {
+		usage, err := k.prefixUsage(ctx, name, options)
+		if err != nil {
+			return KeyUsageReport{}, fmt.Errorf("prefix %s: %w", name, err)
+		}
+		report.TotalKeys += usage.Keys
+		report.EstimatedBytes += usage.EstimatedBytes
+		report.Prefixes = append(report.Prefixes, usage)
+	}
+	return report, nil
+}
+
+func (k *KeyUsage) prefixUsage(ctx context.Context, name string, options KeyUsageOptions) (PrefixUsage, error) {
+	prefix := k.prefixes[name]
+	usage := PrefixUsage{Name: name, Prefix: prefix}
+	idleThresholdSeconds := int64(options.IdleThreshold.Seconds())
+	pattern := globReplacer.Replace(prefix) + "*"
+
+	var cursor uint64
+	for {
+		keys, next, err := k.reader(k.redisClient).Scan(ctx, cursor, pattern, k.scanCount).Result()
+		if err != nil {
+			return usage, err
+		}
+
+		idle, err := k.inspect(ctx, keys, idleThresholdSeconds, &usage)
+		if err != nil {
+			return usage, err
+		}
+		if options.Purge && len(idle) > 0 {
+			purged, err := purgeIdleScript.Run(ctx, k.redisClient, append(idle, ThrottleKey), idleThresholdSeconds).Int64()
+			if err != nil {
+				return usage, err
+			}
+			usage.PurgedKeys += purged
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if usage.SampledKeys > 0 {
+		usage.EstimatedBytes = usage.SampledBytes * usage.Keys / usage.SampledKeys
+	}
+	return usage, nil
+}
+
+// inspect adds one SCAN page to usage and returns the keys without a TTL idle
+// for at least idleThresholdSeconds. OBJECT IDLETIME is read first: unlike Redis, some
+// emulators count TTL lookups as a use.
+func (k *KeyUsage) inspect(ctx context.Context, keys []string, idleThresholdSeconds int64, usage *PrefixUsage) ([]string, error) {
+	idleTimes := make([]*redis.DurationCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	memory := make([]*redis.IntCmd, len(keys))
+
+	pipe := k.reader(k.redisClient).Pipeline()
+	for i, key := range keys {
+		if idleThresholdSeconds > 0 {
+			idleTimes[i] = pipe.ObjectIdleTime(ctx, key)
+		}
+		ttls[i] = pipe.PTTL(ctx, key)
+		if usage.SampledKeys+int64(i) < k.sampleSize {
+			memory[i] = pipe.MemoryUsage(ctx, key)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	var idle []string
+	for i, key := range keys {
+		ttl, err := ttls[i].Result()
+		if err != nil {
+			return nil, err
+		}
+		if ttl == -2 {
+			// Expired or deleted since the scan.
+			continue
+		}
+
+		usage.Keys++
+		if ttl == -1 {
+			usage.KeysWithoutTTL++
+		}
+		if memory[i] != nil {
+			if bytes, err := memory[i].Result(); err == nil {
+				usage.SampledKeys++
+				usage.SampledBytes += bytes
+			}
+		}
+		// Keys with a TTL, such as quota counters, expire on their own when
+		// they should; deleting them early would forget usage.
+		if idleTimes[i] != nil && ttl == -1 {
+			idleTime, err := idleTimes[i].Result()
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if int64(idleTime.Seconds()) >= idleThresholdSeconds {
+				usage.IdleKeys++
+				idle = append(idle, key)
+			}
+		}
+	}
+	return idle, nil
+}
+
+// StartPurge purges the keys idle for at least idleThreshold every interval
+// through housekeeping until ctx is cancelled.
+func (k *KeyUsage) StartPurge(ctx context.Context, housekeeping *Housekeeping, interval time.Duration, idleThreshold time.Duration) {
+	housekeeping.Schedule(ctx, HousekeepingJob{
+		Name:     "idle_key_purge",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			report, err := k.Report(ctx, KeyUsageOptions{IdleThreshold: idleThreshold, Purge: true})
+			if err != nil {
+				return err
+			}
+			for _, usage := range report.Prefixes {
+				if usage.PurgedKeys > 0 {
+					slog.Info("purged idle keys", "prefix", usage.Prefix, "purged", usage.PurgedKeys, "keys", usage.Keys)
+				}
+			}
+			return nil
+		},
+	})
+}
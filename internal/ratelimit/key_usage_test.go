@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyUsage_Report(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := context.Background()
+	start := time.Unix(10000, 0)
+	server.SetTime(start)
+
+	require.NoError(t, client.Set(ctx, "rl:tb::stale", "1", 0).Err())
+	require.NoError(t, client.HSet(ctx, "rl:tb::old", "tokens", 5).Err())
+	server.SetTime(start.Add(2 * time.Hour))
+	require.NoError(t, client.HSet(ctx, "rl:tb::fresh", "tokens", 5).Err())
+	require.NoError(t, client.Expire(ctx, "rl:tb::fresh", time.Hour).Err())
+	require.NoError(t, client.Set(ctx, "rl:quota::fresh", "1", time.Hour).Err())
+	require.NoError(t, client.Set(ctx, "unrelated", "1", 0).Err())
+
+	usage := NewKeyUsage(client, map[string]string{"token_bucket": "rl:tb:", "quota": "rl:quota:"}, 10, 2)
+
+	report, err := usage.Report(ctx, KeyUsageOptions{IdleThreshold: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), report.TotalKeys)
+	require.Len(t, report.Prefixes, 2)
+
+	quota, tokenBucket := report.Prefixes[0], report.Prefixes[1]
+	assert.Equal(t, "quota", quota.Name)
+	assert.Equal(t, int64(1), quota.Keys)
+	assert.Equal(t, int64(0), quota.KeysWithoutTTL)
+	assert.Equal(t, int64(0), quota.IdleKeys)
+
+	assert.Equal(t, "token_bucket", tokenBucket.Name)
+	assert.Equal(t, int64(3), tokenBucket.Keys)
+	assert.Equal(t, int64(2), tokenBucket.KeysWithoutTTL)
+	assert.Equal(t, int64(2), tokenBucket.IdleKeys)
+	assert.Equal(t, int64(0), tokenBucket.PurgedKeys)
+	assert.Equal(t, int64(2), tokenBucket.SampledKeys)
+	assert.Positive(t, tokenBucket.EstimatedBytes)
+	assert.Equal(t, tokenBucket.SampledBytes*3/2, tokenBucket.EstimatedBytes)
+
+	exists, err := client.Exists(ctx, "rl:tb::stale", "rl:tb::old").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), exists, "a report alone deletes nothing")
+}
+
+func TestKeyUsage_Purge(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := context.Background()
+	start := time.Unix(10000, 0)
+	server.SetTime(start)
+
+	require.NoError(t, client.Set(ctx, "rl:tb::stale", "1", 0).Err())
+	require.NoError(t, client.Set(ctx, "rl:quota::stale", "1", 0).Err())
+	server.SetTime(start.Add(2 * time.Hour))
+	require.NoError(t, client.Set(ctx, "rl:tb::fresh", "1", 0).Err())
+
+	usage := NewKeyUsage(client, map[string]string{"token_bucket": "rl:tb:", "quota": "rl:quota:"}, 10, 0)
+
+	report, err := usage.Report(ctx, KeyUsageOptions{Name: "token_bucket", IdleThreshold: time.Hour, Purge: true})
+	require.NoError(t, err)
+	assert.True(t, report.Purged)
+	require.Len(t, report.Prefixes, 1)
+	assert.Equal(t, int64(1), report.Prefixes[0].PurgedKeys)
+	assert.Equal(t, int64(0), report.Prefixes[0].SampledKeys)
+
+	keys, err := client.Keys(ctx, "*").Result()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"rl:tb::fresh", "rl:quota::stale"}, keys)
+
+	_, err = usage.Report(ctx, KeyUsageOptions{Name: "sliding_window_log"})
+	assert.ErrorIs(t, err, ErrUnknownKeyPrefix)
+}
+
+func TestKeyUsage_PurgeKeepsKeysWithTTL(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := context.Background()
+	start := time.Unix(10000, 0)
+	server.SetTime(start)
+
+	// A monthly quota counter that sees no traffic for a week.
+	require.NoError(t, client.Set(ctx, "rl:quota::customer", "42", 30*24*time.Hour).Err())
+	server.SetTime(start.Add(7 * 24 * time.Hour))
+
+	usage := NewKeyUsage(client, map[string]string{"quota": "rl:quota:"}, 10, 0)
+	report, err := usage.Report(ctx, KeyUsageOptions{IdleThreshold: time.Hour, Purge: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), report.Prefixes[0].IdleKeys)
+	assert.Equal(t, int64(0), report.Prefixes[0].PurgedKeys)
+
+	// The script checks the TTL too, in case one was set since the scan.
+	purged, err := purgeIdleScript.Run(ctx, client, []string{"rl:quota::customer", ThrottleKey}, 1).Int64()
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+	assert.True(t, server.Exists("rl:quota::customer"))
+}
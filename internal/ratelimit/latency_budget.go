@@ -0,0 +1,253 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+)
+
+type LatencyBudgetConfig struct {
+	// Budget is how long a request waits for its check.
+	Budget time.Duration
+	// Timeout bounds a check finishing in the background.
+	Timeout time.Duration
+	// MaxPending caps the checks finishing in the background; requests over
+	// budget beyond it wait for their check instead. Zero uses
+	// DefaultLatencyBudgetMaxPending.
+	MaxPending int
+}
+
+type budgetedDecision struct {
+	granted  int64
+	response RateLimitResponse
+	err      error
+}
+
+// LatencyBudgetRateLimiter bounds the latency a check adds to a request. A
+// check that hasn't finished within the budget lets the request through
+// optimistically. The check carries on in the background and still charges
+// the key, so the counter catches up, and its late decision is counted to
+// show how often optimism let through a request the limiter would have
+// denied. Only IsAllowed and AllowN are budgeted.
+//
+// Optimistic responses are charged like any other, so they can be refunded.
+// A refund waits for the key's checks still finishing in the background, so
+// it isn't given back before it was taken.
+type LatencyBudgetRateLimiter struct {
+	limiter   RateLimiter
+	budget    time.Duration
+	timeout   time.Duration
+	pending   chan struct{}
+	collector metrics.Collector
+
+	mu       sync.Mutex
+	inflight map[string]map[chan struct{}]struct{}
+}
+
+func NewLatencyBudgetRateLimiter(limiter RateLimiter, config LatencyBudgetConfig, collector metrics.Collector) *LatencyBudgetRateLimiter {
+	maxPending := config.MaxPending
+	if maxPending <= 0 {
+		maxPending = DefaultLatencyBudgetMaxPending
+	}
+	return &LatencyBudgetRateLimiter{
+		limiter:   limiter,
+		budget:    config.Budget,
+		timeout:   config.Timeout,
+		pending:   make(chan struct{}, maxPending),
+		collector: collector,
+		inflight:  make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+func (l *LatencyBudgetRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	_, response, err := l.decide(ctx, key, 1, func(ctx context.Context) (int64, RateLimitResponse, error) {
+		response, err := l.limiter.IsAllowed(ctx, key, timestamp)
+		return 1, response, err
+	})
+	return response, err
+}
+
+func (l *LatencyBudgetRateLimiter) AllowN(ctx context.Context, key string, n int64, timestamp time.Time) (int64, RateLimitResponse, error) {
+	batcher, ok := l.limiter.(BatchRateLimiter)
+	if !ok {
+		return 0, RateLimitResponse{Err: ErrBatchNotSupported}, ErrBatchNotSupported
+	}
+	return l.decide(ctx, key, n, func(ctx context.Context) (int64, RateLimitResponse, error) {
+		return batcher.AllowN(ctx, key, n, timestamp)
+	})
+}
+
+// decide runs check and waits for it for the budget at most. The check is
+// cancelled with ctx until the request has been let through, and then left
+// to finish within the timeout.
+func (l *LatencyBudgetRateLimiter) decide(ctx context.Context, key string, n int64, check func(ctx context.Context) (int64, RateLimitResponse, error)) (int64, RateLimitResponse, error) {
+	checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), l.timeout)
+	var detached atomic.Bool
+	stop := context.AfterFunc(ctx, func() {
+		if !detached.Load() {
+			cancel()
+		}
+	})
+	done := make(chan budgetedDecision, 1)
+	go func() {
+		defer cancel()
+		defer stop()
+		granted, response, err := check(checkCtx)
+		done <- budgetedDecision{granted: granted, response: response, err: err}
+	}()
+
+	budget := time.NewTimer(l.budget)
+	defer budget.Stop()
+	select {
+	case decision := <-done:
+		return decision.granted, decision.response, decision.err
+	case <-ctx.Done():
+		return 0, RateLimitResponse{Err: ctx.Err()}, ctx.Err()
+	case <-budget.C:
+	}
+
+	select {
+	case l.pending <- struct{}{}:
+	default:
+		// Too many checks are finishing in the background already, so this
+		// one is waited for.
+		select {
+		case decision := <-done:
+			return decision.granted, decision.response, decision.err
+		case <-ctx.Done():
+			return 0, RateLimitResponse{Err: ctx.Err()}, ctx.Err()
+		}
+	}
+	detached.Store(true)
+	key = namespacedKey(ctx, key)
+	finished := l.track(key)
+	go l.reconcile(key, finished, done)
+
+	metadata := Metadata{}
+	metadata.Set("optimistic", true)
+	return n, RateLimitResponse{Allowed: true, Optimistic: true, Metadata: metadata}, nil
+}
+
+// track registers a check of key finishing in the background. The returned
+// channel is closed by reconcile once it has.
+func (l *LatencyBudgetRateLimiter) track(key string) chan struct{} {
+	finished := make(chan struct{})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight[key] == nil {
+		l.inflight[key] = make(map[chan struct{}]struct{})
+	}
+	l.inflight[key][finished] = struct{}{}
+	return finished
+}
+
+// wait waits for the checks of key finishing in the background when it is
+// called.
+func (l *LatencyBudgetRateLimiter) wait(ctx context.Context, key string) error {
+	l.mu.Lock()
+	checks := make([]chan struct{}, 0, len(l.inflight[key]))
+	for finished := range l.inflight[key] {
+		checks = append(checks, finished)
+	}
+	l.mu.Unlock()
+
+	for _, finished := range checks {
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// reconcile waits for a check whose request was let through and counts its
+// decision.
+func (l *LatencyBudgetRateLimiter) reconcile(key string, finished chan struct{}, done <-chan budgetedDecision) {
+	decision := <-done
+	<-l.pending
+	l.mu.Lock()
+	delete(l.inflight[key], finished)
+	if len(l.inflight[key]) == 0 {
+		delete(l.inflight, key)
+	}
+	l.mu.Unlock()
+	close(finished)
+
+	switch {
+	case decision.err != nil:
+		slog.Warn("rate limit check let through over its latency budget failed", "error", decision.err.Error())
+		l.collector.RecordOptimisticAllow(metrics.OptimisticFailed)
+	case !decision.response.Allowed:
+		l.collector.RecordOptimisticAllow(metrics.OptimisticDenied)
+	default:
+		l.collector.RecordOptimisticAllow(metrics.OptimisticAllowed)
+	}
+}
+
+func (l *LatencyBudgetRateLimiter) SupportsBatch() bool {
+	return SupportsBatch(l.limiter)
+}
+
+func (l *LatencyBudgetRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	peeker, ok := l.limiter.(Peeker)
+	if !ok {
+		return RateLimitResponse{Err: ErrPeekNotSupported}, ErrPeekNotSupported
+	}
+	return peeker.Peek(ctx, key, timestamp)
+}
+
+func (l *LatencyBudgetRateLimiter) Reset(ctx context.Context, key string) error {
+	return l.limiter.Reset(ctx, key)
+}
+
+func (l *LatencyBudgetRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	resetter, ok := l.limiter.(PrefixResetter)
+	if !ok {
+		return 0, ErrResetPrefixNotSupported
+	}
+	return resetter.ResetPrefix(ctx, prefix)
+}
+
+// Refund gives back n requests once the checks of key finishing in the
+// background have charged it. A request whose late check was denied was
+// never charged, so refunding it returns capacity the key didn't use, up to
+// its limit.
+func (l *LatencyBudgetRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	refunder, ok := l.limiter.(Refunder)
+	if !ok {
+		return ErrRefundNotSupported
+	}
+	if err := l.wait(ctx, namespacedKey(ctx, key)); err != nil {
+		return err
+	}
+	return refunder.Refund(ctx, key, n, timestamp)
+}
+
+func (l *LatencyBudgetRateLimiter) SupportsRefund() bool {
+	return SupportsRefund(l.limiter)
+}
+
+func (l *LatencyBudgetRateLimiter) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	debtor, ok := l.limiter.(Debtor)
+	if !ok {
+		return ErrDebtNotSupported
+	}
+	return debtor.AddDebt(ctx, key, n, timestamp)
+}
+
+func (l *LatencyBudgetRateLimiter) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error) {
+	reserver, ok := l.limiter.(Reserver)
+	if !ok {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: ErrReserveNotSupported}}, ErrReserveNotSupported
+	}
+	return reserver.ReserveN(ctx, key, n, timestamp, maxDelay)
+}
+
+func (l *LatencyBudgetRateLimiter) SupportsReserve() bool {
+	return SupportsReserve(l.limiter)
+}
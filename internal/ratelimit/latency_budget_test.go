@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// delayedLimiter decides after delay, or fails when its context ends first.
+type delayedLimiter struct {
+	delay    time.Duration
+	response RateLimitResponse
+}
+
+func (d *delayedLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	select {
+	case <-time.After(d.delay):
+		return d.response, nil
+	case <-ctx.Done():
+		return RateLimitResponse{Err: ctx.Err()}, ctx.Err()
+	}
+}
+
+func (d *delayedLimiter) Reset(ctx context.Context, key string) error {
+	return nil
+}
+
+// chargingLimiter is a delayedLimiter logging its charges and refunds.
+type chargingLimiter struct {
+	delayedLimiter
+	mu  sync.Mutex
+	log []string
+}
+
+func (c *chargingLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	response, err := c.delayedLimiter.IsAllowed(ctx, key, timestamp)
+	c.record("charge " + key)
+	return response, err
+}
+
+func (c *chargingLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	c.record("refund " + key)
+	return nil
+}
+
+func (c *chargingLimiter) record(event string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.log = append(c.log, event)
+}
+
+func (c *chargingLimiter) recorded() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.log...)
+}
+
+type optimisticCollector struct {
+	metrics.NoopCollector
+	mu       sync.Mutex
+	outcomes []string
+}
+
+func (o *optimisticCollector) RecordOptimisticAllow(outcome string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.outcomes = append(o.outcomes, outcome)
+}
+
+func (o *optimisticCollector) recorded() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.outcomes...)
+}
+
+func TestLatencyBudgetRateLimiter_WithinBudget(t *testing.T) {
+	inner := &delayedLimiter{response: RateLimitResponse{Allowed: false, Limit: 10}}
+	limiter := NewLatencyBudgetRateLimiter(inner, LatencyBudgetConfig{Budget: time.Second, Timeout: time.Second}, metrics.NewNoopCollector())
+
+	response, err := limiter.IsAllowed(context.Background(), "client", time.Now())
+	require.NoError(t, err)
+	assert.False(t, response.Allowed, "checks within the budget decide")
+	assert.Equal(t, int64(10), response.Limit)
+}
+
+func TestLatencyBudgetRateLimiter_OverBudget(t *testing.T) {
+	inner := &delayedLimiter{delay: 50 * time.Millisecond, response: RateLimitResponse{Allowed: false}}
+	collector := &optimisticCollector{}
+	limiter := NewLatencyBudgetRateLimiter(inner, LatencyBudgetConfig{Budget: time.Millisecond, Timeout: time.Second}, collector)
+
+	start := time.Now()
+	response, err := limiter.IsAllowed(context.Background(), "client", start)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 50*time.Millisecond, "the request doesn't wait for the check")
+	assert.True(t, response.Allowed)
+	assert.True(t, response.Optimistic)
+	assert.False(t, response.Bypassed, "the late check still charges the key")
+	assert.Equal(t, true, response.Metadata.Value("optimistic"))
+
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{metrics.OptimisticDenied}, collector.recorded())
+	}, time.Second, 10*time.Millisecond, "the late decision is counted")
+}
+
+func TestLatencyBudgetRateLimiter_ClientGone(t *testing.T) {
+	inner := &delayedLimiter{delay: time.Second}
+	collector := &optimisticCollector{}
+	limiter := NewLatencyBudgetRateLimiter(inner, LatencyBudgetConfig{Budget: 500 * time.Millisecond, Timeout: time.Second}, collector)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := limiter.IsAllowed(ctx, "client", time.Now())
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, collector.recorded(), "a request gone before its budget isn't let through")
+}
+
+func TestLatencyBudgetRateLimiter_MaxPending(t *testing.T) {
+	inner := &delayedLimiter{delay: 50 * time.Millisecond, response: RateLimitResponse{Allowed: false}}
+	limiter := NewLatencyBudgetRateLimiter(inner, LatencyBudgetConfig{Budget: time.Millisecond, Timeout: time.Second, MaxPending: 1}, metrics.NewNoopCollector())
+
+	response, err := limiter.IsAllowed(context.Background(), "first", time.Now())
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+
+	response, err = limiter.IsAllowed(context.Background(), "second", time.Now())
+	require.NoError(t, err)
+	assert.False(t, response.Allowed, "beyond max pending the check is waited for")
+}
+
+func TestLatencyBudgetRateLimiter_RefundsOptimisticAllows(t *testing.T) {
+	inner := &chargingLimiter{delayedLimiter: delayedLimiter{delay: 50 * time.Millisecond, response: RateLimitResponse{Allowed: true}}}
+	limiter := NewLatencyBudgetRateLimiter(inner, LatencyBudgetConfig{Budget: time.Millisecond, Timeout: time.Second}, metrics.NewNoopCollector())
+
+	response, charge, err := Begin(context.Background(), limiter, "client", time.Now())
+	require.NoError(t, err)
+	assert.True(t, response.Optimistic)
+	require.NotNil(t, charge, "optimistic allows are charged")
+
+	require.NoError(t, charge.Rollback(context.Background()))
+	assert.Equal(t, []string{"charge client", "refund client"}, inner.recorded(), "the refund waits for the late charge")
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LeaderElection elects one instance among those sharing a Redis to run
+// work that should happen once, not once per instance. The leader holds a
+// lease under key, set with NX and a TTL, and extends it a few times per
+// TTL; when it stops, or can't reach Redis for a whole TTL, the lease
+// expires and another instance takes it.
+type LeaderElection struct {
+	redisClient *redis.Client
+	key         string
+	id          string
+	ttl         time.Duration
+	done        chan struct{}
+
+	mu         sync.Mutex
+	leaseUntil time.Time
+}
+
+// NewLeaderElection campaigns for the lease under key with a unique id for
+// this instance.
+func NewLeaderElection(redisClient *redis.Client, key string, ttl time.Duration) (*LeaderElection, error) {
+	if ttl <= 0 {
+		ttl = DefaultLeaderLeaseTTL
+	}
+
+	suffix, err := connectionID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate leader id: %w", err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &LeaderElection{
+		redisClient: redisClient,
+		key:         key,
+		id:          hostname + ":" + suffix[:8],
+		ttl:         ttl,
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// ID identifies this instance in the lease.
+func (e *LeaderElection) ID() string {
+	return e.id
+}
+
+// IsLeader reports whether this instance holds the lease. It turns false as
+// soon as the lease may have expired, even before Redis is reachable again
+// to tell.
+func (e *LeaderElection) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Now().Before(e.leaseUntil)
+}
+
+// Start campaigns until ctx is cancelled, then gives up the lease if held.
+// Done is closed once it has.
+func (e *LeaderElection) Start(ctx context.Context) {
+	go func() {
+		defer close(e.done)
+
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			if err := e.Campaign(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("leader election failed", "key", e.key, "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				e.resign()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (e *LeaderElection) Done() <-chan struct{} {
+	return e.done
+}
+
+// Campaign takes the lease if it is free, or extends it if this instance
+// holds it. On error, leadership lasts until the lease held would expire.
+func (e *LeaderElection) Campaign(ctx context.Context) error {
+	start := time.Now()
+	held, err := leaderLeaseScript.Run(ctx, e.redisClient, []string{e.key, ThrottleKey}, e.id, e.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	wasLeader := start.Before(e.leaseUntil)
+	if held != 1 {
+		e.leaseUntil = time.Time{}
+		if wasLeader {
+			slog.Warn("lost leadership", "key", e.key, "id", e.id)
+		}
+		return nil
+	}
+
+	// The lease was set after start, so it outlives this.
+	e.leaseUntil = start.Add(e.ttl)
+	if !wasLeader {
+		slog.Info("became leader", "key", e.key, "id", e.id)
+	}
+	return nil
+}
+
+// resign gives up the lease so another instance takes over without waiting
+// for it to expire.
+func (e *LeaderElection) resign() {
+	e.mu.Lock()
+	e.leaseUntil = time.Time{}
+	e.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := leaderResignScript.Run(ctx, e.redisClient, []string{e.key, ThrottleKey}, e.id).Err(); err != nil {
+		slog.Warn("failed to give up leadership", "key", e.key, "error", err)
+	}
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderElection_Campaign(t *testing.T) {
+	ctx := context.Background()
+	client, server := newScriptRedis(t)
+
+	first, err := NewLeaderElection(client, "rl:leader", 15*time.Second)
+	require.NoError(t, err)
+	second, err := NewLeaderElection(client, "rl:leader", 15*time.Second)
+	require.NoError(t, err)
+	require.NotEqual(t, first.ID(), second.ID())
+
+	require.NoError(t, first.Campaign(ctx))
+	require.NoError(t, second.Campaign(ctx))
+	assert.True(t, first.IsLeader())
+	assert.False(t, second.IsLeader(), "the lease is held")
+	holder, err := server.Get("rl:leader")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID(), holder)
+
+	server.FastForward(10 * time.Second)
+	require.NoError(t, first.Campaign(ctx))
+	assert.Equal(t, 15*time.Second, server.TTL("rl:leader"), "the leader extends its lease")
+
+	server.FastForward(16 * time.Second)
+	require.NoError(t, second.Campaign(ctx))
+	assert.True(t, second.IsLeader(), "an expired lease is taken over")
+	require.NoError(t, first.Campaign(ctx))
+	assert.False(t, first.IsLeader(), "a leader that couldn't extend its lease steps down")
+}
+
+func TestLeaderElection_ResignsOnStop(t *testing.T) {
+	client, server := newScriptRedis(t)
+	leader, err := NewLeaderElection(client, "rl:leader", 15*time.Second)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader.Start(ctx)
+	require.Eventually(t, leader.IsLeader, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-leader.Done():
+	case <-time.After(time.Second):
+		t.Fatal("leader election didn't stop")
+	}
+	assert.False(t, leader.IsLeader())
+	assert.False(t, server.Exists("rl:leader"), "the lease is given up for the next leader")
+}
+
+func TestHousekeeping_RunsOnLeaderOnly(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	leader, err := NewLeaderElection(client, "rl:leader", 15*time.Second)
+	require.NoError(t, err)
+	follower, err := NewLeaderElection(client, "rl:leader", 15*time.Second)
+	require.NoError(t, err)
+	require.NoError(t, leader.Campaign(context.Background()))
+	require.NoError(t, follower.Campaign(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var leaderRuns, followerRuns, unelectedRuns atomic.Int64
+	schedule := func(housekeeping *Housekeeping, runs *atomic.Int64) {
+		housekeeping.Schedule(ctx, HousekeepingJob{
+			Name:       "test",
+			Interval:   time.Millisecond,
+			RunAtStart: true,
+			Run: func(ctx context.Context) error {
+				runs.Add(1)
+				return nil
+			},
+		})
+	}
+	schedule(NewHousekeeping(leader), &leaderRuns)
+	schedule(NewHousekeeping(follower), &followerRuns)
+	schedule(nil, &unelectedRuns)
+
+	assert.Eventually(t, func() bool {
+		return leaderRuns.Load() > 2 && unelectedRuns.Load() > 2
+	}, time.Second, time.Millisecond)
+	assert.Zero(t, followerRuns.Load())
+}
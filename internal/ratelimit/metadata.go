@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// inlineMetadataValues is how many values of its own a decision holds
+// without allocating; the built-in strategies set at most this many on their
+// common paths.
+const inlineMetadataValues = 6
+
+// Metadata describes a decision beyond Allowed/Remaining, for humans and
+// dashboards. Most of it, such as bucket_size or window_size, is constant per
+// limiter, so a decision shares its limiter's constant values and keeps only
+// its own, unboxed when they are numbers or times. A map is only built when
+// Map or JSON encoding asks for one.
+//
+// Metadata is a value: copies may be changed independently of each other, and
+// the zero value is empty and ready to use.
+type Metadata struct {
+	shared map[string]interface{}
+	inline [inlineMetadataValues]metadataValue
+	count  int
+	more   []metadataValue
+}
+
+type metadataKind uint8
+
+const (
+	metadataAny metadataKind = iota
+	metadataInt
+	metadataFloat
+	metadataTime
+)
+
+type metadataValue struct {
+	name string
+	kind metadataKind
+	i    int64
+	t    time.Time
+	v    interface{}
+}
+
+func (v metadataValue) value() interface{} {
+	switch v.kind {
+	case metadataInt:
+		return v.i
+	case metadataFloat:
+		return math.Float64frombits(uint64(v.i))
+	case metadataTime:
+		return v.t
+	default:
+		return v.v
+	}
+}
+
+// SharedMetadata wraps values that every decision of a limiter reports. The
+// map is shared by those decisions and must not be changed afterwards.
+func SharedMetadata(values map[string]interface{}) Metadata {
+	return Metadata{shared: values}
+}
+
+// MetadataOf returns metadata holding values, which are copied.
+func MetadataOf(values map[string]interface{}) Metadata {
+	var m Metadata
+	for name, value := range values {
+		m.Set(name, value)
+	}
+	return m
+}
+
+// Set records a value of this decision, replacing any value of that name.
+func (m *Metadata) Set(name string, value interface{}) {
+	m.set(metadataValue{name: name, kind: metadataAny, v: value})
+}
+
+// SetInt is Set for an int64, without boxing it until it is read.
+func (m *Metadata) SetInt(name string, value int64) {
+	m.set(metadataValue{name: name, kind: metadataInt, i: value})
+}
+
+// SetFloat is Set for a float64, without boxing it until it is read.
+func (m *Metadata) SetFloat(name string, value float64) {
+	m.set(metadataValue{name: name, kind: metadataFloat, i: int64(math.Float64bits(value))})
+}
+
+// SetTime is Set for a time.Time, without boxing it until it is read.
+func (m *Metadata) SetTime(name string, value time.Time) {
+	m.set(metadataValue{name: name, kind: metadataTime, t: value})
+}
+
+func (m *Metadata) set(value metadataValue) {
+	for i := 0; i < m.count; i++ {
+		if m.inline[i].name == value.name {
+			m.inline[i] = value
+			return
+		}
+	}
+	for i := range m.more {
+		if m.more[i].name == value.name {
+			// more may be shared with copies of m, so it is never written in
+			// place.
+			more := make([]metadataValue, len(m.more))
+			copy(more, m.more)
+			more[i] = value
+			m.more = more
+			return
+		}
+	}
+
+	if m.count < inlineMetadataValues {
+		m.inline[m.count] = value
+		m.count++
+		return
+	}
+	m.more = append(m.more[:len(m.more):len(m.more)], value)
+}
+
+// Get returns the value recorded under name, if any.
+func (m Metadata) Get(name string) (interface{}, bool) {
+	for i := 0; i < m.count; i++ {
+		if m.inline[i].name == name {
+			return m.inline[i].value(), true
+		}
+	}
+	for _, value := range m.more {
+		if value.name == name {
+			return value.value(), true
+		}
+	}
+	value, ok := m.shared[name]
+	return value, ok
+}
+
+// Value returns the value recorded under name, or nil.
+func (m Metadata) Value(name string) interface{} {
+	value, _ := m.Get(name)
+	return value
+}
+
+func (m Metadata) Has(name string) bool {
+	_, ok := m.Get(name)
+	return ok
+}
+
+// Len returns the number of distinct names recorded.
+func (m Metadata) Len() int {
+	n := len(m.shared)
+	m.rangeOwn(func(value metadataValue) {
+		if _, shadowed := m.shared[value.name]; !shadowed {
+			n++
+		}
+	})
+	return n
+}
+
+func (m Metadata) rangeOwn(f func(value metadataValue)) {
+	for i := 0; i < m.count; i++ {
+		f(m.inline[i])
+	}
+	for _, value := range m.more {
+		f(value)
+	}
+}
+
+// Map builds a new map of every value recorded; nil when there are none.
+func (m Metadata) Map() map[string]interface{} {
+	if len(m.shared) == 0 && m.count == 0 {
+		return nil
+	}
+
+	values := make(map[string]interface{}, len(m.shared)+m.count+len(m.more))
+	for name, value := range m.shared {
+		values[name] = value
+	}
+	m.rangeOwn(func(value metadataValue) {
+		values[value.name] = value.value()
+	})
+	return values
+}
+
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Map())
+}
+
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*m = MetadataOf(values)
+	return nil
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadata_OwnValuesShadowShared(t *testing.T) {
+	shared := SharedMetadata(map[string]interface{}{"bucket_size": int64(10), "refill_rate": 1.0})
+
+	metadata := shared
+	metadata.SetInt("bucket_size", 5)
+	metadata.SetFloat("tokens", 2.5)
+
+	assert.Equal(t, int64(5), metadata.Value("bucket_size"))
+	assert.Equal(t, 1.0, metadata.Value("refill_rate"))
+	assert.Equal(t, 2.5, metadata.Value("tokens"))
+	assert.Equal(t, 3, metadata.Len())
+	assert.Equal(t, int64(10), shared.Value("bucket_size"), "the shared values are left alone")
+	assert.False(t, shared.Has("tokens"))
+}
+
+func TestMetadata_CopiesAreIndependent(t *testing.T) {
+	var metadata Metadata
+	for i := 0; i < inlineMetadataValues+2; i++ {
+		metadata.SetInt(string(rune('a'+i)), int64(i))
+	}
+
+	copied := metadata
+	copied.SetInt("a", 100)
+	copied.SetInt("h", 100)
+	copied.Set("extra", true)
+
+	assert.Equal(t, int64(0), metadata.Value("a"))
+	assert.Equal(t, int64(7), metadata.Value("h"))
+	assert.False(t, metadata.Has("extra"))
+	assert.Equal(t, int64(100), copied.Value("a"))
+	assert.Equal(t, int64(100), copied.Value("h"))
+	assert.Equal(t, inlineMetadataValues+3, copied.Len())
+}
+
+func TestMetadata_Map(t *testing.T) {
+	var empty Metadata
+	assert.Nil(t, empty.Map())
+
+	now := time.Unix(1000, 0)
+	metadata := SharedMetadata(map[string]interface{}{"window_size": int64(60)})
+	metadata.SetTime("period_start", now)
+	metadata.Set("banned", true)
+
+	assert.Equal(t, map[string]interface{}{
+		"window_size":  int64(60),
+		"period_start": now,
+		"banned":       true,
+	}, metadata.Map())
+}
+
+func TestMetadata_JSON(t *testing.T) {
+	metadata := SharedMetadata(map[string]interface{}{"bucket_size": int64(10)})
+	metadata.SetInt("tokens", 3)
+
+	encoded, err := json.Marshal(RateLimitResponse{Allowed: true, Metadata: metadata})
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"metadata":{"bucket_size":10,"tokens":3}`)
+
+	var decoded RateLimitResponse
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, 10.0, decoded.Metadata.Value("bucket_size"))
+	assert.Equal(t, 3.0, decoded.Metadata.Value("tokens"))
+}
+
+var (
+	metadataMapSink      map[string]interface{}
+	metadataResponseSink RateLimitResponse
+)
+
+// BenchmarkMetadata compares building a decision's metadata as a fresh map,
+// as strategies used to, with sharing the limiter's constant values.
+func BenchmarkMetadata(b *testing.B) {
+	now := time.Now()
+
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			metadataMapSink = map[string]interface{}{
+				"bucket_size":      int64(100),
+				"refill_rate":      10.0,
+				"tokens":           int64(i),
+				"last_refill_time": now,
+			}
+		}
+	})
+
+	b.Run("shared", func(b *testing.B) {
+		shared := SharedMetadata(map[string]interface{}{
+			"bucket_size": int64(100),
+			"refill_rate": 10.0,
+		})
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			metadata := shared
+			metadata.SetInt("tokens", int64(i))
+			metadata.SetTime("last_refill_time", now)
+			metadataResponseSink = RateLimitResponse{Metadata: metadata}
+		}
+	})
+
+	b.Run("decorated", func(b *testing.B) {
+		shared := SharedMetadata(map[string]interface{}{
+			"bucket_size": int64(100),
+			"refill_rate": 10.0,
+		})
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			metadata := shared
+			metadata.SetInt("tokens", int64(i))
+			response := RateLimitResponse{Metadata: metadata}
+			response.Metadata.Set("shadow", true)
+			metadataResponseSink = response
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/pmujumdar27/go-rate-limiter/internal/events"
 	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
 )
 
@@ -11,6 +12,7 @@ type MetricsDecorator struct {
 	rateLimiter RateLimiter
 	collector   metrics.Collector
 	strategy    string
+	decisions   events.Emitter
 }
 
 func NewMetricsDecorator(rateLimiter RateLimiter, collector metrics.Collector, strategy string) *MetricsDecorator {
@@ -21,6 +23,12 @@ func NewMetricsDecorator(rateLimiter RateLimiter, collector metrics.Collector, s
 	}
 }
 
+// WithDecisionStream also emits every decision to decisions.
+func (m *MetricsDecorator) WithDecisionStream(decisions events.Emitter) *MetricsDecorator {
+	m.decisions = decisions
+	return m
+}
+
 func (m *MetricsDecorator) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
 	start := time.Now()
 
@@ -29,13 +37,167 @@ func (m *MetricsDecorator) IsAllowed(ctx context.Context, key string, timestamp
 	duration := time.Since(start)
 	m.collector.RecordRateLimitDuration(m.strategy, duration)
 
-	if err == nil {
+	if err != nil {
+		m.collector.RecordRateLimitError(m.strategy)
+	} else {
 		m.collector.RecordRateLimitDecision(m.strategy, response.Allowed)
+		if namespace := NamespaceFromContext(ctx); namespace != "" {
+			m.collector.RecordNamespaceDecision(namespace, response.Allowed)
+		}
+		m.recordUsage(response)
 	}
+	m.emit(ctx, key, timestamp, response.Allowed, err, duration)
 
 	return response, err
 }
 
+func (m *MetricsDecorator) AllowN(ctx context.Context, key string, n int64, timestamp time.Time) (int64, RateLimitResponse, error) {
+	batcher, ok := m.rateLimiter.(BatchRateLimiter)
+	if !ok {
+		return 0, RateLimitResponse{Err: ErrBatchNotSupported}, ErrBatchNotSupported
+	}
+
+	start := time.Now()
+
+	granted, response, err := batcher.AllowN(ctx, key, n, timestamp)
+
+	duration := time.Since(start)
+	m.collector.RecordRateLimitDuration(m.strategy, duration)
+
+	if err != nil {
+		m.collector.RecordRateLimitError(m.strategy)
+		m.emit(ctx, key, timestamp, false, err, duration)
+		return granted, response, err
+	}
+
+	namespace := NamespaceFromContext(ctx)
+	for i := int64(0); i < n; i++ {
+		allowed := i < granted
+		m.collector.RecordRateLimitDecision(m.strategy, allowed)
+		if namespace != "" {
+			m.collector.RecordNamespaceDecision(namespace, allowed)
+		}
+		m.emit(ctx, key, timestamp, allowed, nil, duration)
+	}
+	m.recordUsage(response)
+
+	return granted, response, nil
+}
+
+func (m *MetricsDecorator) SupportsBatch() bool {
+	return SupportsBatch(m.rateLimiter)
+}
+
+func (m *MetricsDecorator) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	peeker, ok := m.rateLimiter.(Peeker)
+	if !ok {
+		return RateLimitResponse{Err: ErrPeekNotSupported}, ErrPeekNotSupported
+	}
+	return peeker.Peek(ctx, key, timestamp)
+}
+
 func (m *MetricsDecorator) Reset(ctx context.Context, key string) error {
 	return m.rateLimiter.Reset(ctx, key)
 }
+
+func (m *MetricsDecorator) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	resetter, ok := m.rateLimiter.(PrefixResetter)
+	if !ok {
+		return 0, ErrResetPrefixNotSupported
+	}
+	return resetter.ResetPrefix(ctx, prefix)
+}
+
+func (m *MetricsDecorator) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	refunder, ok := m.rateLimiter.(Refunder)
+	if !ok {
+		return ErrRefundNotSupported
+	}
+	return refunder.Refund(ctx, key, n, timestamp)
+}
+
+func (m *MetricsDecorator) SupportsRefund() bool {
+	return SupportsRefund(m.rateLimiter)
+}
+
+func (m *MetricsDecorator) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	debtor, ok := m.rateLimiter.(Debtor)
+	if !ok {
+		return ErrDebtNotSupported
+	}
+	return debtor.AddDebt(ctx, key, n, timestamp)
+}
+
+func (m *MetricsDecorator) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error) {
+	reserver, ok := m.rateLimiter.(Reserver)
+	if !ok {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: ErrReserveNotSupported}}, ErrReserveNotSupported
+	}
+
+	start := time.Now()
+
+	reservation, err := reserver.ReserveN(ctx, key, n, timestamp, maxDelay)
+
+	duration := time.Since(start)
+	m.collector.RecordRateLimitDuration(m.strategy, duration)
+
+	if err != nil {
+		m.collector.RecordRateLimitError(m.strategy)
+	} else {
+		m.collector.RecordRateLimitDecision(m.strategy, reservation.Allowed)
+		if namespace := NamespaceFromContext(ctx); namespace != "" {
+			m.collector.RecordNamespaceDecision(namespace, reservation.Allowed)
+		}
+		m.recordUsage(reservation.RateLimitResponse)
+	}
+	m.emit(ctx, key, timestamp, reservation.Allowed, err, duration)
+
+	return reservation, err
+}
+
+func (m *MetricsDecorator) SupportsReserve() bool {
+	return SupportsReserve(m.rateLimiter)
+}
+
+// recordUsage records the Retry-After of a denial and how much of its limit
+// the key has used, e.g. a sliding window counter's weighted count over its
+// bucket size. Denied keys have used all of it.
+func (m *MetricsDecorator) recordUsage(response RateLimitResponse) {
+	if response.Bypassed || response.Optimistic {
+		return
+	}
+	if !response.Allowed && response.RetryAfter != nil {
+		m.collector.RecordRetryAfter(m.strategy, *response.RetryAfter)
+	}
+	if response.Limit <= 0 {
+		return
+	}
+	utilization := 1.0
+	if response.Allowed {
+		utilization = min(1, max(0, float64(response.Limit-response.Remaining)/float64(response.Limit)))
+	}
+	m.collector.SetUtilization(m.strategy, utilization)
+}
+
+func (m *MetricsDecorator) emit(ctx context.Context, key string, timestamp time.Time, allowed bool, err error, latency time.Duration) {
+	if m.decisions == nil {
+		return
+	}
+
+	decision := events.DecisionDenied
+	switch {
+	case err != nil:
+		decision = events.DecisionError
+	case allowed:
+		decision = events.DecisionAllowed
+	}
+	m.decisions.Emit(events.Decision{
+		Time:          timestamp,
+		DecisionID:    DecisionIDFromContext(ctx),
+		KeyHash:       HashKey(key),
+		Strategy:      m.strategy,
+		Namespace:     NamespaceFromContext(ctx),
+		Decision:      decision,
+		LatencyMicros: latency.Microseconds(),
+	})
+}
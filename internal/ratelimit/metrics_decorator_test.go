@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/events"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingEmitter struct {
+	decisions []events.Decision
+}
+
+func (r *recordingEmitter) Emit(decision events.Decision) {
+	r.decisions = append(r.decisions, decision)
+}
+
+func TestMetricsDecorator_EmitsDecisions(t *testing.T) {
+	inner := &MockRateLimiterForFactory{}
+	now := time.Now()
+	ctx := WithNamespace(context.Background(), "tenant")
+	inner.On("IsAllowed", mock.Anything, "allowed", now).Return(RateLimitResponse{Allowed: true}, nil)
+	inner.On("IsAllowed", mock.Anything, "denied", now).Return(RateLimitResponse{Allowed: false}, nil)
+	inner.On("IsAllowed", mock.Anything, "broken", now).Return(RateLimitResponse{}, errors.New("redis down"))
+
+	emitter := &recordingEmitter{}
+	decorator := NewMetricsDecorator(inner, metrics.NewNoopCollector(), "token_bucket").WithDecisionStream(emitter)
+
+	for _, key := range []string{"allowed", "denied", "broken"} {
+		_, _ = decorator.IsAllowed(ctx, key, now)
+	}
+
+	require.Len(t, emitter.decisions, 3)
+	outcomes := []string{events.DecisionAllowed, events.DecisionDenied, events.DecisionError}
+	for i, decision := range emitter.decisions {
+		assert.Equal(t, outcomes[i], decision.Decision)
+		assert.Equal(t, "token_bucket", decision.Strategy)
+		assert.Equal(t, "tenant", decision.Namespace)
+		assert.Equal(t, now, decision.Time)
+	}
+	assert.Equal(t, HashKey("denied"), emitter.decisions[1].KeyHash)
+}
+
+type usageCollector struct {
+	metrics.NoopCollector
+	retryAfters  []time.Duration
+	utilizations []float64
+}
+
+func (c *usageCollector) RecordRetryAfter(strategy string, retryAfter time.Duration) {
+	c.retryAfters = append(c.retryAfters, retryAfter)
+}
+
+func (c *usageCollector) SetUtilization(strategy string, utilization float64) {
+	c.utilizations = append(c.utilizations, utilization)
+}
+
+func TestMetricsDecorator_RecordsUsage(t *testing.T) {
+	inner := &MockRateLimiterForFactory{}
+	now := time.Now()
+	retryAfter := 3 * time.Second
+	inner.On("IsAllowed", mock.Anything, "allowed", now).Return(RateLimitResponse{Allowed: true, Limit: 10, Remaining: 7}, nil)
+	inner.On("IsAllowed", mock.Anything, "denied", now).Return(RateLimitResponse{Limit: 10, RetryAfter: &retryAfter}, nil)
+	inner.On("IsAllowed", mock.Anything, "bypassed", now).Return(RateLimitResponse{Allowed: true, Bypassed: true}, nil)
+
+	collector := &usageCollector{}
+	decorator := NewMetricsDecorator(inner, collector, "token_bucket")
+	for _, key := range []string{"allowed", "denied", "bypassed"} {
+		_, err := decorator.IsAllowed(context.Background(), key, now)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []time.Duration{retryAfter}, collector.retryAfters)
+	assert.Equal(t, []float64{0.3, 1}, collector.utilizations)
+}
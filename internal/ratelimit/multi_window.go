@@ -0,0 +1,239 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Windows of the multi-window strategy, as reported in the limited_by
+// metadata.
+const (
+	MultiWindowBurst     = "burst"
+	MultiWindowSustained = "sustained"
+)
+
+// MultiWindowConfig limits each key over a short burst window, e.g. 10 per
+// second, and a long sustained one, e.g. 1000 per hour. The sustained window
+// uses the same option names as the sliding window counter, so overrides and
+// scaling adjust it like any other strategy's limit.
+type MultiWindowConfig struct {
+	KeyPrefix        string        `mapstructure:"key_prefix"`
+	TTLBufferSeconds int           `mapstructure:"ttl_buffer_seconds"`
+	WindowSize       time.Duration `mapstructure:"window_size"`
+	BucketSize       int64         `mapstructure:"bucket_size"`
+	BurstWindowSize  time.Duration `mapstructure:"burst_window_size"`
+	BurstLimit       int64         `mapstructure:"burst_limit"`
+}
+
+func (c MultiWindowConfig) Validate() error {
+	if c.WindowSize < time.Millisecond || c.BucketSize <= 0 {
+		return errors.New("window_size and bucket_size must be positive")
+	}
+	if c.BurstWindowSize < time.Millisecond || c.BurstLimit <= 0 {
+		return errors.New("burst_window_size and burst_limit must be positive")
+	}
+	if c.BurstWindowSize >= c.WindowSize {
+		return errors.New("burst_window_size must be shorter than window_size")
+	}
+	return nil
+}
+
+// MultiWindowRateLimiter admits a request only if it fits both the burst and
+// the sustained window, and counts it in both or neither in one script. Each
+// window is a sliding window counter, so its count weighs the previous
+// window by how much of it still overlaps.
+type MultiWindowRateLimiter struct {
+	config      MultiWindowConfig
+	redisClient *redis.Client
+	ttlSeconds  int64
+	topKeys     *TopKeys
+	metadata    Metadata
+}
+
+func NewMultiWindowRateLimiter(config MultiWindowConfig, redisClient *redis.Client) (*MultiWindowRateLimiter, error) {
+	if redisClient == nil {
+		return nil, errors.New("invalid configuration")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	ttlBufferSeconds := config.TTLBufferSeconds
+	if ttlBufferSeconds <= 0 {
+		ttlBufferSeconds = DefaultTTLBufferSeconds
+	}
+
+	return &MultiWindowRateLimiter{
+		config:      config,
+		redisClient: redisClient,
+		// The previous sustained window is still read during the current one.
+		ttlSeconds: max(MinimumTTLSeconds, int64((2*config.WindowSize).Seconds())+int64(ttlBufferSeconds)),
+		metadata: SharedMetadata(map[string]interface{}{
+			"burst_limit":       config.BurstLimit,
+			"burst_window_size": config.BurstWindowSize.Seconds(),
+			"bucket_size":       config.BucketSize,
+			"window_size":       config.WindowSize.Seconds(),
+		}),
+	}, nil
+}
+
+func (m *MultiWindowRateLimiter) redisKey(key string) string {
+	return fmt.Sprintf("%s:%s", m.config.KeyPrefix, key)
+}
+
+// windowIndexes returns which burst and sustained window timestamp falls in.
+func (m *MultiWindowRateLimiter) windowIndexes(timestamp time.Time) (int64, int64) {
+	nanos := timestamp.UnixNano()
+	return nanos / m.config.BurstWindowSize.Nanoseconds(), nanos / m.config.WindowSize.Nanoseconds()
+}
+
+func windowArgs(args []interface{}, timestamp time.Time, size time.Duration, limit int64) []interface{} {
+	nanos := timestamp.UnixNano()
+	progress := float64(nanos%size.Nanoseconds()) / float64(size.Nanoseconds())
+	return append(args, nanos/size.Nanoseconds(), progress, size.Milliseconds(), limit)
+}
+
+func (m *MultiWindowRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	return m.check(ctx, key, timestamp, 1)
+}
+
+// Peek reports the decision the next request would get without counting it.
+func (m *MultiWindowRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	return m.check(ctx, key, timestamp, 0)
+}
+
+func (m *MultiWindowRateLimiter) check(ctx context.Context, key string, timestamp time.Time, cost int64) (RateLimitResponse, error) {
+	args := []interface{}{cost, m.ttlSeconds}
+	args = windowArgs(args, timestamp, m.config.BurstWindowSize, m.config.BurstLimit)
+	args = windowArgs(args, timestamp, m.config.WindowSize, m.config.BucketSize)
+
+	keys := []string{m.redisKey(key)}
+	if cost > 0 {
+		keys, args = m.topKeys.scriptKeys(keys, args, key, timestamp)
+	} else {
+		keys = append(keys, ThrottleKey)
+	}
+	result, err := multiWindowScript.Run(ctx, m.redisClient, keys, args...).Result()
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) != 7 {
+		err = errors.New("invalid redis response from multi-window script")
+		return RateLimitResponse{Err: err}, err
+	}
+
+	values := make([]int64, len(resultArray))
+	for i := range resultArray {
+		values[i], err = getInt64FromResult(resultArray[i])
+		if err != nil {
+			err = fmt.Errorf("failed to parse multi-window script result %d: %w", i, err)
+			return RateLimitResponse{Err: err}, err
+		}
+	}
+	allowed, limitedBy, waitMs := values[0], values[1], values[2]
+	burstLimit, burstCount := values[3], values[4]
+	sustainedLimit, sustainedCount := values[5], values[6]
+
+	metadata := m.metadata
+	metadata.SetInt("burst_count", burstCount)
+	metadata.SetInt("sustained_count", sustainedCount)
+	markThrottled(&metadata, sustainedLimit, m.config.BucketSize)
+
+	if allowed == 0 {
+		window, limit := MultiWindowSustained, sustainedLimit
+		if limitedBy == 1 {
+			window, limit = MultiWindowBurst, burstLimit
+		}
+		metadata.Set("limited_by", window)
+		retryAfter := time.Duration(waitMs) * time.Millisecond
+
+		return RateLimitResponse{
+			Allowed:    false,
+			Limit:      limit,
+			Remaining:  0,
+			ResetTime:  timestamp.Add(retryAfter),
+			RetryAfter: &retryAfter,
+			Metadata:   metadata,
+		}, nil
+	}
+
+	// The window with the least room left is the one the caller runs into
+	// next, so its limit and end are reported.
+	burstIndex, sustainedIndex := m.windowIndexes(timestamp)
+	limit, remaining := sustainedLimit, max(0, sustainedLimit-sustainedCount)
+	resetTime := time.Unix(0, (sustainedIndex+1)*m.config.WindowSize.Nanoseconds())
+	if burstRemaining := max(0, burstLimit-burstCount); burstRemaining < remaining {
+		limit, remaining = burstLimit, burstRemaining
+		resetTime = time.Unix(0, (burstIndex+1)*m.config.BurstWindowSize.Nanoseconds())
+	}
+
+	return RateLimitResponse{
+		Allowed:   true,
+		Limit:     limit,
+		Remaining: remaining,
+		ResetTime: resetTime,
+		Metadata:  metadata,
+	}, nil
+}
+
+func (m *MultiWindowRateLimiter) setTopKeys(topKeys *TopKeys) {
+	m.topKeys = topKeys
+}
+
+func (m *MultiWindowRateLimiter) Reset(ctx context.Context, key string) error {
+	return m.redisClient.Del(ctx, m.redisKey(key)).Err()
+}
+
+func (m *MultiWindowRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPrefix
+	}
+	return deleteMatching(ctx, m.redisClient, prefixPattern(m.config.KeyPrefix, prefix))
+}
+
+// Refund takes n requests back out of both windows, as long as they are still
+// the windows timestamp falls in.
+func (m *MultiWindowRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	if n <= 0 {
+		return nil
+	}
+	burstIndex, sustainedIndex := m.windowIndexes(timestamp)
+	return multiWindowRefundScript.Run(ctx, m.redisClient, []string{m.redisKey(key), ThrottleKey}, n, burstIndex, sustainedIndex).Err()
+}
+
+type MultiWindowConstructor struct{}
+
+func (c *MultiWindowConstructor) Name() string {
+	return "multi_window"
+}
+
+func (c *MultiWindowConstructor) NewFromConfig(config map[string]interface{}, redisClient *redis.Client) (RateLimiter, error) {
+	options, err := DecodeOptions[MultiWindowConfig](config)
+	if err != nil {
+		return nil, fmt.Errorf("multi_window strategy: %w", err)
+	}
+	return NewMultiWindowRateLimiter(options, redisClient)
+}
+
+func (c *MultiWindowConstructor) ConvertConfig(rawConfig interface{}) (map[string]interface{}, error) {
+	cfg, ok := rawConfig.(config.MultiWindowConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected MultiWindowConfig, got %T", rawConfig)
+	}
+
+	return EncodeOptions(MultiWindowConfig{
+		KeyPrefix:        cfg.KeyPrefix,
+		TTLBufferSeconds: cfg.TTLBufferSeconds,
+		WindowSize:       time.Duration(cfg.Sustained.WindowSizeSeconds) * time.Second,
+		BucketSize:       cfg.Sustained.Limit,
+		BurstWindowSize:  time.Duration(cfg.Burst.WindowSizeSeconds) * time.Second,
+		BurstLimit:       cfg.Burst.Limit,
+	})
+}
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMultiWindow(t *testing.T) *MultiWindowRateLimiter {
+	t.Helper()
+	client, _ := newScriptRedis(t)
+	limiter, err := NewMultiWindowRateLimiter(MultiWindowConfig{
+		KeyPrefix:       "test:mw",
+		WindowSize:      10 * time.Second,
+		BucketSize:      5,
+		BurstWindowSize: time.Second,
+		BurstLimit:      3,
+	}, client)
+	require.NoError(t, err)
+	return limiter
+}
+
+func TestMultiWindowRateLimiter_LimitedByBurst(t *testing.T) {
+	limiter := newTestMultiWindow(t)
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 3; i++ {
+		response, err := limiter.IsAllowed(ctx, "alice", now)
+		require.NoError(t, err)
+		require.True(t, response.Allowed)
+	}
+
+	response, err := limiter.IsAllowed(ctx, "alice", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, MultiWindowBurst, response.Metadata.Value("limited_by"))
+	assert.Equal(t, int64(3), response.Limit)
+	assert.Equal(t, int64(3), response.Metadata.Value("sustained_count"), "denied requests aren't counted")
+	require.NotNil(t, response.RetryAfter)
+	assert.Less(t, *response.RetryAfter, 2*time.Second)
+
+	response, err = limiter.IsAllowed(ctx, "alice", now.Add(*response.RetryAfter))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+}
+
+func TestMultiWindowRateLimiter_LimitedBySustained(t *testing.T) {
+	limiter := newTestMultiWindow(t)
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 3; i++ {
+		response, err := limiter.IsAllowed(ctx, "alice", now)
+		require.NoError(t, err)
+		require.True(t, response.Allowed)
+	}
+	later := now.Add(2 * time.Second)
+	for i := 0; i < 2; i++ {
+		response, err := limiter.IsAllowed(ctx, "alice", later)
+		require.NoError(t, err)
+		require.True(t, response.Allowed)
+	}
+
+	response, err := limiter.IsAllowed(ctx, "alice", later)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, MultiWindowSustained, response.Metadata.Value("limited_by"))
+	assert.Equal(t, int64(5), response.Limit)
+	require.NotNil(t, response.RetryAfter)
+	assert.Greater(t, *response.RetryAfter, 7*time.Second, "the burst window frees up long before the sustained one")
+
+	response, err = limiter.IsAllowed(ctx, "alice", later.Add(*response.RetryAfter))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+}
+
+func TestMultiWindowRateLimiter_ReportsTightestWindow(t *testing.T) {
+	limiter := newTestMultiWindow(t)
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+
+	response, err := limiter.IsAllowed(ctx, "alice", now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), response.Limit)
+	assert.Equal(t, int64(2), response.Remaining)
+	assert.Equal(t, now.Add(time.Second), response.ResetTime)
+	assert.Equal(t, int64(1), response.Metadata.Value("burst_count"))
+
+	response, err = limiter.IsAllowed(ctx, "alice", now.Add(5*time.Second))
+	require.NoError(t, err)
+	response, err = limiter.IsAllowed(ctx, "alice", now.Add(7*time.Second))
+	require.NoError(t, err)
+	response, err = limiter.IsAllowed(ctx, "alice", now.Add(9*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), response.Limit)
+	assert.Equal(t, int64(1), response.Remaining)
+	assert.Equal(t, now.Add(10*time.Second), response.ResetTime)
+}
+
+func TestMultiWindowRateLimiter_PeekAndRefund(t *testing.T) {
+	limiter := newTestMultiWindow(t)
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 3; i++ {
+		_, err := limiter.IsAllowed(ctx, "alice", now)
+		require.NoError(t, err)
+	}
+
+	response, err := limiter.Peek(ctx, "alice", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, int64(3), response.Metadata.Value("burst_count"))
+
+	require.NoError(t, limiter.Refund(ctx, "alice", 1, now))
+	response, err = limiter.Peek(ctx, "alice", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(2), response.Metadata.Value("burst_count"))
+	assert.Equal(t, int64(2), response.Metadata.Value("sustained_count"))
+
+	response, err = limiter.Peek(ctx, "alice", now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), response.Metadata.Value("burst_count"), "peeking counts nothing")
+}
+
+func TestMultiWindowConfig_Validate(t *testing.T) {
+	valid := MultiWindowConfig{WindowSize: time.Hour, BucketSize: 1000, BurstWindowSize: time.Second, BurstLimit: 10}
+	assert.NoError(t, valid.Validate())
+
+	invalid := valid
+	invalid.BurstWindowSize = time.Hour
+	assert.Error(t, invalid.Validate())
+
+	invalid = valid
+	invalid.BurstLimit = 0
+	assert.Error(t, invalid.Validate())
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// namespaceKeyPrefix starts the keys of every namespace. Keys outside one
+// that start with it too are escaped, so no client key can name another
+// namespace's state.
+const namespaceKeyPrefix = "ns:"
+
+// ErrNamespacePrefix rejects a prefix reset outside any namespace that would
+// also match the keys of every namespace.
+var ErrNamespacePrefix = errors.New("prefix would match namespaced keys; reset them within their namespace")
+
+type namespaceContextKey struct{}
+
+// WithNamespace scopes every rate limit call made with ctx to namespace.
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	if namespace == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, namespaceContextKey{}, namespace)
+}
+
+func NamespaceFromContext(ctx context.Context) string {
+	namespace, _ := ctx.Value(namespaceContextKey{}).(string)
+	return namespace
+}
+
+func namespacedKey(ctx context.Context, key string) string {
+	namespace := NamespaceFromContext(ctx)
+	if namespace == "" {
+		if strings.HasPrefix(key, namespaceKeyPrefix) {
+			// Namespaces are never empty, so "ns::" is free for these.
+			return namespaceKeyPrefix + ":" + key
+		}
+		return key
+	}
+	return fmt.Sprintf("%s%s:%s", namespaceKeyPrefix, namespace, key)
+}
+
+// namespacedPrefix is namespacedKey for a prefix of keys. Outside a
+// namespace, prefixes of "ns:" itself are refused, since the keys they
+// match include every namespace's.
+func namespacedPrefix(ctx context.Context, prefix string) (string, error) {
+	if NamespaceFromContext(ctx) == "" && strings.HasPrefix(namespaceKeyPrefix, prefix) {
+		return "", ErrNamespacePrefix
+	}
+	return namespacedKey(ctx, prefix), nil
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"fmt"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// Options is a typed strategy configuration. Fields carry mapstructure tags
+// naming their keys in the converted config map.
+type Options interface {
+	Validate() error
+}
+
+// DecodeOptions decodes a converted strategy config into T and validates it.
+// Unknown keys are rejected so a misspelt option fails instead of silently
+// falling back to its zero value; durations may be given as time.Duration,
+// nanoseconds or strings such as "1m".
+func DecodeOptions[T Options](config map[string]interface{}) (T, error) {
+	var options T
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:  mapstructure.StringToTimeDurationHookFunc(),
+		ErrorUnused: true,
+		Result:      &options,
+	})
+	if err != nil {
+		return options, err
+	}
+	if err := decoder.Decode(config); err != nil {
+		return options, err
+	}
+	if err := options.Validate(); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+// EncodeOptions flattens typed options into the config map passed to
+// NewFromConfig, which ApplyOverrides and ScaleLimits operate on.
+func EncodeOptions(options Options) (map[string]interface{}, error) {
+	config := make(map[string]interface{})
+	if err := mapstructure.Decode(options, &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// TypedConstructor adapts a strategy built from typed options to
+// StrategyConstructor, so custom strategies don't have to pick values out of
+// the config map by hand. Constructors implementing StrategyConstructor
+// directly keep working unchanged.
+type TypedConstructor[T Options] struct {
+	StrategyName string
+	// Convert turns the strategy's section of the application config into
+	// options.
+	Convert func(rawConfig interface{}) (T, error)
+	New     func(options T, redisClient *redis.Client) (RateLimiter, error)
+}
+
+func (c *TypedConstructor[T]) Name() string {
+	return c.StrategyName
+}
+
+func (c *TypedConstructor[T]) NewFromConfig(config map[string]interface{}, redisClient *redis.Client) (RateLimiter, error) {
+	options, err := DecodeOptions[T](config)
+	if err != nil {
+		return nil, fmt.Errorf("%s strategy: %w", c.StrategyName, err)
+	}
+	return c.New(options, redisClient)
+}
+
+func (c *TypedConstructor[T]) ConvertConfig(rawConfig interface{}) (map[string]interface{}, error) {
+	options, err := c.Convert(rawConfig)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeOptions(options)
+}
@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeOptions(t *testing.T) {
+	t.Run("accepts numbers of any width and duration strings", func(t *testing.T) {
+		options, err := DecodeOptions[SlidingWindowCounterConfig](map[string]interface{}{
+			"window_size":        "90s",
+			"bucket_size":        float64(20),
+			"key_prefix":         "test:",
+			"ttl_buffer_seconds": int64(5),
+			"sub_windows":        4,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, SlidingWindowCounterConfig{
+			WindowSize:       90 * time.Second,
+			BucketSize:       20,
+			KeyPrefix:        "test:",
+			TTLBufferSeconds: 5,
+			SubWindows:       4,
+		}, options)
+	})
+
+	t.Run("rejects unknown keys", func(t *testing.T) {
+		_, err := DecodeOptions[SlidingWindowLogConfig](map[string]interface{}{
+			"window_size": time.Minute,
+			"bucket_size": int64(10),
+			"bucket_szie": int64(10),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "bucket_szie")
+	})
+
+	t.Run("rejects values of the wrong type", func(t *testing.T) {
+		_, err := DecodeOptions[QuotaConfig](map[string]interface{}{
+			"period": QuotaPeriodDaily,
+			"limit":  "lots",
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("validates the result", func(t *testing.T) {
+		_, err := DecodeOptions[TokenBucketOptions](map[string]interface{}{
+			"bucket_size":                   int64(10),
+			"refill_rate_per_second":        int64(1),
+			"lease_size":                    int64(5),
+			"global_bucket_size":            int64(100),
+			"global_refill_rate_per_second": int64(10),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "lease mode")
+	})
+}
+
+func TestEncodeOptions(t *testing.T) {
+	constructor := &TokenBucketConstructor{}
+	strategyConfig, err := constructor.ConvertConfig(config.TokenBucketConfig{
+		BucketSize:          10,
+		RefillRatePerSecond: 2,
+		KeyPrefix:           "test:",
+		TTLBufferSeconds:    5,
+		Lease:               config.TokenLeaseConfig{Size: 3, TTLMillis: 500},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"bucket_size":                   int64(10),
+		"refill_rate_per_second":        float64(2),
+		"key_prefix":                    "test:",
+		"ttl_buffer_seconds":            5,
+		"global_bucket_size":            int64(0),
+		"global_refill_rate_per_second": float64(0),
+		"lease_size":                    int64(3),
+		"lease_ttl_ms":                  int64(500),
+	}, strategyConfig)
+
+	options, err := DecodeOptions[TokenBucketOptions](strategyConfig)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), options.LeaseSize)
+	assert.Equal(t, int64(10), options.BucketSize)
+}
+
+type fixedWindowOptions struct {
+	Window time.Duration `mapstructure:"window"`
+	Limit  int64         `mapstructure:"limit"`
+}
+
+func (o fixedWindowOptions) Validate() error {
+	if o.Window <= 0 || o.Limit <= 0 {
+		return errors.New("window and limit must be positive")
+	}
+	return nil
+}
+
+func TestTypedConstructor(t *testing.T) {
+	var built fixedWindowOptions
+	constructor := &TypedConstructor[fixedWindowOptions]{
+		StrategyName: "fixed_window",
+		Convert: func(rawConfig interface{}) (fixedWindowOptions, error) {
+			limit, ok := rawConfig.(int64)
+			if !ok {
+				return fixedWindowOptions{}, errors.New("expected a limit")
+			}
+			return fixedWindowOptions{Window: time.Minute, Limit: limit}, nil
+		},
+		New: func(options fixedWindowOptions, redisClient *redis.Client) (RateLimiter, error) {
+			built = options
+			return nil, nil
+		},
+	}
+
+	strategyConfig, err := constructor.ConvertConfig(int64(30))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"window": time.Minute, "limit": int64(30)}, strategyConfig)
+
+	overridden, err := ApplyOverrides(strategyConfig, StrategyOverrides{Limit: 5})
+	require.NoError(t, err)
+	_, err = constructor.NewFromConfig(overridden, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fixedWindowOptions{Window: time.Minute, Limit: 5}, built)
+
+	_, err = constructor.NewFromConfig(map[string]interface{}{"window": time.Minute}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "fixed_window strategy")
+}
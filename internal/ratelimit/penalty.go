@@ -0,0 +1,236 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// PenaltyKeyPrefix prefixes the Redis keys of blocked clients.
+	PenaltyKeyPrefix = "rl:penalty:"
+	// ViolationKeyPrefix prefixes the per-key denial counters used for
+	// escalation.
+	ViolationKeyPrefix = "rl:violations:"
+	// BanListKey is a sorted set of automatically banned keys scored by the
+	// Unix millisecond their ban ends.
+	BanListKey = "rl:bans"
+)
+
+var (
+	ErrInvalidPenalty    = errors.New("penalty duration must be positive")
+	ErrInvalidEscalation = errors.New("escalation needs a positive max violations, window and ban duration")
+)
+
+// PenaltyState describes a block on a key.
+type PenaltyState struct {
+	Active    bool       `json:"active"`
+	Key       string     `json:"key"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Ban is an automatic block placed by escalation.
+type Ban struct {
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// EscalationConfig bans a key for BanDuration once it has been denied more
+// than MaxViolations times within Window.
+type EscalationConfig struct {
+	MaxViolations int64
+	Window        time.Duration
+	BanDuration   time.Duration
+}
+
+type cachedPenalty struct {
+	state   PenaltyState
+	expires time.Time
+}
+
+// PenaltyBox blocks misbehaving clients outright for longer than their limit
+// would. Blocks live in Redis, so every instance and strategy honours them.
+// Policies reuse a key's block state for DefaultPenaltyCacheTTL rather than
+// adding a round trip to every decision, so a block set on another instance
+// takes up to that long to apply here.
+type PenaltyBox struct {
+	redisClient *redis.Client
+	escalation  *EscalationConfig
+
+	mu    sync.Mutex
+	cache map[string]cachedPenalty
+}
+
+func NewPenaltyBox(redisClient *redis.Client) *PenaltyBox {
+	return &PenaltyBox{redisClient: redisClient, cache: make(map[string]cachedPenalty)}
+}
+
+// WithEscalation makes policies using the box ban keys that keep getting
+// denied.
+func (p *PenaltyBox) WithEscalation(config EscalationConfig) (*PenaltyBox, error) {
+	if config.MaxViolations <= 0 || config.Window < time.Millisecond || config.BanDuration < time.Millisecond {
+		return nil, ErrInvalidEscalation
+	}
+	p.escalation = &config
+	return p, nil
+}
+
+// Block denies key, in ctx's namespace, for duration.
+func (p *PenaltyBox) Block(ctx context.Context, key string, duration time.Duration, reason string) error {
+	if duration <= 0 {
+		return ErrInvalidPenalty
+	}
+	key = namespacedKey(ctx, key)
+	defer p.forget(key)
+	return p.redisClient.Set(ctx, PenaltyKeyPrefix+key, reason, duration).Err()
+}
+
+// Clear lifts a block, whether set by an operator or by escalation.
+func (p *PenaltyBox) Clear(ctx context.Context, key string) error {
+	key = namespacedKey(ctx, key)
+	defer p.forget(key)
+	_, err := p.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, PenaltyKeyPrefix+key)
+		pipe.ZRem(ctx, BanListKey, key)
+		return nil
+	})
+	return err
+}
+
+// Bans lists the automatic bans still in force, soonest to expire first.
+func (p *PenaltyBox) Bans(ctx context.Context, now time.Time) ([]Ban, error) {
+	entries, err := p.redisClient.ZRangeByScoreWithScores(ctx, BanListKey, &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(now.UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	bans := make([]Ban, 0, len(entries))
+	for _, entry := range entries {
+		member, _ := entry.Member.(string)
+		bans = append(bans, Ban{Key: member, ExpiresAt: time.UnixMilli(int64(entry.Score))})
+	}
+	return bans, nil
+}
+
+func (p *PenaltyBox) Get(ctx context.Context, key string) (PenaltyState, error) {
+	return p.state(ctx, namespacedKey(ctx, key))
+}
+
+func (p *PenaltyBox) state(ctx context.Context, key string) (PenaltyState, error) {
+	var reason *redis.StringCmd
+	var ttl *redis.DurationCmd
+	_, err := p.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		reason = pipe.Get(ctx, PenaltyKeyPrefix+key)
+		ttl = pipe.PTTL(ctx, PenaltyKeyPrefix+key)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return PenaltyState{Key: key}, nil
+	}
+	if err != nil {
+		return PenaltyState{}, err
+	}
+
+	state := PenaltyState{Active: true, Key: key, Reason: reason.Val()}
+	if ttl.Val() > 0 {
+		expiresAt := time.Now().Add(ttl.Val())
+		state.ExpiresAt = &expiresAt
+	}
+	return state, nil
+}
+
+// recordViolation counts a denial of key and reports whether it tipped the
+// key into a ban. It is a no-op without escalation.
+func (p *PenaltyBox) recordViolation(ctx context.Context, key string, timestamp time.Time) (bool, error) {
+	if p.escalation == nil {
+		return false, nil
+	}
+
+	reason := fmt.Sprintf("denied more than %d times in %s", p.escalation.MaxViolations, p.escalation.Window)
+	result, err := escalationScript.Run(ctx, p.redisClient,
+		[]string{ViolationKeyPrefix + key, PenaltyKeyPrefix + key, BanListKey, ThrottleKey},
+		p.escalation.MaxViolations, p.escalation.Window.Milliseconds(), p.escalation.BanDuration.Milliseconds(),
+		timestamp.UnixMilli(), reason, key,
+	).Int64Slice()
+	if err != nil {
+		return false, err
+	}
+	banned := len(result) > 0 && result[0] == 1
+	if banned {
+		p.forget(key)
+	}
+	return banned, nil
+}
+
+// check returns a denial when key is blocked.
+func (p *PenaltyBox) check(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, bool, error) {
+	state, err := p.cachedState(ctx, key)
+	if err != nil || !state.Active {
+		return RateLimitResponse{Err: err}, false, err
+	}
+
+	response := RateLimitResponse{Allowed: false}
+	response.Metadata.Set("penalized", true)
+	if state.Reason != "" {
+		response.Metadata.Set("penalty_reason", state.Reason)
+	}
+	if state.ExpiresAt != nil {
+		retryAfter := state.ExpiresAt.Sub(timestamp)
+		response.ResetTime = *state.ExpiresAt
+		response.RetryAfter = &retryAfter
+	}
+	return response, true, nil
+}
+
+// cachedState is state, reused for DefaultPenaltyCacheTTL or until the block
+// ends, whichever comes first.
+func (p *PenaltyBox) cachedState(ctx context.Context, key string) (PenaltyState, error) {
+	now := time.Now()
+	p.mu.Lock()
+	cached, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.state, nil
+	}
+
+	state, err := p.state(ctx, key)
+	if err != nil {
+		return state, err
+	}
+	expires := now.Add(DefaultPenaltyCacheTTL)
+	if state.ExpiresAt != nil && state.ExpiresAt.Before(expires) {
+		expires = *state.ExpiresAt
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.cache[key]; !ok && len(p.cache) >= MaxPenaltyCacheKeys {
+		for cachedKey, cached := range p.cache {
+			if !now.Before(cached.expires) {
+				delete(p.cache, cachedKey)
+			}
+		}
+		if len(p.cache) >= MaxPenaltyCacheKeys {
+			p.cache = make(map[string]cachedPenalty)
+		}
+	}
+	p.cache[key] = cachedPenalty{state: state, expires: expires}
+	return state, nil
+}
+
+// forget drops the cached block state of key, already namespaced, once this
+// instance changed it.
+func (p *PenaltyBox) forget(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.cache, key)
+}
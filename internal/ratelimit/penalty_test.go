@@ -0,0 +1,278 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chargeDebt adds two requests of debt to an untouched three-request budget
+// and checks that only one request is then allowed.
+func chargeDebt(t *testing.T, rateLimiter RateLimiter, now time.Time) {
+	t.Helper()
+	ctx := context.Background()
+
+	require.NoError(t, rateLimiter.(Debtor).AddDebt(ctx, "client", 2, now))
+
+	response, err := rateLimiter.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	response, err = rateLimiter.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed, "debt should use up the remaining budget")
+}
+
+func TestAddDebt_Strategies(t *testing.T) {
+	t.Run("token_bucket", func(t *testing.T) {
+		client, _ := newScriptRedis(t)
+		rateLimiter, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 3, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+		require.NoError(t, err)
+		chargeDebt(t, rateLimiter, time.Unix(0, scriptNow))
+	})
+
+	t.Run("sliding_window_log", func(t *testing.T) {
+		client, _ := newScriptRedis(t)
+		rateLimiter, err := NewSlidingWindowLogRateLimiter(SlidingWindowLogConfig{WindowSize: time.Minute, BucketSize: 3, KeyPrefix: "swl"}, client)
+		require.NoError(t, err)
+		chargeDebt(t, rateLimiter, time.Unix(0, scriptNow))
+	})
+
+	t.Run("sliding_window_counter", func(t *testing.T) {
+		client, _ := newScriptRedis(t)
+		rateLimiter, err := NewSlidingWindowCounterRateLimiter(SlidingWindowCounterConfig{WindowSize: time.Minute, BucketSize: 3, KeyPrefix: "swc"}, client)
+		require.NoError(t, err)
+		chargeDebt(t, rateLimiter, time.Unix(0, scriptNow))
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		client, _ := newScriptRedis(t)
+		rateLimiter, err := NewQuotaRateLimiter(QuotaConfig{Period: QuotaPeriodDaily, Limit: 3, KeyPrefix: "quota"}, client)
+		require.NoError(t, err)
+		chargeDebt(t, rateLimiter, time.Now())
+	})
+}
+
+func TestAddDebt_TokenBucketGoesNegative(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := context.Background()
+	now := time.Unix(0, scriptNow)
+
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 3, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	require.NoError(t, bucket.AddDebt(ctx, "client", 5, now))
+	assert.Equal(t, "-2", server.HGet("tb:client", "tokens"))
+
+	response, err := bucket.IsAllowed(ctx, "client", now.Add(2*time.Second))
+	require.NoError(t, err)
+	assert.False(t, response.Allowed, "debt is only repaid once the bucket refills past zero")
+}
+
+func TestAddDebt_SlidingWindowLogCapsAtBucketSize(t *testing.T) {
+	client, server := newScriptRedis(t)
+	rateLimiter, err := NewSlidingWindowLogRateLimiter(SlidingWindowLogConfig{WindowSize: time.Minute, BucketSize: 3, KeyPrefix: "swl"}, client)
+	require.NoError(t, err)
+
+	require.NoError(t, rateLimiter.AddDebt(context.Background(), "client", 1000000, time.Unix(0, scriptNow)))
+	members, err := server.ZMembers("swl:client")
+	require.NoError(t, err)
+	assert.Len(t, members, 3, "debt beyond the bucket size denies no longer")
+}
+
+func TestPenaltyBox_CachesChecks(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := context.Background()
+	now := time.Now()
+	box := NewPenaltyBox(client)
+
+	_, penalized, err := box.check(ctx, "client", now)
+	require.NoError(t, err)
+	assert.False(t, penalized)
+
+	require.NoError(t, server.Set(PenaltyKeyPrefix+"client", "elsewhere"))
+	_, penalized, err = box.check(ctx, "client", now)
+	require.NoError(t, err)
+	assert.False(t, penalized, "blocks set by other instances apply once the cached state expires")
+
+	require.NoError(t, box.Block(ctx, "client", time.Minute, "abuse"))
+	_, penalized, err = box.check(ctx, "client", now)
+	require.NoError(t, err)
+	assert.True(t, penalized, "this instance's blocks apply straight away")
+
+	require.NoError(t, box.Clear(ctx, "client"))
+	_, penalized, err = box.check(ctx, "client", now)
+	require.NoError(t, err)
+	assert.False(t, penalized)
+}
+
+func TestPenaltyBox_Block(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := WithNamespace(context.Background(), "tenant")
+	box := NewPenaltyBox(client)
+
+	assert.ErrorIs(t, box.Block(ctx, "client", 0, ""), ErrInvalidPenalty)
+
+	state, err := box.Get(ctx, "client")
+	require.NoError(t, err)
+	assert.False(t, state.Active)
+
+	require.NoError(t, box.Block(ctx, "client", time.Hour, "scraping"))
+	reason, err := server.Get(PenaltyKeyPrefix + "ns:tenant:client")
+	require.NoError(t, err)
+	assert.Equal(t, "scraping", reason)
+	assert.Equal(t, time.Hour, server.TTL(PenaltyKeyPrefix+"ns:tenant:client"))
+
+	state, err = box.Get(ctx, "client")
+	require.NoError(t, err)
+	assert.True(t, state.Active)
+	assert.Equal(t, "scraping", state.Reason)
+	require.NotNil(t, state.ExpiresAt)
+
+	require.NoError(t, box.Clear(ctx, "client"))
+	state, err = box.Get(ctx, "client")
+	require.NoError(t, err)
+	assert.False(t, state.Active)
+}
+
+func TestPolicy_Penalties(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 3, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	box := NewPenaltyBox(client)
+	policy := NewPolicy("default", bucket, nil).WithPenalties(box)
+
+	require.NoError(t, box.Block(ctx, "client", time.Minute, "abuse"))
+
+	response, err := policy.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, true, response.Metadata.Value("penalized"))
+	assert.Equal(t, "abuse", response.Metadata.Value("penalty_reason"))
+	require.NotNil(t, response.RetryAfter)
+	assert.InDelta(t, time.Minute.Seconds(), response.RetryAfter.Seconds(), 1)
+
+	_, response, err = policy.AllowN(ctx, "client", 1, now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+
+	response, err = policy.IsAllowed(ctx, "other", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed, "only the penalized key is blocked")
+
+	response, err = policy.IsAllowed(WithNamespace(ctx, "tenant"), "client", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed, "blocks are scoped to their namespace")
+
+	require.NoError(t, box.Clear(ctx, "client"))
+	response, err = policy.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+
+	assert.ErrorIs(t, NewPolicy("mock", &MockRateLimiterForFactory{}, nil).AddDebt(ctx, "client", 1, now), ErrDebtNotSupported)
+}
+
+func TestPenaltyBox_WithEscalation_Invalid(t *testing.T) {
+	client, _ := newScriptRedis(t)
+
+	for _, config := range []EscalationConfig{
+		{},
+		{MaxViolations: 3, Window: time.Minute},
+		{MaxViolations: 3, BanDuration: time.Minute},
+		{Window: time.Minute, BanDuration: time.Minute},
+	} {
+		_, err := NewPenaltyBox(client).WithEscalation(config)
+		assert.ErrorIs(t, err, ErrInvalidEscalation, "%+v", config)
+	}
+}
+
+func TestPolicy_Escalation(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 1, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	box, err := NewPenaltyBox(client).WithEscalation(EscalationConfig{MaxViolations: 2, Window: time.Minute, BanDuration: time.Hour})
+	require.NoError(t, err)
+	policy := NewPolicy("default", bucket, nil).WithPenalties(box)
+
+	response, err := policy.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	require.True(t, response.Allowed)
+
+	for i := 0; i < 2; i++ {
+		response, err = policy.IsAllowed(ctx, "client", now)
+		require.NoError(t, err)
+		assert.False(t, response.Allowed)
+		assert.Nil(t, response.Metadata.Value("banned"))
+	}
+	assert.Equal(t, time.Minute, server.TTL(ViolationKeyPrefix+"client"))
+
+	response, err = policy.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, true, response.Metadata.Value("banned"), "the third denial exceeds two violations")
+	assert.False(t, server.Exists(ViolationKeyPrefix+"client"))
+	assert.Equal(t, time.Hour, server.TTL(PenaltyKeyPrefix+"client"))
+
+	response, err = policy.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.Equal(t, true, response.Metadata.Value("penalized"))
+
+	bans, err := box.Bans(ctx, now)
+	require.NoError(t, err)
+	require.Len(t, bans, 1)
+	assert.Equal(t, "client", bans[0].Key)
+	assert.Equal(t, now.Add(time.Hour).UnixMilli(), bans[0].ExpiresAt.UnixMilli())
+
+	bans, err = box.Bans(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, bans, "expired bans are not listed")
+
+	require.NoError(t, box.Clear(ctx, "client"))
+	bans, err = box.Bans(ctx, now)
+	require.NoError(t, err)
+	assert.Empty(t, bans)
+}
+
+type recordingNotifier struct {
+	events []notify.Event
+}
+
+func (r *recordingNotifier) Notify(event notify.Event) {
+	r.events = append(r.events, event)
+}
+
+func TestPolicy_NotifiesDenialsAndBans(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 1, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	box, err := NewPenaltyBox(client).WithEscalation(EscalationConfig{MaxViolations: 1, Window: time.Minute, BanDuration: time.Hour})
+	require.NoError(t, err)
+	notifier := &recordingNotifier{}
+	policy := NewPolicy("default", bucket, nil).WithPenalties(box).WithNotifier(notifier)
+
+	for i := 0; i < 4; i++ {
+		_, err = policy.IsAllowed(ctx, "client", now)
+		require.NoError(t, err)
+	}
+
+	types := make([]notify.EventType, 0, len(notifier.events))
+	for _, event := range notifier.events {
+		types = append(types, event.Type)
+		assert.Equal(t, "client", event.Key)
+		assert.Equal(t, "default", event.Policy)
+	}
+	assert.Equal(t, []notify.EventType{notify.EventKeyThrottled, notify.EventKeyThrottled, notify.EventKeyBanned}, types,
+		"the banned key's later denials come from the penalty box and are not reported")
+	assert.Equal(t, float64(3600), notifier.events[2].Details["ban_seconds"])
+}
@@ -0,0 +1,404 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/pmujumdar27/go-rate-limiter/internal/notify"
+)
+
+// Policy is a named rate limiter that operators can switch off at runtime.
+// A disabled policy lets every request through and records it as bypassed.
+type Policy struct {
+	name      string
+	current   atomic.Pointer[policyLimiter]
+	collector metrics.Collector
+	penalties *PenaltyBox
+	notifier  notify.Notifier
+	softLimit softLimit
+	enabled   atomic.Bool
+	// bypassed is the metadata of every decision made while disabled.
+	bypassed Metadata
+}
+
+type softLimit struct {
+	threshold float64
+	notify    bool
+
+	// notified holds, per key, the end of the window its last soft limit
+	// event was sent for.
+	mu       sync.Mutex
+	notified map[string]time.Time
+}
+
+type policyLimiter struct {
+	rateLimiter RateLimiter
+}
+
+func NewPolicy(name string, rateLimiter RateLimiter, collector metrics.Collector) *Policy {
+	if collector == nil {
+		collector = metrics.NewNoopCollector()
+	}
+
+	p := &Policy{
+		name:      name,
+		collector: collector,
+		bypassed:  SharedMetadata(map[string]interface{}{"policy": name}),
+	}
+	p.current.Store(&policyLimiter{rateLimiter: rateLimiter})
+	p.enabled.Store(true)
+	return p
+}
+
+// WithPenalties denies keys blocked in penalties before consulting the limiter.
+func (p *Policy) WithPenalties(penalties *PenaltyBox) *Policy {
+	p.penalties = penalties
+	return p
+}
+
+// WithNotifier reports denials and bans of this policy's keys to notifier.
+func (p *Policy) WithNotifier(notifier notify.Notifier) *Policy {
+	p.notifier = notifier
+	return p
+}
+
+// WithSoftLimit marks allowed decisions that use threshold or more of the
+// limit, e.g. 0.8, with soft_limit metadata so clients can back off before
+// being denied. With notify the first of them in each window of a key is
+// also reported to the notifier.
+func (p *Policy) WithSoftLimit(threshold float64, notify bool) *Policy {
+	p.softLimit = softLimit{threshold: threshold, notify: notify, notified: make(map[string]time.Time)}
+	return p
+}
+
+func (p *Policy) Name() string {
+	return p.name
+}
+
+func (p *Policy) Enabled() bool {
+	return p.enabled.Load()
+}
+
+func (p *Policy) SetEnabled(enabled bool) {
+	p.enabled.Store(enabled)
+}
+
+// SetRateLimiter swaps the limiter behind the policy, e.g. after a strategy
+// switch. Requests already in flight finish on the old one.
+func (p *Policy) SetRateLimiter(rateLimiter RateLimiter) {
+	p.current.Store(&policyLimiter{rateLimiter: rateLimiter})
+}
+
+func (p *Policy) limiter() RateLimiter {
+	return p.current.Load().rateLimiter
+}
+
+func (p *Policy) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	if !p.Enabled() {
+		p.collector.RecordRateLimitBypass(p.name)
+		return RateLimitResponse{
+			Allowed:  true,
+			Bypassed: true,
+			Metadata: p.bypassed,
+		}, nil
+	}
+
+	key = namespacedKey(ctx, key)
+	if p.penalties != nil {
+		if response, penalized, err := p.penalties.check(ctx, key, timestamp); err != nil || penalized {
+			return response, err
+		}
+	}
+
+	response, err := p.limiter().IsAllowed(ctx, key, timestamp)
+	if err == nil {
+		p.onDecided(ctx, key, timestamp, &response)
+	}
+	return response, err
+}
+
+func (p *Policy) AllowN(ctx context.Context, key string, n int64, timestamp time.Time) (int64, RateLimitResponse, error) {
+	if !p.Enabled() {
+		for i := int64(0); i < n; i++ {
+			p.collector.RecordRateLimitBypass(p.name)
+		}
+		return n, RateLimitResponse{
+			Allowed:  true,
+			Bypassed: true,
+			Metadata: p.bypassed,
+		}, nil
+	}
+
+	batcher, ok := p.limiter().(BatchRateLimiter)
+	if !ok {
+		return 0, RateLimitResponse{Err: ErrBatchNotSupported}, ErrBatchNotSupported
+	}
+
+	key = namespacedKey(ctx, key)
+	if p.penalties != nil {
+		if response, penalized, err := p.penalties.check(ctx, key, timestamp); err != nil || penalized {
+			return 0, response, err
+		}
+	}
+
+	allowed, response, err := batcher.AllowN(ctx, key, n, timestamp)
+	if err == nil {
+		p.onDecided(ctx, key, timestamp, &response)
+	}
+	return allowed, response, err
+}
+
+// SupportsBatch reports whether AllowN can be served by the underlying limiter.
+func (p *Policy) SupportsBatch() bool {
+	return SupportsBatch(p.limiter())
+}
+
+// Peek reports usage from the underlying limiter even while the policy is disabled.
+func (p *Policy) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	peeker, ok := p.limiter().(Peeker)
+	if !ok {
+		return RateLimitResponse{Err: ErrPeekNotSupported}, ErrPeekNotSupported
+	}
+	return peeker.Peek(ctx, namespacedKey(ctx, key), timestamp)
+}
+
+func (p *Policy) Reset(ctx context.Context, key string) error {
+	return p.limiter().Reset(ctx, namespacedKey(ctx, key))
+}
+
+// Refund is a no-op while the policy is disabled, since bypassed requests
+// consumed nothing.
+// ResetPrefix clears every key of the policy's namespace that starts with
+// prefix.
+func (p *Policy) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	resetter, ok := p.limiter().(PrefixResetter)
+	if !ok {
+		return 0, ErrResetPrefixNotSupported
+	}
+	if prefix == "" {
+		return 0, ErrEmptyPrefix
+	}
+	prefix, err := namespacedPrefix(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	return resetter.ResetPrefix(ctx, prefix)
+}
+
+func (p *Policy) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	if !p.Enabled() {
+		return nil
+	}
+
+	refunder, ok := p.limiter().(Refunder)
+	if !ok {
+		return ErrRefundNotSupported
+	}
+	return refunder.Refund(ctx, namespacedKey(ctx, key), n, timestamp)
+}
+
+func (p *Policy) SupportsRefund() bool {
+	return SupportsRefund(p.limiter())
+}
+
+func (p *Policy) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error) {
+	if !p.Enabled() {
+		p.collector.RecordRateLimitBypass(p.name)
+		return Reservation{RateLimitResponse: RateLimitResponse{
+			Allowed:  true,
+			Bypassed: true,
+			Metadata: p.bypassed,
+		}}, nil
+	}
+
+	reserver, ok := p.limiter().(Reserver)
+	if !ok {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: ErrReserveNotSupported}}, ErrReserveNotSupported
+	}
+
+	key = namespacedKey(ctx, key)
+	if p.penalties != nil {
+		if response, penalized, err := p.penalties.check(ctx, key, timestamp); err != nil || penalized {
+			return Reservation{RateLimitResponse: response}, err
+		}
+	}
+
+	reservation, err := reserver.ReserveN(ctx, key, n, timestamp, maxDelay)
+	if err == nil {
+		p.onDecided(ctx, key, timestamp, &reservation.RateLimitResponse)
+	}
+	return reservation, err
+}
+
+func (p *Policy) onDecided(ctx context.Context, key string, timestamp time.Time, response *RateLimitResponse) {
+	if !response.Allowed {
+		p.onDenied(ctx, key, timestamp, response)
+		return
+	}
+	p.checkSoftLimit(key, timestamp, response)
+}
+
+// checkSoftLimit marks an allowed response that leaves key at or past the
+// soft limit.
+func (p *Policy) checkSoftLimit(key string, timestamp time.Time, response *RateLimitResponse) {
+	if p.softLimit.threshold <= 0 || response.Bypassed || response.Limit <= 0 {
+		return
+	}
+	used := response.Limit - response.Remaining
+	if float64(used) < p.softLimit.threshold*float64(response.Limit) {
+		return
+	}
+
+	response.Metadata.Set("soft_limit", true)
+	if p.softLimit.notify && p.softLimit.firstInWindow(key, timestamp, response.ResetTime) {
+		p.notify(notify.EventKeySoftLimit, key, timestamp, map[string]interface{}{
+			"limit":     response.Limit,
+			"remaining": response.Remaining,
+			"threshold": p.softLimit.threshold,
+		})
+	}
+}
+
+// firstInWindow reports whether key has had no soft limit event in the
+// window ending at resetTime, and records one. Responses without a reset
+// time in the future can't be told apart, so each of them is reported.
+func (s *softLimit) firstInWindow(key string, timestamp time.Time, resetTime time.Time) bool {
+	if !resetTime.After(timestamp) {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if windowEnd, ok := s.notified[key]; ok && timestamp.Before(windowEnd) {
+		return false
+	}
+	if _, ok := s.notified[key]; !ok && len(s.notified) >= MaxSoftLimitNotices {
+		for notifiedKey, windowEnd := range s.notified {
+			if !timestamp.Before(windowEnd) {
+				delete(s.notified, notifiedKey)
+			}
+		}
+		if len(s.notified) >= MaxSoftLimitNotices {
+			s.notified = make(map[string]time.Time)
+		}
+	}
+	s.notified[key] = resetTime
+	return true
+}
+
+// onDenied runs after the limiter denies key; penalty denials skip it so a
+// banned key isn't reported, or escalated, again.
+func (p *Policy) onDenied(ctx context.Context, key string, timestamp time.Time, response *RateLimitResponse) {
+	if p.notifier != nil {
+		details := map[string]interface{}{
+			"limit": response.Limit,
+		}
+		if response.RetryAfter != nil {
+			details["retry_after_seconds"] = response.RetryAfter.Seconds()
+		}
+		p.notify(notify.EventKeyThrottled, key, timestamp, details)
+	}
+	p.escalate(ctx, key, timestamp, response)
+}
+
+func (p *Policy) notify(eventType notify.EventType, key string, timestamp time.Time, details map[string]interface{}) {
+	if p.notifier == nil {
+		return
+	}
+	p.notifier.Notify(notify.Event{
+		Type:    eventType,
+		Time:    timestamp,
+		Key:     key,
+		Policy:  p.name,
+		Details: details,
+	})
+}
+
+// escalate counts a denial towards a ban. Failures are logged rather than
+// returned so a broken counter never changes the decision already made.
+func (p *Policy) escalate(ctx context.Context, key string, timestamp time.Time, response *RateLimitResponse) {
+	if p.penalties == nil {
+		return
+	}
+
+	banned, err := p.penalties.recordViolation(ctx, key, timestamp)
+	if err != nil {
+		slog.Warn("failed to record rate limit violation", "policy", p.name, "key", key, "error", err.Error())
+		return
+	}
+	if !banned {
+		return
+	}
+
+	p.collector.RecordBan(p.name)
+	slog.Info("key banned after repeated denials", "policy", p.name, "key", key)
+	response.Metadata.Set("banned", true)
+	p.notify(notify.EventKeyBanned, key, timestamp, map[string]interface{}{
+		"ban_seconds": p.penalties.escalation.BanDuration.Seconds(),
+	})
+}
+
+func (p *Policy) SupportsReserve() bool {
+	return SupportsReserve(p.limiter())
+}
+
+// AddDebt charges key even while the policy is disabled, so the debt is
+// still owed when it is switched back on.
+func (p *Policy) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	debtor, ok := p.limiter().(Debtor)
+	if !ok {
+		return ErrDebtNotSupported
+	}
+	return debtor.AddDebt(ctx, namespacedKey(ctx, key), n, timestamp)
+}
+
+type PolicyRegistry struct {
+	mu       sync.RWMutex
+	policies map[string]*Policy
+}
+
+func NewPolicyRegistry() *PolicyRegistry {
+	return &PolicyRegistry{
+		policies: make(map[string]*Policy),
+	}
+}
+
+func (r *PolicyRegistry) Register(policy *Policy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policies[policy.Name()] = policy
+}
+
+// Unregister removes the policy named name, e.g. of a rule that was deleted.
+func (r *PolicyRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.policies, name)
+}
+
+func (r *PolicyRegistry) Get(name string) (*Policy, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	policy, exists := r.policies[name]
+	return policy, exists
+}
+
+// List returns all registered policies ordered by name.
+func (r *PolicyRegistry) List() []*Policy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	policies := make([]*Policy, 0, len(r.policies))
+	for _, policy := range r.policies {
+		policies = append(policies, policy)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name() < policies[j].Name()
+	})
+	return policies
+}
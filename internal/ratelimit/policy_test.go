@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/pmujumdar27/go-rate-limiter/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_EnabledDelegates(t *testing.T) {
+	mockLimiter := &MockRateLimiterForFactory{}
+	mockLimiter.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(
+		RateLimitResponse{Allowed: false, Limit: 10}, nil)
+
+	policy := NewPolicy("default", mockLimiter, metrics.NewNoopCollector())
+	assert.True(t, policy.Enabled())
+
+	response, err := policy.IsAllowed(context.Background(), "client", time.Now())
+
+	assert.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.False(t, response.Bypassed)
+	mockLimiter.AssertExpectations(t)
+}
+
+func TestPolicy_DisabledBypasses(t *testing.T) {
+	mockLimiter := &MockRateLimiterForFactory{}
+
+	policy := NewPolicy("default", mockLimiter, nil)
+	policy.SetEnabled(false)
+
+	response, err := policy.IsAllowed(context.Background(), "client", time.Now())
+
+	assert.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.True(t, response.Bypassed)
+	assert.Equal(t, "default", response.Metadata.Value("policy"))
+	mockLimiter.AssertNotCalled(t, "IsAllowed", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPolicy_SoftLimit(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 5, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	notifier := &recordingNotifier{}
+	policy := NewPolicy("default", bucket, nil).WithNotifier(notifier).WithSoftLimit(0.8, true)
+
+	for i := 0; i < 3; i++ {
+		response, err := policy.IsAllowed(ctx, "client", now)
+		require.NoError(t, err)
+		assert.False(t, response.Metadata.Has("soft_limit"))
+	}
+
+	response, err := policy.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, true, response.Metadata.Value("soft_limit"), "4 of 5 used")
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, notify.EventKeySoftLimit, notifier.events[0].Type)
+	assert.Equal(t, int64(1), notifier.events[0].Details["remaining"])
+
+	response, err = policy.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.Equal(t, true, response.Metadata.Value("soft_limit"), "5 of 5 used")
+	assert.Len(t, notifier.events, 1, "one event per window")
+	response, err = policy.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	assert.False(t, response.Metadata.Has("soft_limit"), "denials aren't soft")
+	require.Len(t, notifier.events, 2)
+	assert.Equal(t, notify.EventKeyThrottled, notifier.events[1].Type)
+
+	// Once the bucket is full again the next crossing is a new window.
+	later := now.Add(5 * time.Second)
+	for i := 0; i < 5; i++ {
+		_, err := policy.IsAllowed(ctx, "client", later)
+		require.NoError(t, err)
+	}
+	require.Len(t, notifier.events, 3)
+	assert.Equal(t, notify.EventKeySoftLimit, notifier.events[2].Type)
+}
+
+func TestPolicy_SetRateLimiter(t *testing.T) {
+	oldLimiter := &MockRateLimiterForFactory{}
+	newLimiter := &MockRateLimiterForFactory{}
+	newLimiter.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(
+		RateLimitResponse{Allowed: true, Limit: 5}, nil)
+
+	policy := NewPolicy("default", oldLimiter, nil)
+	policy.SetRateLimiter(newLimiter)
+
+	response, err := policy.IsAllowed(context.Background(), "client", time.Now())
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), response.Limit)
+	oldLimiter.AssertNotCalled(t, "IsAllowed", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPolicyRegistry(t *testing.T) {
+	registry := NewPolicyRegistry()
+	registry.Register(NewPolicy("search", &MockRateLimiterForFactory{}, nil))
+	registry.Register(NewPolicy("login", &MockRateLimiterForFactory{}, nil))
+
+	policy, exists := registry.Get("login")
+	assert.True(t, exists)
+	assert.Equal(t, "login", policy.Name())
+
+	_, exists = registry.Get("missing")
+	assert.False(t, exists)
+
+	policies := registry.List()
+	assert.Len(t, policies, 2)
+	assert.Equal(t, "login", policies[0].Name())
+	assert.Equal(t, "search", policies[1].Name())
+}
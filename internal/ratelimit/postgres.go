@@ -0,0 +1,347 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// PostgresDB is the part of a pgx connection pool the Postgres backend uses;
+// *pgxpool.Pool implements it.
+type PostgresDB interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// PostgresSchema creates the tables of the Postgres backend. Each key is one
+// row, so a decision is a single UPSERT whose row lock serialises concurrent
+// requests for the key.
+const PostgresSchema = `
+CREATE TABLE IF NOT EXISTS rate_limit_token_buckets (
+	key         text PRIMARY KEY,
+	tokens      double precision NOT NULL,
+	refilled_at bigint NOT NULL,
+	allowed     boolean NOT NULL,
+	expires_at  timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS rate_limit_token_buckets_expires_at ON rate_limit_token_buckets (expires_at);
+
+CREATE TABLE IF NOT EXISTS rate_limit_fixed_windows (
+	key          text PRIMARY KEY,
+	window_start bigint NOT NULL,
+	count        bigint NOT NULL,
+	allowed      boolean NOT NULL,
+	expires_at   timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS rate_limit_fixed_windows_expires_at ON rate_limit_fixed_windows (expires_at);
+`
+
+// postgresRefilled is a bucket's tokens after refilling it up to $4, in
+// nanoseconds, at $3 tokens a second, capped at the bucket size $2.
+const postgresRefilled = `LEAST($2::float8, b.tokens + GREATEST(0, $4::bigint - b.refilled_at) / 1e9 * $3::float8)`
+
+// postgresTokenBucketQuery takes a token from key $1 if it has one. The SET
+// expressions all see the row as it was, so allowed and tokens agree.
+const postgresTokenBucketQuery = `
+INSERT INTO rate_limit_token_buckets AS b (key, tokens, refilled_at, allowed, expires_at)
+VALUES ($1, $2::float8 - 1, $4::bigint, true, $5::timestamptz)
+ON CONFLICT (key) DO UPDATE SET
+	tokens = CASE WHEN ` + postgresRefilled + ` >= 1 THEN ` + postgresRefilled + ` - 1 ELSE ` + postgresRefilled + ` END,
+	allowed = ` + postgresRefilled + ` >= 1,
+	refilled_at = GREATEST(b.refilled_at, $4::bigint),
+	expires_at = $5::timestamptz
+RETURNING tokens, allowed`
+
+// postgresFixedWindowQuery counts a request for key $1 in the window starting
+// at $2 if fewer than $3 were counted there. Denied requests aren't counted.
+const postgresFixedWindowQuery = `
+INSERT INTO rate_limit_fixed_windows AS w (key, window_start, count, allowed, expires_at)
+VALUES ($1, $2::bigint, 1, true, $4::timestamptz)
+ON CONFLICT (key) DO UPDATE SET
+	count = CASE WHEN w.window_start <> $2::bigint THEN 1 WHEN w.count < $3::bigint THEN w.count + 1 ELSE w.count END,
+	allowed = w.window_start <> $2::bigint OR w.count < $3::bigint,
+	window_start = $2::bigint,
+	expires_at = $4::timestamptz
+RETURNING count, allowed`
+
+// PostgresStore keeps rate limit state in Postgres for deployments that
+// already run it and don't need Redis throughput.
+type PostgresStore struct {
+	db PostgresDB
+}
+
+func NewPostgresStore(db PostgresDB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// CreateSchema creates the backend's tables if they don't exist yet.
+func (s *PostgresStore) CreateSchema(ctx context.Context) error {
+	if _, err := s.db.Exec(ctx, PostgresSchema); err != nil {
+		return fmt.Errorf("failed to create postgres schema: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpired deletes the rows of keys idle long enough to be back at their
+// full limit, which Redis would have expired, and returns how many it deleted.
+func (s *PostgresStore) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	var purged int64
+	for _, table := range []string{"rate_limit_token_buckets", "rate_limit_fixed_windows"} {
+		tag, err := s.db.Exec(ctx, "DELETE FROM "+table+" WHERE expires_at < $1", now)
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge %s: %w", table, err)
+		}
+		purged += tag.RowsAffected()
+	}
+	return purged, nil
+}
+
+// StartPurge runs PurgeExpired every interval through housekeeping until
+// ctx is done.
+func (s *PostgresStore) StartPurge(ctx context.Context, housekeeping *Housekeeping, interval time.Duration) {
+	housekeeping.Schedule(ctx, HousekeepingJob{
+		Name:     "postgres_purge",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			purged, err := s.PurgeExpired(ctx, time.Now())
+			if err != nil {
+				return err
+			}
+			if purged > 0 {
+				slog.Info("purged expired postgres rows", "purged", purged)
+			}
+			return nil
+		},
+	})
+}
+
+// PostgresTokenBucketRateLimiter is the token bucket strategy on Postgres.
+// It has no global bucket or lease mode.
+type PostgresTokenBucketRateLimiter struct {
+	db                  PostgresDB
+	bucketSize          int64
+	refillRatePerSecond float64
+	keyPrefix           string
+	ttlBuffer           time.Duration
+	metadata            Metadata
+}
+
+func NewPostgresTokenBucketRateLimiter(config TokenBucketConfig, db PostgresDB) (*PostgresTokenBucketRateLimiter, error) {
+	if db == nil {
+		return nil, errors.New("invalid configuration")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.GlobalBucketSize > 0 {
+		return nil, errors.New("the postgres backend has no global bucket")
+	}
+
+	ttlBufferSeconds := config.TTLBufferSeconds
+	if ttlBufferSeconds <= 0 {
+		ttlBufferSeconds = DefaultTTLBufferSeconds
+	}
+
+	return &PostgresTokenBucketRateLimiter{
+		db:                  db,
+		bucketSize:          config.BucketSize,
+		refillRatePerSecond: config.RefillRatePerSecond,
+		keyPrefix:           config.KeyPrefix,
+		ttlBuffer:           time.Duration(ttlBufferSeconds) * time.Second,
+		metadata: SharedMetadata(map[string]interface{}{
+			"bucket_size": config.BucketSize,
+			"refill_rate": config.RefillRatePerSecond,
+		}),
+	}, nil
+}
+
+func (tb *PostgresTokenBucketRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	refillRate := tb.refillRatePerSecond
+	secondsToFill := time.Duration(float64(tb.bucketSize) / refillRate * float64(time.Second))
+	expiresAt := timestamp.Add(secondsToFill + tb.ttlBuffer)
+
+	var tokens float64
+	var allowed bool
+	err := tb.db.QueryRow(ctx, postgresTokenBucketQuery,
+		tb.keyPrefix+key, tb.bucketSize, tb.refillRatePerSecond, timestamp.UnixNano(), expiresAt).Scan(&tokens, &allowed)
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	metadata := tb.metadata
+	if allowed {
+		fullTime := timestamp.Add(time.Duration((float64(tb.bucketSize) - tokens) / refillRate * float64(time.Second)))
+		metadata.SetTime("bucket_full_time", fullTime)
+
+		return RateLimitResponse{
+			Allowed:   true,
+			Limit:     tb.bucketSize,
+			Remaining: int64(math.Floor(tokens)),
+			ResetTime: fullTime,
+			Metadata:  metadata,
+		}, nil
+	}
+
+	nextTokenTime := timestamp.Add(time.Duration((1 - tokens) / refillRate * float64(time.Second)))
+	retryAfter := nextTokenTime.Sub(timestamp)
+	metadata.SetInt("current_tokens", int64(math.Floor(tokens)))
+	metadata.SetTime("next_token_time", nextTokenTime)
+
+	return RateLimitResponse{
+		Allowed:    false,
+		Limit:      tb.bucketSize,
+		Remaining:  0,
+		ResetTime:  nextTokenTime,
+		RetryAfter: &retryAfter,
+		Metadata:   metadata,
+	}, nil
+}
+
+func (tb *PostgresTokenBucketRateLimiter) Reset(ctx context.Context, key string) error {
+	_, err := tb.db.Exec(ctx, "DELETE FROM rate_limit_token_buckets WHERE key = $1", tb.keyPrefix+key)
+	return err
+}
+
+type FixedWindowConfig struct {
+	WindowSize time.Duration `mapstructure:"window_size"`
+	BucketSize int64         `mapstructure:"bucket_size"`
+	KeyPrefix  string        `mapstructure:"key_prefix"`
+}
+
+func (c FixedWindowConfig) Validate() error {
+	if c.WindowSize <= 0 || c.BucketSize <= 0 {
+		return errors.New("window_size and bucket_size must be positive")
+	}
+	return nil
+}
+
+// PostgresFixedWindowRateLimiter allows BucketSize requests per key in each
+// window aligned to the Unix epoch. It only exists on the Postgres backend.
+type PostgresFixedWindowRateLimiter struct {
+	db         PostgresDB
+	windowSize time.Duration
+	bucketSize int64
+	keyPrefix  string
+	metadata   Metadata
+}
+
+func NewPostgresFixedWindowRateLimiter(config FixedWindowConfig, db PostgresDB) (*PostgresFixedWindowRateLimiter, error) {
+	if db == nil {
+		return nil, errors.New("invalid configuration")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &PostgresFixedWindowRateLimiter{
+		db:         db,
+		windowSize: config.WindowSize,
+		bucketSize: config.BucketSize,
+		keyPrefix:  config.KeyPrefix,
+		metadata: SharedMetadata(map[string]interface{}{
+			"window_size": int64(config.WindowSize / time.Second),
+		}),
+	}, nil
+}
+
+func (fw *PostgresFixedWindowRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	windowStart := timestamp.UnixNano() / int64(fw.windowSize) * int64(fw.windowSize)
+	resetTime := time.Unix(0, windowStart+int64(fw.windowSize))
+
+	var count int64
+	var allowed bool
+	err := fw.db.QueryRow(ctx, postgresFixedWindowQuery,
+		fw.keyPrefix+key, windowStart, fw.bucketSize, resetTime).Scan(&count, &allowed)
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	metadata := fw.metadata
+	metadata.SetInt("current_count", count)
+	if allowed {
+		return RateLimitResponse{
+			Allowed:   true,
+			Limit:     fw.bucketSize,
+			Remaining: max(0, fw.bucketSize-count),
+			ResetTime: resetTime,
+			Metadata:  metadata,
+		}, nil
+	}
+
+	retryAfter := resetTime.Sub(timestamp)
+	return RateLimitResponse{
+		Allowed:    false,
+		Limit:      fw.bucketSize,
+		Remaining:  0,
+		ResetTime:  resetTime,
+		RetryAfter: &retryAfter,
+		Metadata:   metadata,
+	}, nil
+}
+
+func (fw *PostgresFixedWindowRateLimiter) Reset(ctx context.Context, key string) error {
+	_, err := fw.db.Exec(ctx, "DELETE FROM rate_limit_fixed_windows WHERE key = $1", fw.keyPrefix+key)
+	return err
+}
+
+// PostgresTokenBucketConstructor builds the token bucket strategy on
+// Postgres from the token bucket's configuration.
+type PostgresTokenBucketConstructor struct {
+	store *PostgresStore
+}
+
+func (c *PostgresTokenBucketConstructor) Name() string {
+	return "token_bucket"
+}
+
+func (c *PostgresTokenBucketConstructor) NewFromConfig(config map[string]interface{}, _ *redis.Client) (RateLimiter, error) {
+	options, err := DecodeOptions[TokenBucketOptions](config)
+	if err != nil {
+		return nil, fmt.Errorf("token bucket strategy: %w", err)
+	}
+	if options.LeaseSize > 0 {
+		return nil, errors.New("the postgres backend has no lease mode")
+	}
+	return NewPostgresTokenBucketRateLimiter(options.TokenBucketConfig, c.store.db)
+}
+
+func (c *PostgresTokenBucketConstructor) ConvertConfig(rawConfig interface{}) (map[string]interface{}, error) {
+	return (&TokenBucketConstructor{}).ConvertConfig(rawConfig)
+}
+
+type PostgresFixedWindowConstructor struct {
+	store *PostgresStore
+}
+
+func (c *PostgresFixedWindowConstructor) Name() string {
+	return "fixed_window"
+}
+
+func (c *PostgresFixedWindowConstructor) NewFromConfig(config map[string]interface{}, _ *redis.Client) (RateLimiter, error) {
+	options, err := DecodeOptions[FixedWindowConfig](config)
+	if err != nil {
+		return nil, fmt.Errorf("fixed window strategy: %w", err)
+	}
+	return NewPostgresFixedWindowRateLimiter(options, c.store.db)
+}
+
+func (c *PostgresFixedWindowConstructor) ConvertConfig(rawConfig interface{}) (map[string]interface{}, error) {
+	cfg, ok := rawConfig.(config.FixedWindowConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected FixedWindowConfig, got %T", rawConfig)
+	}
+
+	return EncodeOptions(FixedWindowConfig{
+		WindowSize: time.Duration(cfg.WindowSizeSeconds) * time.Second,
+		BucketSize: cfg.BucketSize,
+		KeyPrefix:  cfg.KeyPrefix,
+	})
+}
@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePostgres answers every query with row and records the arguments, since
+// the decisions themselves happen in SQL.
+type fakePostgres struct {
+	row   []any
+	err   error
+	query string
+	args  []any
+	execs []string
+}
+
+func (f *fakePostgres) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	f.query = sql
+	f.args = args
+	return fakeRow{values: f.row, err: f.err}
+}
+
+func (f *fakePostgres) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	f.execs = append(f.execs, sql)
+	f.args = args
+	return pgconn.NewCommandTag("DELETE 2"), f.err
+}
+
+type fakeRow struct {
+	values []any
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	for i, value := range r.values {
+		switch target := dest[i].(type) {
+		case *float64:
+			*target = value.(float64)
+		case *int64:
+			*target = value.(int64)
+		case *bool:
+			*target = value.(bool)
+		}
+	}
+	return nil
+}
+
+func TestPostgresTokenBucket_IsAllowed(t *testing.T) {
+	db := &fakePostgres{row: []any{3.5, true}}
+	rateLimiter, err := NewPostgresTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 10, RefillRatePerSecond: 2, KeyPrefix: "tb:"}, db)
+	require.NoError(t, err)
+
+	now := time.Unix(1000, 0)
+	response, err := rateLimiter.IsAllowed(context.Background(), "client", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(10), response.Limit)
+	assert.Equal(t, int64(3), response.Remaining)
+	assert.Equal(t, now.Add(3250*time.Millisecond), response.ResetTime)
+
+	assert.Equal(t, postgresTokenBucketQuery, db.query)
+	assert.Equal(t, []any{"tb:client", int64(10), float64(2), now.UnixNano(), now.Add(5*time.Second + DefaultTTLBufferSeconds*time.Second)}, db.args)
+
+	db.row = []any{0.5, false}
+	response, err = rateLimiter.IsAllowed(context.Background(), "client", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	require.NotNil(t, response.RetryAfter)
+	assert.Equal(t, 250*time.Millisecond, *response.RetryAfter)
+}
+
+func TestPostgresFixedWindow_IsAllowed(t *testing.T) {
+	db := &fakePostgres{row: []any{int64(4), true}}
+	rateLimiter, err := NewPostgresFixedWindowRateLimiter(FixedWindowConfig{WindowSize: time.Minute, BucketSize: 5, KeyPrefix: "fw:"}, db)
+	require.NoError(t, err)
+
+	now := time.Unix(1000, 0)
+	windowStart := time.Unix(960, 0)
+	response, err := rateLimiter.IsAllowed(context.Background(), "client", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(1), response.Remaining)
+	assert.Equal(t, windowStart.Add(time.Minute), response.ResetTime)
+	assert.Equal(t, []any{"fw:client", windowStart.UnixNano(), int64(5), windowStart.Add(time.Minute)}, db.args)
+
+	db.row = []any{int64(5), false}
+	response, err = rateLimiter.IsAllowed(context.Background(), "client", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	require.NotNil(t, response.RetryAfter)
+	assert.Equal(t, 20*time.Second, *response.RetryAfter)
+
+	db.err = errors.New("connection refused")
+	_, err = rateLimiter.IsAllowed(context.Background(), "client", now)
+	assert.Error(t, err)
+}
+
+func TestPostgresStore_ResetAndPurge(t *testing.T) {
+	db := &fakePostgres{}
+	store := NewPostgresStore(db)
+	factory := NewFactory(nil).WithPostgres(store)
+	assert.ElementsMatch(t, []string{"token_bucket", "fixed_window"}, factory.GetAvailableStrategies())
+
+	rateLimiter, err := NewPostgresFixedWindowRateLimiter(FixedWindowConfig{WindowSize: time.Minute, BucketSize: 5, KeyPrefix: "fw:"}, db)
+	require.NoError(t, err)
+	require.NoError(t, rateLimiter.Reset(context.Background(), "client"))
+	assert.Equal(t, []any{"fw:client"}, db.args)
+
+	purged, err := store.PurgeExpired(context.Background(), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), purged, "both tables are purged")
+}
+
+func TestPostgresTokenBucketConstructor_RejectsLeases(t *testing.T) {
+	constructor := &PostgresTokenBucketConstructor{store: NewPostgresStore(&fakePostgres{})}
+	config, err := EncodeOptions(TokenBucketOptions{
+		TokenBucketConfig: TokenBucketConfig{BucketSize: 10, RefillRatePerSecond: 1},
+		LeaseSize:         5,
+	})
+	require.NoError(t, err)
+
+	_, err = constructor.NewFromConfig(config, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// prefixResetScanCount is the COUNT hint for each SCAN of a prefix reset.
+const prefixResetScanCount = 1000
+
+var ErrEmptyPrefix = errors.New("prefix must not be empty")
+
+var globReplacer = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// prefixPattern returns the SCAN pattern for every key under keyPrefix whose
+// client key starts with prefix, which is matched literally.
+func prefixPattern(keyPrefix, prefix string) string {
+	return keyPrefix + ":" + globReplacer.Replace(prefix) + "*"
+}
+
+// deleteMatching deletes the keys matching pattern, apart from those starting
+// with any of except, one
+// SCAN page at a time so Redis is never blocked for long. Keys written while
+// it runs may survive.
+func deleteMatching(ctx context.Context, client *redis.Client, pattern string, except ...string) (int64, error) {
+	var deleted int64
+	var cursor uint64
+
+	for {
+		keys, next, err := client.Scan(ctx, cursor, pattern, prefixResetScanCount).Result()
+		if err != nil {
+			return deleted, err
+		}
+
+		keys = removeKeys(keys, except)
+		if len(keys) > 0 {
+			n, err := client.Del(ctx, keys...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return deleted, nil
+		}
+	}
+}
+
+func removeKeys(keys []string, except []string) []string {
+	if len(except) == 0 {
+		return keys
+	}
+	kept := keys[:0]
+	for _, key := range keys {
+		excluded := false
+		for _, exception := range except {
+			if strings.HasPrefix(key, exception) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, key)
+		}
+	}
+	return kept
+}
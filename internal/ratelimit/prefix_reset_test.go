@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetPrefix_Strategies(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, scriptNow)
+
+	t.Run("token_bucket keeps the global bucket", func(t *testing.T) {
+		client, server := newScriptRedis(t)
+		rateLimiter, err := NewTokenBucketRateLimiter(TokenBucketConfig{
+			BucketSize: 5, RefillRatePerSecond: 1, KeyPrefix: "tb",
+			GlobalBucketSize: 100, GlobalRefillRatePerSecond: 10,
+		}, client)
+		require.NoError(t, err)
+
+		for _, key := range []string{"gold", "gopher", "other"} {
+			_, err := rateLimiter.IsAllowed(ctx, key, now)
+			require.NoError(t, err)
+		}
+
+		deleted, err := rateLimiter.ResetPrefix(ctx, "g")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), deleted)
+		assert.True(t, server.Exists("tb:"+GlobalBucketKey))
+		assert.True(t, server.Exists("tb:other"))
+	})
+
+	t.Run("sliding_window_counter", func(t *testing.T) {
+		client, server := newScriptRedis(t)
+		rateLimiter, err := NewSlidingWindowCounterRateLimiter(SlidingWindowCounterConfig{WindowSize: time.Minute, BucketSize: 5, KeyPrefix: "swc"}, client)
+		require.NoError(t, err)
+
+		_, err = rateLimiter.IsAllowed(ctx, "customer:1", now)
+		require.NoError(t, err)
+		_, err = rateLimiter.IsAllowed(ctx, "other", now)
+		require.NoError(t, err)
+
+		_, err = rateLimiter.ResetPrefix(ctx, "customer:")
+		require.NoError(t, err)
+		for _, key := range server.Keys() {
+			assert.NotContains(t, key, "customer")
+		}
+		assert.True(t, server.Exists("swc:other:current"))
+	})
+
+	t.Run("empty prefix", func(t *testing.T) {
+		client, _ := newScriptRedis(t)
+		rateLimiter, err := NewQuotaRateLimiter(QuotaConfig{Limit: 5, Period: QuotaPeriodDaily, KeyPrefix: "quota"}, client)
+		require.NoError(t, err)
+
+		_, err = rateLimiter.ResetPrefix(ctx, "")
+		assert.ErrorIs(t, err, ErrEmptyPrefix)
+	})
+}
+
+func TestResetPrefix_MatchesLiterally(t *testing.T) {
+	client, server := newScriptRedis(t)
+	for _, key := range []string{"swl:a*b", "swl:a*bc", "swl:axb"} {
+		require.NoError(t, server.Set(key, "1"))
+	}
+
+	deleted, err := deleteMatching(context.Background(), client, prefixPattern("swl", "a*b"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	assert.Equal(t, []string{"swl:axb"}, server.Keys())
+}
+
+func TestPolicy_ResetPrefix_Namespaced(t *testing.T) {
+	client, server := newScriptRedis(t)
+	rateLimiter, err := NewSlidingWindowLogRateLimiter(SlidingWindowLogConfig{WindowSize: time.Minute, BucketSize: 5, KeyPrefix: "swl"}, client)
+	require.NoError(t, err)
+	policy := NewPolicy("default", rateLimiter, nil)
+
+	for _, key := range []string{"swl:ns:tenant:customer-1", "swl:customer-1"} {
+		require.NoError(t, server.Set(key, "1"))
+	}
+
+	deleted, err := policy.ResetPrefix(WithNamespace(context.Background(), "tenant"), "customer")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.Equal(t, []string{"swl:customer-1"}, server.Keys())
+}
+
+func TestPolicy_ResetPrefix_CannotReachNamespaces(t *testing.T) {
+	client, server := newScriptRedis(t)
+	rateLimiter, err := NewSlidingWindowLogRateLimiter(SlidingWindowLogConfig{WindowSize: time.Minute, BucketSize: 5, KeyPrefix: "swl"}, client)
+	require.NoError(t, err)
+	policy := NewPolicy("default", rateLimiter, nil)
+	require.NoError(t, server.Set("swl:ns:tenant:customer-1", "1"))
+
+	for _, prefix := range []string{"n", "ns", "ns:"} {
+		_, err := policy.ResetPrefix(context.Background(), prefix)
+		assert.ErrorIs(t, err, ErrNamespacePrefix, prefix)
+	}
+	deleted, err := policy.ResetPrefix(context.Background(), "ns:tenant:")
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+	assert.True(t, server.Exists("swl:ns:tenant:customer-1"))
+}
+
+func TestNamespacedKey_EscapesNamespacePrefix(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "customer-1", namespacedKey(ctx, "customer-1"))
+	assert.Equal(t, "ns:tenant:customer-1", namespacedKey(WithNamespace(ctx, "tenant"), "customer-1"))
+	assert.Equal(t, "ns::ns:tenant:customer-1", namespacedKey(ctx, "ns:tenant:customer-1"),
+		"a key outside any namespace can't name a namespace's state")
+}
@@ -0,0 +1,305 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/pmujumdar27/go-rate-limiter/internal/notify"
+)
+
+type QuarantineConfig struct {
+	// SlowThreshold is how long a check may take before it counts as slow.
+	// Failed checks aren't counted: an outage is left to the fail mode
+	// rather than quarantining every namespace.
+	SlowThreshold time.Duration
+	// Window is how long a namespace's checks are counted before the counts
+	// start over.
+	Window time.Duration
+	// MinRequests is how many checks a namespace needs in a window before
+	// it can be quarantined.
+	MinRequests int64
+	// SlowRatio is the share of slow checks in a window that quarantines a
+	// namespace.
+	SlowRatio float64
+	// Duration is how long a namespace stays quarantined before its checks
+	// go to Redis again.
+	Duration time.Duration
+	// Limit and Period configure the local limiter serving a quarantined
+	// namespace: Limit requests per key and Period, on each instance.
+	Limit  int64
+	Period time.Duration
+}
+
+type namespaceHealth struct {
+	windowStart time.Time
+	checks      int64
+	slow        int64
+	until       time.Time
+	windows     map[string]*localWindow
+}
+
+type localWindow struct {
+	start time.Time
+	count int64
+}
+
+// Quarantine isolates namespaces whose Redis keys turn pathological, e.g.
+// huge sorted sets or slow scripts, from the others. It tracks how many of
+// each namespace's checks are slow and, once too many are, serves the
+// namespace from an approximate in-memory limiter for a while, alerting
+// through the log, the collector and the notifier. The namespace's keys are
+// left alone in Redis, so it is back where it was when the quarantine ends.
+// Checks without a namespace are never quarantined.
+type Quarantine struct {
+	config    QuarantineConfig
+	collector metrics.Collector
+	notifier  notify.Notifier
+
+	mu         sync.Mutex
+	namespaces map[string]*namespaceHealth
+}
+
+// NewQuarantine returns a Quarantine alerting through collector and, when
+// not nil, notifier.
+func NewQuarantine(config QuarantineConfig, collector metrics.Collector, notifier notify.Notifier) *Quarantine {
+	return &Quarantine{
+		config:     config,
+		collector:  collector,
+		notifier:   notifier,
+		namespaces: make(map[string]*namespaceHealth),
+	}
+}
+
+// Wrap returns limiter with its checks quarantined per namespace. Limiters
+// wrapped by the same Quarantine share its view of the namespaces, so a
+// quarantine outlives a strategy switch.
+func (q *Quarantine) Wrap(limiter RateLimiter) *QuarantineRateLimiter {
+	return &QuarantineRateLimiter{limiter: limiter, quarantine: q}
+}
+
+// allowLocal decides n requests for key locally when namespace is
+// quarantined. It reports false when the check should go to Redis.
+func (q *Quarantine) allowLocal(namespace, key string, n int64, timestamp time.Time) (int64, RateLimitResponse, bool) {
+	q.mu.Lock()
+	health := q.namespaces[namespace]
+	if health == nil || health.until.IsZero() {
+		q.mu.Unlock()
+		return 0, RateLimitResponse{}, false
+	}
+	if !timestamp.Before(health.until) {
+		health.until = time.Time{}
+		health.windows = nil
+		q.mu.Unlock()
+		q.collector.SetNamespaceQuarantined(namespace, false)
+		slog.Info("namespace released from quarantine", "namespace", namespace)
+		return 0, RateLimitResponse{}, false
+	}
+
+	window := health.windows[key]
+	if window == nil || !timestamp.Before(window.start.Add(q.config.Period)) {
+		if window == nil {
+			q.sweepLocked(health, timestamp)
+		}
+		window = &localWindow{start: timestamp}
+		health.windows[key] = window
+	}
+	granted := min(n, q.config.Limit-window.count)
+	window.count += max(granted, 0)
+	remaining := q.config.Limit - window.count
+	reset := window.start.Add(q.config.Period)
+	until := health.until
+	q.mu.Unlock()
+
+	metadata := Metadata{}
+	metadata.Set("quarantined", true)
+	metadata.SetTime("quarantined_until", until)
+	if granted > 0 {
+		return granted, RateLimitResponse{
+			Allowed:   true,
+			Limit:     q.config.Limit,
+			Remaining: remaining,
+			ResetTime: reset,
+			Metadata:  metadata,
+		}, true
+	}
+	retryAfter := reset.Sub(timestamp)
+	return 0, RateLimitResponse{
+		Allowed:    false,
+		Limit:      q.config.Limit,
+		ResetTime:  reset,
+		RetryAfter: &retryAfter,
+		Metadata:   metadata,
+	}, true
+}
+
+// sweepLocked makes room for a new window once health has
+// MaxQuarantineKeys: ended windows are removed and, when all are still
+// running, the oldest one, whose key starts over.
+func (q *Quarantine) sweepLocked(health *namespaceHealth, now time.Time) {
+	if len(health.windows) < MaxQuarantineKeys {
+		return
+	}
+	oldestKey, oldest := "", now
+	for key, window := range health.windows {
+		if !now.Before(window.start.Add(q.config.Period)) {
+			delete(health.windows, key)
+			continue
+		}
+		if !window.start.After(oldest) {
+			oldestKey, oldest = key, window.start
+		}
+	}
+	if len(health.windows) >= MaxQuarantineKeys {
+		delete(health.windows, oldestKey)
+	}
+}
+
+// observe counts a check of namespace that went to Redis and succeeded, and
+// quarantines the namespace when too many of its checks in the window were
+// slow.
+func (q *Quarantine) observe(namespace string, took time.Duration, timestamp time.Time) {
+	q.mu.Lock()
+	health := q.namespaces[namespace]
+	if health == nil {
+		health = &namespaceHealth{windowStart: timestamp}
+		q.namespaces[namespace] = health
+	}
+	if !timestamp.Before(health.windowStart.Add(q.config.Window)) {
+		health.windowStart, health.checks, health.slow = timestamp, 0, 0
+	}
+	health.checks++
+	if took > q.config.SlowThreshold {
+		health.slow++
+	}
+
+	ratio := float64(health.slow) / float64(health.checks)
+	if health.checks < q.config.MinRequests || ratio < q.config.SlowRatio {
+		q.mu.Unlock()
+		return
+	}
+	health.until = timestamp.Add(q.config.Duration)
+	health.windows = make(map[string]*localWindow)
+	health.windowStart, health.checks, health.slow = health.until, 0, 0
+	until := health.until
+	q.mu.Unlock()
+
+	q.collector.SetNamespaceQuarantined(namespace, true)
+	slog.Warn("namespace quarantined, serving its checks locally",
+		"namespace", namespace, "slow_ratio", ratio, "until", until)
+	if q.notifier != nil {
+		q.notifier.Notify(notify.Event{
+			Type: notify.EventNamespaceQuarantined,
+			Time: timestamp,
+			Details: map[string]interface{}{
+				"namespace":  namespace,
+				"slow_ratio": ratio,
+				"until":      until,
+			},
+		})
+	}
+}
+
+// QuarantineRateLimiter sends the checks of quarantined namespaces to the
+// Quarantine's local limiter and times the others. Only IsAllowed and AllowN
+// are quarantined; the other operations always reach the wrapped limiter.
+type QuarantineRateLimiter struct {
+	limiter    RateLimiter
+	quarantine *Quarantine
+}
+
+func (q *QuarantineRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	namespace := NamespaceFromContext(ctx)
+	if namespace == "" {
+		return q.limiter.IsAllowed(ctx, key, timestamp)
+	}
+	if _, response, ok := q.quarantine.allowLocal(namespace, key, 1, timestamp); ok {
+		return response, nil
+	}
+
+	start := time.Now()
+	response, err := q.limiter.IsAllowed(ctx, key, timestamp)
+	if err == nil {
+		q.quarantine.observe(namespace, time.Since(start), timestamp)
+	}
+	return response, err
+}
+
+func (q *QuarantineRateLimiter) AllowN(ctx context.Context, key string, n int64, timestamp time.Time) (int64, RateLimitResponse, error) {
+	batcher, ok := q.limiter.(BatchRateLimiter)
+	if !ok {
+		return 0, RateLimitResponse{Err: ErrBatchNotSupported}, ErrBatchNotSupported
+	}
+	namespace := NamespaceFromContext(ctx)
+	if namespace == "" {
+		return batcher.AllowN(ctx, key, n, timestamp)
+	}
+	if granted, response, ok := q.quarantine.allowLocal(namespace, key, n, timestamp); ok {
+		return granted, response, nil
+	}
+
+	start := time.Now()
+	granted, response, err := batcher.AllowN(ctx, key, n, timestamp)
+	if err == nil {
+		q.quarantine.observe(namespace, time.Since(start), timestamp)
+	}
+	return granted, response, err
+}
+
+func (q *QuarantineRateLimiter) SupportsBatch() bool {
+	return SupportsBatch(q.limiter)
+}
+
+func (q *QuarantineRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	peeker, ok := q.limiter.(Peeker)
+	if !ok {
+		return RateLimitResponse{Err: ErrPeekNotSupported}, ErrPeekNotSupported
+	}
+	return peeker.Peek(ctx, key, timestamp)
+}
+
+func (q *QuarantineRateLimiter) Reset(ctx context.Context, key string) error {
+	return q.limiter.Reset(ctx, key)
+}
+
+func (q *QuarantineRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	resetter, ok := q.limiter.(PrefixResetter)
+	if !ok {
+		return 0, ErrResetPrefixNotSupported
+	}
+	return resetter.ResetPrefix(ctx, prefix)
+}
+
+func (q *QuarantineRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	refunder, ok := q.limiter.(Refunder)
+	if !ok {
+		return ErrRefundNotSupported
+	}
+	return refunder.Refund(ctx, key, n, timestamp)
+}
+
+func (q *QuarantineRateLimiter) SupportsRefund() bool {
+	return SupportsRefund(q.limiter)
+}
+
+func (q *QuarantineRateLimiter) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	debtor, ok := q.limiter.(Debtor)
+	if !ok {
+		return ErrDebtNotSupported
+	}
+	return debtor.AddDebt(ctx, key, n, timestamp)
+}
+
+func (q *QuarantineRateLimiter) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error) {
+	reserver, ok := q.limiter.(Reserver)
+	if !ok {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: ErrReserveNotSupported}}, ErrReserveNotSupported
+	}
+	return reserver.ReserveN(ctx, key, n, timestamp, maxDelay)
+}
+
+func (q *QuarantineRateLimiter) SupportsReserve() bool {
+	return SupportsReserve(q.limiter)
+}
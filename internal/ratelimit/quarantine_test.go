@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/pmujumdar27/go-rate-limiter/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type quarantineCollector struct {
+	metrics.NoopCollector
+	changes []string
+}
+
+func (q *quarantineCollector) SetNamespaceQuarantined(namespace string, quarantined bool) {
+	q.changes = append(q.changes, fmt.Sprintf("%s/%t", namespace, quarantined))
+}
+
+var testQuarantineConfig = QuarantineConfig{
+	SlowThreshold: time.Second,
+	Window:        time.Minute,
+	MinRequests:   3,
+	SlowRatio:     0.5,
+	Duration:      5 * time.Minute,
+	Limit:         2,
+	Period:        time.Minute,
+}
+
+func TestQuarantine_QuarantinesSlowNamespace(t *testing.T) {
+	inner := new(MockRateLimiterForFactory)
+	collector := &quarantineCollector{}
+	notifier := &recordingNotifier{}
+	config := testQuarantineConfig
+	config.SlowThreshold = time.Millisecond
+	limiter := NewQuarantine(config, collector, notifier).Wrap(inner)
+
+	slow := WithNamespace(context.Background(), "slow")
+	fast := WithNamespace(context.Background(), "fast")
+	now := time.Now()
+
+	inner.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(RateLimitResponse{Allowed: true}, nil).After(5 * time.Millisecond).Times(3)
+	for i := 0; i < 3; i++ {
+		_, err := limiter.IsAllowed(slow, "client", now)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"slow/true"}, collector.changes)
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, notify.EventNamespaceQuarantined, notifier.events[0].Type)
+	assert.Equal(t, "slow", notifier.events[0].Details["namespace"])
+
+	for i := 0; i < 2; i++ {
+		response, err := limiter.IsAllowed(slow, "client", now)
+		require.NoError(t, err)
+		assert.True(t, response.Allowed, "the local limiter decides")
+		assert.Equal(t, true, response.Metadata.Value("quarantined"))
+	}
+	response, err := limiter.IsAllowed(slow, "client", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed, "the local limit applies")
+	require.NotNil(t, response.RetryAfter)
+	assert.Equal(t, time.Minute, *response.RetryAfter)
+
+	inner.On("IsAllowed", mock.Anything, "other", mock.Anything).Return(RateLimitResponse{Allowed: true}, nil).Once()
+	response, err = limiter.IsAllowed(fast, "other", now)
+	require.NoError(t, err)
+	assert.False(t, response.Metadata.Has("quarantined"), "other namespaces still reach Redis")
+
+	inner.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(RateLimitResponse{Allowed: true}, nil).Once()
+	response, err = limiter.IsAllowed(slow, "client", now.Add(5*time.Minute))
+	require.NoError(t, err)
+	assert.False(t, response.Metadata.Has("quarantined"), "the quarantine ends")
+	assert.Equal(t, []string{"slow/true", "slow/false"}, collector.changes)
+	inner.AssertExpectations(t)
+}
+
+func TestQuarantine_Thresholds(t *testing.T) {
+	inner := new(MockRateLimiterForFactory)
+	collector := &quarantineCollector{}
+	limiter := NewQuarantine(testQuarantineConfig, collector, nil).Wrap(inner)
+	now := time.Now()
+
+	inner.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(RateLimitResponse{}, errors.New("busy script"))
+
+	for i := 0; i < 5; i++ {
+		_, err := limiter.IsAllowed(context.Background(), "client", now)
+		assert.Error(t, err)
+	}
+	assert.Empty(t, collector.changes, "checks without a namespace are never quarantined")
+
+	ctx := WithNamespace(context.Background(), "tenant")
+	for i := 0; i < 5; i++ {
+		_, err := limiter.IsAllowed(ctx, "client", now)
+		assert.Error(t, err)
+	}
+	assert.Empty(t, collector.changes, "failed checks are left to the fail mode")
+
+	quarantine := NewQuarantine(testQuarantineConfig, collector, nil)
+	for i := 0; i < 3; i++ {
+		quarantine.observe("tenant", 2*time.Second, now.Add(time.Duration(i)*time.Minute))
+	}
+	assert.Empty(t, collector.changes, "the counts start over every window")
+}
+
+func TestQuarantine_AllowN(t *testing.T) {
+	quarantine := NewQuarantine(testQuarantineConfig, metrics.NewNoopCollector(), nil)
+	ctx := WithNamespace(context.Background(), "slow")
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		quarantine.observe("slow", 2*time.Second, now)
+	}
+
+	limiter := quarantine.Wrap(new(MockBatchRateLimiter))
+	granted, response, err := limiter.AllowN(ctx, "client", 5, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), granted, "up to the local limit is granted")
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(0), response.Remaining)
+}
+
+func TestQuarantine_BoundsLocalWindows(t *testing.T) {
+	quarantine := NewQuarantine(testQuarantineConfig, metrics.NewNoopCollector(), nil)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		quarantine.observe("slow", 2*time.Second, now)
+	}
+
+	for i := 0; i <= MaxQuarantineKeys; i++ {
+		_, _, ok := quarantine.allowLocal("slow", fmt.Sprintf("key-%d", i), 1, now.Add(time.Duration(i)*time.Microsecond))
+		require.True(t, ok)
+	}
+	windows := quarantine.namespaces["slow"].windows
+	assert.Len(t, windows, MaxQuarantineKeys, "running windows are bounded too")
+	assert.NotContains(t, windows, "key-0", "the oldest window makes room")
+}
@@ -0,0 +1,264 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	QuotaPeriodDaily   = "daily"
+	QuotaPeriodMonthly = "monthly"
+)
+
+type QuotaConfig struct {
+	Period           string `mapstructure:"period"`
+	Limit            int64  `mapstructure:"limit"`
+	AnchorDay        int    `mapstructure:"anchor_day"`
+	KeyPrefix        string `mapstructure:"key_prefix"`
+	TTLBufferSeconds int    `mapstructure:"ttl_buffer_seconds"`
+}
+
+// Validate accepts an AnchorDay of 0, which means the 1st.
+func (c QuotaConfig) Validate() error {
+	if c.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	if c.Period != QuotaPeriodDaily && c.Period != QuotaPeriodMonthly {
+		return fmt.Errorf("invalid quota period: %q", c.Period)
+	}
+	if c.AnchorDay < 0 || c.AnchorDay > 28 {
+		return fmt.Errorf("quota anchor day must be between 1 and 28, got %d", c.AnchorDay)
+	}
+	return nil
+}
+
+// QuotaRateLimiter counts requests per calendar period (UTC day or billing
+// month) rather than over a sliding window.
+type QuotaRateLimiter struct {
+	replicaReads
+	period      string
+	limit       int64
+	anchorDay   int
+	redisClient *redis.Client
+	keyPrefix   string
+	ttlBuffer   int64
+	topKeys     *TopKeys
+	metadata    Metadata
+}
+
+func NewQuotaRateLimiter(config QuotaConfig, redisClient *redis.Client) (*QuotaRateLimiter, error) {
+	if redisClient == nil {
+		return nil, errors.New("invalid configuration")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	anchorDay := config.AnchorDay
+	if anchorDay == 0 {
+		anchorDay = 1
+	}
+
+	ttlBufferSeconds := config.TTLBufferSeconds
+	if ttlBufferSeconds <= 0 {
+		ttlBufferSeconds = DefaultTTLBufferSeconds
+	}
+
+	return &QuotaRateLimiter{
+		period:      config.Period,
+		limit:       config.Limit,
+		anchorDay:   anchorDay,
+		redisClient: redisClient,
+		keyPrefix:   config.KeyPrefix,
+		metadata:    SharedMetadata(map[string]interface{}{"quota_period": config.Period}),
+		ttlBuffer:   int64(ttlBufferSeconds),
+	}, nil
+}
+
+func (q *QuotaRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	periodStart, periodEnd := q.periodBounds(timestamp)
+	redisKey := q.periodKey(key, periodStart)
+
+	expireAt := periodEnd.Unix() + q.ttlBuffer
+
+	keys, args := q.topKeys.scriptKeys([]string{redisKey}, []interface{}{q.limit, expireAt}, key, timestamp)
+	result, err := quotaScript.Run(ctx, q.redisClient, keys, args...).Result()
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) < 2 {
+		err = errors.New("invalid redis response from quota script")
+		return RateLimitResponse{Err: err}, err
+	}
+
+	allowed, err := getInt64FromResult(resultArray[0])
+	if err != nil {
+		err = fmt.Errorf("failed to parse allowed flag: %w", err)
+		return RateLimitResponse{Err: err}, err
+	}
+
+	used, err := getInt64FromResult(resultArray[1])
+	if err != nil {
+		err = fmt.Errorf("failed to parse used count: %w", err)
+		return RateLimitResponse{Err: err}, err
+	}
+
+	limit := limitFromResult(resultArray, 2, q.limit)
+	return q.buildResponse(allowed == 1, used, limit, periodStart, periodEnd, timestamp), nil
+}
+
+func (q *QuotaRateLimiter) setTopKeys(topKeys *TopKeys) {
+	q.topKeys = topKeys
+}
+
+// Peek reports the quota usage for key without consuming any of it, against
+// the limit as lowered by the operator throttle.
+func (q *QuotaRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	periodStart, periodEnd := q.periodBounds(timestamp)
+	redisKey := q.periodKey(key, periodStart)
+
+	result, err := q.runRead(ctx, quotaPeekScript, q.redisClient, []string{redisKey, ThrottleKey}, q.limit).Result()
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) < 1 {
+		err = errors.New("invalid redis response from quota peek script")
+		return RateLimitResponse{Err: err}, err
+	}
+
+	used, err := getInt64FromResult(resultArray[0])
+	if err != nil {
+		err = fmt.Errorf("failed to parse used count: %w", err)
+		return RateLimitResponse{Err: err}, err
+	}
+
+	limit := limitFromResult(resultArray, 1, q.limit)
+	return q.buildResponse(used < limit, used, limit, periodStart, periodEnd, timestamp), nil
+}
+
+func (q *QuotaRateLimiter) Reset(ctx context.Context, key string) error {
+	periodStart, _ := q.periodBounds(time.Now())
+
+	_, err := q.redisClient.Del(ctx, q.periodKey(key, periodStart)).Result()
+	return err
+}
+
+// ResetPrefix deletes every period of every key starting with prefix.
+func (q *QuotaRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPrefix
+	}
+	return deleteMatching(ctx, q.redisClient, prefixPattern(q.keyPrefix, prefix))
+}
+
+// AddDebt charges n requests to the period containing timestamp.
+func (q *QuotaRateLimiter) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	if n <= 0 {
+		return nil
+	}
+
+	periodStart, periodEnd := q.periodBounds(timestamp)
+	expireAt := periodEnd.Unix() + q.ttlBuffer
+
+	return quotaDebtScript.Run(ctx, q.redisClient, []string{q.periodKey(key, periodStart), ThrottleKey}, n, expireAt).Err()
+}
+
+func (q *QuotaRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	if n <= 0 {
+		return nil
+	}
+
+	periodStart, _ := q.periodBounds(timestamp)
+
+	return quotaRefundScript.Run(ctx, q.redisClient, []string{q.periodKey(key, periodStart), ThrottleKey}, n).Err()
+}
+
+func (q *QuotaRateLimiter) buildResponse(allowed bool, used int64, limit int64, periodStart, periodEnd, timestamp time.Time) RateLimitResponse {
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	metadata := q.metadata
+	metadata.SetTime("period_start", periodStart)
+	metadata.SetInt("used", used)
+	markThrottled(&metadata, limit, q.limit)
+
+	if allowed {
+		return RateLimitResponse{
+			Allowed:   true,
+			Limit:     limit,
+			Remaining: remaining,
+			ResetTime: periodEnd,
+			Metadata:  metadata,
+		}
+	}
+
+	retryAfter := periodEnd.Sub(timestamp)
+	return RateLimitResponse{
+		Allowed:    false,
+		Limit:      limit,
+		Remaining:  0,
+		ResetTime:  periodEnd,
+		RetryAfter: &retryAfter,
+		Metadata:   metadata,
+	}
+}
+
+func (q *QuotaRateLimiter) periodKey(key string, periodStart time.Time) string {
+	return fmt.Sprintf("%s:%s:%d", q.keyPrefix, key, periodStart.Unix())
+}
+
+// periodBounds returns the UTC start and end of the quota period containing timestamp.
+func (q *QuotaRateLimiter) periodBounds(timestamp time.Time) (time.Time, time.Time) {
+	t := timestamp.UTC()
+
+	if q.period == QuotaPeriodDaily {
+		start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	}
+
+	start := time.Date(t.Year(), t.Month(), q.anchorDay, 0, 0, 0, 0, time.UTC)
+	if t.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start, start.AddDate(0, 1, 0)
+}
+
+type QuotaConstructor struct{}
+
+func (c *QuotaConstructor) Name() string {
+	return "quota"
+}
+
+func (c *QuotaConstructor) NewFromConfig(config map[string]interface{}, redisClient *redis.Client) (RateLimiter, error) {
+	options, err := DecodeOptions[QuotaConfig](config)
+	if err != nil {
+		return nil, fmt.Errorf("quota strategy: %w", err)
+	}
+	return NewQuotaRateLimiter(options, redisClient)
+}
+
+func (c *QuotaConstructor) ConvertConfig(rawConfig interface{}) (map[string]interface{}, error) {
+	cfg, ok := rawConfig.(config.QuotaConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected QuotaConfig, got %T", rawConfig)
+	}
+
+	return EncodeOptions(QuotaConfig{
+		Period:           cfg.Period,
+		Limit:            cfg.Limit,
+		AnchorDay:        cfg.AnchorDay,
+		KeyPrefix:        cfg.KeyPrefix,
+		TTLBufferSeconds: cfg.TTLBufferSeconds,
+	})
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewQuotaRateLimiter(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      QuotaConfig
+		expectError bool
+	}{
+		{
+			name:        "valid daily config",
+			config:      QuotaConfig{Period: QuotaPeriodDaily, Limit: 100, KeyPrefix: "test:"},
+			expectError: false,
+		},
+		{
+			name:        "valid monthly config with anchor",
+			config:      QuotaConfig{Period: QuotaPeriodMonthly, Limit: 100, AnchorDay: 15, KeyPrefix: "test:"},
+			expectError: false,
+		},
+		{
+			name:        "invalid limit",
+			config:      QuotaConfig{Period: QuotaPeriodDaily, Limit: 0},
+			expectError: true,
+		},
+		{
+			name:        "invalid period",
+			config:      QuotaConfig{Period: "weekly", Limit: 100},
+			expectError: true,
+		},
+		{
+			name:        "invalid anchor day",
+			config:      QuotaConfig{Period: QuotaPeriodMonthly, Limit: 100, AnchorDay: 31},
+			expectError: true,
+		},
+	}
+
+	mockRedis := &redis.Client{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := NewQuotaRateLimiter(tt.config, mockRedis)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, limiter)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, limiter)
+				assert.Equal(t, tt.config.Limit, limiter.limit)
+				assert.Equal(t, int64(DefaultTTLBufferSeconds), limiter.ttlBuffer)
+			}
+		})
+	}
+}
+
+func TestQuotaRateLimiter_periodBounds(t *testing.T) {
+	mockRedis := &redis.Client{}
+
+	daily, err := NewQuotaRateLimiter(QuotaConfig{Period: QuotaPeriodDaily, Limit: 10}, mockRedis)
+	assert.NoError(t, err)
+
+	start, end := daily.periodBounds(time.Date(2025, 3, 10, 17, 30, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC), end)
+
+	monthly, err := NewQuotaRateLimiter(QuotaConfig{Period: QuotaPeriodMonthly, Limit: 10, AnchorDay: 15}, mockRedis)
+	assert.NoError(t, err)
+
+	start, end = monthly.periodBounds(time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2025, 2, 15, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC), end)
+
+	start, end = monthly.periodBounds(time.Date(2025, 12, 20, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2025, 12, 15, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), end)
+}
+
+func TestQuotaRateLimiter_buildResponse(t *testing.T) {
+	limiter, err := NewQuotaRateLimiter(QuotaConfig{Period: QuotaPeriodDaily, Limit: 10}, &redis.Client{})
+	assert.NoError(t, err)
+
+	now := time.Date(2025, 3, 10, 18, 0, 0, 0, time.UTC)
+	start, end := limiter.periodBounds(now)
+
+	response := limiter.buildResponse(true, 4, 10, start, end, now)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(6), response.Remaining)
+	assert.Equal(t, end, response.ResetTime)
+	assert.Equal(t, QuotaPeriodDaily, response.Metadata.Value("quota_period"))
+
+	response = limiter.buildResponse(false, 10, 10, start, end, now)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, int64(0), response.Remaining)
+	assert.Equal(t, 6*time.Hour, *response.RetryAfter)
+}
+
+func TestQuotaRateLimiter_PeekThrottled(t *testing.T) {
+	ctx := context.Background()
+	client, server := newScriptRedis(t)
+	limiter, err := NewQuotaRateLimiter(QuotaConfig{Period: QuotaPeriodDaily, Limit: 10, KeyPrefix: "quota:"}, client)
+	require.NoError(t, err)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := limiter.IsAllowed(ctx, "client", now)
+		require.NoError(t, err)
+	}
+	require.NoError(t, server.Set(ThrottleKey, "0.2"))
+
+	response, err := limiter.Peek(ctx, "client", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed, "3 used is over the throttled limit of 2")
+	assert.Equal(t, int64(2), response.Limit)
+	assert.Equal(t, true, response.Metadata.Value("throttled"))
+}
+
+func TestQuotaConstructor(t *testing.T) {
+	constructor := &QuotaConstructor{}
+	assert.Equal(t, "quota", constructor.Name())
+
+	limiter, err := constructor.NewFromConfig(map[string]interface{}{
+		"period":             "daily",
+		"limit":              int64(50),
+		"anchor_day":         1,
+		"key_prefix":         "test:",
+		"ttl_buffer_seconds": 60,
+	}, &redis.Client{})
+	assert.NoError(t, err)
+	assert.NotNil(t, limiter)
+}
@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MinRedisVersion is the oldest Redis the scripts run on: they call TIME
+// before writing, which needs scripts to be replicated by effects, the
+// default since Redis 5.
+const MinRedisVersion = "5.0.0"
+
+// ProbeKey is the key every strategy is tried on at startup. The strategies
+// are built with it appended to their key prefix as well, so the probe
+// stays apart from real clients; see ProbeStrategies.
+const ProbeKey = "__startup_probe__"
+
+// RedisCapabilities describes the Redis server the limiter runs against, as
+// reported by INFO.
+type RedisCapabilities struct {
+	// Version is the server's version, or empty if INFO didn't report it,
+	// e.g. for Redis-compatible servers with a partial INFO.
+	Version string
+	// Cluster is set when the server runs in cluster mode.
+	Cluster bool
+	// Replica is set when the server is a read-only replica.
+	Replica bool
+	// Replicas is the number of replicas connected to the server, which
+	// reads could be sent to.
+	Replicas int
+	// Functions is set when the server has Redis Functions (Redis 7).
+	Functions bool
+}
+
+// DetectRedisCapabilities reads the capabilities of client's server.
+func DetectRedisCapabilities(ctx context.Context, client redis.Cmdable) (RedisCapabilities, error) {
+	info, err := client.Info(ctx).Result()
+	if err != nil {
+		return RedisCapabilities{}, fmt.Errorf("failed to read redis INFO: %w", err)
+	}
+	return parseRedisInfo(info), nil
+}
+
+func parseRedisInfo(info string) RedisCapabilities {
+	var capabilities RedisCapabilities
+	for _, line := range strings.Split(info, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		switch name {
+		case "redis_version":
+			capabilities.Version = value
+		case "cluster_enabled":
+			capabilities.Cluster = value == "1"
+		case "role":
+			capabilities.Replica = value == "slave" || value == "replica"
+		case "connected_slaves":
+			capabilities.Replicas, _ = strconv.Atoi(value)
+		}
+	}
+	capabilities.Functions = capabilities.Version != "" && compareVersions(capabilities.Version, "7.0.0") >= 0
+	return capabilities
+}
+
+func (c RedisCapabilities) String() string {
+	version := c.Version
+	if version == "" {
+		version = "unknown version"
+	}
+	var traits []string
+	if c.Cluster {
+		traits = append(traits, "cluster mode")
+	}
+	if c.Replica {
+		traits = append(traits, "replica")
+	} else {
+		traits = append(traits, fmt.Sprintf("%d replicas", c.Replicas))
+	}
+	if c.Functions {
+		traits = append(traits, "functions")
+	}
+	return fmt.Sprintf("Redis %s (%s)", version, strings.Join(traits, ", "))
+}
+
+// Check reports every capability the limiter needs that the server lacks,
+// functions being needed when the scripts run as Redis Functions. An
+// unknown version is given the benefit of the doubt.
+func (c RedisCapabilities) Check(functions bool) error {
+	var errs []error
+	if c.Version != "" && compareVersions(c.Version, MinRedisVersion) < 0 {
+		errs = append(errs, fmt.Errorf("redis %s is older than %s, the oldest version the scripts run on", c.Version, MinRedisVersion))
+	}
+	if c.Cluster {
+		errs = append(errs, errors.New("redis runs in cluster mode, which the limiter doesn't support; its scripts touch several keys that cluster mode may place on different nodes"))
+	}
+	if c.Replica {
+		errs = append(errs, errors.New("redis is a read-only replica; point redis.host at the primary"))
+	}
+	if functions && c.Version != "" && !c.Functions {
+		errs = append(errs, fmt.Errorf("redis.functions needs Redis 7, the server runs %s", c.Version))
+	}
+	return errors.Join(errs...)
+}
+
+// compareVersions compares dotted versions such as "7.2.4" numerically,
+// treating missing parts as 0.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range max(len(as), len(bs)) {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// ProbeStrategy runs rateLimiter's scripts once against ProbeKey: a
+// decision, then a peek and a refund when it has them, and a reset to clean
+// up. An error means the strategy would fail on every request, e.g. because
+// a script doesn't run on the server.
+func ProbeStrategy(ctx context.Context, rateLimiter RateLimiter) error {
+	now := time.Now()
+	if _, err := rateLimiter.IsAllowed(ctx, ProbeKey, now); err != nil {
+		return fmt.Errorf("decide: %w", err)
+	}
+	if peeker, ok := rateLimiter.(Peeker); ok {
+		if _, err := peeker.Peek(ctx, ProbeKey, now); err != nil && !errors.Is(err, ErrPeekNotSupported) {
+			return fmt.Errorf("peek: %w", err)
+		}
+	}
+	if refunder, ok := rateLimiter.(Refunder); ok && SupportsRefund(rateLimiter) {
+		if err := refunder.Refund(ctx, ProbeKey, 1, now); err != nil {
+			return fmt.Errorf("refund: %w", err)
+		}
+	}
+	if err := rateLimiter.Reset(ctx, ProbeKey); err != nil {
+		return fmt.Errorf("reset: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRedisInfo(t *testing.T) {
+	info := "# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n\r\n" +
+		"# Replication\r\nrole:master\r\nconnected_slaves:2\r\n\r\n" +
+		"# Cluster\r\ncluster_enabled:0\r\n"
+	assert.Equal(t, RedisCapabilities{Version: "7.2.4", Replicas: 2, Functions: true}, parseRedisInfo(info))
+
+	info = "redis_version:6.2.14\nrole:slave\ncluster_enabled:1\n"
+	assert.Equal(t, RedisCapabilities{Version: "6.2.14", Replica: true, Cluster: true}, parseRedisInfo(info))
+
+	assert.Equal(t, RedisCapabilities{}, parseRedisInfo("# Clients\nconnected_clients:1\n"))
+}
+
+func TestRedisCapabilities_Check(t *testing.T) {
+	assert.NoError(t, RedisCapabilities{Version: "7.0.0", Functions: true}.Check(true))
+	assert.NoError(t, RedisCapabilities{Version: "6.2.14"}.Check(false))
+	assert.NoError(t, RedisCapabilities{}.Check(true), "an unknown version passes")
+
+	err := RedisCapabilities{Version: "4.0.14", Cluster: true, Replica: true}.Check(true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "older than 5.0.0")
+	assert.Contains(t, err.Error(), "cluster mode")
+	assert.Contains(t, err.Error(), "replica")
+	assert.Contains(t, err.Error(), "redis.functions needs Redis 7")
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Zero(t, compareVersions("7.0", "7.0.0"))
+	assert.Negative(t, compareVersions("6.2.14", "7.0.0"))
+	assert.Positive(t, compareVersions("10.0.0", "7.2.4"))
+}
+
+func TestProbeStrategy(t *testing.T) {
+	client, server := newScriptRedis(t)
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 2, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+
+	require.NoError(t, ProbeStrategy(context.Background(), bucket))
+	assert.False(t, server.Exists("tb:"+ProbeKey), "the probe key is reset")
+
+	broken := &MockRateLimiterForFactory{}
+	broken.On("IsAllowed", mock.Anything, ProbeKey, mock.Anything).Return(RateLimitResponse{}, errors.New("ERR Error compiling script"))
+	err = ProbeStrategy(context.Background(), broken)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "decide: ERR Error compiling script")
+}
@@ -0,0 +1,185 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exhaustAndRefund uses up a three-request budget, refunds two requests and
+// checks that exactly two more requests are then allowed.
+func exhaustAndRefund(t *testing.T, rateLimiter RateLimiter, now time.Time) {
+	t.Helper()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		response, err := rateLimiter.IsAllowed(ctx, "client", now)
+		require.NoError(t, err)
+		require.True(t, response.Allowed)
+	}
+	response, err := rateLimiter.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	require.False(t, response.Allowed)
+
+	require.True(t, SupportsRefund(rateLimiter))
+	require.NoError(t, rateLimiter.(Refunder).Refund(ctx, "client", 2, now))
+
+	for i := 0; i < 2; i++ {
+		response, err = rateLimiter.IsAllowed(ctx, "client", now)
+		require.NoError(t, err)
+		assert.True(t, response.Allowed, "refunded requests should free up capacity")
+	}
+	response, err = rateLimiter.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed, "only two requests should be refunded")
+}
+
+func TestRefund_Strategies(t *testing.T) {
+	t.Run("token_bucket", func(t *testing.T) {
+		client, _ := newScriptRedis(t)
+		rateLimiter, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 3, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+		require.NoError(t, err)
+		exhaustAndRefund(t, rateLimiter, time.Unix(0, scriptNow))
+	})
+
+	t.Run("token_bucket_global", func(t *testing.T) {
+		client, server := newScriptRedis(t)
+		rateLimiter, err := NewTokenBucketRateLimiter(TokenBucketConfig{
+			BucketSize: 5, RefillRatePerSecond: 1, GlobalBucketSize: 3, GlobalRefillRatePerSecond: 1, KeyPrefix: "tb",
+		}, client)
+		require.NoError(t, err)
+		exhaustAndRefund(t, rateLimiter, time.Unix(0, scriptNow))
+		assert.Equal(t, "0", server.HGet("tb:"+GlobalBucketKey, "tokens"))
+	})
+
+	t.Run("sliding_window_log", func(t *testing.T) {
+		client, _ := newScriptRedis(t)
+		rateLimiter, err := NewSlidingWindowLogRateLimiter(SlidingWindowLogConfig{WindowSize: time.Minute, BucketSize: 3, KeyPrefix: "swl"}, client)
+		require.NoError(t, err)
+		exhaustAndRefund(t, rateLimiter, time.Unix(0, scriptNow))
+	})
+
+	t.Run("sliding_window_counter", func(t *testing.T) {
+		client, _ := newScriptRedis(t)
+		rateLimiter, err := NewSlidingWindowCounterRateLimiter(SlidingWindowCounterConfig{WindowSize: time.Minute, BucketSize: 3, KeyPrefix: "swc"}, client)
+		require.NoError(t, err)
+		exhaustAndRefund(t, rateLimiter, time.Unix(0, scriptNow))
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		client, _ := newScriptRedis(t)
+		rateLimiter, err := NewQuotaRateLimiter(QuotaConfig{Period: QuotaPeriodDaily, Limit: 3, KeyPrefix: "quota"}, client)
+		require.NoError(t, err)
+		// Quota keys expire at the end of the period, so use the real clock.
+		exhaustAndRefund(t, rateLimiter, time.Now())
+	})
+}
+
+func TestRefund_NeverExceedsLimit(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := context.Background()
+	now := time.Unix(0, scriptNow)
+
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 3, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	_, err = bucket.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	require.NoError(t, bucket.Refund(ctx, "client", 5, now))
+	assert.Equal(t, "3", server.HGet("tb:client", "tokens"))
+	server.FlushAll()
+
+	quota, err := NewQuotaRateLimiter(QuotaConfig{Period: QuotaPeriodDaily, Limit: 2, KeyPrefix: "quota"}, client)
+	require.NoError(t, err)
+	require.NoError(t, quota.Refund(ctx, "client", 1, now))
+	assert.Empty(t, server.Keys(), "refunding an unused quota should not create a key")
+}
+
+func TestRefund_TokenBucketRollover(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := context.Background()
+	now := time.Unix(0, scriptNow)
+
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 3, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	allowed := func(at time.Time) int {
+		t.Helper()
+		count := 0
+		for i := 0; i < 5; i++ {
+			response, err := bucket.IsAllowed(ctx, "client", at)
+			require.NoError(t, err)
+			if response.Allowed {
+				count++
+			}
+		}
+		return count
+	}
+
+	require.Equal(t, 3, allowed(now))
+
+	// By the refund the bucket has refilled, so the refund can't add to it.
+	later := now.Add(10 * time.Second)
+	require.NoError(t, bucket.Refund(ctx, "client", 2, now))
+	assert.Equal(t, 3, allowed(later), "a refund after the bucket refilled frees nothing beyond its size")
+
+	// The charged bucket was reset and a new one started before the refund.
+	require.NoError(t, bucket.Reset(ctx, "client"))
+	assert.Equal(t, 3, allowed(later.Add(time.Second)))
+	require.NoError(t, bucket.Refund(ctx, "client", 2, later))
+	assert.Equal(t, "0", server.HGet("tb:client", "tokens"), "a refund doesn't reach a bucket created after its charge")
+
+	// Refunds of charges the bucket took still count.
+	require.NoError(t, bucket.Refund(ctx, "client", 2, later.Add(time.Second)))
+	assert.Equal(t, "2", server.HGet("tb:client", "tokens"))
+
+	// The key expired since the charge.
+	server.FlushAll()
+	require.NoError(t, bucket.Refund(ctx, "client", 2, later))
+	assert.Empty(t, server.Keys(), "refunding an expired bucket should not create it")
+
+	// Buckets from before created_nanos are refunded as they were.
+	server.HSet("tb:client", "tokens", "0", "last_refill_time_nanos", strconv.FormatInt(later.UnixNano(), 10))
+	require.NoError(t, bucket.Refund(ctx, "client", 1, now))
+	assert.Equal(t, "1", server.HGet("tb:client", "tokens"))
+}
+
+func TestRefund_TokenBucketConcurrent(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := context.Background()
+	now := time.Unix(0, scriptNow)
+
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 5, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err := bucket.IsAllowed(ctx, "client", now)
+		require.NoError(t, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, bucket.Refund(ctx, "client", 1, now))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, "5", server.HGet("tb:client", "tokens"), "concurrent refunds stop at the bucket size")
+}
+
+func TestRefund_ThroughPolicy(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 3, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+
+	policy := NewPolicy("default", bucket, nil)
+	assert.True(t, SupportsRefund(policy))
+	exhaustAndRefund(t, policy, time.Unix(0, scriptNow))
+
+	assert.False(t, SupportsRefund(NewPolicy("mock", &MockRateLimiterForFactory{}, nil)))
+	assert.ErrorIs(t, NewPolicy("mock", &MockRateLimiterForFactory{}, nil).Refund(context.Background(), "client", 1, time.Now()), ErrRefundNotSupported)
+}
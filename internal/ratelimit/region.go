@@ -0,0 +1,297 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// RegionDemandKeyPrefix prefixes the per-interval request counts each
+	// region publishes in its own Redis for the others to read.
+	RegionDemandKeyPrefix = "rl:region:demand:"
+
+	DefaultReconcileInterval = 10 * time.Second
+
+	// shareTolerance is how far a reconciled share may drift from the one in
+	// use before the limiter is rebuilt.
+	shareTolerance = 0.01
+)
+
+var ErrInvalidRegion = errors.New("invalid region config")
+
+type RegionConfig struct {
+	// Name is this region; it must be one of the Shares.
+	Name string
+	// Shares splits the global limit between regions, e.g. {"us": 0.6,
+	// "eu": 0.4}, and must add up to 1.
+	Shares map[string]float64
+	// Peers reach the other regions' Redis to read their demand. Until every
+	// region's demand is known the configured shares are used.
+	Peers map[string]*redis.Client
+	// ReconcileInterval is how often demand is published and shares are
+	// recomputed.
+	ReconcileInterval time.Duration
+	// MinShareFraction of each configured share is kept whatever the demand;
+	// the rest is split by demand. 1 keeps the shares static.
+	MinShareFraction float64
+}
+
+type regionalLimiter struct {
+	rateLimiter RateLimiter
+	share       float64
+}
+
+// RegionalRateLimiter enforces this region's share of a global limit against
+// its own Redis, so no request waits on another region. Each instance counts
+// its requests and periodically adds them to the region's demand; every
+// region then reads the others' demand from their Redis and moves its share
+// towards its part of the total traffic. Regions compute the same shares
+// from the same counts, so together they stay close to the global limit.
+type RegionalRateLimiter struct {
+	name        string
+	shares      map[string]float64
+	peers       map[string]*redis.Client
+	redisClient *redis.Client
+	interval    time.Duration
+	minFraction float64
+	build       func(share float64) (RateLimiter, error)
+
+	current atomic.Pointer[regionalLimiter]
+	demand  atomic.Int64
+}
+
+// NewRegionalRateLimiter builds the limiter through build, which must return
+// the global limits scaled by share.
+func NewRegionalRateLimiter(redisClient *redis.Client, config RegionConfig, build func(share float64) (RateLimiter, error)) (*RegionalRateLimiter, error) {
+	share, exists := config.Shares[config.Name]
+	if !exists {
+		return nil, fmt.Errorf("%w: region %q has no share", ErrInvalidRegion, config.Name)
+	}
+
+	total := 0.0
+	for region, regionShare := range config.Shares {
+		if regionShare <= 0 || regionShare > 1 {
+			return nil, fmt.Errorf("%w: share of %s must be in (0, 1]", ErrInvalidRegion, region)
+		}
+		total += regionShare
+	}
+	if math.Abs(total-1) > 0.001 {
+		return nil, fmt.Errorf("%w: shares add up to %g, not 1", ErrInvalidRegion, total)
+	}
+
+	for region := range config.Peers {
+		if _, exists := config.Shares[region]; !exists || region == config.Name {
+			return nil, fmt.Errorf("%w: peer %s is not another region with a share", ErrInvalidRegion, region)
+		}
+	}
+
+	if config.MinShareFraction < 0 || config.MinShareFraction > 1 {
+		return nil, fmt.Errorf("%w: min share fraction must be between 0 and 1", ErrInvalidRegion)
+	}
+	if config.ReconcileInterval == 0 {
+		config.ReconcileInterval = DefaultReconcileInterval
+	}
+	if config.ReconcileInterval < time.Second {
+		return nil, fmt.Errorf("%w: reconcile interval must be at least 1s", ErrInvalidRegion)
+	}
+
+	r := &RegionalRateLimiter{
+		name:        config.Name,
+		shares:      config.Shares,
+		peers:       config.Peers,
+		redisClient: redisClient,
+		interval:    config.ReconcileInterval,
+		minFraction: config.MinShareFraction,
+		build:       build,
+	}
+	if err := r.setShare(share); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Share returns the fraction of the global limit this region enforces now.
+func (r *RegionalRateLimiter) Share() float64 {
+	return r.current.Load().share
+}
+
+// Start reconciles every interval until ctx is done.
+func (r *RegionalRateLimiter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := r.Reconcile(ctx, now); err != nil {
+					slog.Warn("region reconciliation failed", "region", r.name, "error", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// Reconcile publishes this instance's demand since the last call and
+// recomputes the share from the previous interval's demand of every region.
+func (r *RegionalRateLimiter) Reconcile(ctx context.Context, now time.Time) error {
+	bucket := now.Truncate(r.interval).Unix()
+
+	if demand := r.demand.Swap(0); demand > 0 {
+		key := r.demandKey(r.name, bucket)
+		_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.IncrBy(ctx, key, demand)
+			pipe.Expire(ctx, key, 3*r.interval)
+			return nil
+		})
+		if err != nil {
+			r.demand.Add(demand)
+			return err
+		}
+	}
+
+	demands := make(map[string]int64, len(r.shares))
+	previous := bucket - int64(r.interval.Seconds())
+	for region := range r.shares {
+		client := r.redisClient
+		if region != r.name {
+			client = r.peers[region]
+		}
+		if client == nil {
+			return r.setShare(r.shares[r.name])
+		}
+
+		demand, err := client.Get(ctx, r.demandKey(region, previous)).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			// An unreachable region may be using its full configured share.
+			slog.Warn("failed to read region demand", "region", region, "error", err.Error())
+			return r.setShare(r.shares[r.name])
+		}
+		demands[region] = demand
+	}
+
+	return r.setShare(r.reconciledShare(demands))
+}
+
+// reconciledShare gives each region MinShareFraction of its configured share
+// and splits the rest by demand.
+func (r *RegionalRateLimiter) reconciledShare(demands map[string]int64) float64 {
+	var total int64
+	for _, demand := range demands {
+		total += demand
+	}
+	if total == 0 {
+		return r.shares[r.name]
+	}
+
+	floor := r.shares[r.name] * r.minFraction
+	remainder := 1 - r.minFraction
+	return floor + remainder*float64(demands[r.name])/float64(total)
+}
+
+func (r *RegionalRateLimiter) setShare(share float64) error {
+	current := r.current.Load()
+	if current != nil && math.Abs(current.share-share) < shareTolerance {
+		return nil
+	}
+
+	rateLimiter, err := r.build(share)
+	if err != nil {
+		return fmt.Errorf("region %s share %.3f: %w", r.name, share, err)
+	}
+	r.current.Store(&regionalLimiter{rateLimiter: rateLimiter, share: share})
+	if current != nil {
+		slog.Info("region share changed", "region", r.name, "from", current.share, "to", share)
+	}
+	return nil
+}
+
+func (r *RegionalRateLimiter) demandKey(region string, bucket int64) string {
+	return RegionDemandKeyPrefix + region + ":" + strconv.FormatInt(bucket, 10)
+}
+
+func (r *RegionalRateLimiter) limiter() RateLimiter {
+	return r.current.Load().rateLimiter
+}
+
+func (r *RegionalRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	r.demand.Add(1)
+	return r.limiter().IsAllowed(ctx, key, timestamp)
+}
+
+func (r *RegionalRateLimiter) AllowN(ctx context.Context, key string, n int64, timestamp time.Time) (int64, RateLimitResponse, error) {
+	batcher, ok := r.limiter().(BatchRateLimiter)
+	if !ok {
+		return 0, RateLimitResponse{Err: ErrBatchNotSupported}, ErrBatchNotSupported
+	}
+	r.demand.Add(n)
+	return batcher.AllowN(ctx, key, n, timestamp)
+}
+
+func (r *RegionalRateLimiter) SupportsBatch() bool {
+	return SupportsBatch(r.limiter())
+}
+
+func (r *RegionalRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	peeker, ok := r.limiter().(Peeker)
+	if !ok {
+		return RateLimitResponse{Err: ErrPeekNotSupported}, ErrPeekNotSupported
+	}
+	return peeker.Peek(ctx, key, timestamp)
+}
+
+// Reset clears key in this region only.
+func (r *RegionalRateLimiter) Reset(ctx context.Context, key string) error {
+	return r.limiter().Reset(ctx, key)
+}
+
+func (r *RegionalRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	resetter, ok := r.limiter().(PrefixResetter)
+	if !ok {
+		return 0, ErrResetPrefixNotSupported
+	}
+	return resetter.ResetPrefix(ctx, prefix)
+}
+
+func (r *RegionalRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	refunder, ok := r.limiter().(Refunder)
+	if !ok {
+		return ErrRefundNotSupported
+	}
+	return refunder.Refund(ctx, key, n, timestamp)
+}
+
+func (r *RegionalRateLimiter) SupportsRefund() bool {
+	return SupportsRefund(r.limiter())
+}
+
+func (r *RegionalRateLimiter) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	debtor, ok := r.limiter().(Debtor)
+	if !ok {
+		return ErrDebtNotSupported
+	}
+	return debtor.AddDebt(ctx, key, n, timestamp)
+}
+
+func (r *RegionalRateLimiter) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error) {
+	reserver, ok := r.limiter().(Reserver)
+	if !ok {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: ErrReserveNotSupported}}, ErrReserveNotSupported
+	}
+	r.demand.Add(n)
+	return reserver.ReserveN(ctx, key, n, timestamp, maxDelay)
+}
+
+func (r *RegionalRateLimiter) SupportsReserve() bool {
+	return SupportsReserve(r.limiter())
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRegion builds a regional token bucket over a global limit of 100
+// requests, recording the shares it was built with.
+func newRegion(t *testing.T, client *redis.Client, config RegionConfig) (*RegionalRateLimiter, *[]float64) {
+	t.Helper()
+	var built []float64
+	regional, err := NewRegionalRateLimiter(client, config, func(share float64) (RateLimiter, error) {
+		built = append(built, share)
+		scaled, err := ScaleLimits(map[string]interface{}{
+			"bucket_size":            int64(100),
+			"refill_rate_per_second": int64(1),
+			"key_prefix":             "tb",
+			"ttl_buffer_seconds":     60,
+		}, share, "")
+		if err != nil {
+			return nil, err
+		}
+		return (&TokenBucketConstructor{}).NewFromConfig(scaled, client)
+	})
+	require.NoError(t, err)
+	return regional, &built
+}
+
+func TestNewRegionalRateLimiter_Validation(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	build := func(share float64) (RateLimiter, error) { return nil, nil }
+
+	for name, config := range map[string]RegionConfig{
+		"unknown region":   {Name: "ap", Shares: map[string]float64{"us": 0.6, "eu": 0.4}},
+		"shares not 1":     {Name: "us", Shares: map[string]float64{"us": 0.6, "eu": 0.6}},
+		"peer without one": {Name: "us", Shares: map[string]float64{"us": 1}, Peers: map[string]*redis.Client{"eu": client}},
+		"self as peer":     {Name: "us", Shares: map[string]float64{"us": 1}, Peers: map[string]*redis.Client{"us": client}},
+		"bad fraction":     {Name: "us", Shares: map[string]float64{"us": 1}, MinShareFraction: 2},
+		"short interval":   {Name: "us", Shares: map[string]float64{"us": 1}, ReconcileInterval: time.Millisecond},
+	} {
+		_, err := NewRegionalRateLimiter(client, config, build)
+		assert.ErrorIs(t, err, ErrInvalidRegion, name)
+	}
+}
+
+func TestRegionalRateLimiter_EnforcesShare(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	regional, _ := newRegion(t, client, RegionConfig{Name: "us", Shares: map[string]float64{"us": 0.6, "eu": 0.4}})
+
+	now := time.Unix(0, scriptNow)
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		response, err := regional.IsAllowed(context.Background(), "client", now)
+		require.NoError(t, err)
+		if response.Allowed {
+			allowed++
+		}
+	}
+	assert.Equal(t, 60, allowed)
+	assert.Equal(t, 0.6, regional.Share())
+}
+
+func TestRegionalRateLimiter_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	usClient, usServer := newScriptRedis(t)
+	euClient, euServer := newScriptRedis(t)
+
+	config := RegionConfig{
+		Shares:            map[string]float64{"us": 0.6, "eu": 0.4},
+		ReconcileInterval: 10 * time.Second,
+		MinShareFraction:  0.5,
+	}
+	usConfig := config
+	usConfig.Name, usConfig.Peers = "us", map[string]*redis.Client{"eu": euClient}
+	us, built := newRegion(t, usClient, usConfig)
+
+	now := time.Unix(1_700_000_000, 0)
+	previous := strconv.FormatInt(now.Truncate(config.ReconcileInterval).Unix()-10, 10)
+
+	// With no demand recorded anywhere the configured share stays.
+	require.NoError(t, us.Reconcile(ctx, now))
+	assert.Equal(t, 0.6, us.Share())
+
+	// Requests served here are added to this region's current bucket.
+	for i := 0; i < 3; i++ {
+		_, err := us.IsAllowed(ctx, "client", time.Unix(0, scriptNow))
+		require.NoError(t, err)
+	}
+	require.NoError(t, us.Reconcile(ctx, now))
+	current := strconv.FormatInt(now.Truncate(config.ReconcileInterval).Unix(), 10)
+	demand, err := usServer.Get(RegionDemandKeyPrefix + "us:" + current)
+	require.NoError(t, err)
+	assert.Equal(t, "3", demand)
+
+	// Europe saw three times the traffic in the last interval, so it gets
+	// most of the flexible half: us = 0.3 + 0.5 * 100/400.
+	require.NoError(t, usServer.Set(RegionDemandKeyPrefix+"us:"+previous, "100"))
+	require.NoError(t, euServer.Set(RegionDemandKeyPrefix+"eu:"+previous, "300"))
+	require.NoError(t, us.Reconcile(ctx, now))
+	assert.InDelta(t, 0.425, us.Share(), 1e-9)
+	assert.Len(t, *built, 2, "the limiter is rebuilt when the share moves")
+
+	// An unreachable peer falls back to the configured share.
+	euServer.Close()
+	require.NoError(t, us.Reconcile(ctx, now))
+	assert.Equal(t, 0.6, us.Share())
+}
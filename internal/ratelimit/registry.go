@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"fmt"
+	"plugin"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]StrategyConstructor)
+)
+
+// Register makes a strategy available to every Factory created afterwards,
+// next to the built-in ones, so custom strategies don't need changes to the
+// factory. Like database/sql.Register it is meant to be called from an init
+// function, and panics if constructor is nil or its name is already taken.
+// Its config is read from rate_limiter.strategies.custom.<name>.
+func Register(constructor StrategyConstructor) {
+	if constructor == nil {
+		panic("ratelimit: Register constructor is nil")
+	}
+
+	name := constructor.Name()
+	if slices.Contains(config.Strategies, name) {
+		panic(fmt.Sprintf("ratelimit: Register called for built-in strategy %s", name))
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("ratelimit: Register called twice for strategy %s", name))
+	}
+	registry[name] = constructor
+}
+
+// RegisteredStrategies returns the names of the registered strategies, sorted.
+func RegisteredStrategies() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func registeredConstructors() []StrategyConstructor {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	constructors := make([]StrategyConstructor, 0, len(registry))
+	for _, constructor := range registry {
+		constructors = append(constructors, constructor)
+	}
+	return constructors
+}
+
+// LoadPlugins opens the Go plugins at paths, whose init functions register
+// their strategies with Register. Plugins have to be built with
+// -buildmode=plugin from this module, with the same Go version and
+// dependency versions as the server, and are only supported on Linux,
+// FreeBSD and macOS with cgo enabled.
+func LoadPlugins(paths []string) error {
+	for _, path := range paths {
+		registered := len(RegisteredStrategies())
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("failed to load plugin %s: %w", path, err)
+		}
+		if len(RegisteredStrategies()) == registered {
+			return fmt.Errorf("plugin %s registered no strategies", path)
+		}
+	}
+	return nil
+}
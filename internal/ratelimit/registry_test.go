@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registeredBucket is a token bucket registered under another name, as a
+// third-party strategy would be.
+func registeredBucket(name string) StrategyConstructor {
+	return &TypedConstructor[TokenBucketConfig]{
+		StrategyName: name,
+		Convert: func(rawConfig interface{}) (TokenBucketConfig, error) {
+			section, ok := rawConfig.(map[string]interface{})
+			if !ok {
+				return TokenBucketConfig{}, fmt.Errorf("expected a config section, got %T", rawConfig)
+			}
+			return TokenBucketConfig{
+				KeyPrefix:           section["key_prefix"].(string),
+				BucketSize:          int64(section["capacity"].(int)),
+				RefillRatePerSecond: 1,
+			}, nil
+		},
+		New: func(options TokenBucketConfig, redisClient *redis.Client) (RateLimiter, error) {
+			return NewTokenBucketRateLimiter(options, redisClient)
+		},
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register(registeredBucket("registered_bucket"))
+	t.Cleanup(func() {
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		delete(registry, "registered_bucket")
+	})
+	assert.Contains(t, RegisteredStrategies(), "registered_bucket")
+	assert.Contains(t, NewFactory(nil).GetAvailableStrategies(), "registered_bucket")
+	assert.Contains(t, NewFactory(nil).WithPostgres(NewPostgresStore(&fakePostgres{})).GetAvailableStrategies(), "registered_bucket")
+
+	assert.Panics(t, func() { Register(registeredBucket("registered_bucket")) }, "names are unique")
+	assert.Panics(t, func() { Register(registeredBucket("token_bucket")) }, "built-in names are taken")
+	assert.Panics(t, func() { Register(nil) })
+
+	client, _ := newScriptRedis(t)
+	manager := NewConfigBasedStrategyManager(&config.RateLimiterConfig{
+		Strategy: "registered_bucket",
+		Strategies: config.RateLimiterStrategiesConfig{
+			Custom: map[string]map[string]interface{}{
+				"registered_bucket": {"key_prefix": "rb:", "capacity": 2},
+			},
+		},
+	}, client, metrics.NewRegistry("default", metrics.NewNoopCollector()))
+
+	rateLimiter, err := manager.GetCurrentStrategy()
+	require.NoError(t, err)
+	response, err := rateLimiter.IsAllowed(context.Background(), "client", time.Now())
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(2), response.Limit)
+	assert.Equal(t, "rb:", manager.KeyPrefixes()["registered_bucket"])
+}
+
+func TestLoadPlugins(t *testing.T) {
+	require.NoError(t, LoadPlugins(nil))
+	assert.Error(t, LoadPlugins([]string{t.TempDir() + "/missing.so"}))
+}
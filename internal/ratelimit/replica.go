@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// readClientSetter is implemented by strategies that can send their
+// read-only operations, such as Peek, to a replica.
+type readClientSetter interface {
+	setReadClient(client *redis.Client)
+}
+
+// replicaReads holds the replica a limiter reads from. Without one, reads go
+// to the primary like everything else.
+type replicaReads struct {
+	readClient *redis.Client
+}
+
+func (r *replicaReads) setReadClient(client *redis.Client) {
+	r.readClient = client
+}
+
+// reader returns the client reads should use.
+func (r *replicaReads) reader(primary *redis.Client) *redis.Client {
+	if r.readClient != nil {
+		return r.readClient
+	}
+	return primary
+}
+
+// runRead runs a script that only reads, on the replica when there is one.
+// The replica always gets it with EVALSHA: a read-only replica refuses
+// FCALL for functions not flagged no-writes, but runs plain scripts that
+// don't write.
+func (r *replicaReads) runRead(ctx context.Context, script *luaScript, primary *redis.Client, keys []string, args ...interface{}) *redis.Cmd {
+	if r.readClient == nil {
+		return script.Run(ctx, primary, keys, args...)
+	}
+	return script.Script.Run(ctx, r.readClient, keys, args...)
+}
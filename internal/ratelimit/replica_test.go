@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicaReads_Peek(t *testing.T) {
+	primary, primaryServer := newScriptRedis(t)
+	replica, replicaServer := newScriptRedis(t)
+	manager := NewConfigBasedStrategyManager(&config.RateLimiterConfig{
+		Strategy: "token_bucket",
+		Strategies: config.RateLimiterStrategiesConfig{
+			TokenBucket: config.TokenBucketConfig{KeyPrefix: "tb", TTLBufferSeconds: 60, BucketSize: 10, RefillRatePerSecond: 1},
+		},
+	}, primary, metrics.NewRegistry("default", metrics.NewNoopCollector())).WithReadClient(replica)
+
+	rateLimiter, err := manager.GetCurrentStrategy()
+	require.NoError(t, err)
+	now := time.Unix(0, scriptNow)
+	_, err = rateLimiter.IsAllowed(context.Background(), "client", now)
+	require.NoError(t, err)
+	assert.True(t, primaryServer.Exists("tb:client"), "decisions go to the primary")
+	assert.False(t, replicaServer.Exists("tb:client"))
+
+	// The replica hasn't caught up, so it still sees a full bucket.
+	response, err := rateLimiter.(Peeker).Peek(context.Background(), "client", now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), response.Remaining)
+}
+
+func TestReplicaReads_Quota(t *testing.T) {
+	primary, _ := newScriptRedis(t)
+	replica, replicaServer := newScriptRedis(t)
+	quota, err := NewQuotaRateLimiter(QuotaConfig{Period: QuotaPeriodDaily, Limit: 5, KeyPrefix: "q"}, primary)
+	require.NoError(t, err)
+	quota.setReadClient(replica)
+
+	now := time.Now()
+	periodStart, _ := quota.periodBounds(now)
+	require.NoError(t, replicaServer.Set(quota.periodKey("client", periodStart), "3"))
+
+	response, err := quota.Peek(context.Background(), "client", now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), response.Remaining)
+}
+
+func TestKeyUsage_ReadClient(t *testing.T) {
+	primary, _ := newScriptRedis(t)
+	replica, replicaServer := newScriptRedis(t)
+	require.NoError(t, replicaServer.Set("rl:tb::client", "1"))
+
+	usage := NewKeyUsage(primary, map[string]string{"token_bucket": "rl:tb:"}, 10, 0).WithReadClient(replica)
+	report, err := usage.Report(context.Background(), KeyUsageOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), report.TotalKeys, "keys are scanned on the replica")
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket_ReserveN(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := context.Background()
+	now := time.Unix(0, scriptNow)
+
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 4, RefillRatePerSecond: 2, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	require.True(t, SupportsReserve(bucket))
+
+	reservation, err := bucket.ReserveN(ctx, "client", 3, now, time.Second)
+	require.NoError(t, err)
+	assert.True(t, reservation.Allowed)
+	assert.Zero(t, reservation.Delay)
+	assert.Equal(t, int64(1), reservation.Remaining)
+
+	// Two more tokens put the bucket one into debt, repaid at 2 tokens/s.
+	reservation, err = bucket.ReserveN(ctx, "client", 2, now, time.Second)
+	require.NoError(t, err)
+	assert.True(t, reservation.Allowed)
+	assert.Equal(t, 500*time.Millisecond, reservation.Delay)
+	assert.Equal(t, int64(0), reservation.Remaining)
+	assert.Equal(t, "-1", server.HGet("tb:client", "tokens"))
+
+	// Waiting 1.5s is over the limit, so nothing is taken.
+	reservation, err = bucket.ReserveN(ctx, "client", 2, now, time.Second)
+	require.NoError(t, err)
+	assert.False(t, reservation.Allowed)
+	require.NotNil(t, reservation.RetryAfter)
+	assert.Equal(t, 500*time.Millisecond, *reservation.RetryAfter)
+	assert.Equal(t, "-1", server.HGet("tb:client", "tokens"))
+
+	response, err := bucket.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed, "callers without a reservation wait behind the debt")
+
+	reservation, err = bucket.ReserveN(ctx, "client", 5, now, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, reservation.Allowed)
+	assert.Nil(t, reservation.RetryAfter)
+	assert.Equal(t, true, reservation.Metadata.Value("exceeds_bucket_size"))
+
+	_, err = bucket.ReserveN(ctx, "client", 0, now, time.Second)
+	assert.Error(t, err)
+}
+
+func TestTokenBucket_ReserveNWithGlobalBucket(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{
+		BucketSize: 4, RefillRatePerSecond: 2, GlobalBucketSize: 10, GlobalRefillRatePerSecond: 1,
+	}, client)
+	require.NoError(t, err)
+
+	assert.False(t, SupportsReserve(bucket))
+	_, err = bucket.ReserveN(context.Background(), "client", 1, time.Now(), time.Second)
+	assert.ErrorIs(t, err, ErrReserveNotSupported)
+}
+
+func TestPolicy_ReserveN(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 1, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+
+	policy := NewPolicy("default", bucket, nil)
+	assert.True(t, SupportsReserve(policy))
+
+	ctx := WithNamespace(context.Background(), "tenant")
+	reservation, err := policy.ReserveN(ctx, "client", 1, time.Unix(0, scriptNow), 0)
+	require.NoError(t, err)
+	assert.True(t, reservation.Allowed)
+
+	policy.SetEnabled(false)
+	reservation, err = policy.ReserveN(ctx, "client", 1, time.Unix(0, scriptNow), 0)
+	require.NoError(t, err)
+	assert.True(t, reservation.Bypassed)
+
+	assert.False(t, SupportsReserve(NewPolicy("mock", &MockRateLimiterForFactory{}, nil)))
+}
@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SandboxSequence is a repeating cycle of decisions; true allows a request.
+type SandboxSequence []bool
+
+// ParseSandboxSequence parses a cycle written as "a" (allow) and "d" (deny)
+// characters, e.g. "aad" denies every third request.
+func ParseSandboxSequence(sequence string) (SandboxSequence, error) {
+	if sequence == "" {
+		return nil, fmt.Errorf("sandbox sequence must not be empty")
+	}
+	if len(sequence) > MaxSandboxSequenceLength {
+		return nil, fmt.Errorf("sandbox sequence longer than %d steps", MaxSandboxSequenceLength)
+	}
+
+	parsed := make(SandboxSequence, 0, len(sequence))
+	for _, step := range strings.ToLower(sequence) {
+		switch step {
+		case 'a':
+			parsed = append(parsed, true)
+		case 'd':
+			parsed = append(parsed, false)
+		default:
+			return nil, fmt.Errorf("invalid sandbox step %q, expected 'a' or 'd'", step)
+		}
+	}
+	return parsed, nil
+}
+
+// DenyEverySequence returns the cycle that denies every nth request.
+func DenyEverySequence(n int) (SandboxSequence, error) {
+	if n < 1 || n > MaxSandboxSequenceLength {
+		return nil, fmt.Errorf("deny_every must be between 1 and %d", MaxSandboxSequenceLength)
+	}
+
+	sequence := make(SandboxSequence, n)
+	for i := 0; i < n-1; i++ {
+		sequence[i] = true
+	}
+	return sequence, nil
+}
+
+func (s SandboxSequence) String() string {
+	var b strings.Builder
+	for _, allowed := range s {
+		if allowed {
+			b.WriteByte('a')
+		} else {
+			b.WriteByte('d')
+		}
+	}
+	return b.String()
+}
+
+type SandboxConfig struct {
+	DefaultSequence SandboxSequence
+	RetryAfter      time.Duration
+}
+
+// Sandbox replays deterministic allow/deny sequences per key so clients can
+// exercise their back-off handling without touching real limits. State is
+// in memory only.
+type Sandbox struct {
+	defaultSequence SandboxSequence
+	retryAfter      time.Duration
+
+	mu        sync.Mutex
+	positions map[string]int
+}
+
+func NewSandbox(config SandboxConfig) (*Sandbox, error) {
+	if len(config.DefaultSequence) == 0 {
+		return nil, fmt.Errorf("sandbox default sequence must not be empty")
+	}
+	if config.RetryAfter <= 0 {
+		return nil, fmt.Errorf("sandbox retry after must be positive")
+	}
+
+	return &Sandbox{
+		defaultSequence: config.DefaultSequence,
+		retryAfter:      config.RetryAfter,
+		positions:       make(map[string]int),
+	}, nil
+}
+
+func (s *Sandbox) DefaultSequence() SandboxSequence {
+	return s.defaultSequence
+}
+
+// Next advances key through sequence and returns the decision for this step.
+// A nil sequence uses the configured default.
+func (s *Sandbox) Next(key string, sequence SandboxSequence, timestamp time.Time) RateLimitResponse {
+	if len(sequence) == 0 {
+		sequence = s.defaultSequence
+	}
+
+	s.mu.Lock()
+	if _, exists := s.positions[key]; !exists && len(s.positions) >= MaxSandboxKeys {
+		s.positions = make(map[string]int)
+	}
+	step := s.positions[key] % len(sequence)
+	s.positions[key] = step + 1
+	s.mu.Unlock()
+
+	var limit, remaining int64
+	for i, allowed := range sequence {
+		if !allowed {
+			continue
+		}
+		limit++
+		if i > step {
+			remaining++
+		}
+	}
+
+	resetTime := timestamp.Add(s.retryAfter)
+	var metadata Metadata
+	metadata.Set("sandbox", true)
+	metadata.Set("sequence", sequence.String())
+	metadata.Set("step", step+1)
+
+	if sequence[step] {
+		return RateLimitResponse{
+			Allowed:   true,
+			Limit:     limit,
+			Remaining: remaining,
+			ResetTime: resetTime,
+			Metadata:  metadata,
+		}
+	}
+
+	retryAfter := s.retryAfter
+	return RateLimitResponse{
+		Allowed:    false,
+		Limit:      limit,
+		Remaining:  0,
+		ResetTime:  resetTime,
+		RetryAfter: &retryAfter,
+		Metadata:   metadata,
+	}
+}
+
+// Reset restarts the sequence for key.
+func (s *Sandbox) Reset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.positions, key)
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSandboxSequence(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected SandboxSequence
+		wantErr  bool
+	}{
+		{"allow allow deny", "aad", SandboxSequence{true, true, false}, false},
+		{"upper case", "AD", SandboxSequence{true, false}, false},
+		{"empty", "", nil, true},
+		{"invalid step", "axd", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sequence, err := ParseSandboxSequence(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, sequence)
+		})
+	}
+}
+
+func TestDenyEverySequence(t *testing.T) {
+	sequence, err := DenyEverySequence(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "aad", sequence.String())
+
+	_, err = DenyEverySequence(0)
+	assert.Error(t, err)
+}
+
+func TestSandbox_ReplaysSequence(t *testing.T) {
+	sequence, _ := ParseSandboxSequence("aad")
+	sandbox, err := NewSandbox(SandboxConfig{DefaultSequence: sequence, RetryAfter: 2 * time.Second})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	var decisions []bool
+	for i := 0; i < 6; i++ {
+		decisions = append(decisions, sandbox.Next("client", nil, now).Allowed)
+	}
+	assert.Equal(t, []bool{true, true, false, true, true, false}, decisions)
+
+	sandbox.Reset("client")
+	first := sandbox.Next("client", nil, now)
+	assert.True(t, first.Allowed)
+	assert.Equal(t, int64(2), first.Limit)
+	assert.Equal(t, int64(1), first.Remaining)
+
+	sandbox.Next("client", nil, now)
+	denied := sandbox.Next("client", nil, now)
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, 2*time.Second, *denied.RetryAfter)
+	assert.Equal(t, 3, denied.Metadata.Value("step"))
+}
+
+func TestSandbox_KeysAreIndependent(t *testing.T) {
+	sequence, _ := ParseSandboxSequence("ad")
+	sandbox, _ := NewSandbox(SandboxConfig{DefaultSequence: sequence, RetryAfter: time.Second})
+
+	now := time.Now()
+	assert.True(t, sandbox.Next("a", nil, now).Allowed)
+	assert.True(t, sandbox.Next("b", nil, now).Allowed)
+	assert.False(t, sandbox.Next("a", nil, now).Allowed)
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+//go:embed scripts/*.lua scripts/lib/*.lua
+var scriptFiles embed.FS
+
+// scriptPrelude is prepended to every script so they share helpers such as
+// the operator throttle lookup and the schema version.
+var scriptPrelude = fmt.Sprintf("local SCHEMA_VERSION = %d\n", SchemaVersion) +
+	readScriptFile("lib/schema.lua") + readScriptFile("lib/throttle.lua") + readScriptFile("lib/top_keys.lua") + readScriptFile("lib/key_stats.lua") +
+	readScriptFile("lib/token_bucket.lua")
+
+// scripts holds every embedded Lua script by file name. Scripts run through
+// redis.Script, which uses EVALSHA and falls back to EVAL on NOSCRIPT, or as
+// Redis Functions once LoadFunctions has been called.
+var scripts = map[string]*luaScript{}
+
+var (
+	tokenBucketScript                = loadScript("token_bucket.lua")
+	tokenBucketPeekScript            = loadScript("token_bucket_peek.lua")
+	tokenBucketAcquireScript         = loadScript("token_bucket_acquire.lua")
+	tokenBucketGlobalScript          = loadScript("token_bucket_global.lua")
+	tokenBucketRefundScript          = loadScript("token_bucket_refund.lua")
+	tokenBucketReserveScript         = loadScript("token_bucket_reserve.lua")
+	tokenBucketDebtScript            = loadScript("token_bucket_debt.lua")
+	slidingWindowLogScript           = loadScript("sliding_window_log.lua")
+	slidingWindowLogPeekScript       = loadScript("sliding_window_log_peek.lua")
+	slidingWindowLogRefundScript     = loadScript("sliding_window_log_refund.lua")
+	slidingWindowLogDebtScript       = loadScript("sliding_window_log_debt.lua")
+	slidingWindowCounterScript       = loadScript("sliding_window_counter.lua")
+	slidingWindowCounterPeekScript   = loadScript("sliding_window_counter_peek.lua")
+	slidingWindowCounterRefundScript = loadScript("sliding_window_counter_refund.lua")
+	slidingWindowCounterDebtScript   = loadScript("sliding_window_counter_debt.lua")
+	bucketsScript                    = loadScript("sliding_window_counter_buckets.lua")
+	bucketsPeekScript                = loadScript("sliding_window_counter_buckets_peek.lua")
+	bucketsRefundScript              = loadScript("sliding_window_counter_buckets_refund.lua")
+	bucketsDebtScript                = loadScript("sliding_window_counter_buckets_debt.lua")
+	hierarchicalScript               = loadScript("hierarchical.lua")
+	multiWindowScript                = loadScript("multi_window.lua")
+	multiWindowRefundScript          = loadScript("multi_window_refund.lua")
+	quotaScript                      = loadScript("quota.lua")
+	quotaPeekScript                  = loadScript("quota_peek.lua")
+	quotaRefundScript                = loadScript("quota_refund.lua")
+	quotaDebtScript                  = loadScript("quota_debt.lua")
+	escalationScript                 = loadScript("escalation.lua")
+	purgeIdleScript                  = loadScript("purge_idle.lua")
+	connectionAcquireScript          = loadScript("connection_acquire.lua")
+	stateImportScript                = loadScript("state_import.lua")
+	keyMigrateScript                 = loadScript("key_migrate.lua")
+	leaderLeaseScript                = loadScript("leader_lease.lua")
+	leaderResignScript               = loadScript("leader_resign.lua")
+)
+
+// loadScript reads an embedded script. A missing or empty file is a build
+// mistake, so it panics rather than failing on the first request.
+func loadScript(name string) *luaScript {
+	source := scriptPrelude + readScriptFile(name)
+	script := &luaScript{
+		Script: redis.NewScript(source),
+		name:   strings.TrimSuffix(name, ".lua"),
+		source: source,
+	}
+	scripts[name] = script
+	return script
+}
+
+func readScriptFile(name string) string {
+	source, err := scriptFiles.ReadFile("scripts/" + name)
+	if err != nil {
+		panic(fmt.Sprintf("lua script %s: %v", name, err))
+	}
+	if strings.TrimSpace(string(source)) == "" {
+		panic(fmt.Sprintf("lua script %s is empty", name))
+	}
+	return string(source)
+}
+
+// LoadScripts compiles every embedded script on the server with SCRIPT LOAD,
+// surfacing Lua syntax errors at startup and warming the EVALSHA cache.
+func LoadScripts(ctx context.Context, client redis.Scripter) error {
+	names := make([]string, 0, len(scripts))
+	for name := range scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		script := scripts[name]
+		sha, err := script.Load(ctx, client).Result()
+		if err != nil {
+			return fmt.Errorf("lua script %s: %w", name, err)
+		}
+		if sha != script.Hash() {
+			return fmt.Errorf("lua script %s: redis returned sha %s, expected %s", name, sha, script.Hash())
+		}
+	}
+
+	return nil
+}
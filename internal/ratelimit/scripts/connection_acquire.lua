@@ -0,0 +1,18 @@
+-- Admits a connection while the key holds fewer than max_connections. Each
+-- connection is a member of a sorted set scored by when its lease expires, so
+-- connections of an instance that died without releasing them drop out.
+-- KEYS[1]: connection set
+-- ARGV: max_connections, now_ms, lease_ms, connection_id
+local max_connections = throttled(tonumber(ARGV[1]))
+local now_ms = tonumber(ARGV[2])
+local lease_ms = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now_ms)
+local open = redis.call('ZCARD', KEYS[1])
+if open >= max_connections then
+	return {0, open, max_connections}
+end
+
+redis.call('ZADD', KEYS[1], now_ms + lease_ms, ARGV[4])
+redis.call('PEXPIRE', KEYS[1], lease_ms)
+return {1, open + 1, max_connections}
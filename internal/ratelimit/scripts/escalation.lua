@@ -0,0 +1,22 @@
+-- Counts a denial against a key and bans the key once it has been denied more
+-- than threshold times within the window.
+-- KEYS[1]: violation counter, KEYS[2]: penalty key, KEYS[3]: ban list
+-- ARGV: threshold, window_ms, ban_ms, now_ms, reason, member
+local threshold = tonumber(ARGV[1])
+local window_ms = tonumber(ARGV[2])
+local ban_ms = tonumber(ARGV[3])
+local now_ms = tonumber(ARGV[4])
+
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], window_ms)
+end
+if count <= threshold then
+	return {0, count}
+end
+
+redis.call('DEL', KEYS[1])
+redis.call('SET', KEYS[2], ARGV[5], 'PX', ban_ms)
+redis.call('ZREMRANGEBYSCORE', KEYS[3], '-inf', now_ms)
+redis.call('ZADD', KEYS[3], now_ms + ban_ms, ARGV[6])
+return {1, count}
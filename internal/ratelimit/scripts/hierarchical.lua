@@ -0,0 +1,88 @@
+-- Charges a token at every level of a hierarchy (the key, then its
+-- organization, then the whole service) or at none of them. KEYS holds one
+-- bucket per level; ARGV[1] is how many there are, followed by the bucket
+-- size and refill rate of each level.
+local level_count = tonumber(ARGV[1])
+local current_time_nanos = tonumber(ARGV[2])
+local ttl_buffer_seconds = tonumber(ARGV[3])
+
+local multiplier = throttle_multiplier()
+
+local function refill(key, size, rate)
+	local bucket_data = redis.call('HMGET', key, 'tokens', 'last_refill_time_nanos', 'schema')
+	local tokens = size
+	local last_refill_time_nanos = current_time_nanos
+
+	if bucket_data[1] then
+		tokens = tonumber(bucket_data[1])
+	end
+
+	if bucket_data[2] then
+		last_refill_time_nanos = tonumber(bucket_data[2])
+	end
+
+	local time_since_last_refill_seconds = (current_time_nanos - last_refill_time_nanos) / 1000000000 -- NanosecondsPerSecond
+	return math.min(size, tokens + time_since_last_refill_seconds * rate), bucket_data[3], bucket_data[1]
+end
+
+local function store(key, tokens, size, rate, schema, stored_tokens)
+	redis.call('HMSET', key,
+		'tokens', tokens,
+		'last_refill_time_nanos', current_time_nanos,
+		'schema', schema_stamp(schema))
+	record_bucket_created(key, stored_tokens, current_time_nanos)
+
+	local ttl_seconds = math.max(60, size / rate + ttl_buffer_seconds) -- MinimumTTLSeconds
+	redis.call('EXPIRE', key, ttl_seconds)
+end
+
+local sizes = {}
+local rates = {}
+local tokens = {}
+local schemas = {}
+local stored = {}
+for level = 1, level_count do
+	sizes[level] = math.max(1, math.floor(tonumber(ARGV[2 + 2 * level]) * multiplier))
+	rates[level] = tonumber(ARGV[3 + 2 * level]) * multiplier
+	tokens[level], schemas[level], stored[level] = refill(KEYS[level], sizes[level], rates[level])
+end
+
+-- limited_by is the level that frees up last, so retrying after its wait
+-- finds a token at every level.
+local wait_seconds = 0
+local limited_by = 0
+for level = 1, level_count do
+	if tokens[level] < 1 then
+		local level_wait_seconds = (1 - tokens[level]) / rates[level]
+		if limited_by == 0 or level_wait_seconds > wait_seconds then
+			wait_seconds = level_wait_seconds
+			limited_by = level
+		end
+	end
+end
+
+local allowed = 1
+if limited_by > 0 then
+	allowed = 0
+else
+	for level = 1, level_count do
+		tokens[level] = tokens[level] - 1
+	end
+end
+
+local result = {allowed, limited_by, 0, sizes[1]}
+for level = 1, level_count do
+	store(KEYS[level], tokens[level], sizes[level], rates[level], schemas[level], stored[level])
+	result[4 + level] = math.floor(tokens[level])
+end
+
+if allowed == 1 then
+	local seconds_to_full = (sizes[1] - tokens[1]) / rates[1]
+	result[3] = current_time_nanos + (seconds_to_full * 1000000000) -- NanosecondsPerSecond
+	record_top_keys(level_count, 1, 0)
+else
+	result[3] = current_time_nanos + (wait_seconds * 1000000000) -- NanosecondsPerSecond
+	record_top_keys(level_count, 1, 1)
+end
+
+return result
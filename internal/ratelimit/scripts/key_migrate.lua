@@ -0,0 +1,22 @@
+-- Renames each key in KEYS (bar the throttle key) at an odd position to the
+-- key after it. A target that exists is kept, and its source left in place,
+-- unless ARGV[1] is 1; a source gone since it was scanned is skipped. Returns
+-- how many keys were renamed, kept and gone.
+local overwrite = ARGV[1] == '1'
+local renamed, existing, missing = 0, 0, 0
+
+for i = 1, #KEYS - 1, 2 do
+	local source, target = KEYS[i], KEYS[i + 1]
+	if redis.call('EXISTS', source) == 0 then
+		missing = missing + 1
+	elseif overwrite then
+		redis.call('RENAME', source, target)
+		renamed = renamed + 1
+	elseif redis.call('RENAMENX', source, target) == 1 then
+		renamed = renamed + 1
+	else
+		existing = existing + 1
+	end
+end
+
+return {renamed, existing, missing}
@@ -0,0 +1,13 @@
+-- Takes the lease in KEYS[1] for ARGV[1], or extends it when ARGV[1] already
+-- holds it, for ARGV[2] milliseconds. Returns 1 when ARGV[1] holds the lease.
+local holder = redis.call('GET', KEYS[1])
+if holder == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if holder then
+	return 0
+end
+
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
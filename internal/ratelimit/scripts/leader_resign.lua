@@ -0,0 +1,6 @@
+-- Gives up the lease in KEYS[1] if ARGV[1] holds it, so another instance
+-- can take it without waiting for it to expire.
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
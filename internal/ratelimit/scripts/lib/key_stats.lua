@@ -0,0 +1,44 @@
+-- Prepended to every script. With key stats on (window_ms above 0) it counts
+-- a request, and a denial when denied is 1, in the stats_ fields of the
+-- strategy's own hash, and returns the requests and denials over the last
+-- window_ms and when the key was first seen, in milliseconds. The previous
+-- window is weighted by how much of it still overlaps, as in the sliding
+-- window counter. The caller keeps the hash's TTL up to date.
+local function record_key_stats(key, window_ms, now_ms, denied)
+	if window_ms <= 0 then
+		return {}
+	end
+
+	local stored = redis.call('HMGET', key, 'stats_window', 'stats_requests', 'stats_denied',
+		'stats_previous_requests', 'stats_previous_denied', 'stats_first_seen')
+	local window = math.floor(now_ms / window_ms)
+	local requests, denials, previous_requests, previous_denials = 0, 0, 0, 0
+	local stored_window = tonumber(stored[1])
+	if stored_window == window then
+		requests = tonumber(stored[2]) or 0
+		denials = tonumber(stored[3]) or 0
+		previous_requests = tonumber(stored[4]) or 0
+		previous_denials = tonumber(stored[5]) or 0
+	elseif stored_window == window - 1 then
+		previous_requests = tonumber(stored[2]) or 0
+		previous_denials = tonumber(stored[3]) or 0
+	end
+	local first_seen = tonumber(stored[6]) or now_ms
+
+	requests = requests + 1
+	denials = denials + denied
+	redis.call('HSET', key,
+		'stats_window', window,
+		'stats_requests', requests,
+		'stats_denied', denials,
+		'stats_previous_requests', previous_requests,
+		'stats_previous_denied', previous_denials,
+		'stats_first_seen', first_seen)
+
+	local weight = 1 - (now_ms % window_ms) / window_ms
+	return {
+		math.floor(requests + previous_requests * weight),
+		math.floor(denials + previous_denials * weight),
+		first_seen,
+	}
+end
@@ -0,0 +1,25 @@
+-- Prepended to every script, after SCHEMA_VERSION. Strategy hashes record
+-- the version of the format that wrote them in a schema field; a hash
+-- without one predates versioning and is version 1. Scripts read the fields
+-- of their own version and the previous one, read a later version's hash
+-- by the fields they know, and never lower the version they find, so the
+-- instances either side of a rolling upgrade can share keys. A format change
+-- must therefore stay readable by the previous version's scripts, or move to
+-- new keys.
+--
+-- Sliding window logs carry the version in their members, which readers
+-- never parse. The buckets of the sub-window counter are the hash's field
+-- names, which version 1 scripts can't skip, so its hash is read tolerantly
+-- from version 2 on and stamped from version 3. Plain counters such as the
+-- quota's hold nothing but the count and stay unversioned.
+--
+-- Version 3 adds created_nanos to token bucket hashes; see
+-- lib/token_bucket.lua.
+local function schema_version(stored)
+	return tonumber(stored) or 1
+end
+
+-- schema_stamp is the version to write back to a hash stamped stored.
+local function schema_stamp(stored)
+	return math.max(schema_version(stored), SCHEMA_VERSION)
+end
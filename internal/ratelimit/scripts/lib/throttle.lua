@@ -0,0 +1,14 @@
+-- Prepended to every script. Operators can scale all limits fleet-wide with a
+-- multiplier in (0, 1] stored under the last key; anything else means 1.
+local function throttle_multiplier()
+	local value = tonumber(redis.call('GET', KEYS[#KEYS]) or '1')
+	if value == nil or value <= 0 or value > 1 then
+		return 1
+	end
+	return value
+end
+
+local function throttled(limit)
+	return math.max(1, math.floor(limit * throttle_multiplier()))
+end
+
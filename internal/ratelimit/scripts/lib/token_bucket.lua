@@ -0,0 +1,11 @@
+-- Prepended to every script. Token bucket hashes record when they were
+-- created in created_nanos, so a refund can tell a charge made against the
+-- bucket from one made against an earlier bucket under the same key that
+-- expired or was reset since. stored_tokens is the hash's tokens field as
+-- read before the write; the hash is new when it had none. Hashes created
+-- before schema version 3 have no created_nanos.
+local function record_bucket_created(key, stored_tokens, now_nanos)
+	if not stored_tokens then
+		redis.call('HSET', key, 'created_nanos', now_nanos)
+	end
+end
@@ -0,0 +1,21 @@
+-- Prepended to every script. With top keys analytics on, the caller passes
+-- the traffic and throttled sorted sets right before the throttle key, and
+-- the member and their TTL as the last two arguments. strategy_keys is how
+-- many keys the script itself takes.
+local function record_top_keys(strategy_keys, requested, denied)
+	if #KEYS ~= strategy_keys + 3 then
+		return
+	end
+
+	local member = ARGV[#ARGV - 1]
+	local ttl_seconds = tonumber(ARGV[#ARGV])
+	local traffic_key = KEYS[strategy_keys + 1]
+	local throttled_key = KEYS[strategy_keys + 2]
+
+	redis.call('ZINCRBY', traffic_key, requested, member)
+	redis.call('EXPIRE', traffic_key, ttl_seconds)
+	if denied > 0 then
+		redis.call('ZINCRBY', throttled_key, denied, member)
+		redis.call('EXPIRE', throttled_key, ttl_seconds)
+	end
+end
@@ -0,0 +1,89 @@
+-- Checks a request against a short burst window and a long sustained window,
+-- each a sliding window counter kept in one hash per key, and counts it in
+-- both or in neither. ARGV[1] is the cost (1 to count the request, 0 to only
+-- look), ARGV[2] the key's TTL, then per window its index (the time divided
+-- by its size), the progress through it, its size in milliseconds and its
+-- limit.
+local key = KEYS[1]
+local cost = tonumber(ARGV[1])
+local ttl_seconds = tonumber(ARGV[2])
+local names = {'burst', 'sustained'}
+local schema = schema_stamp(redis.call('HGET', key, 'schema'))
+
+local windows = {}
+for w = 1, 2 do
+	local base = 2 + (w - 1) * 4
+	local window = {
+		index = tonumber(ARGV[base + 1]),
+		progress = tonumber(ARGV[base + 2]),
+		size_ms = tonumber(ARGV[base + 3]),
+		limit = throttled(tonumber(ARGV[base + 4])),
+		current = 0,
+		previous = 0,
+	}
+
+	local stored = redis.call('HMGET', key, names[w] .. '_index', names[w] .. '_current', names[w] .. '_previous')
+	local stored_index = tonumber(stored[1])
+	if stored_index == window.index then
+		window.current = tonumber(stored[2]) or 0
+		window.previous = tonumber(stored[3]) or 0
+	elseif stored_index == window.index - 1 then
+		window.previous = tonumber(stored[2]) or 0
+	end
+	window.weighted = window.current + window.previous * (1 - window.progress)
+	windows[w] = window
+end
+
+-- wait_ms is how long until the weighted count drops below the limit if no
+-- more requests are counted: first the previous window's share fades out,
+-- then, if the current window alone is at the limit, its own share once it
+-- has become the previous one.
+local function wait_ms(window)
+	if window.weighted < window.limit then
+		return 0
+	end
+	local progress
+	if window.current < window.limit then
+		progress = 1 - (window.limit - window.current) / window.previous
+	else
+		progress = 2 - window.limit / window.current
+	end
+	return math.ceil((progress - window.progress) * window.size_ms) + 1
+end
+
+local limited_by = 0
+local wait = 0
+for w = 1, 2 do
+	local window_wait = wait_ms(windows[w])
+	if window_wait > 0 and window_wait > wait then
+		limited_by = w
+		wait = window_wait
+	end
+end
+
+local allowed = 1
+if limited_by > 0 then
+	allowed = 0
+elseif cost > 0 then
+	for w = 1, 2 do
+		local window = windows[w]
+		window.current = window.current + cost
+		window.weighted = window.weighted + cost
+		redis.call('HSET', key,
+			names[w] .. '_index', window.index,
+			names[w] .. '_current', window.current,
+			names[w] .. '_previous', window.previous,
+			'schema', schema)
+	end
+	redis.call('EXPIRE', key, ttl_seconds)
+end
+
+if cost > 0 then
+	record_top_keys(1, 1, 1 - allowed)
+end
+
+return {
+	allowed, limited_by, wait,
+	windows[1].limit, math.floor(windows[1].weighted),
+	windows[2].limit, math.floor(windows[2].weighted),
+}
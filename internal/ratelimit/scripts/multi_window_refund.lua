@@ -0,0 +1,15 @@
+-- Takes n requests back out of both windows of a multi-window key. ARGV[1] is
+-- n, followed by the current index of the burst and the sustained window; a
+-- window that has moved on since the requests were counted is left alone.
+local key = KEYS[1]
+local n = tonumber(ARGV[1])
+local names = {'burst', 'sustained'}
+
+for w = 1, 2 do
+	local stored = redis.call('HMGET', key, names[w] .. '_index', names[w] .. '_current')
+	if tonumber(stored[1]) == tonumber(ARGV[1 + w]) and stored[2] then
+		redis.call('HSET', key, names[w] .. '_current', math.max(0, tonumber(stored[2]) - n))
+	end
+end
+
+return 1
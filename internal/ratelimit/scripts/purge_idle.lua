@@ -0,0 +1,15 @@
+-- Deletes each key in KEYS (bar the throttle key) that has no TTL and has
+-- gone unused for at least ARGV[1] seconds. Both are checked again here so a
+-- key used or given a TTL since it was scanned survives; keys with a TTL
+-- expire on their own.
+local idle_threshold_seconds = tonumber(ARGV[1])
+local deleted = 0
+
+for i = 1, #KEYS - 1 do
+	local idle = redis.call('OBJECT', 'IDLETIME', KEYS[i])
+	if idle and idle >= idle_threshold_seconds and redis.call('PTTL', KEYS[i]) == -1 then
+		deleted = deleted + redis.call('DEL', KEYS[i])
+	end
+end
+
+return deleted
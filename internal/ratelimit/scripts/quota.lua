@@ -0,0 +1,18 @@
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local expire_at = tonumber(ARGV[2])
+
+limit = throttled(limit)
+
+local used = tonumber(redis.call('GET', key) or '0')
+
+if used >= limit then
+	record_top_keys(1, 1, 1)
+	return {0, used, limit}
+end
+
+used = redis.call('INCR', key)
+redis.call('EXPIREAT', key, expire_at)
+
+record_top_keys(1, 1, 0)
+return {1, used, limit}
@@ -0,0 +1,8 @@
+local key = KEYS[1]
+local debt = tonumber(ARGV[1])
+local expire_at = tonumber(ARGV[2])
+
+local used = redis.call('INCRBY', key, debt)
+redis.call('EXPIREAT', key, expire_at)
+
+return {used}
@@ -0,0 +1,6 @@
+local key = KEYS[1]
+local limit = throttled(tonumber(ARGV[1]))
+
+local used = tonumber(redis.call('GET', key) or '0')
+
+return {used, limit}
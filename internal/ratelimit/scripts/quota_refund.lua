@@ -0,0 +1,9 @@
+local key = KEYS[1]
+local n = tonumber(ARGV[1])
+
+local used = tonumber(redis.call('GET', key) or '0')
+if used <= 0 then
+	return {0}
+end
+
+return {redis.call('DECRBY', key, math.min(n, used))}
@@ -0,0 +1,60 @@
+local key = KEYS[1]
+local current_window_start = tonumber(ARGV[1])
+local previous_window_start = tonumber(ARGV[2])
+local bucket_size = tonumber(ARGV[3])
+local window_size_nanos = tonumber(ARGV[4])
+local ttl_seconds = tonumber(ARGV[5])
+local window_progress = tonumber(ARGV[6])
+local stats_window_ms = tonumber(ARGV[7])
+local now_ms = tonumber(ARGV[8])
+
+bucket_size = throttled(bucket_size)
+
+local current_window_key = key .. ':current'
+local previous_window_key = key .. ':previous'
+
+local current_count = 0
+local previous_count = 0
+
+local current_window_data = redis.call('HMGET', current_window_key, 'count', 'window_start', 'schema')
+if current_window_data[1] and current_window_data[2] then
+	local stored_window_start = tonumber(current_window_data[2])
+	if stored_window_start == current_window_start then
+		current_count = tonumber(current_window_data[1])
+	elseif stored_window_start == previous_window_start then
+		previous_count = tonumber(current_window_data[1])
+	end
+end
+
+if previous_count == 0 then
+	local previous_window_data = redis.call('HMGET', previous_window_key, 'count', 'window_start')
+	if previous_window_data[1] and previous_window_data[2] and tonumber(previous_window_data[2]) == previous_window_start then
+		previous_count = tonumber(previous_window_data[1])
+	end
+end
+
+local previous_window_weight = 1 - window_progress
+local weighted_count = math.floor(current_count + (previous_count * previous_window_weight))
+
+if weighted_count >= bucket_size then
+	local reset_time_nanos = current_window_start + window_size_nanos
+	local stats = record_key_stats(current_window_key, stats_window_ms, now_ms, 1)
+	if stats[1] then
+		redis.call('EXPIRE', current_window_key, ttl_seconds)
+	end
+	record_top_keys(1, 1, 1)
+	return {0, weighted_count, reset_time_nanos, current_count, previous_count, 0, bucket_size, stats[1], stats[2], stats[3]}
+end
+
+local new_current_count = current_count + 1
+local stats = record_key_stats(current_window_key, stats_window_ms, now_ms, 0)
+local schema = schema_stamp(current_window_data[3])
+redis.call('HMSET', current_window_key, 'count', new_current_count, 'window_start', current_window_start, 'schema', schema)
+redis.call('EXPIRE', current_window_key, ttl_seconds)
+
+redis.call('HMSET', previous_window_key, 'count', previous_count, 'window_start', previous_window_start, 'schema', schema)
+redis.call('EXPIRE', previous_window_key, ttl_seconds)
+
+local remaining_requests = math.max(0, bucket_size - weighted_count - 1)
+record_top_keys(1, 1, 0)
+return {1, weighted_count + 1, 0, new_current_count, previous_count, remaining_requests, bucket_size, stats[1], stats[2], stats[3]}
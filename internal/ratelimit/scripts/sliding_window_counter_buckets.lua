@@ -0,0 +1,63 @@
+local key = KEYS[1] .. ':buckets'
+local current_bucket = tonumber(ARGV[1])
+local sub_windows = tonumber(ARGV[2])
+local bucket_size = throttled(tonumber(ARGV[3]))
+local ttl_seconds = tonumber(ARGV[4])
+local bucket_progress = tonumber(ARGV[5])
+
+-- counts[1] is the sub-window sliding out of the window, weighted by how much
+-- of it is still covered; counts[sub_windows + 1] is the current one.
+local oldest_bucket = current_bucket - sub_windows
+local counts = {}
+for i = 1, sub_windows + 1 do
+	counts[i] = 0
+end
+
+local stored = redis.call('HGETALL', key)
+local expired = {}
+local skipped = 0
+local schema
+for i = 1, #stored, 2 do
+	local bucket = tonumber(stored[i])
+	if bucket == nil then
+		-- Not a bucket, such as the schema.
+		skipped = skipped + 1
+		if stored[i] == 'schema' then
+			schema = stored[i + 1]
+		end
+	elseif bucket < oldest_bucket then
+		expired[#expired + 1] = stored[i]
+	elseif bucket <= current_bucket then
+		counts[bucket - oldest_bucket + 1] = tonumber(stored[i + 1])
+	end
+end
+if #expired > 0 then
+	redis.call('HDEL', key, unpack(expired))
+end
+local stored_buckets = #stored / 2 - #expired - skipped
+
+local full_count = 0
+for i = 2, sub_windows + 1 do
+	full_count = full_count + counts[i]
+end
+local weighted_count = math.floor(full_count + counts[1] * (1 - bucket_progress))
+
+local result
+if weighted_count >= bucket_size then
+	record_top_keys(1, 1, 1)
+	result = {0, weighted_count, 0, bucket_size, stored_buckets}
+else
+	if counts[sub_windows + 1] == 0 then
+		stored_buckets = stored_buckets + 1
+	end
+	counts[sub_windows + 1] = redis.call('HINCRBY', key, ARGV[1], 1)
+	redis.call('HSET', key, 'schema', schema_stamp(schema))
+	redis.call('EXPIRE', key, ttl_seconds)
+	record_top_keys(1, 1, 0)
+	result = {1, weighted_count + 1, math.max(0, bucket_size - weighted_count - 1), bucket_size, stored_buckets}
+end
+
+for i = 1, sub_windows + 1 do
+	result[#result + 1] = counts[i]
+end
+return result
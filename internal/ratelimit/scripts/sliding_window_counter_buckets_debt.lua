@@ -0,0 +1,10 @@
+local key = KEYS[1] .. ':buckets'
+local current_bucket = ARGV[1]
+local debt = tonumber(ARGV[2])
+local ttl_seconds = tonumber(ARGV[3])
+
+local count = redis.call('HINCRBY', key, current_bucket, debt)
+redis.call('HSET', key, 'schema', schema_stamp(redis.call('HGET', key, 'schema')))
+redis.call('EXPIRE', key, ttl_seconds)
+
+return {count}
@@ -0,0 +1,33 @@
+local key = KEYS[1] .. ':buckets'
+local current_bucket = tonumber(ARGV[1])
+local sub_windows = tonumber(ARGV[2])
+local bucket_size = throttled(tonumber(ARGV[3]))
+local bucket_progress = tonumber(ARGV[4])
+
+local oldest_bucket = current_bucket - sub_windows
+local counts = {}
+for i = 1, sub_windows + 1 do
+	counts[i] = 0
+end
+
+local stored = redis.call('HGETALL', key)
+local stored_buckets = 0
+for i = 1, #stored, 2 do
+	local bucket = tonumber(stored[i])
+	if bucket and bucket >= oldest_bucket and bucket <= current_bucket then
+		counts[bucket - oldest_bucket + 1] = tonumber(stored[i + 1])
+		stored_buckets = stored_buckets + 1
+	end
+end
+
+local full_count = 0
+for i = 2, sub_windows + 1 do
+	full_count = full_count + counts[i]
+end
+local weighted_count = math.floor(full_count + counts[1] * (1 - bucket_progress))
+
+local result = {weighted_count, bucket_size, stored_buckets}
+for i = 1, sub_windows + 1 do
+	result[#result + 1] = counts[i]
+end
+return result
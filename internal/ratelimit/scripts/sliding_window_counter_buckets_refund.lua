@@ -0,0 +1,11 @@
+local key = KEYS[1] .. ':buckets'
+local current_bucket = ARGV[1]
+local n = tonumber(ARGV[2])
+
+-- Only the current sub-window is refunded, as with two windows.
+local count = tonumber(redis.call('HGET', key, current_bucket))
+if not count or count <= 0 then
+	return {count or 0}
+end
+
+return {redis.call('HINCRBY', key, current_bucket, -math.min(n, count))}
@@ -0,0 +1,26 @@
+local key = KEYS[1]
+local current_window_start = tonumber(ARGV[1])
+local previous_window_start = tonumber(ARGV[2])
+local debt = tonumber(ARGV[3])
+local ttl_seconds = tonumber(ARGV[4])
+
+local current_window_key = key .. ':current'
+local previous_window_key = key .. ':previous'
+
+local current_window_data = redis.call('HMGET', current_window_key, 'count', 'window_start', 'schema')
+local schema = schema_stamp(current_window_data[3])
+local stored_window_start = tonumber(current_window_data[2])
+
+if current_window_data[1] and stored_window_start == current_window_start then
+	redis.call('HINCRBY', current_window_key, 'count', debt)
+else
+	-- Roll the window over the way the limit script would before charging.
+	if current_window_data[1] and stored_window_start == previous_window_start then
+		redis.call('HMSET', previous_window_key, 'count', current_window_data[1], 'window_start', previous_window_start, 'schema', schema)
+		redis.call('EXPIRE', previous_window_key, ttl_seconds)
+	end
+	redis.call('HMSET', current_window_key, 'count', debt, 'window_start', current_window_start, 'schema', schema)
+end
+redis.call('EXPIRE', current_window_key, ttl_seconds)
+
+return {tonumber(redis.call('HGET', current_window_key, 'count'))}
@@ -0,0 +1,29 @@
+local key = KEYS[1]
+local current_window_start = tonumber(ARGV[1])
+local previous_window_start = tonumber(ARGV[2])
+local window_progress = tonumber(ARGV[3])
+local bucket_size = throttled(tonumber(ARGV[4]))
+
+local current_count = 0
+local previous_count = 0
+
+local current_window_data = redis.call('HMGET', key .. ':current', 'count', 'window_start')
+if current_window_data[1] and current_window_data[2] then
+	local stored_window_start = tonumber(current_window_data[2])
+	if stored_window_start == current_window_start then
+		current_count = tonumber(current_window_data[1])
+	elseif stored_window_start == previous_window_start then
+		previous_count = tonumber(current_window_data[1])
+	end
+end
+
+if previous_count == 0 then
+	local previous_window_data = redis.call('HMGET', key .. ':previous', 'count', 'window_start')
+	if previous_window_data[1] and previous_window_data[2] and tonumber(previous_window_data[2]) == previous_window_start then
+		previous_count = tonumber(previous_window_data[1])
+	end
+end
+
+local weighted_count = math.floor(current_count + (previous_count * (1 - window_progress)))
+
+return {weighted_count, current_count, previous_count, bucket_size}
@@ -0,0 +1,19 @@
+local key = KEYS[1]
+local current_window_start = tonumber(ARGV[1])
+local n = tonumber(ARGV[2])
+
+local current_window_key = key .. ':current'
+
+-- Only refund into the window the requests were counted in; once it has
+-- rolled over the count only carries a fractional weight, so it is left alone.
+local current_window_data = redis.call('HMGET', current_window_key, 'count', 'window_start')
+if not current_window_data[1] or not current_window_data[2] then
+	return {0}
+end
+
+local count = tonumber(current_window_data[1])
+if tonumber(current_window_data[2]) ~= current_window_start or count <= 0 then
+	return {count}
+end
+
+return {redis.call('HINCRBY', current_window_key, 'count', -math.min(n, count))}
@@ -0,0 +1,59 @@
+local key = KEYS[1]
+local window_start_nanos = tonumber(ARGV[1])
+local current_timestamp_nanos = tonumber(ARGV[2])
+local bucket_size = tonumber(ARGV[3])
+local window_size_seconds = tonumber(ARGV[4])
+local ttl_buffer_seconds = tonumber(ARGV[5])
+local max_entries = tonumber(ARGV[6])
+
+bucket_size = throttled(bucket_size)
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', window_start_nanos)
+
+local current_count = redis.call('ZCARD', key)
+local approximate = 0
+
+-- A log at its cap may have lost its oldest entries, so extrapolate the
+-- count from the request rate over the span it still covers.
+if max_entries > 0 and current_count >= max_entries then
+	approximate = 1
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	local span_nanos = current_timestamp_nanos - tonumber(oldest[2])
+	if span_nanos > 0 then
+		local estimated = math.floor(current_count * window_size_seconds * 1000000000 / span_nanos) -- NanosecondsPerSecond
+		current_count = math.max(current_count, estimated)
+	end
+end
+
+if current_count >= bucket_size then
+	local timestamps = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	local oldest_timestamp_nanos = 0
+	local reset_time_seconds = 0
+
+	if #timestamps > 0 then
+		oldest_timestamp_nanos = tonumber(timestamps[2])
+		reset_time_seconds = (oldest_timestamp_nanos + (window_size_seconds * 1000000000)) / 1000000000 -- NanosecondsPerSecond
+	end
+
+	record_top_keys(1, 1, 1)
+	return {0, current_count, reset_time_seconds, 0, approximate, bucket_size}
+end
+
+local member = 'v' .. SCHEMA_VERSION .. ':' .. current_timestamp_nanos .. ':' .. math.random()
+redis.call('ZADD', key, current_timestamp_nanos, member)
+
+if max_entries > 0 then
+	local size = redis.call('ZCARD', key)
+	if size > max_entries then
+		redis.call('ZREMRANGEBYRANK', key, 0, size - max_entries - 1)
+		approximate = 1
+	end
+end
+
+local ttl_seconds = window_size_seconds + ttl_buffer_seconds
+redis.call('EXPIRE', key, ttl_seconds)
+
+local remaining = math.max(0, bucket_size - current_count - 1)
+
+record_top_keys(1, 1, 0)
+return {1, current_count + 1, 0, remaining, approximate, bucket_size}
@@ -0,0 +1,13 @@
+-- Logs ARGV[1] extra entries at the current time; they age out with the
+-- window like real requests. Callers cap the debt at the bucket size.
+local key = KEYS[1]
+local debt = tonumber(ARGV[1])
+local current_timestamp_nanos = tonumber(ARGV[2])
+local ttl_seconds = tonumber(ARGV[3])
+
+for i = 1, debt do
+	redis.call('ZADD', key, current_timestamp_nanos, 'v' .. SCHEMA_VERSION .. ':' .. current_timestamp_nanos .. ':debt:' .. i .. ':' .. math.random())
+end
+redis.call('EXPIRE', key, ttl_seconds)
+
+return {redis.call('ZCARD', key)}
@@ -0,0 +1,40 @@
+local key = KEYS[1]
+local window_start_nanos = ARGV[1]
+local window_size_seconds = tonumber(ARGV[2])
+local current_timestamp_nanos = tonumber(ARGV[3])
+local max_entries = tonumber(ARGV[4])
+local bucket_size = throttled(tonumber(ARGV[5]))
+local recent_requests = tonumber(ARGV[6]) or 0
+
+local current_count = redis.call('ZCOUNT', key, '(' .. window_start_nanos, '+inf')
+local oldest = redis.call('ZRANGEBYSCORE', key, '(' .. window_start_nanos, '+inf', 'WITHSCORES', 'LIMIT', 0, 1)
+local approximate = 0
+
+local reset_time_seconds = 0
+if #oldest > 0 then
+	reset_time_seconds = (tonumber(oldest[2]) + (window_size_seconds * 1000000000)) / 1000000000 -- NanosecondsPerSecond
+
+	-- Same extrapolation as the limiting script for logs at their cap.
+	if max_entries > 0 and current_count >= max_entries then
+		approximate = 1
+		local span_nanos = current_timestamp_nanos - tonumber(oldest[2])
+		if span_nanos > 0 then
+			local estimated = math.floor(current_count * window_size_seconds * 1000000000 / span_nanos) -- NanosecondsPerSecond
+			current_count = math.max(current_count, estimated)
+		end
+	end
+end
+
+local result = {current_count, reset_time_seconds, approximate, bucket_size}
+
+-- The timestamps of the most recent requests, newest first, for debugging.
+if recent_requests > 0 then
+	local recent = {}
+	local entries = redis.call('ZREVRANGEBYSCORE', key, '+inf', '(' .. window_start_nanos, 'WITHSCORES', 'LIMIT', 0, recent_requests)
+	for i = 2, #entries, 2 do
+		recent[#recent + 1] = entries[i]
+	end
+	result[5] = recent
+end
+
+return result
@@ -0,0 +1,8 @@
+-- Drops the newest ARGV[1] entries from the log; which entries go doesn't
+-- matter for the count, and the newest keep the reset time unchanged.
+local key = KEYS[1]
+local n = tonumber(ARGV[1])
+
+redis.call('ZPOPMAX', key, n)
+
+return {redis.call('ZCARD', key)}
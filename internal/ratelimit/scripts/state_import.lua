@@ -0,0 +1,35 @@
+-- Writes one exported key. ARGV: overwrite (1/0), type, TTL in milliseconds
+-- (0 for none), then the value: the string itself, hash field/value pairs or
+-- sorted set score/member pairs. Returns 1 if the key was written and 0 if it
+-- already existed and overwrite was off.
+local key = KEYS[1]
+local overwrite = ARGV[1] == '1'
+local kind = ARGV[2]
+local ttl_ms = tonumber(ARGV[3])
+
+if redis.call('EXISTS', key) == 1 then
+	if not overwrite then
+		return 0
+	end
+	redis.call('DEL', key)
+end
+
+if kind == 'string' then
+	redis.call('SET', key, ARGV[4])
+elseif kind == 'hash' then
+	for i = 4, #ARGV, 2 do
+		redis.call('HSET', key, ARGV[i], ARGV[i + 1])
+	end
+elseif kind == 'zset' then
+	for i = 4, #ARGV, 2 do
+		redis.call('ZADD', key, ARGV[i], ARGV[i + 1])
+	end
+else
+	return redis.error_reply('unsupported key type ' .. kind)
+end
+
+if ttl_ms > 0 then
+	redis.call('PEXPIRE', key, ttl_ms)
+end
+
+return 1
@@ -0,0 +1,67 @@
+local key = KEYS[1]
+local bucket_size = tonumber(ARGV[1])
+local refill_rate = tonumber(ARGV[2])
+
+local multiplier = throttle_multiplier()
+bucket_size = math.max(1, math.floor(bucket_size * multiplier))
+refill_rate = refill_rate * multiplier
+local current_time_nanos = tonumber(ARGV[3])
+local ttl_buffer_seconds = tonumber(ARGV[4])
+local stats_window_ms = tonumber(ARGV[5])
+local current_time_ms = math.floor(current_time_nanos / 1000000)
+
+local bucket_data = redis.call('HMGET', key, 'tokens', 'last_refill_time_nanos', 'schema')
+local current_tokens = bucket_size
+local last_refill_time_nanos = current_time_nanos
+
+if bucket_data[1] then
+	current_tokens = tonumber(bucket_data[1])
+end
+
+if bucket_data[2] then
+	last_refill_time_nanos = tonumber(bucket_data[2])
+end
+
+local time_since_last_refill_seconds = (current_time_nanos - last_refill_time_nanos) / 1000000000 -- NanosecondsPerSecond
+
+local tokens_to_refill = time_since_last_refill_seconds * refill_rate
+
+current_tokens = math.min(bucket_size, current_tokens + tokens_to_refill)
+
+if current_tokens < 1 then
+	local tokens_needed = 1 - current_tokens
+	local seconds_until_token = tokens_needed / refill_rate
+	local next_token_time_nanos = current_time_nanos + (seconds_until_token * 1000000000) -- NanosecondsPerSecond
+
+	local stats = record_key_stats(key, stats_window_ms, current_time_ms, 1)
+	redis.call('HMSET', key,
+		'tokens', current_tokens,
+		'last_refill_time_nanos', current_time_nanos,
+		'schema', schema_stamp(bucket_data[3]))
+	record_bucket_created(key, bucket_data[1], current_time_nanos)
+
+	local ttl_seconds = math.ceil(math.max(60, (bucket_size - current_tokens) / refill_rate + ttl_buffer_seconds)) -- MinimumTTLSeconds
+	redis.call('EXPIRE', key, ttl_seconds)
+
+	record_top_keys(1, 1, 1)
+	return {0, current_tokens, next_token_time_nanos, bucket_size, stats[1], stats[2], stats[3]}
+end
+
+local remaining_tokens = current_tokens - 1
+
+local stats = record_key_stats(key, stats_window_ms, current_time_ms, 0)
+redis.call('HMSET', key,
+	'tokens', remaining_tokens,
+	'last_refill_time_nanos', current_time_nanos,
+	'schema', schema_stamp(bucket_data[3]))
+record_bucket_created(key, bucket_data[1], current_time_nanos)
+
+local ttl_seconds = math.ceil(math.max(60, (bucket_size - remaining_tokens) / refill_rate + ttl_buffer_seconds)) -- MinimumTTLSeconds
+redis.call('EXPIRE', key, ttl_seconds)
+
+local tokens_to_full = bucket_size - remaining_tokens
+local seconds_to_full = tokens_to_full / refill_rate
+local full_time_nanos = current_time_nanos + (seconds_to_full * 1000000000) -- NanosecondsPerSecond
+
+record_top_keys(1, 1, 0)
+return {1, remaining_tokens, full_time_nanos, bucket_size, stats[1], stats[2], stats[3]}
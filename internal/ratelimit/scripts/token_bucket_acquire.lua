@@ -0,0 +1,48 @@
+local key = KEYS[1]
+local bucket_size = tonumber(ARGV[1])
+local refill_rate = tonumber(ARGV[2])
+
+local multiplier = throttle_multiplier()
+bucket_size = math.max(1, math.floor(bucket_size * multiplier))
+refill_rate = refill_rate * multiplier
+local current_time_nanos = tonumber(ARGV[3])
+local ttl_buffer_seconds = tonumber(ARGV[4])
+local requested = tonumber(ARGV[5])
+
+local bucket_data = redis.call('HMGET', key, 'tokens', 'last_refill_time_nanos', 'schema')
+local current_tokens = bucket_size
+local last_refill_time_nanos = current_time_nanos
+
+if bucket_data[1] then
+	current_tokens = tonumber(bucket_data[1])
+end
+
+if bucket_data[2] then
+	last_refill_time_nanos = tonumber(bucket_data[2])
+end
+
+local time_since_last_refill_seconds = (current_time_nanos - last_refill_time_nanos) / 1000000000 -- NanosecondsPerSecond
+current_tokens = math.min(bucket_size, current_tokens + time_since_last_refill_seconds * refill_rate)
+
+local granted = math.min(requested, math.floor(current_tokens))
+if granted < 0 then
+	granted = 0
+end
+current_tokens = current_tokens - granted
+
+redis.call('HMSET', key,
+	'tokens', current_tokens,
+	'last_refill_time_nanos', current_time_nanos,
+	'schema', schema_stamp(bucket_data[3]))
+record_bucket_created(key, bucket_data[1], current_time_nanos)
+
+local ttl_seconds = math.ceil(math.max(60, (bucket_size - current_tokens) / refill_rate + ttl_buffer_seconds)) -- MinimumTTLSeconds
+redis.call('EXPIRE', key, ttl_seconds)
+
+local next_token_time_nanos = current_time_nanos
+if granted == 0 then
+	next_token_time_nanos = current_time_nanos + ((1 - current_tokens) / refill_rate) * 1000000000 -- NanosecondsPerSecond
+end
+
+record_top_keys(1, requested, requested - granted)
+return {granted, next_token_time_nanos, math.floor(current_tokens), bucket_size}
@@ -0,0 +1,39 @@
+-- Takes ARGV[3] tokens from the bucket regardless of its level, so a
+-- penalised client waits for the refill to pay the debt off.
+local key = KEYS[1]
+local bucket_size = tonumber(ARGV[1])
+local refill_rate = tonumber(ARGV[2])
+
+local multiplier = throttle_multiplier()
+bucket_size = math.max(1, math.floor(bucket_size * multiplier))
+refill_rate = refill_rate * multiplier
+local debt = tonumber(ARGV[3])
+local current_time_nanos = tonumber(ARGV[4])
+local ttl_buffer_seconds = tonumber(ARGV[5])
+
+local bucket_data = redis.call('HMGET', key, 'tokens', 'last_refill_time_nanos', 'schema')
+local current_tokens = bucket_size
+local last_refill_time_nanos = current_time_nanos
+
+if bucket_data[1] then
+	current_tokens = tonumber(bucket_data[1])
+end
+
+if bucket_data[2] then
+	last_refill_time_nanos = tonumber(bucket_data[2])
+end
+
+local time_since_last_refill_seconds = (current_time_nanos - last_refill_time_nanos) / 1000000000 -- NanosecondsPerSecond
+current_tokens = math.min(bucket_size, current_tokens + time_since_last_refill_seconds * refill_rate)
+current_tokens = current_tokens - debt
+
+redis.call('HMSET', key,
+	'tokens', current_tokens,
+	'last_refill_time_nanos', current_time_nanos,
+	'schema', schema_stamp(bucket_data[3]))
+record_bucket_created(key, bucket_data[1], current_time_nanos)
+
+local ttl_seconds = math.ceil(math.max(60, (bucket_size - current_tokens) / refill_rate + ttl_buffer_seconds)) -- MinimumTTLSeconds
+redis.call('EXPIRE', key, ttl_seconds)
+
+return {math.floor(current_tokens)}
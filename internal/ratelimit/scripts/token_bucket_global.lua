@@ -0,0 +1,87 @@
+local client_key = KEYS[1]
+local global_key = KEYS[2]
+local bucket_size = tonumber(ARGV[1])
+local refill_rate = tonumber(ARGV[2])
+local global_bucket_size = tonumber(ARGV[3])
+local global_refill_rate = tonumber(ARGV[4])
+local current_time_nanos = tonumber(ARGV[5])
+local ttl_buffer_seconds = tonumber(ARGV[6])
+local stats_window_ms = tonumber(ARGV[7])
+local current_time_ms = math.floor(current_time_nanos / 1000000)
+
+local multiplier = throttle_multiplier()
+bucket_size = math.max(1, math.floor(bucket_size * multiplier))
+refill_rate = refill_rate * multiplier
+global_bucket_size = math.max(1, math.floor(global_bucket_size * multiplier))
+global_refill_rate = global_refill_rate * multiplier
+
+local function refill(key, size, rate)
+	local bucket_data = redis.call('HMGET', key, 'tokens', 'last_refill_time_nanos', 'schema')
+	local tokens = size
+	local last_refill_time_nanos = current_time_nanos
+
+	if bucket_data[1] then
+		tokens = tonumber(bucket_data[1])
+	end
+
+	if bucket_data[2] then
+		last_refill_time_nanos = tonumber(bucket_data[2])
+	end
+
+	local time_since_last_refill_seconds = (current_time_nanos - last_refill_time_nanos) / 1000000000 -- NanosecondsPerSecond
+	return math.min(size, tokens + time_since_last_refill_seconds * rate), bucket_data[3], bucket_data[1]
+end
+
+local function store(key, tokens, size, rate, schema, stored_tokens)
+	redis.call('HMSET', key,
+		'tokens', tokens,
+		'last_refill_time_nanos', current_time_nanos,
+		'schema', schema_stamp(schema))
+	record_bucket_created(key, stored_tokens, current_time_nanos)
+
+	local ttl_seconds = math.ceil(math.max(60, size / rate + ttl_buffer_seconds)) -- MinimumTTLSeconds
+	redis.call('EXPIRE', key, ttl_seconds)
+end
+
+local client_tokens, client_schema, client_stored = refill(client_key, bucket_size, refill_rate)
+local global_tokens, global_schema, global_stored = refill(global_key, global_bucket_size, global_refill_rate)
+
+-- A request needs a token from both buckets; when either is empty neither is
+-- charged. limited_by is 1 for the client bucket and 2 for the global one.
+if client_tokens < 1 or global_tokens < 1 then
+	local wait_seconds = 0
+	local limited_by = 1
+
+	if client_tokens < 1 then
+		wait_seconds = (1 - client_tokens) / refill_rate
+	end
+
+	if global_tokens < 1 then
+		local global_wait_seconds = (1 - global_tokens) / global_refill_rate
+		if global_wait_seconds > wait_seconds then
+			wait_seconds = global_wait_seconds
+			limited_by = 2
+		end
+	end
+
+	local stats = record_key_stats(client_key, stats_window_ms, current_time_ms, 1)
+	store(client_key, client_tokens, bucket_size, refill_rate, client_schema, client_stored)
+	store(global_key, global_tokens, global_bucket_size, global_refill_rate, global_schema, global_stored)
+
+	local next_token_time_nanos = current_time_nanos + (wait_seconds * 1000000000) -- NanosecondsPerSecond
+	record_top_keys(2, 1, 1)
+	return {0, math.floor(client_tokens), math.floor(global_tokens), next_token_time_nanos, limited_by, bucket_size, stats[1], stats[2], stats[3]}
+end
+
+client_tokens = client_tokens - 1
+global_tokens = global_tokens - 1
+
+local stats = record_key_stats(client_key, stats_window_ms, current_time_ms, 0)
+store(client_key, client_tokens, bucket_size, refill_rate, client_schema, client_stored)
+store(global_key, global_tokens, global_bucket_size, global_refill_rate, global_schema, global_stored)
+
+local seconds_to_full = (bucket_size - client_tokens) / refill_rate
+local full_time_nanos = current_time_nanos + (seconds_to_full * 1000000000) -- NanosecondsPerSecond
+
+record_top_keys(2, 1, 0)
+return {1, math.floor(client_tokens), math.floor(global_tokens), full_time_nanos, 0, bucket_size, stats[1], stats[2], stats[3]}
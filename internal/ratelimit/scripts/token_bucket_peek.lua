@@ -0,0 +1,28 @@
+local key = KEYS[1]
+local bucket_size = tonumber(ARGV[1])
+local refill_rate = tonumber(ARGV[2])
+
+local multiplier = throttle_multiplier()
+bucket_size = math.max(1, math.floor(bucket_size * multiplier))
+refill_rate = refill_rate * multiplier
+local current_time_nanos = tonumber(ARGV[3])
+
+local bucket_data = redis.call('HMGET', key, 'tokens', 'last_refill_time_nanos')
+local current_tokens = bucket_size
+local last_refill_time_nanos = current_time_nanos
+
+if bucket_data[1] then
+	current_tokens = tonumber(bucket_data[1])
+end
+
+if bucket_data[2] then
+	last_refill_time_nanos = tonumber(bucket_data[2])
+end
+
+local time_since_last_refill_seconds = (current_time_nanos - last_refill_time_nanos) / 1000000000 -- NanosecondsPerSecond
+current_tokens = math.min(bucket_size, current_tokens + time_since_last_refill_seconds * refill_rate)
+
+local seconds_to_full = (bucket_size - current_tokens) / refill_rate
+local full_time_nanos = current_time_nanos + (seconds_to_full * 1000000000) -- NanosecondsPerSecond
+
+return {math.floor(current_tokens), full_time_nanos, bucket_size}
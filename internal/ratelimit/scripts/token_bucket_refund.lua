@@ -0,0 +1,29 @@
+-- Returns ARGV[1] tokens to each bucket in KEYS (bar the throttle key), capped
+-- at the matching bucket size in ARGV[3..], for requests charged at ARGV[2]
+-- nanoseconds. Buckets that have expired are already full, and a bucket
+-- created after the charge, once the one charged expired or was reset, never
+-- held it; a charge decided a moment before the request that created its
+-- bucket is taken for one of those too, erring towards limiting. Running as
+-- one script, concurrent refunds of a key add up without either going past
+-- the cap. Returns the tokens each bucket holds after.
+local n = tonumber(ARGV[1])
+local charged_nanos = tonumber(ARGV[2])
+local tokens = {}
+
+for i = 1, #KEYS - 1 do
+	local bucket_size = throttled(tonumber(ARGV[i + 2]))
+	local bucket_data = redis.call('HMGET', KEYS[i], 'tokens', 'created_nanos')
+	local current = tonumber(bucket_data[1])
+	local created_nanos = tonumber(bucket_data[2])
+	if not current then
+		tokens[i] = bucket_size
+	elseif created_nanos and created_nanos > charged_nanos then
+		tokens[i] = math.floor(current)
+	else
+		current = math.min(bucket_size, current + n)
+		redis.call('HSET', KEYS[i], 'tokens', current)
+		tokens[i] = math.floor(current)
+	end
+end
+
+return tokens
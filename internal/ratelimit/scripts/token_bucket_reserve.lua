@@ -0,0 +1,61 @@
+local key = KEYS[1]
+local bucket_size = tonumber(ARGV[1])
+local refill_rate = tonumber(ARGV[2])
+
+local multiplier = throttle_multiplier()
+bucket_size = math.max(1, math.floor(bucket_size * multiplier))
+refill_rate = refill_rate * multiplier
+local requested = tonumber(ARGV[3])
+local current_time_nanos = tonumber(ARGV[4])
+local max_delay_nanos = tonumber(ARGV[5])
+local ttl_buffer_seconds = tonumber(ARGV[6])
+
+local bucket_data = redis.call('HMGET', key, 'tokens', 'last_refill_time_nanos', 'schema')
+local current_tokens = bucket_size
+local last_refill_time_nanos = current_time_nanos
+
+if bucket_data[1] then
+	current_tokens = tonumber(bucket_data[1])
+end
+
+if bucket_data[2] then
+	last_refill_time_nanos = tonumber(bucket_data[2])
+end
+
+local time_since_last_refill_seconds = (current_time_nanos - last_refill_time_nanos) / 1000000000 -- NanosecondsPerSecond
+current_tokens = math.min(bucket_size, current_tokens + time_since_last_refill_seconds * refill_rate)
+
+-- More tokens than the bucket holds can never be granted.
+if requested > bucket_size then
+	local full_time_nanos = current_time_nanos + ((bucket_size - current_tokens) / refill_rate) * 1000000000 -- NanosecondsPerSecond
+	record_top_keys(1, requested, requested)
+	return {0, math.floor(current_tokens), -1, full_time_nanos, bucket_size}
+end
+
+-- Tokens are taken up front and may go negative; the debt is what later
+-- callers wait on, as with golang.org/x/time/rate.
+local remaining_tokens = current_tokens - requested
+local delay_nanos = 0
+if remaining_tokens < 0 then
+	delay_nanos = math.ceil((-remaining_tokens / refill_rate) * 1000000000) -- NanosecondsPerSecond
+end
+
+local seconds_to_full = (bucket_size - remaining_tokens) / refill_rate
+local full_time_nanos = current_time_nanos + (seconds_to_full * 1000000000) -- NanosecondsPerSecond
+
+if delay_nanos > max_delay_nanos then
+	record_top_keys(1, requested, requested)
+	return {0, math.floor(current_tokens), delay_nanos, full_time_nanos, bucket_size}
+end
+
+redis.call('HMSET', key,
+	'tokens', remaining_tokens,
+	'last_refill_time_nanos', current_time_nanos,
+	'schema', schema_stamp(bucket_data[3]))
+record_bucket_created(key, bucket_data[1], current_time_nanos)
+
+local ttl_seconds = math.max(60, seconds_to_full + ttl_buffer_seconds) -- MinimumTTLSeconds
+redis.call('EXPIRE', key, math.ceil(ttl_seconds))
+
+record_top_keys(1, requested, 0)
+return {1, math.floor(remaining_tokens), delay_nanos, full_time_nanos, bucket_size}
@@ -0,0 +1,335 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptNow is a small fixed clock so float arithmetic inside the scripts
+// stays exact (real UnixNano values exceed a double's integer precision). It
+// is deliberately not a round number: miniredis formats round scores as
+// "1e+12", which gopher-lua's tonumber can't parse.
+const scriptNow = int64(1000)*NanosecondsPerSecond + 500
+
+func newScriptRedis(t testing.TB) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func evalScript(t *testing.T, client *redis.Client, script *luaScript, keys []string, args ...interface{}) []interface{} {
+	t.Helper()
+	keys = append(keys, ThrottleKey)
+	result, err := script.Run(context.Background(), client, keys, args...).Result()
+	require.NoError(t, err)
+	resultArray, ok := result.([]interface{})
+	require.True(t, ok, "expected an array reply, got %T", result)
+	return resultArray
+}
+
+func TestLoadScripts(t *testing.T) {
+	client, _ := newScriptRedis(t)
+
+	files, err := scriptFiles.ReadDir("scripts")
+	require.NoError(t, err)
+	scriptCount := 0
+	for _, file := range files {
+		if !file.IsDir() {
+			scriptCount++
+		}
+	}
+	assert.Len(t, scripts, scriptCount, "every embedded script should be loaded")
+
+	require.NoError(t, LoadScripts(context.Background(), client))
+
+	for name, script := range scripts {
+		exists, err := script.Exists(context.Background(), client).Result()
+		require.NoError(t, err)
+		assert.Equal(t, []bool{true}, exists, name)
+	}
+}
+
+func TestTokenBucketScript(t *testing.T) {
+	client, server := newScriptRedis(t)
+
+	// bucket_size, refill_rate, now, ttl_buffer, stats_window_ms
+	result := evalScript(t, client, tokenBucketScript, []string{"tb:k"}, 2, 1, scriptNow, 5, 0)
+	assert.Equal(t, []interface{}{int64(1), int64(1), scriptNow + NanosecondsPerSecond, int64(2)}, result)
+
+	evalScript(t, client, tokenBucketScript, []string{"tb:k"}, 2, 1, scriptNow, 5, 0)
+	result = evalScript(t, client, tokenBucketScript, []string{"tb:k"}, 2, 1, scriptNow, 5, 0)
+	assert.Equal(t, []interface{}{int64(0), int64(0), scriptNow + NanosecondsPerSecond, int64(2)}, result)
+
+	assert.Equal(t, "0", server.HGet("tb:k", "tokens"))
+	assert.Equal(t, MinimumTTLSeconds, int(server.TTL("tb:k").Seconds()))
+}
+
+func TestTokenBucketPeekScript(t *testing.T) {
+	client, server := newScriptRedis(t)
+
+	result := evalScript(t, client, tokenBucketPeekScript, []string{"tb:k"}, 5, 1, scriptNow)
+	assert.Equal(t, []interface{}{int64(5), scriptNow, int64(5)}, result)
+	assert.False(t, server.Exists("tb:k"), "peek must not create the bucket")
+
+	server.HSet("tb:k", "tokens", "1", "last_refill_time_nanos", strconv.FormatInt(scriptNow, 10))
+	result = evalScript(t, client, tokenBucketPeekScript, []string{"tb:k"}, 5, 1, scriptNow+2*NanosecondsPerSecond)
+	assert.Equal(t, []interface{}{int64(3), scriptNow + 4*NanosecondsPerSecond, int64(5)}, result)
+	assert.Equal(t, "1", server.HGet("tb:k", "tokens"))
+}
+
+func TestTokenBucketAcquireScript(t *testing.T) {
+	client, _ := newScriptRedis(t)
+
+	// bucket_size, refill_rate, now, ttl_buffer, requested
+	result := evalScript(t, client, tokenBucketAcquireScript, []string{"tb:k"}, 5, 1, scriptNow, 5, 3)
+	assert.Equal(t, []interface{}{int64(3), scriptNow, int64(2), int64(5)}, result)
+
+	result = evalScript(t, client, tokenBucketAcquireScript, []string{"tb:k"}, 5, 1, scriptNow, 5, 3)
+	assert.Equal(t, []interface{}{int64(2), scriptNow, int64(0), int64(5)}, result)
+
+	result = evalScript(t, client, tokenBucketAcquireScript, []string{"tb:k"}, 5, 1, scriptNow, 5, 1)
+	assert.Equal(t, []interface{}{int64(0), scriptNow + NanosecondsPerSecond, int64(0), int64(5)}, result)
+}
+
+func TestTokenBucketGlobalScript(t *testing.T) {
+	client, server := newScriptRedis(t)
+	keys := func(client string) []string { return []string{"tb:" + client, "tb:__global__"} }
+
+	// bucket_size, refill_rate, global_bucket_size, global_refill_rate, now, ttl_buffer, stats_window_ms
+	result := evalScript(t, client, tokenBucketGlobalScript, keys("a"), 2, 1, 3, 1, scriptNow, 5, 0)
+	assert.Equal(t, []interface{}{int64(1), int64(1), int64(2), scriptNow + NanosecondsPerSecond, int64(0), int64(2)}, result)
+
+	evalScript(t, client, tokenBucketGlobalScript, keys("a"), 2, 1, 3, 1, scriptNow, 5, 0)
+	result = evalScript(t, client, tokenBucketGlobalScript, keys("a"), 2, 1, 3, 1, scriptNow, 5, 0)
+	assert.Equal(t, int64(0), result[0])
+	assert.Equal(t, int64(1), result[4], "client a is out of tokens")
+
+	result = evalScript(t, client, tokenBucketGlobalScript, keys("b"), 2, 1, 3, 1, scriptNow, 5, 0)
+	assert.Equal(t, int64(1), result[0])
+	assert.Equal(t, int64(0), result[2])
+
+	result = evalScript(t, client, tokenBucketGlobalScript, keys("c"), 2, 1, 3, 1, scriptNow, 5, 0)
+	assert.Equal(t, []interface{}{int64(0), int64(2), int64(0), scriptNow + NanosecondsPerSecond, int64(2), int64(2)}, result)
+	assert.Equal(t, "2", server.HGet("tb:c", "tokens"), "a global denial doesn't charge the client")
+
+	// A fractional global refill rate and key stats.
+	server.FlushAll()
+	nowMillis := scriptNow / 1000000
+	result = evalScript(t, client, tokenBucketGlobalScript, keys("d"), 2, 1, 1, 0.3, scriptNow, 60, 60000)
+	assert.Equal(t, int64(1), result[0])
+	assert.Equal(t, []interface{}{int64(1), int64(0), nowMillis}, result[6:], "requests, denied and first seen of the client")
+	assert.Equal(t, 64*time.Second, server.TTL("tb:__global__"), "1 token at 0.3/s plus the buffer, rounded up")
+
+	result = evalScript(t, client, tokenBucketGlobalScript, keys("d"), 2, 1, 1, 0.3, scriptNow, 60, 60000)
+	assert.Equal(t, int64(0), result[0])
+	assert.Equal(t, int64(2), result[4], "the global bucket is empty")
+	assert.Equal(t, []interface{}{int64(2), int64(1), nowMillis}, result[6:])
+	assert.Empty(t, server.HGet("tb:__global__", "stats_requests"), "stats are kept for the client only")
+}
+
+func TestSlidingWindowLogScript(t *testing.T) {
+	client, server := newScriptRedis(t)
+	windowStart := scriptNow - 10*NanosecondsPerSecond
+
+	// window_start, now, bucket_size, window_seconds, ttl_buffer, max_entries
+	result := evalScript(t, client, slidingWindowLogScript, []string{"swl:k"}, windowStart, scriptNow, 2, 10, 5, 0)
+	assert.Equal(t, []interface{}{int64(1), int64(1), int64(0), int64(1), int64(0), int64(2)}, result)
+
+	result = evalScript(t, client, slidingWindowLogScript, []string{"swl:k"}, windowStart, scriptNow, 2, 10, 5, 0)
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(0), int64(0), int64(0), int64(2)}, result)
+
+	result = evalScript(t, client, slidingWindowLogScript, []string{"swl:k"}, windowStart, scriptNow, 2, 10, 5, 0)
+	assert.Equal(t, []interface{}{int64(0), int64(2), int64(1010), int64(0), int64(0), int64(2)}, result)
+
+	assert.Equal(t, 15, int(server.TTL("swl:k").Seconds()))
+}
+
+func TestSlidingWindowLogScript_MaxEntries(t *testing.T) {
+	client, server := newScriptRedis(t)
+	windowStart := scriptNow - 10*NanosecondsPerSecond
+
+	// Two requests per second for 3 seconds with a cap of 4 entries.
+	var result []interface{}
+	for i := int64(0); i < 6; i++ {
+		now := scriptNow - 3*NanosecondsPerSecond + i*NanosecondsPerSecond/2
+		result = evalScript(t, client, slidingWindowLogScript, []string{"swl:k"}, windowStart, now, 100, 10, 5, 4)
+	}
+
+	members, err := server.ZMembers("swl:k")
+	require.NoError(t, err)
+	assert.Len(t, members, 4, "the log is trimmed to max_entries")
+	assert.Equal(t, int64(1), result[4], "trimmed responses are flagged approximate")
+
+	// 4 entries over the last 2s extrapolate to 20 over the 10s window.
+	result = evalScript(t, client, slidingWindowLogPeekScript, []string{"swl:k"}, windowStart, 10, scriptNow, 4, 100)
+	assert.Equal(t, int64(20), result[0])
+	assert.Equal(t, int64(1), result[2])
+
+	// The estimate, not the trimmed log size, decides.
+	result = evalScript(t, client, slidingWindowLogScript, []string{"swl:k"}, windowStart, scriptNow, 20, 10, 5, 4)
+	assert.Equal(t, int64(0), result[0])
+}
+
+func TestSlidingWindowLogPeekScript(t *testing.T) {
+	client, server := newScriptRedis(t)
+	windowStart := scriptNow - 10*NanosecondsPerSecond
+
+	_, err := server.ZAdd("swl:k", float64(windowStart), "expired")
+	require.NoError(t, err)
+	_, err = server.ZAdd("swl:k", float64(scriptNow-NanosecondsPerSecond), "live")
+	require.NoError(t, err)
+
+	// window_start, window_seconds, now, max_entries, bucket_size
+	result := evalScript(t, client, slidingWindowLogPeekScript, []string{"swl:k"}, windowStart, 10, scriptNow, 0, 5)
+	assert.Equal(t, []interface{}{int64(1), int64(1009), int64(0), int64(5)}, result)
+
+	members, err := server.ZMembers("swl:k")
+	require.NoError(t, err)
+	assert.Len(t, members, 2, "peek must not trim the log")
+
+	_, err = server.ZAdd("swl:k", float64(scriptNow-NanosecondsPerSecond/2), "newer")
+	require.NoError(t, err)
+	result = evalScript(t, client, slidingWindowLogPeekScript, []string{"swl:k"}, windowStart, 10, scriptNow, 0, 5, 5)
+	require.Len(t, result, 5)
+	recent, err := timestampsFromResult(result[4])
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{
+		time.Unix(0, scriptNow-NanosecondsPerSecond/2),
+		time.Unix(0, scriptNow-NanosecondsPerSecond),
+	}, recent, "newest first, without expired entries")
+}
+
+func TestSlidingWindowCounterScript(t *testing.T) {
+	client, server := newScriptRedis(t)
+	window := int64(10 * NanosecondsPerSecond)
+	current := (scriptNow / window) * window
+	previous := current - window
+
+	server.HSet("swc:k:current", "count", "4", "window_start", "990000000000")
+
+	// current_start, previous_start, bucket_size, window_nanos, ttl_seconds, progress
+	result := evalScript(t, client, slidingWindowCounterScript, []string{"swc:k"}, current, previous, 4, window, 25, "0.5", 0, 0)
+	assert.Equal(t, []interface{}{int64(1), int64(3), int64(0), int64(1), int64(4), int64(1), int64(4)}, result)
+
+	evalScript(t, client, slidingWindowCounterScript, []string{"swc:k"}, current, previous, 4, window, 25, "0.5", 0, 0)
+	result = evalScript(t, client, slidingWindowCounterScript, []string{"swc:k"}, current, previous, 4, window, 25, "0.5", 0, 0)
+	assert.Equal(t, []interface{}{int64(0), int64(4), current + window, int64(2), int64(4), int64(0), int64(4)}, result)
+
+	assert.Equal(t, "2", server.HGet("swc:k:current", "count"))
+	assert.Equal(t, "4", server.HGet("swc:k:previous", "count"))
+	assert.Equal(t, 25, int(server.TTL("swc:k:current").Seconds()))
+}
+
+func TestSlidingWindowCounterPeekScript(t *testing.T) {
+	client, server := newScriptRedis(t)
+	window := int64(10 * NanosecondsPerSecond)
+	current := (scriptNow / window) * window
+	previous := current - window
+
+	server.HSet("swc:k:current", "count", "2", "window_start", "1000000000000")
+	server.HSet("swc:k:previous", "count", "4", "window_start", "990000000000")
+
+	// current_start, previous_start, progress, bucket_size
+	result := evalScript(t, client, slidingWindowCounterPeekScript, []string{"swc:k"}, current, previous, "0.25", 6)
+	assert.Equal(t, []interface{}{int64(5), int64(2), int64(4), int64(6)}, result)
+	assert.Equal(t, "2", server.HGet("swc:k:current", "count"))
+}
+
+func TestQuotaScript(t *testing.T) {
+	client, server := newScriptRedis(t)
+	expireAt := time.Now().Add(24 * time.Hour).Unix()
+
+	// limit, expire_at
+	result := evalScript(t, client, quotaScript, []string{"quota:k"}, 2, expireAt)
+	assert.Equal(t, []interface{}{int64(1), int64(1), int64(2)}, result)
+
+	evalScript(t, client, quotaScript, []string{"quota:k"}, 2, expireAt)
+	result = evalScript(t, client, quotaScript, []string{"quota:k"}, 2, expireAt)
+	assert.Equal(t, []interface{}{int64(0), int64(2), int64(2)}, result)
+
+	value, err := server.Get("quota:k")
+	require.NoError(t, err)
+	assert.Equal(t, "2", value)
+	assert.Greater(t, server.TTL("quota:k").Seconds(), float64(0))
+}
+
+func TestScripts_ThrottleMultiplier(t *testing.T) {
+	client, server := newScriptRedis(t)
+	require.NoError(t, server.Set(ThrottleKey, "0.2"))
+
+	// A bucket of 10 refilling at 1/s becomes 2 refilling at 0.2/s.
+	result := evalScript(t, client, tokenBucketScript, []string{"tb:k"}, 10, 1, scriptNow, 5, 0)
+	assert.Equal(t, []interface{}{int64(1), int64(1), scriptNow + 5*NanosecondsPerSecond, int64(2)}, result)
+
+	expireAt := time.Now().Add(24 * time.Hour).Unix()
+	evalScript(t, client, quotaScript, []string{"quota:k"}, 10, expireAt)
+	evalScript(t, client, quotaScript, []string{"quota:k"}, 10, expireAt)
+	result = evalScript(t, client, quotaScript, []string{"quota:k"}, 10, expireAt)
+	assert.Equal(t, []interface{}{int64(0), int64(2), int64(2)}, result)
+	result = evalScript(t, client, quotaPeekScript, []string{"quota:k"}, 10)
+	assert.Equal(t, []interface{}{int64(2), int64(2)}, result, "peeks see the throttled limit too")
+
+	// Out-of-range values are ignored rather than locking everyone out.
+	require.NoError(t, server.Set(ThrottleKey, "0"))
+	result = evalScript(t, client, tokenBucketPeekScript, []string{"tb:other"}, 10, 1, scriptNow)
+	assert.Equal(t, int64(10), result[2])
+
+	// Limits never drop below one request.
+	require.NoError(t, server.Set(ThrottleKey, "0.01"))
+	result = evalScript(t, client, tokenBucketPeekScript, []string{"tb:other"}, 10, 1, scriptNow)
+	assert.Equal(t, int64(1), result[2])
+}
+
+func TestScripts_SchemaVersion(t *testing.T) {
+	client, server := newScriptRedis(t)
+	schema := strconv.Itoa(SchemaVersion)
+
+	evalScript(t, client, tokenBucketScript, []string{"tb:new"}, 5, 1, scriptNow, 5, 0)
+	assert.Equal(t, schema, server.HGet("tb:new", "schema"))
+	assert.Equal(t, strconv.FormatInt(scriptNow, 10), server.HGet("tb:new", "created_nanos"))
+
+	// Hashes written before versioning are read as they are and stamped.
+	server.HSet("tb:old", "tokens", "2", "last_refill_time_nanos", strconv.FormatInt(scriptNow, 10))
+	result := evalScript(t, client, tokenBucketScript, []string{"tb:old"}, 5, 1, scriptNow, 5, 0)
+	assert.Equal(t, int64(1), result[1])
+	assert.Equal(t, schema, server.HGet("tb:old", "schema"))
+	assert.Empty(t, server.HGet("tb:old", "created_nanos"), "when an older hash was created is unknown")
+
+	// A later version's stamp is kept.
+	later := strconv.Itoa(SchemaVersion + 1)
+	server.HSet("tb:later", "tokens", "2", "last_refill_time_nanos", strconv.FormatInt(scriptNow, 10), "schema", later)
+	evalScript(t, client, tokenBucketScript, []string{"tb:later"}, 5, 1, scriptNow, 5, 0)
+	assert.Equal(t, later, server.HGet("tb:later", "schema"))
+
+	window := int64(10 * NanosecondsPerSecond)
+	current := (scriptNow / window) * window
+	evalScript(t, client, slidingWindowCounterScript, []string{"swc:k"}, current, current-window, 4, window, 25, "0.5", 0, 0)
+	assert.Equal(t, schema, server.HGet("swc:k:current", "schema"))
+	assert.Equal(t, schema, server.HGet("swc:k:previous", "schema"))
+
+	evalScript(t, client, slidingWindowLogScript, []string{"swl:k"}, scriptNow-window, scriptNow, 4, 10, 5, 0)
+	members, err := server.ZMembers("swl:k")
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	assert.True(t, strings.HasPrefix(members[0], "v"+schema+":"))
+
+	// The sub-window counter's hash skips fields that aren't buckets.
+	server.HSet("swc:k:buckets", "100", "1", "schema", later)
+	result = evalScript(t, client, bucketsScript, []string{"swc:k"}, 100, 2, 10, 30, "0.5")
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(8), int64(10), int64(1)}, result[:5])
+	assert.Equal(t, later, server.HGet("swc:k:buckets", "schema"))
+	evalScript(t, client, bucketsScript, []string{"swc:new"}, 100, 2, 10, 30, "0.5")
+	assert.Equal(t, schema, server.HGet("swc:new:buckets", "schema"))
+	result = evalScript(t, client, bucketsPeekScript, []string{"swc:k"}, 100, 2, 10, "0.5")
+	assert.Equal(t, []interface{}{int64(2), int64(10), int64(1)}, result[:3])
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+)
+
+// ShadowRateLimiter enforces one strategy while running another on the same
+// traffic, so the two can be compared before switching. The shadow is
+// checked concurrently and its decision is only counted and added to the
+// metadata; its errors never fail the request.
+type ShadowRateLimiter struct {
+	enforced     RateLimiter
+	shadow       RateLimiter
+	enforcedName string
+	shadowName   string
+	collector    metrics.Collector
+}
+
+func NewShadowRateLimiter(enforced RateLimiter, enforcedName string, shadow RateLimiter, shadowName string, collector metrics.Collector) *ShadowRateLimiter {
+	return &ShadowRateLimiter{
+		enforced:     enforced,
+		shadow:       shadow,
+		enforcedName: enforcedName,
+		shadowName:   shadowName,
+		collector:    collector,
+	}
+}
+
+type shadowResult struct {
+	response RateLimitResponse
+	err      error
+}
+
+func (s *ShadowRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	shadowDone := make(chan shadowResult, 1)
+	go func() {
+		response, err := s.shadow.IsAllowed(ctx, key, timestamp)
+		shadowDone <- shadowResult{response: response, err: err}
+	}()
+
+	response, err := s.enforced.IsAllowed(ctx, key, timestamp)
+	shadow := <-shadowDone
+	if err != nil {
+		return response, err
+	}
+
+	response.Metadata.Set("shadow_strategy", s.shadowName)
+	if shadow.err != nil {
+		s.collector.RecordShadowDecision(s.enforcedName, s.shadowName, metrics.ShadowError)
+		response.Metadata.Set("shadow_error", shadow.err.Error())
+	} else {
+		s.collector.RecordShadowDecision(s.enforcedName, s.shadowName, metrics.ShadowOutcome(response.Allowed, shadow.response.Allowed))
+		response.Metadata.Set("shadow_allowed", shadow.response.Allowed)
+		response.Metadata.SetInt("shadow_remaining", shadow.response.Remaining)
+	}
+	return response, nil
+}
+
+func (s *ShadowRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	peeker, ok := s.enforced.(Peeker)
+	if !ok {
+		return RateLimitResponse{Err: ErrPeekNotSupported}, ErrPeekNotSupported
+	}
+	return peeker.Peek(ctx, key, timestamp)
+}
+
+// Reset clears key under both strategies, so they keep seeing the same
+// traffic.
+func (s *ShadowRateLimiter) Reset(ctx context.Context, key string) error {
+	err := s.enforced.Reset(ctx, key)
+	if shadowErr := s.shadow.Reset(ctx, key); shadowErr != nil {
+		err = errors.Join(err, fmt.Errorf("shadow strategy %s: %w", s.shadowName, shadowErr))
+	}
+	return err
+}
+
+// ResetPrefix clears the prefix under both strategies and reports the
+// enforced strategy's deletions.
+func (s *ShadowRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	resetter, ok := s.enforced.(PrefixResetter)
+	if !ok {
+		return 0, ErrResetPrefixNotSupported
+	}
+	deleted, err := resetter.ResetPrefix(ctx, prefix)
+	if shadowResetter, ok := s.shadow.(PrefixResetter); ok {
+		if _, shadowErr := shadowResetter.ResetPrefix(ctx, prefix); shadowErr != nil {
+			err = errors.Join(err, fmt.Errorf("shadow strategy %s: %w", s.shadowName, shadowErr))
+		}
+	}
+	return deleted, err
+}
+
+// Refund hands back to the shadow too when it can take it; a shadow that
+// can't keeps counting the request.
+func (s *ShadowRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	refunder, ok := s.enforced.(Refunder)
+	if !ok {
+		return ErrRefundNotSupported
+	}
+	if shadowRefunder, ok := s.shadow.(Refunder); ok && SupportsRefund(s.shadow) {
+		_ = shadowRefunder.Refund(ctx, key, n, timestamp)
+	}
+	return refunder.Refund(ctx, key, n, timestamp)
+}
+
+func (s *ShadowRateLimiter) SupportsRefund() bool {
+	return SupportsRefund(s.enforced)
+}
+
+// AddDebt charges the shadow too when it can take it.
+func (s *ShadowRateLimiter) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	debtor, ok := s.enforced.(Debtor)
+	if !ok {
+		return ErrDebtNotSupported
+	}
+	if shadowDebtor, ok := s.shadow.(Debtor); ok {
+		_ = shadowDebtor.AddDebt(ctx, key, n, timestamp)
+	}
+	return debtor.AddDebt(ctx, key, n, timestamp)
+}
+
+// ReserveN is served by the enforced strategy alone; reservations aren't
+// compared.
+func (s *ShadowRateLimiter) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error) {
+	reserver, ok := s.enforced.(Reserver)
+	if !ok {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: ErrReserveNotSupported}}, ErrReserveNotSupported
+	}
+	return reserver.ReserveN(ctx, key, n, timestamp, maxDelay)
+}
+
+func (s *ShadowRateLimiter) SupportsReserve() bool {
+	return SupportsReserve(s.enforced)
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type shadowCollector struct {
+	metrics.NoopCollector
+	outcomes []string
+}
+
+func (s *shadowCollector) RecordShadowDecision(enforced, shadow, outcome string) {
+	s.outcomes = append(s.outcomes, enforced+"/"+shadow+"/"+outcome)
+}
+
+func TestShadowRateLimiter_IsAllowed(t *testing.T) {
+	enforced := new(MockRateLimiterForFactory)
+	shadow := new(MockRateLimiterForFactory)
+	collector := &shadowCollector{}
+	limiter := NewShadowRateLimiter(enforced, "sliding_window_counter", shadow, "sliding_window_log", collector)
+
+	enforced.On("IsAllowed", mock.Anything, "client", mock.Anything).
+		Return(RateLimitResponse{Allowed: true, Metadata: MetadataOf(map[string]interface{}{"weighted_count": 3})}, nil).Twice()
+	shadow.On("IsAllowed", mock.Anything, "client", mock.Anything).
+		Return(RateLimitResponse{Allowed: false}, nil).Once()
+	shadow.On("IsAllowed", mock.Anything, "client", mock.Anything).
+		Return(RateLimitResponse{}, errors.New("redis down")).Once()
+
+	response, err := limiter.IsAllowed(context.Background(), "client", time.Now())
+	require.NoError(t, err)
+	assert.True(t, response.Allowed, "the shadow never decides")
+	assert.Equal(t, 3, response.Metadata.Value("weighted_count"))
+	assert.Equal(t, "sliding_window_log", response.Metadata.Value("shadow_strategy"))
+	assert.Equal(t, false, response.Metadata.Value("shadow_allowed"))
+
+	response, err = limiter.IsAllowed(context.Background(), "client", time.Now())
+	require.NoError(t, err, "shadow errors don't fail the request")
+	assert.True(t, response.Allowed)
+	assert.Equal(t, "redis down", response.Metadata.Value("shadow_error"))
+
+	assert.Equal(t, []string{
+		"sliding_window_counter/sliding_window_log/" + metrics.ShadowStricter,
+		"sliding_window_counter/sliding_window_log/" + metrics.ShadowError,
+	}, collector.outcomes)
+}
+
+func TestShadowRateLimiter_EnforcedError(t *testing.T) {
+	enforced := new(MockRateLimiterForFactory)
+	shadow := new(MockRateLimiterForFactory)
+	collector := &shadowCollector{}
+	limiter := NewShadowRateLimiter(enforced, "token_bucket", shadow, "sliding_window_log", collector)
+
+	enforced.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(RateLimitResponse{}, errors.New("redis down"))
+	shadow.On("IsAllowed", mock.Anything, "client", mock.Anything).Return(RateLimitResponse{Allowed: true}, nil)
+
+	_, err := limiter.IsAllowed(context.Background(), "client", time.Now())
+	assert.Error(t, err)
+	assert.Empty(t, collector.outcomes, "nothing to compare against")
+}
+
+func TestShadowRateLimiter_Reset(t *testing.T) {
+	enforced := new(MockRateLimiterForFactory)
+	shadow := new(MockRateLimiterForFactory)
+	limiter := NewShadowRateLimiter(enforced, "token_bucket", shadow, "sliding_window_log", metrics.NewNoopCollector())
+
+	enforced.On("Reset", mock.Anything, "client").Return(nil)
+	shadow.On("Reset", mock.Anything, "client").Return(errors.New("redis down"))
+
+	err := limiter.Reset(context.Background(), "client")
+	assert.ErrorContains(t, err, "shadow strategy sliding_window_log")
+	enforced.AssertExpectations(t)
+}
+
+func TestShadowOutcome(t *testing.T) {
+	assert.Equal(t, metrics.ShadowAgree, metrics.ShadowOutcome(true, true))
+	assert.Equal(t, metrics.ShadowAgree, metrics.ShadowOutcome(false, false))
+	assert.Equal(t, metrics.ShadowStricter, metrics.ShadowOutcome(true, false))
+	assert.Equal(t, metrics.ShadowLooser, metrics.ShadowOutcome(false, true))
+}
@@ -11,24 +11,45 @@ import (
 )
 
 type SlidingWindowCounterConfig struct {
-	WindowSize       time.Duration
-	BucketSize       int64
-	KeyPrefix        string
-	TTLBufferSeconds int
+	WindowSize       time.Duration `mapstructure:"window_size"`
+	BucketSize       int64         `mapstructure:"bucket_size"`
+	KeyPrefix        string        `mapstructure:"key_prefix"`
+	TTLBufferSeconds int           `mapstructure:"ttl_buffer_seconds"`
+	// SubWindows above 1 splits the window into that many buckets held in a
+	// Redis hash instead of weighting the whole previous window.
+	SubWindows int `mapstructure:"sub_windows"`
+}
+
+func (c SlidingWindowCounterConfig) Validate() error {
+	if c.WindowSize <= 0 || c.BucketSize <= 0 {
+		return errors.New("window_size and bucket_size must be positive")
+	}
+	if c.SubWindows < 0 || c.SubWindows > MaxSubWindows {
+		return fmt.Errorf("sub_windows must be between 0 and %d", MaxSubWindows)
+	}
+	return nil
 }
 
 type SlidingWindowCounterRateLimiter struct {
+	replicaReads
 	windowSizeNanos int64
 	redisClient     *redis.Client
 	keyPrefix       string
 	bucketSize      int64
 	ttlBuffer       int64
+	topKeys         *TopKeys
+	keyStatsWindow  time.Duration
+	subWindows      int64
+	metadata        Metadata
 }
 
 func NewSlidingWindowCounterRateLimiter(config SlidingWindowCounterConfig, redisClient *redis.Client) (*SlidingWindowCounterRateLimiter, error) {
-	if config.WindowSize <= 0 || config.BucketSize <= 0 || redisClient == nil {
+	if redisClient == nil {
 		return nil, errors.New("invalid configuration")
 	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
 	ttlBufferSeconds := config.TTLBufferSeconds
 	if ttlBufferSeconds <= 0 {
@@ -41,10 +62,38 @@ func NewSlidingWindowCounterRateLimiter(config SlidingWindowCounterConfig, redis
 		keyPrefix:       config.KeyPrefix,
 		bucketSize:      config.BucketSize,
 		ttlBuffer:       int64(ttlBufferSeconds),
+		subWindows:      int64(config.SubWindows),
+		metadata:        SharedMetadata(windowCounterMetadata(config)),
 	}, nil
 }
 
+func windowCounterMetadata(config SlidingWindowCounterConfig) map[string]interface{} {
+	windowSizeNanos := config.WindowSize.Nanoseconds()
+	metadata := map[string]interface{}{
+		"window_size": windowSizeNanos / NanosecondsPerSecond,
+	}
+	if config.SubWindows > 1 {
+		subWindows := int64(config.SubWindows)
+		metadata["sub_windows"] = subWindows
+		metadata["sub_window_size"] = float64(windowSizeNanos/subWindows) / float64(NanosecondsPerSecond)
+	}
+	return metadata
+}
+
+func (swc *SlidingWindowCounterRateLimiter) counterMetadata(weightedCount, currentCount, previousCount int64, windowProgress float64) Metadata {
+	metadata := swc.metadata
+	metadata.SetInt("weighted_count", weightedCount)
+	metadata.SetInt("current_count", currentCount)
+	metadata.SetInt("previous_count", previousCount)
+	metadata.SetFloat("window_progress", windowProgress)
+	return metadata
+}
+
 func (swc *SlidingWindowCounterRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	if swc.subWindows > 1 {
+		return swc.isAllowedBuckets(ctx, key, timestamp)
+	}
+
 	redisKey := fmt.Sprintf("%s:%s", swc.keyPrefix, key)
 	currentTimestampNanos := timestamp.UnixNano()
 	currentWindowStart := (currentTimestampNanos / swc.windowSizeNanos) * swc.windowSizeNanos
@@ -56,61 +105,13 @@ func (swc *SlidingWindowCounterRateLimiter) IsAllowed(ctx context.Context, key s
 		windowProgress = 1.0
 	}
 
-	script := `
-		local key = KEYS[1]
-		local current_window_start = tonumber(ARGV[1])
-		local previous_window_start = tonumber(ARGV[2])
-		local bucket_size = tonumber(ARGV[3])
-		local window_size_nanos = tonumber(ARGV[4])
-		local ttl_seconds = tonumber(ARGV[5])
-		local window_progress = tonumber(ARGV[6])
-
-		local current_window_key = key .. ':current'
-		local previous_window_key = key .. ':previous'
-
-		local current_count = 0
-		local previous_count = 0
-
-		local current_window_data = redis.call('HMGET', current_window_key, 'count', 'window_start')
-		if current_window_data[1] and current_window_data[2] then
-			local stored_window_start = tonumber(current_window_data[2])
-			if stored_window_start == current_window_start then
-				current_count = tonumber(current_window_data[1])
-			elseif stored_window_start == previous_window_start then
-				previous_count = tonumber(current_window_data[1])
-			end
-		end
-
-		if previous_count == 0 then
-			local previous_window_data = redis.call('HMGET', previous_window_key, 'count', 'window_start')
-			if previous_window_data[1] and previous_window_data[2] and tonumber(previous_window_data[2]) == previous_window_start then
-				previous_count = tonumber(previous_window_data[1])
-			end
-		end
-
-		local previous_window_weight = 1 - window_progress
-		local weighted_count = math.floor(current_count + (previous_count * previous_window_weight))
-
-		if weighted_count >= bucket_size then
-			local reset_time_nanos = current_window_start + window_size_nanos
-			return {0, weighted_count, reset_time_nanos, current_count, previous_count}
-		end
-
-		local new_current_count = current_count + 1
-		redis.call('HMSET', current_window_key, 'count', new_current_count, 'window_start', current_window_start)
-		redis.call('EXPIRE', current_window_key, ttl_seconds)
-
-		redis.call('HMSET', previous_window_key, 'count', previous_count, 'window_start', previous_window_start)
-		redis.call('EXPIRE', previous_window_key, ttl_seconds)
-
-		local remaining_requests = math.max(0, bucket_size - weighted_count - 1)
-		return {1, weighted_count + 1, 0, new_current_count, previous_count, remaining_requests}
-	`
-
 	ttlSeconds := (swc.windowSizeNanos/NanosecondsPerSecond)*2 + swc.ttlBuffer
 
-	result, err := swc.redisClient.Eval(ctx, script, []string{redisKey},
-		currentWindowStart, previousWindowStart, swc.bucketSize, swc.windowSizeNanos, ttlSeconds, windowProgress).Result()
+	keys, args := swc.topKeys.scriptKeys([]string{redisKey}, []interface{}{
+		currentWindowStart, previousWindowStart, swc.bucketSize, swc.windowSizeNanos, ttlSeconds, windowProgress,
+		swc.keyStatsWindow.Milliseconds(), timestamp.UnixMilli(),
+	}, key, timestamp)
+	result, err := slidingWindowCounterScript.Run(ctx, swc.redisClient, keys, args...).Result()
 
 	if err != nil {
 		return RateLimitResponse{Err: err}, err
@@ -152,13 +153,10 @@ func (swc *SlidingWindowCounterRateLimiter) IsAllowed(ctx context.Context, key s
 		return RateLimitResponse{Err: err}, err
 	}
 
-	metadata := map[string]interface{}{
-		"weighted_count":  weightedCount,
-		"current_count":   currentCount,
-		"previous_count":  previousCount,
-		"window_progress": windowProgress,
-		"window_size":     swc.windowSizeNanos / NanosecondsPerSecond,
-	}
+	metadata := swc.counterMetadata(weightedCount, currentCount, previousCount, windowProgress)
+	limit := limitFromResult(resultArray, 6, swc.bucketSize)
+	markThrottled(&metadata, limit, swc.bucketSize)
+	stats := keyStatsFromResult(resultArray, 7)
 
 	resetTime := time.Unix(0, currentWindowStart+swc.windowSizeNanos)
 	if resetTimeNanos > 0 {
@@ -175,10 +173,11 @@ func (swc *SlidingWindowCounterRateLimiter) IsAllowed(ctx context.Context, key s
 
 		return RateLimitResponse{
 			Allowed:   true,
-			Limit:     swc.bucketSize,
+			Limit:     limit,
 			Remaining: remainingRequests,
 			ResetTime: resetTime,
 			Metadata:  metadata,
+			Stats:     stats,
 		}, nil
 	}
 
@@ -186,11 +185,85 @@ func (swc *SlidingWindowCounterRateLimiter) IsAllowed(ctx context.Context, key s
 
 	return RateLimitResponse{
 		Allowed:    false,
-		Limit:      swc.bucketSize,
+		Limit:      limit,
 		Remaining:  0,
 		ResetTime:  resetTime,
 		RetryAfter: &retryAfter,
 		Metadata:   metadata,
+		Stats:      stats,
+	}, nil
+}
+
+func (swc *SlidingWindowCounterRateLimiter) setTopKeys(topKeys *TopKeys) {
+	swc.topKeys = topKeys
+}
+
+func (swc *SlidingWindowCounterRateLimiter) setKeyStats(window time.Duration) {
+	swc.keyStatsWindow = window
+}
+
+// Peek computes the weighted count for key without incrementing either window.
+func (swc *SlidingWindowCounterRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	if swc.subWindows > 1 {
+		return swc.peekBuckets(ctx, key, timestamp)
+	}
+
+	redisKey := fmt.Sprintf("%s:%s", swc.keyPrefix, key)
+	currentTimestampNanos := timestamp.UnixNano()
+	currentWindowStart := (currentTimestampNanos / swc.windowSizeNanos) * swc.windowSizeNanos
+	previousWindowStart := currentWindowStart - swc.windowSizeNanos
+
+	timeIntoWindow := currentTimestampNanos - currentWindowStart
+	windowProgress := float64(timeIntoWindow) / float64(swc.windowSizeNanos)
+	if windowProgress > 1.0 {
+		windowProgress = 1.0
+	}
+
+	result, err := swc.runRead(ctx, slidingWindowCounterPeekScript, swc.redisClient, []string{redisKey, ThrottleKey},
+		currentWindowStart, previousWindowStart, windowProgress, swc.bucketSize).Result()
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) < 3 {
+		err = errors.New("invalid redis response from sliding window counter peek script")
+		return RateLimitResponse{Err: err}, err
+	}
+
+	weightedCount, err := getInt64FromResult(resultArray[0])
+	if err != nil {
+		err = fmt.Errorf("failed to parse weighted count: %w", err)
+		return RateLimitResponse{Err: err}, err
+	}
+
+	currentCount, err := getInt64FromResult(resultArray[1])
+	if err != nil {
+		err = fmt.Errorf("failed to parse current count: %w", err)
+		return RateLimitResponse{Err: err}, err
+	}
+
+	previousCount, err := getInt64FromResult(resultArray[2])
+	if err != nil {
+		err = fmt.Errorf("failed to parse previous count: %w", err)
+		return RateLimitResponse{Err: err}, err
+	}
+
+	limit := limitFromResult(resultArray, 3, swc.bucketSize)
+	remaining := limit - weightedCount
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	metadata := swc.counterMetadata(weightedCount, currentCount, previousCount, windowProgress)
+	markThrottled(&metadata, limit, swc.bucketSize)
+
+	return RateLimitResponse{
+		Allowed:   remaining > 0,
+		Limit:     limit,
+		Remaining: remaining,
+		ResetTime: time.Unix(0, currentWindowStart+swc.windowSizeNanos),
+		Metadata:  metadata,
 	}, nil
 }
 
@@ -198,11 +271,58 @@ func (swc *SlidingWindowCounterRateLimiter) Reset(ctx context.Context, key strin
 	redisKey := fmt.Sprintf("%s:%s", swc.keyPrefix, key)
 	currentWindowKey := fmt.Sprintf("%s:current", redisKey)
 	previousWindowKey := fmt.Sprintf("%s:previous", redisKey)
+	bucketsKey := fmt.Sprintf("%s:buckets", redisKey)
 
-	_, err := swc.redisClient.Del(ctx, currentWindowKey, previousWindowKey).Result()
+	_, err := swc.redisClient.Del(ctx, currentWindowKey, previousWindowKey, bucketsKey).Result()
 	return err
 }
 
+// ResetPrefix deletes both windows of every key starting with prefix.
+func (swc *SlidingWindowCounterRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPrefix
+	}
+	return deleteMatching(ctx, swc.redisClient, prefixPattern(swc.keyPrefix, prefix))
+}
+
+// AddDebt charges n requests to the current window.
+func (swc *SlidingWindowCounterRateLimiter) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	if n <= 0 {
+		return nil
+	}
+
+	redisKey := fmt.Sprintf("%s:%s", swc.keyPrefix, key)
+	if swc.subWindows > 1 {
+		currentBucket, _ := swc.bucketAt(timestamp)
+		return bucketsDebtScript.Run(ctx, swc.redisClient, []string{redisKey, ThrottleKey},
+			currentBucket, n, swc.bucketTTLSeconds()).Err()
+	}
+
+	currentWindowStart := (timestamp.UnixNano() / swc.windowSizeNanos) * swc.windowSizeNanos
+	previousWindowStart := currentWindowStart - swc.windowSizeNanos
+	ttlSeconds := (swc.windowSizeNanos/NanosecondsPerSecond)*2 + swc.ttlBuffer
+
+	return slidingWindowCounterDebtScript.Run(ctx, swc.redisClient, []string{redisKey, ThrottleKey},
+		currentWindowStart, previousWindowStart, n, ttlSeconds).Err()
+}
+
+// Refund decrements the window timestamp was counted in, if it is still current.
+func (swc *SlidingWindowCounterRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	if n <= 0 {
+		return nil
+	}
+
+	redisKey := fmt.Sprintf("%s:%s", swc.keyPrefix, key)
+	if swc.subWindows > 1 {
+		currentBucket, _ := swc.bucketAt(timestamp)
+		return bucketsRefundScript.Run(ctx, swc.redisClient, []string{redisKey, ThrottleKey}, currentBucket, n).Err()
+	}
+
+	currentWindowStart := (timestamp.UnixNano() / swc.windowSizeNanos) * swc.windowSizeNanos
+
+	return slidingWindowCounterRefundScript.Run(ctx, swc.redisClient, []string{redisKey, ThrottleKey}, currentWindowStart, n).Err()
+}
+
 func (swc *SlidingWindowCounterRateLimiter) calculateRetryAfter(currentCount, previousCount, currentWindowStart, currentTimestamp int64) time.Duration {
 	if previousCount == 0 {
 		retryAfterNanos := (currentWindowStart + swc.windowSizeNanos) - currentTimestamp
@@ -233,30 +353,11 @@ func (c *SlidingWindowCounterConstructor) Name() string {
 }
 
 func (c *SlidingWindowCounterConstructor) NewFromConfig(config map[string]interface{}, redisClient *redis.Client) (RateLimiter, error) {
-	windowSize, err := getDurationConfig(config, "window_size")
-	if err != nil {
-		return nil, fmt.Errorf("sliding window counter strategy: %w", err)
-	}
-	bucketSize, err := getInt64Config(config, "bucket_size")
-	if err != nil {
-		return nil, fmt.Errorf("sliding window counter strategy: %w", err)
-	}
-	keyPrefix, err := getStringConfig(config, "key_prefix")
-	if err != nil {
-		return nil, fmt.Errorf("sliding window counter strategy: %w", err)
-	}
-	ttlBuffer, err := getIntConfig(config, "ttl_buffer_seconds")
+	options, err := DecodeOptions[SlidingWindowCounterConfig](config)
 	if err != nil {
 		return nil, fmt.Errorf("sliding window counter strategy: %w", err)
 	}
-	
-	slidingWindowCounterConfig := SlidingWindowCounterConfig{
-		WindowSize:       windowSize,
-		BucketSize:       bucketSize,
-		KeyPrefix:        keyPrefix,
-		TTLBufferSeconds: ttlBuffer,
-	}
-	return NewSlidingWindowCounterRateLimiter(slidingWindowCounterConfig, redisClient)
+	return NewSlidingWindowCounterRateLimiter(options, redisClient)
 }
 
 func (c *SlidingWindowCounterConstructor) ConvertConfig(rawConfig interface{}) (map[string]interface{}, error) {
@@ -264,12 +365,12 @@ func (c *SlidingWindowCounterConstructor) ConvertConfig(rawConfig interface{}) (
 	if !ok {
 		return nil, fmt.Errorf("expected SlidingWindowCounterConfig, got %T", rawConfig)
 	}
-	
-	windowSize := time.Duration(cfg.WindowSizeSeconds) * time.Second
-	return map[string]interface{}{
-		"key_prefix":         cfg.KeyPrefix,
-		"ttl_buffer_seconds": cfg.TTLBufferSeconds,
-		"window_size":        windowSize,
-		"bucket_size":        cfg.BucketSize,
-	}, nil
+
+	return EncodeOptions(SlidingWindowCounterConfig{
+		WindowSize:       time.Duration(cfg.WindowSizeSeconds) * time.Second,
+		BucketSize:       cfg.BucketSize,
+		KeyPrefix:        cfg.KeyPrefix,
+		TTLBufferSeconds: cfg.TTLBufferSeconds,
+		SubWindows:       cfg.SubWindows,
+	})
 }
@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// With sub-windows the counter keeps one hash field per bucket instead of
+// the two windows. Only the bucket sliding out of the window is weighted, so
+// the estimate can be off by at most that bucket's count rather than the
+// whole previous window's, at the cost of up to sub_windows + 1 fields per
+// key. Both are reported in the metadata as max_error and stored_buckets.
+
+// bucketAt returns the bucket timestamp falls in, numbered from the epoch,
+// and how far into it timestamp is.
+func (swc *SlidingWindowCounterRateLimiter) bucketAt(timestamp time.Time) (int64, float64) {
+	bucketNanos := swc.bucketNanos()
+	nanos := timestamp.UnixNano()
+	bucket := nanos / bucketNanos
+	return bucket, float64(nanos-bucket*bucketNanos) / float64(bucketNanos)
+}
+
+// bucketNanos is the width of one bucket; windows that don't divide evenly
+// lose the remainder.
+func (swc *SlidingWindowCounterRateLimiter) bucketNanos() int64 {
+	return swc.windowSizeNanos / swc.subWindows
+}
+
+func (swc *SlidingWindowCounterRateLimiter) bucketTTLSeconds() int64 {
+	return (swc.windowSizeNanos+swc.bucketNanos())/NanosecondsPerSecond + 1 + swc.ttlBuffer
+}
+
+func (swc *SlidingWindowCounterRateLimiter) isAllowedBuckets(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	redisKey := fmt.Sprintf("%s:%s", swc.keyPrefix, key)
+	currentBucket, progress := swc.bucketAt(timestamp)
+
+	keys, args := swc.topKeys.scriptKeys([]string{redisKey}, []interface{}{
+		currentBucket, swc.subWindows, swc.bucketSize, swc.bucketTTLSeconds(), progress,
+	}, key, timestamp)
+	result, err := bucketsScript.Run(ctx, swc.redisClient, keys, args...).Result()
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	values, err := int64Results(result, 5+int(swc.subWindows)+1)
+	if err != nil {
+		err = fmt.Errorf("sliding window counter buckets: %w", err)
+		return RateLimitResponse{Err: err}, err
+	}
+	allowed, weightedCount, remaining, storedBuckets, counts := values[0], values[1], values[2], values[4], values[5:]
+	limit := swc.bucketSize
+	if values[3] > 0 {
+		limit = values[3]
+	}
+
+	metadata := swc.bucketMetadata(weightedCount, storedBuckets, counts, progress)
+	markThrottled(&metadata, limit, swc.bucketSize)
+
+	nextBucket := time.Unix(0, (currentBucket+1)*swc.bucketNanos())
+	if allowed == 1 {
+		return RateLimitResponse{
+			Allowed:   true,
+			Limit:     limit,
+			Remaining: remaining,
+			ResetTime: nextBucket,
+			Metadata:  metadata,
+		}, nil
+	}
+
+	retryAfter := bucketRetryAfter(counts, limit, currentBucket, swc.bucketNanos(), timestamp.UnixNano())
+	return RateLimitResponse{
+		Allowed:    false,
+		Limit:      limit,
+		Remaining:  0,
+		ResetTime:  timestamp.Add(retryAfter),
+		RetryAfter: &retryAfter,
+		Metadata:   metadata,
+	}, nil
+}
+
+func (swc *SlidingWindowCounterRateLimiter) peekBuckets(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	redisKey := fmt.Sprintf("%s:%s", swc.keyPrefix, key)
+	currentBucket, progress := swc.bucketAt(timestamp)
+
+	result, err := swc.runRead(ctx, bucketsPeekScript, swc.redisClient, []string{redisKey, ThrottleKey},
+		currentBucket, swc.subWindows, swc.bucketSize, progress).Result()
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	values, err := int64Results(result, 3+int(swc.subWindows)+1)
+	if err != nil {
+		err = fmt.Errorf("sliding window counter buckets peek: %w", err)
+		return RateLimitResponse{Err: err}, err
+	}
+	weightedCount, storedBuckets, counts := values[0], values[2], values[3:]
+	limit := swc.bucketSize
+	if values[1] > 0 {
+		limit = values[1]
+	}
+
+	remaining := limit - weightedCount
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	metadata := swc.bucketMetadata(weightedCount, storedBuckets, counts, progress)
+	markThrottled(&metadata, limit, swc.bucketSize)
+
+	return RateLimitResponse{
+		Allowed:   remaining > 0,
+		Limit:     limit,
+		Remaining: remaining,
+		ResetTime: time.Unix(0, (currentBucket+1)*swc.bucketNanos()),
+		Metadata:  metadata,
+	}, nil
+}
+
+func (swc *SlidingWindowCounterRateLimiter) bucketMetadata(weightedCount, storedBuckets int64, counts []int64, progress float64) Metadata {
+	metadata := swc.metadata
+	metadata.SetInt("weighted_count", weightedCount)
+	metadata.SetInt("current_count", counts[len(counts)-1])
+	metadata.SetFloat("sub_window_progress", progress)
+	metadata.SetInt("stored_buckets", storedBuckets)
+	metadata.SetInt("max_error", counts[0])
+	return metadata
+}
+
+// bucketRetryAfter finds how long until the weighted count drops below limit
+// if no more requests are counted. counts runs from the bucket sliding out of
+// the window to the current one.
+func bucketRetryAfter(counts []int64, limit, currentBucket, bucketNanos, now int64) time.Duration {
+	subWindows := int64(len(counts) - 1)
+	for k := int64(0); k <= subWindows; k++ {
+		// During bucket currentBucket+k, counts[k] slides out and the rest
+		// are fully inside the window.
+		var full int64
+		for _, count := range counts[k+1:] {
+			full += count
+		}
+		if full >= limit {
+			continue
+		}
+
+		at := (currentBucket + k) * bucketNanos
+		if edge := counts[k]; edge > 0 {
+			// full + edge * (1 - progress) < limit
+			progress := 1 - float64(limit-full)/float64(edge)
+			if progress >= 0 {
+				at += int64(progress*float64(bucketNanos)) + 1
+			}
+		}
+		if at < now {
+			at = now
+		}
+		return time.Duration(at - now)
+	}
+	return time.Duration((currentBucket+subWindows+1)*bucketNanos - now)
+}
+
+func int64Results(result interface{}, length int) ([]int64, error) {
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) != length {
+		return nil, errors.New("invalid redis response from rate limit script")
+	}
+
+	values := make([]int64, len(resultArray))
+	for i, value := range resultArray {
+		parsed, err := getInt64FromResult(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse result %d: %w", i, err)
+		}
+		values[i] = parsed
+	}
+	return values, nil
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlidingWindowCounterRateLimiter_SubWindows(t *testing.T) {
+	client, server := newScriptRedis(t)
+	limiter, err := NewSlidingWindowCounterRateLimiter(SlidingWindowCounterConfig{
+		WindowSize: time.Minute,
+		BucketSize: 10,
+		KeyPrefix:  "test:swc",
+		SubWindows: 6,
+	}, client)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	base := time.Unix(6000, 0)
+	for i := 0; i < 6; i++ {
+		response, err := limiter.IsAllowed(ctx, "client", base.Add(time.Second))
+		require.NoError(t, err)
+		require.True(t, response.Allowed)
+	}
+	for i := 0; i < 4; i++ {
+		response, err := limiter.IsAllowed(ctx, "client", base.Add(25*time.Second))
+		require.NoError(t, err)
+		require.True(t, response.Allowed)
+	}
+
+	response, err := limiter.IsAllowed(ctx, "client", base.Add(26*time.Second))
+	require.NoError(t, err)
+	assert.False(t, response.Allowed)
+	require.NotNil(t, response.RetryAfter)
+	assert.Equal(t, 34*time.Second+time.Nanosecond, *response.RetryAfter, "until the first bucket starts sliding out")
+	assert.Equal(t, int64(10), response.Metadata.Value("weighted_count"))
+	assert.Equal(t, int64(2), response.Metadata.Value("stored_buckets"))
+	assert.Equal(t, int64(6), response.Metadata.Value("sub_windows"))
+	assert.Equal(t, 10.0, response.Metadata.Value("sub_window_size"))
+
+	peek, err := limiter.Peek(ctx, "client", base.Add(26*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), peek.Remaining)
+
+	// A tenth of the way into the bucket after the window, 90% of the first
+	// bucket still counts: 4 + 6*0.9 = 9.4.
+	response, err = limiter.IsAllowed(ctx, "client", base.Add(61*time.Second))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(6), response.Metadata.Value("max_error"))
+
+	response, err = limiter.IsAllowed(ctx, "client", base.Add(10*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(1), response.Metadata.Value("weighted_count"))
+	fields, err := client.HLen(ctx, "test:swc:client:buckets").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), fields, "buckets outside the window are pruned, leaving the current one and the schema")
+	assert.Positive(t, server.TTL("test:swc:client:buckets"))
+
+	require.NoError(t, limiter.Reset(ctx, "client"))
+	assert.False(t, server.Exists("test:swc:client:buckets"))
+}
+
+func TestSlidingWindowCounterRateLimiter_SubWindowsDebtAndRefund(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	limiter, err := NewSlidingWindowCounterRateLimiter(SlidingWindowCounterConfig{
+		WindowSize: time.Minute,
+		BucketSize: 10,
+		KeyPrefix:  "test:swc",
+		SubWindows: 60,
+	}, client)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	now := time.Unix(6000, 0)
+	require.NoError(t, limiter.AddDebt(ctx, "client", 9, now))
+
+	response, err := limiter.IsAllowed(ctx, "client", now)
+	require.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(0), response.Remaining)
+
+	require.NoError(t, limiter.Refund(ctx, "client", 3, now))
+	peek, err := limiter.Peek(ctx, "client", now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), peek.Remaining)
+}
+
+func TestNewSlidingWindowCounterRateLimiter_SubWindowsBounds(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	_, err := NewSlidingWindowCounterRateLimiter(SlidingWindowCounterConfig{
+		WindowSize: time.Minute,
+		BucketSize: 10,
+		SubWindows: MaxSubWindows + 1,
+	}, client)
+	assert.Error(t, err)
+}
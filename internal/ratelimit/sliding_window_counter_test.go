@@ -207,21 +207,21 @@ func TestSlidingWindowCounterRateLimiter_ResponseParsing(t *testing.T) {
 			if resetTimeNanos > 0 {
 				response.ResetTime = time.Unix(0, resetTimeNanos)
 			}
-			response.Metadata = map[string]interface{}{
+			response.Metadata = MetadataOf(map[string]interface{}{
 				"weighted_count":  weightedCount,
 				"current_count":   currentCount,
 				"previous_count":  previousCount,
 				"window_progress": windowProgress,
 				"window_size":     limiter.windowSizeNanos / NanosecondsPerSecond,
-			}
+			})
 		}
 		
 		assert.True(t, response.Allowed)
 		assert.Equal(t, int64(5), response.Limit)
 		assert.Equal(t, int64(2), response.Remaining)
 		assert.NotNil(t, response.Metadata)
-		assert.Equal(t, int64(2), response.Metadata["weighted_count"])
-		assert.Equal(t, int64(2), response.Metadata["current_count"])
+		assert.Equal(t, int64(2), response.Metadata.Value("weighted_count"))
+		assert.Equal(t, int64(2), response.Metadata.Value("current_count"))
 	})
 
 	t.Run("denied request response", func(t *testing.T) {
@@ -249,13 +249,13 @@ func TestSlidingWindowCounterRateLimiter_ResponseParsing(t *testing.T) {
 			response.ResetTime = time.Unix(0, resetTimeNanos)
 			retryAfter := limiter.calculateRetryAfter(currentCount, previousCount, currentWindowStart, currentTimestamp)
 			response.RetryAfter = &retryAfter
-			response.Metadata = map[string]interface{}{
+			response.Metadata = MetadataOf(map[string]interface{}{
 				"weighted_count":  weightedCount,
 				"current_count":   currentCount,
 				"previous_count":  previousCount,
 				"window_progress": windowProgress,
 				"window_size":     limiter.windowSizeNanos / NanosecondsPerSecond,
-			}
+			})
 		}
 		
 		assert.False(t, response.Allowed)
@@ -263,8 +263,8 @@ func TestSlidingWindowCounterRateLimiter_ResponseParsing(t *testing.T) {
 		assert.Equal(t, int64(0), response.Remaining)
 		assert.NotNil(t, response.RetryAfter)
 		assert.NotNil(t, response.Metadata)
-		assert.Equal(t, int64(5), response.Metadata["weighted_count"])
-		assert.Equal(t, int64(3), response.Metadata["current_count"])
+		assert.Equal(t, int64(5), response.Metadata.Value("weighted_count"))
+		assert.Equal(t, int64(3), response.Metadata.Value("current_count"))
 	})
 }
 
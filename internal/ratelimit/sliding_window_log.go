@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/pmujumdar27/go-rate-limiter/internal/config"
@@ -11,24 +12,44 @@ import (
 )
 
 type SlidingWindowLogConfig struct {
-	WindowSize       time.Duration
-	BucketSize       int64
-	KeyPrefix        string
-	TTLBufferSeconds int
+	WindowSize       time.Duration `mapstructure:"window_size"`
+	BucketSize       int64         `mapstructure:"bucket_size"`
+	KeyPrefix        string        `mapstructure:"key_prefix"`
+	TTLBufferSeconds int           `mapstructure:"ttl_buffer_seconds"`
+	// MaxEntries caps the log kept per key; 0 means unbounded. When the cap
+	// is hit the count is extrapolated and responses are marked approximate.
+	MaxEntries int64 `mapstructure:"max_entries"`
+}
+
+func (c SlidingWindowLogConfig) Validate() error {
+	if c.WindowSize <= 0 || c.BucketSize <= 0 {
+		return errors.New("window_size and bucket_size must be positive")
+	}
+	if c.MaxEntries < 0 {
+		return errors.New("max_entries must not be negative")
+	}
+	return nil
 }
 
 type SlidingWindowLogRateLimiter struct {
+	replicaReads
 	windowSizeSeconds int64
 	redisClient       *redis.Client
 	keyPrefix         string
 	bucketSize        int64
 	ttlBuffer         int64
+	maxEntries        int64
+	topKeys           *TopKeys
+	metadata          Metadata
 }
 
 func NewSlidingWindowLogRateLimiter(config SlidingWindowLogConfig, redisClient *redis.Client) (*SlidingWindowLogRateLimiter, error) {
-	if config.WindowSize <= 0 || config.BucketSize <= 0 || redisClient == nil {
+	if redisClient == nil {
 		return nil, errors.New("invalid configuration")
 	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
 	ttlBufferSeconds := config.TTLBufferSeconds
 	if ttlBufferSeconds <= 0 {
@@ -41,6 +62,10 @@ func NewSlidingWindowLogRateLimiter(config SlidingWindowLogConfig, redisClient *
 		keyPrefix:         config.KeyPrefix,
 		bucketSize:        config.BucketSize,
 		ttlBuffer:         int64(ttlBufferSeconds),
+		maxEntries:        config.MaxEntries,
+		metadata: SharedMetadata(map[string]interface{}{
+			"window_size": int64(config.WindowSize.Seconds()),
+		}),
 	}, nil
 }
 
@@ -50,44 +75,10 @@ func (swl *SlidingWindowLogRateLimiter) IsAllowed(ctx context.Context, key strin
 	currentTimestampNanos := timestamp.UnixNano()
 	windowStartNanos := currentTimestampNanos - (swl.windowSizeSeconds * NanosecondsPerSecond)
 
-	script := `
-		local key = KEYS[1]
-		local window_start_nanos = tonumber(ARGV[1])
-		local current_timestamp_nanos = tonumber(ARGV[2])
-		local bucket_size = tonumber(ARGV[3])
-		local window_size_seconds = tonumber(ARGV[4])
-		local ttl_buffer_seconds = tonumber(ARGV[5])
-		
-		redis.call('ZREMRANGEBYSCORE', key, '-inf', window_start_nanos)
-		
-		local current_count = redis.call('ZCARD', key)
-		
-		if current_count >= bucket_size then
-			local timestamps = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
-			local oldest_timestamp_nanos = 0
-			local reset_time_seconds = 0
-			
-			if #timestamps > 0 then
-				oldest_timestamp_nanos = tonumber(timestamps[2])
-				reset_time_seconds = (oldest_timestamp_nanos + (window_size_seconds * 1000000000)) / 1000000000 -- NanosecondsPerSecond
-			end
-			
-			return {0, current_count, reset_time_seconds}
-		end
-		
-		local member = current_timestamp_nanos .. ':' .. math.random()
-		redis.call('ZADD', key, current_timestamp_nanos, member)
-		
-		local ttl_seconds = window_size_seconds + ttl_buffer_seconds
-		redis.call('EXPIRE', key, ttl_seconds)
-		
-		local remaining = bucket_size - current_count - 1
-		
-		return {1, current_count + 1, 0, remaining}
-	`
-
-	result, err := swl.redisClient.Eval(ctx, script, []string{redisKey},
-		windowStartNanos, currentTimestampNanos, swl.bucketSize, swl.windowSizeSeconds, swl.ttlBuffer).Result()
+	keys, args := swl.topKeys.scriptKeys([]string{redisKey}, []interface{}{
+		windowStartNanos, currentTimestampNanos, swl.bucketSize, swl.windowSizeSeconds, swl.ttlBuffer, swl.maxEntries,
+	}, key, timestamp)
+	result, err := slidingWindowLogScript.Run(ctx, swl.redisClient, keys, args...).Result()
 
 	if err != nil {
 		return RateLimitResponse{
@@ -119,10 +110,13 @@ func (swl *SlidingWindowLogRateLimiter) IsAllowed(ctx context.Context, key strin
 		return RateLimitResponse{Err: err}, err
 	}
 
-	metadata := map[string]interface{}{
-		"current_count": currentCount,
-		"window_size":   swl.windowSizeSeconds,
+	metadata := swl.metadata
+	metadata.SetInt("current_count", currentCount)
+	if len(resultArray) > 4 {
+		swl.markApproximate(&metadata, resultArray[4])
 	}
+	limit := limitFromResult(resultArray, 5, swl.bucketSize)
+	markThrottled(&metadata, limit, swl.bucketSize)
 
 	resetTime := timestamp.Add(time.Duration(swl.windowSizeSeconds) * time.Second)
 	if resetTimeSeconds > 0 {
@@ -139,7 +133,7 @@ func (swl *SlidingWindowLogRateLimiter) IsAllowed(ctx context.Context, key strin
 
 		return RateLimitResponse{
 			Allowed:   true,
-			Limit:     swl.bucketSize,
+			Limit:     limit,
 			Remaining: remainingRequests,
 			ResetTime: resetTime,
 			Metadata:  metadata,
@@ -150,7 +144,7 @@ func (swl *SlidingWindowLogRateLimiter) IsAllowed(ctx context.Context, key strin
 
 	return RateLimitResponse{
 		Allowed:    false,
-		Limit:      swl.bucketSize,
+		Limit:      limit,
 		Remaining:  0,
 		ResetTime:  resetTime,
 		RetryAfter: &retryAfter,
@@ -158,6 +152,132 @@ func (swl *SlidingWindowLogRateLimiter) IsAllowed(ctx context.Context, key strin
 	}, nil
 }
 
+func (swl *SlidingWindowLogRateLimiter) setTopKeys(topKeys *TopKeys) {
+	swl.topKeys = topKeys
+}
+
+// MaxRecentRequests caps how many request timestamps Peek returns.
+const MaxRecentRequests = 100
+
+type recentRequestsContextKey struct{}
+
+// WithRecentRequests asks Peek for the timestamps of the key's n most recent
+// requests in the window, newest first, in RateLimitResponse.RecentRequests,
+// to compare the limiter's view with a client's own logs. Only strategies
+// that log request times, like the sliding window log, return them. n is
+// capped at MaxRecentRequests.
+func WithRecentRequests(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, recentRequestsContextKey{}, min(n, MaxRecentRequests))
+}
+
+func RecentRequestsFromContext(ctx context.Context) int {
+	n, _ := ctx.Value(recentRequestsContextKey{}).(int)
+	return max(n, 0)
+}
+
+// Peek counts the requests logged in the current window without recording one.
+func (swl *SlidingWindowLogRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	redisKey := fmt.Sprintf("%s:%s", swl.keyPrefix, key)
+
+	currentTimestampNanos := timestamp.UnixNano()
+	windowStartNanos := currentTimestampNanos - (swl.windowSizeSeconds * NanosecondsPerSecond)
+
+	result, err := swl.runRead(ctx, slidingWindowLogPeekScript, swl.redisClient, []string{redisKey, ThrottleKey},
+		windowStartNanos, swl.windowSizeSeconds, currentTimestampNanos, swl.maxEntries, swl.bucketSize,
+		RecentRequestsFromContext(ctx)).Result()
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) < 2 {
+		err = errors.New("invalid redis response from sliding window log peek script")
+		return RateLimitResponse{Err: err}, err
+	}
+
+	currentCount, err := getInt64FromResult(resultArray[0])
+	if err != nil {
+		err = fmt.Errorf("failed to parse current count: %w", err)
+		return RateLimitResponse{Err: err}, err
+	}
+
+	resetTimeSeconds, err := getInt64FromResult(resultArray[1])
+	if err != nil {
+		err = fmt.Errorf("failed to parse reset time: %w", err)
+		return RateLimitResponse{Err: err}, err
+	}
+
+	resetTime := timestamp.Add(time.Duration(swl.windowSizeSeconds) * time.Second)
+	if resetTimeSeconds > 0 {
+		resetTime = time.Unix(resetTimeSeconds, 0)
+	}
+
+	limit := limitFromResult(resultArray, 3, swl.bucketSize)
+	remaining := limit - currentCount
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	metadata := swl.metadata
+	metadata.SetInt("current_count", currentCount)
+	if len(resultArray) > 2 {
+		swl.markApproximate(&metadata, resultArray[2])
+	}
+	markThrottled(&metadata, limit, swl.bucketSize)
+
+	var recent []time.Time
+	if len(resultArray) > 4 {
+		if recent, err = timestampsFromResult(resultArray[4]); err != nil {
+			err = fmt.Errorf("failed to parse recent requests: %w", err)
+			return RateLimitResponse{Err: err}, err
+		}
+	}
+
+	return RateLimitResponse{
+		Allowed:        remaining > 0,
+		Limit:          limit,
+		Remaining:      remaining,
+		ResetTime:      resetTime,
+		Metadata:       metadata,
+		RecentRequests: recent,
+	}, nil
+}
+
+// timestampsFromResult reads a script's list of nanosecond scores. Scores are
+// doubles, so the times are only accurate to a microsecond or so.
+func timestampsFromResult(result interface{}) ([]time.Time, error) {
+	scores, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list, got %T", result)
+	}
+	if len(scores) == 0 {
+		return nil, nil
+	}
+
+	timestamps := make([]time.Time, 0, len(scores))
+	for _, score := range scores {
+		text, ok := score.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a score, got %T", score)
+		}
+		nanos, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, err
+		}
+		timestamps = append(timestamps, time.Unix(0, int64(nanos)))
+	}
+	return timestamps, nil
+}
+
+// markApproximate flags responses whose count was extrapolated because the
+// log reached max_entries.
+func (swl *SlidingWindowLogRateLimiter) markApproximate(metadata *Metadata, flag interface{}) {
+	if approximate, err := getInt64FromResult(flag); err == nil && approximate == 1 {
+		metadata.Set("approximate", true)
+		metadata.Set("warning", fmt.Sprintf("log trimmed to %d entries; count is approximate", swl.maxEntries))
+	}
+}
+
 func (swl *SlidingWindowLogRateLimiter) Reset(ctx context.Context, key string) error {
 	redisKey := fmt.Sprintf("%s:%s", swl.keyPrefix, key)
 
@@ -169,6 +289,37 @@ func (swl *SlidingWindowLogRateLimiter) Reset(ctx context.Context, key string) e
 	return nil
 }
 
+func (swl *SlidingWindowLogRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPrefix
+	}
+	return deleteMatching(ctx, swl.redisClient, prefixPattern(swl.keyPrefix, prefix))
+}
+
+// AddDebt logs n extra requests now, at most the bucket size: they all age
+// out together, so more would deny the key no longer.
+func (swl *SlidingWindowLogRateLimiter) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	if n <= 0 {
+		return nil
+	}
+	n = min(n, swl.bucketSize)
+
+	redisKey := fmt.Sprintf("%s:%s", swl.keyPrefix, key)
+
+	return slidingWindowLogDebtScript.Run(ctx, swl.redisClient, []string{redisKey, ThrottleKey},
+		n, timestamp.UnixNano(), swl.windowSizeSeconds+swl.ttlBuffer).Err()
+}
+
+func (swl *SlidingWindowLogRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	if n <= 0 {
+		return nil
+	}
+
+	redisKey := fmt.Sprintf("%s:%s", swl.keyPrefix, key)
+
+	return slidingWindowLogRefundScript.Run(ctx, swl.redisClient, []string{redisKey, ThrottleKey}, n).Err()
+}
+
 func (swl *SlidingWindowLogRateLimiter) calculateRetryAfter(resetTime *time.Time, currentTime time.Time) time.Duration {
 	if resetTime == nil {
 		return 0
@@ -189,30 +340,11 @@ func (c *SlidingWindowLogConstructor) Name() string {
 }
 
 func (c *SlidingWindowLogConstructor) NewFromConfig(config map[string]interface{}, redisClient *redis.Client) (RateLimiter, error) {
-	windowSize, err := getDurationConfig(config, "window_size")
+	options, err := DecodeOptions[SlidingWindowLogConfig](config)
 	if err != nil {
 		return nil, fmt.Errorf("sliding window strategy: %w", err)
 	}
-	bucketSize, err := getInt64Config(config, "bucket_size")
-	if err != nil {
-		return nil, fmt.Errorf("sliding window strategy: %w", err)
-	}
-	keyPrefix, err := getStringConfig(config, "key_prefix")
-	if err != nil {
-		return nil, fmt.Errorf("sliding window strategy: %w", err)
-	}
-	ttlBuffer, err := getIntConfig(config, "ttl_buffer_seconds")
-	if err != nil {
-		return nil, fmt.Errorf("sliding window strategy: %w", err)
-	}
-
-	slidingWindowLogConfig := SlidingWindowLogConfig{
-		WindowSize:       windowSize,
-		BucketSize:       bucketSize,
-		KeyPrefix:        keyPrefix,
-		TTLBufferSeconds: ttlBuffer,
-	}
-	return NewSlidingWindowLogRateLimiter(slidingWindowLogConfig, redisClient)
+	return NewSlidingWindowLogRateLimiter(options, redisClient)
 }
 
 func (c *SlidingWindowLogConstructor) ConvertConfig(rawConfig interface{}) (map[string]interface{}, error) {
@@ -221,11 +353,11 @@ func (c *SlidingWindowLogConstructor) ConvertConfig(rawConfig interface{}) (map[
 		return nil, fmt.Errorf("expected SlidingWindowLogConfig, got %T", rawConfig)
 	}
 
-	windowSize := time.Duration(cfg.WindowSizeSeconds) * time.Second
-	return map[string]interface{}{
-		"key_prefix":         cfg.KeyPrefix,
-		"ttl_buffer_seconds": cfg.TTLBufferSeconds,
-		"window_size":        windowSize,
-		"bucket_size":        cfg.BucketSize,
-	}, nil
+	return EncodeOptions(SlidingWindowLogConfig{
+		WindowSize:       time.Duration(cfg.WindowSizeSeconds) * time.Second,
+		BucketSize:       cfg.BucketSize,
+		KeyPrefix:        cfg.KeyPrefix,
+		TTLBufferSeconds: cfg.TTLBufferSeconds,
+		MaxEntries:       cfg.MaxEntries,
+	})
 }
@@ -167,17 +167,17 @@ func TestSlidingWindowLogRateLimiter_ResponseParsing(t *testing.T) {
 			if resetTimeSeconds > 0 {
 				response.ResetTime = time.Unix(resetTimeSeconds, 0)
 			}
-			response.Metadata = map[string]interface{}{
+			response.Metadata = MetadataOf(map[string]interface{}{
 				"current_count": currentCount,
 				"window_size":   limiter.windowSizeSeconds,
-			}
+			})
 		}
 		
 		assert.True(t, response.Allowed)
 		assert.Equal(t, int64(5), response.Limit)
 		assert.Equal(t, int64(3), response.Remaining)
 		assert.NotNil(t, response.Metadata)
-		assert.Equal(t, int64(2), response.Metadata["current_count"])
+		assert.Equal(t, int64(2), response.Metadata.Value("current_count"))
 	})
 
 	t.Run("denied request response", func(t *testing.T) {
@@ -198,10 +198,10 @@ func TestSlidingWindowLogRateLimiter_ResponseParsing(t *testing.T) {
 			response.ResetTime = time.Unix(resetTimeSeconds, 0)
 			retryAfter := response.ResetTime.Sub(timestamp)
 			response.RetryAfter = &retryAfter
-			response.Metadata = map[string]interface{}{
+			response.Metadata = MetadataOf(map[string]interface{}{
 				"current_count": currentCount,
 				"window_size":   limiter.windowSizeSeconds,
-			}
+			})
 		}
 		
 		assert.False(t, response.Allowed)
@@ -209,7 +209,7 @@ func TestSlidingWindowLogRateLimiter_ResponseParsing(t *testing.T) {
 		assert.Equal(t, int64(0), response.Remaining)
 		assert.NotNil(t, response.RetryAfter)
 		assert.NotNil(t, response.Metadata)
-		assert.Equal(t, int64(5), response.Metadata["current_count"])
+		assert.Equal(t, int64(5), response.Metadata.Value("current_count"))
 	})
 }
 
@@ -0,0 +1,293 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// StateTransfer copies the limiter state under each strategy's key prefix
+// from one Redis to another, so a backend can be replaced without resetting
+// every client's budget. Export runs against the old Redis and Import against
+// the new one.
+type StateTransfer struct {
+	redisClient *redis.Client
+	prefixes    map[string]string
+	scanCount   int64
+}
+
+// NewStateTransfer transfers the keys under each of prefixes, keyed by a name
+// such as the strategy owning them.
+func NewStateTransfer(redisClient *redis.Client, prefixes map[string]string, scanCount int64) *StateTransfer {
+	if scanCount <= 0 {
+		scanCount = DefaultActiveKeysScanCount
+	}
+
+	return &StateTransfer{
+		redisClient: redisClient,
+		prefixes:    prefixes,
+		scanCount:   scanCount,
+	}
+}
+
+var ErrInvalidKeyState = errors.New("invalid key state")
+
+// Key types the built-in strategies store, and so the ones transferred.
+const (
+	KeyTypeString = "string"
+	KeyTypeHash   = "hash"
+	KeyTypeZSet   = "zset"
+)
+
+type ZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// KeyState is one exported key. Only the field matching Type is set. TTLMs is
+// the time the key had left when exported; zero means it never expires.
+type KeyState struct {
+	Key    string            `json:"key"`
+	Type   string            `json:"type"`
+	TTLMs  int64             `json:"ttl_ms,omitempty"`
+	String *string           `json:"string,omitempty"`
+	Hash   map[string]string `json:"hash,omitempty"`
+	ZSet   []ZMember         `json:"zset,omitempty"`
+}
+
+type StateExport struct {
+	ExportedAt time.Time         `json:"exported_at"`
+	Prefixes   map[string]string `json:"prefixes"`
+	Keys       []KeyState        `json:"keys"`
+	// Skipped counts keys of types the strategies don't use.
+	Skipped int64 `json:"skipped"`
+}
+
+// Export reads every key under the prefixes, or only the one called name.
+// Keys are read one SCAN page at a time while traffic goes on, so the export
+// is not a point-in-time snapshot; stop sending traffic to the old backend
+// first for an exact copy.
+func (s *StateTransfer) Export(ctx context.Context, name string) (StateExport, error) {
+	prefixes, err := s.selectPrefixes(name)
+	if err != nil {
+		return StateExport{}, err
+	}
+
+	export := StateExport{ExportedAt: time.Now(), Prefixes: prefixes, Keys: []KeyState{}}
+	names := make([]string, 0, len(prefixes))
+	for name := range prefixes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := s.exportPrefix(ctx, prefixes[name], &export); err != nil {
+			return StateExport{}, fmt.Errorf("prefix %s: %w", name, err)
+		}
+	}
+	return export, nil
+}
+
+func (s *StateTransfer) selectPrefixes(name string) (map[string]string, error) {
+	if name == "" {
+		return s.prefixes, nil
+	}
+	prefix, ok := s.prefixes[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyPrefix, name)
+	}
+	return map[string]string{name: prefix}, nil
+}
+
+func (s *StateTransfer) exportPrefix(ctx context.Context, prefix string, export *StateExport) error {
+	pattern := globReplacer.Replace(keysUnder(prefix)) + "*"
+
+	var cursor uint64
+	for {
+		keys, next, err := s.redisClient.Scan(ctx, cursor, pattern, s.scanCount).Result()
+		if err != nil {
+			return err
+		}
+		if err := s.exportKeys(ctx, keys, export); err != nil {
+			return err
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// exportKeys reads one SCAN page: the type and TTL of each key first, then
+// its value with the command for that type.
+func (s *StateTransfer) exportKeys(ctx context.Context, keys []string, export *StateExport) error {
+	types := make([]*redis.StatusCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+
+	pipe := s.redisClient.Pipeline()
+	for i, key := range keys {
+		types[i] = pipe.Type(ctx, key)
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	states := make([]KeyState, 0, len(keys))
+	values := make([]redis.Cmder, 0, len(keys))
+	pipe = s.redisClient.Pipeline()
+	for i, key := range keys {
+		ttl := ttls[i].Val()
+		if ttl == -2 {
+			// Expired or deleted since the scan.
+			continue
+		}
+
+		state := KeyState{Key: key, Type: types[i].Val()}
+		if ttl > 0 {
+			state.TTLMs = max(1, ttl.Milliseconds())
+		}
+		switch state.Type {
+		case KeyTypeString:
+			values = append(values, pipe.Get(ctx, key))
+		case KeyTypeHash:
+			values = append(values, pipe.HGetAll(ctx, key))
+		case KeyTypeZSet:
+			values = append(values, pipe.ZRangeWithScores(ctx, key, 0, -1))
+		default:
+			export.Skipped++
+			continue
+		}
+		states = append(states, state)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	for i, state := range states {
+		switch cmd := values[i].(type) {
+		case *redis.StringCmd:
+			value, err := cmd.Result()
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			state.String = &value
+		case *redis.MapStringStringCmd:
+			state.Hash = cmd.Val()
+			if len(state.Hash) == 0 {
+				continue
+			}
+		case *redis.ZSliceCmd:
+			for _, z := range cmd.Val() {
+				state.ZSet = append(state.ZSet, ZMember{Member: fmt.Sprint(z.Member), Score: z.Score})
+			}
+			if len(state.ZSet) == 0 {
+				continue
+			}
+		}
+		export.Keys = append(export.Keys, state)
+	}
+	return nil
+}
+
+type ImportOptions struct {
+	// Overwrite replaces keys that already exist; by default they are kept,
+	// as they hold state counted since the new backend took traffic.
+	Overwrite bool
+}
+
+type ImportResult struct {
+	Imported int64 `json:"imported"`
+	Existing int64 `json:"existing"`
+}
+
+// Import writes keys, each atomically. Every key must lie under one of the
+// prefixes, so an export can't be used to write arbitrary keys; all keys are
+// checked before any is written.
+func (s *StateTransfer) Import(ctx context.Context, keys []KeyState, options ImportOptions) (ImportResult, error) {
+	for _, state := range keys {
+		if err := s.validate(state); err != nil {
+			return ImportResult{}, err
+		}
+	}
+
+	overwrite := "0"
+	if options.Overwrite {
+		overwrite = "1"
+	}
+
+	var result ImportResult
+	for _, state := range keys {
+		args := []interface{}{overwrite, state.Type, state.TTLMs}
+		switch state.Type {
+		case KeyTypeString:
+			args = append(args, *state.String)
+		case KeyTypeHash:
+			for field, value := range state.Hash {
+				args = append(args, field, value)
+			}
+		case KeyTypeZSet:
+			for _, z := range state.ZSet {
+				args = append(args, z.Score, z.Member)
+			}
+		}
+
+		written, err := stateImportScript.Run(ctx, s.redisClient, []string{state.Key, ThrottleKey}, args...).Int64()
+		if err != nil {
+			return result, fmt.Errorf("key %s: %w", state.Key, err)
+		}
+		if written == 1 {
+			result.Imported++
+		} else {
+			result.Existing++
+		}
+	}
+	return result, nil
+}
+
+func (s *StateTransfer) validate(state KeyState) error {
+	owned := false
+	for _, prefix := range s.prefixes {
+		if prefix != "" && strings.HasPrefix(state.Key, keysUnder(prefix)) {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		return fmt.Errorf("%w: key %q is not under a configured prefix", ErrInvalidKeyState, state.Key)
+	}
+
+	var valid bool
+	switch state.Type {
+	case KeyTypeString:
+		valid = state.String != nil
+	case KeyTypeHash:
+		valid = len(state.Hash) > 0
+	case KeyTypeZSet:
+		valid = len(state.ZSet) > 0
+	}
+	if !valid {
+		return fmt.Errorf("%w: key %q has no %s value", ErrInvalidKeyState, state.Key, state.Type)
+	}
+	if state.TTLMs < 0 {
+		return fmt.Errorf("%w: key %q has a negative ttl", ErrInvalidKeyState, state.Key)
+	}
+	return nil
+}
+
+// keysUnder returns what the keys a strategy writes under prefix start
+// with: the prefix and the ':' every strategy puts before the client key.
+// Matching on the prefix alone would take in a strategy whose prefix merely
+// starts with it, e.g. "rl:tbx" for "rl:tb".
+func keysUnder(prefix string) string {
+	return prefix + ":"
+}
@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var transferPrefixes = map[string]string{
+	"token_bucket":       "rl:tb:",
+	"sliding_window_log": "rl:swl:",
+	"quota":              "rl:quota:",
+}
+
+func TestStateTransfer_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	source, _ := newScriptRedis(t)
+	require.NoError(t, source.HSet(ctx, "rl:tb::alice", "tokens", "3.5", "last_refill_time", "1000000000500").Err())
+	require.NoError(t, source.Expire(ctx, "rl:tb::alice", time.Minute).Err())
+	require.NoError(t, source.ZAdd(ctx, "rl:swl::bob",
+		redis.Z{Score: 1000000000500, Member: "a"},
+		redis.Z{Score: 1000000001500, Member: "b"}).Err())
+	require.NoError(t, source.Set(ctx, "rl:quota::carol", "42", 0).Err())
+	require.NoError(t, source.SAdd(ctx, "rl:tb::odd", "x").Err())
+	require.NoError(t, source.Set(ctx, "unrelated", "1", 0).Err())
+	require.NoError(t, source.Set(ctx, "rl:tb:x:dave", "1", 0).Err())
+
+	export, err := NewStateTransfer(source, transferPrefixes, 10).Export(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, export.Keys, 3)
+	assert.Equal(t, int64(1), export.Skipped)
+
+	// The export travels as JSON between deployments.
+	encoded, err := json.Marshal(export)
+	require.NoError(t, err)
+	var decoded StateExport
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+
+	target, _ := newScriptRedis(t)
+	result, err := NewStateTransfer(target, transferPrefixes, 10).Import(ctx, decoded.Keys, ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Imported: 3}, result)
+
+	hash, err := target.HGetAll(ctx, "rl:tb::alice").Result()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tokens": "3.5", "last_refill_time": "1000000000500"}, hash)
+	ttl, err := target.PTTL(ctx, "rl:tb::alice").Result()
+	require.NoError(t, err)
+	assert.InDelta(t, float64(time.Minute), float64(ttl), float64(time.Second))
+
+	members, err := target.ZRangeWithScores(ctx, "rl:swl::bob", 0, -1).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []redis.Z{
+		{Score: 1000000000500, Member: "a"},
+		{Score: 1000000001500, Member: "b"},
+	}, members)
+
+	value, err := target.Get(ctx, "rl:quota::carol").Result()
+	require.NoError(t, err)
+	assert.Equal(t, "42", value)
+	ttl, err = target.PTTL(ctx, "rl:quota::carol").Result()
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+}
+
+func TestStateTransfer_ExportOnePrefix(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newScriptRedis(t)
+	require.NoError(t, client.Set(ctx, "rl:quota::carol", "42", 0).Err())
+	require.NoError(t, client.HSet(ctx, "rl:tb::alice", "tokens", "1").Err())
+	transfer := NewStateTransfer(client, transferPrefixes, 10)
+
+	export, err := transfer.Export(ctx, "quota")
+	require.NoError(t, err)
+	require.Len(t, export.Keys, 1)
+	assert.Equal(t, "rl:quota::carol", export.Keys[0].Key)
+	assert.Equal(t, map[string]string{"quota": "rl:quota:"}, export.Prefixes)
+
+	_, err = transfer.Export(ctx, "nope")
+	assert.ErrorIs(t, err, ErrUnknownKeyPrefix)
+}
+
+func TestStateTransfer_ImportKeepsExistingKeys(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newScriptRedis(t)
+	require.NoError(t, client.Set(ctx, "rl:quota::carol", "7", 0).Err())
+	transfer := NewStateTransfer(client, transferPrefixes, 10)
+	imported := "42"
+	keys := []KeyState{{Key: "rl:quota::carol", Type: KeyTypeString, String: &imported}}
+
+	result, err := transfer.Import(ctx, keys, ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Existing: 1}, result)
+	assert.Equal(t, "7", client.Get(ctx, "rl:quota::carol").Val())
+
+	result, err = transfer.Import(ctx, keys, ImportOptions{Overwrite: true})
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Imported: 1}, result)
+	assert.Equal(t, "42", client.Get(ctx, "rl:quota::carol").Val())
+}
+
+func TestStateTransfer_ImportRejectsInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newScriptRedis(t)
+	transfer := NewStateTransfer(client, transferPrefixes, 10)
+	value := "1"
+
+	for name, keys := range map[string][]KeyState{
+		"outside the prefixes": {{Key: "rl:tb::alice", Type: KeyTypeString, String: &value}, {Key: "session:alice", Type: KeyTypeString, String: &value}},
+		"past the prefix":      {{Key: "rl:tb:x:alice", Type: KeyTypeString, String: &value}},
+		"missing value":        {{Key: "rl:tb::alice", Type: KeyTypeHash}},
+		"unknown type":         {{Key: "rl:tb::alice", Type: "list", String: &value}},
+		"negative ttl":         {{Key: "rl:tb::alice", Type: KeyTypeString, String: &value, TTLMs: -1}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := transfer.Import(ctx, keys, ImportOptions{})
+			assert.ErrorIs(t, err, ErrInvalidKeyState)
+		})
+	}
+
+	exists, err := client.Exists(ctx, "rl:tb::alice").Result()
+	require.NoError(t, err)
+	assert.Zero(t, exists, "nothing is written when any key is invalid")
+}
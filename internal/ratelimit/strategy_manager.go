@@ -1,76 +1,377 @@
 package ratelimit
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 
 	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/pmujumdar27/go-rate-limiter/internal/events"
 	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
 )
 
+// ErrStrategySwitchNotSupported is returned when the limiter chain holds
+// strategy-specific copies, such as for geoip rules or regions, that a switch
+// would leave behind.
+var ErrStrategySwitchNotSupported = errors.New("strategy cannot be switched at runtime with geoip rules or regions enabled")
+
 type StrategyManager interface {
 	GetCurrentStrategy() (RateLimiter, error)
 
+	// GetScaledStrategy builds the current strategy with its limits multiplied
+	// by multiplier and its keys stored under keySuffix.
+	GetScaledStrategy(policy string, multiplier float64, keySuffix string) (RateLimiter, error)
+
+	// GetStrategy builds any configured strategy with overrides applied.
+	GetStrategy(policy string, strategy string, overrides StrategyOverrides) (RateLimiter, error)
+
+	// GetShadowStrategy builds a configured strategy to run next to the
+	// enforced one without metrics of its own.
+	GetShadowStrategy(strategy string) (RateLimiter, error)
+
 	UpdateStrategy(strategy string, config map[string]interface{}) error
 
+	// CurrentStrategy names the strategy GetCurrentStrategy builds.
+	CurrentStrategy() string
+
 	GetAvailableStrategies() []string
 }
 
+// StrategyOverrides replaces parts of a strategy's configured limits. Zero
+// values keep the configured setting.
+type StrategyOverrides struct {
+	Limit     int64
+	Window    time.Duration
+	KeySuffix string
+}
+
 type ConfigBasedStrategyManager struct {
 	config      *config.RateLimiterConfig
 	redisClient *redis.Client
 	factory     *Factory
+
+	mu       sync.RWMutex
+	strategy string
 }
 
-func NewConfigBasedStrategyManager(cfg *config.RateLimiterConfig, redisClient *redis.Client) *ConfigBasedStrategyManager {
-	factory := NewFactory(redisClient).WithMetrics(metrics.NewPrometheusCollector())
+func NewConfigBasedStrategyManager(cfg *config.RateLimiterConfig, redisClient *redis.Client, collectors *metrics.Registry) *ConfigBasedStrategyManager {
+	factory := NewFactory(redisClient).WithCollectorRegistry(collectors)
 	return &ConfigBasedStrategyManager{
 		config:      cfg,
 		redisClient: redisClient,
 		factory:     factory,
+		strategy:    cfg.Strategy,
 	}
 }
 
+// WithDecisionStream emits every decision of the strategies built afterwards
+// to decisions.
+func (m *ConfigBasedStrategyManager) WithDecisionStream(decisions events.Emitter) *ConfigBasedStrategyManager {
+	m.factory.WithDecisionStream(decisions)
+	return m
+}
+
+// WithTopKeys makes the strategies built afterwards feed the top keys report.
+func (m *ConfigBasedStrategyManager) WithTopKeys(topKeys *TopKeys) *ConfigBasedStrategyManager {
+	m.factory.WithTopKeys(topKeys)
+	return m
+}
+
+// WithPostgres builds the strategies from the Postgres backend instead of
+// Redis.
+func (m *ConfigBasedStrategyManager) WithPostgres(store *PostgresStore) *ConfigBasedStrategyManager {
+	m.factory.WithPostgres(store)
+	return m
+}
+
+// WithKeyStats makes the strategies built afterwards report KeyStats over
+// window where they support it.
+func (m *ConfigBasedStrategyManager) WithKeyStats(window time.Duration) *ConfigBasedStrategyManager {
+	m.factory.WithKeyStats(window)
+	return m
+}
+
+// WithReadClient makes the strategies built afterwards peek through client,
+// typically a replica.
+func (m *ConfigBasedStrategyManager) WithReadClient(client *redis.Client) *ConfigBasedStrategyManager {
+	m.factory.WithReadClient(client)
+	return m
+}
+
+// WithBackgroundContext stops the background work of the strategies built
+// afterwards when ctx is done.
+func (m *ConfigBasedStrategyManager) WithBackgroundContext(ctx context.Context) *ConfigBasedStrategyManager {
+	m.factory.WithBackgroundContext(ctx)
+	return m
+}
+
+// WithClock makes the limiters of strategy built afterwards decide by clock.
+func (m *ConfigBasedStrategyManager) WithClock(strategy string, clock Clock) *ConfigBasedStrategyManager {
+	m.factory.WithClock(strategy, clock)
+	return m
+}
+
 func (m *ConfigBasedStrategyManager) GetCurrentStrategy() (RateLimiter, error) {
-	strategy := m.config.Strategy
+	return m.GetCurrentStrategyForPolicy(DefaultPolicyName)
+}
+
+// GetCurrentStrategyForPolicy builds the configured strategy with its metrics
+// routed to the collector assigned to policy.
+func (m *ConfigBasedStrategyManager) GetCurrentStrategyForPolicy(policy string) (RateLimiter, error) {
+	strategyConfig, err := m.currentStrategyConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.factory.CreatePolicyRateLimiter(policy, m.CurrentStrategy(), strategyConfig)
+}
 
-	var strategyConfig map[string]interface{}
-	var err error
+func (m *ConfigBasedStrategyManager) GetScaledStrategy(policy string, multiplier float64, keySuffix string) (RateLimiter, error) {
+	strategyConfig, err := m.currentStrategyConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	scaled, err := ScaleLimits(strategyConfig, multiplier, keySuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scale config for strategy %s: %w", m.CurrentStrategy(), err)
+	}
+
+	return m.factory.CreatePolicyRateLimiter(policy, m.CurrentStrategy(), scaled)
+}
+
+func (m *ConfigBasedStrategyManager) GetStrategy(policy string, strategy string, overrides StrategyOverrides) (RateLimiter, error) {
+	strategyConfig, err := m.strategyConfig(strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	strategyConfig, err = ApplyOverrides(strategyConfig, overrides)
+	if err != nil {
+		return nil, fmt.Errorf("failed to override config for strategy %s: %w", strategy, err)
+	}
+
+	return m.factory.CreatePolicyRateLimiter(policy, strategy, strategyConfig)
+}
+
+func (m *ConfigBasedStrategyManager) GetShadowStrategy(strategy string) (RateLimiter, error) {
+	strategyConfig, err := m.strategyConfig(strategy)
+	if err != nil {
+		return nil, err
+	}
+	return m.factory.CreateShadowRateLimiter(strategy, strategyConfig)
+}
+
+func (m *ConfigBasedStrategyManager) currentStrategyConfig() (map[string]interface{}, error) {
+	return m.strategyConfig(m.CurrentStrategy())
+}
 
+func (m *ConfigBasedStrategyManager) strategyConfig(strategy string) (map[string]interface{}, error) {
 	constructor, exists := m.factory.strategies[strategy]
 	if !exists {
 		return nil, fmt.Errorf("unknown strategy: %s", strategy)
 	}
 
-	switch strategy {
-	case "token_bucket":
-		strategyConfig, err = constructor.ConvertConfig(m.config.Strategies.TokenBucket)
-	case "sliding_window_log":
-		strategyConfig, err = constructor.ConvertConfig(m.config.Strategies.SlidingWindowLog)
-	case "sliding_window_counter":
-		strategyConfig, err = constructor.ConvertConfig(m.config.Strategies.SlidingWindowCounter)
-	default:
-		return nil, fmt.Errorf("unknown strategy: %s", strategy)
+	rawConfig, err := m.rawStrategyConfig(strategy)
+	if err != nil {
+		return nil, err
 	}
 
+	strategyConfig, err := constructor.ConvertConfig(rawConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert config for strategy %s: %w", strategy, err)
 	}
-
-	return m.factory.CreateRateLimiter(strategy, strategyConfig)
+	return strategyConfig, nil
 }
 
+// UpdateStrategy makes strategy, with its limits from the configuration file,
+// the one built by GetCurrentStrategy. Limiters built earlier are unchanged,
+// so callers swap them in themselves. The switch is not persisted.
 func (m *ConfigBasedStrategyManager) UpdateStrategy(strategy string, config map[string]interface{}) error {
-	// TODO: Implement for admin API
-	// This would involve:
-	// 1. Validating the new strategy and config
-	// 2. Updating the configuration (possibly persisting to file/database)
-	// 3. Notifying the service to use the new strategy
-	return fmt.Errorf("strategy updates not yet implemented - use configuration files")
+	if len(config) > 0 {
+		return fmt.Errorf("strategy limits can only be changed in the configuration file")
+	}
+	if _, err := m.strategyConfig(strategy); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.strategy = strategy
+	m.mu.Unlock()
+	return nil
+}
+
+// CurrentStrategy returns the name of the strategy GetCurrentStrategy builds.
+func (m *ConfigBasedStrategyManager) CurrentStrategy() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.strategy
 }
 
 func (m *ConfigBasedStrategyManager) GetAvailableStrategies() []string {
 	return m.factory.GetAvailableStrategies()
 }
 
+// ProbeStrategies runs ProbeStrategy on every available strategy and
+// returns all their failures. Each is built without metrics, decisions or
+// top keys, and with ProbeKey appended to its key prefix, so the probe
+// never touches the state of real clients or the buckets they share, such
+// as the global and organization buckets. Every key under that prefix is
+// deleted afterwards. Strategies without a key prefix, such as plugins that
+// don't take one, can't be kept apart from real traffic and are skipped.
+func (m *ConfigBasedStrategyManager) ProbeStrategies(ctx context.Context) error {
+	strategies := m.GetAvailableStrategies()
+	sort.Strings(strategies)
+
+	var errs []error
+	for _, strategy := range strategies {
+		if err := m.probeStrategy(ctx, strategy); err != nil {
+			errs = append(errs, fmt.Errorf("strategy %s: %w", strategy, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *ConfigBasedStrategyManager) probeStrategy(ctx context.Context, strategy string) error {
+	strategyConfig, err := m.strategyConfig(strategy)
+	if err != nil {
+		return err
+	}
+	if _, ok := strategyConfig["key_prefix"]; !ok {
+		return nil
+	}
+
+	strategyConfig, err = ApplyOverrides(strategyConfig, StrategyOverrides{KeySuffix: ProbeKey})
+	if err != nil {
+		return err
+	}
+	rateLimiter, err := m.factory.CreateShadowRateLimiter(strategy, strategyConfig)
+	if err != nil {
+		return err
+	}
+
+	err = ProbeStrategy(ctx, rateLimiter)
+	if m.redisClient != nil {
+		probePrefix, _ := getStringConfig(strategyConfig, "key_prefix")
+		if _, cleanupErr := deleteMatching(ctx, m.redisClient, prefixPattern(probePrefix, "")); cleanupErr != nil {
+			err = errors.Join(err, fmt.Errorf("clean up: %w", cleanupErr))
+		}
+	}
+	return err
+}
+
+// CurrentKeyPrefix returns the Redis key prefix configured for the current strategy.
+func (m *ConfigBasedStrategyManager) CurrentKeyPrefix() (string, error) {
+	return m.keyPrefix(m.CurrentStrategy())
+}
+
+// KeyPrefixes returns the Redis key prefix configured for every strategy,
+// keyed by strategy name.
+func (m *ConfigBasedStrategyManager) KeyPrefixes() map[string]string {
+	prefixes := make(map[string]string)
+	for _, strategy := range m.factory.GetAvailableStrategies() {
+		if prefix, err := m.keyPrefix(strategy); err == nil {
+			prefixes[strategy] = prefix
+		}
+	}
+	return prefixes
+}
+
+func (m *ConfigBasedStrategyManager) keyPrefix(strategy string) (string, error) {
+	switch strategy {
+	case "token_bucket":
+		return m.config.Strategies.TokenBucket.KeyPrefix, nil
+	case "sliding_window_log":
+		return m.config.Strategies.SlidingWindowLog.KeyPrefix, nil
+	case "sliding_window_counter":
+		return m.config.Strategies.SlidingWindowCounter.KeyPrefix, nil
+	case "quota":
+		return m.config.Strategies.Quota.KeyPrefix, nil
+	case "hierarchical":
+		return m.config.Strategies.Hierarchical.KeyPrefix, nil
+	case "multi_window":
+		return m.config.Strategies.MultiWindow.KeyPrefix, nil
+	case "fixed_window":
+		return m.config.Strategies.FixedWindow.KeyPrefix, nil
+	default:
+		if keyPrefix, ok := m.config.Strategies.Custom[strategy]["key_prefix"].(string); ok {
+			return keyPrefix, nil
+		}
+		return "", fmt.Errorf("unknown strategy: %s", strategy)
+	}
+}
+
+func (m *ConfigBasedStrategyManager) rawStrategyConfig(strategy string) (interface{}, error) {
+	switch strategy {
+	case "token_bucket":
+		return m.config.Strategies.TokenBucket, nil
+	case "sliding_window_log":
+		return m.config.Strategies.SlidingWindowLog, nil
+	case "sliding_window_counter":
+		return m.config.Strategies.SlidingWindowCounter, nil
+	case "quota":
+		return m.config.Strategies.Quota, nil
+	case "hierarchical":
+		return m.config.Strategies.Hierarchical, nil
+	case "multi_window":
+		return m.config.Strategies.MultiWindow, nil
+	case "fixed_window":
+		return m.config.Strategies.FixedWindow, nil
+	default:
+		if _, registered := m.factory.strategies[strategy]; registered {
+			return m.config.Strategies.Custom[strategy], nil
+		}
+		return nil, fmt.Errorf("unknown strategy: %s", strategy)
+	}
+}
+
+// ApplyOverrides returns a copy of a converted strategy config with overrides
+// applied. A window on a token bucket sets the refill rate so that limit
+// tokens are restored over the window, fractions of a token per second
+// included.
+func ApplyOverrides(strategyConfig map[string]interface{}, overrides StrategyOverrides) (map[string]interface{}, error) {
+	if overrides.Limit < 0 || overrides.Window < 0 {
+		return nil, fmt.Errorf("limit and window must not be negative")
+	}
+
+	result := make(map[string]interface{}, len(strategyConfig))
+	for name, value := range strategyConfig {
+		result[name] = value
+	}
+
+	if overrides.Limit > 0 {
+		for _, name := range []string{"bucket_size", "limit"} {
+			if _, exists := result[name]; exists {
+				result[name] = overrides.Limit
+			}
+		}
+	}
+
+	if overrides.Window > 0 {
+		if _, exists := result["window_size"]; exists {
+			result["window_size"] = overrides.Window
+		}
+		if _, exists := result["refill_rate_per_second"]; exists {
+			limit, err := getInt64Config(result, "bucket_size")
+			if err != nil {
+				return nil, err
+			}
+			result["refill_rate_per_second"] = float64(limit) / overrides.Window.Seconds()
+		}
+	}
+
+	if overrides.KeySuffix != "" {
+		prefix, err := getStringConfig(result, "key_prefix")
+		if err != nil {
+			return nil, err
+		}
+		result["key_prefix"] = prefix + overrides.KeySuffix
+	}
+
+	return result, nil
+}
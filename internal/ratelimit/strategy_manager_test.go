@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyOverrides(t *testing.T) {
+	tokenBucket := map[string]interface{}{
+		"key_prefix":             "rl:tb:",
+		"bucket_size":            int64(100),
+		"refill_rate_per_second": int64(10),
+	}
+
+	result, err := ApplyOverrides(tokenBucket, StrategyOverrides{Limit: 60, Window: time.Minute, KeySuffix: "rule:writes"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), result["bucket_size"])
+	assert.Equal(t, float64(1), result["refill_rate_per_second"], "60 tokens restored over a minute")
+	assert.Equal(t, "rl:tb:rule:writes", result["key_prefix"])
+	assert.Equal(t, int64(100), tokenBucket["bucket_size"], "the original config is untouched")
+
+	result, err = ApplyOverrides(tokenBucket, StrategyOverrides{Limit: 5, Window: time.Minute})
+	require.NoError(t, err)
+	assert.InDelta(t, 5.0/60, result["refill_rate_per_second"], 1e-9, "slow refills aren't rounded up to a token a second")
+	client, _ := newScriptRedis(t)
+	limiter, err := (&TokenBucketConstructor{}).NewFromConfig(result, client)
+	require.NoError(t, err)
+	assert.InDelta(t, 5.0/60, limiter.(*TokenBucketRateLimiter).refillRatePerSecond, 1e-9)
+
+	window := map[string]interface{}{
+		"key_prefix":  "rl:swc:",
+		"bucket_size": int64(100),
+		"window_size": time.Hour,
+	}
+	result, err = ApplyOverrides(window, StrategyOverrides{Window: 10 * time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), result["bucket_size"])
+	assert.Equal(t, 10*time.Second, result["window_size"])
+
+	quota := map[string]interface{}{"key_prefix": "rl:quota:", "limit": int64(1000)}
+	result, err = ApplyOverrides(quota, StrategyOverrides{Limit: 5})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), result["limit"])
+
+	_, err = ApplyOverrides(quota, StrategyOverrides{Limit: -1})
+	assert.Error(t, err)
+}
+
+func TestConfigBasedStrategyManager_UpdateStrategy(t *testing.T) {
+	client, server := newScriptRedis(t)
+	manager := NewConfigBasedStrategyManager(&config.RateLimiterConfig{
+		Strategy: "token_bucket",
+		Strategies: config.RateLimiterStrategiesConfig{
+			TokenBucket:      config.TokenBucketConfig{KeyPrefix: "tb", TTLBufferSeconds: 60, BucketSize: 10, RefillRatePerSecond: 1},
+			SlidingWindowLog: config.SlidingWindowLogConfig{KeyPrefix: "swl", TTLBufferSeconds: 60, WindowSizeSeconds: 60, BucketSize: 10},
+		},
+	}, client, metrics.NewRegistry("default", metrics.NewNoopCollector()))
+
+	assert.Error(t, manager.UpdateStrategy("leaky_bucket", nil))
+	assert.Error(t, manager.UpdateStrategy("sliding_window_log", map[string]interface{}{"bucket_size": 5}))
+	assert.Equal(t, "token_bucket", manager.CurrentStrategy())
+
+	require.NoError(t, manager.UpdateStrategy("sliding_window_log", nil))
+	assert.Equal(t, "sliding_window_log", manager.CurrentStrategy())
+
+	keyPrefix, err := manager.CurrentKeyPrefix()
+	require.NoError(t, err)
+	assert.Equal(t, "swl", keyPrefix)
+
+	rateLimiter, err := manager.GetCurrentStrategy()
+	require.NoError(t, err)
+	_, err = rateLimiter.IsAllowed(context.Background(), "client", time.Unix(0, scriptNow))
+	require.NoError(t, err)
+	assert.True(t, server.Exists("swl:client"))
+}
+
+func TestConfigBasedStrategyManager_ProbeLeavesRealKeysAlone(t *testing.T) {
+	ctx := context.Background()
+	client, server := newScriptRedis(t)
+	topKeys, err := NewTopKeys(client, TopKeysConfig{})
+	require.NoError(t, err)
+	manager := NewConfigBasedStrategyManager(&config.RateLimiterConfig{
+		Strategy: "token_bucket",
+		Strategies: config.RateLimiterStrategiesConfig{
+			TokenBucket: config.TokenBucketConfig{
+				KeyPrefix: "tb", TTLBufferSeconds: 60, BucketSize: 10, RefillRatePerSecond: 1,
+				Global: config.GlobalBucketConfig{BucketSize: 100, RefillRatePerSecond: 10},
+			},
+		},
+	}, client, metrics.NewRegistry("default", metrics.NewNoopCollector())).WithTopKeys(topKeys)
+
+	server.HSet("tb:"+GlobalBucketKey, "tokens", "42")
+	server.HSet("tb:"+ProbeKey, "tokens", "7")
+
+	require.NoError(t, manager.probeStrategy(ctx, "token_bucket"))
+	assert.Equal(t, []string{"tb:" + GlobalBucketKey, "tb:" + ProbeKey}, server.Keys(), "the probe's own keys are deleted, shared buckets included")
+	assert.Equal(t, "42", server.HGet("tb:"+GlobalBucketKey, "tokens"), "the real global bucket isn't charged")
+	assert.Equal(t, "7", server.HGet("tb:"+ProbeKey, "tokens"), "a real client called like the probe key isn't reset")
+}
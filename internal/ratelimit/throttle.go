@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ThrottleKey holds the fleet-wide limit multiplier. Every script receives it
+// as its last key and scales its configured limit by the stored value.
+const ThrottleKey = "rl:throttle"
+
+var ErrInvalidThrottleMultiplier = errors.New("throttle multiplier must be greater than 0 and at most 1")
+
+// ThrottleState is the emergency brake currently in force.
+type ThrottleState struct {
+	Active     bool       `json:"active"`
+	Multiplier float64    `json:"multiplier"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// Throttle lets operators scale every limit fleet-wide during an incident.
+type Throttle struct {
+	redisClient *redis.Client
+}
+
+func NewThrottle(redisClient *redis.Client) *Throttle {
+	return &Throttle{redisClient: redisClient}
+}
+
+// Set applies multiplier to all limits. A positive duration lifts the brake
+// automatically once it elapses.
+func (t *Throttle) Set(ctx context.Context, multiplier float64, duration time.Duration) error {
+	if multiplier <= 0 || multiplier > 1 {
+		return ErrInvalidThrottleMultiplier
+	}
+	if duration < 0 {
+		duration = 0
+	}
+
+	value := strconv.FormatFloat(multiplier, 'f', -1, 64)
+	return t.redisClient.Set(ctx, ThrottleKey, value, duration).Err()
+}
+
+func (t *Throttle) Clear(ctx context.Context) error {
+	return t.redisClient.Del(ctx, ThrottleKey).Err()
+}
+
+func (t *Throttle) Get(ctx context.Context) (ThrottleState, error) {
+	value, err := t.redisClient.Get(ctx, ThrottleKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return ThrottleState{Multiplier: 1}, nil
+	}
+	if err != nil {
+		return ThrottleState{}, err
+	}
+
+	multiplier, err := strconv.ParseFloat(value, 64)
+	if err != nil || multiplier <= 0 || multiplier > 1 {
+		// The scripts ignore values they can't use, so report it as inactive.
+		return ThrottleState{Multiplier: 1}, nil
+	}
+
+	state := ThrottleState{Active: multiplier < 1, Multiplier: multiplier}
+
+	ttl, err := t.redisClient.TTL(ctx, ThrottleKey).Result()
+	if err != nil {
+		return ThrottleState{}, err
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		state.ExpiresAt = &expiresAt
+	}
+
+	return state, nil
+}
+
+// limitFromResult returns the throttled limit a script reported at index,
+// falling back to the configured limit.
+func limitFromResult(resultArray []interface{}, index int, configured int64) int64 {
+	if len(resultArray) <= index {
+		return configured
+	}
+	limit, err := getInt64FromResult(resultArray[index])
+	if err != nil || limit <= 0 {
+		return configured
+	}
+	return limit
+}
+
+func markThrottled(metadata *Metadata, limit int64, configured int64) {
+	if limit < configured {
+		metadata.Set("throttled", true)
+		metadata.SetInt("configured_limit", configured)
+		metadata.Set("throttle_note", fmt.Sprintf("limit lowered from %d to %d by operator throttle", configured, limit))
+	}
+}
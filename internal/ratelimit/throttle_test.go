@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottle_SetGetClear(t *testing.T) {
+	client, server := newScriptRedis(t)
+	throttle := NewThrottle(client)
+	ctx := context.Background()
+
+	state, err := throttle.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ThrottleState{Multiplier: 1}, state)
+
+	require.NoError(t, throttle.Set(ctx, 0.2, time.Minute))
+	state, err = throttle.Get(ctx)
+	require.NoError(t, err)
+	assert.True(t, state.Active)
+	assert.Equal(t, 0.2, state.Multiplier)
+	require.NotNil(t, state.ExpiresAt)
+	assert.Equal(t, time.Minute, server.TTL(ThrottleKey))
+
+	require.NoError(t, throttle.Clear(ctx))
+	state, err = throttle.Get(ctx)
+	require.NoError(t, err)
+	assert.False(t, state.Active)
+}
+
+func TestThrottle_SetRejectsInvalidMultiplier(t *testing.T) {
+	client, _ := newScriptRedis(t)
+	throttle := NewThrottle(client)
+
+	assert.ErrorIs(t, throttle.Set(context.Background(), 0, 0), ErrInvalidThrottleMultiplier)
+	assert.ErrorIs(t, throttle.Set(context.Background(), 1.1, 0), ErrInvalidThrottleMultiplier)
+}
+
+func TestLimitFromResult(t *testing.T) {
+	assert.Equal(t, int64(2), limitFromResult([]interface{}{int64(1), int64(2)}, 1, 10))
+	assert.Equal(t, int64(10), limitFromResult([]interface{}{int64(1)}, 1, 10), "older replies fall back to the configured limit")
+
+	var metadata Metadata
+	markThrottled(&metadata, 2, 10)
+	assert.Equal(t, true, metadata.Value("throttled"))
+	assert.Equal(t, int64(10), metadata.Value("configured_limit"))
+
+	metadata = Metadata{}
+	markThrottled(&metadata, 10, 10)
+	assert.Zero(t, metadata.Len())
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/pmujumdar27/go-rate-limiter/internal/config"
@@ -11,24 +12,71 @@ import (
 )
 
 type TokenBucketConfig struct {
-	BucketSize          int64
-	RefillRatePerSecond int64
-	KeyPrefix           string
-	TTLBufferSeconds    int
+	BucketSize          int64   `mapstructure:"bucket_size"`
+	RefillRatePerSecond float64 `mapstructure:"refill_rate_per_second"`
+	KeyPrefix           string  `mapstructure:"key_prefix"`
+	TTLBufferSeconds    int     `mapstructure:"ttl_buffer_seconds"`
+	// GlobalBucketSize enables a service-wide bucket shared by every key and
+	// charged atomically with the per-key bucket; 0 disables it.
+	GlobalBucketSize          int64   `mapstructure:"global_bucket_size"`
+	GlobalRefillRatePerSecond float64 `mapstructure:"global_refill_rate_per_second"`
+}
+
+func (c TokenBucketConfig) Validate() error {
+	if c.BucketSize <= 0 || c.RefillRatePerSecond <= 0 {
+		return errors.New("bucket_size and refill_rate_per_second must be positive")
+	}
+	if c.GlobalBucketSize < 0 || (c.GlobalBucketSize > 0 && c.GlobalRefillRatePerSecond <= 0) {
+		return errors.New("invalid global bucket configuration")
+	}
+	return nil
+}
+
+// TokenBucketOptions are the token bucket strategy's options: the bucket
+// plus the optional lease mode wrapped around it.
+type TokenBucketOptions struct {
+	TokenBucketConfig `mapstructure:",squash"`
+	// LeaseSize above 0 hands out tokens in leases of this size; see
+	// LeasedTokenBucketRateLimiter.
+	LeaseSize      int64 `mapstructure:"lease_size"`
+	LeaseTTLMillis int64 `mapstructure:"lease_ttl_ms"`
+}
+
+func (o TokenBucketOptions) Validate() error {
+	if err := o.TokenBucketConfig.Validate(); err != nil {
+		return err
+	}
+	if o.LeaseSize < 0 || o.LeaseTTLMillis < 0 {
+		return errors.New("lease_size and lease_ttl_ms must not be negative")
+	}
+	if o.LeaseSize > 0 && o.GlobalBucketSize > 0 {
+		return errors.New("lease mode can't be combined with a global bucket")
+	}
+	return nil
 }
 
 type TokenBucketRateLimiter struct {
-	bucketSize          int64
-	refillRatePerSecond int64
-	redisClient         *redis.Client
-	keyPrefix           string
-	ttlBuffer           int64
+	replicaReads
+	bucketSize                int64
+	refillRatePerSecond       float64
+	globalBucketSize          int64
+	globalRefillRatePerSecond float64
+	redisClient               *redis.Client
+	keyPrefix                 string
+	ttlBuffer                 int64
+	topKeys                   *TopKeys
+	keyStatsWindow            time.Duration
+	metadata                  Metadata
+	globalMetadata            Metadata
 }
 
 func NewTokenBucketRateLimiter(config TokenBucketConfig, redisClient *redis.Client) (*TokenBucketRateLimiter, error) {
-	if config.BucketSize <= 0 || config.RefillRatePerSecond <= 0 || redisClient == nil {
+	if redisClient == nil {
 		return nil, errors.New("invalid configuration")
 	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
 	ttlBufferSeconds := config.TTLBufferSeconds
 	if ttlBufferSeconds <= 0 {
@@ -36,77 +84,56 @@ func NewTokenBucketRateLimiter(config TokenBucketConfig, redisClient *redis.Clie
 	}
 
 	return &TokenBucketRateLimiter{
-		bucketSize:          config.BucketSize,
-		refillRatePerSecond: config.RefillRatePerSecond,
-		redisClient:         redisClient,
-		keyPrefix:           config.KeyPrefix,
-		ttlBuffer:           int64(ttlBufferSeconds),
+		bucketSize:                config.BucketSize,
+		refillRatePerSecond:       config.RefillRatePerSecond,
+		globalBucketSize:          config.GlobalBucketSize,
+		globalRefillRatePerSecond: config.GlobalRefillRatePerSecond,
+		redisClient:               redisClient,
+		keyPrefix:                 config.KeyPrefix,
+		ttlBuffer:                 int64(ttlBufferSeconds),
+		metadata: SharedMetadata(map[string]interface{}{
+			"bucket_size": config.BucketSize,
+			"refill_rate": config.RefillRatePerSecond,
+		}),
+		globalMetadata: SharedMetadata(map[string]interface{}{
+			"bucket_size":        config.BucketSize,
+			"refill_rate":        config.RefillRatePerSecond,
+			"global_bucket_size": config.GlobalBucketSize,
+		}),
 	}, nil
 }
 
+// bucketKey returns the Redis key of a client's bucket under keyPrefix.
+func bucketKey(keyPrefix, key string) string {
+	return fmt.Sprintf("%s:%s", keyPrefix, escapeReservedKey(key))
+}
+
+func globalBucketKey(keyPrefix string) string {
+	return fmt.Sprintf("%s:%s", keyPrefix, GlobalBucketKey)
+}
+
+// escapeReservedKey keeps client keys out of the shared buckets' names.
+// Escaped keys start with "___", which no shared bucket does, and other
+// keys don't start with "__", so distinct keys stay distinct.
+func escapeReservedKey(key string) string {
+	if strings.HasPrefix(key, ReservedKeyPrefix) {
+		return "_" + key
+	}
+	return key
+}
+
 func (tb *TokenBucketRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
-	redisKey := fmt.Sprintf("%s:%s", tb.keyPrefix, key)
+	if tb.globalBucketSize > 0 {
+		return tb.isAllowedWithGlobal(ctx, key, timestamp)
+	}
+
+	redisKey := bucketKey(tb.keyPrefix, key)
 
 	currentTimestampNanos := timestamp.UnixNano()
 
-	script := `
-		local key = KEYS[1]
-		local bucket_size = tonumber(ARGV[1])
-		local refill_rate = tonumber(ARGV[2])
-		local current_time_nanos = tonumber(ARGV[3])
-		local ttl_buffer_seconds = tonumber(ARGV[4])
-		
-		local bucket_data = redis.call('HMGET', key, 'tokens', 'last_refill_time_nanos')
-		local current_tokens = bucket_size
-		local last_refill_time_nanos = current_time_nanos
-		
-		if bucket_data[1] then
-			current_tokens = tonumber(bucket_data[1])
-		end
-		
-		if bucket_data[2] then
-			last_refill_time_nanos = tonumber(bucket_data[2])
-		end
-		
-		local time_since_last_refill_seconds = (current_time_nanos - last_refill_time_nanos) / 1000000000 -- NanosecondsPerSecond
-		
-		local tokens_to_refill = time_since_last_refill_seconds * refill_rate
-		
-		current_tokens = math.min(bucket_size, current_tokens + tokens_to_refill)
-		
-		if current_tokens < 1 then
-			local tokens_needed = 1 - current_tokens
-			local seconds_until_token = tokens_needed / refill_rate
-			local next_token_time_nanos = current_time_nanos + (seconds_until_token * 1000000000) -- NanosecondsPerSecond
-			
-			redis.call('HMSET', key, 
-				'tokens', current_tokens,
-				'last_refill_time_nanos', current_time_nanos)
-			
-			local ttl_seconds = math.max(60, bucket_size / refill_rate + ttl_buffer_seconds) -- MinimumTTLSeconds
-			redis.call('EXPIRE', key, ttl_seconds)
-			
-			return {0, current_tokens, next_token_time_nanos}
-		end
-		
-		local remaining_tokens = current_tokens - 1
-		
-		redis.call('HMSET', key, 
-			'tokens', remaining_tokens,
-			'last_refill_time_nanos', current_time_nanos)
-		
-		local ttl_seconds = math.max(60, bucket_size / refill_rate + ttl_buffer_seconds) -- MinimumTTLSeconds
-		redis.call('EXPIRE', key, ttl_seconds)
-		
-		local tokens_to_full = bucket_size - remaining_tokens
-		local seconds_to_full = tokens_to_full / refill_rate
-		local full_time_nanos = current_time_nanos + (seconds_to_full * 1000000000) -- NanosecondsPerSecond
-		
-		return {1, remaining_tokens, full_time_nanos}
-	`
-
-	result, err := tb.redisClient.Eval(ctx, script, []string{redisKey},
-		tb.bucketSize, tb.refillRatePerSecond, currentTimestampNanos, tb.ttlBuffer).Result()
+	keys, args := tb.topKeys.scriptKeys([]string{redisKey},
+		[]interface{}{tb.bucketSize, tb.refillRatePerSecond, currentTimestampNanos, tb.ttlBuffer, tb.keyStatsWindow.Milliseconds()}, key, timestamp)
+	result, err := tokenBucketScript.Run(ctx, tb.redisClient, keys, args...).Result()
 
 	if err != nil {
 		return RateLimitResponse{
@@ -138,32 +165,326 @@ func (tb *TokenBucketRateLimiter) IsAllowed(ctx context.Context, key string, tim
 		return RateLimitResponse{Err: err}, err
 	}
 
-	metadata := map[string]interface{}{
-		"bucket_size": tb.bucketSize,
-		"refill_rate": tb.refillRatePerSecond,
-	}
+	limit := limitFromResult(resultArray, 3, tb.bucketSize)
+	stats := keyStatsFromResult(resultArray, 4)
+	metadata := tb.metadata
+	markThrottled(&metadata, limit, tb.bucketSize)
 
 	if allowed == 1 {
 		remainingTokens := tokens
 		fullTime := time.Unix(0, timeNanos)
-		metadata["bucket_full_time"] = fullTime
+		metadata.SetTime("bucket_full_time", fullTime)
 
 		return RateLimitResponse{
 			Allowed:   true,
-			Limit:     tb.bucketSize,
+			Limit:     limit,
 			Remaining: remainingTokens,
 			ResetTime: fullTime,
 			Metadata:  metadata,
+			Stats:     stats,
 		}, nil
 	}
 
 	currentTokens := tokens
 	nextTokenTime := time.Unix(0, timeNanos)
 	retryAfter := nextTokenTime.Sub(timestamp)
-	metadata["current_tokens"] = currentTokens
-	metadata["next_token_time"] = nextTokenTime
+	metadata.SetInt("current_tokens", currentTokens)
+	metadata.SetTime("next_token_time", nextTokenTime)
 
 	return RateLimitResponse{
+		Allowed:    false,
+		Limit:      limit,
+		Remaining:  0,
+		ResetTime:  nextTokenTime,
+		RetryAfter: &retryAfter,
+		Metadata:   metadata,
+		Stats:      stats,
+	}, nil
+}
+
+// isAllowedWithGlobal charges the per-key and global buckets in one script
+// so concurrent callers can't overrun the global cap between two checks.
+func (tb *TokenBucketRateLimiter) isAllowedWithGlobal(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	redisKey := bucketKey(tb.keyPrefix, key)
+	globalKey := globalBucketKey(tb.keyPrefix)
+
+	currentTimestampNanos := timestamp.UnixNano()
+
+	keys, args := tb.topKeys.scriptKeys([]string{redisKey, globalKey}, []interface{}{
+		tb.bucketSize, tb.refillRatePerSecond, tb.globalBucketSize, tb.globalRefillRatePerSecond,
+		currentTimestampNanos, tb.ttlBuffer, tb.keyStatsWindow.Milliseconds(),
+	}, key, timestamp)
+	result, err := tokenBucketGlobalScript.Run(ctx, tb.redisClient, keys, args...).Result()
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) < 5 {
+		err = errors.New("invalid redis response from global token bucket script")
+		return RateLimitResponse{Err: err}, err
+	}
+
+	values := make([]int64, len(resultArray))
+	for i, field := range []string{"allowed flag", "tokens", "global tokens", "time", "limiting bucket"} {
+		values[i], err = getInt64FromResult(resultArray[i])
+		if err != nil {
+			err = fmt.Errorf("failed to parse %s: %w", field, err)
+			return RateLimitResponse{Err: err}, err
+		}
+	}
+	allowed, tokens, globalTokens, timeNanos, limitedBy := values[0], values[1], values[2], values[3], values[4]
+
+	limit := limitFromResult(resultArray, 5, tb.bucketSize)
+	stats := keyStatsFromResult(resultArray, 6)
+	metadata := tb.globalMetadata
+	metadata.SetInt("global_remaining", globalTokens)
+	markThrottled(&metadata, limit, tb.bucketSize)
+
+	if allowed == 1 {
+		fullTime := time.Unix(0, timeNanos)
+		metadata.SetTime("bucket_full_time", fullTime)
+
+		remaining := tokens
+		if globalTokens < remaining {
+			remaining = globalTokens
+		}
+
+		return RateLimitResponse{
+			Allowed:   true,
+			Limit:     limit,
+			Remaining: remaining,
+			ResetTime: fullTime,
+			Metadata:  metadata,
+			Stats:     stats,
+		}, nil
+	}
+
+	nextTokenTime := time.Unix(0, timeNanos)
+	retryAfter := nextTokenTime.Sub(timestamp)
+	metadata.SetInt("current_tokens", tokens)
+	metadata.SetTime("next_token_time", nextTokenTime)
+	metadata.Set("limited_by", "client")
+	if limitedBy == 2 {
+		metadata.Set("limited_by", "global")
+	}
+
+	return RateLimitResponse{
+		Allowed:    false,
+		Limit:      limit,
+		Remaining:  0,
+		ResetTime:  nextTokenTime,
+		RetryAfter: &retryAfter,
+		Metadata:   metadata,
+		Stats:      stats,
+	}, nil
+}
+
+func (tb *TokenBucketRateLimiter) setTopKeys(topKeys *TopKeys) {
+	tb.topKeys = topKeys
+}
+
+func (tb *TokenBucketRateLimiter) setKeyStats(window time.Duration) {
+	tb.keyStatsWindow = window
+}
+
+// SupportsBatch reports whether AllowN is available; batches skip the global
+// bucket, so it is disabled when one is configured.
+func (tb *TokenBucketRateLimiter) SupportsBatch() bool {
+	return tb.globalBucketSize == 0
+}
+
+// Peek reports the refilled token count for key without taking a token.
+func (tb *TokenBucketRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	redisKey := bucketKey(tb.keyPrefix, key)
+
+	currentTimestampNanos := timestamp.UnixNano()
+
+	result, err := tb.runRead(ctx, tokenBucketPeekScript, tb.redisClient, []string{redisKey, ThrottleKey},
+		tb.bucketSize, tb.refillRatePerSecond, currentTimestampNanos).Result()
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) < 2 {
+		err = errors.New("invalid redis response from token bucket peek script")
+		return RateLimitResponse{Err: err}, err
+	}
+
+	tokens, err := getInt64FromResult(resultArray[0])
+	if err != nil {
+		err = fmt.Errorf("failed to parse tokens: %w", err)
+		return RateLimitResponse{Err: err}, err
+	}
+
+	fullTimeNanos, err := getInt64FromResult(resultArray[1])
+	if err != nil {
+		err = fmt.Errorf("failed to parse time: %w", err)
+		return RateLimitResponse{Err: err}, err
+	}
+
+	fullTime := time.Unix(0, fullTimeNanos)
+	limit := limitFromResult(resultArray, 2, tb.bucketSize)
+	metadata := tb.metadata
+	metadata.SetInt("current_tokens", tokens)
+	metadata.SetTime("bucket_full_time", fullTime)
+	markThrottled(&metadata, limit, tb.bucketSize)
+
+	return RateLimitResponse{
+		Allowed:   tokens >= 1,
+		Limit:     limit,
+		Remaining: max(tokens, 0),
+		ResetTime: fullTime,
+		Metadata:  metadata,
+	}, nil
+}
+
+// AddDebt takes n tokens from the key's bucket even if that leaves it
+// negative. The global bucket is not charged.
+func (tb *TokenBucketRateLimiter) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	if n <= 0 {
+		return nil
+	}
+
+	redisKey := bucketKey(tb.keyPrefix, key)
+
+	return tokenBucketDebtScript.Run(ctx, tb.redisClient, []string{redisKey, ThrottleKey},
+		tb.bucketSize, tb.refillRatePerSecond, n, timestamp.UnixNano(), tb.ttlBuffer).Err()
+}
+
+// ReserveN takes n tokens now, letting the bucket go into debt, and reports
+// how long until the debt is repaid. The global bucket can't be reserved
+// against, so it is unsupported when one is configured.
+func (tb *TokenBucketRateLimiter) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error) {
+	if tb.globalBucketSize > 0 {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: ErrReserveNotSupported}}, ErrReserveNotSupported
+	}
+	if n <= 0 {
+		err := fmt.Errorf("reservation size must be positive, got %d", n)
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: err}}, err
+	}
+
+	redisKey := bucketKey(tb.keyPrefix, key)
+
+	keys, args := tb.topKeys.scriptKeys([]string{redisKey},
+		[]interface{}{tb.bucketSize, tb.refillRatePerSecond, n, timestamp.UnixNano(), maxDelay.Nanoseconds(), tb.ttlBuffer}, key, timestamp)
+	result, err := tokenBucketReserveScript.Run(ctx, tb.redisClient, keys, args...).Result()
+	if err != nil {
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: err}}, err
+	}
+
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) < 4 {
+		err = errors.New("invalid redis response from token bucket reserve script")
+		return Reservation{RateLimitResponse: RateLimitResponse{Err: err}}, err
+	}
+
+	values := make([]int64, 4)
+	for i, field := range []string{"reserved flag", "tokens", "delay", "time"} {
+		values[i], err = getInt64FromResult(resultArray[i])
+		if err != nil {
+			err = fmt.Errorf("failed to parse %s: %w", field, err)
+			return Reservation{RateLimitResponse: RateLimitResponse{Err: err}}, err
+		}
+	}
+	reserved, tokens, delayNanos, fullTimeNanos := values[0], values[1], values[2], values[3]
+
+	limit := limitFromResult(resultArray, 4, tb.bucketSize)
+	metadata := tb.metadata
+	metadata.SetInt("current_tokens", tokens)
+	metadata.SetInt("reserved", n)
+	markThrottled(&metadata, limit, tb.bucketSize)
+
+	response := RateLimitResponse{
+		Allowed:   reserved == 1,
+		Limit:     limit,
+		Remaining: max(tokens, 0),
+		ResetTime: time.Unix(0, fullTimeNanos),
+		Metadata:  metadata,
+	}
+	if reserved == 1 {
+		return Reservation{RateLimitResponse: response, Delay: time.Duration(delayNanos)}, nil
+	}
+
+	if delayNanos >= 0 {
+		retryAfter := time.Duration(delayNanos) - maxDelay
+		response.RetryAfter = &retryAfter
+	} else {
+		response.Metadata.Set("exceeds_bucket_size", true)
+	}
+	return Reservation{RateLimitResponse: response}, nil
+}
+
+// SupportsReserve reports whether ReserveN can be served; see ReserveN.
+func (tb *TokenBucketRateLimiter) SupportsReserve() bool {
+	return tb.globalBucketSize == 0
+}
+
+// acquireTokens takes up to n whole tokens from the bucket in one call. It
+// returns how many were granted, the whole tokens left and, when none were
+// granted, when the next token is due.
+func (tb *TokenBucketRateLimiter) acquireTokens(ctx context.Context, key string, n int64, timestamp time.Time) (int64, int64, time.Time, error) {
+	redisKey := bucketKey(tb.keyPrefix, key)
+
+	currentTimestampNanos := timestamp.UnixNano()
+
+	keys, args := tb.topKeys.scriptKeys([]string{redisKey},
+		[]interface{}{tb.bucketSize, tb.refillRatePerSecond, currentTimestampNanos, tb.ttlBuffer, n}, key, timestamp)
+	result, err := tokenBucketAcquireScript.Run(ctx, tb.redisClient, keys, args...).Result()
+	if err != nil {
+		return 0, 0, time.Time{}, err
+	}
+
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) < 3 {
+		return 0, 0, time.Time{}, errors.New("invalid redis response from token acquire script")
+	}
+
+	granted, err := getInt64FromResult(resultArray[0])
+	if err != nil {
+		return 0, 0, time.Time{}, fmt.Errorf("failed to parse granted tokens: %w", err)
+	}
+
+	nextTokenNanos, err := getInt64FromResult(resultArray[1])
+	if err != nil {
+		return 0, 0, time.Time{}, fmt.Errorf("failed to parse time: %w", err)
+	}
+
+	remaining, err := getInt64FromResult(resultArray[2])
+	if err != nil {
+		return 0, 0, time.Time{}, fmt.Errorf("failed to parse tokens: %w", err)
+	}
+
+	return granted, remaining, time.Unix(0, nextTokenNanos), nil
+}
+
+// AllowN decides n requests for key with a single Redis call, granting as
+// many as there are whole tokens.
+func (tb *TokenBucketRateLimiter) AllowN(ctx context.Context, key string, n int64, timestamp time.Time) (int64, RateLimitResponse, error) {
+	granted, remaining, nextTokenTime, err := tb.acquireTokens(ctx, key, n, timestamp)
+	if err != nil {
+		return 0, RateLimitResponse{Err: err}, err
+	}
+
+	metadata := tb.metadata
+	metadata.SetInt("batch_size", n)
+	metadata.SetInt("granted", granted)
+
+	if granted > 0 {
+		secondsToFull := float64(tb.bucketSize-remaining) / float64(tb.refillRatePerSecond)
+		fullTime := timestamp.Add(time.Duration(secondsToFull * float64(time.Second)))
+		return granted, RateLimitResponse{
+			Allowed:   true,
+			Limit:     tb.bucketSize,
+			Remaining: remaining,
+			ResetTime: fullTime,
+			Metadata:  metadata,
+		}, nil
+	}
+
+	retryAfter := nextTokenTime.Sub(timestamp)
+	return 0, RateLimitResponse{
 		Allowed:    false,
 		Limit:      tb.bucketSize,
 		Remaining:  0,
@@ -174,7 +495,7 @@ func (tb *TokenBucketRateLimiter) IsAllowed(ctx context.Context, key string, tim
 }
 
 func (tb *TokenBucketRateLimiter) Reset(ctx context.Context, key string) error {
-	redisKey := fmt.Sprintf("%s:%s", tb.keyPrefix, key)
+	redisKey := bucketKey(tb.keyPrefix, key)
 
 	_, err := tb.redisClient.Del(ctx, redisKey).Result()
 	if err != nil {
@@ -184,6 +505,34 @@ func (tb *TokenBucketRateLimiter) Reset(ctx context.Context, key string) error {
 	return nil
 }
 
+// ResetPrefix deletes the bucket of every key starting with prefix. The
+// global bucket is kept.
+func (tb *TokenBucketRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPrefix
+	}
+	globalKey := globalBucketKey(tb.keyPrefix)
+	return deleteMatching(ctx, tb.redisClient, prefixPattern(tb.keyPrefix, escapeReservedKey(prefix)), globalKey)
+}
+
+// Refund returns n tokens to the key's bucket and, when enabled, the global
+// bucket, up to their size. Buckets created after timestamp, because the
+// one charged expired or was reset, are left as they are.
+func (tb *TokenBucketRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	if n <= 0 {
+		return nil
+	}
+
+	keys := []string{bucketKey(tb.keyPrefix, key)}
+	args := []interface{}{n, timestamp.UnixNano(), tb.bucketSize}
+	if tb.globalBucketSize > 0 {
+		keys = append(keys, globalBucketKey(tb.keyPrefix))
+		args = append(args, tb.globalBucketSize)
+	}
+
+	return tokenBucketRefundScript.Run(ctx, tb.redisClient, append(keys, ThrottleKey), args...).Err()
+}
+
 type TokenBucketConstructor struct{}
 
 func (c *TokenBucketConstructor) Name() string {
@@ -191,30 +540,23 @@ func (c *TokenBucketConstructor) Name() string {
 }
 
 func (c *TokenBucketConstructor) NewFromConfig(config map[string]interface{}, redisClient *redis.Client) (RateLimiter, error) {
-	bucketSize, err := getInt64Config(config, "bucket_size")
+	options, err := DecodeOptions[TokenBucketOptions](config)
 	if err != nil {
 		return nil, fmt.Errorf("token bucket strategy: %w", err)
 	}
-	refillRate, err := getInt64Config(config, "refill_rate_per_second")
+
+	bucket, err := NewTokenBucketRateLimiter(options.TokenBucketConfig, redisClient)
 	if err != nil {
-		return nil, fmt.Errorf("token bucket strategy: %w", err)
+		return nil, err
 	}
-	keyPrefix, err := getStringConfig(config, "key_prefix")
-	if err != nil {
-		return nil, fmt.Errorf("token bucket strategy: %w", err)
-	}
-	ttlBuffer, err := getIntConfig(config, "ttl_buffer_seconds")
-	if err != nil {
-		return nil, fmt.Errorf("token bucket strategy: %w", err)
+	if options.LeaseSize == 0 {
+		return bucket, nil
 	}
 
-	tokenBucketConfig := TokenBucketConfig{
-		BucketSize:          bucketSize,
-		RefillRatePerSecond: refillRate,
-		KeyPrefix:           keyPrefix,
-		TTLBufferSeconds:    ttlBuffer,
-	}
-	return NewTokenBucketRateLimiter(tokenBucketConfig, redisClient)
+	return NewLeasedTokenBucketRateLimiter(bucket, TokenLeaseConfig{
+		LeaseSize: options.LeaseSize,
+		LeaseTTL:  time.Duration(options.LeaseTTLMillis) * time.Millisecond,
+	})
 }
 
 func (c *TokenBucketConstructor) ConvertConfig(rawConfig interface{}) (map[string]interface{}, error) {
@@ -223,10 +565,16 @@ func (c *TokenBucketConstructor) ConvertConfig(rawConfig interface{}) (map[strin
 		return nil, fmt.Errorf("expected TokenBucketConfig, got %T", rawConfig)
 	}
 
-	return map[string]interface{}{
-		"key_prefix":             cfg.KeyPrefix,
-		"ttl_buffer_seconds":     cfg.TTLBufferSeconds,
-		"bucket_size":            cfg.BucketSize,
-		"refill_rate_per_second": cfg.RefillRatePerSecond,
-	}, nil
+	return EncodeOptions(TokenBucketOptions{
+		TokenBucketConfig: TokenBucketConfig{
+			BucketSize:                cfg.BucketSize,
+			RefillRatePerSecond:       float64(cfg.RefillRatePerSecond),
+			KeyPrefix:                 cfg.KeyPrefix,
+			TTLBufferSeconds:          cfg.TTLBufferSeconds,
+			GlobalBucketSize:          cfg.Global.BucketSize,
+			GlobalRefillRatePerSecond: cfg.Global.RefillRatePerSecond,
+		},
+		LeaseSize:      cfg.Lease.Size,
+		LeaseTTLMillis: cfg.Lease.TTLMillis,
+	})
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockRedisClient struct {
@@ -180,4 +181,29 @@ func TestTokenBucketConstructor(t *testing.T) {
 		assert.Equal(t, "test:", expected["key_prefix"])
 		assert.Equal(t, 5, expected["ttl_buffer_seconds"])
 	})
-}
\ No newline at end of file
+}
+func TestTokenBucketRateLimiter_ClientCannotNameGlobalBucket(t *testing.T) {
+	client, server := newScriptRedis(t)
+	ctx := context.Background()
+	now := time.Unix(0, scriptNow)
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{
+		BucketSize: 5, RefillRatePerSecond: 1, GlobalBucketSize: 2, GlobalRefillRatePerSecond: 1, KeyPrefix: "tb",
+	}, client)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		response, err := bucket.IsAllowed(ctx, GlobalBucketKey, now)
+		require.NoError(t, err)
+		assert.True(t, response.Allowed)
+	}
+	assert.True(t, server.Exists("tb:___global__"), "the client gets a bucket of its own")
+
+	response, err := bucket.IsAllowed(ctx, "other", now)
+	require.NoError(t, err)
+	assert.False(t, response.Allowed, "the global bucket is shared")
+
+	deleted, err := bucket.ResetPrefix(ctx, "_")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.True(t, server.Exists("tb:__global__"), "prefix resets keep the global bucket")
+}
@@ -0,0 +1,229 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TokenLeaseConfig struct {
+	LeaseSize int64
+	LeaseTTL  time.Duration
+}
+
+type tokenLease struct {
+	tokens     int64
+	expiresAt  time.Time
+	refreshing bool
+}
+
+// LeasedTokenBucketRateLimiter claims batches of tokens from the shared Redis
+// bucket and serves them from memory. Unused tokens are dropped when the lease
+// expires, so an instance can over-admit by at most one lease per key.
+type LeasedTokenBucketRateLimiter struct {
+	bucket    *TokenBucketRateLimiter
+	leaseSize int64
+	leaseTTL  time.Duration
+	ctx       context.Context
+	metadata  Metadata
+
+	mu     sync.Mutex
+	leases map[string]*tokenLease
+}
+
+func NewLeasedTokenBucketRateLimiter(bucket *TokenBucketRateLimiter, config TokenLeaseConfig) (*LeasedTokenBucketRateLimiter, error) {
+	if bucket == nil || config.LeaseSize <= 0 {
+		return nil, errors.New("invalid configuration")
+	}
+	if config.LeaseSize > bucket.bucketSize {
+		return nil, fmt.Errorf("lease size %d exceeds bucket size %d", config.LeaseSize, bucket.bucketSize)
+	}
+
+	leaseTTL := config.LeaseTTL
+	if leaseTTL <= 0 {
+		leaseTTL = DefaultTokenLeaseTTL
+	}
+
+	return &LeasedTokenBucketRateLimiter{
+		bucket:    bucket,
+		leaseSize: config.LeaseSize,
+		leaseTTL:  leaseTTL,
+		ctx:       context.Background(),
+		leases:    make(map[string]*tokenLease),
+		metadata: SharedMetadata(map[string]interface{}{
+			"bucket_size": bucket.bucketSize,
+			"refill_rate": bucket.refillRatePerSecond,
+			"lease_size":  config.LeaseSize,
+		}),
+	}, nil
+}
+
+func (l *LeasedTokenBucketRateLimiter) IsAllowed(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	l.mu.Lock()
+	lease := l.leases[key]
+	if lease != nil && lease.tokens > 0 && timestamp.Before(lease.expiresAt) {
+		lease.tokens--
+		remaining := lease.tokens
+		expiresAt := lease.expiresAt
+		if remaining < l.leaseSize/2 && !lease.refreshing {
+			lease.refreshing = true
+			go l.refresh(key, l.leaseSize-remaining)
+		}
+		l.mu.Unlock()
+		return l.localResponse(remaining, expiresAt), nil
+	}
+	l.mu.Unlock()
+
+	granted, _, nextTokenTime, err := l.bucket.acquireTokens(ctx, key, l.leaseSize, timestamp)
+	if err != nil {
+		return RateLimitResponse{Err: err}, err
+	}
+
+	if granted == 0 {
+		retryAfter := nextTokenTime.Sub(timestamp)
+		if retryAfter < 0 {
+			retryAfter = 0
+		}
+		return RateLimitResponse{
+			Allowed:    false,
+			Limit:      l.bucket.bucketSize,
+			Remaining:  0,
+			ResetTime:  nextTokenTime,
+			RetryAfter: &retryAfter,
+			Metadata:   l.metadata,
+		}, nil
+	}
+
+	expiresAt := timestamp.Add(l.leaseTTL)
+	remaining := granted - 1
+
+	l.mu.Lock()
+	l.sweepExpiredLocked(timestamp)
+	l.leases[key] = &tokenLease{tokens: remaining, expiresAt: expiresAt}
+	l.mu.Unlock()
+
+	return l.localResponse(remaining, expiresAt), nil
+}
+
+func (l *LeasedTokenBucketRateLimiter) Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error) {
+	return l.bucket.Peek(ctx, key, timestamp)
+}
+
+func (l *LeasedTokenBucketRateLimiter) Reset(ctx context.Context, key string) error {
+	l.mu.Lock()
+	delete(l.leases, key)
+	l.mu.Unlock()
+
+	return l.bucket.Reset(ctx, key)
+}
+
+// ResetPrefix drops this instance's leases for keys starting with prefix and
+// clears the shared buckets. Other instances serve their leases until they
+// run out.
+func (l *LeasedTokenBucketRateLimiter) ResetPrefix(ctx context.Context, prefix string) (int64, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPrefix
+	}
+
+	l.mu.Lock()
+	for key := range l.leases {
+		if strings.HasPrefix(key, prefix) {
+			delete(l.leases, key)
+		}
+	}
+	l.mu.Unlock()
+
+	return l.bucket.ResetPrefix(ctx, prefix)
+}
+
+// Refund returns the token to the shared bucket rather than the local lease,
+// so it is available to every instance.
+func (l *LeasedTokenBucketRateLimiter) Refund(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	return l.bucket.Refund(ctx, key, n, timestamp)
+}
+
+// AddDebt charges the shared bucket; tokens already leased locally are still
+// served until the lease runs out.
+func (l *LeasedTokenBucketRateLimiter) AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error {
+	return l.bucket.AddDebt(ctx, key, n, timestamp)
+}
+
+// ReserveN reserves against the shared bucket; the local lease only serves
+// IsAllowed.
+func (l *LeasedTokenBucketRateLimiter) ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error) {
+	return l.bucket.ReserveN(ctx, key, n, timestamp, maxDelay)
+}
+
+func (l *LeasedTokenBucketRateLimiter) SupportsReserve() bool {
+	return l.bucket.SupportsReserve()
+}
+
+func (l *LeasedTokenBucketRateLimiter) setTopKeys(topKeys *TopKeys) {
+	l.bucket.setTopKeys(topKeys)
+}
+
+func (l *LeasedTokenBucketRateLimiter) setBackgroundContext(ctx context.Context) {
+	l.ctx = ctx
+}
+
+// refresh tops up a lease in the background before it runs dry, claiming
+// the n tokens it lacked. A lease never holds more than the lease size;
+// tokens it can't hold, e.g. because it was replaced meanwhile, go back to
+// the shared bucket.
+func (l *LeasedTokenBucketRateLimiter) refresh(key string, n int64) {
+	ctx, cancel := context.WithTimeout(l.ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	granted, _, _, err := l.bucket.acquireTokens(ctx, key, n, now)
+	if err != nil {
+		granted = 0
+	}
+
+	l.mu.Lock()
+	excess := granted
+	if lease := l.leases[key]; lease != nil {
+		lease.refreshing = false
+		if granted > 0 {
+			added := min(granted, max(0, l.leaseSize-lease.tokens))
+			lease.tokens += added
+			lease.expiresAt = now.Add(l.leaseTTL)
+			excess -= added
+		}
+	}
+	l.mu.Unlock()
+
+	if excess > 0 {
+		if err := l.bucket.Refund(ctx, key, excess, now); err != nil {
+			slog.Warn("failed to return leased tokens", "key", key, "error", err.Error())
+		}
+	}
+}
+
+func (l *LeasedTokenBucketRateLimiter) sweepExpiredLocked(now time.Time) {
+	if len(l.leases) < MaxTokenLeases {
+		return
+	}
+	for key, lease := range l.leases {
+		if !now.Before(lease.expiresAt) && !lease.refreshing {
+			delete(l.leases, key)
+		}
+	}
+}
+
+func (l *LeasedTokenBucketRateLimiter) localResponse(remaining int64, expiresAt time.Time) RateLimitResponse {
+	metadata := l.metadata
+	metadata.SetInt("lease_tokens", remaining)
+	metadata.SetTime("lease_expires", expiresAt)
+	return RateLimitResponse{
+		Allowed:   true,
+		Limit:     l.bucket.bucketSize,
+		Remaining: remaining,
+		ResetTime: expiresAt,
+		Metadata:  metadata,
+	}
+}
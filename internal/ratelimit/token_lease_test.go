@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTokenBucket(t *testing.T) *TokenBucketRateLimiter {
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{
+		BucketSize:          100,
+		RefillRatePerSecond: 10,
+		KeyPrefix:           "test:",
+	}, &redis.Client{})
+	assert.NoError(t, err)
+	return bucket
+}
+
+func TestNewLeasedTokenBucketRateLimiter(t *testing.T) {
+	bucket := newTestTokenBucket(t)
+
+	limiter, err := NewLeasedTokenBucketRateLimiter(bucket, TokenLeaseConfig{LeaseSize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultTokenLeaseTTL, limiter.leaseTTL)
+
+	_, err = NewLeasedTokenBucketRateLimiter(bucket, TokenLeaseConfig{LeaseSize: 0})
+	assert.Error(t, err)
+
+	_, err = NewLeasedTokenBucketRateLimiter(bucket, TokenLeaseConfig{LeaseSize: 101})
+	assert.Error(t, err)
+}
+
+func TestLeasedTokenBucketRateLimiter_ServesFromLease(t *testing.T) {
+	limiter, err := NewLeasedTokenBucketRateLimiter(newTestTokenBucket(t), TokenLeaseConfig{
+		LeaseSize: 10,
+		LeaseTTL:  time.Minute,
+	})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	limiter.leases["client"] = &tokenLease{tokens: 9, expiresAt: now.Add(time.Minute)}
+
+	response, err := limiter.IsAllowed(context.Background(), "client", now)
+
+	assert.NoError(t, err)
+	assert.True(t, response.Allowed)
+	assert.Equal(t, int64(8), response.Remaining)
+	assert.Equal(t, int64(8), limiter.leases["client"].tokens)
+	assert.Equal(t, int64(10), response.Metadata.Value("lease_size"))
+}
+
+func TestLeasedTokenBucketRateLimiter_sweepExpired(t *testing.T) {
+	limiter, err := NewLeasedTokenBucketRateLimiter(newTestTokenBucket(t), TokenLeaseConfig{LeaseSize: 10})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	for i := 0; i < MaxTokenLeases; i++ {
+		limiter.leases[string(rune(i))] = &tokenLease{expiresAt: now.Add(-time.Second)}
+	}
+	limiter.leases["live"] = &tokenLease{tokens: 5, expiresAt: now.Add(time.Second)}
+
+	limiter.sweepExpiredLocked(now)
+
+	assert.Len(t, limiter.leases, 1)
+	assert.Contains(t, limiter.leases, "live")
+}
+
+func TestLeasedTokenBucketRateLimiter_RefreshCapsLease(t *testing.T) {
+	client, server := newScriptRedis(t)
+	bucket, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 100, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	limiter, err := NewLeasedTokenBucketRateLimiter(bucket, TokenLeaseConfig{LeaseSize: 10, LeaseTTL: time.Minute})
+	require.NoError(t, err)
+
+	limiter.leases["client"] = &tokenLease{tokens: 4, expiresAt: time.Now().Add(time.Minute), refreshing: true}
+	limiter.refresh("client", 6)
+	assert.Equal(t, int64(10), limiter.leases["client"].tokens, "a refresh claims what the lease lacks")
+	assert.False(t, limiter.leases["client"].refreshing)
+
+	limiter.leases["client"] = &tokenLease{tokens: 9, expiresAt: time.Now().Add(time.Minute), refreshing: true}
+	limiter.refresh("client", 6)
+	assert.Equal(t, int64(10), limiter.leases["client"].tokens, "a lease never holds more than its size")
+	tokens, err := strconv.ParseFloat(server.HGet("tb:client", "tokens"), 64)
+	require.NoError(t, err)
+	assert.InDelta(t, 100-6-6+5, tokens, 0.1, "tokens the lease can't hold go back to the bucket")
+}
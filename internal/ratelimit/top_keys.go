@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// TopKeysPrefix prefixes the per-bucket sorted sets of request and denial
+	// counts by key.
+	TopKeysPrefix = "rl:analytics:"
+
+	DefaultTopKeysWindow     = time.Hour
+	DefaultTopKeysResolution = time.Minute
+)
+
+type TopKeysConfig struct {
+	// Window is how far back the report looks. Counts are kept in buckets of
+	// Resolution, so the window slides in steps of that size.
+	Window     time.Duration
+	Resolution time.Duration
+}
+
+type KeyCount struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+type TopKeysReport struct {
+	WindowSeconds  int64      `json:"window_seconds"`
+	HighestTraffic []KeyCount `json:"highest_traffic"`
+	MostThrottled  []KeyCount `json:"most_throttled"`
+}
+
+// TopKeys tracks which keys send the most requests and get denied the most.
+// The strategy scripts update the counts as part of each decision, which
+// costs up to two extra writes per request.
+type TopKeys struct {
+	redisClient *redis.Client
+	window      time.Duration
+	resolution  time.Duration
+}
+
+func NewTopKeys(redisClient *redis.Client, config TopKeysConfig) (*TopKeys, error) {
+	if config.Window <= 0 {
+		config.Window = DefaultTopKeysWindow
+	}
+	if config.Resolution <= 0 {
+		config.Resolution = DefaultTopKeysResolution
+	}
+	if config.Resolution < time.Second || config.Resolution > config.Window {
+		return nil, fmt.Errorf("top keys resolution must be between 1s and the window")
+	}
+
+	return &TopKeys{
+		redisClient: redisClient,
+		window:      config.Window,
+		resolution:  config.Resolution,
+	}, nil
+}
+
+// scriptKeys completes the keys and arguments of a strategy script. With
+// analytics on it adds the sorted sets for timestamp's bucket and the member
+// to count; either way the throttle key goes last. A nil TopKeys is off.
+func (t *TopKeys) scriptKeys(keys []string, args []interface{}, member string, timestamp time.Time) ([]string, []interface{}) {
+	if t == nil {
+		return append(keys, ThrottleKey), args
+	}
+
+	bucket := t.bucket(timestamp)
+	ttlSeconds := int64((t.window + t.resolution).Seconds())
+	keys = append(keys, t.key("traffic", bucket), t.key("throttled", bucket), ThrottleKey)
+	return keys, append(args, member, ttlSeconds)
+}
+
+// Top returns the limit keys with the most requests and the most denials over
+// the window ending at now.
+func (t *TopKeys) Top(ctx context.Context, now time.Time, limit int64) (TopKeysReport, error) {
+	report := TopKeysReport{WindowSeconds: int64(t.window.Seconds())}
+
+	var err error
+	if report.HighestTraffic, err = t.top(ctx, "traffic", now, limit); err != nil {
+		return TopKeysReport{}, err
+	}
+	if report.MostThrottled, err = t.top(ctx, "throttled", now, limit); err != nil {
+		return TopKeysReport{}, err
+	}
+	return report, nil
+}
+
+func (t *TopKeys) top(ctx context.Context, kind string, now time.Time, limit int64) ([]KeyCount, error) {
+	last := t.bucket(now)
+	buckets := int64(t.window / t.resolution)
+	resolution := int64(t.resolution.Seconds())
+
+	keys := make([]string, 0, buckets)
+	for i := int64(0); i < buckets; i++ {
+		keys = append(keys, t.key(kind, last-i*resolution))
+	}
+
+	// The union is built server-side so only the top entries come back.
+	dest := fmt.Sprintf("%stop:%s:%d", TopKeysPrefix, kind, now.UnixNano())
+	var entries *redis.ZSliceCmd
+	_, err := t.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZUnionStore(ctx, dest, &redis.ZStore{Keys: keys})
+		entries = pipe.ZRevRangeWithScores(ctx, dest, 0, limit-1)
+		pipe.Del(ctx, dest)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]KeyCount, 0, len(entries.Val()))
+	for _, entry := range entries.Val() {
+		member, _ := entry.Member.(string)
+		counts = append(counts, KeyCount{Key: member, Count: int64(entry.Score)})
+	}
+	return counts, nil
+}
+
+// bucket returns the Unix second at which timestamp's bucket starts.
+func (t *TopKeys) bucket(timestamp time.Time) int64 {
+	return timestamp.Truncate(t.resolution).Unix()
+}
+
+func (t *TopKeys) key(kind string, bucket int64) string {
+	return TopKeysPrefix + kind + ":" + strconv.FormatInt(bucket, 10)
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTopKeys_Validation(t *testing.T) {
+	client, _ := newScriptRedis(t)
+
+	_, err := NewTopKeys(client, TopKeysConfig{Window: time.Minute, Resolution: time.Hour})
+	assert.Error(t, err)
+	_, err = NewTopKeys(client, TopKeysConfig{Window: time.Minute, Resolution: time.Millisecond})
+	assert.Error(t, err)
+
+	topKeys, err := NewTopKeys(client, TopKeysConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTopKeysWindow, topKeys.window)
+	assert.Equal(t, DefaultTopKeysResolution, topKeys.resolution)
+}
+
+func TestTopKeys_CountsStrategyDecisions(t *testing.T) {
+	ctx := context.Background()
+	client, server := newScriptRedis(t)
+	topKeys, err := NewTopKeys(client, TopKeysConfig{Window: 10 * time.Minute, Resolution: time.Minute})
+	require.NoError(t, err)
+
+	rateLimiter, err := NewTokenBucketRateLimiter(TokenBucketConfig{BucketSize: 2, RefillRatePerSecond: 1, KeyPrefix: "tb"}, client)
+	require.NoError(t, err)
+	rateLimiter.setTopKeys(topKeys)
+
+	now := time.Unix(0, scriptNow)
+	for i := 0; i < 5; i++ {
+		_, err := rateLimiter.IsAllowed(ctx, "noisy", now)
+		require.NoError(t, err)
+	}
+	// A request in an earlier bucket still counts within the window.
+	_, err = rateLimiter.IsAllowed(ctx, "quiet", now.Add(-5*time.Minute))
+	require.NoError(t, err)
+
+	report, err := topKeys.Top(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(600), report.WindowSeconds)
+	assert.Equal(t, []KeyCount{{Key: "noisy", Count: 5}, {Key: "quiet", Count: 1}}, report.HighestTraffic)
+	assert.Equal(t, []KeyCount{{Key: "noisy", Count: 3}}, report.MostThrottled)
+
+	report, err = topKeys.Top(ctx, now.Add(20*time.Minute), 10)
+	require.NoError(t, err)
+	assert.Empty(t, report.HighestTraffic, "buckets outside the window are ignored")
+
+	for _, key := range server.Keys() {
+		assert.NotContains(t, key, TopKeysPrefix+"top:", "temporary union keys are removed")
+	}
+}
+
+func TestTopKeys_NilLeavesScriptsUnchanged(t *testing.T) {
+	var topKeys *TopKeys
+	keys, args := topKeys.scriptKeys([]string{"tb:client"}, []interface{}{1}, "client", time.Now())
+
+	assert.Equal(t, []string{"tb:client", ThrottleKey}, keys)
+	assert.Equal(t, []interface{}{1}, args)
+}
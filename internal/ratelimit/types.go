@@ -2,19 +2,30 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type RateLimitResponse struct {
-	Allowed    bool                   `json:"allowed"`
-	Limit      int64                  `json:"limit"`
-	Remaining  int64                  `json:"remaining"`
-	ResetTime  time.Time              `json:"reset_time"`
-	RetryAfter *time.Duration         `json:"retry_after,omitempty"`
-	Metadata   map[string]interface{} `json:"metadata,omitempty"`
-	Err        error                  `json:"-"`
+	Allowed  bool `json:"allowed"`
+	Bypassed bool `json:"bypassed,omitempty"`
+	// Optimistic is set on requests let through before the limiter decided
+	// them. They are still charged, but have no limit or remaining count.
+	Optimistic bool           `json:"optimistic,omitempty"`
+	Limit      int64          `json:"limit"`
+	Remaining  int64          `json:"remaining"`
+	ResetTime  time.Time      `json:"reset_time"`
+	RetryAfter *time.Duration `json:"retry_after,omitempty"`
+	Metadata   Metadata       `json:"metadata"`
+	// Stats is set by strategies keeping key statistics, when enabled.
+	Stats *KeyStats `json:"stats,omitempty"`
+	Err   error     `json:"-"`
+	// RecentRequests are set by Peek when asked for with WithRecentRequests.
+	RecentRequests []time.Time `json:"recent_requests,omitempty"`
 }
 
 type RateLimiter interface {
@@ -22,6 +33,125 @@ type RateLimiter interface {
 	Reset(ctx context.Context, key string) error
 }
 
+// Peeker is implemented by rate limiters that can report a key's usage
+// without consuming capacity.
+type Peeker interface {
+	Peek(ctx context.Context, key string, timestamp time.Time) (RateLimitResponse, error)
+}
+
+var ErrPeekNotSupported = errors.New("rate limiter does not support peeking")
+
+// BatchRateLimiter is implemented by rate limiters that can decide n requests
+// for the same key in one call. It returns how many were granted along with a
+// response describing the state after the grant.
+type BatchRateLimiter interface {
+	RateLimiter
+	AllowN(ctx context.Context, key string, n int64, timestamp time.Time) (int64, RateLimitResponse, error)
+}
+
+var ErrBatchNotSupported = errors.New("rate limiter does not support batch decisions")
+
+// Refunder is implemented by rate limiters that can give back the capacity n
+// allowed requests consumed, for requests that turn out not to count or failed
+// downstream. timestamp is the one the requests were decided at. Refunds never
+// raise a key above its limit.
+type Refunder interface {
+	Refund(ctx context.Context, key string, n int64, timestamp time.Time) error
+}
+
+var ErrRefundNotSupported = errors.New("rate limiter does not support refunds")
+
+// Reservation schedules requests instead of denying them. When Allowed, the
+// requests have been charged and may proceed after Delay; otherwise nothing
+// was charged and RetryAfter, if set, says when the reservation would fit.
+type Reservation struct {
+	RateLimitResponse
+	Delay time.Duration `json:"delay"`
+}
+
+// Reserver is implemented by rate limiters that can pace callers, like
+// golang.org/x/time/rate's ReserveN. Reservations that would have to wait
+// longer than maxDelay are refused. A reservation that won't be used should
+// be handed back with Refund.
+type Reserver interface {
+	ReserveN(ctx context.Context, key string, n int64, timestamp time.Time, maxDelay time.Duration) (Reservation, error)
+}
+
+var ErrReserveNotSupported = errors.New("rate limiter does not support reservations")
+
+// Debtor is implemented by rate limiters that can charge a key for n requests
+// beyond its limit, e.g. to penalise abuse. The debt is paid off by the
+// strategy's normal refill or window, so the key stays blocked for longer.
+type Debtor interface {
+	AddDebt(ctx context.Context, key string, n int64, timestamp time.Time) error
+}
+
+var ErrDebtNotSupported = errors.New("rate limiter does not support debt")
+
+// PrefixResetter is implemented by rate limiters that can clear every key
+// starting with a prefix, e.g. all of one customer's API keys. It returns the
+// number of Redis keys deleted.
+type PrefixResetter interface {
+	ResetPrefix(ctx context.Context, prefix string) (int64, error)
+}
+
+var ErrResetPrefixNotSupported = errors.New("rate limiter does not support prefix resets")
+
+// SupportsBatch reports whether rateLimiter can serve AllowN, looking through
+// wrappers that forward to another limiter.
+func SupportsBatch(rateLimiter RateLimiter) bool {
+	if capable, ok := rateLimiter.(interface{ SupportsBatch() bool }); ok {
+		return capable.SupportsBatch()
+	}
+	_, ok := rateLimiter.(BatchRateLimiter)
+	return ok
+}
+
+// SupportsRefund reports whether rateLimiter can serve Refund, looking through
+// wrappers that forward to another limiter.
+func SupportsRefund(rateLimiter RateLimiter) bool {
+	if capable, ok := rateLimiter.(interface{ SupportsRefund() bool }); ok {
+		return capable.SupportsRefund()
+	}
+	_, ok := rateLimiter.(Refunder)
+	return ok
+}
+
+// SupportsReserve reports whether rateLimiter can serve ReserveN, looking
+// through wrappers that forward to another limiter.
+func SupportsReserve(rateLimiter RateLimiter) bool {
+	if capable, ok := rateLimiter.(interface{ SupportsReserve() bool }); ok {
+		return capable.SupportsReserve()
+	}
+	_, ok := rateLimiter.(Reserver)
+	return ok
+}
+
+// ErrCapabilityLost is returned when a running policy's limiter would be
+// replaced by one that can't serve calls the middleware in front of it makes.
+var ErrCapabilityLost = errors.New("rate limiter lacks capabilities of the one it would replace")
+
+// CheckCapabilities returns ErrCapabilityLost when next can't serve
+// reservations, batches or refunds that current serves. Middleware picks
+// its reserve, batch, refund and cost paths once, when built, so swapping in
+// a limiter without one fails every request taking that path.
+func CheckCapabilities(current, next RateLimiter) error {
+	var lost []string
+	if SupportsReserve(current) && !SupportsReserve(next) {
+		lost = append(lost, "reserve")
+	}
+	if SupportsBatch(current) && !SupportsBatch(next) {
+		lost = append(lost, "batch")
+	}
+	if SupportsRefund(current) && !SupportsRefund(next) {
+		lost = append(lost, "refund")
+	}
+	if len(lost) > 0 {
+		return fmt.Errorf("%w: %s", ErrCapabilityLost, strings.Join(lost, ", "))
+	}
+	return nil
+}
+
 type StrategyConstructor interface {
 	Name() string
 	NewFromConfig(config map[string]interface{}, redisClient *redis.Client) (RateLimiter, error)
@@ -34,4 +164,7 @@ const (
 	TokenBucketStrategy          RateLimitStrategy = "token_bucket"
 	SlidingWindowLogStrategy     RateLimitStrategy = "sliding_window_log"
 	SlidingWindowCounterStrategy RateLimitStrategy = "sliding_window_counter"
+	QuotaStrategy                RateLimitStrategy = "quota"
+	HierarchicalStrategy         RateLimitStrategy = "hierarchical"
+	MultiWindowStrategy          RateLimitStrategy = "multi_window"
 )
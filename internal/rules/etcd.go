@@ -0,0 +1,208 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ErrNoRuleSet is returned when nothing has been pushed to etcd yet.
+var ErrNoRuleSet = errors.New("no rule set in etcd")
+
+// ErrRuleSetConflict is returned when other writers kept updating the rule
+// set while Put was trying to write it.
+var ErrRuleSetConflict = errors.New("rule set changed concurrently, try again")
+
+// putAttempts is how often Put retries a write that lost a race.
+const putAttempts = 5
+
+// RuleSet is one version of the rules as stored in etcd.
+type RuleSet struct {
+	Version   int64               `json:"version"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	Rules     []config.RuleConfig `json:"rules"`
+}
+
+// etcdClient is the part of *clientv3.Client EtcdStore uses.
+type etcdClient interface {
+	clientv3.KV
+	clientv3.Watcher
+}
+
+// EtcdStore keeps versioned rule sets under a prefix in etcd: the one in
+// force at <prefix>/current and every version ever written at
+// <prefix>/versions/<version>, so any of them can be rolled back to.
+type EtcdStore struct {
+	client etcdClient
+	prefix string
+}
+
+func NewEtcdStore(client etcdClient, prefix string) *EtcdStore {
+	return &EtcdStore{client: client, prefix: strings.TrimRight(prefix, "/")}
+}
+
+func (s *EtcdStore) currentKey() string {
+	return s.prefix + "/current"
+}
+
+func (s *EtcdStore) versionsKey() string {
+	return s.prefix + "/versions/"
+}
+
+// versionKey zero-pads version so the versions sort by key.
+func (s *EtcdStore) versionKey(version int64) string {
+	return fmt.Sprintf("%s%020d", s.versionsKey(), version)
+}
+
+// Current returns the rule set in force and the etcd revision it was read
+// at, which Watch continues from.
+func (s *EtcdStore) Current(ctx context.Context) (RuleSet, int64, error) {
+	resp, err := s.client.Get(ctx, s.currentKey())
+	if err != nil {
+		return RuleSet{}, 0, fmt.Errorf("failed to read rules from etcd: %w", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return RuleSet{}, resp.Header.GetRevision(), ErrNoRuleSet
+	}
+
+	set, err := decodeRuleSet(resp.Kvs[0].Value)
+	return set, resp.Header.GetRevision(), err
+}
+
+// Put writes rules as the next version and makes it current in one
+// transaction, which only succeeds if nobody else wrote in between.
+func (s *EtcdStore) Put(ctx context.Context, rules []config.RuleConfig) (RuleSet, error) {
+	for attempt := 0; attempt < putAttempts; attempt++ {
+		resp, err := s.client.Get(ctx, s.currentKey())
+		if err != nil {
+			return RuleSet{}, fmt.Errorf("failed to read rules from etcd: %w", err)
+		}
+
+		unchanged := clientv3.Compare(clientv3.CreateRevision(s.currentKey()), "=", 0)
+		set := RuleSet{Version: 1, UpdatedAt: time.Now().UTC(), Rules: rules}
+		if len(resp.Kvs) > 0 {
+			current, err := decodeRuleSet(resp.Kvs[0].Value)
+			if err != nil {
+				return RuleSet{}, err
+			}
+			set.Version = current.Version + 1
+			unchanged = clientv3.Compare(clientv3.ModRevision(s.currentKey()), "=", resp.Kvs[0].ModRevision)
+		}
+
+		data, err := json.Marshal(set)
+		if err != nil {
+			return RuleSet{}, err
+		}
+		txn, err := s.client.Txn(ctx).
+			If(unchanged).
+			Then(clientv3.OpPut(s.currentKey(), string(data)), clientv3.OpPut(s.versionKey(set.Version), string(data))).
+			Commit()
+		if err != nil {
+			return RuleSet{}, fmt.Errorf("failed to write rules to etcd: %w", err)
+		}
+		if txn.Succeeded {
+			return set, nil
+		}
+	}
+	return RuleSet{}, ErrRuleSetConflict
+}
+
+// Rollback makes the rules of version current again. It writes them as a new
+// version, so the history keeps the rollback too.
+func (s *EtcdStore) Rollback(ctx context.Context, version int64) (RuleSet, error) {
+	resp, err := s.client.Get(ctx, s.versionKey(version))
+	if err != nil {
+		return RuleSet{}, fmt.Errorf("failed to read rules from etcd: %w", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return RuleSet{}, fmt.Errorf("rule set version %d not found", version)
+	}
+
+	previous, err := decodeRuleSet(resp.Kvs[0].Value)
+	if err != nil {
+		return RuleSet{}, err
+	}
+	return s.Put(ctx, previous.Rules)
+}
+
+// History returns every version written, newest first.
+func (s *EtcdStore) History(ctx context.Context) ([]RuleSet, error) {
+	resp, err := s.client.Get(ctx, s.versionsKey(), clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules from etcd: %w", err)
+	}
+
+	sets := make([]RuleSet, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		set, err := decodeRuleSet(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	sort.Slice(sets, func(i, j int) bool { return sets[i].Version > sets[j].Version })
+	return sets, nil
+}
+
+// Watch calls apply with every rule set made current after revision, in
+// order, until ctx is done. When the watch breaks, e.g. because etcd
+// compacted past it, it reads the current rule set again and carries on.
+func (s *EtcdStore) Watch(ctx context.Context, revision int64, apply func(RuleSet)) {
+	go func() {
+		for {
+			for resp := range s.client.Watch(clientv3.WithRequireLeader(ctx), s.currentKey(), clientv3.WithRev(revision+1)) {
+				if err := resp.Err(); err != nil {
+					slog.Error("rules watch failed", "error", err)
+					continue
+				}
+				for _, event := range resp.Events {
+					revision = event.Kv.ModRevision
+					if event.Type != clientv3.EventTypePut {
+						continue
+					}
+					set, err := decodeRuleSet(event.Kv.Value)
+					if err != nil {
+						slog.Error("ignoring undecodable rule set", "error", err)
+						continue
+					}
+					apply(set)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+
+			set, current, err := s.Current(ctx)
+			switch {
+			case errors.Is(err, ErrNoRuleSet):
+				revision = current
+			case err != nil:
+				slog.Error("failed to reload rules after the watch broke", "error", err)
+			default:
+				if current > revision {
+					apply(set)
+				}
+				revision = current
+			}
+		}
+	}()
+}
+
+func decodeRuleSet(data []byte) (RuleSet, error) {
+	var set RuleSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return RuleSet{}, fmt.Errorf("invalid rule set in etcd: %w", err)
+	}
+	return set, nil
+}
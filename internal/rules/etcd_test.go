@@ -0,0 +1,239 @@
+package rules
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeEtcd is an in-memory KV with just enough of etcd's revision, txn and
+// watch behaviour for EtcdStore.
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Watcher
+
+	mu       sync.Mutex
+	revision int64
+	kvs      map[string]*mvccpb.KeyValue
+	watches  map[string]chan clientv3.WatchResponse
+	// beforeCommit runs before each transaction, to simulate another writer.
+	beforeCommit func()
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{kvs: make(map[string]*mvccpb.KeyValue), watches: make(map[string]chan clientv3.WatchResponse)}
+}
+
+func (f *fakeEtcd) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	op := clientv3.OpGet(key, opts...)
+	resp := &clientv3.GetResponse{Header: &pb.ResponseHeader{Revision: f.revision}}
+	for k, kv := range f.kvs {
+		if k == key || (op.IsOptsWithPrefix() && strings.HasPrefix(k, key)) {
+			resp.Kvs = append(resp.Kvs, kv)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeEtcd) put(key, value string) {
+	f.revision++
+	kv := &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value), ModRevision: f.revision, CreateRevision: f.revision}
+	if existing, ok := f.kvs[key]; ok {
+		kv.CreateRevision = existing.CreateRevision
+	}
+	f.kvs[key] = kv
+	if watch, ok := f.watches[key]; ok {
+		watch <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: clientv3.EventTypePut, Kv: kv}}}
+	}
+}
+
+func (f *fakeEtcd) Txn(ctx context.Context) clientv3.Txn {
+	return &fakeTxn{etcd: f}
+}
+
+func (f *fakeEtcd) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	watch := make(chan clientv3.WatchResponse, 10)
+	f.watches[key] = watch
+	return watch
+}
+
+func (f *fakeEtcd) closeWatches() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, watch := range f.watches {
+		close(watch)
+	}
+	f.watches = make(map[string]chan clientv3.WatchResponse)
+}
+
+type fakeTxn struct {
+	etcd *fakeEtcd
+	cmps []clientv3.Cmp
+	ops  []clientv3.Op
+}
+
+func (t *fakeTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.cmps = cs
+	return t
+}
+
+func (t *fakeTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.ops = ops
+	return t
+}
+
+func (t *fakeTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	return t
+}
+
+func (t *fakeTxn) Commit() (*clientv3.TxnResponse, error) {
+	if t.etcd.beforeCommit != nil {
+		t.etcd.beforeCommit()
+	}
+
+	t.etcd.mu.Lock()
+	defer t.etcd.mu.Unlock()
+
+	for _, cmp := range t.cmps {
+		var got, want int64
+		kv := t.etcd.kvs[string(cmp.KeyBytes())]
+		switch target := cmp.TargetUnion.(type) {
+		case *pb.Compare_CreateRevision:
+			want = target.CreateRevision
+			if kv != nil {
+				got = kv.CreateRevision
+			}
+		case *pb.Compare_ModRevision:
+			want = target.ModRevision
+			if kv != nil {
+				got = kv.ModRevision
+			}
+		}
+		if got != want {
+			return &clientv3.TxnResponse{Succeeded: false}, nil
+		}
+	}
+
+	for _, op := range t.ops {
+		if op.IsPut() {
+			t.etcd.put(string(op.KeyBytes()), string(op.ValueBytes()))
+		}
+	}
+	return &clientv3.TxnResponse{Succeeded: true}, nil
+}
+
+func ruleNamed(name string) config.RuleConfig {
+	return config.RuleConfig{Name: name, Match: config.RuleMatchConfig{Paths: []string{"/" + name}}, Action: string(ActionBypass)}
+}
+
+func TestEtcdStore_PutAndRollback(t *testing.T) {
+	ctx := context.Background()
+	store := NewEtcdStore(newFakeEtcd(), "/rate-limiter/rules/")
+
+	_, _, err := store.Current(ctx)
+	assert.ErrorIs(t, err, ErrNoRuleSet)
+
+	first, err := store.Put(ctx, []config.RuleConfig{ruleNamed("health")})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), first.Version)
+
+	second, err := store.Put(ctx, []config.RuleConfig{ruleNamed("metrics")})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), second.Version)
+
+	current, _, err := store.Current(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "metrics", current.Rules[0].Name)
+
+	rolledBack, err := store.Rollback(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), rolledBack.Version, "a rollback is a new version")
+	assert.Equal(t, "health", rolledBack.Rules[0].Name)
+
+	history, err := store.History(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, []int64{3, 2, 1}, []int64{history[0].Version, history[1].Version, history[2].Version})
+
+	_, err = store.Rollback(ctx, 7)
+	assert.Error(t, err)
+}
+
+func TestEtcdStore_PutRetriesConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	etcd := newFakeEtcd()
+	store := NewEtcdStore(etcd, "/rules")
+	other := NewEtcdStore(etcd, "/rules")
+
+	etcd.beforeCommit = func() {
+		etcd.beforeCommit = nil
+		_, err := other.Put(ctx, []config.RuleConfig{ruleNamed("other")})
+		require.NoError(t, err)
+	}
+
+	set, err := store.Put(ctx, []config.RuleConfig{ruleNamed("mine")})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), set.Version, "the losing write is retried on top of the winner")
+
+	history, err := store.History(ctx)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	etcd.beforeCommit = func() {
+		etcd.mu.Lock()
+		etcd.put("/rules/current", `{"version":99}`)
+		etcd.mu.Unlock()
+	}
+	_, err = store.Put(ctx, nil)
+	assert.ErrorIs(t, err, ErrRuleSetConflict)
+}
+
+func TestEtcdStore_Watch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	etcd := newFakeEtcd()
+	store := NewEtcdStore(etcd, "/rules")
+	_, revision, err := store.Current(ctx)
+	require.ErrorIs(t, err, ErrNoRuleSet)
+
+	applied := make(chan RuleSet, 10)
+	store.Watch(ctx, revision, func(set RuleSet) { applied <- set })
+	require.Eventually(t, func() bool {
+		etcd.mu.Lock()
+		defer etcd.mu.Unlock()
+		return len(etcd.watches) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = store.Put(ctx, []config.RuleConfig{ruleNamed("health")})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), (<-applied).Version)
+
+	// A broken watch catches up on what it missed by re-reading current.
+	etcd.closeWatches()
+	_, err = store.Put(ctx, []config.RuleConfig{ruleNamed("metrics")})
+	require.NoError(t, err)
+
+	select {
+	case set := <-applied:
+		assert.Equal(t, int64(2), set.Version)
+	case <-time.After(3 * time.Second):
+		t.Fatal("rule set was not applied after the watch broke")
+	}
+}
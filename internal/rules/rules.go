@@ -0,0 +1,166 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"path"
+	"strings"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+type Action string
+
+const (
+	// ActionLimit applies the rule's policy.
+	ActionLimit Action = "limit"
+	// ActionBypass lets the request through without touching any limiter.
+	ActionBypass Action = "bypass"
+	// ActionDeny rejects the request outright.
+	ActionDeny Action = "deny"
+)
+
+// DefaultTierHeader carries the caller's plan. It should be set by a trusted
+// gateway, since clients can otherwise pick their own tier.
+const DefaultTierHeader = "X-RateLimit-Tier"
+
+// Matcher selects requests. Every non-empty field must match; within a field
+// any entry may match.
+type Matcher struct {
+	// Paths are path.Match patterns; a trailing "/**" matches any suffix.
+	Paths   []string
+	Methods []string
+	// Headers maps a header name to its required value; an empty value only
+	// requires the header to be present.
+	Headers map[string]string
+	Tiers   []string
+	CIDRs   []netip.Prefix
+}
+
+type Rule struct {
+	Name   string
+	Match  Matcher
+	Action Action
+	// Policy decides ActionLimit requests.
+	Policy *ratelimit.Policy
+}
+
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return errors.New("rule name is required")
+	}
+	switch r.Action {
+	case ActionLimit:
+		if r.Policy == nil {
+			return fmt.Errorf("rule %s: limit action needs a policy", r.Name)
+		}
+	case ActionBypass, ActionDeny:
+	default:
+		return fmt.Errorf("rule %s: unknown action %q", r.Name, r.Action)
+	}
+	for _, pattern := range r.Match.Paths {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/**"), ""); err != nil {
+			return fmt.Errorf("rule %s: path %q: %w", r.Name, pattern, err)
+		}
+	}
+	return nil
+}
+
+// Request is what rules are matched against.
+type Request struct {
+	Method   string
+	Path     string
+	Header   http.Header
+	ClientIP string
+}
+
+// Engine evaluates an ordered list of rules; the first match wins.
+type Engine struct {
+	rules      []Rule
+	tierHeader string
+}
+
+func NewEngine(tierHeader string) *Engine {
+	if tierHeader == "" {
+		tierHeader = DefaultTierHeader
+	}
+	return &Engine{tierHeader: tierHeader}
+}
+
+func (e *Engine) Add(rule Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	for _, existing := range e.rules {
+		if existing.Name == rule.Name {
+			return fmt.Errorf("duplicate rule %s", rule.Name)
+		}
+	}
+	e.rules = append(e.rules, rule)
+	return nil
+}
+
+func (e *Engine) Rules() []Rule {
+	return append([]Rule(nil), e.rules...)
+}
+
+// Evaluate returns the first rule matching req.
+func (e *Engine) Evaluate(req Request) (Rule, bool) {
+	for _, rule := range e.rules {
+		if e.matches(rule.Match, req) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+func (e *Engine) matches(m Matcher, req Request) bool {
+	if len(m.Paths) > 0 && !anyMatch(m.Paths, func(pattern string) bool { return matchPath(pattern, req.Path) }) {
+		return false
+	}
+	if len(m.Methods) > 0 && !anyMatch(m.Methods, func(method string) bool { return strings.EqualFold(method, req.Method) }) {
+		return false
+	}
+	for name, want := range m.Headers {
+		values, present := req.Header[http.CanonicalHeaderKey(name)]
+		if !present || (want != "" && (len(values) == 0 || values[0] != want)) {
+			return false
+		}
+	}
+	if len(m.Tiers) > 0 {
+		tier := req.Header.Get(e.tierHeader)
+		if tier == "" || !anyMatch(m.Tiers, func(want string) bool { return strings.EqualFold(want, tier) }) {
+			return false
+		}
+	}
+	if len(m.CIDRs) > 0 {
+		addr, err := netip.ParseAddr(req.ClientIP)
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		if !anyMatch(m.CIDRs, func(prefix netip.Prefix) bool { return prefix.Contains(addr) }) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchPath(pattern, requestPath string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/")
+	}
+	matched, _ := path.Match(pattern, requestPath)
+	return matched
+}
+
+func anyMatch[T any](values []T, match func(T) bool) bool {
+	for _, value := range values {
+		if match(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package rules
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEngine(t *testing.T, rules ...Rule) *Engine {
+	t.Helper()
+	engine := NewEngine("")
+	for _, rule := range rules {
+		require.NoError(t, engine.Add(rule))
+	}
+	return engine
+}
+
+func TestEngine_FirstMatchWins(t *testing.T) {
+	policy := ratelimit.NewPolicy("writes", nil, nil)
+	engine := newTestEngine(t,
+		Rule{Name: "health", Match: Matcher{Paths: []string{"/health"}}, Action: ActionBypass},
+		Rule{Name: "blocked", Match: Matcher{CIDRs: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}}, Action: ActionDeny},
+		Rule{Name: "writes", Match: Matcher{Paths: []string{"/api/**"}, Methods: []string{"POST", "DELETE"}}, Action: ActionLimit, Policy: policy},
+	)
+
+	rule, ok := engine.Evaluate(Request{Method: "GET", Path: "/health", ClientIP: "192.0.2.1"})
+	require.True(t, ok)
+	assert.Equal(t, "health", rule.Name)
+
+	rule, ok = engine.Evaluate(Request{Method: "POST", Path: "/api/users/1", ClientIP: "192.0.2.1"})
+	require.True(t, ok)
+	assert.Equal(t, "blocked", rule.Name)
+
+	rule, ok = engine.Evaluate(Request{Method: "post", Path: "/api/users/1", ClientIP: "198.51.100.1"})
+	require.True(t, ok)
+	assert.Equal(t, "writes", rule.Name)
+	assert.Same(t, policy, rule.Policy)
+
+	_, ok = engine.Evaluate(Request{Method: "GET", Path: "/api/users/1", ClientIP: "198.51.100.1"})
+	assert.False(t, ok)
+}
+
+func TestEngine_HeaderAndTierMatchers(t *testing.T) {
+	engine := newTestEngine(t,
+		Rule{Name: "internal", Match: Matcher{Headers: map[string]string{"x-internal": ""}}, Action: ActionBypass},
+		Rule{Name: "beta", Match: Matcher{Headers: map[string]string{"X-Beta": "on"}}, Action: ActionBypass},
+		Rule{Name: "free", Match: Matcher{Tiers: []string{"free"}}, Action: ActionDeny},
+	)
+
+	evaluate := func(name, value string) string {
+		header := http.Header{}
+		header.Set(name, value)
+		rule, _ := engine.Evaluate(Request{Method: "GET", Path: "/", Header: header})
+		return rule.Name
+	}
+
+	assert.Equal(t, "internal", evaluate("X-Internal", "1"))
+	assert.Equal(t, "beta", evaluate("X-Beta", "on"))
+	assert.Equal(t, "", evaluate("X-Beta", "off"))
+	assert.Equal(t, "free", evaluate(DefaultTierHeader, "FREE"))
+	assert.Equal(t, "", evaluate(DefaultTierHeader, "pro"))
+}
+
+func TestMatchPath(t *testing.T) {
+	assert.True(t, matchPath("/api/*", "/api/users"))
+	assert.False(t, matchPath("/api/*", "/api/users/1"))
+	assert.True(t, matchPath("/api/**", "/api/users/1"))
+	assert.True(t, matchPath("/api/**", "/api"))
+	assert.False(t, matchPath("/api/**", "/apiary"))
+}
+
+func TestRule_Validate(t *testing.T) {
+	assert.Error(t, Rule{Action: ActionBypass}.Validate())
+	assert.Error(t, Rule{Name: "limit", Action: ActionLimit}.Validate(), "limit needs a policy")
+	assert.Error(t, Rule{Name: "unknown", Action: "throttle"}.Validate())
+	assert.Error(t, Rule{Name: "bad-path", Action: ActionDeny, Match: Matcher{Paths: []string{"/api/["}}}.Validate())
+
+	engine := newTestEngine(t, Rule{Name: "dup", Action: ActionDeny})
+	assert.Error(t, engine.Add(Rule{Name: "dup", Action: ActionBypass}))
+}
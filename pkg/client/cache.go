@@ -0,0 +1,59 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+type cachedDenial struct {
+	decision Decision
+	until    time.Time
+}
+
+// negativeCache holds denials until their key may retry. When full, expired
+// entries are swept and new denials are dropped if none were.
+type negativeCache struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]cachedDenial
+}
+
+func newNegativeCache(max int) *negativeCache {
+	return &negativeCache{max: max, entries: make(map[string]cachedDenial)}
+}
+
+func (n *negativeCache) get(key string, now time.Time) (Decision, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	entry, ok := n.entries[key]
+	if !ok {
+		return Decision{}, false
+	}
+	if !now.Before(entry.until) {
+		delete(n.entries, key)
+		return Decision{}, false
+	}
+
+	decision := entry.decision
+	decision.Cached = true
+	decision.RetryAfter = entry.until.Sub(now)
+	return decision, true
+}
+
+func (n *negativeCache) put(key string, decision Decision, now, until time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, exists := n.entries[key]; !exists && len(n.entries) >= n.max {
+		for cachedKey, entry := range n.entries {
+			if !now.Before(entry.until) {
+				delete(n.entries, cachedKey)
+			}
+		}
+		if len(n.entries) >= n.max {
+			return
+		}
+	}
+	n.entries[key] = cachedDenial{decision: decision, until: until}
+}
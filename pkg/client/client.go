@@ -0,0 +1,247 @@
+// Package client lets Go services consult a central rate limiter over HTTP:
+//
+//	limiter, err := client.New(client.Config{BaseURL: "http://rate-limiter:8080"})
+//	handler = limiter.Middleware(client.KeyByHeader("X-API-Key"))(handler)
+//
+// Denials are cached locally until the limiter says the key may retry, so a
+// throttled caller doesn't cost a round trip per request.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTimeout      = 2 * time.Second
+	DefaultMaxRetries   = 2
+	DefaultRetryBackoff = 50 * time.Millisecond
+	// DefaultNegativeCacheTTL bounds how long a denial is cached when the
+	// limiter gives no Retry-After.
+	DefaultNegativeCacheTTL = time.Second
+	DefaultNegativeCacheMax = 10000
+
+	clientIDHeader  = "X-Client-ID"
+	namespaceHeader = "X-RateLimit-Namespace"
+)
+
+var ErrInvalidConfig = errors.New("invalid rate limiter client config")
+
+type Config struct {
+	// BaseURL of the rate limiter, e.g. "http://rate-limiter:8080".
+	BaseURL string
+	// Namespace is sent with every check when set.
+	Namespace string
+	// Timeout bounds each attempt; DefaultTimeout when zero.
+	Timeout time.Duration
+	// MaxRetries is how often a check that failed before it was sent, e.g.
+	// when the connection was refused, is retried; DefaultMaxRetries when
+	// zero, none when negative. Checks the limiter may have counted are not
+	// retried, so a failure never charges a key twice.
+	MaxRetries int
+	// RetryBackoff is the first retry delay, doubled with jitter after each
+	// attempt; DefaultRetryBackoff when zero.
+	RetryBackoff time.Duration
+	// NegativeCacheTTL caps how long a denial is served from memory;
+	// DefaultNegativeCacheTTL when zero, no caching when negative.
+	NegativeCacheTTL time.Duration
+	// NegativeCacheMax bounds the cached denials; DefaultNegativeCacheMax
+	// when zero.
+	NegativeCacheMax int
+	// FailOpen allows requests when the limiter can't be reached instead of
+	// returning the error.
+	FailOpen bool
+	// HTTPClient sends the checks; a client with Timeout when nil.
+	HTTPClient *http.Client
+}
+
+// Decision is the limiter's answer for one request.
+type Decision struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	ResetAt   time.Time
+	// RetryAfter is set on denials when the limiter knows when the key may
+	// try again.
+	RetryAfter time.Duration
+	// Cached is true when the denial was served from the negative cache.
+	Cached bool
+	// FailedOpen is true when the limiter couldn't be reached and FailOpen
+	// allowed the request.
+	FailedOpen bool
+}
+
+type Client struct {
+	baseURL      string
+	namespace    string
+	httpClient   *http.Client
+	maxRetries   int
+	retryBackoff time.Duration
+	cacheTTL     time.Duration
+	failOpen     bool
+	denials      *negativeCache
+	now          func() time.Time
+}
+
+func New(cfg Config) (*Client, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("%w: base URL is required", ErrInvalidConfig)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+	if cfg.NegativeCacheTTL == 0 {
+		cfg.NegativeCacheTTL = DefaultNegativeCacheTTL
+	}
+	if cfg.NegativeCacheMax <= 0 {
+		cfg.NegativeCacheMax = DefaultNegativeCacheMax
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: cfg.Timeout}
+	}
+
+	return &Client{
+		baseURL:      strings.TrimRight(cfg.BaseURL, "/"),
+		namespace:    cfg.Namespace,
+		httpClient:   cfg.HTTPClient,
+		maxRetries:   cfg.MaxRetries,
+		retryBackoff: cfg.RetryBackoff,
+		cacheTTL:     cfg.NegativeCacheTTL,
+		failOpen:     cfg.FailOpen,
+		denials:      newNegativeCache(cfg.NegativeCacheMax),
+		now:          time.Now,
+	}, nil
+}
+
+// Allow consumes one request for key.
+func (c *Client) Allow(ctx context.Context, key string) (Decision, error) {
+	now := c.now()
+	if decision, ok := c.denials.get(key, now); ok {
+		return decision, nil
+	}
+
+	decision, err := c.check(ctx, key)
+	if err != nil {
+		if c.failOpen && ctx.Err() == nil {
+			return Decision{Allowed: true, FailedOpen: true}, nil
+		}
+		return Decision{}, err
+	}
+
+	if !decision.Allowed && c.cacheTTL > 0 {
+		ttl := c.cacheTTL
+		if decision.RetryAfter > 0 && decision.RetryAfter < ttl {
+			ttl = decision.RetryAfter
+		}
+		c.denials.put(key, decision, now, now.Add(ttl))
+	}
+	return decision, nil
+}
+
+func (c *Client) check(ctx context.Context, key string) (Decision, error) {
+	backoff := c.retryBackoff
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+			select {
+			case <-ctx.Done():
+				return Decision{}, ctx.Err()
+			case <-time.After(delay):
+			}
+			backoff *= 2
+		}
+
+		decision, retry, err := c.checkOnce(ctx, key)
+		if err == nil {
+			return decision, nil
+		}
+		lastErr = err
+		if !retry || ctx.Err() != nil {
+			break
+		}
+	}
+	return Decision{}, lastErr
+}
+
+// checkOnce reports whether a failed attempt may be retried: only when the
+// request was never written, since POST /rate-limit charges the key.
+func (c *Client) checkOnce(ctx context.Context, key string) (Decision, bool, error) {
+	var sent bool
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) { sent = true },
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/rate-limit", nil)
+	if err != nil {
+		return Decision{}, false, err
+	}
+	req.Header.Set(clientIDHeader, key)
+	if c.namespace != "" {
+		req.Header.Set(namespaceHeader, c.namespace)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Decision{}, !sent, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return c.decision(resp.Header, true), false, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return c.decision(resp.Header, false), false, nil
+	default:
+		return Decision{}, false, fmt.Errorf("rate limiter returned %d", resp.StatusCode)
+	}
+}
+
+func (c *Client) decision(header http.Header, allowed bool) Decision {
+	decision := Decision{
+		Allowed:   allowed,
+		Limit:     headerInt(header, "RateLimit-Limit"),
+		Remaining: headerInt(header, "RateLimit-Remaining"),
+	}
+	if reset := header.Get("RateLimit-Reset"); reset != "" {
+		decision.ResetAt = c.now().Add(time.Duration(headerInt(header, "RateLimit-Reset")) * time.Second)
+	}
+	if retryAfter := header.Get("Retry-After"); !allowed && retryAfter != "" {
+		decision.RetryAfter = c.parseRetryAfter(retryAfter)
+	}
+	return decision
+}
+
+// parseRetryAfter reads delay-seconds or an HTTP-date, the two forms RFC 9110
+// allows.
+func (c *Client) parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(max(0, seconds)) * time.Second
+	}
+	if retryAt, err := http.ParseTime(value); err == nil {
+		return max(0, retryAt.Sub(c.now()))
+	}
+	return 0
+}
+
+func headerInt(header http.Header, name string) int64 {
+	value, _ := strconv.ParseInt(header.Get(name), 10, 64)
+	return value
+}
@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLimiter answers checks with the statuses in order, repeating the last.
+func fakeLimiter(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rate-limit", r.URL.Path)
+		assert.Equal(t, "customer-1", r.Header.Get("X-Client-ID"))
+
+		call := int(calls.Add(1)) - 1
+		status := statuses[min(call, len(statuses)-1)]
+		w.Header().Set("RateLimit-Limit", "10")
+		w.Header().Set("RateLimit-Remaining", "0")
+		w.Header().Set("RateLimit-Reset", "30")
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "30")
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestClient_Allow(t *testing.T) {
+	server, _ := fakeLimiter(t, http.StatusOK)
+	client, err := New(Config{BaseURL: server.URL})
+	require.NoError(t, err)
+
+	decision, err := client.Allow(context.Background(), "customer-1")
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, int64(10), decision.Limit)
+	assert.WithinDuration(t, time.Now().Add(30*time.Second), decision.ResetAt, time.Second)
+
+	_, err = New(Config{})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestClient_NegativeCache(t *testing.T) {
+	server, calls := fakeLimiter(t, http.StatusTooManyRequests)
+	client, err := New(Config{BaseURL: server.URL, NegativeCacheTTL: time.Minute})
+	require.NoError(t, err)
+	now := time.Unix(1_700_000_000, 0)
+	client.now = func() time.Time { return now }
+
+	decision, err := client.Allow(context.Background(), "customer-1")
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 30*time.Second, decision.RetryAfter)
+
+	now = now.Add(10 * time.Second)
+	decision, err = client.Allow(context.Background(), "customer-1")
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.True(t, decision.Cached)
+	assert.Equal(t, 20*time.Second, decision.RetryAfter)
+	assert.Equal(t, int64(1), calls.Load(), "cached denials skip the limiter")
+
+	now = now.Add(20 * time.Second)
+	_, err = client.Allow(context.Background(), "customer-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), calls.Load(), "the limiter is asked again once the key may retry")
+}
+
+func TestClient_ParseRetryAfter(t *testing.T) {
+	client, err := New(Config{BaseURL: "http://rate-limiter"})
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 21, 7, 28, 0, 0, time.UTC)
+	client.now = func() time.Time { return now }
+
+	assert.Equal(t, 30*time.Second, client.parseRetryAfter("30"))
+	assert.Equal(t, 90*time.Second, client.parseRetryAfter("Wed, 21 Oct 2026 07:29:30 GMT"))
+	assert.Zero(t, client.parseRetryAfter("Wed, 21 Oct 2026 07:00:00 GMT"), "dates in the past mean now")
+	assert.Zero(t, client.parseRetryAfter("soon"))
+}
+
+// failingTransport fails its first round trips, as many as fails, without
+// sending them.
+type failingTransport struct {
+	fails int
+}
+
+func (f *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if f.fails > 0 {
+		f.fails--
+		return nil, errors.New("connection refused")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClient_Retries(t *testing.T) {
+	server, calls := fakeLimiter(t, http.StatusOK)
+	client, err := New(Config{
+		BaseURL:      server.URL,
+		RetryBackoff: time.Millisecond,
+		HTTPClient:   &http.Client{Transport: &failingTransport{fails: 2}},
+	})
+	require.NoError(t, err)
+
+	decision, err := client.Allow(context.Background(), "customer-1")
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, int64(1), calls.Load(), "checks that were never sent are retried")
+
+	server, calls = fakeLimiter(t, http.StatusInternalServerError, http.StatusOK)
+	client, err = New(Config{BaseURL: server.URL, RetryBackoff: time.Millisecond})
+	require.NoError(t, err)
+	_, err = client.Allow(context.Background(), "customer-1")
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), calls.Load(), "a check the limiter may have counted is not retried")
+
+	server, calls = fakeLimiter(t, http.StatusBadRequest)
+	client, err = New(Config{BaseURL: server.URL, RetryBackoff: time.Millisecond})
+	require.NoError(t, err)
+	_, err = client.Allow(context.Background(), "customer-1")
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), calls.Load(), "client errors are not retried")
+}
+
+func TestClient_FailOpen(t *testing.T) {
+	server, _ := fakeLimiter(t, http.StatusServiceUnavailable)
+	client, err := New(Config{BaseURL: server.URL, MaxRetries: -1})
+	require.NoError(t, err)
+	_, err = client.Allow(context.Background(), "customer-1")
+	assert.Error(t, err)
+
+	client, err = New(Config{BaseURL: server.URL, MaxRetries: -1, FailOpen: true})
+	require.NoError(t, err)
+	decision, err := client.Allow(context.Background(), "customer-1")
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.True(t, decision.FailedOpen)
+}
+
+func TestClient_Middleware(t *testing.T) {
+	server, _ := fakeLimiter(t, http.StatusOK, http.StatusTooManyRequests)
+	client, err := New(Config{BaseURL: server.URL})
+	require.NoError(t, err)
+
+	handler := client.Middleware(KeyByHeader("X-API-Key"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("customer-1")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "10", w.Header().Get("RateLimit-Limit"))
+
+	w = serve("customer-1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusNoContent, serve("").Code, "requests without a key are not checked")
+}
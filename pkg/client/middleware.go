@@ -0,0 +1,69 @@
+package client
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// KeyFunc picks the rate limit key of a request. An empty key skips the
+// check.
+type KeyFunc func(r *http.Request) string
+
+// KeyByHeader keys requests by a header such as an API key.
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// KeyByRemoteIP keys requests by the peer address. Behind a proxy, key by the
+// header it sets instead.
+func KeyByRemoteIP() KeyFunc {
+	return func(r *http.Request) string {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+}
+
+// Middleware checks every request with the limiter and answers denied ones
+// with 429 and Retry-After. Requests are answered with 503 when the limiter
+// fails and FailOpen is off.
+func (c *Client) Middleware(key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestKey := key(r)
+			if requestKey == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			decision, err := c.Allow(r.Context(), requestKey)
+			if err != nil {
+				slog.Error("rate limit check failed", "error", err.Error())
+				http.Error(w, "rate limiter unavailable", http.StatusServiceUnavailable)
+				return
+			}
+
+			if !decision.FailedOpen {
+				w.Header().Set("RateLimit-Limit", strconv.FormatInt(decision.Limit, 10))
+				w.Header().Set("RateLimit-Remaining", strconv.FormatInt(decision.Remaining, 10))
+			}
+			if !decision.Allowed {
+				if decision.RetryAfter > 0 {
+					// Round up so clients don't retry a moment too early.
+					w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(decision.RetryAfter.Seconds())), 10))
+				}
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
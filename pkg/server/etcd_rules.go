@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/pmujumdar27/go-rate-limiter/internal/middleware"
+	"github.com/pmujumdar27/go-rate-limiter/internal/rules"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const rulesCommandUsage = "usage: server [push-rules | rollback-rules <version> | rules-history]"
+
+func newEtcdClient(cfg config.RulesEtcdConfig) (*clientv3.Client, error) {
+	return clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		DialTimeout: milliseconds(cfg.DialTimeoutMs),
+	})
+}
+
+// setupEtcdRules connects to etcd and returns the rule set in force there,
+// or the configured rules when none has been pushed yet.
+func (s *Server) setupEtcdRules() ([]config.RuleConfig, error) {
+	client, err := newEtcdClient(s.config.Rules.Etcd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to etcd: %w", err)
+	}
+	s.etcdClient = client
+	s.ruleStore = rules.NewEtcdStore(client, s.config.Rules.Etcd.Prefix)
+
+	ctx, cancel := context.WithTimeout(s.backgroundCtx, milliseconds(s.config.Rules.Etcd.DialTimeoutMs))
+	defer cancel()
+
+	set, revision, err := s.ruleStore.Current(ctx)
+	s.rulesRevision = revision
+	if errors.Is(err, rules.ErrNoRuleSet) {
+		slog.Warn("no rule set in etcd yet, using the configured rules")
+		return s.config.Rules.Rules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("loaded rules from etcd", "version", set.Version, "rules", len(set.Rules))
+	return set.Rules, nil
+}
+
+// watchEtcdRules swaps the rules ruleSet matches against whenever a new rule
+// set is made current in etcd. A rule set that fails to build is logged and
+// the rules in force are kept.
+func (s *Server) watchEtcdRules(ruleSet *middleware.RuleSet) {
+	if s.ruleStore == nil {
+		return
+	}
+
+	registered := make(map[string]bool)
+	for _, rule := range ruleSet.Engine().Rules() {
+		if rule.Policy != nil {
+			registered[rule.Name] = true
+		}
+	}
+
+	s.ruleStore.Watch(s.backgroundCtx, s.rulesRevision, func(set rules.RuleSet) {
+		s.reloadMu.Lock()
+		engine, policies, err := s.buildRules(set.Rules)
+		s.reloadMu.Unlock()
+		if err != nil {
+			slog.Error("rejected rule set from etcd", "version", set.Version, "error", err)
+			return
+		}
+
+		current := make(map[string]bool, len(policies))
+		for _, policy := range policies {
+			s.policies.Register(policy)
+			current[policy.Name()] = true
+		}
+		ruleSet.Update(engine)
+		for name := range registered {
+			if !current[name] {
+				s.policies.Unregister(name)
+			}
+		}
+		registered = current
+
+		slog.Info("applied rules from etcd", "version", set.Version, "rules", len(set.Rules))
+	})
+}
+
+// RunRulesCommand runs one of the commands that manage the rule sets in etcd
+// instead of starting the server.
+func RunRulesCommand(cfg *config.Config, args []string) error {
+	if !cfg.Rules.Etcd.Enabled {
+		return errors.New("rules.etcd.enabled must be set to manage rules in etcd")
+	}
+
+	client, err := newEtcdClient(cfg.Rules.Etcd)
+	if err != nil {
+		return fmt.Errorf("failed to connect to etcd: %w", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	store := rules.NewEtcdStore(client, cfg.Rules.Etcd.Prefix)
+
+	switch args[0] {
+	case "push-rules":
+		// Bootstraps etcd from the rules in the configuration file.
+		set, err := store.Put(ctx, cfg.Rules.Rules)
+		if err != nil {
+			return err
+		}
+		log.Printf("Pushed %d rules as version %d", len(set.Rules), set.Version)
+	case "rollback-rules":
+		if len(args) != 2 {
+			return errors.New(rulesCommandUsage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		set, err := store.Rollback(ctx, version)
+		if err != nil {
+			return err
+		}
+		log.Printf("Rolled back to the rules of version %d as version %d", version, set.Version)
+	case "rules-history":
+		history, err := store.History(ctx)
+		if err != nil {
+			return err
+		}
+		for _, set := range history {
+			fmt.Printf("%d\t%s\t%d rules\n", set.Version, set.UpdatedAt.Format(time.RFC3339), len(set.Rules))
+		}
+	default:
+		return errors.New(rulesCommandUsage)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Package server is the rate limiter service behind cmd/server, for running
+// it from Go: embedded into an existing Gin app, or started in tests without
+// the CLI entrypoint.
+//
+//	cfg, err := server.LoadConfig()
+//	srv, err := server.NewServer(cfg, server.WithRouter(app), server.WithRedisClient(rdb))
+//	defer srv.Shutdown(ctx)
+//
+// NewServer registers the rate limiter's middleware and routes on the
+// router. Run serves them until SIGINT or SIGTERM; an app serving the router
+// itself calls Shutdown instead when it stops.
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// Config is the server's configuration, as loaded from config/config.yaml,
+// .env and GO_ environment variables.
+type Config = config.Config
+
+// StrategyManager builds the rate limiters of the configured strategies.
+type StrategyManager = ratelimit.StrategyManager
+
+// LoadConfig loads and validates the configuration the way cmd/server does.
+func LoadConfig() (*Config, error) {
+	return config.Load()
+}
+
+// Option replaces a dependency NewServer would otherwise build from the
+// config.
+type Option func(*options)
+
+type options struct {
+	router          *gin.Engine
+	redisClient     *redis.Client
+	strategyManager StrategyManager
+}
+
+// WithRouter registers the server's middleware and routes on router instead
+// of a new gin.Default engine. The middleware applies to the router's other
+// routes too.
+func WithRouter(router *gin.Engine) Option {
+	return func(o *options) {
+		o.router = router
+	}
+}
+
+// WithRedisClient uses client instead of connecting to the configured Redis.
+// The server still loads its scripts there, and leaves closing it to the
+// caller.
+func WithRedisClient(client *redis.Client) Option {
+	return func(o *options) {
+		o.redisClient = client
+	}
+}
+
+// WithStrategyManager builds the rate limiters with manager instead of one
+// for rate_limiter in the config. A server with an injected manager can't
+// switch it by reloading the config.
+func WithStrategyManager(manager StrategyManager) Option {
+	return func(o *options) {
+		o.strategyManager = manager
+	}
+}
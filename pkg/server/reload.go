@@ -0,0 +1,123 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+)
+
+// reloadable are the settings a reload applies. Other settings are wired
+// into middleware, clients and background work at startup and need a
+// restart.
+var reloadable = []string{
+	"rate_limiter.strategy",
+	"rate_limiter.strategies.",
+	"rate_limiter.evaluation.",
+	"rate_limiter.experiment.",
+}
+
+func isReloadable(path string) bool {
+	for _, prefix := range reloadable {
+		if path == prefix || (strings.HasSuffix(prefix, ".") && strings.HasPrefix(path, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchReloads reloads the config on every SIGHUP until the server stops.
+func (s *Server) watchReloads() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-hup:
+				if err := s.reload(); err != nil {
+					log.Printf("Config reload failed, keeping the running config: %v", err)
+				}
+			case <-s.backgroundCtx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// reload loads and validates the config again and logs what changed. When
+// the strategy, strategy limits, evaluation or experiment changed, it swaps
+// in a strategy manager built from the new settings and rebuilds the default
+// policy's limiter with it, as a strategy switch does, and is refused the
+// same way when the new limiter can't serve what the middleware uses. Rules,
+// classes and named limiters keep the limiters they were built with.
+func (s *Server) reload() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	current := *s.config
+	current.RateLimiter = *s.rateLimiterConfig
+	changes := config.Diff(&current, cfg)
+	if len(changes) == 0 {
+		log.Println("Config reloaded: nothing changed")
+		return nil
+	}
+
+	apply := false
+	for _, change := range changes {
+		if isReloadable(change.Path) {
+			apply = true
+			log.Printf("Config reloaded: %s", change)
+		} else {
+			log.Printf("Config reloaded: %s (needs a restart)", change)
+		}
+	}
+	if !apply {
+		return nil
+	}
+	if s.config.Regions.Enabled || s.config.RateLimiter.GeoIP.Enabled {
+		return ratelimit.ErrStrategySwitchNotSupported
+	}
+	if s.injected.strategyManager != nil {
+		return errors.New("the strategy manager was injected and isn't rebuilt from the config")
+	}
+	policy, ok := s.policies.Get(ratelimit.DefaultPolicyName)
+	if !ok {
+		return fmt.Errorf("policy %s is not registered", ratelimit.DefaultPolicyName)
+	}
+
+	rateLimiterConfig := *s.rateLimiterConfig
+	rateLimiterConfig.Strategy = cfg.RateLimiter.Strategy
+	rateLimiterConfig.Strategies = cfg.RateLimiter.Strategies
+	rateLimiterConfig.Evaluation = cfg.RateLimiter.Evaluation
+	rateLimiterConfig.Experiment = cfg.RateLimiter.Experiment
+	manager, err := s.newStrategyManager(&rateLimiterConfig)
+	if err != nil {
+		return err
+	}
+
+	previousManager, previousConfig := s.strategyManager, s.rateLimiterConfig
+	s.strategyManager, s.rateLimiterConfig = manager, &rateLimiterConfig
+	rateLimiter, err := s.defaultLimiter()
+	if err == nil {
+		err = ratelimit.CheckCapabilities(policy, rateLimiter)
+	}
+	if err != nil {
+		s.strategyManager, s.rateLimiterConfig = previousManager, previousConfig
+		return err
+	}
+	policy.SetRateLimiter(rateLimiter)
+	log.Printf("Swapped policy %s to strategy %s", policy.Name(), manager.CurrentStrategy())
+	return nil
+}
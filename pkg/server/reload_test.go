@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsReloadable(t *testing.T) {
+	for path, want := range map[string]bool{
+		"rate_limiter.strategy":                            true,
+		"rate_limiter.strategies.token_bucket.bucket_size": true,
+		"rate_limiter.evaluation.enabled":                  true,
+		"rate_limiter.experiment.percentage":               true,
+		"rate_limiter.strategy_header":                     false,
+		"rate_limiter.strategies":                          false,
+		"rate_limiter.max_wait_ms":                         false,
+		"server.port":                                      false,
+	} {
+		assert.Equal(t, want, isReloadable(path), path)
+	}
+}
+
+func TestReload(t *testing.T) {
+	t.Setenv("GO_RATE_LIMITER_STRATEGY", "sliding_window_counter")
+	srv := newTestServer(t, nil)
+	policy, ok := srv.policies.Get(ratelimit.DefaultPolicyName)
+	require.True(t, ok)
+
+	require.NoError(t, srv.reload(), "a reload without reloadable changes keeps the running limiter")
+	assert.Equal(t, "sliding_window_counter", srv.strategyManager.CurrentStrategy())
+
+	t.Setenv("GO_RATE_LIMITER_STRATEGY", "token_bucket")
+	require.NoError(t, srv.reload())
+	assert.Equal(t, "token_bucket", srv.strategyManager.CurrentStrategy())
+	assert.Equal(t, "token_bucket", srv.rateLimiterConfig.Strategy)
+	assert.True(t, ratelimit.SupportsReserve(policy), "the policy runs the new strategy")
+
+	t.Setenv("GO_RATE_LIMITER_STRATEGY", "sliding_window_counter")
+	assert.ErrorIs(t, srv.reload(), ratelimit.ErrCapabilityLost)
+	assert.Equal(t, "token_bucket", srv.strategyManager.CurrentStrategy(), "a refused reload keeps the running config")
+	assert.Equal(t, "token_bucket", srv.rateLimiterConfig.Strategy)
+	assert.True(t, ratelimit.SupportsReserve(policy))
+
+	t.Setenv("GO_RATE_LIMITER_STRATEGY", "no_such_strategy")
+	assert.Error(t, srv.reload(), "an invalid config is rejected")
+	assert.Equal(t, "token_bucket", srv.strategyManager.CurrentStrategy())
+}
@@ -0,0 +1,1981 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/pmujumdar27/go-rate-limiter/internal/events"
+	"github.com/pmujumdar27/go-rate-limiter/internal/handlers"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/pmujumdar27/go-rate-limiter/internal/middleware"
+	"github.com/pmujumdar27/go-rate-limiter/internal/notify"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/pmujumdar27/go-rate-limiter/internal/rules"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/text/language"
+)
+
+type Server struct {
+	config        *config.Config
+	redisClient   *redis.Client
+	readClient    *redis.Client
+	regionPeers   map[string]*redis.Client
+	postgresPool  *pgxpool.Pool
+	postgresStore *ratelimit.PostgresStore
+	etcdClient    *clientv3.Client
+	ruleStore     *rules.EtcdStore
+	rulesRevision int64
+	collectors    *metrics.Registry
+
+	// reloadMu guards strategyManager and rateLimiterConfig, the rate
+	// limiter settings in force, which a reload replaces, and the strategy
+	// switches and rule rebuilds using them.
+	reloadMu          sync.Mutex
+	strategyManager   ratelimit.StrategyManager
+	rateLimiterConfig *config.RateLimiterConfig
+
+	policies       *ratelimit.PolicyRegistry
+	penalties      *ratelimit.PenaltyBox
+	quarantine     *ratelimit.Quarantine
+	asyncAccounts  *ratelimit.AsyncAccounting
+	notifier       notify.Notifier
+	decisions      *events.Stream
+	decisionTail   *events.Tail
+	stopTails      context.CancelFunc
+	topKeys        *ratelimit.TopKeys
+	keyUsage       *ratelimit.KeyUsage
+	stateTransfer  *ratelimit.StateTransfer
+	keyMigration   *ratelimit.KeyMigration
+	leader         *ratelimit.LeaderElection
+	housekeeping   *ratelimit.Housekeeping
+	stopDecisions  context.CancelFunc
+	auditLog       *ratelimit.AuditLog
+	auditFile      *ratelimit.RotatingFile
+	geoLookup      *ratelimit.MaxMindGeoLookup
+	router         *gin.Engine
+	httpServer     *http.Server
+	readiness      *handlers.Readiness
+	backgroundCtx  context.Context
+	stopBackground context.CancelFunc
+	injected       options
+}
+
+// NewServer connects to the configured backends and sets up the routes,
+// with opts replacing the dependencies the caller provides.
+func NewServer(cfg *config.Config, opts ...Option) (*Server, error) {
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	server := &Server{
+		config:         cfg,
+		backgroundCtx:  backgroundCtx,
+		stopBackground: stopBackground,
+	}
+	for _, opt := range opts {
+		opt(&server.injected)
+	}
+
+	if err := server.setup(); err != nil {
+		// The leader election and background workers may already be running,
+		// and the connections open.
+		server.stopBackground()
+		if server.stopDecisions != nil {
+			server.stopDecisions()
+		}
+		server.closeConnections()
+		return nil, err
+	}
+	return server, nil
+}
+
+func (s *Server) setup() error {
+	if err := s.setupMetrics(); err != nil {
+		return fmt.Errorf("failed to setup metrics: %w", err)
+	}
+
+	if err := s.setupRedis(); err != nil {
+		return fmt.Errorf("failed to setup redis: %w", err)
+	}
+
+	if err := s.setupHousekeeping(); err != nil {
+		return fmt.Errorf("failed to setup housekeeping: %w", err)
+	}
+
+	if err := s.setupStrategyManager(); err != nil {
+		return fmt.Errorf("failed to setup strategy manager: %w", err)
+	}
+
+	return s.setupRoutes()
+}
+
+func (s *Server) setupMetrics() error {
+	observability := s.config.Observability
+
+	collectors := make(map[string]metrics.Collector)
+	var prometheusCollector metrics.Collector
+	for name, collectorConfig := range observability.Collectors {
+		switch collectorConfig.Type {
+		case "prometheus":
+			if prometheusCollector == nil {
+				prometheusCollector = metrics.NewPrometheusCollector()
+			}
+			collectors[name] = prometheusCollector
+		case "statsd":
+			collector, err := metrics.NewStatsdCollector(collectorConfig.Address, collectorConfig.Prefix)
+			if err != nil {
+				metrics.CloseCollectors(collectors)
+				return err
+			}
+			collectors[name] = collector
+		case "noop":
+			collectors[name] = metrics.NewNoopCollector()
+		default:
+			metrics.CloseCollectors(collectors)
+			return fmt.Errorf("collector %s: unknown type %q", name, collectorConfig.Type)
+		}
+	}
+
+	defaultCollector, exists := collectors[observability.DefaultCollector]
+	if !exists {
+		metrics.CloseCollectors(collectors)
+		return fmt.Errorf("default collector %q is not configured", observability.DefaultCollector)
+	}
+
+	s.collectors = metrics.NewRegistry(observability.DefaultCollector, defaultCollector)
+	for name, collector := range collectors {
+		s.collectors.Register(name, collector)
+	}
+
+	for policy, collectorName := range observability.PolicyCollectors {
+		if err := s.collectors.Assign(policy, collectorName); err != nil {
+			return fmt.Errorf("policy %s: %w", policy, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) setupRedis() error {
+	if s.injected.redisClient != nil {
+		s.redisClient = s.injected.redisClient
+	} else {
+		options, err := redisOptions(s.config.Redis)
+		if err != nil {
+			return err
+		}
+		client := redis.NewClient(options)
+		if err := metrics.RegisterRedisPoolMetrics(prometheus.DefaultRegisterer, "main", client); err != nil {
+			client.Close()
+			return err
+		}
+		s.redisClient = client
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.redisClient.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	capabilities, err := ratelimit.DetectRedisCapabilities(ctx, s.redisClient)
+	if err != nil {
+		return err
+	}
+	log.Printf("Connected to %s", capabilities)
+	if err := capabilities.Check(s.config.Redis.Functions); err != nil {
+		return fmt.Errorf("unsupported Redis: %w", err)
+	}
+
+	if err := s.setupReplica(ctx); err != nil {
+		return err
+	}
+
+	if s.config.Redis.Functions {
+		if err := ratelimit.LoadFunctions(ctx, s.redisClient); err != nil {
+			return fmt.Errorf("failed to load Redis functions: %w", err)
+		}
+		log.Printf("Running rate limit scripts as Redis functions from library %s", ratelimit.FunctionLibrary())
+		return nil
+	}
+
+	if err := ratelimit.LoadScripts(ctx, s.redisClient); err != nil {
+		return fmt.Errorf("failed to load Lua scripts: %w", err)
+	}
+
+	return nil
+}
+
+// setupHousekeeping elects the instance that runs background jobs over
+// shared state, unless every instance is to run them.
+func (s *Server) setupHousekeeping() error {
+	cfg := s.config.Housekeeping
+	if !cfg.LeaderElection {
+		s.housekeeping = ratelimit.NewHousekeeping(nil)
+		return nil
+	}
+
+	leader, err := ratelimit.NewLeaderElection(s.redisClient, cfg.LeaseKey, time.Duration(cfg.LeaseTTLSeconds)*time.Second)
+	if err != nil {
+		return err
+	}
+	leader.Start(s.backgroundCtx)
+	s.leader = leader
+	s.housekeeping = ratelimit.NewHousekeeping(leader)
+	log.Printf("Running housekeeping on the leader of %s as %s", cfg.LeaseKey, leader.ID())
+	return nil
+}
+
+// setupReplica connects the client read-only operations go to. Without a
+// replica, it is the primary's client.
+func (s *Server) setupReplica(ctx context.Context) error {
+	s.readClient = s.redisClient
+	replica := s.config.Redis.Replica
+	if !replica.Enabled {
+		return nil
+	}
+
+	replicaConfig := s.config.Redis
+	replicaConfig.Host, replicaConfig.Port = replica.Host, replica.Port
+	options, err := redisOptions(replicaConfig)
+	if err != nil {
+		return err
+	}
+	client := redis.NewClient(options)
+	if err := metrics.RegisterRedisPoolMetrics(prometheus.DefaultRegisterer, "replica", client); err != nil {
+		client.Close()
+		return err
+	}
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return fmt.Errorf("failed to connect to the Redis replica: %w", err)
+	}
+	s.readClient = client
+
+	capabilities, err := ratelimit.DetectRedisCapabilities(ctx, client)
+	if err != nil {
+		return err
+	}
+	if !capabilities.Replica {
+		log.Printf("Redis replica %s:%d is not a replica; reads are sent to it anyway", replica.Host, replica.Port)
+	}
+	log.Printf("Reading from replica %s", capabilities)
+	return nil
+}
+
+// setupPostgres connects to the postgres backend, creates its tables and
+// starts purging the rows of idle keys.
+func (s *Server) setupPostgres() (*ratelimit.PostgresStore, error) {
+	poolConfig, err := pgxpool.ParseConfig(s.config.Postgres.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dsn: %w", err)
+	}
+	if s.config.Postgres.MaxConns > 0 {
+		poolConfig.MaxConns = s.config.Postgres.MaxConns
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to Postgres: %w", err)
+	}
+	s.postgresPool = pool
+
+	store := ratelimit.NewPostgresStore(pool)
+	if err := store.CreateSchema(ctx); err != nil {
+		return nil, err
+	}
+	store.StartPurge(s.backgroundCtx, s.housekeeping, time.Duration(s.config.Postgres.PurgeIntervalSeconds)*time.Second)
+	return store, nil
+}
+
+func redisOptions(cfg config.RedisConfig) (*redis.Options, error) {
+	tlsConfig, err := redisTLSConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("redis %s: %w", cfg.Host, err)
+	}
+
+	return &redis.Options{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		MaxRetries:   cfg.MaxRetries,
+		DialTimeout:  milliseconds(cfg.DialTimeoutMs),
+		ReadTimeout:  milliseconds(cfg.ReadTimeoutMs),
+		WriteTimeout: milliseconds(cfg.WriteTimeoutMs),
+		PoolTimeout:  milliseconds(cfg.PoolTimeoutMs),
+		TLSConfig:    tlsConfig,
+	}, nil
+}
+
+func redisTLSConfig(cfg config.RedisConfig) (*tls.Config, error) {
+	if !cfg.TLS.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLS.ServerName,
+		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = cfg.Host
+	}
+
+	if cfg.TLS.CAFile != "" {
+		caPEM, err := os.ReadFile(cfg.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.TLS.CAFile)
+		}
+	}
+
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		return nil, fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+	if cfg.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// milliseconds keeps -1, which go-redis reads as no timeout.
+func milliseconds(ms int) time.Duration {
+	if ms < 0 {
+		return -1
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func (s *Server) setupStrategyManager() error {
+	if err := ratelimit.LoadPlugins(s.config.RateLimiter.Plugins); err != nil {
+		return err
+	}
+
+	if s.config.RateLimiter.Backend == "postgres" {
+		store, err := s.setupPostgres()
+		if err != nil {
+			return fmt.Errorf("failed to setup postgres: %w", err)
+		}
+		s.postgresStore = store
+	}
+
+	if err := s.setupDecisionStream(); err != nil {
+		return fmt.Errorf("failed to setup decision stream: %w", err)
+	}
+	s.decisionTail = events.NewTail()
+
+	if topKeysConfig := s.config.Analytics.TopKeys; topKeysConfig.Enabled {
+		topKeys, err := ratelimit.NewTopKeys(s.redisClient, ratelimit.TopKeysConfig{
+			Window:     time.Duration(topKeysConfig.WindowSeconds) * time.Second,
+			Resolution: time.Duration(topKeysConfig.ResolutionSeconds) * time.Second,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to setup top keys: %w", err)
+		}
+		s.topKeys = topKeys
+	}
+
+	s.rateLimiterConfig = &s.config.RateLimiter
+	if s.injected.strategyManager != nil {
+		s.strategyManager = s.injected.strategyManager
+	} else {
+		manager, err := s.newStrategyManager(s.rateLimiterConfig)
+		if err != nil {
+			return err
+		}
+		s.strategyManager = manager
+	}
+	prefixes, _ := s.strategyManager.(keyPrefixer)
+
+	if s.config.RateLimiter.ActiveKeys.Enabled {
+		if prefixes == nil {
+			return errors.New("rate_limiter.active_keys needs a strategy manager reporting its key prefixes")
+		}
+		if _, _, err := s.activeKeyPattern(); err != nil {
+			return err
+		}
+
+		scanner := ratelimit.NewActiveKeysScanner(
+			s.readClient,
+			s.collectors.ForPolicy(ratelimit.DefaultPolicyName),
+			time.Duration(s.config.RateLimiter.ActiveKeys.ScanIntervalSeconds)*time.Second,
+			s.config.RateLimiter.ActiveKeys.ScanCount,
+		)
+		scanner.Follow(s.activeKeyPattern)
+		scanner.Start(s.backgroundCtx, s.housekeeping)
+	}
+
+	// Key usage, state transfer and key migration by name find no keys of a manager that doesn't
+	// report its prefixes.
+	keyPrefixes := map[string]string{}
+	if prefixes != nil {
+		keyPrefixes = prefixes.KeyPrefixes()
+	}
+	keyUsage := s.config.KeyUsage
+	s.keyUsage = ratelimit.NewKeyUsage(s.redisClient, keyPrefixes, keyUsage.ScanCount, keyUsage.SampleSize).
+		WithReadClient(s.readClient)
+	s.stateTransfer = ratelimit.NewStateTransfer(s.redisClient, keyPrefixes, keyUsage.ScanCount)
+	s.keyMigration = ratelimit.NewKeyMigration(s.redisClient, keyPrefixes, keyUsage.ScanCount, keyUsage.Migration.KeysPerSecond)
+	if keyUsage.Purge.Enabled {
+		s.keyUsage.StartPurge(s.backgroundCtx, s.housekeeping,
+			time.Duration(keyUsage.Purge.IntervalSeconds)*time.Second,
+			time.Duration(keyUsage.Purge.IdleSeconds)*time.Second)
+	}
+
+	return nil
+}
+
+// activeKeyPattern returns the current strategy of the default policy and
+// the SCAN pattern of its keys, which change with strategy switches and
+// reloads.
+func (s *Server) activeKeyPattern() (strategy, pattern string, err error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	prefixes, ok := s.strategyManager.(keyPrefixer)
+	if !ok {
+		return "", "", errors.New("the strategy manager doesn't report its key prefixes")
+	}
+	strategy = s.strategyManager.CurrentStrategy()
+	keyPrefix, ok := prefixes.KeyPrefixes()[strategy]
+	if !ok {
+		return "", "", fmt.Errorf("strategy %s has no key prefix", strategy)
+	}
+	return strategy, ratelimit.ActiveKeyPattern(strategy, keyPrefix), nil
+}
+
+// keyPrefixer is implemented by strategy managers that report the Redis key
+// prefixes of their strategies, as ConfigBasedStrategyManager does.
+type keyPrefixer interface {
+	CurrentKeyPrefix() (string, error)
+	KeyPrefixes() map[string]string
+}
+
+// newStrategyManager builds a strategy manager for cfg on the server's
+// backends, decision stream, clocks and analytics, and probes its
+// strategies.
+func (s *Server) newStrategyManager(cfg *config.RateLimiterConfig) (*ratelimit.ConfigBasedStrategyManager, error) {
+	manager := ratelimit.NewConfigBasedStrategyManager(cfg, s.redisClient, s.collectors).
+		WithBackgroundContext(s.backgroundCtx)
+	if s.readClient != s.redisClient {
+		manager.WithReadClient(s.readClient)
+	}
+	if s.postgresStore != nil {
+		manager.WithPostgres(s.postgresStore)
+	}
+
+	if s.decisions != nil {
+		manager.WithDecisionStream(events.Tee(s.decisions, s.decisionTail))
+	} else {
+		manager.WithDecisionStream(s.decisionTail)
+	}
+
+	if err := s.setupClocks(manager); err != nil {
+		return nil, fmt.Errorf("failed to setup clocks: %w", err)
+	}
+
+	if s.topKeys != nil {
+		manager.WithTopKeys(s.topKeys)
+	}
+	if keyStatsConfig := s.config.Analytics.KeyStats; keyStatsConfig.Enabled {
+		manager.WithKeyStats(time.Duration(keyStatsConfig.WindowSeconds) * time.Second)
+	}
+
+	// Fail now rather than with EVAL errors on every request.
+	probeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := manager.ProbeStrategies(probeCtx); err != nil {
+		return nil, fmt.Errorf("strategies failed their startup probe: %w", err)
+	}
+
+	return manager, nil
+}
+
+// setupClocks makes each strategy decide by its configured clock source.
+// Strategies on the same source share one clock, so a hybrid clock syncs
+// once for all of them.
+func (s *Server) setupClocks(manager *ratelimit.ConfigBasedStrategyManager) error {
+	cfg := s.config.RateLimiter.Clock
+	clocks := make(map[string]ratelimit.Clock)
+	for _, strategy := range manager.GetAvailableStrategies() {
+		source := cfg.Source
+		if override, ok := cfg.Strategies[strategy]; ok {
+			source = override
+		}
+
+		clock, ok := clocks[source]
+		if !ok {
+			var err error
+			clock, err = ratelimit.NewClock(source, s.redisClient,
+				time.Duration(cfg.SyncIntervalSeconds)*time.Second,
+				milliseconds(cfg.MaxRoundTripMs))
+			if err != nil {
+				return err
+			}
+			clocks[source] = clock
+		}
+		if clock != nil {
+			manager.WithClock(strategy, clock)
+		}
+	}
+	return nil
+}
+
+// setupDecisionStream publishes every decision for offline analysis. The
+// stream outlives the background context so decisions made while requests
+// drain at shutdown are still flushed.
+func (s *Server) setupDecisionStream() error {
+	cfg := s.config.DecisionStream
+	if !cfg.Enabled {
+		return nil
+	}
+
+	var publisher events.Publisher
+	switch cfg.Backend {
+	case "nats":
+		natsPublisher, err := events.NewNATSPublisher(cfg.Address, cfg.Subject)
+		if err != nil {
+			return err
+		}
+		publisher = natsPublisher
+	default:
+		return fmt.Errorf("unsupported decision stream backend: %s", cfg.Backend)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	s.decisions = events.NewStream(publisher, events.StreamConfig{
+		BatchSize:     cfg.BatchSize,
+		FlushInterval: time.Duration(cfg.FlushIntervalMs) * time.Millisecond,
+		BufferSize:    cfg.BufferSize,
+	})
+	s.stopDecisions = stop
+	s.decisions.Start(ctx)
+	return nil
+}
+
+func (s *Server) setupRoutes() error {
+	s.router = s.injected.router
+	if s.router == nil {
+		s.router = gin.Default()
+	}
+	s.readiness = handlers.NewReadiness()
+	s.router.Use(s.readiness.Track())
+	if err := middleware.ConfigureClientIP(s.router, middleware.ClientIPConfig{
+		TrustedProxies: s.config.Server.TrustedProxies,
+		Headers:        s.config.Server.ClientIPHeaders,
+	}); err != nil {
+		return fmt.Errorf("failed to configure client IP resolution: %w", err)
+	}
+	if aggregation := s.config.RateLimiter.IPAggregation; aggregation.Enabled {
+		ipAggregation, err := middleware.IPAggregation(middleware.IPAggregationConfig{
+			IPv4PrefixLength: aggregation.IPv4PrefixLength,
+			IPv6PrefixLength: aggregation.IPv6PrefixLength,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to configure IP aggregation: %w", err)
+		}
+		s.router.Use(ipAggregation)
+	}
+	s.router.Use(middleware.RequestID())
+	if header := s.config.RateLimiter.Strategies.Hierarchical.OrganizationHeader; header != "" {
+		s.router.Use(middleware.Organization(header))
+	}
+	if s.config.Server.ProblemJSON.Enabled {
+		s.router.Use(middleware.ProblemJSON(s.config.Server.ProblemJSON.TypeBaseURL))
+	}
+	if s.config.Server.Localization.Enabled {
+		s.router.Use(middleware.Localize(s.messageCatalog()))
+	}
+	s.router.Use(middleware.RetryAfterFormat(s.config.Server.RetryAfterFormat))
+	s.router.Use(middleware.BodyLimit(middleware.BodyLimitConfig{
+		MaxBytes:     s.config.Server.MaxBodyBytes,
+		MaxJSONDepth: s.config.Server.MaxJSONDepth,
+	}))
+	if err := s.setupHandlers(); err != nil {
+		return err
+	}
+	return s.setupHTTPServer()
+}
+
+func (s *Server) setupHandlers() error {
+	rateLimiter, err := s.setupRegions()
+	if err != nil {
+		return fmt.Errorf("failed to get rate limiter from strategy manager: %w", err)
+	}
+
+	rateLimiter, err = s.setupGeoIP(rateLimiter)
+	if err != nil {
+		return fmt.Errorf("failed to setup geoip rules: %w", err)
+	}
+
+	rateLimiter, err = s.setupExperiment(rateLimiter)
+	if err != nil {
+		return fmt.Errorf("failed to setup strategy experiment: %w", err)
+	}
+
+	rateLimiter, err = s.setupEvaluation(rateLimiter)
+	if err != nil {
+		return fmt.Errorf("failed to setup strategy evaluation: %w", err)
+	}
+
+	s.penalties, err = s.setupPenalties()
+	if err != nil {
+		return fmt.Errorf("failed to setup penalties: %w", err)
+	}
+	s.notifier, err = s.setupNotifier()
+	if err != nil {
+		return fmt.Errorf("failed to setup notifications: %w", err)
+	}
+	s.setupQuarantine()
+	s.setupAsyncAccounting()
+	rateLimiter, err = s.withAsyncAccounting(s.withLatencyBudget(s.withQuarantine(rateLimiter)))
+	if err != nil {
+		return fmt.Errorf("failed to setup async accounting: %w", err)
+	}
+
+	defaultPolicy := s.newPolicy(ratelimit.DefaultPolicyName, rateLimiter)
+	s.policies = ratelimit.NewPolicyRegistry()
+	s.policies.Register(defaultPolicy)
+
+	denialLog, err := s.setupDenialLog()
+	if err != nil {
+		return fmt.Errorf("failed to setup denial log: %w", err)
+	}
+
+	auditLog, err := s.setupAuditLog()
+	if err != nil {
+		return fmt.Errorf("failed to setup audit log: %w", err)
+	}
+
+	sandbox, err := s.setupSandbox()
+	if err != nil {
+		return fmt.Errorf("failed to setup sandbox: %w", err)
+	}
+
+	keyExtractor, err := s.setupKeyExtractor()
+	if err != nil {
+		return fmt.Errorf("failed to setup key extractor: %w", err)
+	}
+
+	ruleEngine, err := s.setupRules()
+	if err != nil {
+		return fmt.Errorf("failed to setup rules: %w", err)
+	}
+
+	classifier, classProfiles, err := s.setupClassification()
+	if err != nil {
+		return fmt.Errorf("failed to setup classification: %w", err)
+	}
+
+	namedLimiters, err := s.setupLimiters()
+	if err != nil {
+		return fmt.Errorf("failed to setup limiters: %w", err)
+	}
+
+	rateLimitHandler := handlers.NewRateLimitHandler(defaultPolicy).
+		WithDenialLog(denialLog).
+		WithAuditLog(auditLog).
+		WithSandbox(sandbox).
+		WithTimeout(milliseconds(s.config.RateLimiter.TimeoutMs))
+	demoHandler := handlers.NewDemoHandler()
+	adminHandler := handlers.NewAdminHandler(s.policies).
+		WithDenialLog(denialLog).
+		WithThrottle(ratelimit.NewThrottle(s.redisClient)).
+		WithPenalties(s.penalties).
+		WithKeyNotes(ratelimit.NewKeyNotes(s.redisClient)).
+		WithNotifier(s.notifier).
+		WithTopKeys(s.topKeys).
+		WithKeyUsage(s.keyUsage).
+		WithStateTransfer(s.stateTransfer).
+		WithKeyMigration(s.backgroundCtx, s.keyMigration).
+		WithStats(s.config.RateLimiter.Strategy, prometheus.DefaultGatherer).
+		WithStrategySwitch(s.strategySwitch(defaultPolicy))
+	tailCtx, stopTails := context.WithCancel(s.backgroundCtx)
+	s.stopTails = stopTails
+	adminHandler.WithDecisionTail(tailCtx, s.decisionTail)
+
+	adminAuth, err := s.setupAdminAuth()
+	if err != nil {
+		return fmt.Errorf("failed to setup admin auth: %w", err)
+	}
+	readOnly := adminAuth.Require(middleware.RoleReadOnly)
+	adminOnly := adminAuth.Require(middleware.RoleAdmin)
+
+	s.router.GET("/health", handlers.Health)
+	s.router.GET("/health/ready", s.readiness.Ready)
+	s.router.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"service": "go-rate-limiter",
+			"version": "1.0.0",
+			"status":  "running",
+		})
+	})
+
+	namespaces := s.namespaceMiddleware()
+
+	rateLimit := s.router.Group("/rate-limit", namespaces...)
+	{
+		rateLimit.POST("", rateLimitHandler.RateLimit)
+		rateLimit.POST("/reset", adminOnly, rateLimitHandler.ResetRateLimit)
+		rateLimit.POST("/reserve", rateLimitHandler.Reserve)
+		rateLimit.GET("/quota", rateLimitHandler.QuotaUsage)
+		rateLimit.GET("/status", readOnlyForOtherKeys(readOnly), rateLimitHandler.Status)
+		rateLimit.POST("/test", readOnly, rateLimitHandler.Test)
+		rateLimit.POST("/test/reset", readOnly, rateLimitHandler.ResetTest)
+	}
+	s.router.GET("/metrics", handlers.MetricsHandler())
+
+	if crawlers := s.config.Crawlers; crawlers.Enabled && crawlers.RobotsTxt {
+		delays := make([]handlers.CrawlDelay, 0, len(crawlers.Crawlers))
+		for _, crawler := range crawlers.Crawlers {
+			delays = append(delays, handlers.CrawlDelay{
+				UserAgent: crawler.Name,
+				Delay:     time.Duration(crawler.CrawlDelaySeconds) * time.Second,
+			})
+		}
+		s.router.GET("/robots.txt", handlers.RobotsTxt(delays))
+	}
+
+	if s.config.Dashboard.Enabled {
+		s.router.StaticFS("/dashboard", handlers.DashboardFS())
+	}
+
+	rateLimitConfig := &middleware.RateLimitConfig{
+		KeyExtractor:     keyExtractor,
+		DenialLog:        denialLog,
+		AuditLog:         auditLog,
+		CoalesceWindow:   s.coalesceWindow(),
+		CoalesceMaxBatch: s.config.RateLimiter.Coalescing.MaxBatch,
+		KeyByRoute:       s.config.RateLimiter.KeyByRoute,
+		MaxWait:          time.Duration(s.config.RateLimiter.MaxWaitMs) * time.Millisecond,
+		MaxQueueDepth:    s.config.RateLimiter.MaxQueueDepth,
+		Timeout:          milliseconds(s.config.RateLimiter.TimeoutMs),
+		AbuseScoring:     s.abuseScoring(),
+		Mode: middleware.NewModeTracker(middleware.ModeConfig{
+			DryRun:    s.config.RateLimiter.DryRun,
+			FailOpen:  s.config.RateLimiter.FailOpen,
+			Collector: s.collectors.ForPolicy(ratelimit.DefaultPolicyName),
+		}),
+	}
+	countResponse, err := middleware.NewResponseCounter(middleware.ResponseCountingConfig{
+		CountStatusCodes:   s.config.RateLimiter.ResponseCounting.CountStatusCodes,
+		SkipStatusCodes:    s.config.RateLimiter.ResponseCounting.SkipStatusCodes,
+		RefundServerErrors: s.config.RateLimiter.ResponseCounting.RefundServerErrors,
+		CountHeaders:       headerMatches(s.config.RateLimiter.ResponseCounting.CountHeaders),
+		SkipHeaders:        headerMatches(s.config.RateLimiter.ResponseCounting.SkipHeaders),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure response counting: %w", err)
+	}
+	rateLimitConfig.CountResponse = countResponse
+
+	api := s.router.Group("/api", namespaces...)
+	if classifier != nil {
+		api.Use(middleware.Classify(classifier))
+	}
+	if shedder := s.setupLoadShedding(); shedder != nil {
+		// Shed before anything asks Redis, once the class is known.
+		api.Use(middleware.LoadShed(shedder))
+	}
+	if conns := s.config.RateLimiter.Connections; conns.Enabled {
+		connectionLimiter, err := ratelimit.NewConnectionLimiter(ratelimit.ConnectionLimiterConfig{
+			KeyPrefix:            conns.KeyPrefix,
+			MaxConnections:       conns.MaxPerKey,
+			LeaseTTL:             time.Duration(conns.LeaseTTLSeconds) * time.Second,
+			MessageBucketSize:    conns.MessageBucketSize,
+			MessageRatePerSecond: conns.MessageRatePerSecond,
+		}, s.redisClient)
+		if err != nil {
+			return fmt.Errorf("failed to configure connection limits: %w", err)
+		}
+		api.Use(middleware.ConnectionLimit(connectionLimiter, keyExtractor))
+	}
+	if graphQL := s.config.RateLimiter.GraphQL; graphQL.Enabled {
+		// Registered before the rules and classes below so the operation's
+		// cost is all it is charged.
+		if !ratelimit.SupportsBatch(defaultPolicy) && !ratelimit.SupportsReserve(defaultPolicy) {
+			log.Printf("Strategy %s can't charge GraphQL operations their cost; operations costing more than 1 will fail", s.config.RateLimiter.Strategy)
+		}
+		graphQLLimit := middleware.GraphQLRateLimit(defaultPolicy, s.graphQLConfig(), rateLimitConfig)
+		api.POST(graphQL.Path, graphQLLimit, demoHandler.GraphQLResource)
+		api.GET(graphQL.Path, graphQLLimit, demoHandler.GraphQLResource)
+	}
+	defaultLimit := middleware.RateLimit(defaultPolicy, rateLimitConfig)
+	if classifier != nil {
+		defaultLimit = middleware.ClassRateLimit(classProfiles, defaultPolicy, rateLimitConfig)
+	}
+	unrestricted := []gin.HandlerFunc{demoHandler.UnrestrictedResource}
+	if routes := s.config.RateLimiter.Routes; len(routes) > 0 {
+		routeLimits := make([]middleware.RouteLimit, 0, len(routes))
+		for _, route := range routes {
+			routeLimits = append(routeLimits, middleware.RouteLimit{Path: route.Path, Method: route.Method, Limiter: route.Limiter})
+		}
+		limiters := middleware.NewNamedLimiters(namedLimiters, rateLimitConfig)
+		defaultLimit, err = limiters.Routes(routeLimits, defaultLimit)
+		if err != nil {
+			return fmt.Errorf("failed to setup route limits: %w", err)
+		}
+		// Without rules or classes the unrestricted route has no default
+		// limit, but still gets its route's.
+		routeLimit, _ := limiters.Routes(routeLimits, nil)
+		unrestricted = append([]gin.HandlerFunc{routeLimit}, unrestricted...)
+	}
+	switch {
+	case ruleEngine != nil && (classifier != nil || len(s.config.RateLimiter.Routes) > 0):
+		// Requests no rule matches fall through to their route's or class's
+		// limit.
+		ruleSet := middleware.NewRuleSet(ruleEngine, nil, rateLimitConfig)
+		s.watchEtcdRules(ruleSet)
+		api.Use(ruleSet.Handler(), defaultLimit)
+		api.GET("/unrestricted", demoHandler.UnrestrictedResource)
+		api.GET("/restricted", demoHandler.RestrictedResource)
+	case ruleEngine != nil:
+		ruleSet := middleware.NewRuleSet(ruleEngine, defaultPolicy, rateLimitConfig)
+		s.watchEtcdRules(ruleSet)
+		api.Use(ruleSet.Handler())
+		api.GET("/unrestricted", demoHandler.UnrestrictedResource)
+		api.GET("/restricted", demoHandler.RestrictedResource)
+	default:
+		api.GET("/unrestricted", unrestricted...)
+		api.GET("/restricted", defaultLimit, demoHandler.RestrictedResource)
+	}
+
+	admin := s.router.Group("/admin")
+	{
+		admin.GET("/policies", readOnly, adminHandler.ListPolicies)
+		admin.PATCH("/policies/:name", adminOnly, adminHandler.UpdatePolicy)
+		admin.GET("/denials", readOnly, adminHandler.ExportDenials)
+		admin.GET("/throttle", readOnly, adminHandler.GetThrottle)
+		admin.POST("/throttle", adminOnly, adminHandler.SetThrottle)
+		admin.DELETE("/throttle", adminOnly, adminHandler.ClearThrottle)
+		admin.GET("/penalize", readOnly, adminHandler.GetPenalty)
+		admin.POST("/penalize", adminOnly, adminHandler.Penalize)
+		admin.DELETE("/penalize", adminOnly, adminHandler.ClearPenalty)
+		admin.GET("/bans", readOnly, adminHandler.ListBans)
+		admin.PUT("/notes", adminOnly, adminHandler.AnnotateKey)
+		admin.DELETE("/notes", adminOnly, adminHandler.ClearKeyNote)
+		admin.GET("/analytics/top-keys", readOnly, adminHandler.TopKeys)
+		admin.GET("/stats", readOnly, adminHandler.Stats)
+		admin.PUT("/strategy", adminOnly, adminHandler.SwitchStrategy)
+		admin.GET("/decisions/tail", readOnly, adminHandler.TailDecisions)
+		admin.DELETE("/keys/*key", adminOnly, adminHandler.ResetKey)
+		admin.GET("/keys/inspect", readOnly, adminHandler.InspectKey)
+		admin.GET("/keys/usage", readOnly, adminHandler.KeyUsage)
+		admin.POST("/keys/purge", adminOnly, adminHandler.PurgeIdleKeys)
+		admin.POST("/keys/migrate", adminOnly, adminHandler.MigrateKeys)
+		admin.GET("/keys/migrate/:id", readOnly, adminHandler.KeyMigrationStatus)
+		admin.GET("/state/export", adminOnly, adminHandler.ExportState)
+		admin.POST("/state/import", adminOnly, adminHandler.ImportState)
+		admin.GET("/observability/alerts", readOnly, handlers.AlertRulesHandler(metrics.AlertThresholds{
+			DenialRatio:       s.config.Observability.Alerts.DenialRatio,
+			ErrorRatio:        s.config.Observability.Alerts.ErrorRatio,
+			LatencyP99Seconds: s.config.Observability.Alerts.LatencyP99Seconds,
+			For:               s.config.Observability.Alerts.For,
+			Window:            s.config.Observability.Alerts.Window,
+		}))
+	}
+
+	// The document lists every route registered above, and itself.
+	routes := append(s.router.Routes(), gin.RouteInfo{Method: http.MethodGet, Path: "/openapi.json"})
+	openAPI := handlers.OpenAPI("go-rate-limiter", "1.0.0", routes, handlers.Operations)
+	s.router.GET("/openapi.json", handlers.OpenAPIHandler(openAPI))
+	return nil
+}
+
+func (s *Server) setupDenialLog() (*ratelimit.DenialLog, error) {
+	if !s.config.DenialLog.Enabled {
+		return nil, nil
+	}
+
+	denialLog, err := ratelimit.NewDenialLog(ratelimit.DenialLogConfig{
+		StreamKey:  s.config.DenialLog.StreamKey,
+		MaxEntries: s.config.DenialLog.MaxEntries,
+		Retention:  time.Duration(s.config.DenialLog.RetentionSeconds) * time.Second,
+	}, s.redisClient)
+	if err != nil {
+		return nil, err
+	}
+	denialLog.Start(s.backgroundCtx)
+	return denialLog, nil
+}
+
+func (s *Server) setupAuditLog() (*ratelimit.AuditLog, error) {
+	cfg := s.config.AuditLog
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var output io.Writer = os.Stdout
+	if cfg.Output != "" && cfg.Output != "stdout" {
+		file, err := ratelimit.OpenRotatingFile(cfg.Output, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		s.auditFile = file
+		output = file
+	}
+
+	auditLog, err := ratelimit.NewAuditLog(ratelimit.AuditLogConfig{
+		Output:          output,
+		AllowSampleRate: cfg.AllowSampleRate,
+		DenySampleRate:  cfg.DenySampleRate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	auditLog.Start(s.backgroundCtx)
+	s.auditLog = auditLog
+	return auditLog, nil
+}
+
+func (s *Server) setupPenalties() (*ratelimit.PenaltyBox, error) {
+	penalties := ratelimit.NewPenaltyBox(s.redisClient)
+	escalation := s.config.Penalties.Escalation
+	if !escalation.Enabled {
+		return penalties, nil
+	}
+
+	return penalties.WithEscalation(ratelimit.EscalationConfig{
+		MaxViolations: escalation.MaxViolations,
+		Window:        time.Duration(escalation.WindowSeconds) * time.Second,
+		BanDuration:   time.Duration(escalation.BanSeconds) * time.Second,
+	})
+}
+
+// setupNotifier returns a nil Notifier, rather than a nil *WebhookNotifier,
+// when notifications are off so callers can compare against nil.
+func (s *Server) setupNotifier() (notify.Notifier, error) {
+	cfg := s.config.Notifications
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	events := make([]notify.EventType, 0, len(cfg.Events))
+	for _, event := range cfg.Events {
+		events = append(events, notify.EventType(event))
+	}
+
+	notifier, err := notify.NewWebhookNotifier(notify.WebhookConfig{
+		URLs:           cfg.WebhookURLs,
+		Events:         events,
+		Cooldown:       time.Duration(cfg.CooldownSeconds) * time.Second,
+		MaxRetries:     cfg.MaxRetries,
+		InitialBackoff: time.Duration(cfg.InitialBackoffMs) * time.Millisecond,
+		Timeout:        time.Duration(cfg.TimeoutMs) * time.Millisecond,
+		QueueSize:      cfg.QueueSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	notifier.Start(s.backgroundCtx)
+	return notifier, nil
+}
+
+func (s *Server) setupSandbox() (*ratelimit.Sandbox, error) {
+	if !s.config.Sandbox.Enabled {
+		return nil, nil
+	}
+
+	sequence, err := ratelimit.ParseSandboxSequence(s.config.Sandbox.DefaultSequence)
+	if err != nil {
+		return nil, err
+	}
+
+	return ratelimit.NewSandbox(ratelimit.SandboxConfig{
+		DefaultSequence: sequence,
+		RetryAfter:      time.Duration(s.config.Sandbox.RetryAfterSeconds) * time.Second,
+	})
+}
+
+// strategySwitch rebuilds the default policy's limiter from another
+// configured strategy. GeoIP rules and regions hold scaled copies of the
+// startup strategy, so switching is refused while they are enabled, as is a
+// switch to a strategy lacking reservations, batches or refunds the running
+// one has.
+func (s *Server) strategySwitch(policy *ratelimit.Policy) func(strategy string) error {
+	return func(strategy string) error {
+		if s.config.Regions.Enabled || s.config.RateLimiter.GeoIP.Enabled {
+			return ratelimit.ErrStrategySwitchNotSupported
+		}
+		s.reloadMu.Lock()
+		defer s.reloadMu.Unlock()
+		previous := s.strategyManager.CurrentStrategy()
+		if err := s.strategyManager.UpdateStrategy(strategy, nil); err != nil {
+			return err
+		}
+
+		rateLimiter, err := s.defaultLimiter()
+		if err == nil {
+			err = ratelimit.CheckCapabilities(policy, rateLimiter)
+		}
+		if err != nil {
+			if rollbackErr := s.strategyManager.UpdateStrategy(previous, nil); rollbackErr != nil {
+				log.Printf("Failed to restore strategy %s: %v", previous, rollbackErr)
+			}
+			return err
+		}
+		policy.SetRateLimiter(rateLimiter)
+		log.Printf("Switched policy %s to strategy %s", policy.Name(), strategy)
+		return nil
+	}
+}
+
+// defaultLimiter builds the default policy's limiter from the current
+// strategy, with the experiment, evaluation, quarantine, latency budget and
+// async accounting around it.
+func (s *Server) defaultLimiter() (ratelimit.RateLimiter, error) {
+	rateLimiter, err := s.strategyManager.GetCurrentStrategy()
+	if err != nil {
+		return nil, err
+	}
+	if rateLimiter, err = s.setupExperiment(rateLimiter); err != nil {
+		return nil, err
+	}
+	if rateLimiter, err = s.setupEvaluation(rateLimiter); err != nil {
+		return nil, err
+	}
+	return s.withAsyncAccounting(s.withLatencyBudget(s.withQuarantine(rateLimiter)))
+}
+
+// setupQuarantine isolates namespaces whose Redis keys became slow from the
+// others when the quarantine is enabled.
+func (s *Server) setupQuarantine() {
+	cfg := s.config.Namespaces.Quarantine
+	if !s.config.Namespaces.Enabled || !cfg.Enabled {
+		return
+	}
+	s.quarantine = ratelimit.NewQuarantine(ratelimit.QuarantineConfig{
+		SlowThreshold: time.Duration(cfg.SlowMs) * time.Millisecond,
+		Window:        time.Duration(cfg.WindowSeconds) * time.Second,
+		MinRequests:   cfg.MinRequests,
+		SlowRatio:     cfg.SlowRatio,
+		Duration:      time.Duration(cfg.DurationSeconds) * time.Second,
+		Limit:         cfg.Limit,
+		Period:        time.Duration(cfg.LimitWindowSeconds) * time.Second,
+	}, s.collectors.ForPolicy(ratelimit.DefaultPolicyName), s.notifier)
+}
+
+// withQuarantine wraps the default policy's limiter with the quarantine.
+// Every limiter it builds shares the one quarantine, so a strategy switch
+// or reload keeps the namespaces in quarantine there.
+func (s *Server) withQuarantine(rateLimiter ratelimit.RateLimiter) ratelimit.RateLimiter {
+	if s.quarantine == nil {
+		return rateLimiter
+	}
+	return s.quarantine.Wrap(rateLimiter)
+}
+
+// withLatencyBudget lets the default policy's requests through when their
+// check runs over the latency budget, if enabled.
+func (s *Server) withLatencyBudget(rateLimiter ratelimit.RateLimiter) ratelimit.RateLimiter {
+	cfg := s.config.RateLimiter.LatencyBudget
+	if !cfg.Enabled {
+		return rateLimiter
+	}
+	return ratelimit.NewLatencyBudgetRateLimiter(rateLimiter, ratelimit.LatencyBudgetConfig{
+		Budget:     milliseconds(cfg.BudgetMs),
+		Timeout:    milliseconds(s.config.RateLimiter.TimeoutMs),
+		MaxPending: cfg.MaxPending,
+	}, s.collectors.ForPolicy(ratelimit.DefaultPolicyName))
+}
+
+// setupAsyncAccounting starts charging the default policy's requests in the
+// background when async accounting is enabled.
+func (s *Server) setupAsyncAccounting() {
+	cfg := s.config.RateLimiter.AsyncAccounting
+	if !cfg.Enabled {
+		return
+	}
+	s.asyncAccounts = ratelimit.NewAsyncAccounting(ratelimit.AsyncAccountingConfig{
+		BatchSize:     cfg.BatchSize,
+		FlushInterval: milliseconds(cfg.FlushIntervalMs),
+		BufferSize:    cfg.BufferSize,
+		Timeout:       milliseconds(s.config.RateLimiter.TimeoutMs),
+	})
+	s.asyncAccounts.Start(s.backgroundCtx)
+}
+
+// withAsyncAccounting wraps the default policy's limiter with async
+// accounting. Every limiter it builds shares the one buffer, so requests let
+// through before a strategy switch are still charged to the old strategy.
+// Strategies that can't decide batches are refused.
+func (s *Server) withAsyncAccounting(rateLimiter ratelimit.RateLimiter) (ratelimit.RateLimiter, error) {
+	if s.asyncAccounts == nil {
+		return rateLimiter, nil
+	}
+	wrapped, err := s.asyncAccounts.Wrap(rateLimiter)
+	if err != nil {
+		return nil, fmt.Errorf("async accounting needs a strategy deciding batches: %w", err)
+	}
+	return wrapped, nil
+}
+
+// setupEvaluation runs the shadow strategy next to rateLimiter when
+// evaluation is enabled. The shadow uses its configured limits, without
+// geoip rules or region shares. Evaluation pauses while the shadow strategy
+// is the enforced one, since both would count the same keys.
+func (s *Server) setupEvaluation(rateLimiter ratelimit.RateLimiter) (ratelimit.RateLimiter, error) {
+	evaluation := s.rateLimiterConfig.Evaluation
+	if !evaluation.Enabled {
+		return rateLimiter, nil
+	}
+
+	enforced := s.strategyManager.CurrentStrategy()
+	if evaluation.ShadowStrategy == enforced {
+		log.Printf("Strategy evaluation paused: %s is both enforced and shadow", enforced)
+		return rateLimiter, nil
+	}
+
+	shadow, err := s.strategyManager.GetShadowStrategy(evaluation.ShadowStrategy)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Evaluating strategy %s in the shadow of %s", evaluation.ShadowStrategy, enforced)
+	return ratelimit.NewShadowRateLimiter(rateLimiter, enforced, shadow, evaluation.ShadowStrategy,
+		s.collectors.ForPolicy(ratelimit.DefaultPolicyName)), nil
+}
+
+// setupExperiment splits the keys of rateLimiter with the experiment
+// strategy when the experiment is enabled. Like the shadow, the experiment
+// arm uses its configured limits, without geoip rules or region shares. The
+// experiment pauses while its strategy is the enforced one.
+func (s *Server) setupExperiment(rateLimiter ratelimit.RateLimiter) (ratelimit.RateLimiter, error) {
+	experiment := s.rateLimiterConfig.Experiment
+	if !experiment.Enabled {
+		return rateLimiter, nil
+	}
+
+	control := s.strategyManager.CurrentStrategy()
+	if experiment.Strategy == control {
+		log.Printf("Strategy experiment paused: %s is both control and experiment", control)
+		return rateLimiter, nil
+	}
+
+	treatment, err := s.strategyManager.GetStrategy(ratelimit.DefaultPolicyName, experiment.Strategy, ratelimit.StrategyOverrides{})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Experimenting with strategy %s for %.0f%% of keys, against %s", experiment.Strategy, experiment.Share*100, control)
+	return ratelimit.NewExperimentRateLimiter(rateLimiter, control, treatment, experiment.Strategy,
+		experiment.Share, experiment.Salt, s.collectors.ForPolicy(ratelimit.DefaultPolicyName)), nil
+}
+
+// setupRegions returns the current strategy, limited to this region's share
+// of it when regions are enabled.
+func (s *Server) setupRegions() (ratelimit.RateLimiter, error) {
+	regions := s.config.Regions
+	if !regions.Enabled {
+		return s.strategyManager.GetCurrentStrategy()
+	}
+
+	peers := make(map[string]*redis.Client, len(regions.Peers))
+	for name, peer := range regions.Peers {
+		options, err := redisOptions(peer)
+		if err != nil {
+			closeRedisClients(peers)
+			return nil, fmt.Errorf("region peer %s: %w", name, err)
+		}
+		client := redis.NewClient(options)
+		if err := metrics.RegisterRedisPoolMetrics(prometheus.DefaultRegisterer, "region:"+name, client); err != nil {
+			client.Close()
+			closeRedisClients(peers)
+			return nil, err
+		}
+		peers[name] = client
+	}
+
+	regional, err := ratelimit.NewRegionalRateLimiter(s.redisClient, ratelimit.RegionConfig{
+		Name:              regions.Name,
+		Shares:            regions.Shares,
+		Peers:             peers,
+		ReconcileInterval: time.Duration(regions.ReconcileIntervalSeconds) * time.Second,
+		MinShareFraction:  regions.MinShareFraction,
+	}, func(share float64) (ratelimit.RateLimiter, error) {
+		return s.strategyManager.GetScaledStrategy(ratelimit.DefaultPolicyName, share, "")
+	})
+	if err != nil {
+		closeRedisClients(peers)
+		return nil, err
+	}
+	s.regionPeers = peers
+	regional.Start(s.backgroundCtx)
+	return regional, nil
+}
+
+// closeRedisClients closes the clients of the named peer regions and drops
+// their pool metrics.
+func closeRedisClients(clients map[string]*redis.Client) {
+	for name, client := range clients {
+		if err := client.Close(); err != nil {
+			log.Printf("Error closing Redis connection to region %s: %v", name, err)
+		}
+		metrics.UnregisterRedisPoolMetrics(prometheus.DefaultRegisterer, "region:"+name)
+	}
+}
+
+// setupGeoIP routes clients matching a geoip rule to a copy of the strategy
+// with scaled limits and its own keys.
+func (s *Server) setupGeoIP(rateLimiter ratelimit.RateLimiter) (ratelimit.RateLimiter, error) {
+	geoIP := s.config.RateLimiter.GeoIP
+	if !geoIP.Enabled {
+		return rateLimiter, nil
+	}
+
+	lookup, err := ratelimit.OpenMaxMindGeoLookup(geoIP.CountryDB, geoIP.ASNDB)
+	if err != nil {
+		return nil, err
+	}
+	s.geoLookup = lookup
+
+	geo := ratelimit.NewGeoRateLimiter(lookup, rateLimiter)
+	for _, rule := range geoIP.Rules {
+		scaled, err := s.strategyManager.GetScaledStrategy(ratelimit.DefaultPolicyName, rule.LimitMultiplier, "geo:"+rule.Name)
+		if err != nil {
+			return nil, fmt.Errorf("geo rule %s: %w", rule.Name, err)
+		}
+		if err := geo.AddRule(ratelimit.GeoRule{
+			Name:            rule.Name,
+			Countries:       rule.Countries,
+			ASNs:            rule.ASNs,
+			LimitMultiplier: rule.LimitMultiplier,
+		}, scaled); err != nil {
+			return nil, err
+		}
+	}
+	return geo, nil
+}
+
+// newPolicy names rateLimiter as a policy reporting to its collector, with
+// the server's penalties, notifier and soft limit.
+func (s *Server) newPolicy(name string, rateLimiter ratelimit.RateLimiter) *ratelimit.Policy {
+	softLimit := s.config.RateLimiter.SoftLimit
+	return ratelimit.NewPolicy(name, rateLimiter, s.collectors.ForPolicy(name)).
+		WithPenalties(s.penalties).
+		WithNotifier(s.notifier).
+		WithSoftLimit(softLimit.Threshold, softLimit.Notify)
+}
+
+// setupRules builds the rule engine from configuration, registering a policy
+// per limit rule so each can be toggled and monitored on its own. With etcd
+// enabled the rules come from there instead, falling back to the configured
+// ones until a rule set has been pushed.
+func (s *Server) setupRules() (*rules.Engine, error) {
+	if !s.config.Rules.Enabled {
+		return nil, nil
+	}
+
+	ruleConfigs := s.config.Rules.Rules
+	if s.config.Rules.Etcd.Enabled {
+		var err error
+		if ruleConfigs, err = s.setupEtcdRules(); err != nil {
+			return nil, err
+		}
+	}
+
+	engine, policies, err := s.buildRules(ruleConfigs)
+	if err != nil {
+		return nil, err
+	}
+	for _, policy := range policies {
+		s.policies.Register(policy)
+	}
+	return engine, nil
+}
+
+// buildRules builds an engine from ruleConfigs and returns the policies of its
+// limit rules, leaving registering them to the caller.
+func (s *Server) buildRules(ruleConfigs []config.RuleConfig) (*rules.Engine, []*ratelimit.Policy, error) {
+	engine := rules.NewEngine(s.config.Rules.TierHeader)
+	var policies []*ratelimit.Policy
+	for _, ruleConfig := range ruleConfigs {
+		if ruleConfig.Name == ratelimit.DefaultPolicyName {
+			return nil, nil, fmt.Errorf("rule name %q is reserved", ruleConfig.Name)
+		}
+
+		cidrs := make([]netip.Prefix, 0, len(ruleConfig.Match.CIDRs))
+		for _, cidr := range ruleConfig.Match.CIDRs {
+			prefix, err := parsePrefix(cidr)
+			if err != nil {
+				return nil, nil, fmt.Errorf("rule %s: %w", ruleConfig.Name, err)
+			}
+			cidrs = append(cidrs, prefix)
+		}
+
+		rule := rules.Rule{
+			Name: ruleConfig.Name,
+			Match: rules.Matcher{
+				Paths:   ruleConfig.Match.Paths,
+				Methods: ruleConfig.Match.Methods,
+				Headers: ruleConfig.Match.Headers,
+				Tiers:   ruleConfig.Match.Tiers,
+				CIDRs:   cidrs,
+			},
+			Action: rules.Action(ruleConfig.Action),
+		}
+
+		if rule.Action == rules.ActionLimit {
+			// Rules from etcd skip config.Load, so their templates are
+			// resolved here.
+			if err := s.config.RateLimiter.ApplyTemplate(ruleConfig.Template, &ruleConfig.Strategy, &ruleConfig.Limit, &ruleConfig.WindowSeconds); err != nil {
+				return nil, nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+			strategy := ruleConfig.Strategy
+			if strategy == "" {
+				strategy = s.config.RateLimiter.Strategy
+			}
+			rateLimiter, err := s.strategyManager.GetStrategy(rule.Name, strategy, ratelimit.StrategyOverrides{
+				Limit:     ruleConfig.Limit,
+				Window:    time.Duration(ruleConfig.WindowSeconds) * time.Second,
+				KeySuffix: "rule:" + rule.Name,
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+			rule.Policy = s.newPolicy(rule.Name, rateLimiter)
+		}
+
+		if err := engine.Add(rule); err != nil {
+			return nil, nil, err
+		}
+		if rule.Policy != nil {
+			policies = append(policies, rule.Policy)
+		}
+	}
+
+	return engine, policies, nil
+}
+
+// setupClassification builds the request classifier and registers a policy,
+// named class:<name>, for each configured class and one, named
+// crawler:<name>, for each crawler. Crawlers are recognised first.
+func (s *Server) setupClassification() (middleware.Classifier, map[string]middleware.ClassProfile, error) {
+	var classifier middleware.Classifiers
+	profiles := make(map[string]middleware.ClassProfile)
+
+	if s.config.Crawlers.Enabled {
+		crawlers, err := s.setupCrawlers()
+		if err != nil {
+			return nil, nil, err
+		}
+		crawlerClassifier := middleware.NewCrawlerClassifier(crawlers)
+		classifier = append(classifier, crawlerClassifier)
+		maps.Copy(profiles, crawlerClassifier.Profiles())
+	}
+
+	classification := s.config.Classification
+	if !classification.Enabled {
+		if len(classifier) == 0 {
+			return nil, nil, nil
+		}
+		return classifier, profiles, nil
+	}
+
+	matches := make([]middleware.ClassMatch, 0, len(classification.Classes))
+	for _, classConfig := range classification.Classes {
+		match := classConfig.Match
+		if len(match.Headers) > 0 || len(match.CIDRs) > 0 || len(match.UserAgents) > 0 {
+			cidrs := make([]netip.Prefix, 0, len(match.CIDRs))
+			for _, cidr := range match.CIDRs {
+				prefix, err := parsePrefix(cidr)
+				if err != nil {
+					return nil, nil, fmt.Errorf("class %s: %w", classConfig.Name, err)
+				}
+				cidrs = append(cidrs, prefix)
+			}
+			matches = append(matches, middleware.ClassMatch{
+				Class:      classConfig.Name,
+				Headers:    match.Headers,
+				CIDRs:      cidrs,
+				UserAgents: match.UserAgents,
+			})
+		}
+
+		name := "class:" + classConfig.Name
+		strategy := classConfig.Strategy
+		if strategy == "" {
+			strategy = s.config.RateLimiter.Strategy
+		}
+		rateLimiter, err := s.strategyManager.GetStrategy(name, strategy, ratelimit.StrategyOverrides{
+			Limit:     classConfig.Limit,
+			Window:    time.Duration(classConfig.WindowSeconds) * time.Second,
+			KeySuffix: name,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("class %s: %w", classConfig.Name, err)
+		}
+		policy := s.newPolicy(name, rateLimiter)
+		s.policies.Register(policy)
+		profiles[classConfig.Name] = middleware.ClassProfile{Policy: policy}
+	}
+
+	classifier = append(classifier,
+		middleware.NewMatchClassifier(matches),
+		middleware.NewUserAgentClassifier(classification.BotUserAgents),
+		middleware.AnonymousClassifier(classification.CredentialHeaders),
+	)
+	return classifier, profiles, nil
+}
+
+// setupLimiters registers a policy, named limiter:<name>, for each named
+// limiter and returns them by name.
+func (s *Server) setupLimiters() (map[string]ratelimit.RateLimiter, error) {
+	limiters := make(map[string]ratelimit.RateLimiter, len(s.config.RateLimiter.Limiters))
+	for _, limiterConfig := range s.config.RateLimiter.Limiters {
+		name := "limiter:" + limiterConfig.Name
+		strategy := limiterConfig.Strategy
+		if strategy == "" {
+			strategy = s.config.RateLimiter.Strategy
+		}
+		rateLimiter, err := s.strategyManager.GetStrategy(name, strategy, ratelimit.StrategyOverrides{
+			Limit:     limiterConfig.Limit,
+			Window:    time.Duration(limiterConfig.WindowSeconds) * time.Second,
+			KeySuffix: name,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("limiter %s: %w", limiterConfig.Name, err)
+		}
+		policy := s.newPolicy(name, rateLimiter)
+		s.policies.Register(policy)
+		limiters[limiterConfig.Name] = policy
+	}
+	return limiters, nil
+}
+
+// setupCrawlers registers a policy per crawler allowing burst requests per
+// burst crawl delays.
+func (s *Server) setupCrawlers() ([]middleware.Crawler, error) {
+	crawlers := make([]middleware.Crawler, 0, len(s.config.Crawlers.Crawlers))
+	for _, crawlerConfig := range s.config.Crawlers.Crawlers {
+		cidrs := make([]netip.Prefix, 0, len(crawlerConfig.CIDRs))
+		for _, cidr := range crawlerConfig.CIDRs {
+			prefix, err := parsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("crawler %s: %w", crawlerConfig.Name, err)
+			}
+			cidrs = append(cidrs, prefix)
+		}
+
+		burst := max(1, crawlerConfig.Burst)
+		delay := time.Duration(crawlerConfig.CrawlDelaySeconds) * time.Second
+		name := "crawler:" + crawlerConfig.Name
+		rateLimiter, err := s.strategyManager.GetStrategy(name, s.config.Crawlers.Strategy, ratelimit.StrategyOverrides{
+			Limit:     burst,
+			Window:    time.Duration(burst) * delay,
+			KeySuffix: name,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("crawler %s: %w", crawlerConfig.Name, err)
+		}
+		policy := s.newPolicy(name, rateLimiter)
+		s.policies.Register(policy)
+
+		crawlers = append(crawlers, middleware.Crawler{
+			Name:       crawlerConfig.Name,
+			UserAgents: crawlerConfig.UserAgents,
+			CIDRs:      cidrs,
+			CrawlDelay: delay,
+			Policy:     policy,
+		})
+	}
+	return crawlers, nil
+}
+
+// parsePrefix accepts a CIDR or a single address.
+func parsePrefix(value string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid cidr %q", value)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// setupKeyExtractor returns nil to keep the middleware's default extractor.
+// Key fields take precedence on their routes, then the key template, and
+// both fall back to the JWT or default extractor.
+func (s *Server) setupKeyExtractor() (func(c *gin.Context) string, error) {
+	keyExtractor, err := s.setupJWTKeyExtractor()
+	if err != nil {
+		return nil, err
+	}
+
+	if keyTemplate := s.config.RateLimiter.KeyTemplate; keyTemplate.Enabled {
+		variables := make(map[string]middleware.KeyTemplateVariable, len(keyTemplate.Variables))
+		for _, variable := range keyTemplate.Variables {
+			variables[variable.Name] = middleware.KeyTemplateVariable{
+				Source: middleware.KeyTemplateSource(variable.Source),
+				Field:  variable.Field,
+			}
+		}
+		keyExtractor, err = middleware.NewKeyTemplateExtractor(middleware.KeyTemplateConfig{
+			Template:   keyTemplate.Template,
+			Variables:  variables,
+			TierHeader: s.config.Rules.TierHeader,
+			Fallback:   keyExtractor,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keyFields := s.config.RateLimiter.KeyFields
+	if !keyFields.Enabled {
+		return keyExtractor, nil
+	}
+
+	routes := make([]middleware.FieldKeyRoute, 0, len(keyFields.Routes))
+	for _, route := range keyFields.Routes {
+		routes = append(routes, middleware.FieldKeyRoute{
+			Path:   route.Path,
+			Method: route.Method,
+			Source: middleware.FieldKeySource(route.Source),
+			Field:  route.Field,
+		})
+	}
+	return middleware.NewFieldKeyExtractor(middleware.FieldKeyConfig{
+		Routes:       routes,
+		MaxBodyBytes: keyFields.MaxBodyBytes,
+		Fallback:     keyExtractor,
+	})
+}
+
+func headerMatches(matches []config.ResponseHeaderMatch) []middleware.HeaderMatch {
+	converted := make([]middleware.HeaderMatch, 0, len(matches))
+	for _, match := range matches {
+		converted = append(converted, middleware.HeaderMatch{Name: match.Name, Value: match.Value})
+	}
+	return converted
+}
+
+// messageCatalog holds the configured translations of error messages.
+func (s *Server) messageCatalog() middleware.Messages {
+	messages := middleware.Messages{}
+	for _, message := range s.config.Server.Localization.Messages {
+		messages.Add(language.Make(message.Language), message.Message, message.Translation)
+	}
+	return messages
+}
+
+// abuseScoring weighs /api requests by the anti-abuse score in the
+// configured header, or returns nil when abuse scoring is disabled.
+func (s *Server) abuseScoring() *middleware.AbuseScoring {
+	cfg := s.config.RateLimiter.AbuseScore
+	if !cfg.Enabled {
+		return nil
+	}
+
+	ranges := make([]middleware.ScoreRange, 0, len(cfg.Ranges))
+	for _, r := range cfg.Ranges {
+		ranges = append(ranges, middleware.ScoreRange{Min: r.Min, Max: r.Max, Multiplier: r.Multiplier})
+	}
+	return &middleware.AbuseScoring{
+		Scorer:   middleware.HeaderScorer{Header: cfg.Header},
+		Ranges:   ranges,
+		Unscored: cfg.UnscoredMultiplier,
+	}
+}
+
+// setupLoadShedding returns the load shedder sampling this node, or nil when
+// load shedding is disabled.
+func (s *Server) setupLoadShedding() *middleware.LoadShedder {
+	shedding := s.config.LoadShedding
+	if !shedding.Enabled {
+		return nil
+	}
+
+	priorities := make(map[string]int, len(shedding.Priorities))
+	for _, priority := range shedding.Priorities {
+		priorities[priority.Class] = priority.Priority
+	}
+	if len(priorities) > 0 && !s.config.Classification.Enabled {
+		log.Printf("Load shedding priorities need classification; every request gets the default priority")
+	}
+	shedder := middleware.NewLoadShedder(middleware.LoadShedConfig{
+		MaxInFlight:     shedding.MaxInFlight,
+		MaxGoroutines:   shedding.MaxGoroutines,
+		MaxCPU:          shedding.MaxCPU,
+		ShedFrom:        shedding.ShedFrom,
+		Priorities:      priorities,
+		DefaultPriority: shedding.DefaultPriority,
+		SampleInterval:  time.Duration(shedding.SampleIntervalMs) * time.Millisecond,
+		RetryAfter:      time.Duration(shedding.RetryAfterSeconds) * time.Second,
+		Collector:       s.collectors.ForPolicy(ratelimit.DefaultPolicyName),
+	})
+	go shedder.Run(s.backgroundCtx)
+	return shedder
+}
+
+func (s *Server) graphQLConfig() middleware.GraphQLConfig {
+	graphQL := s.config.RateLimiter.GraphQL
+	operations := make(map[string]int64, len(graphQL.Operations))
+	for _, operation := range graphQL.Operations {
+		operations[operation.Name] = operation.Cost
+	}
+	return middleware.GraphQLConfig{
+		MaxDepth:        graphQL.MaxDepth,
+		MaxComplexity:   graphQL.MaxComplexity,
+		ListArguments:   graphQL.ListArguments,
+		DefaultListSize: graphQL.DefaultListSize,
+		Operations:      operations,
+		MaxBodyBytes:    graphQL.MaxBodyBytes,
+	}
+}
+
+func (s *Server) setupJWTKeyExtractor() (func(c *gin.Context) string, error) {
+	jwtKey := s.config.RateLimiter.JWTKey
+	if !jwtKey.Enabled {
+		return nil, nil
+	}
+
+	cfg := middleware.JWTKeyConfig{
+		Claim:       jwtKey.Claim,
+		HMACSecret:  []byte(jwtKey.HMACSecret),
+		JWKSURL:     jwtKey.JWKSURL,
+		JWKSRefresh: time.Duration(jwtKey.JWKSRefreshSeconds) * time.Second,
+	}
+
+	if jwtKey.RSAPublicKeyFile != "" {
+		pemBytes, err := os.ReadFile(jwtKey.RSAPublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", jwtKey.RSAPublicKeyFile, err)
+		}
+		cfg.RSAPublicKey = publicKey
+	}
+
+	return middleware.NewJWTKeyExtractor(cfg)
+}
+
+func (s *Server) coalesceWindow() time.Duration {
+	if !s.config.RateLimiter.Coalescing.Enabled {
+		return 0
+	}
+	return time.Duration(s.config.RateLimiter.Coalescing.MaxDelayMs) * time.Millisecond
+}
+
+func (s *Server) namespaceMiddleware() []gin.HandlerFunc {
+	if !s.config.Namespaces.Enabled {
+		return nil
+	}
+
+	allowed := make(map[string]string, len(s.config.Namespaces.Allowed))
+	for name, namespace := range s.config.Namespaces.Allowed {
+		allowed[name] = namespace.Token
+	}
+
+	return []gin.HandlerFunc{middleware.Namespace(middleware.NamespaceConfig{
+		Namespaces: allowed,
+		Required:   s.config.Namespaces.Required,
+	})}
+}
+
+// setupAdminAuth returns nil, which lets every caller through, when admin
+// auth is disabled.
+func (s *Server) setupAdminAuth() (*middleware.AdminAuth, error) {
+	cfg := s.config.AdminAuth
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tokens := make(map[string]middleware.AdminPrincipal, len(cfg.Tokens))
+	for name, token := range cfg.Tokens {
+		if _, duplicate := tokens[token.Token]; duplicate {
+			return nil, fmt.Errorf("admin token for %s is already used by another caller", name)
+		}
+		tokens[token.Token] = middleware.AdminPrincipal{Name: name, Role: middleware.Role(token.Role)}
+	}
+	clientCerts := make(map[string]middleware.Role, len(cfg.ClientCerts))
+	for commonName, cert := range cfg.ClientCerts {
+		clientCerts[commonName] = middleware.Role(cert.Role)
+	}
+	if len(tokens) == 0 && len(clientCerts) == 0 {
+		return nil, fmt.Errorf("admin_auth is enabled but no tokens or client certificates are configured")
+	}
+	if len(clientCerts) > 0 && (!s.tlsEnabled() || s.config.Server.TLSClientCAFile == "") {
+		return nil, fmt.Errorf("admin_auth.client_certs requires server TLS with tls_client_ca_file")
+	}
+
+	return middleware.NewAdminAuth(middleware.AdminAuthConfig{
+		Tokens:      tokens,
+		ClientCerts: clientCerts,
+	})
+}
+
+func (s *Server) setupHTTPServer() error {
+	cfg := s.config.Server
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return fmt.Errorf("server.tls_cert_file and server.tls_key_file must be set together")
+	}
+	for _, timeout := range []struct {
+		field   string
+		seconds int
+	}{
+		{"server.read_timeout_seconds", cfg.ReadTimeoutSeconds},
+		{"server.read_header_timeout_seconds", cfg.ReadHeaderTimeoutSeconds},
+		{"server.write_timeout_seconds", cfg.WriteTimeoutSeconds},
+		{"server.idle_timeout_seconds", cfg.IdleTimeoutSeconds},
+	} {
+		// Zero leaves the timeout off.
+		if timeout.seconds < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", timeout.field, timeout.seconds)
+		}
+	}
+	writeTimeout := time.Duration(cfg.WriteTimeoutSeconds) * time.Second
+	if maxWait := time.Duration(s.config.RateLimiter.MaxWaitMs) * time.Millisecond; writeTimeout > 0 && maxWait >= writeTimeout {
+		return fmt.Errorf("server.write_timeout_seconds must exceed rate_limiter.max_wait_ms")
+	}
+
+	// Without TLS HTTP/2 is only available as h2c, which gin serves itself.
+	s.router.UseH2C = cfg.HTTP2 && !s.tlsEnabled()
+	s.httpServer = &http.Server{
+		Addr:              cfg.Port,
+		Handler:           s.router.Handler(),
+		ReadTimeout:       time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeoutSeconds) * time.Second,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       time.Duration(cfg.IdleTimeoutSeconds) * time.Second,
+	}
+
+	// Shutdown doesn't cancel requests, so open decision tails are ended
+	// explicitly.
+	s.httpServer.RegisterOnShutdown(s.stopTails)
+
+	if cfg.Autocert.Enabled {
+		if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+			return fmt.Errorf("server.autocert cannot be combined with tls_cert_file")
+		}
+		if len(cfg.Autocert.Domains) == 0 {
+			return fmt.Errorf("server.autocert is enabled but no domains are configured")
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.Autocert.Domains...),
+			Cache:      autocert.DirCache(cfg.Autocert.CacheDir),
+			Email:      cfg.Autocert.Email,
+		}
+		s.httpServer.TLSConfig = manager.TLSConfig()
+	}
+
+	if caFile := cfg.TLSClientCAFile; caFile != "" {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %w", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no certificates found in %s", caFile)
+		}
+		if s.httpServer.TLSConfig == nil {
+			s.httpServer.TLSConfig = &tls.Config{}
+		}
+		// Clients without a certificate can still authenticate with a token.
+		s.httpServer.TLSConfig.ClientCAs = clientCAs
+		s.httpServer.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	if !cfg.HTTP2 && s.tlsEnabled() {
+		// A non-nil TLSNextProto stops net/http from offering h2.
+		s.httpServer.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		if s.httpServer.TLSConfig != nil {
+			s.httpServer.TLSConfig.NextProtos = slices.DeleteFunc(s.httpServer.TLSConfig.NextProtos, func(proto string) bool {
+				return proto == "h2"
+			})
+		}
+	}
+	return nil
+}
+
+// readOnlyForOtherKeys lets callers report on their own key, and requires
+// readOnly to name another with ?key=.
+func readOnlyForOtherKeys(readOnly gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("key") != "" {
+			readOnly(c)
+		}
+	}
+}
+
+func (s *Server) tlsEnabled() bool {
+	cfg := s.config.Server
+	return cfg.Autocert.Enabled || (cfg.TLSCertFile != "" && cfg.TLSKeyFile != "")
+}
+
+// Router is the engine serving the server's routes.
+func (s *Server) Router() *gin.Engine {
+	return s.router
+}
+
+// Run starts the server and serves until SIGINT or SIGTERM, reloading the
+// config on SIGHUP, then drains and shuts down.
+func (s *Server) Run() error {
+	s.Start()
+	s.watchReloads()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down server...")
+
+	// Keep serving while load balancers notice the failing readiness check.
+	s.readiness.Drain()
+	if drain := time.Duration(s.config.Server.DrainSeconds) * time.Second; drain > 0 {
+		log.Printf("Draining for %s with %d requests in flight", drain, s.readiness.InFlight())
+		time.Sleep(drain)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
+
+// Start listens on the configured port in the background.
+func (s *Server) Start() {
+	go func() {
+		log.Printf("Starting server on %s", s.config.Server.Port)
+		var err error
+		if s.tlsEnabled() {
+			// Empty with autocert, whose TLSConfig supplies the certificates.
+			err = s.httpServer.ListenAndServeTLS(s.config.Server.TLSCertFile, s.config.Server.TLSKeyFile)
+		} else {
+			err = s.httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+}
+
+// Shutdown stops the HTTP server, if started, and the background work, and
+// closes the connections the server opened. Decisions still buffered for the
+// decision stream, requests not yet charged by async accounting and queued
+// audit records are flushed until ctx is done. A step that fails doesn't
+// stop the others; their errors are returned together.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var errs []error
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		log.Printf("Server forced to shutdown with %d requests in flight: %v", s.readiness.InFlight(), err)
+		errs = append(errs, fmt.Errorf("failed to shut down HTTP server: %w", err))
+	}
+	s.stopBackground()
+
+	wait := func(done <-chan struct{}, what string) {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			log.Printf("Gave up %s: %v", what, ctx.Err())
+			errs = append(errs, fmt.Errorf("gave up %s: %w", what, ctx.Err()))
+		}
+	}
+
+	if s.asyncAccounts != nil {
+		wait(s.asyncAccounts.Done(), "charging requests let through by async accounting")
+	}
+	if s.leader != nil {
+		wait(s.leader.Done(), "handing over leadership")
+	}
+	if s.auditLog != nil {
+		wait(s.auditLog.Done(), "writing the audit log")
+	}
+	if s.decisions != nil {
+		s.stopDecisions()
+		wait(s.decisions.Done(), "flushing decision stream")
+	}
+
+	s.closeConnections()
+
+	log.Println("Server exited")
+	return errors.Join(errs...)
+}
+
+// closeConnections closes the connections the server opened, skipping any
+// setup didn't get to.
+func (s *Server) closeConnections() {
+	if s.redisClient != nil && s.injected.redisClient == nil {
+		if err := s.redisClient.Close(); err != nil {
+			log.Printf("Error closing Redis connection: %v", err)
+		}
+		metrics.UnregisterRedisPoolMetrics(prometheus.DefaultRegisterer, "main")
+	}
+	if s.readClient != nil && s.readClient != s.redisClient {
+		if err := s.readClient.Close(); err != nil {
+			log.Printf("Error closing Redis replica connection: %v", err)
+		}
+		metrics.UnregisterRedisPoolMetrics(prometheus.DefaultRegisterer, "replica")
+	}
+	closeRedisClients(s.regionPeers)
+	s.regionPeers = nil
+
+	if s.postgresPool != nil {
+		s.postgresPool.Close()
+	}
+
+	if s.etcdClient != nil {
+		if err := s.etcdClient.Close(); err != nil {
+			log.Printf("Error closing etcd connection: %v", err)
+		}
+	}
+
+	if s.auditFile != nil {
+		if err := s.auditFile.Close(); err != nil {
+			log.Printf("Error closing audit log: %v", err)
+		}
+	}
+
+	if s.geoLookup != nil {
+		if err := s.geoLookup.Close(); err != nil {
+			log.Printf("Error closing GeoIP databases: %v", err)
+		}
+	}
+
+	if s.collectors != nil {
+		if err := s.collectors.Close(); err != nil {
+			log.Printf("Error closing metrics collectors: %v", err)
+		}
+	}
+}
@@ -0,0 +1,572 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/pmujumdar27/go-rate-limiter/internal/config"
+	"github.com/pmujumdar27/go-rate-limiter/internal/metrics"
+	"github.com/pmujumdar27/go-rate-limiter/internal/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewServer_Embedded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	redisServer := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	cfg.Observability.DefaultCollector = "noop"
+	cfg.Observability.Collectors = map[string]config.CollectorConfig{"noop": {Type: "noop"}}
+
+	app := gin.New()
+	app.GET("/app", func(c *gin.Context) { c.String(http.StatusOK, "app") })
+
+	srv, err := NewServer(cfg, WithRouter(app), WithRedisClient(client))
+	require.NoError(t, err)
+	assert.Same(t, app, srv.Router())
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/app", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "the app keeps its routes")
+
+	req := httptest.NewRequest("POST", "/rate-limit", nil)
+	req.Header.Set("X-Client-ID", "test-client")
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, redisServer.Keys(), "decisions are stored in the injected Redis")
+
+	require.NoError(t, srv.Shutdown(context.Background()))
+	assert.NoError(t, client.Ping(context.Background()).Err(), "the injected client is left open")
+}
+
+func newTestServer(t *testing.T, configure func(cfg *Config)) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	redisServer := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	cfg.Observability.DefaultCollector = "noop"
+	cfg.Observability.Collectors = map[string]config.CollectorConfig{"noop": {Type: "noop"}}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	srv, err := NewServer(cfg, WithRouter(gin.New()), WithRedisClient(client))
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return srv
+}
+
+func TestNewServer_ReturnsSetupErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	redisServer := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	cfg.Observability.DefaultCollector = "noop"
+	cfg.Observability.Collectors = map[string]config.CollectorConfig{"noop": {Type: "noop"}}
+	cfg.Server.Autocert.Enabled = true
+
+	var srv *Server
+	require.NotPanics(t, func() {
+		srv, err = NewServer(cfg, WithRouter(gin.New()), WithRedisClient(client))
+	})
+	assert.ErrorContains(t, err, "no domains are configured")
+	assert.Nil(t, srv)
+	assert.NoError(t, client.Ping(context.Background()).Err(), "the injected client isn't the server's to close")
+}
+
+func TestShutdown_ClosesRegionPeers(t *testing.T) {
+	srv := newTestServer(t, withRegionPeer(t, "eu-west"))
+	client := srv.regionPeers["eu-west"]
+	require.NotNil(t, client)
+	require.NoError(t, client.Ping(context.Background()).Err())
+
+	require.NoError(t, srv.Shutdown(context.Background()))
+
+	assert.ErrorIs(t, client.Ping(context.Background()).Err(), redis.ErrClosed)
+}
+
+func TestShutdown_ClosesConnectionsWhenForced(t *testing.T) {
+	srv := newTestServer(t, withRegionPeer(t, "eu-west"))
+	client := srv.regionPeers["eu-west"]
+	require.NotNil(t, client)
+
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	srv.router.GET("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.httpServer.Serve(listener)
+	go http.Get("http://" + listener.Addr().String() + "/slow")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, client.Ping(context.Background()).Err(), redis.ErrClosed, "connections are closed even when the HTTP server didn't stop in time")
+}
+
+// withRegionPeer enables regions with a peer called name backed by its own
+// miniredis.
+func withRegionPeer(t *testing.T, name string) func(cfg *Config) {
+	peer := miniredis.RunT(t)
+	port, err := strconv.Atoi(peer.Port())
+	require.NoError(t, err)
+	return func(cfg *Config) {
+		cfg.Regions = config.RegionsConfig{
+			Enabled:                  true,
+			Name:                     "us-east",
+			Shares:                   map[string]float64{"us-east": 0.5, name: 0.5},
+			Peers:                    map[string]config.RedisConfig{name: {Host: peer.Host(), Port: port}},
+			ReconcileIntervalSeconds: 10,
+			MinShareFraction:         0.5,
+		}
+	}
+}
+
+func TestStrategySwitch_RefusesLostCapabilities(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.RateLimiter.Strategy = "token_bucket"
+	})
+	policy, ok := srv.policies.Get(ratelimit.DefaultPolicyName)
+	require.True(t, ok)
+	switchStrategy := srv.strategySwitch(policy)
+
+	err := switchStrategy("sliding_window_counter")
+	assert.ErrorIs(t, err, ratelimit.ErrCapabilityLost, "the middleware reserves and batches through the token bucket")
+	assert.Equal(t, "token_bucket", srv.strategyManager.CurrentStrategy())
+	assert.True(t, ratelimit.SupportsReserve(policy))
+
+	srv = newTestServer(t, nil)
+	policy, ok = srv.policies.Get(ratelimit.DefaultPolicyName)
+	require.True(t, ok)
+	require.NoError(t, srv.strategySwitch(policy)("token_bucket"), "gaining capabilities is fine")
+	assert.Equal(t, "token_bucket", srv.strategyManager.CurrentStrategy())
+}
+
+func TestActiveKeyPattern_FollowsStrategySwitch(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.RateLimiter.Strategy = "sliding_window_log"
+		cfg.RateLimiter.ActiveKeys.Enabled = true
+	})
+	policy, ok := srv.policies.Get(ratelimit.DefaultPolicyName)
+	require.True(t, ok)
+
+	strategy, pattern, err := srv.activeKeyPattern()
+	require.NoError(t, err)
+	assert.Equal(t, "sliding_window_log", strategy)
+	assert.Equal(t, ratelimit.ActiveKeyPattern(strategy, srv.config.RateLimiter.Strategies.SlidingWindowLog.KeyPrefix), pattern)
+
+	require.NoError(t, srv.strategySwitch(policy)("sliding_window_counter"))
+	strategy, pattern, err = srv.activeKeyPattern()
+	require.NoError(t, err)
+	assert.Equal(t, "sliding_window_counter", strategy)
+	assert.Equal(t, ratelimit.ActiveKeyPattern(strategy, srv.config.RateLimiter.Strategies.SlidingWindowCounter.KeyPrefix), pattern)
+}
+
+func TestRateLimitRoutes_RequireAuthForOtherKeys(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.Sandbox.Enabled = true
+		cfg.AdminAuth.Enabled = true
+		cfg.AdminAuth.Tokens = map[string]config.AdminTokenConfig{"ops": {Token: "secret", Role: "read_only"}}
+	})
+
+	for _, tc := range []struct {
+		method, target, token string
+		status                int
+	}{
+		{"GET", "/rate-limit/status", "", http.StatusOK},
+		{"GET", "/rate-limit/status?key=customer", "", http.StatusUnauthorized},
+		{"GET", "/rate-limit/status?key=customer", "secret", http.StatusOK},
+		{"POST", "/rate-limit/test", "", http.StatusUnauthorized},
+		{"POST", "/rate-limit/test", "secret", http.StatusOK},
+		{"POST", "/rate-limit/test/reset", "", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		srv.Router().ServeHTTP(w, req)
+		assert.Equal(t, tc.status, w.Code, "%s %s with token %q", tc.method, tc.target, tc.token)
+	}
+}
+
+func TestRedisTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir)
+	garbage := filepath.Join(dir, "garbage.pem")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a certificate"), 0o600))
+
+	tests := []struct {
+		name   string
+		tls    config.RedisTLSConfig
+		err    string
+		verify func(t *testing.T, tlsConfig *tls.Config)
+	}{
+		{
+			name: "disabled",
+			tls:  config.RedisTLSConfig{CAFile: garbage},
+			verify: func(t *testing.T, tlsConfig *tls.Config) {
+				assert.Nil(t, tlsConfig)
+			},
+		},
+		{
+			name: "server name defaults to the host",
+			tls:  config.RedisTLSConfig{Enabled: true},
+			verify: func(t *testing.T, tlsConfig *tls.Config) {
+				assert.Equal(t, "redis.internal", tlsConfig.ServerName)
+				assert.False(t, tlsConfig.InsecureSkipVerify)
+				assert.Nil(t, tlsConfig.RootCAs, "the system roots are used")
+				assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+			},
+		},
+		{
+			name: "server name",
+			tls:  config.RedisTLSConfig{Enabled: true, ServerName: "cache.example.com"},
+			verify: func(t *testing.T, tlsConfig *tls.Config) {
+				assert.Equal(t, "cache.example.com", tlsConfig.ServerName)
+			},
+		},
+		{
+			name: "insecure skip verify",
+			tls:  config.RedisTLSConfig{Enabled: true, InsecureSkipVerify: true},
+			verify: func(t *testing.T, tlsConfig *tls.Config) {
+				assert.True(t, tlsConfig.InsecureSkipVerify)
+			},
+		},
+		{
+			name: "CA and client certificate",
+			tls:  config.RedisTLSConfig{Enabled: true, CAFile: certFile, CertFile: certFile, KeyFile: keyFile},
+			verify: func(t *testing.T, tlsConfig *tls.Config) {
+				assert.NotNil(t, tlsConfig.RootCAs)
+				assert.Len(t, tlsConfig.Certificates, 1)
+			},
+		},
+		{
+			name: "missing CA file",
+			tls:  config.RedisTLSConfig{Enabled: true, CAFile: filepath.Join(dir, "missing.pem")},
+			err:  "failed to read CA",
+		},
+		{
+			name: "unparseable CA file",
+			tls:  config.RedisTLSConfig{Enabled: true, CAFile: garbage},
+			err:  "no certificates found in " + garbage,
+		},
+		{
+			name: "client certificate without key",
+			tls:  config.RedisTLSConfig{Enabled: true, CertFile: certFile},
+			err:  "tls cert_file and key_file must be set together",
+		},
+		{
+			name: "client key without certificate",
+			tls:  config.RedisTLSConfig{Enabled: true, KeyFile: keyFile},
+			err:  "tls cert_file and key_file must be set together",
+		},
+		{
+			name: "unparseable client certificate",
+			tls:  config.RedisTLSConfig{Enabled: true, CertFile: garbage, KeyFile: keyFile},
+			err:  "failed to load client certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := redisTLSConfig(config.RedisConfig{Host: "redis.internal", Port: 6380, TLS: tt.tls})
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			tt.verify(t, tlsConfig)
+		})
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for localhost, usable
+// as its own CA, and its key to dir.
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestSetupHTTPServer(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, t.TempDir())
+
+	tests := []struct {
+		name      string
+		configure func(cfg *config.ServerConfig)
+		err       string
+		verify    func(t *testing.T, s *Server)
+	}{
+		{
+			name: "h2c without TLS",
+			verify: func(t *testing.T, s *Server) {
+				assert.True(t, s.router.UseH2C)
+				assert.Nil(t, s.httpServer.TLSConfig)
+			},
+		},
+		{
+			name: "no h2c with TLS",
+			configure: func(cfg *config.ServerConfig) {
+				cfg.TLSCertFile, cfg.TLSKeyFile = certFile, keyFile
+			},
+			verify: func(t *testing.T, s *Server) {
+				assert.False(t, s.router.UseH2C, "h2 is negotiated over TLS instead")
+				assert.Nil(t, s.httpServer.TLSNextProto)
+			},
+		},
+		{
+			name: "TLS with client certificates and without HTTP/2",
+			configure: func(cfg *config.ServerConfig) {
+				cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile = certFile, keyFile, certFile
+				cfg.HTTP2 = false
+			},
+			verify: func(t *testing.T, s *Server) {
+				assert.False(t, s.router.UseH2C)
+				require.NotNil(t, s.httpServer.TLSConfig)
+				assert.NotNil(t, s.httpServer.TLSConfig.ClientCAs)
+				assert.Equal(t, tls.VerifyClientCertIfGiven, s.httpServer.TLSConfig.ClientAuth)
+				assert.NotNil(t, s.httpServer.TLSNextProto, "h2 isn't offered")
+			},
+		},
+		{
+			name: "zero timeouts",
+			configure: func(cfg *config.ServerConfig) {
+				cfg.ReadTimeoutSeconds, cfg.ReadHeaderTimeoutSeconds, cfg.WriteTimeoutSeconds, cfg.IdleTimeoutSeconds = 0, 0, 0, 0
+			},
+			verify: func(t *testing.T, s *Server) {
+				assert.Zero(t, s.httpServer.ReadTimeout)
+				assert.Zero(t, s.httpServer.ReadHeaderTimeout)
+				assert.Zero(t, s.httpServer.WriteTimeout)
+				assert.Zero(t, s.httpServer.IdleTimeout)
+			},
+		},
+		{
+			name: "timeouts",
+			configure: func(cfg *config.ServerConfig) {
+				cfg.ReadTimeoutSeconds, cfg.ReadHeaderTimeoutSeconds, cfg.WriteTimeoutSeconds, cfg.IdleTimeoutSeconds = 15, 5, 30, 120
+			},
+			verify: func(t *testing.T, s *Server) {
+				assert.Equal(t, 15*time.Second, s.httpServer.ReadTimeout)
+				assert.Equal(t, 5*time.Second, s.httpServer.ReadHeaderTimeout)
+				assert.Equal(t, 30*time.Second, s.httpServer.WriteTimeout)
+				assert.Equal(t, 120*time.Second, s.httpServer.IdleTimeout)
+			},
+		},
+		{
+			name: "negative timeout",
+			configure: func(cfg *config.ServerConfig) {
+				cfg.IdleTimeoutSeconds = -1
+			},
+			err: "server.idle_timeout_seconds must not be negative, got -1",
+		},
+		{
+			name: "certificate without key",
+			configure: func(cfg *config.ServerConfig) {
+				cfg.TLSCertFile = certFile
+			},
+			err: "server.tls_cert_file and server.tls_key_file must be set together",
+		},
+		{
+			name: "key without certificate",
+			configure: func(cfg *config.ServerConfig) {
+				cfg.TLSKeyFile = keyFile
+			},
+			err: "server.tls_cert_file and server.tls_key_file must be set together",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig()
+			require.NoError(t, err)
+			cfg.Server.HTTP2 = true
+			if tt.configure != nil {
+				tt.configure(&cfg.Server)
+			}
+			s := &Server{config: cfg, router: gin.New(), stopTails: func() {}}
+
+			err = s.setupHTTPServer()
+
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			tt.verify(t, s)
+		})
+	}
+}
+
+func TestRedisOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		redis  config.RedisConfig
+		verify func(t *testing.T, options *redis.Options)
+	}{
+		{
+			name: "configured",
+			redis: config.RedisConfig{
+				Host: "redis.internal", Port: 6380, Username: "rl", Password: "secret", DB: 2,
+				PoolSize: 50, MinIdleConns: 5, MaxRetries: 4,
+				DialTimeoutMs: 1500, ReadTimeoutMs: 250, WriteTimeoutMs: 300, PoolTimeoutMs: 2000,
+			},
+			verify: func(t *testing.T, options *redis.Options) {
+				assert.Equal(t, "redis.internal:6380", options.Addr)
+				assert.Equal(t, "rl", options.Username)
+				assert.Equal(t, "secret", options.Password)
+				assert.Equal(t, 2, options.DB)
+				assert.Equal(t, 50, options.PoolSize)
+				assert.Equal(t, 5, options.MinIdleConns)
+				assert.Equal(t, 4, options.MaxRetries)
+				assert.Equal(t, 1500*time.Millisecond, options.DialTimeout)
+				assert.Equal(t, 250*time.Millisecond, options.ReadTimeout)
+				assert.Equal(t, 300*time.Millisecond, options.WriteTimeout)
+				assert.Equal(t, 2*time.Second, options.PoolTimeout)
+				assert.Nil(t, options.TLSConfig)
+			},
+		},
+		{
+			name:  "zero values leave go-redis defaults",
+			redis: config.RedisConfig{Host: "localhost", Port: 6379},
+			verify: func(t *testing.T, options *redis.Options) {
+				assert.Zero(t, options.PoolSize)
+				assert.Zero(t, options.MinIdleConns)
+				assert.Zero(t, options.ReadTimeout)
+
+				defaults := redis.NewClient(options)
+				defer defaults.Close()
+				assert.Positive(t, defaults.Options().PoolSize)
+				assert.Equal(t, 5*time.Second, defaults.Options().DialTimeout)
+				assert.Equal(t, 3*time.Second, defaults.Options().ReadTimeout)
+			},
+		},
+		{
+			name:  "negative timeouts disable them",
+			redis: config.RedisConfig{Host: "localhost", Port: 6379, ReadTimeoutMs: -1, WriteTimeoutMs: -5},
+			verify: func(t *testing.T, options *redis.Options) {
+				assert.Equal(t, time.Duration(-1), options.ReadTimeout)
+				assert.Equal(t, time.Duration(-1), options.WriteTimeout)
+			},
+		},
+		{
+			name:  "TLS",
+			redis: config.RedisConfig{Host: "redis.internal", Port: 6380, TLS: config.RedisTLSConfig{Enabled: true}},
+			verify: func(t *testing.T, options *redis.Options) {
+				require.NotNil(t, options.TLSConfig)
+				assert.Equal(t, "redis.internal", options.TLSConfig.ServerName)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := redisOptions(tt.redis)
+			require.NoError(t, err)
+			tt.verify(t, options)
+		})
+	}
+
+	_, err := redisOptions(config.RedisConfig{Host: "redis.internal", TLS: config.RedisTLSConfig{Enabled: true, CertFile: "cert.pem"}})
+	assert.ErrorContains(t, err, "redis redis.internal: tls cert_file and key_file must be set together")
+}
+
+func TestNewServer_RegistersRedisPoolMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	redisServer := miniredis.RunT(t)
+	port, err := strconv.Atoi(redisServer.Port())
+	require.NoError(t, err)
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	cfg.Observability.DefaultCollector = "noop"
+	cfg.Observability.Collectors = map[string]config.CollectorConfig{"noop": {Type: "noop"}}
+	cfg.Redis.Host, cfg.Redis.Port = redisServer.Host(), port
+
+	srv, err := NewServer(cfg, WithRouter(gin.New()))
+	require.NoError(t, err)
+	assert.True(t, hasRedisPoolMetrics(t, "main"))
+
+	require.NoError(t, srv.Shutdown(context.Background()))
+	assert.False(t, hasRedisPoolMetrics(t, "main"), "a later server can register its own client")
+}
+
+func hasRedisPoolMetrics(t *testing.T, client string) bool {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != metrics.RedisPoolMetricPrefix+"connections" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "client" && label.GetValue() == client {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}